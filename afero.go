@@ -43,6 +43,10 @@ type File interface {
 	io.WriterAt
 
 	Name() string
+	// Readdir and Readdirnames follow the contract of os.File: for n > 0
+	// they return up to n entries, continuing where the call before
+	// stopped, and no entries with io.EOF once all were returned; for
+	// n <= 0 they return all remaining entries and a nil error.
 	Readdir(count int) ([]os.FileInfo, error)
 	Readdirnames(n int) ([]string, error)
 	Stat() (os.FileInfo, error)
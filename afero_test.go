@@ -16,15 +16,18 @@ package afero
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	iofs "io/fs"
 	"os"
 	"path/filepath"
+	"regexp"
 	"runtime"
 	"strings"
 	"syscall"
 	"testing"
+	"time"
 )
 
 var (
@@ -77,6 +80,49 @@ func TestRead0(t *testing.T) {
 	}
 }
 
+// Zero length reads and writes must behave like they do on *os.File: they
+// return 0, nil wherever the file offset is and do not modify the file.
+func TestZeroLengthIO(t *testing.T) {
+	defer removeAllTestFiles(t)
+	for _, fs := range Fss {
+		tmp := testDir(fs)
+		path := filepath.Join(tmp, testName)
+
+		f, err := fs.Create(path)
+		if err != nil {
+			t.Fatal(fs.Name(), "Create failed:", err)
+		}
+		f.WriteString("abc")
+
+		for _, off := range []int64{0, 3, 10} {
+			if _, err := f.Seek(off, io.SeekStart); err != nil {
+				t.Fatal(fs.Name(), err)
+			}
+			if n, err := f.Read([]byte{}); n != 0 || err != nil {
+				t.Errorf("%v: Read(0) at %d = %d, %v, want 0, nil", fs.Name(), off, n, err)
+			}
+			if n, err := f.ReadAt(make([]byte, 0, 8), off); n != 0 || err != nil {
+				t.Errorf("%v: ReadAt(0, %d) = %d, %v, want 0, nil", fs.Name(), off, n, err)
+			}
+			if n, err := f.Write(nil); n != 0 || err != nil {
+				t.Errorf("%v: Write(0) at %d = %d, %v, want 0, nil", fs.Name(), off, n, err)
+			}
+			if n, err := f.WriteAt(nil, off); n != 0 || err != nil {
+				t.Errorf("%v: WriteAt(0, %d) = %d, %v, want 0, nil", fs.Name(), off, n, err)
+			}
+		}
+		f.Close()
+
+		fi, err := fs.Stat(path)
+		if err != nil {
+			t.Fatal(fs.Name(), err)
+		}
+		if fi.Size() != 3 {
+			t.Errorf("%v: zero length writes changed the size to %d", fs.Name(), fi.Size())
+		}
+	}
+}
+
 func TestOpenFile(t *testing.T) {
 	defer removeAllTestFiles(t)
 	for _, fs := range Fss {
@@ -297,6 +343,98 @@ func TestRemove(t *testing.T) {
 	}
 }
 
+// errorOp returns the Op of the *os.PathError or *os.LinkError in err.
+func errorOp(err error) string {
+	var pe *os.PathError
+	if errors.As(err, &pe) {
+		return pe.Op
+	}
+	var le *os.LinkError
+	if errors.As(err, &le) {
+		return le.Op
+	}
+	return ""
+}
+
+// TestErrorOps checks that backends and wrappers report the same Op strings
+// as the os package.
+func TestErrorOps(t *testing.T) {
+	defer removeAllTestFiles(t)
+
+	osBase := NewBasePathFs(&OsFs{}, testDir(&OsFs{}))
+	memBase := &MemMapFs{}
+	for _, fs := range []Fs{osBase, memBase} {
+		if err := fs.Mkdir("/dir", 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := WriteFile(fs, "/file.bin", []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	type opCase struct {
+		call string
+		fn   func(fs Fs) error
+		op   string
+	}
+	const missing = "/missing"
+	notFound := []opCase{
+		{"Open", func(fs Fs) error { _, err := fs.Open(missing); return err }, "open"},
+		{"OpenFile", func(fs Fs) error { _, err := fs.OpenFile(missing, os.O_RDWR, 0); return err }, "open"},
+		{"Stat", func(fs Fs) error { _, err := fs.Stat(missing); return err }, "stat"},
+		{"Remove", func(fs Fs) error { return fs.Remove(missing) }, "remove"},
+		{"Rename", func(fs Fs) error { return fs.Rename(missing, "/other") }, "rename"},
+		{"Mkdir", func(fs Fs) error { return fs.Mkdir("/dir", 0o755) }, "mkdir"},
+		{"Chmod", func(fs Fs) error { return fs.Chmod(missing, 0o644) }, "chmod"},
+		{"Chtimes", func(fs Fs) error { return fs.Chtimes(missing, time.Now(), time.Now()) }, "chtimes"},
+		{"Lstat", func(fs Fs) error { _, _, err := fs.(Lstater).LstatIfPossible(missing); return err }, "lstat"},
+	}
+	denied := []opCase{
+		{"Create", func(fs Fs) error { _, err := fs.Create("/file.bin"); return err }, "open"},
+		{"OpenFile", func(fs Fs) error { _, err := fs.OpenFile("/file.bin", os.O_WRONLY, 0); return err }, "open"},
+		{"Mkdir", func(fs Fs) error { return fs.Mkdir("/new", 0o755) }, "mkdir"},
+		{"MkdirAll", func(fs Fs) error { return fs.MkdirAll("/new/sub", 0o755) }, "mkdir"},
+		{"Remove", func(fs Fs) error { return fs.Remove("/file.bin") }, "remove"},
+		{"RemoveAll", func(fs Fs) error { return fs.RemoveAll("/dir") }, "RemoveAll"},
+		{"Rename", func(fs Fs) error { return fs.Rename("/file.bin", "/other") }, "rename"},
+		{"Chmod", func(fs Fs) error { return fs.Chmod("/file.bin", 0o600) }, "chmod"},
+		{"Chown", func(fs Fs) error { return fs.Chown("/file.bin", 0, 0) }, "chown"},
+		{"Chtimes", func(fs Fs) error { return fs.Chtimes("/file.bin", time.Now(), time.Now()) }, "chtimes"},
+	}
+	filtered := []opCase{
+		{"Open", func(fs Fs) error { _, err := fs.Open("/file.bin"); return err }, "open"},
+		{"Create", func(fs Fs) error { _, err := fs.Create("/other.bin"); return err }, "open"},
+		{"Stat", func(fs Fs) error { _, err := fs.Stat("/file.bin"); return err }, "stat"},
+		{"Remove", func(fs Fs) error { return fs.Remove("/file.bin") }, "remove"},
+		{"Chmod", func(fs Fs) error { return fs.Chmod("/file.bin", 0o600) }, "chmod"},
+	}
+
+	tests := []struct {
+		name  string
+		fs    Fs
+		cases []opCase
+	}{
+		{"OsFs", osBase, notFound},
+		{"MemMapFs", memBase, notFound},
+		{"BasePathFs", NewBasePathFs(memBase, "/"), notFound},
+		{"CopyOnWriteFs", NewCopyOnWriteFs(NewReadOnlyFs(memBase), &MemMapFs{}), notFound},
+		{"ReadOnlyFs", NewReadOnlyFs(memBase), denied},
+		{"RegexpFs", NewRegexpFs(memBase, regexp.MustCompile(`\.txt$`)), filtered},
+	}
+	for _, tt := range tests {
+		for _, c := range tt.cases {
+			err := c.fn(tt.fs)
+			if err == nil {
+				t.Errorf("%s.%s: expected an error", tt.name, c.call)
+				continue
+			}
+			if op := errorOp(err); op != c.op {
+				t.Errorf("%s.%s: got op %q (%v), want %q", tt.name, c.call, op, err, c.op)
+			}
+		}
+	}
+}
+
 func TestTruncate(t *testing.T) {
 	defer removeAllTestFiles(t)
 	for _, fs := range Fss {
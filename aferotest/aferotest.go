@@ -0,0 +1,534 @@
+// Package aferotest checks that an afero.Fs behaves like the file systems of
+// the afero package, for authors of backends outside of it:
+//
+//	func TestConformance(t *testing.T) {
+//		aferotest.Conformance(t, func(t *testing.T) afero.Fs {
+//			return mybackend.New(t.TempDir())
+//		}, afero.CapLstat|afero.CapReadAt)
+//	}
+//
+// The suite runs every method of Fs and File, the open flags and the errors
+// they return, and the optional interfaces named by the capabilities.
+package aferotest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// Factory returns a new, empty and writable Fs for the test t. Names are
+// absolute slash separated paths, so an OsFs should be wrapped in a
+// BasePathFs of a temporary directory.
+type Factory func(t *testing.T) afero.Fs
+
+// Option configures Conformance.
+type Option func(*config)
+
+type config struct {
+	skip map[string]string
+}
+
+// Skip skips the subtest name, e.g. "Chmod", with reason, for a behavior
+// the Fs documents as unsupported.
+func Skip(name, reason string) Option {
+	return func(c *config) {
+		if c.skip == nil {
+			c.skip = make(map[string]string)
+		}
+		c.skip[name] = reason
+	}
+}
+
+// Conformance runs the suite as subtests of t, each on a Fs returned by
+// newFs. The optional interfaces are tested for the capabilities in caps;
+// claiming a capability the Fs does not implement is an error.
+func Conformance(t *testing.T, newFs Factory, caps afero.Capability, opts ...Option) {
+	var c config
+	for _, opt := range opts {
+		opt(&c)
+	}
+	run := func(name string, test func(*testing.T, afero.Fs)) {
+		t.Run(name, func(t *testing.T) {
+			if reason, ok := c.skip[name]; ok {
+				t.Skip(reason)
+			}
+			test(t, newFs(t))
+		})
+	}
+	for _, test := range []struct {
+		name string
+		run  func(*testing.T, afero.Fs)
+	}{
+		{"Create", testCreate},
+		{"OpenFlags", testOpenFlags},
+		{"Errors", testErrors},
+		{"ReadWrite", testReadWrite},
+		{"Seek", testSeek},
+		{"Truncate", testTruncate},
+		{"Mkdir", testMkdir},
+		{"Readdir", testReaddir},
+		{"Remove", testRemove},
+		{"Rename", testRename},
+		{"Chmod", testChmod},
+		{"Chtimes", testChtimes},
+		{"Concurrency", testConcurrency},
+	} {
+		run(test.name, test.run)
+	}
+	for _, test := range capabilityTests {
+		if caps.Has(test.c) {
+			run(test.name, test.run)
+		}
+	}
+}
+
+// write creates name with content, failing the test on errors.
+func write(t *testing.T, fs afero.Fs, name, content string) {
+	t.Helper()
+	if err := afero.WriteFile(fs, name, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// content returns the content of name, or the error reading it.
+func content(fs afero.Fs, name string) string {
+	b, err := afero.ReadFile(fs, name)
+	if err != nil {
+		return "error: " + err.Error()
+	}
+	return string(b)
+}
+
+// checkPathError reports an error unless err matches target and is an
+// *os.PathError, or an *os.LinkError if link is set.
+func checkPathError(t *testing.T, op string, err, target error, link bool) {
+	t.Helper()
+	if !errors.Is(err, target) {
+		t.Errorf("%s = %v, want %v", op, err, target)
+		return
+	}
+	var pe *os.PathError
+	var le *os.LinkError
+	if !errors.As(err, &pe) && !(link && errors.As(err, &le)) {
+		t.Errorf("%s = %T, want an *os.PathError", op, err)
+	}
+}
+
+func testCreate(t *testing.T, fs afero.Fs) {
+	f, err := fs.Create("/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := f.WriteString("content"); n != 7 || err != nil {
+		t.Errorf("WriteString = %d, %v", n, err)
+	}
+	if err := f.Sync(); err != nil {
+		t.Errorf("Sync = %v", err)
+	}
+	if f.Name() != "/file" {
+		t.Errorf("Name = %q", f.Name())
+	}
+	fi, err := f.Stat()
+	if err != nil || fi.Name() != "file" || fi.Size() != 7 || !fi.Mode().IsRegular() || fi.IsDir() {
+		t.Errorf("Stat of the file = %v, %v", fi, err)
+	}
+	if err := f.Close(); err != nil {
+		t.Errorf("Close = %v", err)
+	}
+	if got := content(fs, "/file"); got != "content" {
+		t.Errorf("content = %q", got)
+	}
+
+	// Create truncates
+	f, err = fs.Create("/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if fi, err := fs.Stat("/file"); err != nil || fi.Size() != 0 {
+		t.Errorf("Stat after Create of an existing file = %v, %v", fi, err)
+	}
+	if fs.Name() == "" {
+		t.Error("Name of the Fs is empty")
+	}
+}
+
+func testOpenFlags(t *testing.T, fs afero.Fs) {
+	write(t, fs, "/file", "0123456789")
+
+	for _, tt := range []struct {
+		name     string
+		flag     int
+		canRead  bool
+		canWrite bool
+	}{
+		{"O_RDONLY", os.O_RDONLY, true, false},
+		{"O_WRONLY", os.O_WRONLY, false, true},
+		{"O_RDWR", os.O_RDWR, true, true},
+	} {
+		f, err := fs.OpenFile("/file", tt.flag, 0)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		_, rerr := f.Read(make([]byte, 1))
+		if (rerr == nil) != tt.canRead {
+			t.Errorf("%s: Read = %v", tt.name, rerr)
+		}
+		_, werr := f.WriteAt([]byte("x"), 9)
+		if (werr == nil) != tt.canWrite {
+			t.Errorf("%s: WriteAt = %v", tt.name, werr)
+		}
+		f.Close()
+	}
+
+	f, err := fs.OpenFile("/file", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("ab"))
+	f.Seek(0, io.SeekStart)
+	f.Write([]byte("cd"))
+	f.Close()
+	if got := content(fs, "/file"); got != "012345678xabcd" {
+		t.Errorf("after O_APPEND: %q", got)
+	}
+
+	f, err = fs.OpenFile("/file", os.O_RDWR|os.O_TRUNC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if got := content(fs, "/file"); got != "" {
+		t.Errorf("after O_TRUNC: %q", got)
+	}
+
+	f, err = fs.OpenFile("/new", os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		t.Fatalf("O_CREATE|O_EXCL of a new file: %v", err)
+	}
+	f.Close()
+	_, err = fs.OpenFile("/new", os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644)
+	checkPathError(t, "O_CREATE|O_EXCL of an existing file", err, os.ErrExist, false)
+	_, err = fs.OpenFile("/missing", os.O_RDWR, 0)
+	checkPathError(t, "OpenFile of a missing file", err, os.ErrNotExist, false)
+}
+
+func testErrors(t *testing.T, fs afero.Fs) {
+	write(t, fs, "/file", "")
+
+	_, err := fs.Open("/missing")
+	checkPathError(t, "Open", err, os.ErrNotExist, false)
+	_, err = fs.Stat("/missing")
+	checkPathError(t, "Stat", err, os.ErrNotExist, false)
+	checkPathError(t, "Remove", fs.Remove("/missing"), os.ErrNotExist, false)
+	checkPathError(t, "Chmod", fs.Chmod("/missing", 0o644), os.ErrNotExist, false)
+	checkPathError(t, "Chtimes", fs.Chtimes("/missing", time.Now(), time.Now()), os.ErrNotExist, false)
+	checkPathError(t, "Rename", fs.Rename("/missing", "/other"), os.ErrNotExist, true)
+	checkPathError(t, "Mkdir", fs.Mkdir("/file", 0o755), os.ErrExist, false)
+	if err := fs.RemoveAll("/missing"); err != nil {
+		t.Errorf("RemoveAll of a missing file = %v, want nil", err)
+	}
+
+	f, err := fs.Open("/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Read(make([]byte, 1)); err == nil {
+		t.Error("Read after Close succeeded")
+	}
+	if _, err := f.Write([]byte("x")); err == nil {
+		t.Error("Write after Close succeeded")
+	}
+}
+
+func testReadWrite(t *testing.T, fs afero.Fs) {
+	f, err := fs.OpenFile("/file", os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if n, err := f.Write([]byte("hello, world")); n != 12 || err != nil {
+		t.Fatalf("Write = %d, %v", n, err)
+	}
+	if n, err := f.WriteAt([]byte("HELLO"), 0); n != 5 || err != nil {
+		t.Errorf("WriteAt = %d, %v", n, err)
+	}
+	// WriteAt past the end leaves a hole of zeros
+	if _, err := f.WriteAt([]byte("!"), 14); err != nil {
+		t.Errorf("WriteAt past the end = %v", err)
+	}
+
+	b := make([]byte, 5)
+	if n, err := f.ReadAt(b, 7); n != 5 || err != nil || string(b) != "world" {
+		t.Errorf("ReadAt = %d, %q, %v", n, b[:n], err)
+	}
+	if n, err := f.ReadAt(b, 12); n != 3 || err != io.EOF || string(b[:n]) != "\x00\x00!" {
+		t.Errorf("ReadAt at the end = %d, %q, %v, want 3 bytes and io.EOF", n, b[:n], err)
+	}
+	if n, err := f.Read(b); n != 3 || string(b[:n]) != "\x00\x00!" {
+		t.Errorf("Read after Write = %d, %q, %v", n, b[:n], err)
+	}
+	if n, err := f.Read(b); n != 0 || err != io.EOF {
+		t.Errorf("Read at the end = %d, %v, want io.EOF", n, err)
+	}
+	if n, err := f.Read(nil); n != 0 || (err != nil && err != io.EOF) {
+		t.Errorf("Read of nothing = %d, %v", n, err)
+	}
+	if got := content(fs, "/file"); got != "HELLO, world\x00\x00!" {
+		t.Errorf("content = %q", got)
+	}
+}
+
+func testSeek(t *testing.T, fs afero.Fs) {
+	write(t, fs, "/file", "0123456789")
+	f, err := fs.Open("/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for _, tt := range []struct {
+		offset int64
+		whence int
+		want   int64
+	}{
+		{3, io.SeekStart, 3},
+		{2, io.SeekCurrent, 5},
+		{-1, io.SeekEnd, 9},
+		{5, io.SeekEnd, 15},
+		{0, io.SeekStart, 0},
+	} {
+		if got, err := f.Seek(tt.offset, tt.whence); got != tt.want || err != nil {
+			t.Errorf("Seek(%d, %d) = %d, %v, want %d", tt.offset, tt.whence, got, err, tt.want)
+		}
+	}
+	f.Seek(8, io.SeekStart)
+	if b, err := io.ReadAll(f); string(b) != "89" || err != nil {
+		t.Errorf("Read after Seek = %q, %v", b, err)
+	}
+	if _, err := f.Seek(-1, io.SeekStart); err == nil {
+		t.Error("Seek before the start succeeded")
+	}
+}
+
+func testTruncate(t *testing.T, fs afero.Fs) {
+	write(t, fs, "/file", "0123456789")
+	f, err := fs.OpenFile("/file", os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := f.Truncate(4); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := f.Stat(); err != nil || fi.Size() != 4 {
+		t.Errorf("Stat after Truncate = %v, %v", fi, err)
+	}
+	if err := f.Truncate(6); err != nil {
+		t.Fatal(err)
+	}
+	if got := content(fs, "/file"); got != "0123\x00\x00" {
+		t.Errorf("content after growing = %q", got)
+	}
+	if err := f.Truncate(-1); err == nil {
+		t.Error("Truncate to a negative size succeeded")
+	}
+
+	r, err := fs.Open("/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if err := r.Truncate(0); err == nil {
+		t.Error("Truncate of a file opened read-only succeeded")
+	}
+}
+
+func testMkdir(t *testing.T, fs afero.Fs) {
+	if err := fs.Mkdir("/dir", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	checkPathError(t, "Mkdir of an existing directory", fs.Mkdir("/dir", 0o755), os.ErrExist, false)
+	if err := fs.MkdirAll("/dir/a/b/c", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.MkdirAll("/dir/a/b/c", 0o755); err != nil {
+		t.Errorf("MkdirAll of an existing directory = %v", err)
+	}
+	fi, err := fs.Stat("/dir/a/b")
+	if err != nil || !fi.IsDir() || !fi.Mode().IsDir() || fi.Name() != "b" {
+		t.Errorf("Stat of a directory = %v, %v", fi, err)
+	}
+}
+
+func testReaddir(t *testing.T, fs afero.Fs) {
+	want := []string{"a", "b", "c", "d", "sub"}
+	fs.Mkdir("/dir", 0o755)
+	for _, name := range want[:4] {
+		write(t, fs, "/dir/"+name, name)
+	}
+	fs.Mkdir("/dir/sub", 0o755)
+
+	f, err := fs.Open("/dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fis, err := f.Readdir(-1)
+	f.Close()
+	if err != nil {
+		t.Fatalf("Readdir(-1) = %v", err)
+	}
+	names := make(map[string]bool)
+	for _, fi := range fis {
+		names[fi.Name()] = true
+		if fi.IsDir() != (fi.Name() == "sub") {
+			t.Errorf("%s: IsDir = %v", fi.Name(), fi.IsDir())
+		}
+	}
+	for _, name := range want {
+		if !names[name] {
+			t.Errorf("Readdir(-1) misses %s", name)
+		}
+	}
+	if len(fis) != len(want) {
+		t.Errorf("Readdir(-1) returned %d entries, want %v", len(fis), want)
+	}
+	CheckReaddir(t, fs, "/dir")
+
+	f, err = fs.Open("/dir/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Readdir(-1); err == nil {
+		t.Error("Readdir of a file succeeded")
+	}
+	f.Close()
+}
+
+func testRemove(t *testing.T, fs afero.Fs) {
+	fs.MkdirAll("/dir/sub", 0o755)
+	write(t, fs, "/dir/sub/file", "")
+	write(t, fs, "/file", "")
+
+	if err := fs.Remove("/file"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Stat("/file"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Stat after Remove = %v", err)
+	}
+	if err := fs.Remove("/dir"); err == nil {
+		t.Error("Remove of a directory which is not empty succeeded")
+	}
+	if err := fs.RemoveAll("/dir"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Stat("/dir/sub/file"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Stat after RemoveAll = %v", err)
+	}
+	fs.Mkdir("/empty", 0o755)
+	if err := fs.Remove("/empty"); err != nil {
+		t.Errorf("Remove of an empty directory = %v", err)
+	}
+}
+
+func testRename(t *testing.T, fs afero.Fs) {
+	fs.MkdirAll("/dir/sub", 0o755)
+	write(t, fs, "/dir/sub/file", "data")
+	write(t, fs, "/a", "a")
+	write(t, fs, "/b", "b")
+
+	if err := fs.Rename("/a", "/b"); err != nil {
+		t.Fatal(err)
+	}
+	if got := content(fs, "/b"); got != "a" {
+		t.Errorf("Rename onto a file left %q", got)
+	}
+	if _, err := fs.Stat("/a"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Stat of the old name = %v", err)
+	}
+	if err := fs.Rename("/dir", "/moved"); err != nil {
+		t.Fatal(err)
+	}
+	if got := content(fs, "/moved/sub/file"); got != "data" {
+		t.Errorf("file of a renamed directory = %q", got)
+	}
+	if _, err := fs.Stat("/dir"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Stat of the old directory = %v", err)
+	}
+}
+
+func testChmod(t *testing.T, fs afero.Fs) {
+	write(t, fs, "/file", "")
+	// Only the write bit is checked, which every platform keeps.
+	for _, mode := range []os.FileMode{0o444, 0o644} {
+		if err := fs.Chmod("/file", mode); err != nil {
+			t.Fatal(err)
+		}
+		fi, err := fs.Stat("/file")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode()&0o200 != mode&0o200 || !fi.Mode().IsRegular() {
+			t.Errorf("mode after Chmod(%v) = %v", mode, fi.Mode())
+		}
+	}
+}
+
+func testChtimes(t *testing.T, fs afero.Fs) {
+	write(t, fs, "/file", "")
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := fs.Chtimes("/file", mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := fs.Stat("/file"); err != nil || !fi.ModTime().Equal(mtime) {
+		t.Errorf("ModTime after Chtimes = %v, %v, want %v", fi.ModTime(), err, mtime)
+	}
+}
+
+func testConcurrency(t *testing.T, fs afero.Fs) {
+	const n = 8
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+	write(t, fs, "/shared", string(data))
+	fs.Mkdir("/dir", 0o755)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*n)
+	for i := 0; i < n; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprintf("/dir/%d", i)
+			if err := afero.WriteFile(fs, name, data[:i*100], 0o644); err != nil {
+				errs <- err
+				return
+			}
+			if got, err := afero.ReadFile(fs, name); err != nil || len(got) != i*100 {
+				errs <- fmt.Errorf("%s: %d bytes, %v", name, len(got), err)
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			if got, err := afero.ReadFile(fs, "/shared"); err != nil || !bytes.Equal(got, data) {
+				errs <- fmt.Errorf("concurrent read: %d bytes, %v", len(got), err)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if fis, err := afero.ReadDir(fs, "/dir"); err != nil || len(fis) != n {
+		t.Errorf("ReadDir after concurrent writes = %d entries, %v", len(fis), err)
+	}
+}
@@ -0,0 +1,81 @@
+package aferotest
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestMemMapFs(t *testing.T) {
+	Conformance(t, func(t *testing.T) afero.Fs {
+		return afero.NewMemMapFs()
+	}, afero.Capabilities(afero.NewMemMapFs()))
+}
+
+// basePathCaps are the capabilities checked through a BasePathFs, which
+// keeps symlink targets as names of the Fs below it, so relative targets
+// cannot be created and Readlink does not return the name given.
+const basePathCaps = ^(afero.CapSymlink | afero.CapReadlink)
+
+func TestOsFs(t *testing.T) {
+	Conformance(t, func(t *testing.T) afero.Fs {
+		return afero.NewBasePathFs(afero.NewOsFs(), t.TempDir())
+	}, afero.Capabilities(afero.NewOsFs())&basePathCaps)
+}
+
+func TestBasePathFs(t *testing.T) {
+	Conformance(t, func(t *testing.T) afero.Fs {
+		fs := afero.NewMemMapFs()
+		fs.Mkdir("/base", 0o755)
+		return afero.NewBasePathFs(fs, "/base")
+	}, afero.Capabilities(afero.NewMemMapFs())&basePathCaps)
+}
+
+// noChmodFs fails every Chmod of an existing file, so the Chmod subtest
+// only passes skipped.
+type noChmodFs struct {
+	afero.Fs
+}
+
+func (fs noChmodFs) Chmod(name string, mode os.FileMode) error {
+	if _, err := fs.Stat(name); err != nil {
+		return err
+	}
+	return &os.PathError{Op: "chmod", Path: name, Err: errors.ErrUnsupported}
+}
+
+func TestSkip(t *testing.T) {
+	Conformance(t, func(t *testing.T) afero.Fs {
+		return noChmodFs{afero.NewMemMapFs()}
+	}, 0, Skip("Chmod", "noChmodFs has no permissions"))
+}
+
+func TestChecksumFs(t *testing.T) {
+	newFs := func(t *testing.T) afero.Fs {
+		return afero.NewChecksumFs(afero.NewMemMapFs(), nil)
+	}
+	Conformance(t, newFs, afero.Capabilities(newFs(t)))
+}
+
+func TestTxFs(t *testing.T) {
+	newFs := func(t *testing.T) afero.Fs {
+		return afero.NewTxFs(afero.NewMemMapFs())
+	}
+	Conformance(t, newFs, afero.Capabilities(newFs(t)))
+}
+
+func TestCopyOnWriteFs(t *testing.T) {
+	newFs := func(t *testing.T) afero.Fs {
+		return afero.NewCopyOnWriteFs(afero.NewReadOnlyFs(afero.NewMemMapFs()), afero.NewMemMapFs())
+	}
+	Conformance(t, newFs, afero.Capabilities(newFs(t)))
+}
+
+func TestCacheOnReadFs(t *testing.T) {
+	newFs := func(t *testing.T) afero.Fs {
+		return afero.NewCacheOnReadFs(afero.NewMemMapFs(), afero.NewMemMapFs(), 0)
+	}
+	Conformance(t, newFs, afero.Capabilities(newFs(t)))
+}
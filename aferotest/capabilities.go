@@ -0,0 +1,283 @@
+package aferotest
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// capabilityTests test the optional interfaces, each run if its capability
+// is claimed.
+var capabilityTests = []struct {
+	c    afero.Capability
+	name string
+	run  func(*testing.T, afero.Fs)
+}{
+	{afero.CapLstat, "Lstat", testLstat},
+	{afero.CapSymlink, "Symlink", testSymlink},
+	{afero.CapReadlink, "Readlink", testReadlink},
+	{afero.CapHardLink, "HardLink", testHardLink},
+	{afero.CapLock, "Lock", testLock},
+	{afero.CapXattr, "Xattr", testXattr},
+	{afero.CapReadAt, "ReadAt", testReadAt},
+	{afero.CapAtomicRename, "AtomicRename", testAtomicRename},
+}
+
+// implements fails the test unless fs implements the optional interface T.
+func implements[T any](t *testing.T, fs afero.Fs) T {
+	t.Helper()
+	i, ok := fs.(T)
+	if !ok {
+		var zero *T
+		t.Fatalf("%T does not implement %T", fs, zero)
+	}
+	return i
+}
+
+// symlink creates the symlink name to target, for the tests which need one.
+func symlink(t *testing.T, fs afero.Fs, target, name string) {
+	t.Helper()
+	l, ok := fs.(afero.Linker)
+	if !ok {
+		t.Skip("the Fs cannot create symlinks")
+	}
+	if err := l.SymlinkIfPossible(target, name); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testLstat(t *testing.T, fs afero.Fs) {
+	l := implements[afero.Lstater](t, fs)
+	write(t, fs, "/file", "data")
+	fi, _, err := l.LstatIfPossible("/file")
+	if err != nil || fi.Size() != 4 || !fi.Mode().IsRegular() {
+		t.Errorf("LstatIfPossible of a file = %v, %v", fi, err)
+	}
+	_, _, err = l.LstatIfPossible("/missing")
+	checkPathError(t, "LstatIfPossible", err, os.ErrNotExist, false)
+
+	symlink(t, fs, "/file", "/link")
+	fi, lstatCalled, err := l.LstatIfPossible("/link")
+	if err != nil || !lstatCalled || fi.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("LstatIfPossible of a symlink = %v, %v, %v", fi, lstatCalled, err)
+	}
+}
+
+func testSymlink(t *testing.T, fs afero.Fs) {
+	l := implements[afero.Linker](t, fs)
+	write(t, fs, "/file", "data")
+	fs.Mkdir("/dir", 0o755)
+	if err := l.SymlinkIfPossible("/file", "/dir/link"); err != nil {
+		t.Fatal(err)
+	}
+	if got := content(fs, "/dir/link"); got != "data" {
+		t.Errorf("reading through the symlink = %q", got)
+	}
+	if fi, err := fs.Stat("/dir/link"); err != nil || !fi.Mode().IsRegular() {
+		t.Errorf("Stat of the symlink = %v, %v, want its target", fi, err)
+	}
+	checkPathError(t, "SymlinkIfPossible onto an existing file", l.SymlinkIfPossible("/file", "/dir/link"), os.ErrExist, true)
+
+	// a relative link and a dangling one
+	if err := l.SymlinkIfPossible("../file", "/dir/rel"); err != nil {
+		t.Fatal(err)
+	}
+	if got := content(fs, "/dir/rel"); got != "data" {
+		t.Errorf("reading through a relative symlink = %q", got)
+	}
+	if err := l.SymlinkIfPossible("/missing", "/dangling"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Stat("/dangling"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Stat of a dangling symlink = %v", err)
+	}
+	if err := fs.Remove("/dangling"); err != nil {
+		t.Errorf("Remove of a dangling symlink = %v", err)
+	}
+	if got := content(fs, "/file"); got != "data" {
+		t.Errorf("the target changed: %q", got)
+	}
+}
+
+func testReadlink(t *testing.T, fs afero.Fs) {
+	r := implements[afero.LinkReader](t, fs)
+	write(t, fs, "/file", "")
+	symlink(t, fs, "file", "/link")
+	if target, err := r.ReadlinkIfPossible("/link"); err != nil || target != "file" {
+		t.Errorf("ReadlinkIfPossible = %q, %v", target, err)
+	}
+	if _, err := r.ReadlinkIfPossible("/file"); err == nil {
+		t.Error("ReadlinkIfPossible of a file succeeded")
+	}
+}
+
+func testHardLink(t *testing.T, fs afero.Fs) {
+	l := implements[afero.HardLinker](t, fs)
+	write(t, fs, "/file", "data")
+	if err := l.LinkIfPossible("/file", "/link"); err != nil {
+		t.Fatal(err)
+	}
+	f, err := fs.OpenFile("/link", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("+"))
+	f.Close()
+	if got := content(fs, "/file"); got != "data+" {
+		t.Errorf("write through the link: %q", got)
+	}
+	if err := fs.Remove("/file"); err != nil {
+		t.Fatal(err)
+	}
+	if got := content(fs, "/link"); got != "data+" {
+		t.Errorf("the link after removing the file: %q", got)
+	}
+	checkPathError(t, "LinkIfPossible of a missing file", l.LinkIfPossible("/missing", "/other"), os.ErrNotExist, true)
+}
+
+func testLock(t *testing.T, fs afero.Fs) {
+	l := implements[afero.Locker](t, fs)
+	write(t, fs, "/file", "")
+	lock, ok, err := l.LockIfPossible("/file", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		lock.Close()
+		t.Skip("the platform cannot lock")
+	}
+
+	locked := make(chan io.Closer)
+	go func() {
+		second, _, err := l.LockIfPossible("/file", true)
+		if err != nil {
+			t.Error(err)
+			close(locked)
+			return
+		}
+		locked <- second
+	}()
+	select {
+	case <-locked:
+		t.Fatal("a second exclusive lock was taken while the first was held")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if err := lock.Close(); err != nil {
+		t.Errorf("unlock = %v", err)
+	}
+	select {
+	case second, ok := <-locked:
+		if ok {
+			second.Close()
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the second lock was not taken after the first was released")
+	}
+}
+
+func testXattr(t *testing.T, fs afero.Fs) {
+	x := implements[afero.Xattrer](t, fs)
+	write(t, fs, "/file", "")
+	if err := x.SetXattr("/file", "user.test", []byte("value")); err != nil {
+		if errors.Is(err, afero.ErrNoXattr) {
+			t.Skip("the platform does not support extended attributes")
+		}
+		t.Fatal(err)
+	}
+	if v, err := x.GetXattr("/file", "user.test"); err != nil || string(v) != "value" {
+		t.Errorf("GetXattr = %q, %v", v, err)
+	}
+	names, err := x.ListXattr("/file")
+	found := false
+	for _, name := range names {
+		found = found || name == "user.test"
+	}
+	if err != nil || !found {
+		t.Errorf("ListXattr = %v, %v", names, err)
+	}
+	if err := x.RemoveXattr("/file", "user.test"); err != nil {
+		t.Fatal(err)
+	}
+	_, err = x.GetXattr("/file", "user.test")
+	checkPathError(t, "GetXattr of a removed attribute", err, afero.ErrXattrNotFound, false)
+	_, err = x.GetXattr("/missing", "user.test")
+	checkPathError(t, "GetXattr of a missing file", err, os.ErrNotExist, false)
+}
+
+func testReadAt(t *testing.T, fs afero.Fs) {
+	data := make([]byte, 1<<16)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	write(t, fs, "/file", string(data))
+	f, err := fs.Open("/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// ReadAt neither depends on nor moves the offset of Read.
+	f.Seek(100, io.SeekStart)
+	b := make([]byte, 10)
+	for _, off := range []int64{60000, 5, 32768} {
+		if n, err := f.ReadAt(b, off); n != len(b) || err != nil || string(b) != string(data[off:off+10]) {
+			t.Errorf("ReadAt(%d) = %d, %v", off, n, err)
+		}
+	}
+	if n, _ := f.Read(b); n != len(b) || string(b) != string(data[100:110]) {
+		t.Errorf("Read after ReadAt = %d bytes at another offset", n)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(off int64) {
+			defer wg.Done()
+			b := make([]byte, 1000)
+			if n, err := f.ReadAt(b, off); n != len(b) || err != nil || string(b) != string(data[off:off+1000]) {
+				t.Errorf("concurrent ReadAt(%d) = %d, %v", off, n, err)
+			}
+		}(int64(i) * 7000)
+	}
+	wg.Wait()
+}
+
+func testAtomicRename(t *testing.T, fs afero.Fs) {
+	write(t, fs, "/file", "old")
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	defer func() {
+		close(done)
+		wg.Wait()
+	}()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if got := content(fs, "/file"); got != "old" && got != "new" {
+				t.Errorf("a reader saw %q during Rename", got)
+				return
+			}
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		write(t, fs, "/tmp", "new")
+		if err := fs.Rename("/tmp", "/file"); err != nil {
+			t.Fatal(err)
+		}
+		write(t, fs, "/tmp", "old")
+		if err := fs.Rename("/tmp", "/file"); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
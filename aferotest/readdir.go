@@ -0,0 +1,101 @@
+package aferotest
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+// CheckReaddir checks that Readdir and Readdirnames of the directory dir of
+// fs, which must hold at least two entries, follow the contract of os.File:
+// Readdir(n) with n > 0 returns between 1 and n entries and a nil error,
+// continuing where the call before stopped, then no entries and io.EOF on
+// every further call; Readdir(n) with n <= 0 returns all remaining entries
+// and a nil error, at the end of the directory as well.
+//
+// Conformance runs it, it is exported for read-only backends which cannot
+// run the whole suite.
+func CheckReaddir(t *testing.T, fs afero.Fs, dir string) {
+	t.Helper()
+	want := readdirnames(t, fs, dir)
+	sort.Strings(want)
+	if len(want) < 2 {
+		t.Fatalf("%s holds %d entries, at least 2 are needed", dir, len(want))
+	}
+
+	for _, n := range []int{1, 2, len(want) + 1} {
+		f, err := fs.Open(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for i := 0; ; i++ {
+			fis, err := f.Readdir(n)
+			if err == io.EOF {
+				if len(fis) != 0 {
+					t.Errorf("Readdir(%d) returned %d entries with io.EOF", n, len(fis))
+				}
+				break
+			}
+			if err != nil || len(fis) == 0 || len(fis) > n || i > len(want) {
+				t.Fatalf("Readdir(%d) = %d entries, %v", n, len(fis), err)
+			}
+			for _, fi := range fis {
+				names = append(names, fi.Name())
+			}
+		}
+		sort.Strings(names)
+		if fmt.Sprint(names) != fmt.Sprint(want) {
+			t.Errorf("Readdir(%d) returned %v, want %v", n, names, want)
+		}
+		if fis, err := f.Readdir(n); len(fis) != 0 || err != io.EOF {
+			t.Errorf("Readdir(%d) after io.EOF = %d entries, %v", n, len(fis), err)
+		}
+		if names, err := f.Readdirnames(-1); len(names) != 0 || err != nil {
+			t.Errorf("Readdirnames(-1) after io.EOF = %v, %v", names, err)
+		}
+		f.Close()
+	}
+
+	// a listing goes on after a partial read, in Readdir and Readdirnames
+	f, err := fs.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	first, err := f.Readdirnames(1)
+	if err != nil || len(first) != 1 {
+		t.Fatalf("Readdirnames(1) = %v, %v", first, err)
+	}
+	fis, err := f.Readdir(-1)
+	if err != nil {
+		t.Fatalf("Readdir(-1) after Readdirnames(1) = %v", err)
+	}
+	names := first
+	for _, fi := range fis {
+		names = append(names, fi.Name())
+	}
+	sort.Strings(names)
+	if fmt.Sprint(names) != fmt.Sprint(want) {
+		t.Errorf("Readdirnames(1) and Readdir(-1) returned %v, want %v", names, want)
+	}
+}
+
+// readdirnames returns the names of the entries of dir, failing the test on
+// errors.
+func readdirnames(t *testing.T, fs afero.Fs, dir string) []string {
+	t.Helper()
+	f, err := fs.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	names, err := f.Readdirnames(-1)
+	if err != nil {
+		t.Fatalf("Readdirnames(-1) of %s = %v", dir, err)
+	}
+	return names
+}
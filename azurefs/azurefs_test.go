@@ -0,0 +1,287 @@
+package azurefs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/spf13/afero/aferotest"
+)
+
+// memClient is an in-memory blobClient.
+type memClient struct {
+	mu    sync.Mutex
+	conts map[string]map[string][]byte
+}
+
+func newMemClient(conts ...string) *memClient {
+	c := &memClient{conts: make(map[string]map[string][]byte)}
+	for _, name := range conts {
+		c.conts[name] = make(map[string][]byte)
+	}
+	return c
+}
+
+func (c *memClient) blobs(cont string) (map[string][]byte, error) {
+	blobs, ok := c.conts[cont]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return blobs, nil
+}
+
+func (c *memClient) containerExists(_ context.Context, cont string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := c.blobs(cont)
+	return err
+}
+
+func (c *memClient) properties(_ context.Context, cont, name string) (blobEntry, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	blobs, err := c.blobs(cont)
+	if err != nil {
+		return blobEntry{}, err
+	}
+	data, ok := blobs[name]
+	if !ok {
+		return blobEntry{}, os.ErrNotExist
+	}
+	return blobEntry{name: name, size: int64(len(data)), modTime: time.Now()}, nil
+}
+
+func (c *memClient) download(_ context.Context, cont, name string, off, count int64) (io.ReadCloser, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	blobs, err := c.blobs(cont)
+	if err != nil {
+		return nil, err
+	}
+	data, ok := blobs[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	if off >= int64(len(data)) && (off > 0 || count > 0) {
+		return nil, io.EOF
+	}
+	data = data[off:]
+	if count > 0 && count < int64(len(data)) {
+		data = data[:count]
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (c *memClient) upload(_ context.Context, cont, name string, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	blobs, err := c.blobs(cont)
+	if err != nil {
+		return err
+	}
+	blobs[name] = data
+	return nil
+}
+
+func (c *memClient) remove(_ context.Context, cont, name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	blobs, err := c.blobs(cont)
+	if err != nil {
+		return err
+	}
+	if _, ok := blobs[name]; !ok {
+		return os.ErrNotExist
+	}
+	delete(blobs, name)
+	return nil
+}
+
+func (c *memClient) list(_ context.Context, cont, prefix string, delimited bool) ([]blobEntry, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	blobs, err := c.blobs(cont)
+	if err != nil {
+		return nil, err
+	}
+	var entries []blobEntry
+	seen := make(map[string]bool)
+	for name, data := range blobs {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if i := strings.Index(name[len(prefix):], "/"); delimited && i >= 0 {
+			p := name[:len(prefix)+i+1]
+			if !seen[p] {
+				seen[p] = true
+				entries = append(entries, blobEntry{name: p, prefix: true})
+			}
+			continue
+		}
+		entries = append(entries, blobEntry{name: name, size: int64(len(data))})
+	}
+	sortEntries(entries)
+	return entries, nil
+}
+
+func (c *memClient) copy(_ context.Context, cont, src, dst string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	blobs, err := c.blobs(cont)
+	if err != nil {
+		return err
+	}
+	data, ok := blobs[src]
+	if !ok {
+		return os.ErrNotExist
+	}
+	blobs[dst] = data
+	return nil
+}
+
+func (c *memClient) names(cont string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var names []string
+	for name := range c.conts[cont] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestAzureFs(t *testing.T) {
+	client := newMemClient("bucket")
+	fs := &Fs{ctx: context.Background(), client: client}
+
+	if _, err := fs.Stat("missing"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Stat of missing container = %v", err)
+	}
+	if err := fs.MkdirAll("/bucket/a/b", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := afero.WriteFile(fs, "/bucket/a/f.txt", []byte("hello world"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := afero.WriteFile(fs, "/bucket/a/implied/g.txt", []byte("g"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a/", "a/b/", "a/f.txt", "a/implied/g.txt"}; !reflect.DeepEqual(client.names("bucket"), want) {
+		t.Errorf("blobs = %v, want %v", client.names("bucket"), want)
+	}
+
+	for name, dir := range map[string]bool{"bucket": true, "bucket/a": true, "bucket/a/implied": true, "bucket/a/f.txt": false} {
+		fi, err := fs.Stat(name)
+		if err != nil || fi.IsDir() != dir {
+			t.Errorf("Stat(%s) = %v, %v, want dir %v", name, fi, err, dir)
+		}
+	}
+
+	infos, err := afero.ReadDir(fs, "bucket/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, fi := range infos {
+		names = append(names, fi.Name())
+	}
+	if want := []string{"b", "f.txt", "implied"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("ReadDir = %v, want %v", names, want)
+	}
+	aferotest.CheckReaddir(t, fs, "bucket/a")
+
+	// Writes in the middle keep the content around them.
+	f, err := fs.OpenFile("bucket/a/f.txt", os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte("W"), 6); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 5)
+	if n, err := f.ReadAt(buf, 6); err != nil || string(buf[:n]) != "World" {
+		t.Errorf("ReadAt = %q, %v", buf[:n], err)
+	}
+	if err := f.Truncate(5); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if data, err := afero.ReadFile(fs, "bucket/a/f.txt"); err != nil || string(data) != "hello" {
+		t.Errorf("content = %q, %v", data, err)
+	}
+
+	f, err = fs.OpenFile("bucket/a/f.txt", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Seek(0, io.SeekStart)
+	f.WriteString(", azure")
+	if _, err := f.WriteAt([]byte("x"), 0); !errors.Is(err, ErrWriteAtInAppendMode) {
+		t.Errorf("WriteAt in append mode = %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := afero.ReadFile(fs, "bucket/a/f.txt"); err != nil || string(data) != "hello, azure" {
+		t.Errorf("content after append = %q, %v", data, err)
+	}
+
+	if err := fs.Remove("bucket/a"); err == nil {
+		t.Error("Remove of non-empty dir succeeded")
+	}
+	if err := fs.Rename("bucket/a", "bucket/z"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"z/", "z/b/", "z/f.txt", "z/implied/g.txt"}; !reflect.DeepEqual(client.names("bucket"), want) {
+		t.Errorf("blobs after Rename = %v, want %v", client.names("bucket"), want)
+	}
+	if err := fs.Remove("bucket/z/b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.RemoveAll("bucket/z"); err != nil {
+		t.Fatal(err)
+	}
+	if names := client.names("bucket"); len(names) != 0 {
+		t.Errorf("blobs after RemoveAll = %v", names)
+	}
+}
+
+func TestAzureFsOpenFlags(t *testing.T) {
+	fs := &Fs{ctx: context.Background(), client: newMemClient("c")}
+
+	if _, err := fs.Open("c/missing"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Open missing = %v", err)
+	}
+	f, err := fs.OpenFile("c/new", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if fi, err := fs.Stat("c/new"); err != nil || fi.Size() != 0 {
+		t.Errorf("created file = %v, %v", fi, err)
+	}
+	if _, err := fs.OpenFile("c/new", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644); !errors.Is(err, os.ErrExist) {
+		t.Errorf("O_EXCL on existing file = %v", err)
+	}
+	fs.Mkdir("c/d", 0o755)
+	if _, err := fs.OpenFile("c/d", os.O_WRONLY, 0); err == nil {
+		t.Error("opened a directory for writing")
+	}
+	r, _ := fs.Open("c/new")
+	if _, err := r.Write([]byte("x")); err == nil {
+		t.Error("Write to read-only file succeeded")
+	}
+}
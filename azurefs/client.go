@@ -0,0 +1,172 @@
+package azurefs
+
+import (
+	"context"
+	"io"
+	"os"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+)
+
+// copyPollInterval is the time between checks of a pending server-side copy.
+const copyPollInterval = 100 * time.Millisecond
+
+// blobEntry is a blob or, in listings with a delimiter, a common prefix.
+type blobEntry struct {
+	name    string
+	prefix  bool
+	size    int64
+	modTime time.Time
+}
+
+// blobClient holds the Blob Storage operations used by Fs, so that they
+// can be replaced in tests. Missing containers and blobs are reported as
+// os.ErrNotExist, reads past the end as io.EOF.
+type blobClient interface {
+	containerExists(ctx context.Context, cont string) error
+	properties(ctx context.Context, cont, name string) (blobEntry, error)
+	// download returns count bytes from off, or everything from off if
+	// count is 0.
+	download(ctx context.Context, cont, name string, off, count int64) (io.ReadCloser, error)
+	// upload stores the content read from r as a block blob.
+	upload(ctx context.Context, cont, name string, r io.Reader) error
+	remove(ctx context.Context, cont, name string) error
+	// list returns the blobs starting with prefix, sorted by name. With a
+	// delimiter, blobs below the next "/" are reported as one prefix entry.
+	list(ctx context.Context, cont, prefix string, delimited bool) ([]blobEntry, error)
+	copy(ctx context.Context, cont, src, dst string) error
+}
+
+// sdkClient implements blobClient with the azblob SDK.
+type sdkClient struct {
+	client *azblob.Client
+}
+
+func (c *sdkClient) container(cont string) *container.Client {
+	return c.client.ServiceClient().NewContainerClient(cont)
+}
+
+// mapError translates the error codes with an os or io equivalent.
+func mapError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case bloberror.HasCode(err, bloberror.BlobNotFound, bloberror.ContainerNotFound, bloberror.ResourceNotFound):
+		return os.ErrNotExist
+	case bloberror.HasCode(err, bloberror.InvalidRange):
+		return io.EOF
+	case bloberror.HasCode(err, bloberror.AuthorizationFailure, bloberror.AuthorizationPermissionMismatch,
+		bloberror.AuthenticationFailed, bloberror.InsufficientAccountPermissions):
+		return os.ErrPermission
+	}
+	return err
+}
+
+func (c *sdkClient) containerExists(ctx context.Context, cont string) error {
+	_, err := c.container(cont).GetProperties(ctx, nil)
+	return mapError(err)
+}
+
+func (c *sdkClient) properties(ctx context.Context, cont, name string) (blobEntry, error) {
+	resp, err := c.container(cont).NewBlobClient(name).GetProperties(ctx, nil)
+	if err != nil {
+		return blobEntry{}, mapError(err)
+	}
+	return blobEntry{name: name, size: *resp.ContentLength, modTime: *resp.LastModified}, nil
+}
+
+func (c *sdkClient) download(ctx context.Context, cont, name string, off, count int64) (io.ReadCloser, error) {
+	resp, err := c.client.DownloadStream(ctx, cont, name, &azblob.DownloadStreamOptions{
+		Range: azblob.HTTPRange{Offset: off, Count: count},
+	})
+	if err != nil {
+		return nil, mapError(err)
+	}
+	return resp.Body, nil
+}
+
+func (c *sdkClient) upload(ctx context.Context, cont, name string, r io.Reader) error {
+	_, err := c.client.UploadStream(ctx, cont, name, r, nil)
+	return mapError(err)
+}
+
+func (c *sdkClient) remove(ctx context.Context, cont, name string) error {
+	_, err := c.client.DeleteBlob(ctx, cont, name, nil)
+	return mapError(err)
+}
+
+func (c *sdkClient) list(ctx context.Context, cont, prefix string, delimited bool) ([]blobEntry, error) {
+	var entries []blobEntry
+	add := func(items []*container.BlobItem) {
+		for _, item := range items {
+			e := blobEntry{name: *item.Name}
+			if p := item.Properties; p != nil {
+				if p.ContentLength != nil {
+					e.size = *p.ContentLength
+				}
+				if p.LastModified != nil {
+					e.modTime = *p.LastModified
+				}
+			}
+			entries = append(entries, e)
+		}
+	}
+
+	if !delimited {
+		pager := c.container(cont).NewListBlobsFlatPager(&container.ListBlobsFlatOptions{Prefix: to.Ptr(prefix)})
+		for pager.More() {
+			page, err := pager.NextPage(ctx)
+			if err != nil {
+				return nil, mapError(err)
+			}
+			add(page.Segment.BlobItems)
+		}
+		return entries, nil
+	}
+
+	pager := c.container(cont).NewListBlobsHierarchyPager("/", &container.ListBlobsHierarchyOptions{Prefix: to.Ptr(prefix)})
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, mapError(err)
+		}
+		add(page.Segment.BlobItems)
+		for _, p := range page.Segment.BlobPrefixes {
+			entries = append(entries, blobEntry{name: *p.Name, prefix: true})
+		}
+	}
+	sortEntries(entries)
+	return entries, nil
+}
+
+func (c *sdkClient) copy(ctx context.Context, cont, src, dst string) error {
+	cc := c.container(cont)
+	dstBlob := cc.NewBlobClient(dst)
+	resp, err := dstBlob.StartCopyFromURL(ctx, cc.NewBlobClient(src).URL(), nil)
+	if err != nil {
+		return mapError(err)
+	}
+	// Copies within an account usually complete synchronously.
+	status := resp.CopyStatus
+	for status != nil && *status == blob.CopyStatusTypePending {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(copyPollInterval):
+		}
+		props, err := dstBlob.GetProperties(ctx, nil)
+		if err != nil {
+			return mapError(err)
+		}
+		status = props.CopyStatus
+	}
+	if status != nil && *status != blob.CopyStatusTypeSuccess {
+		return &os.LinkError{Op: "copy", Old: src, New: dst, Err: ErrCopyFailed}
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+package azurefs
+
+import "errors"
+
+var (
+	ErrNoContainerInName = errors.New("no container name found in the name")
+	ErrEmptyBlobName     = errors.New("blob name is empty")
+	ErrOutOfRange        = errors.New("out of range")
+	ErrCopyFailed        = errors.New("server-side copy did not succeed")
+
+	// ErrWriteAtInAppendMode is returned by WriteAt on files opened with
+	// O_APPEND, like in os.
+	ErrWriteAtInAppendMode = errors.New("invalid use of WriteAt on file opened with O_APPEND")
+)
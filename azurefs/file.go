@@ -0,0 +1,368 @@
+package azurefs
+
+import (
+	"errors"
+	"io"
+	"os"
+	"syscall"
+
+	"github.com/spf13/afero"
+	"github.com/spf13/afero/internal/common"
+)
+
+// File is a blob or directory opened from a Fs.
+type File struct {
+	fs         *Fs
+	name       string
+	cont, blob string
+	flag       int
+	info       os.FileInfo
+	off        int64
+
+	// reader streams the content from readerOff for sequential reads.
+	reader    io.ReadCloser
+	readerOff int64
+
+	// writer feeds the running upload, which returns its result on done.
+	// writerOff is the offset of the next byte written and base the size
+	// of the blob when the upload started.
+	writer    *io.PipeWriter
+	writerOff int64
+	base      int64
+	done      chan error
+
+	dir    common.DirLister
+	closed bool
+}
+
+var _ afero.File = (*File)(nil)
+
+func (f *File) Name() string { return f.name }
+
+func (f *File) Close() error {
+	if f.closed {
+		return afero.ErrFileClosed
+	}
+	err := f.commit()
+	f.closeReader()
+	f.closed = true
+	return err
+}
+
+func (f *File) closeReader() {
+	if f.reader != nil {
+		f.reader.Close()
+		f.reader = nil
+	}
+}
+
+// Sync commits the running upload, if any.
+func (f *File) Sync() error {
+	if f.closed {
+		return afero.ErrFileClosed
+	}
+	return f.commit()
+}
+
+// startUpload begins a new upload of the blob whose content up to off is
+// copied from the current one.
+func (f *File) startUpload(off int64) error {
+	var size int64
+	e, err := f.fs.client.properties(f.fs.ctx, f.cont, f.blob)
+	switch {
+	case err == nil:
+		size = e.size
+	case !errors.Is(err, os.ErrNotExist):
+		return err
+	}
+	if off > size {
+		return ErrOutOfRange
+	}
+
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := f.fs.client.upload(f.fs.ctx, f.cont, f.blob, pr)
+		pr.CloseWithError(err)
+		done <- err
+	}()
+	f.writer, f.writerOff, f.base, f.done = pw, off, size, done
+	if off > 0 {
+		if err := f.copyRange(0, off); err != nil {
+			f.abort(err)
+			return err
+		}
+	}
+	return nil
+}
+
+// copyRange writes the current content of the blob from off to end, or to
+// its end if end is negative, to the upload.
+func (f *File) copyRange(off, end int64) error {
+	count := int64(0)
+	if end >= 0 {
+		count = end - off
+	}
+	r, err := f.fs.client.download(f.fs.ctx, f.cont, f.blob, off, count)
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	_, err = io.Copy(f.writer, r)
+	return err
+}
+
+// abort cancels the running upload.
+func (f *File) abort(err error) {
+	f.writer.CloseWithError(err)
+	<-f.done
+	f.writer = nil
+}
+
+// commit finishes the running upload, keeping the content of the blob
+// after the last write.
+func (f *File) commit() error {
+	if f.writer == nil {
+		return nil
+	}
+	if f.base > f.writerOff {
+		if err := f.copyRange(f.writerOff, -1); err != nil {
+			f.abort(err)
+			return &os.PathError{Op: "write", Path: f.name, Err: err}
+		}
+	}
+	f.writer.Close()
+	err := <-f.done
+	f.writer = nil
+	if err != nil {
+		return &os.PathError{Op: "write", Path: f.name, Err: err}
+	}
+	return nil
+}
+
+func (f *File) Read(p []byte) (int, error) {
+	if f.closed {
+		return 0, afero.ErrFileClosed
+	}
+	if f.info.IsDir() {
+		return 0, &os.PathError{Op: "read", Path: f.name, Err: syscall.EISDIR}
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if err := f.commit(); err != nil {
+		return 0, err
+	}
+	if f.reader == nil || f.readerOff != f.off {
+		f.closeReader()
+		r, err := f.fs.client.download(f.fs.ctx, f.cont, f.blob, f.off, 0)
+		if err == io.EOF {
+			return 0, io.EOF
+		}
+		if err != nil {
+			return 0, &os.PathError{Op: "read", Path: f.name, Err: err}
+		}
+		f.reader, f.readerOff = r, f.off
+	}
+	n, err := f.reader.Read(p)
+	f.off += int64(n)
+	f.readerOff = f.off
+	if err != nil && err != io.EOF {
+		err = &os.PathError{Op: "read", Path: f.name, Err: err}
+	}
+	return n, err
+}
+
+func (f *File) ReadAt(p []byte, off int64) (int, error) {
+	if f.closed {
+		return 0, afero.ErrFileClosed
+	}
+	if f.info.IsDir() {
+		return 0, &os.PathError{Op: "read", Path: f.name, Err: syscall.EISDIR}
+	}
+	if off < 0 {
+		return 0, &os.PathError{Op: "readat", Path: f.name, Err: ErrOutOfRange}
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if err := f.commit(); err != nil {
+		return 0, err
+	}
+	r, err := f.fs.client.download(f.fs.ctx, f.cont, f.blob, off, int64(len(p)))
+	if err == io.EOF {
+		return 0, io.EOF
+	}
+	if err != nil {
+		return 0, &os.PathError{Op: "read", Path: f.name, Err: err}
+	}
+	defer r.Close()
+	n, err := io.ReadFull(r, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	if f.closed {
+		return 0, afero.ErrFileClosed
+	}
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.off
+	case io.SeekEnd:
+		if err := f.commit(); err != nil {
+			return 0, err
+		}
+		fi, err := f.fs.Stat(f.name)
+		if err != nil {
+			return 0, err
+		}
+		offset += fi.Size()
+	}
+	if offset < 0 {
+		return 0, &os.PathError{Op: "seek", Path: f.name, Err: syscall.EINVAL}
+	}
+	f.off = offset
+	return offset, nil
+}
+
+// Write writes p at the offset of f, or with O_APPEND at the end of the
+// blob, wherever the offset is. Sequential appends continue the running
+// upload; the first one copies the current content of the blob to it.
+func (f *File) Write(p []byte) (int, error) {
+	if f.closed {
+		return 0, afero.ErrFileClosed
+	}
+	if f.flag&os.O_APPEND != 0 {
+		end, err := f.end()
+		if err != nil {
+			return 0, &os.PathError{Op: "write", Path: f.name, Err: err}
+		}
+		f.off = end
+	}
+	n, err := f.writeAt(p, f.off)
+	f.off += int64(n)
+	return n, err
+}
+
+// end returns the size the blob has once the running upload is committed.
+func (f *File) end() (int64, error) {
+	if f.writer != nil {
+		return max(f.writerOff, f.base), nil
+	}
+	e, err := f.fs.client.properties(f.fs.ctx, f.cont, f.blob)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	return e.size, err
+}
+
+func (f *File) WriteAt(p []byte, off int64) (int, error) {
+	if f.closed {
+		return 0, afero.ErrFileClosed
+	}
+	if f.flag&os.O_APPEND != 0 {
+		return 0, &os.PathError{Op: "writeat", Path: f.name, Err: ErrWriteAtInAppendMode}
+	}
+	return f.writeAt(p, off)
+}
+
+func (f *File) writeAt(p []byte, off int64) (int, error) {
+	if f.flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND) == 0 {
+		return 0, &os.PathError{Op: "write", Path: f.name, Err: syscall.EBADF}
+	}
+	if f.writer == nil || f.writerOff != off {
+		if err := f.commit(); err != nil {
+			return 0, err
+		}
+		f.closeReader()
+		if err := f.startUpload(off); err != nil {
+			return 0, &os.PathError{Op: "write", Path: f.name, Err: err}
+		}
+	}
+	n, err := f.writer.Write(p)
+	f.writerOff += int64(n)
+	if err != nil {
+		err = &os.PathError{Op: "write", Path: f.name, Err: err}
+	}
+	return n, err
+}
+
+func (f *File) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *File) Truncate(size int64) error {
+	if f.closed {
+		return afero.ErrFileClosed
+	}
+	if size < 0 {
+		return &os.PathError{Op: "truncate", Path: f.name, Err: ErrOutOfRange}
+	}
+	if err := f.commit(); err != nil {
+		return err
+	}
+	f.closeReader()
+	fi, err := f.fs.Stat(f.name)
+	if err != nil {
+		return err
+	}
+	if err := f.startUpload(0); err != nil {
+		return &os.PathError{Op: "truncate", Path: f.name, Err: err}
+	}
+	f.base = 0 // drop the content after size
+	if keep := min(size, fi.Size()); keep > 0 {
+		if err := f.copyRange(0, keep); err != nil {
+			f.abort(err)
+			return &os.PathError{Op: "truncate", Path: f.name, Err: err}
+		}
+	}
+	if pad := size - fi.Size(); pad > 0 {
+		if _, err := f.writer.Write(make([]byte, pad)); err != nil {
+			f.abort(err)
+			return &os.PathError{Op: "truncate", Path: f.name, Err: err}
+		}
+	}
+	f.writerOff = size
+	return f.commit()
+}
+
+func (f *File) Stat() (os.FileInfo, error) {
+	if f.closed {
+		return nil, afero.ErrFileClosed
+	}
+	if err := f.commit(); err != nil {
+		return nil, err
+	}
+	return f.fs.Stat(f.name)
+}
+
+func (f *File) Readdir(count int) ([]os.FileInfo, error) {
+	if f.closed {
+		return nil, afero.ErrFileClosed
+	}
+	if !f.info.IsDir() {
+		return nil, &os.PathError{Op: "readdir", Path: f.name, Err: syscall.ENOTDIR}
+	}
+	return f.dir.Readdir(count, func() ([]os.FileInfo, error) {
+		entries, err := f.fs.readDir(f.name)
+		if err != nil {
+			return nil, err
+		}
+		return entries, io.EOF
+	})
+}
+
+func (f *File) Readdirnames(n int) ([]string, error) {
+	entries, err := f.Readdir(n)
+	names := make([]string, len(entries))
+	for i, fi := range entries {
+		names[i] = fi.Name()
+	}
+	return names, err
+}
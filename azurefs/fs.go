@@ -0,0 +1,346 @@
+// Package azurefs provides an afero.Fs for Azure Blob Storage.
+//
+// The first element of a path is the container, the rest is the name of
+// the blob: "photos/2024/cat.jpg" is the blob "2024/cat.jpg" in the
+// container "photos". Like gcsfs, directories are emulated: Mkdir stores an
+// empty placeholder blob with a trailing slash, and every prefix of a blob
+// name is a directory as well.
+package azurefs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+
+	"github.com/spf13/afero"
+)
+
+const (
+	defaultFileMode = 0o644
+	defaultDirMode  = os.ModeDir | 0o755
+)
+
+// Fs is an afero.Fs for the containers of a storage account.
+//
+// Files opened for writing are uploaded as block blobs while they are
+// written, the upload is committed on Sync and Close. Writes which do not
+// continue the previous one commit it and start a new upload, copying the
+// existing content before the offset, and after the written data on commit.
+type Fs struct {
+	ctx    context.Context
+	client blobClient
+}
+
+// New returns a Fs using client.
+func New(ctx context.Context, client *azblob.Client) afero.Fs {
+	return &Fs{ctx: ctx, client: &sdkClient{client: client}}
+}
+
+// NewFromConnectionString returns a Fs for the storage account of a
+// connection string.
+func NewFromConnectionString(ctx context.Context, connectionString string) (afero.Fs, error) {
+	client, err := azblob.NewClientFromConnectionString(connectionString, nil)
+	if err != nil {
+		return nil, err
+	}
+	return New(ctx, client), nil
+}
+
+// WithContext returns a copy of fs whose operations, and the files opened
+// through it, use ctx.
+func (fs *Fs) WithContext(ctx context.Context) afero.Fs {
+	c := *fs
+	c.ctx = ctx
+	return &c
+}
+
+// OpenFileContext opens name like OpenFile, with ctx used for opening it
+// and for the requests of the file, so that ReadFileContext and the other
+// context helpers of afero can cancel them.
+func (fs *Fs) OpenFileContext(ctx context.Context, name string, flag int, perm os.FileMode) (afero.File, error) {
+	return fs.WithContext(ctx).OpenFile(name, flag, perm)
+}
+
+func (fs *Fs) Name() string { return "AzureFs" }
+
+// PathSeparator returns "/", which separates the elements of blob names
+// on every OS.
+func (fs *Fs) PathSeparator() string { return "/" }
+
+// split returns the container and blob name of name.
+func split(name string) (cont, blobName string) {
+	name = path.Clean("/" + strings.ReplaceAll(name, "\\", "/"))[1:]
+	cont, blobName, _ = strings.Cut(name, "/")
+	return cont, blobName
+}
+
+func sortEntries(entries []blobEntry) {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+}
+
+func (fs *Fs) Stat(name string) (os.FileInfo, error) {
+	cont, blobName := split(name)
+	if cont == "" {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: ErrNoContainerInName}
+	}
+	if blobName == "" {
+		if err := fs.client.containerExists(fs.ctx, cont); err != nil {
+			return nil, &os.PathError{Op: "stat", Path: name, Err: err}
+		}
+		return &fileInfo{name: cont, mode: defaultDirMode}, nil
+	}
+
+	e, err := fs.client.properties(fs.ctx, cont, blobName)
+	if err == nil {
+		return &fileInfo{name: path.Base(blobName), size: e.size, mode: defaultFileMode, modTime: e.modTime}, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: err}
+	}
+	// A directory has a placeholder or blobs below it.
+	entries, err := fs.client.list(fs.ctx, cont, blobName+"/", true)
+	if err != nil {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: err}
+	}
+	if len(entries) == 0 {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+	}
+	fi := &fileInfo{name: path.Base(blobName), mode: defaultDirMode}
+	if entries[0].name == blobName+"/" {
+		fi.modTime = entries[0].modTime
+	}
+	return fi, nil
+}
+
+// readDir returns the entries of the directory name, sorted by name.
+func (fs *Fs) readDir(name string) ([]os.FileInfo, error) {
+	cont, blobName := split(name)
+	prefix := ""
+	if blobName != "" {
+		prefix = blobName + "/"
+	}
+	entries, err := fs.client.list(fs.ctx, cont, prefix, true)
+	if err != nil {
+		return nil, &os.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, e := range entries {
+		if e.name == prefix {
+			continue // the placeholder of the directory itself
+		}
+		base := strings.TrimSuffix(e.name[len(prefix):], "/")
+		if e.prefix {
+			infos = append(infos, &fileInfo{name: base, mode: defaultDirMode})
+		} else if !strings.HasSuffix(e.name, "/") {
+			infos = append(infos, &fileInfo{name: base, size: e.size, mode: defaultFileMode, modTime: e.modTime})
+		}
+	}
+	return infos, nil
+}
+
+func (fs *Fs) Create(name string) (afero.File, error) {
+	return fs.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, defaultFileMode)
+}
+
+func (fs *Fs) Open(name string) (afero.File, error) {
+	return fs.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (fs *Fs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	cont, blobName := split(name)
+	write := flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_TRUNC) != 0
+	fi, err := fs.Stat(name)
+	switch {
+	case err == nil && flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL:
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrExist}
+	case err == nil && fi.IsDir() && write:
+		return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
+	case err == nil:
+	case errors.Is(err, os.ErrNotExist) && flag&os.O_CREATE != 0 && blobName != "":
+		fi = &fileInfo{name: path.Base(blobName), mode: defaultFileMode, modTime: time.Now()}
+	default:
+		return nil, &os.PathError{Op: "open", Path: name, Err: err.(*os.PathError).Err}
+	}
+
+	f := &File{fs: fs, name: name, cont: cont, blob: blobName, flag: flag, info: fi}
+	if !write && flag&os.O_CREATE == 0 {
+		return f, nil
+	}
+	// Create and truncate right away, so the blob exists even if nothing is
+	// ever written to it.
+	if err != nil || flag&os.O_TRUNC != 0 && fi.Size() > 0 {
+		if err := fs.client.upload(fs.ctx, cont, blobName, strings.NewReader("")); err != nil {
+			return nil, &os.PathError{Op: "open", Path: name, Err: err}
+		}
+	} else if flag&os.O_APPEND != 0 {
+		f.off = fi.Size()
+	}
+	return f, nil
+}
+
+func (fs *Fs) Mkdir(name string, perm os.FileMode) error {
+	cont, blobName := split(name)
+	if cont == "" {
+		return &os.PathError{Op: "mkdir", Path: name, Err: ErrNoContainerInName}
+	}
+	if blobName == "" {
+		// containers are managed outside of the Fs
+		return &os.PathError{Op: "mkdir", Path: name, Err: ErrEmptyBlobName}
+	}
+	if _, err := fs.Stat(name); err == nil {
+		return &os.PathError{Op: "mkdir", Path: name, Err: os.ErrExist}
+	}
+	if err := fs.client.upload(fs.ctx, cont, blobName+"/", strings.NewReader("")); err != nil {
+		return &os.PathError{Op: "mkdir", Path: name, Err: err}
+	}
+	return nil
+}
+
+func (fs *Fs) MkdirAll(name string, perm os.FileMode) error {
+	cont, blobName := split(name)
+	if cont == "" {
+		return &os.PathError{Op: "mkdir", Path: name, Err: ErrNoContainerInName}
+	}
+	if blobName == "" {
+		return &os.PathError{Op: "mkdir", Path: name, Err: ErrEmptyBlobName}
+	}
+	dir := cont
+	for _, elem := range strings.Split(blobName, "/") {
+		dir += "/" + elem
+		fi, err := fs.Stat(dir)
+		if err == nil {
+			if !fi.IsDir() {
+				return &os.PathError{Op: "mkdir", Path: dir, Err: syscall.ENOTDIR}
+			}
+			continue
+		}
+		if err := fs.Mkdir(dir, perm); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (fs *Fs) Remove(name string) error {
+	cont, blobName := split(name)
+	fi, err := fs.Stat(name)
+	if err != nil {
+		return &os.PathError{Op: "remove", Path: name, Err: err.(*os.PathError).Err}
+	}
+	if blobName == "" {
+		return &os.PathError{Op: "remove", Path: name, Err: ErrEmptyBlobName}
+	}
+	if !fi.IsDir() {
+		if err := fs.client.remove(fs.ctx, cont, blobName); err != nil {
+			return &os.PathError{Op: "remove", Path: name, Err: err}
+		}
+		return nil
+	}
+	infos, err := fs.readDir(name)
+	if err != nil {
+		return err
+	}
+	if len(infos) > 0 {
+		return &os.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
+	}
+	err = fs.client.remove(fs.ctx, cont, blobName+"/")
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return &os.PathError{Op: "remove", Path: name, Err: err}
+	}
+	return nil
+}
+
+func (fs *Fs) RemoveAll(name string) error {
+	cont, blobName := split(name)
+	if blobName == "" {
+		return &os.PathError{Op: "RemoveAll", Path: name, Err: ErrEmptyBlobName}
+	}
+	fi, err := fs.Stat(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fs.Remove(name)
+	}
+	entries, err := fs.client.list(fs.ctx, cont, blobName+"/", false)
+	if err != nil {
+		return &os.PathError{Op: "RemoveAll", Path: name, Err: err}
+	}
+	for _, e := range entries {
+		if err := fs.client.remove(fs.ctx, cont, e.name); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return &os.PathError{Op: "RemoveAll", Path: name, Err: err}
+		}
+	}
+	return nil
+}
+
+// Rename copies the blob, or all blobs of a directory, server-side and then
+// deletes the originals. Both names must be in the same container.
+func (fs *Fs) Rename(oldname, newname string) error {
+	oldCont, oldBlob := split(oldname)
+	newCont, newBlob := split(newname)
+	if oldBlob == "" || newBlob == "" {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: ErrEmptyBlobName}
+	}
+	if oldCont != newCont {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: afero.ErrCrossDevice}
+	}
+	fi, err := fs.Stat(oldname)
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err.(*os.PathError).Err}
+	}
+
+	moves := []blobEntry{{name: oldBlob}}
+	if fi.IsDir() {
+		if moves, err = fs.client.list(fs.ctx, oldCont, oldBlob+"/", false); err != nil {
+			return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err}
+		}
+	}
+	for _, e := range moves {
+		dst := newBlob + e.name[len(oldBlob):]
+		if err := fs.client.copy(fs.ctx, oldCont, e.name, dst); err != nil {
+			return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err}
+		}
+		if err := fs.client.remove(fs.ctx, oldCont, e.name); err != nil {
+			return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err}
+		}
+	}
+	return nil
+}
+
+func (fs *Fs) Chmod(_ string, _ os.FileMode) error {
+	return fmt.Errorf("method Chmod is not implemented in Azure Blob Storage: %w", errors.ErrUnsupported)
+}
+
+func (fs *Fs) Chtimes(_ string, _, _ time.Time) error {
+	return fmt.Errorf("method Chtimes is not implemented, blob times are set by Azure Blob Storage: %w", errors.ErrUnsupported)
+}
+
+func (fs *Fs) Chown(_ string, _, _ int) error {
+	return fmt.Errorf("method Chown is not implemented in Azure Blob Storage: %w", errors.ErrUnsupported)
+}
+
+type fileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (fi *fileInfo) Name() string       { return fi.name }
+func (fi *fileInfo) Size() int64        { return fi.size }
+func (fi *fileInfo) Mode() os.FileMode  { return fi.mode }
+func (fi *fileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *fileInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi *fileInfo) Sys() interface{}   { return nil }
@@ -0,0 +1,32 @@
+package azurefs
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"os"
+	"path"
+
+	"github.com/spf13/afero"
+)
+
+// The az scheme opens az://container/prefix with afero.OpenURL, rooted at
+// the prefix in the container, or all containers for az:// alone. The
+// storage account is the one of the connection string in the
+// AZURE_STORAGE_CONNECTION_STRING env variable.
+func init() {
+	afero.RegisterScheme("az", func(ctx context.Context, u *url.URL) (afero.Fs, error) {
+		cs := os.Getenv("AZURE_STORAGE_CONNECTION_STRING")
+		if cs == "" {
+			return nil, errors.New("azurefs: AZURE_STORAGE_CONNECTION_STRING is not set")
+		}
+		fs, err := NewFromConnectionString(ctx, cs)
+		if err != nil {
+			return nil, err
+		}
+		if root := path.Join("/", u.Host, u.Path); root != "/" {
+			fs = afero.NewBasePathFs(fs, root)
+		}
+		return fs, nil
+	})
+}
@@ -1,11 +1,15 @@
 package afero
 
 import (
+	"container/list"
+	"errors"
+	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -22,11 +26,28 @@ var (
 //
 // Note that it does not clean the error messages on return, so you may
 // reveal the real path on errors.
+//
+// Symlinks within the base path are followed by the source Fs, so they can
+// point outside of it. Use NewHardenedBasePathFs to prevent that.
 type BasePathFs struct {
 	source Fs
 	path   string
+
+	// hardened makes the BasePathFs resolve symlinks itself.
+	hardened bool
+
+	// root, if set, is called for the real paths below the base path
+	// instead of source.
+	root *OsRootFs
+
+	// paths caches the real paths of a BasePathFs which is not hardened.
+	paths pathCache
 }
 
+// ErrEscapesBasePath is returned by a hardened BasePathFs for names whose
+// symlinks lead outside of the base path.
+var ErrEscapesBasePath = errors.New("path escapes from base path")
+
 type BasePathFile struct {
 	File
 	path string
@@ -34,7 +55,7 @@ type BasePathFile struct {
 
 func (f *BasePathFile) Name() string {
 	sourcename := f.File.Name()
-	return strings.TrimPrefix(sourcename, filepath.Clean(f.path))
+	return strings.TrimPrefix(sourcename, f.path)
 }
 
 func (f *BasePathFile) ReadDir(n int) ([]fs.DirEntry, error) {
@@ -44,26 +65,184 @@ func (f *BasePathFile) ReadDir(n int) ([]fs.DirEntry, error) {
 	return readDirFile{f.File}.ReadDir(n)
 }
 
+func (f *BasePathFile) ReadFrom(r io.Reader) (int64, error) {
+	return readFrom(f.File, r)
+}
+
+func (f *BasePathFile) WriteTo(w io.Writer) (int64, error) {
+	return writeTo(f.File, w)
+}
+
+// NewBasePathFs returns a BasePathFs restricting source to path. If source
+// is a BasePathFs itself, which is not hardened, and path stays below its
+// base path, the result is a single BasePathFs for the joined path over its
+// source.
 func NewBasePathFs(source Fs, path string) Fs {
+	if inner, ok := source.(*BasePathFs); ok && !inner.hardened && inner.root == nil && validateBasePathName(path) == nil {
+		rel := Clean(inner.source, path)
+		if rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+PathSeparatorOf(inner.source)) {
+			return &BasePathFs{source: inner.source, path: Join(inner.source, inner.path, path)}
+		}
+	}
 	return &BasePathFs{source: source, path: path}
 }
 
+// NewHardenedBasePathFs returns a BasePathFs that is a jail for symlinks,
+// like openat2 with RESOLVE_BENEATH. It resolves all symlinks in the given
+// names itself, one path element at a time, and fails with
+// ErrEscapesBasePath if a step leads outside the base path. The last
+// element is only resolved by the operations following symlinks, so
+// symlinks themselves can still be removed, renamed and read.
+//
+// The checks are not atomic: a symlink changed between the check and the
+// call to the source Fs is followed by the source. Over an OsFs, when built
+// with Go 1.25 or later and the base path exists, the calls go through an
+// OsRootFs for the base path instead, which closes that window.
+func NewHardenedBasePathFs(source Fs, path string) Fs {
+	return &BasePathFs{source: source, path: path, hardened: true, root: hardenedRoot(source, path)}
+}
+
+// target returns the Fs to call for path, a real path below the base path,
+// and the name to call it with.
+func (b *BasePathFs) target(path string) (Fs, string) {
+	if b.root == nil {
+		return b.source, path
+	}
+	return b.root, strings.TrimPrefix(path, filepath.Clean(b.path))
+}
+
 // on a file outside the base path it returns the given file name and an error,
 // else the given file with the base path prepended
 func (b *BasePathFs) RealPath(name string) (path string, err error) {
+	return b.realPath(name, true)
+}
+
+// realPath is RealPath, but in a hardened BasePathFs only resolves a
+// symlink in the last element of name if follow is set.
+func (b *BasePathFs) realPath(name string, follow bool) (path string, err error) {
+	if !b.hardened {
+		if path, ok := b.paths.get(name); ok {
+			return path, nil
+		}
+	}
 	if err := validateBasePathName(name); err != nil {
 		return name, err
 	}
 
-	bpath := filepath.Clean(b.path)
-	path = filepath.Clean(filepath.Join(bpath, name))
+	bpath := Clean(b.source, b.path)
+	path = Join(b.source, bpath, name)
 	if !strings.HasPrefix(path, bpath) {
 		return name, os.ErrNotExist
 	}
+	if b.hardened {
+		return b.resolve(bpath, strings.TrimPrefix(path, bpath), follow)
+	}
 
+	b.paths.put(name, path)
 	return path, nil
 }
 
+// basePathCacheSize is the number of real paths a BasePathFs caches.
+const basePathCacheSize = 256
+
+// pathCache holds the most recently used real paths of a BasePathFs, which
+// only depend on the names as long as symlinks are not resolved.
+type pathCache struct {
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   list.List // of *pathEntry, most recently used first
+}
+
+type pathEntry struct {
+	name, path string
+}
+
+func (c *pathCache) get(name string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[name]
+	if !ok {
+		return "", false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*pathEntry).path, true
+}
+
+func (c *pathCache) put(name, path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]*list.Element)
+	}
+	if _, ok := c.entries[name]; ok {
+		return
+	}
+	c.entries[name] = c.order.PushFront(&pathEntry{name: name, path: path})
+	if c.order.Len() > basePathCacheSize {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*pathEntry).name)
+	}
+}
+
+// resolve returns the path of name below bpath with all symlinks resolved,
+// the one in the last element only if follow is set.
+func (b *BasePathFs) resolve(bpath, name string, follow bool) (string, error) {
+	reader, ok := b.source.(LinkReader)
+	if !ok {
+		return filepath.Join(bpath, name), nil
+	}
+	sep := string(filepath.Separator)
+	inBase := func(p string) bool {
+		return p == bpath || strings.HasPrefix(p, strings.TrimSuffix(bpath, sep)+sep)
+	}
+
+	cur := bpath
+	rest := strings.Split(name, sep)
+	links := 0
+	for len(rest) > 0 {
+		elem := rest[0]
+		rest = rest[1:]
+		switch elem {
+		case "", ".":
+			continue
+		case "..":
+			if cur == bpath {
+				return name, ErrEscapesBasePath
+			}
+			cur = filepath.Dir(cur)
+			continue
+		}
+		next := filepath.Join(cur, elem)
+		if len(rest) == 0 && !follow {
+			return next, nil
+		}
+		fi, err := lstatIfPossible(b.source, next)
+		if err != nil || fi.Mode()&os.ModeSymlink == 0 {
+			// Missing elements cannot be symlinks; creating them is up
+			// to the source.
+			cur = next
+			continue
+		}
+		if links++; links > maxSymlinks {
+			return name, errLoop
+		}
+		target, err := reader.ReadlinkIfPossible(next)
+		if err != nil {
+			return name, err
+		}
+		if filepath.IsAbs(target) {
+			target = filepath.Clean(target)
+			if !inBase(target) {
+				return name, ErrEscapesBasePath
+			}
+			cur, target = bpath, strings.TrimPrefix(target, bpath)
+		}
+		rest = append(strings.Split(target, sep), rest...)
+	}
+	return cur, nil
+}
+
 func validateBasePathName(name string) error {
 	if runtime.GOOS != "windows" {
 		// Not much to do here;
@@ -84,114 +263,140 @@ func (b *BasePathFs) Chtimes(name string, atime, mtime time.Time) (err error) {
 	if name, err = b.RealPath(name); err != nil {
 		return &os.PathError{Op: "chtimes", Path: name, Err: err}
 	}
-	return b.source.Chtimes(name, atime, mtime)
+	fs, name := b.target(name)
+	return fs.Chtimes(name, atime, mtime)
 }
 
 func (b *BasePathFs) Chmod(name string, mode os.FileMode) (err error) {
 	if name, err = b.RealPath(name); err != nil {
 		return &os.PathError{Op: "chmod", Path: name, Err: err}
 	}
-	return b.source.Chmod(name, mode)
+	fs, name := b.target(name)
+	return fs.Chmod(name, mode)
 }
 
 func (b *BasePathFs) Chown(name string, uid, gid int) (err error) {
 	if name, err = b.RealPath(name); err != nil {
 		return &os.PathError{Op: "chown", Path: name, Err: err}
 	}
-	return b.source.Chown(name, uid, gid)
+	fs, name := b.target(name)
+	return fs.Chown(name, uid, gid)
 }
 
 func (b *BasePathFs) Name() string {
 	return "BasePathFs"
 }
 
+// Unwrap returns the source Fs, whose paths are not restricted to the base
+// path.
+func (b *BasePathFs) Unwrap() Fs {
+	return b.source
+}
+
+// Capabilities returns those of the source, all of which a BasePathFs passes
+// on.
+func (b *BasePathFs) Capabilities() Capability {
+	return Capabilities(b.source)
+}
+
 func (b *BasePathFs) Stat(name string) (fi os.FileInfo, err error) {
 	if name, err = b.RealPath(name); err != nil {
 		return nil, &os.PathError{Op: "stat", Path: name, Err: err}
 	}
-	return b.source.Stat(name)
+	fs, name := b.target(name)
+	return fs.Stat(name)
 }
 
 func (b *BasePathFs) Rename(oldname, newname string) (err error) {
-	if oldname, err = b.RealPath(oldname); err != nil {
+	if oldname, err = b.realPath(oldname, false); err != nil {
 		return &os.PathError{Op: "rename", Path: oldname, Err: err}
 	}
-	if newname, err = b.RealPath(newname); err != nil {
+	if newname, err = b.realPath(newname, false); err != nil {
 		return &os.PathError{Op: "rename", Path: newname, Err: err}
 	}
-	return b.source.Rename(oldname, newname)
+	fs, oldname := b.target(oldname)
+	_, newname = b.target(newname)
+	return fs.Rename(oldname, newname)
 }
 
 func (b *BasePathFs) RemoveAll(name string) (err error) {
-	if name, err = b.RealPath(name); err != nil {
-		return &os.PathError{Op: "remove_all", Path: name, Err: err}
+	if name, err = b.realPath(name, false); err != nil {
+		return &os.PathError{Op: "RemoveAll", Path: name, Err: err}
 	}
-	return b.source.RemoveAll(name)
+	fs, name := b.target(name)
+	return fs.RemoveAll(name)
 }
 
 func (b *BasePathFs) Remove(name string) (err error) {
-	if name, err = b.RealPath(name); err != nil {
+	if name, err = b.realPath(name, false); err != nil {
 		return &os.PathError{Op: "remove", Path: name, Err: err}
 	}
-	return b.source.Remove(name)
+	fs, name := b.target(name)
+	return fs.Remove(name)
 }
 
 func (b *BasePathFs) OpenFile(name string, flag int, mode os.FileMode) (f File, err error) {
 	if name, err = b.RealPath(name); err != nil {
-		return nil, &os.PathError{Op: "openfile", Path: name, Err: err}
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
 	}
-	sourcef, err := b.source.OpenFile(name, flag, mode)
+	fs, name := b.target(name)
+	sourcef, err := fs.OpenFile(name, flag, mode)
 	if err != nil {
 		return nil, err
 	}
-	return &BasePathFile{sourcef, b.path}, nil
+	return &BasePathFile{sourcef, Clean(b.source, b.path)}, nil
 }
 
 func (b *BasePathFs) Open(name string) (f File, err error) {
 	if name, err = b.RealPath(name); err != nil {
 		return nil, &os.PathError{Op: "open", Path: name, Err: err}
 	}
-	sourcef, err := b.source.Open(name)
+	fs, name := b.target(name)
+	sourcef, err := fs.Open(name)
 	if err != nil {
 		return nil, err
 	}
-	return &BasePathFile{File: sourcef, path: b.path}, nil
+	return &BasePathFile{File: sourcef, path: Clean(b.source, b.path)}, nil
 }
 
 func (b *BasePathFs) Mkdir(name string, mode os.FileMode) (err error) {
-	if name, err = b.RealPath(name); err != nil {
+	if name, err = b.realPath(name, false); err != nil {
 		return &os.PathError{Op: "mkdir", Path: name, Err: err}
 	}
-	return b.source.Mkdir(name, mode)
+	fs, name := b.target(name)
+	return fs.Mkdir(name, mode)
 }
 
 func (b *BasePathFs) MkdirAll(name string, mode os.FileMode) (err error) {
 	if name, err = b.RealPath(name); err != nil {
 		return &os.PathError{Op: "mkdir", Path: name, Err: err}
 	}
-	return b.source.MkdirAll(name, mode)
+	fs, name := b.target(name)
+	return fs.MkdirAll(name, mode)
 }
 
 func (b *BasePathFs) Create(name string) (f File, err error) {
 	if name, err = b.RealPath(name); err != nil {
-		return nil, &os.PathError{Op: "create", Path: name, Err: err}
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
 	}
-	sourcef, err := b.source.Create(name)
+	fs, name := b.target(name)
+	sourcef, err := fs.Create(name)
 	if err != nil {
 		return nil, err
 	}
-	return &BasePathFile{File: sourcef, path: b.path}, nil
+	return &BasePathFile{File: sourcef, path: Clean(b.source, b.path)}, nil
 }
 
 func (b *BasePathFs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
-	name, err := b.RealPath(name)
+	name, err := b.realPath(name, false)
 	if err != nil {
 		return nil, false, &os.PathError{Op: "lstat", Path: name, Err: err}
 	}
-	if lstater, ok := b.source.(Lstater); ok {
+	fs, name := b.target(name)
+	if lstater, ok := fs.(Lstater); ok {
 		return lstater.LstatIfPossible(name)
 	}
-	fi, err := b.source.Stat(name)
+	fi, err := fs.Stat(name)
 	return fi, false, err
 }
 
@@ -200,22 +405,81 @@ func (b *BasePathFs) SymlinkIfPossible(oldname, newname string) error {
 	if err != nil {
 		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: err}
 	}
-	newname, err = b.RealPath(newname)
+	newname, err = b.realPath(newname, false)
 	if err != nil {
 		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: err}
 	}
-	if linker, ok := b.source.(Linker); ok {
+	fs, newname := b.target(newname)
+	if linker, ok := fs.(Linker); ok {
 		return linker.SymlinkIfPossible(oldname, newname)
 	}
 	return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: ErrNoSymlink}
 }
 
-func (b *BasePathFs) ReadlinkIfPossible(name string) (string, error) {
+func (b *BasePathFs) LinkIfPossible(oldname, newname string) error {
+	oldname, err := b.realPath(oldname, false)
+	if err != nil {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: err}
+	}
+	newname, err = b.realPath(newname, false)
+	if err != nil {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: err}
+	}
+	fs, oldname := b.target(oldname)
+	_, newname = b.target(newname)
+	if linker, ok := fs.(HardLinker); ok {
+		return linker.LinkIfPossible(oldname, newname)
+	}
+	return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: ErrNoLink}
+}
+
+func (b *BasePathFs) LockIfPossible(name string, exclusive bool) (io.Closer, bool, error) {
+	name, err := b.RealPath(name)
+	if err != nil {
+		return nil, false, &os.PathError{Op: "lock", Path: name, Err: err}
+	}
+	return lockIfPossible(b.source, name, exclusive)
+}
+
+func (b *BasePathFs) GetXattr(name, attr string) ([]byte, error) {
 	name, err := b.RealPath(name)
+	if err != nil {
+		return nil, &os.PathError{Op: "getxattr", Path: name, Err: err}
+	}
+	return GetXattr(b.source, name, attr)
+}
+
+func (b *BasePathFs) SetXattr(name, attr string, value []byte) error {
+	name, err := b.RealPath(name)
+	if err != nil {
+		return &os.PathError{Op: "setxattr", Path: name, Err: err}
+	}
+	return SetXattr(b.source, name, attr, value)
+}
+
+func (b *BasePathFs) ListXattr(name string) ([]string, error) {
+	name, err := b.RealPath(name)
+	if err != nil {
+		return nil, &os.PathError{Op: "listxattr", Path: name, Err: err}
+	}
+	return ListXattr(b.source, name)
+}
+
+func (b *BasePathFs) RemoveXattr(name, attr string) error {
+	name, err := b.RealPath(name)
+	if err != nil {
+		return &os.PathError{Op: "removexattr", Path: name, Err: err}
+	}
+	return RemoveXattr(b.source, name, attr)
+}
+
+func (b *BasePathFs) ReadlinkIfPossible(name string) (string, error) {
+	name, err := b.realPath(name, false)
 	if err != nil {
 		return "", &os.PathError{Op: "readlink", Path: name, Err: err}
 	}
-	if reader, ok := b.source.(LinkReader); ok {
+	fs, name := b.target(name)
+	if reader, ok := fs.(LinkReader); ok {
 		return reader.ReadlinkIfPossible(name)
 	}
 	return "", &os.PathError{Op: "readlink", Path: name, Err: ErrNoReadlink}
@@ -1,6 +1,8 @@
 package afero
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -138,6 +140,52 @@ func TestNestedBasePaths(t *testing.T) {
 	}
 }
 
+func TestNestedBasePathsCollapse(t *testing.T) {
+	memFs := NewMemMapFs()
+	nested := NewBasePathFs(NewBasePathFs(NewBasePathFs(memFs, "/a"), "b"), "/c")
+	b, ok := nested.(*BasePathFs)
+	if !ok || b.source != memFs || b.path != filepath.FromSlash("/a/b/c") {
+		t.Fatalf("nested BasePathFs = %#v, want one for /a/b/c over the MemMapFs", nested)
+	}
+	if err := WriteFile(nested, "/file", []byte("data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := memFs.Stat("/a/b/c/file"); err != nil {
+		t.Error(err)
+	}
+	for i := 0; i < 2; i++ {
+		// the second time from the cache
+		if p, err := b.RealPath("/x/../file"); err != nil || p != filepath.FromSlash("/a/b/c/file") {
+			t.Errorf("RealPath = %q, %v", p, err)
+		}
+	}
+
+	// base paths leaving the one below, and hardened ones, are kept apart
+	if up, ok := NewBasePathFs(NewBasePathFs(memFs, "/a"), "../b").(*BasePathFs); !ok || up.source == memFs {
+		t.Error("a base path above the one below was collapsed")
+	}
+	hardened := NewHardenedBasePathFs(memFs, "/a")
+	if h := NewBasePathFs(hardened, "b").(*BasePathFs); h.source != hardened {
+		t.Error("a hardened BasePathFs was collapsed")
+	}
+}
+
+func TestBasePathCacheEviction(t *testing.T) {
+	b := NewBasePathFs(NewMemMapFs(), "/base").(*BasePathFs)
+	for i := 0; i < 2*basePathCacheSize; i++ {
+		name := fmt.Sprintf("/file%d", i)
+		if p, err := b.RealPath(name); err != nil || p != filepath.Join(filepath.FromSlash("/base"), name) {
+			t.Fatalf("RealPath(%q) = %q, %v", name, p, err)
+		}
+	}
+	if n := b.paths.order.Len(); n != basePathCacheSize || len(b.paths.entries) != n {
+		t.Errorf("cache holds %d paths, want %d", n, basePathCacheSize)
+	}
+	if _, ok := b.paths.get("/file0"); ok {
+		t.Error("the least recently used path was not evicted")
+	}
+}
+
 func TestBasePathOpenFile(t *testing.T) {
 	baseFs := &MemMapFs{}
 	baseFs.MkdirAll("/base/path/tmp", 0o777)
@@ -185,3 +233,62 @@ func TestBasePathTempFile(t *testing.T) {
 		t.Fatalf("TempFile realpath leaked: expected %s, got %s", expected, actual)
 	}
 }
+
+func TestHardenedBasePathSymlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses Unix paths")
+	}
+	base := NewMemMapFs()
+	linker := base.(Linker)
+	base.MkdirAll("/jail/data", 0o755)
+	base.MkdirAll("/etc", 0o755)
+	WriteFile(base, "/etc/passwd", []byte("root"), 0o644)
+	WriteFile(base, "/jail/data/file", []byte("data"), 0o644)
+	for target, link := range map[string]string{
+		"../etc":     "/jail/up",
+		"/etc":       "/jail/abs",
+		"data":       "/jail/rel",
+		"/jail/data": "/jail/absin",
+		"data/../..": "/jail/dotdot",
+		"loop":       "/jail/loop",
+	} {
+		if err := linker.SymlinkIfPossible(target, link); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	plain := NewBasePathFs(base, "/jail")
+	if data, err := ReadFile(plain, "/up/passwd"); err != nil || string(data) != "root" {
+		t.Fatalf("plain BasePathFs: ReadFile = %q, %v; the test expects it to escape", data, err)
+	}
+
+	bp := NewHardenedBasePathFs(base, "/jail")
+	for _, name := range []string{"/up/passwd", "/abs/passwd", "/dotdot/etc/passwd", "/rel/../up/passwd"} {
+		if _, err := ReadFile(bp, name); !errors.Is(err, ErrEscapesBasePath) {
+			t.Errorf("ReadFile(%q) = %v, want ErrEscapesBasePath", name, err)
+		}
+	}
+	if _, err := bp.Create("/abs/new"); !errors.Is(err, ErrEscapesBasePath) {
+		t.Errorf("Create through escaping link = %v, want ErrEscapesBasePath", err)
+	}
+	if _, err := bp.Stat("/loop"); !errors.Is(err, errLoop) {
+		t.Errorf("Stat(loop) = %v, want ELOOP", err)
+	}
+
+	for _, name := range []string{"/rel/file", "/absin/file", "/data/../rel/file"} {
+		if data, err := ReadFile(bp, name); err != nil || string(data) != "data" {
+			t.Errorf("ReadFile(%q) = %q, %v", name, data, err)
+		}
+	}
+
+	// The escaping links themselves can still be handled.
+	if fi, _, err := bp.(Lstater).LstatIfPossible("/up"); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("Lstat(/up) = %v, %v", fi, err)
+	}
+	if target, err := bp.(LinkReader).ReadlinkIfPossible("/abs"); err != nil || target != "/etc" {
+		t.Errorf("Readlink(/abs) = %q, %v", target, err)
+	}
+	if err := bp.Remove("/up"); err != nil {
+		t.Errorf("Remove(/up) = %v", err)
+	}
+}
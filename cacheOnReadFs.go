@@ -4,6 +4,8 @@ import (
 	"os"
 	"syscall"
 	"time"
+
+	"github.com/spf13/afero/mem"
 )
 
 // If the cache duration is 0, cache time will be unlimited, i.e. once
@@ -23,10 +25,127 @@ type CacheOnReadFs struct {
 	base      Fs
 	layer     Fs
 	cacheTime time.Duration
+	maxBytes  int64
+	index     cacheIndex
+
+	// statTTL and negativeTTL are how long stats keeps the files found
+	// and not found in the base.
+	statTTL, negativeTTL time.Duration
+	stats                statCache
+
+	// clock is set by SetClock, nil means time.Now.
+	clock mem.Clock
+}
+
+// CacheOnReadOption configures a CacheOnReadFs.
+type CacheOnReadOption func(*CacheOnReadFs)
+
+// CacheOnReadStatTTL keeps the results of Stat on the base for ttl, so
+// checking files which are not in the layer, or whose cached copy expired,
+// does not reach the base every time. Changes made through the
+// CacheOnReadFs drop the results they affect; others are only seen once
+// the results expire or are dropped with InvalidatePath or InvalidateAll.
+func CacheOnReadStatTTL(ttl time.Duration) CacheOnReadOption {
+	return func(u *CacheOnReadFs) {
+		u.statTTL = ttl
+	}
+}
+
+// CacheOnReadNegativeTTL remembers for ttl that files do not exist in the
+// base, so repeated checks for missing files are answered without it. It
+// is subject to the same invalidation as CacheOnReadStatTTL.
+func CacheOnReadNegativeTTL(ttl time.Duration) CacheOnReadOption {
+	return func(u *CacheOnReadFs) {
+		u.negativeTTL = ttl
+	}
+}
+
+func NewCacheOnReadFs(base Fs, layer Fs, cacheTime time.Duration, opts ...CacheOnReadOption) Fs {
+	u := &CacheOnReadFs{base: base, layer: layer, cacheTime: cacheTime}
+	for _, opt := range opts {
+		opt(u)
+	}
+	return u
+}
+
+// NewCacheOnReadFsWithMaxSize returns a CacheOnReadFs that keeps the files
+// in the layer below maxBytes in total, evicting the least recently used
+// ones. The files are counted once they are opened through the union, so
+// the layer should not be shared with other data.
+func NewCacheOnReadFsWithMaxSize(base Fs, layer Fs, cacheTime time.Duration, maxBytes int64, opts ...CacheOnReadOption) Fs {
+	u := &CacheOnReadFs{base: base, layer: layer, cacheTime: cacheTime, maxBytes: maxBytes}
+	for _, opt := range opts {
+		opt(u)
+	}
+	return u
+}
+
+// SetClock makes the cache time count the time of c, e.g. a mem.FakeClock
+// shared with a MemMapFs layer, instead of that of time.Now. It must be set
+// before u is used.
+func (u *CacheOnReadFs) SetClock(c mem.Clock) {
+	u.clock = c
+}
+
+// now returns the time of the clock of u.
+func (u *CacheOnReadFs) now() time.Time {
+	if u.clock == nil {
+		return time.Now()
+	}
+	return u.clock.Now()
+}
+
+// InvalidatePath drops the results of Stat on the base kept for name,
+// everything below it and its parent directory. Cached copies in the layer
+// are kept.
+func (u *CacheOnReadFs) InvalidatePath(name string) {
+	u.stats.invalidate(name)
+}
+
+// InvalidateAll drops all results of Stat on the base kept by u.
+func (u *CacheOnReadFs) InvalidateAll() {
+	u.stats.clear()
+}
+
+// baseStat returns the Stat of name on the base, or the result kept from
+// an earlier call.
+func (u *CacheOnReadFs) baseStat(name string) (os.FileInfo, error) {
+	if u.statTTL <= 0 && u.negativeTTL <= 0 {
+		return u.base.Stat(name)
+	}
+	now := u.now()
+	if fi, err, ok := u.stats.get(name, now); ok {
+		return fi, err
+	}
+	fi, err := u.base.Stat(name)
+	switch {
+	case err == nil && u.statTTL > 0:
+		u.stats.put(name, fi, nil, now.Add(u.statTTL))
+	case os.IsNotExist(err) && u.negativeTTL > 0:
+		u.stats.put(name, nil, err, now.Add(u.negativeTTL))
+	}
+	return fi, err
 }
 
-func NewCacheOnReadFs(base Fs, layer Fs, cacheTime time.Duration) Fs {
-	return &CacheOnReadFs{base: base, layer: layer, cacheTime: cacheTime}
+// Stats returns the cache counters.
+func (u *CacheOnReadFs) Stats() CacheStats {
+	return u.index.snapshot()
+}
+
+// cached records that the file name was read from the layer, after copying
+// it there if hit is false, and evicts files if the cache grew too large.
+func (u *CacheOnReadFs) cached(name string, hit bool) {
+	fi, err := u.layer.Stat(name)
+	if err != nil || fi.IsDir() {
+		return
+	}
+	u.index.use(name, fi.Size(), hit)
+	if u.maxBytes <= 0 {
+		return
+	}
+	for _, evicted := range u.index.evict(u.maxBytes) {
+		u.layer.Remove(evicted)
+	}
 }
 
 type cacheState int
@@ -52,8 +171,8 @@ func (u *CacheOnReadFs) cacheStatus(name string) (state cacheState, fi os.FileIn
 		if u.cacheTime == 0 {
 			return cacheHit, lfi, nil
 		}
-		if lfi.ModTime().Add(u.cacheTime).Before(time.Now()) {
-			bfi, err = u.base.Stat(name)
+		if lfi.ModTime().Add(u.cacheTime).Before(u.now()) {
+			bfi, err = u.baseStat(name)
 			if err != nil {
 				return cacheLocal, lfi, nil
 			}
@@ -75,11 +194,12 @@ func (u *CacheOnReadFs) copyToLayer(name string) error {
 	return copyToLayer(u.base, u.layer, name)
 }
 
-func (u *CacheOnReadFs) copyFileToLayer(name string, flag int, perm os.FileMode) error {
-	return copyFileToLayer(u.base, u.layer, name, flag, perm)
+func (u *CacheOnReadFs) copyFileToLayer(name string, flag int) error {
+	return copyFileToLayer(u.base, u.layer, name, flag)
 }
 
 func (u *CacheOnReadFs) Chtimes(name string, atime, mtime time.Time) error {
+	defer u.stats.invalidate(name)
 	st, _, err := u.cacheStatus(name)
 	if err != nil {
 		return err
@@ -101,6 +221,7 @@ func (u *CacheOnReadFs) Chtimes(name string, atime, mtime time.Time) error {
 }
 
 func (u *CacheOnReadFs) Chmod(name string, mode os.FileMode) error {
+	defer u.stats.invalidate(name)
 	st, _, err := u.cacheStatus(name)
 	if err != nil {
 		return err
@@ -122,6 +243,7 @@ func (u *CacheOnReadFs) Chmod(name string, mode os.FileMode) error {
 }
 
 func (u *CacheOnReadFs) Chown(name string, uid, gid int) error {
+	defer u.stats.invalidate(name)
 	st, _, err := u.cacheStatus(name)
 	if err != nil {
 		return err
@@ -149,13 +271,15 @@ func (u *CacheOnReadFs) Stat(name string) (os.FileInfo, error) {
 	}
 	switch st {
 	case cacheMiss:
-		return u.base.Stat(name)
+		return u.baseStat(name)
 	default: // cacheStale has base, cacheHit and cacheLocal the layer os.FileInfo
 		return fi, nil
 	}
 }
 
 func (u *CacheOnReadFs) Rename(oldname, newname string) error {
+	defer u.stats.invalidate(newname)
+	defer u.stats.invalidate(oldname)
 	st, _, err := u.cacheStatus(oldname)
 	if err != nil {
 		return err
@@ -173,10 +297,40 @@ func (u *CacheOnReadFs) Rename(oldname, newname string) error {
 	if err != nil {
 		return err
 	}
+	u.index.rename(oldname, newname)
 	return u.layer.Rename(oldname, newname)
 }
 
+// LinkIfPossible creates the link in the base. A cached copy of newname in
+// the layer is dropped. If the layer has hard links too, oldname is cached
+// and linked to newname there, so that writes through one name show in the
+// cached copy of the other; otherwise newname is copied again on the next
+// read.
+func (u *CacheOnReadFs) LinkIfPossible(oldname, newname string) error {
+	defer u.stats.invalidate(newname)
+	if err := Link(u.base, oldname, newname); err != nil {
+		return err
+	}
+	if err := u.layer.Remove(newname); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if !Capabilities(u.layer).Has(CapHardLink) {
+		return nil
+	}
+	st, _, err := u.cacheStatus(oldname)
+	if err != nil {
+		return err
+	}
+	if st == cacheStale || st == cacheMiss {
+		if err := u.copyToLayer(oldname); err != nil {
+			return err
+		}
+	}
+	return Link(u.layer, oldname, newname)
+}
+
 func (u *CacheOnReadFs) Remove(name string) error {
+	defer u.stats.invalidate(name)
 	st, _, err := u.cacheStatus(name)
 	if err != nil {
 		return err
@@ -189,10 +343,12 @@ func (u *CacheOnReadFs) Remove(name string) error {
 	if err != nil {
 		return err
 	}
+	u.index.forget(name)
 	return u.layer.Remove(name)
 }
 
 func (u *CacheOnReadFs) RemoveAll(name string) error {
+	defer u.stats.invalidate(name)
 	st, _, err := u.cacheStatus(name)
 	if err != nil {
 		return err
@@ -205,6 +361,7 @@ func (u *CacheOnReadFs) RemoveAll(name string) error {
 	if err != nil {
 		return err
 	}
+	u.index.forget(name)
 	return u.layer.RemoveAll(name)
 }
 
@@ -214,14 +371,18 @@ func (u *CacheOnReadFs) OpenFile(name string, flag int, perm os.FileMode) (File,
 		return nil, err
 	}
 	switch st {
-	case cacheLocal, cacheHit:
+	case cacheLocal:
+	case cacheHit:
+		u.cached(name, true)
 	default:
-		if err := u.copyFileToLayer(name, flag, perm); err != nil {
+		if err := u.copyFileToLayer(name, flag); err != nil {
 			return nil, err
 		}
+		u.cached(name, false)
 	}
 	if flag&(os.O_WRONLY|syscall.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) != 0 {
 		bfi, err := u.base.OpenFile(name, flag, perm)
+		u.stats.invalidate(name)
 		if err != nil {
 			return nil, err
 		}
@@ -235,7 +396,13 @@ func (u *CacheOnReadFs) OpenFile(name string, flag int, perm os.FileMode) (File,
 	return u.layer.OpenFile(name, flag, perm)
 }
 
+// Open returns the file from the layer, copying it there first if needed.
+// The file is read-only, writes would only reach the cached copy.
 func (u *CacheOnReadFs) Open(name string) (File, error) {
+	return readOnlyFile(u.open(name))
+}
+
+func (u *CacheOnReadFs) open(name string) (File, error) {
 	st, fi, err := u.cacheStatus(name)
 	if err != nil {
 		return nil, err
@@ -246,7 +413,7 @@ func (u *CacheOnReadFs) Open(name string) (File, error) {
 		return u.layer.Open(name)
 
 	case cacheMiss:
-		bfi, err := u.base.Stat(name)
+		bfi, err := u.baseStat(name)
 		if err != nil {
 			return nil, err
 		}
@@ -256,6 +423,7 @@ func (u *CacheOnReadFs) Open(name string) (File, error) {
 		if err := u.copyToLayer(name); err != nil {
 			return nil, err
 		}
+		u.cached(name, false)
 		return u.layer.Open(name)
 
 	case cacheStale:
@@ -263,10 +431,12 @@ func (u *CacheOnReadFs) Open(name string) (File, error) {
 			if err := u.copyToLayer(name); err != nil {
 				return nil, err
 			}
+			u.cached(name, false)
 			return u.layer.Open(name)
 		}
 	case cacheHit:
 		if !fi.IsDir() {
+			u.cached(name, true)
 			return u.layer.Open(name)
 		}
 	}
@@ -280,6 +450,7 @@ func (u *CacheOnReadFs) Open(name string) (File, error) {
 }
 
 func (u *CacheOnReadFs) Mkdir(name string, perm os.FileMode) error {
+	defer u.stats.invalidate(name)
 	err := u.base.Mkdir(name, perm)
 	if err != nil {
 		return err
@@ -291,7 +462,18 @@ func (u *CacheOnReadFs) Name() string {
 	return "CacheOnReadFs"
 }
 
+// Unwrap returns the base Fs, which the cache layer mirrors.
+func (u *CacheOnReadFs) Unwrap() Fs {
+	return u.base
+}
+
+// Capabilities returns CapHardLink of the base, hard links are created there.
+func (u *CacheOnReadFs) Capabilities() Capability {
+	return Capabilities(u.base) & CapHardLink
+}
+
 func (u *CacheOnReadFs) MkdirAll(name string, perm os.FileMode) error {
+	defer u.stats.invalidate(name)
 	err := u.base.MkdirAll(name, perm)
 	if err != nil {
 		return err
@@ -300,6 +482,7 @@ func (u *CacheOnReadFs) MkdirAll(name string, perm os.FileMode) error {
 }
 
 func (u *CacheOnReadFs) Create(name string) (File, error) {
+	defer u.stats.invalidate(name)
 	bfh, err := u.base.Create(name)
 	if err != nil {
 		return nil, err
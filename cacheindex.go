@@ -0,0 +1,166 @@
+package afero
+
+import (
+	"container/list"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheStats are the counters of a CacheOnReadFs.
+type CacheStats struct {
+	// Hits and Misses count the files opened from the cache and the files
+	// copied to it from the base.
+	Hits, Misses uint64
+	// Evictions counts the files removed from the cache to make room.
+	Evictions uint64
+	// Bytes is the size of the files in the cache, as far as they were
+	// copied or opened through the CacheOnReadFs.
+	Bytes int64
+}
+
+// cacheIndex tracks the files of the cache layer in least recently used
+// order.
+type cacheIndex struct {
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   list.List // of *cacheEntry, most recently used first
+	stats   CacheStats
+}
+
+type cacheEntry struct {
+	name string
+	size int64
+}
+
+// use records an access to name, which has the given size in the cache.
+func (c *cacheIndex) use(name string, size int64, hit bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if hit {
+		c.stats.Hits++
+	} else {
+		c.stats.Misses++
+	}
+	name = filepath.Clean(name)
+	if c.entries == nil {
+		c.entries = make(map[string]*list.Element)
+	}
+	if el, ok := c.entries[name]; ok {
+		e := el.Value.(*cacheEntry)
+		c.stats.Bytes += size - e.size
+		e.size = size
+		c.order.MoveToFront(el)
+		return
+	}
+	c.entries[name] = c.order.PushFront(&cacheEntry{name: name, size: size})
+	c.stats.Bytes += size
+}
+
+// evict returns the least recently used files to remove so that the cache
+// holds at most maxBytes. The most recently used file is never evicted.
+func (c *cacheIndex) evict(maxBytes int64) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var names []string
+	for c.stats.Bytes > maxBytes && c.order.Len() > 1 {
+		e := c.order.Remove(c.order.Back()).(*cacheEntry)
+		delete(c.entries, e.name)
+		c.stats.Bytes -= e.size
+		c.stats.Evictions++
+		names = append(names, e.name)
+	}
+	return names
+}
+
+// forget drops name and, if it is a directory, everything below it.
+func (c *cacheIndex) forget(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	name = filepath.Clean(name)
+	for n, el := range c.entries {
+		if n == name || strings.HasPrefix(n, name+FilePathSeparator) {
+			c.stats.Bytes -= el.Value.(*cacheEntry).size
+			c.order.Remove(el)
+			delete(c.entries, n)
+		}
+	}
+}
+
+// rename moves the entry of oldname to newname.
+func (c *cacheIndex) rename(oldname, newname string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	oldname, newname = filepath.Clean(oldname), filepath.Clean(newname)
+	if el, ok := c.entries[oldname]; ok {
+		delete(c.entries, oldname)
+		el.Value.(*cacheEntry).name = newname
+		c.entries[newname] = el
+	}
+}
+
+func (c *cacheIndex) snapshot() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+// statCache remembers the results of Stat on the base of a CacheOnReadFs,
+// found files and missing ones, until they expire.
+type statCache struct {
+	mu      sync.Mutex
+	entries map[string]statEntry
+}
+
+type statEntry struct {
+	fi      os.FileInfo
+	err     error
+	expires time.Time
+}
+
+// get returns the remembered result for name, if it has not expired at now.
+func (c *statCache) get(name string, now time.Time) (os.FileInfo, error, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[filepath.Clean(name)]
+	if !ok || !now.Before(e.expires) {
+		return nil, nil, false
+	}
+	return e.fi, e.err, true
+}
+
+func (c *statCache) put(name string, fi os.FileInfo, err error, expires time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]statEntry)
+	}
+	c.entries[filepath.Clean(name)] = statEntry{fi: fi, err: err, expires: expires}
+}
+
+// invalidate drops name, everything below it and the directories above
+// it, whose entries may have changed with it or which it may have created.
+func (c *statCache) invalidate(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	name = filepath.Clean(name)
+	for dir := filepath.Dir(name); ; dir = filepath.Dir(dir) {
+		delete(c.entries, dir)
+		if dir == filepath.Dir(dir) {
+			break
+		}
+	}
+	for n := range c.entries {
+		if n == name || strings.HasPrefix(n, strings.TrimSuffix(name, FilePathSeparator)+FilePathSeparator) {
+			delete(c.entries, n)
+		}
+	}
+}
+
+func (c *statCache) clear() {
+	c.mu.Lock()
+	c.entries = nil
+	c.mu.Unlock()
+}
@@ -0,0 +1,116 @@
+package afero
+
+import (
+	"errors"
+	"strings"
+)
+
+// Capability is a set of optional features a filesystem may support on top
+// of the Fs interface.
+type Capability uint
+
+const (
+	// CapLstat means the filesystem implements Lstater.
+	CapLstat Capability = 1 << iota
+	// CapSymlink means the filesystem can create symlinks (Linker).
+	CapSymlink
+	// CapReadlink means the filesystem can read symlinks (LinkReader).
+	CapReadlink
+	// CapAtomicRename means Rename replaces the target in a single step,
+	// so readers never observe a missing or partially written file.
+	CapAtomicRename
+	// CapHardLink means the filesystem can create hard links (HardLinker).
+	CapHardLink
+	// CapLock means the filesystem can lock files (Locker).
+	CapLock
+	// CapXattr means the filesystem supports extended attributes (Xattrer).
+	CapXattr
+	// CapReadAt means the files serve ReadAt directly at the offset, instead
+	// of reading everything before it or failing.
+	CapReadAt
+)
+
+var capabilityNames = []struct {
+	c    Capability
+	name string
+}{
+	{CapLstat, "lstat"},
+	{CapSymlink, "symlink"},
+	{CapReadlink, "readlink"},
+	{CapAtomicRename, "atomic-rename"},
+	{CapHardLink, "hardlink"},
+	{CapLock, "lock"},
+	{CapXattr, "xattr"},
+	{CapReadAt, "readat"},
+}
+
+func (c Capability) String() string {
+	if c == 0 {
+		return "none"
+	}
+	var names []string
+	for _, cn := range capabilityNames {
+		if c&cn.c != 0 {
+			names = append(names, cn.name)
+		}
+	}
+	return strings.Join(names, "|")
+}
+
+// Has reports whether all capabilities in other are present in c.
+func (c Capability) Has(other Capability) bool {
+	return c&other == other
+}
+
+// ErrMissingCapability is returned when a filesystem lacks a capability
+// the caller declared it needs.
+var ErrMissingCapability = errors.New("missing capability")
+
+// Capabler is implemented by filesystems which report their capabilities
+// themselves, typically wrappers whose optional interfaces are implemented
+// unconditionally and delegate to their source, so that a type assertion
+// is not enough.
+type Capabler interface {
+	Capabilities() Capability
+}
+
+// Capabilities reports the optional capabilities the given Fs actually
+// provides. A Capabler reports them itself.
+//
+// Other filesystems are checked for the optional interfaces, which cannot
+// tell CapAtomicRename or CapReadAt. If they are a WrappingFs, only the
+// capabilities of the Fs they wrap which they implement as well are
+// reported, along with CapAtomicRename and CapReadAt of that Fs: a wrapper
+// which renames or reads differently implements Capabler.
+func Capabilities(fs Fs) Capability {
+	if c, ok := fs.(Capabler); ok {
+		return c.Capabilities()
+	}
+
+	var c Capability
+	if _, ok := fs.(Lstater); ok {
+		c |= CapLstat
+	}
+	if _, ok := fs.(Linker); ok {
+		c |= CapSymlink
+	}
+	if _, ok := fs.(LinkReader); ok {
+		c |= CapReadlink
+	}
+	if _, ok := fs.(HardLinker); ok {
+		c |= CapHardLink
+	}
+	if _, ok := fs.(Locker); ok {
+		c |= CapLock
+	}
+	if _, ok := fs.(Xattrer); ok {
+		c |= CapXattr
+	}
+	if u, ok := fs.(WrappingFs); ok {
+		if inner := u.Unwrap(); inner != nil {
+			ic := Capabilities(inner)
+			c = c&ic | ic&(CapAtomicRename|CapReadAt)
+		}
+	}
+	return c
+}
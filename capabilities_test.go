@@ -0,0 +1,101 @@
+package afero
+
+import (
+	"errors"
+	"os"
+	"regexp"
+	"testing"
+)
+
+func TestCapabilities(t *testing.T) {
+	mem := &MemMapFs{}
+	osfs := &OsFs{}
+
+	tests := []struct {
+		name string
+		fs   Fs
+		want Capability
+	}{
+		{"OsFs", osfs, CapLstat | CapSymlink | CapReadlink | CapAtomicRename | CapHardLink | osCapLock | osCapXattr | CapReadAt},
+		{"MemMapFs", mem, CapLstat | CapSymlink | CapReadlink | CapAtomicRename | CapHardLink | CapLock | CapXattr | CapReadAt},
+		{"BasePathFs over OsFs", NewBasePathFs(osfs, "/tmp"), CapLstat | CapSymlink | CapReadlink | CapAtomicRename | CapHardLink | osCapLock | osCapXattr | CapReadAt},
+		{"BasePathFs over MemMapFs", NewBasePathFs(mem, "/tmp"), CapLstat | CapSymlink | CapReadlink | CapAtomicRename | CapHardLink | CapLock | CapXattr | CapReadAt},
+		{"ScannerFs over MemMapFs", NewScannerFs(mem, nil), CapLstat | CapAtomicRename | CapLock | CapXattr | CapReadAt},
+		{"ReadOnlyFs over OsFs", NewReadOnlyFs(osfs), CapLstat | CapReadlink | osCapLock | osCapXattr | CapReadAt},
+		{"RegexpFs over OsFs", NewRegexpFs(osfs, regexp.MustCompile(`\.txt$`)), CapAtomicRename | CapReadAt},
+		{"CopyOnWriteFs", NewCopyOnWriteFs(NewReadOnlyFs(osfs), mem), CapLstat | CapSymlink | CapReadlink | CapReadAt},
+		{"CacheOnReadFs", NewCacheOnReadFs(osfs, mem, 0), CapHardLink},
+		{"IOFS adapter", FromIOFS{}, 0},
+		{"wrapper with Unwrap", lstatWrapper{mem}, CapLstat | CapAtomicRename | CapReadAt},
+		{"wrapper with Unwrap over IOFS", lstatWrapper{FromIOFS{}}, 0},
+		{"Capabler", cappedWrapper{lstatWrapper{mem}}, CapLstat},
+		{"wrapper over a Capabler", lstatWrapper{cappedWrapper{lstatWrapper{mem}}}, CapLstat},
+	}
+
+	for _, tt := range tests {
+		if got := Capabilities(tt.fs); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+// lstatWrapper is a wrapper from outside the package which implements
+// Lstater by delegating to the Fs it wraps.
+type lstatWrapper struct {
+	Fs
+}
+
+func (w lstatWrapper) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	if l, ok := w.Fs.(Lstater); ok {
+		return l.LstatIfPossible(name)
+	}
+	fi, err := w.Fs.Stat(name)
+	return fi, false, err
+}
+
+func (w lstatWrapper) Unwrap() Fs { return w.Fs }
+
+// cappedWrapper is a wrapper from outside the package whose Rename and
+// files do not keep the guarantees of the Fs it wraps.
+type cappedWrapper struct {
+	lstatWrapper
+}
+
+func (w cappedWrapper) Capabilities() Capability { return CapLstat }
+
+func TestCapabilityString(t *testing.T) {
+	if s := Capability(0).String(); s != "none" {
+		t.Errorf("got %q", s)
+	}
+	if s := (CapSymlink | CapAtomicRename).String(); s != "symlink|atomic-rename" {
+		t.Errorf("got %q", s)
+	}
+}
+
+func TestScope(t *testing.T) {
+	a := Afero{Fs: NewScannerFs(&MemMapFs{}, nil)}
+	if err := a.MkdirAll("/base/sub", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.WriteFile("/base/file", []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	scoped, err := a.Scope("/base", CapAtomicRename)
+	if err != nil {
+		t.Fatalf("Scope: %v", err)
+	}
+	if ok, _ := scoped.DirExists("/sub"); !ok {
+		t.Error("expected /sub to be visible in scoped fs")
+	}
+
+	if _, err := a.Scope("/base", CapSymlink); !errors.Is(err, ErrMissingCapability) {
+		t.Errorf("expected ErrMissingCapability, got %v", err)
+	}
+	if _, err := a.Scope("/base/file", 0); err == nil {
+		t.Error("expected error scoping to a file")
+	}
+	if _, err := a.Scope("/missing", 0); err == nil {
+		t.Error("expected error scoping to a missing dir")
+	}
+}
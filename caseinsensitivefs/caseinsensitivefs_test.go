@@ -0,0 +1,122 @@
+package caseinsensitivefs
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/spf13/afero/aferotest"
+)
+
+func readDirNames(t *testing.T, fs afero.Fs, dir string) []string {
+	t.Helper()
+	fis, err := afero.ReadDir(fs, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, fi := range fis {
+		names = append(names, fi.Name())
+	}
+	return names
+}
+
+func TestLookup(t *testing.T) {
+	base := afero.NewMemMapFs()
+	fs := New(base)
+	if err := fs.MkdirAll("/Docs/Notes", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := afero.WriteFile(fs, "/docs/notes/README.md", []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := afero.ReadFile(base, "/Docs/Notes/README.md"); err != nil || string(got) != "hello" {
+		t.Errorf("base content = %q, %v, want the case of the first creation kept", got, err)
+	}
+	if got, err := afero.ReadFile(fs, "/DOCS/notes/readme.MD"); err != nil || string(got) != "hello" {
+		t.Errorf("ReadFile = %q, %v", got, err)
+	}
+	if fi, err := fs.Stat("/docs/NOTES/readme.md"); err != nil || fi.Name() != "README.md" {
+		t.Errorf("Stat = %v, %v, want the stored name", fi, err)
+	}
+	if _, err := fs.Stat("/docs/missing"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Stat of a missing file = %v", err)
+	}
+
+	// creating another case of an existing name reuses the entry
+	if err := afero.WriteFile(fs, "/docs/notes/readme.md", []byte("changed"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.OpenFile("/DOCS/NOTES/Readme.md", os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644); !errors.Is(err, os.ErrExist) {
+		t.Errorf("O_EXCL on another case = %v, want ErrExist", err)
+	}
+	if err := fs.Mkdir("/docs", 0o755); !errors.Is(err, os.ErrExist) {
+		t.Errorf("Mkdir of another case = %v, want ErrExist", err)
+	}
+	if got := readDirNames(t, base, "/Docs/Notes"); !reflect.DeepEqual(got, []string{"README.md"}) {
+		t.Errorf("base entries = %v", got)
+	}
+
+	if err := fs.Remove("/docs/notes/readme.md"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readDirNames(t, base, "/Docs/Notes"); len(got) != 0 {
+		t.Errorf("base entries after Remove = %v", got)
+	}
+}
+
+func TestRename(t *testing.T) {
+	base := afero.NewMemMapFs()
+	fs := New(base)
+	afero.WriteFile(fs, "/dir/foo", []byte("foo"), 0o644)
+	afero.WriteFile(fs, "/dir/bar", []byte("bar"), 0o644)
+
+	// a case-only rename changes the stored name
+	if err := fs.Rename("/dir/foo", "/DIR/Foo"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readDirNames(t, base, "/dir"); !reflect.DeepEqual(got, []string{"Foo", "bar"}) {
+		t.Errorf("after case change: %v", got)
+	}
+
+	// renaming onto another case of an existing name replaces that entry
+	if err := fs.Rename("/dir/FOO", "/dir/BAR"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readDirNames(t, base, "/dir"); !reflect.DeepEqual(got, []string{"bar"}) {
+		t.Errorf("after replacing rename: %v", got)
+	}
+	if got, _ := afero.ReadFile(fs, "/dir/Bar"); string(got) != "foo" {
+		t.Errorf("content = %q", got)
+	}
+}
+
+func TestCollision(t *testing.T) {
+	base := afero.NewMemMapFs()
+	afero.WriteFile(base, "/a/File", nil, 0o644)
+	afero.WriteFile(base, "/a/file", nil, 0o644)
+	fs := New(base)
+
+	if _, err := fs.Stat("/a/file"); err != nil {
+		t.Errorf("Stat of an exact match = %v", err)
+	}
+	if _, err := fs.Stat("/a/FILE"); !errors.Is(err, ErrCaseCollision) {
+		t.Errorf("Stat = %v, want ErrCaseCollision", err)
+	}
+	if _, err := fs.Create("/A/FILE"); !errors.Is(err, ErrCaseCollision) {
+		t.Errorf("Create = %v, want ErrCaseCollision", err)
+	}
+	afero.WriteFile(fs, "/a/other", nil, 0o644)
+	if err := fs.Rename("/a/other", "/a/FiLe"); !errors.Is(err, ErrCaseCollision) {
+		t.Errorf("Rename = %v, want ErrCaseCollision", err)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	newFs := func(t *testing.T) afero.Fs {
+		return New(afero.NewMemMapFs())
+	}
+	aferotest.Conformance(t, newFs, afero.Capabilities(newFs(t)))
+}
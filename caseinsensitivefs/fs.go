@@ -0,0 +1,238 @@
+// Package caseinsensitivefs provides an afero.Fs which looks up names in a
+// base Fs ignoring case but keeps the case they were created with, like the
+// default file systems of macOS and Windows. Wrapping a MemMapFs makes it
+// possible to test path handling for those platforms on any OS.
+package caseinsensitivefs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// ErrCaseCollision is returned when a name matches several entries of the
+// base Fs which differ only in case, so that it cannot be resolved. The Fs
+// never creates such entries itself.
+var ErrCaseCollision = errors.New("several names differ only in case")
+
+// errNotFound is returned by lookup when no entry matches.
+var errNotFound = errors.New("no matching entry")
+
+// Fs resolves every path element to the entry of the base with the same
+// name up to case, using strings.EqualFold. An exact match is preferred,
+// otherwise the directory is listed. Elements which match no entry are
+// passed to the base as given, so that new files and directories keep
+// their case and Create or Mkdir of a name which exists with another case
+// opens or fails on the existing entry instead of adding a second one.
+//
+// Files and FileInfos carry the names stored in the base.
+type Fs struct {
+	base afero.Fs
+}
+
+func New(base afero.Fs) afero.Fs {
+	return &Fs{base: base}
+}
+
+// resolve returns the path of the base which name refers to.
+func (fs *Fs) resolve(op, name string) (string, error) {
+	name = afero.Clean(fs, name)
+	sep := afero.PathSeparatorOf(fs)
+	var cur string
+	if sep == afero.FilePathSeparator {
+		cur = filepath.VolumeName(name)
+	}
+	rest := name[len(cur):]
+	if strings.HasPrefix(rest, sep) {
+		cur += sep
+		rest = rest[len(sep):]
+	}
+	if rest == "" || rest == "." {
+		return name, nil
+	}
+	elems := strings.Split(rest, sep)
+	for i, elem := range elems {
+		if elem == ".." {
+			// only left by Clean at the start of relative paths
+			cur = afero.Join(fs, cur, elem)
+			continue
+		}
+		actual, err := fs.lookup(cur, elem)
+		if err == errNotFound {
+			return afero.Join(fs, append([]string{cur}, elems[i:]...)...), nil
+		}
+		if err != nil {
+			return "", &os.PathError{Op: op, Path: name, Err: err}
+		}
+		cur = afero.Join(fs, cur, actual)
+	}
+	return cur, nil
+}
+
+// lookup returns the name of the entry of dir matching elem.
+func (fs *Fs) lookup(dir, elem string) (string, error) {
+	if _, _, err := fs.lstat(afero.Join(fs, dir, elem)); err == nil {
+		return elem, nil
+	}
+	if dir == "" {
+		dir = "."
+	}
+	f, err := fs.base.Open(dir)
+	if err != nil {
+		return "", errNotFound
+	}
+	names, err := f.Readdirnames(-1)
+	f.Close()
+	if err != nil {
+		return "", errNotFound
+	}
+	match := ""
+	for _, n := range names {
+		if strings.EqualFold(n, elem) {
+			if match != "" {
+				return "", ErrCaseCollision
+			}
+			match = n
+		}
+	}
+	if match == "" {
+		return "", errNotFound
+	}
+	return match, nil
+}
+
+func (fs *Fs) lstat(name string) (os.FileInfo, bool, error) {
+	if lfs, ok := fs.base.(afero.Lstater); ok {
+		return lfs.LstatIfPossible(name)
+	}
+	fi, err := fs.base.Stat(name)
+	return fi, false, err
+}
+
+func (fs *Fs) Name() string { return "CaseInsensitiveFs" }
+
+// Unwrap returns the base Fs, whose lookups are case-sensitive.
+func (fs *Fs) Unwrap() afero.Fs {
+	return fs.base
+}
+
+func (fs *Fs) Create(name string) (afero.File, error) {
+	return fs.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o666)
+}
+
+func (fs *Fs) Mkdir(name string, perm os.FileMode) error {
+	p, err := fs.resolve("mkdir", name)
+	if err != nil {
+		return err
+	}
+	return fs.base.Mkdir(p, perm)
+}
+
+func (fs *Fs) MkdirAll(path string, perm os.FileMode) error {
+	p, err := fs.resolve("mkdir", path)
+	if err != nil {
+		return err
+	}
+	return fs.base.MkdirAll(p, perm)
+}
+
+func (fs *Fs) Open(name string) (afero.File, error) {
+	p, err := fs.resolve("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return fs.base.Open(p)
+}
+
+func (fs *Fs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	p, err := fs.resolve("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return fs.base.OpenFile(p, flag, perm)
+}
+
+func (fs *Fs) Remove(name string) error {
+	p, err := fs.resolve("remove", name)
+	if err != nil {
+		return err
+	}
+	return fs.base.Remove(p)
+}
+
+func (fs *Fs) RemoveAll(path string) error {
+	p, err := fs.resolve("removeall", path)
+	if err != nil {
+		return err
+	}
+	return fs.base.RemoveAll(p)
+}
+
+// Rename renames oldname to newname. When newname matches an existing entry
+// other than oldname, that entry is replaced and its case kept; renaming a
+// file to another case of its own name changes the case.
+func (fs *Fs) Rename(oldname, newname string) error {
+	from, err := fs.resolve("rename", oldname)
+	if err != nil {
+		return err
+	}
+	newname = afero.Clean(fs, newname)
+	dir, err := fs.resolve("rename", afero.Dir(fs, newname))
+	if err != nil {
+		return err
+	}
+	elem := afero.Base(fs, newname)
+	to := afero.Join(fs, dir, elem)
+	actual, err := fs.lookup(dir, elem)
+	switch {
+	case err == nil && afero.Join(fs, dir, actual) != from:
+		to = afero.Join(fs, dir, actual)
+	case err != nil && err != errNotFound:
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err}
+	}
+	return fs.base.Rename(from, to)
+}
+
+func (fs *Fs) Stat(name string) (os.FileInfo, error) {
+	p, err := fs.resolve("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return fs.base.Stat(p)
+}
+
+func (fs *Fs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	p, err := fs.resolve("lstat", name)
+	if err != nil {
+		return nil, false, err
+	}
+	return fs.lstat(p)
+}
+
+func (fs *Fs) Chmod(name string, mode os.FileMode) error {
+	p, err := fs.resolve("chmod", name)
+	if err != nil {
+		return err
+	}
+	return fs.base.Chmod(p, mode)
+}
+
+func (fs *Fs) Chown(name string, uid, gid int) error {
+	p, err := fs.resolve("chown", name)
+	if err != nil {
+		return err
+	}
+	return fs.base.Chown(p, uid, gid)
+}
+
+func (fs *Fs) Chtimes(name string, atime, mtime time.Time) error {
+	p, err := fs.resolve("chtimes", name)
+	if err != nil {
+		return err
+	}
+	return fs.base.Chtimes(p, atime, mtime)
+}
@@ -0,0 +1,391 @@
+package afero
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrChecksumMismatch is returned when the content of a file does not
+	// match its recorded checksum.
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	// ErrNoChecksum is returned by Verify for files without a checksum.
+	ErrNoChecksum = errors.New("no checksum recorded")
+)
+
+// The ChecksumFs records a digest of every file written through it and
+// verifies it when the file is read back sequentially: instead of io.EOF,
+// Read returns ErrChecksumMismatch if the content was changed behind its
+// back. The digest of a file is dropped when it is first changed through a
+// handle and recorded again when the handle is closed. Files only read after a Seek to another offset are not verified,
+// use Verify for them.
+//
+// The digests are kept in memory. WriteIndex and ReadIndex store them in a
+// sidecar file in the format of sha256sum and similar tools.
+type ChecksumFs struct {
+	source  Fs
+	newHash func() hash.Hash
+
+	mu   sync.RWMutex
+	sums map[string][]byte
+}
+
+// NewChecksumFs returns a ChecksumFs recording digests of newHash, or of
+// sha256.New if it is nil.
+func NewChecksumFs(source Fs, newHash func() hash.Hash) *ChecksumFs {
+	if newHash == nil {
+		newHash = sha256.New
+	}
+	return &ChecksumFs{source: source, newHash: newHash, sums: make(map[string][]byte)}
+}
+
+// Sum returns the recorded digest of name.
+func (c *ChecksumFs) Sum(name string) ([]byte, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	sum, ok := c.sums[Clean(c, name)]
+	return sum, ok
+}
+
+// Update records the current digest of name, e.g. for files which were
+// written to the source directly.
+func (c *ChecksumFs) Update(name string) error {
+	sum, err := c.hashFile(name)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.sums[Clean(c, name)] = sum
+	c.mu.Unlock()
+	return nil
+}
+
+// Verify hashes name and compares it to the recorded digest.
+func (c *ChecksumFs) Verify(name string) error {
+	want, ok := c.Sum(name)
+	if !ok {
+		return &os.PathError{Op: "verify", Path: name, Err: ErrNoChecksum}
+	}
+	got, err := c.hashFile(name)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(got, want) {
+		return &os.PathError{Op: "verify", Path: name, Err: ErrChecksumMismatch}
+	}
+	return nil
+}
+
+// VerifyAll verifies all files with a recorded digest and returns the
+// errors joined, in the order of the names.
+func (c *ChecksumFs) VerifyAll() error {
+	var errs []error
+	for _, name := range c.names() {
+		if err := c.Verify(name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// WriteIndex writes the recorded digests to w, one "<hex digest>  <name>"
+// line per file.
+func (c *ChecksumFs) WriteIndex(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, name := range c.names() {
+		sum, ok := c.Sum(name)
+		if !ok {
+			continue
+		}
+		if _, err := fmt.Fprintf(bw, "%x  %s\n", sum, name); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// ReadIndex adds the digests written by WriteIndex to the recorded ones.
+func (c *ChecksumFs) ReadIndex(r io.Reader) error {
+	sums := make(map[string][]byte)
+	s := bufio.NewScanner(r)
+	for line := 1; s.Scan(); line++ {
+		hexSum, name, ok := strings.Cut(s.Text(), "  ")
+		if !ok {
+			return fmt.Errorf("checksum index line %d: missing name", line)
+		}
+		sum, err := hex.DecodeString(hexSum)
+		if err != nil {
+			return fmt.Errorf("checksum index line %d: %w", line, err)
+		}
+		sums[Clean(c, name)] = sum
+	}
+	if err := s.Err(); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	for name, sum := range sums {
+		c.sums[name] = sum
+	}
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *ChecksumFs) names() []string {
+	c.mu.RLock()
+	names := make([]string, 0, len(c.sums))
+	for name := range c.sums {
+		names = append(names, name)
+	}
+	c.mu.RUnlock()
+	sort.Strings(names)
+	return names
+}
+
+func (c *ChecksumFs) hashFile(name string) ([]byte, error) {
+	f, err := c.source.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := c.newHash()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// forget drops the digests of name and everything below it.
+func (c *ChecksumFs) forget(name string) {
+	name = Clean(c, name)
+	prefix := name + PathSeparatorOf(c)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for n := range c.sums {
+		if n == name || strings.HasPrefix(n, prefix) {
+			delete(c.sums, n)
+		}
+	}
+}
+
+func (c *ChecksumFs) wrap(name string, f File, flag int) *ChecksumFile {
+	cf := &ChecksumFile{File: f, fs: c, name: name, dirty: flag&os.O_CREATE != 0}
+	if flag&os.O_TRUNC != 0 {
+		cf.change()
+	}
+	if sum, ok := c.Sum(name); ok {
+		cf.want, cf.h = sum, c.newHash()
+	}
+	return cf
+}
+
+func (c *ChecksumFs) Create(name string) (File, error) {
+	f, err := c.source.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return c.wrap(name, f, os.O_RDWR|os.O_CREATE|os.O_TRUNC), nil
+}
+
+func (c *ChecksumFs) Open(name string) (File, error) {
+	f, err := c.source.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return c.wrap(name, f, os.O_RDONLY), nil
+}
+
+func (c *ChecksumFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	f, err := c.source.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return c.wrap(name, f, flag), nil
+}
+
+func (c *ChecksumFs) Mkdir(name string, perm os.FileMode) error {
+	return c.source.Mkdir(name, perm)
+}
+
+func (c *ChecksumFs) MkdirAll(path string, perm os.FileMode) error {
+	return c.source.MkdirAll(path, perm)
+}
+
+func (c *ChecksumFs) Remove(name string) error {
+	if err := c.source.Remove(name); err != nil {
+		return err
+	}
+	c.forget(name)
+	return nil
+}
+
+func (c *ChecksumFs) RemoveAll(path string) error {
+	if err := c.source.RemoveAll(path); err != nil {
+		return err
+	}
+	c.forget(path)
+	return nil
+}
+
+func (c *ChecksumFs) Rename(oldname, newname string) error {
+	if err := c.source.Rename(oldname, newname); err != nil {
+		return err
+	}
+	oldname, newname = Clean(c, oldname), Clean(c, newname)
+	sep := PathSeparatorOf(c)
+	prefix := oldname + sep
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	moved := make(map[string][]byte)
+	for n, sum := range c.sums {
+		switch {
+		case n == oldname:
+			moved[newname] = sum
+		case strings.HasPrefix(n, prefix):
+			moved[Join(c, newname, n[len(prefix):])] = sum
+		case n == newname || strings.HasPrefix(n, newname+sep):
+			// replaced by the renamed file
+		default:
+			continue
+		}
+		delete(c.sums, n)
+	}
+	for n, sum := range moved {
+		c.sums[n] = sum
+	}
+	return nil
+}
+
+func (c *ChecksumFs) Stat(name string) (os.FileInfo, error) {
+	return c.source.Stat(name)
+}
+
+func (c *ChecksumFs) Name() string {
+	return "ChecksumFs"
+}
+
+// Unwrap returns the source Fs, whose reads are not verified.
+func (c *ChecksumFs) Unwrap() Fs {
+	return c.source
+}
+
+// Capabilities returns CapAtomicRename and CapReadAt of the source, the
+// optional interfaces are not implemented.
+func (c *ChecksumFs) Capabilities() Capability {
+	return Capabilities(c.source) & (CapAtomicRename | CapReadAt)
+}
+
+func (c *ChecksumFs) Chmod(name string, mode os.FileMode) error {
+	return c.source.Chmod(name, mode)
+}
+
+func (c *ChecksumFs) Chown(name string, uid, gid int) error {
+	return c.source.Chown(name, uid, gid)
+}
+
+func (c *ChecksumFs) Chtimes(name string, atime, mtime time.Time) error {
+	return c.source.Chtimes(name, atime, mtime)
+}
+
+// ChecksumFile is returned by ChecksumFs. It updates the digest of the file
+// on Close if it was written to, and verifies it on sequential reads.
+type ChecksumFile struct {
+	File
+	fs    *ChecksumFs
+	name  string
+	dirty bool
+	// changed is set once the digest was dropped for a change.
+	changed bool
+
+	// h hashes what was read so far while the reads are sequential from
+	// the start; it is nil if the file is not verified.
+	h    hash.Hash
+	want []byte
+}
+
+func (f *ChecksumFile) Read(p []byte) (int, error) {
+	n, err := f.File.Read(p)
+	if f.h == nil {
+		return n, err
+	}
+	f.h.Write(p[:n])
+	if err == io.EOF && !f.dirty && !bytes.Equal(f.h.Sum(nil), f.want) {
+		f.h = nil
+		return n, &os.PathError{Op: "read", Path: f.name, Err: ErrChecksumMismatch}
+	}
+	return n, err
+}
+
+func (f *ChecksumFile) Seek(offset int64, whence int) (int64, error) {
+	ret, err := f.File.Seek(offset, whence)
+	if err == nil && f.h != nil {
+		if ret == 0 {
+			f.h.Reset()
+		} else {
+			f.h = nil
+		}
+	}
+	return ret, err
+}
+
+// change marks the file as written and drops its digest, which does not
+// match other readers of the file until Close records the new one.
+func (f *ChecksumFile) change() {
+	f.dirty = true
+	if !f.changed {
+		f.changed = true
+		f.fs.forget(f.name)
+	}
+}
+
+func (f *ChecksumFile) Write(p []byte) (int, error) {
+	f.change()
+	return f.File.Write(p)
+}
+
+func (f *ChecksumFile) WriteAt(p []byte, off int64) (int, error) {
+	f.change()
+	return f.File.WriteAt(p, off)
+}
+
+func (f *ChecksumFile) WriteString(s string) (int, error) {
+	f.change()
+	return f.File.WriteString(s)
+}
+
+func (f *ChecksumFile) Truncate(size int64) error {
+	f.change()
+	return f.File.Truncate(size)
+}
+
+func (f *ChecksumFile) ReadFrom(r io.Reader) (int64, error) {
+	f.change()
+	return readFrom(f.File, r)
+}
+
+func (f *ChecksumFile) WriteTo(w io.Writer) (int64, error) {
+	if f.h != nil {
+		return io.Copy(w, readerOnly{f})
+	}
+	return writeTo(f.File, w)
+}
+
+func (f *ChecksumFile) Close() error {
+	if err := f.File.Close(); err != nil {
+		return err
+	}
+	if !f.dirty {
+		return nil
+	}
+	return f.fs.Update(f.name)
+}
@@ -0,0 +1,114 @@
+package afero
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestChecksumFs(t *testing.T) {
+	base := NewMemMapFs()
+	fs := NewChecksumFs(base, sha256.New)
+
+	if err := WriteFile(fs, "/a.txt", []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	want := sha256.Sum256([]byte("hello"))
+	if sum, ok := fs.Sum("/a.txt"); !ok || !bytes.Equal(sum, want[:]) {
+		t.Fatalf("Sum = %x, %v, want %x", sum, ok, want)
+	}
+	if data, err := ReadFile(fs, "/a.txt"); err != nil || string(data) != "hello" {
+		t.Errorf("ReadFile = %q, %v", data, err)
+	}
+	if err := fs.Verify("/a.txt"); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+
+	// Tamper with the file behind the back of fs.
+	if err := WriteFile(base, "/a.txt", []byte("HELLO"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadFile(fs, "/a.txt"); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("ReadFile tampered file: got %v, want ErrChecksumMismatch", err)
+	}
+	f, err := fs.Open("/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(io.Discard, f); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("io.Copy tampered file: got %v, want ErrChecksumMismatch", err)
+	}
+	f.Close()
+	if err := fs.Verify("/a.txt"); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Verify tampered file: got %v, want ErrChecksumMismatch", err)
+	}
+
+	if err := fs.Verify("/missing"); !errors.Is(err, ErrNoChecksum) {
+		t.Errorf("Verify without checksum: got %v, want ErrNoChecksum", err)
+	}
+
+	if err := WriteFile(fs, "/dir/b.txt", []byte("b"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Rename("/dir", "/moved"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fs.Sum("/moved/b.txt"); !ok {
+		t.Error("checksum was not moved along with the renamed directory")
+	}
+	err = fs.VerifyAll()
+	if !errors.Is(err, ErrChecksumMismatch) || strings.Contains(err.Error(), "b.txt") {
+		t.Errorf("VerifyAll = %v, want only the mismatch of /a.txt", err)
+	}
+
+	// The index round-trips.
+	var index bytes.Buffer
+	if err := fs.WriteIndex(&index); err != nil {
+		t.Fatal(err)
+	}
+	restored := NewChecksumFs(base, sha256.New)
+	if err := restored.ReadIndex(&index); err != nil {
+		t.Fatal(err)
+	}
+	if err := restored.Verify("/moved/b.txt"); err != nil {
+		t.Errorf("Verify with restored index: %v", err)
+	}
+
+	if err := fs.Remove("/moved/b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fs.Sum("/moved/b.txt"); ok {
+		t.Error("checksum of removed file is still recorded")
+	}
+}
+
+func TestChecksumFsTruncate(t *testing.T) {
+	fs := NewChecksumFs(NewMemMapFs(), nil)
+	if err := WriteFile(fs, "/a.txt", []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := fs.OpenFile("/a.txt", os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Truncate(2); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fs.Sum("/a.txt"); ok {
+		t.Error("checksum kept after Truncate")
+	}
+	if data, err := ReadFile(fs, "/a.txt"); err != nil || string(data) != "he" {
+		t.Errorf("ReadFile before Close = %q, %v", data, err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	want := sha256.Sum256([]byte("he"))
+	if sum, ok := fs.Sum("/a.txt"); !ok || !bytes.Equal(sum, want[:]) {
+		t.Errorf("Sum after Close = %x, %v, want %x of sha256", sum, ok, want)
+	}
+}
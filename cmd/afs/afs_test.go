@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// afs runs the command line and returns its output and status.
+func afs(t *testing.T, args ...string) (string, int) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), args, &stdout, &stderr)
+	return stdout.String() + stderr.String(), code
+}
+
+func TestCommands(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "src", "sub"), 0o755)
+	os.WriteFile(filepath.Join(dir, "src", "a.txt"), []byte("hello\n"), 0o644)
+	os.WriteFile(filepath.Join(dir, "src", "sub", "b.txt"), []byte("b"), 0o644)
+
+	for _, c := range []struct {
+		args []string
+		out  string
+		code int
+	}{
+		{[]string{"cp", "-r", "os://" + filepath.Join(dir, "src"), "mem://t/"}, "", 0},
+		{[]string{"ls", "mem://t/src"}, "a.txt\nsub/\n", 0},
+		{[]string{"cat", "mem://t/src/a.txt"}, "hello\n", 0},
+		{[]string{"tree", "mem://t/src"}, "mem://t/src\n├── a.txt\n└── sub\n    └── b.txt\n", 0},
+		{[]string{"cp", "mem://t/src/a.txt", "mem://t/src/sub"}, "", 0},
+		{[]string{"cat", "mem://t/src/sub/a.txt"}, "hello\n", 0},
+		{[]string{"rm", "mem://t/src/sub"}, "directory not empty", 1},
+		{[]string{"rm", "-r", "mem://t/src/sub"}, "", 0},
+		{[]string{"rm", "-f", "mem://t/src/missing"}, "", 0},
+		{[]string{"sync", "-n", "-delete", "mem://t/src", filepath.Join(dir, "src")}, "remove sub\n", 0},
+		{[]string{"sync", "-delete", filepath.Join(dir, "src"), "mem://t/copy"}, "mkdir .\ncopy a.txt\nmkdir sub\ncopy sub/b.txt\n", 0},
+		{[]string{"ls", "s3://bucket"}, "unknown URL scheme", 1},
+		{[]string{"cp", "only-one"}, "usage: afs cp", 2},
+		{[]string{"frobnicate"}, "usage:", 2},
+	} {
+		out, code := afs(t, c.args...)
+		if code != c.code || !strings.Contains(out, c.out) || c.code == 0 && out != c.out {
+			t.Errorf("afs %s = %q, %d, want %q, %d", strings.Join(c.args, " "), out, code, c.out, c.code)
+		}
+	}
+}
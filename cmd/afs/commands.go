@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/afero"
+)
+
+func runLs(e *env, args []string) error {
+	flags := e.flags()
+	long := flags.Bool("l", false, "print the mode, size and modification time")
+	args, err := parse(flags, args, 1, -1)
+	if err != nil {
+		return err
+	}
+	for i, arg := range args {
+		loc, err := e.open(arg)
+		if err != nil {
+			return err
+		}
+		fi, err := loc.fs.Stat(loc.path)
+		if err != nil {
+			return err
+		}
+		fis := []os.FileInfo{fi}
+		if fi.IsDir() {
+			if fis, err = afero.ReadDir(loc.fs, loc.path); err != nil {
+				return err
+			}
+			if len(args) > 1 {
+				if i > 0 {
+					fmt.Fprintln(e.stdout)
+				}
+				fmt.Fprintf(e.stdout, "%s:\n", arg)
+			}
+		}
+		for _, fi := range fis {
+			name := fi.Name()
+			if fi.IsDir() {
+				name += "/"
+			}
+			if *long {
+				fmt.Fprintf(e.stdout, "%s %10d %s %s\n", fi.Mode(), fi.Size(), fi.ModTime().Format("2006-01-02 15:04"), name)
+			} else {
+				fmt.Fprintln(e.stdout, name)
+			}
+		}
+	}
+	return nil
+}
+
+func runCat(e *env, args []string) error {
+	args, err := parse(e.flags(), args, 1, -1)
+	if err != nil {
+		return err
+	}
+	for _, arg := range args {
+		loc, err := e.open(arg)
+		if err != nil {
+			return err
+		}
+		f, err := loc.fs.Open(loc.path)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(e.stdout, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runCp copies a file, or a directory with -r. If dst is a directory, src
+// is copied into it.
+func runCp(e *env, args []string) error {
+	flags := e.flags()
+	recursive := flags.Bool("r", false, "copy directories recursively")
+	noOverwrite := flags.Bool("n", false, "do not overwrite existing files")
+	args, err := parse(flags, args, 2, 2)
+	if err != nil {
+		return err
+	}
+	src, err := e.open(args[0])
+	if err != nil {
+		return err
+	}
+	dst, err := e.open(args[1])
+	if err != nil {
+		return err
+	}
+	if ok, _ := afero.IsDir(dst.fs, dst.path); ok {
+		dst = dst.join(filepath.Base(src.path))
+	}
+	var opts []afero.CopyOption
+	if *noOverwrite {
+		opts = append(opts, afero.CopyNoOverwrite())
+	}
+	if *recursive {
+		if ok, _ := afero.IsDir(src.fs, src.path); ok {
+			return afero.CopyDir(dst.fs, dst.path, src.fs, src.path, opts...)
+		}
+	}
+	return afero.CopyFile(dst.fs, dst.path, src.fs, src.path, opts...)
+}
+
+func runRm(e *env, args []string) error {
+	flags := e.flags()
+	recursive := flags.Bool("r", false, "remove directories and their contents")
+	force := flags.Bool("f", false, "ignore missing files")
+	args, err := parse(flags, args, 1, -1)
+	if err != nil {
+		return err
+	}
+	for _, arg := range args {
+		loc, err := e.open(arg)
+		if err != nil {
+			return err
+		}
+		if *recursive {
+			if _, err := loc.fs.Stat(loc.path); err != nil && !(*force && os.IsNotExist(err)) {
+				return err
+			}
+			err = loc.fs.RemoveAll(loc.path)
+		} else {
+			err = loc.fs.Remove(loc.path)
+		}
+		if err != nil && !(*force && os.IsNotExist(err)) {
+			return err
+		}
+	}
+	return nil
+}
+
+var syncCompares = map[string]afero.SyncCompare{
+	"modtime": afero.SyncSizeModTime,
+	"size":    afero.SyncSize,
+	"hash":    afero.SyncHash,
+	"always":  afero.SyncAlways,
+}
+
+// runSync mirrors src into dst with afero.Sync and prints what it does.
+func runSync(e *env, args []string) error {
+	flags := e.flags()
+	var opts afero.SyncOptions
+	flags.BoolVar(&opts.Delete, "delete", false, "remove files of dst which are not in src")
+	flags.BoolVar(&opts.DryRun, "n", false, "only print what would be done")
+	compare := flags.String("compare", "modtime", "how unchanged files are detected: modtime, size, hash or always")
+	flags.Var((*patterns)(&opts.Exclude), "exclude", "skip base names matching the `pattern`; can be repeated")
+	args, err := parse(flags, args, 2, 2)
+	if err != nil {
+		return err
+	}
+	var ok bool
+	if opts.Compare, ok = syncCompares[*compare]; !ok {
+		return fmt.Errorf("unknown -compare %q", *compare)
+	}
+	src, err := e.open(args[0])
+	if err != nil {
+		return err
+	}
+	dst, err := e.open(args[1])
+	if err != nil {
+		return err
+	}
+	opts.SrcDir, opts.DstDir = src.path, dst.path
+	actions, err := afero.Sync(dst.fs, src.fs, opts)
+	for _, a := range actions {
+		fmt.Fprintf(e.stdout, "%s %s\n", a.Op, a.Path)
+	}
+	return err
+}
+
+func runTree(e *env, args []string) error {
+	args, err := parse(e.flags(), args, 1, 1)
+	if err != nil {
+		return err
+	}
+	loc, err := e.open(args[0])
+	if err != nil {
+		return err
+	}
+	if _, err := loc.fs.Stat(loc.path); err != nil {
+		return err
+	}
+	fmt.Fprintln(e.stdout, args[0])
+	return tree(e.stdout, loc.fs, loc.path, "")
+}
+
+func tree(w io.Writer, fs afero.Fs, dir, indent string) error {
+	fis, err := afero.ReadDir(fs, dir)
+	if err != nil {
+		return err
+	}
+	for i, fi := range fis {
+		branch, next := "├── ", "│   "
+		if i == len(fis)-1 {
+			branch, next = "└── ", "    "
+		}
+		fmt.Fprintln(w, indent+branch+fi.Name())
+		if fi.IsDir() {
+			if err := tree(w, fs, filepath.Join(dir, fi.Name()), indent+next); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/spf13/afero"
+
+	// the backends, registering their URL schemes
+	_ "github.com/spf13/afero/azurefs"
+	_ "github.com/spf13/afero/gcsfs"
+	_ "github.com/spf13/afero/httpclientfs"
+	_ "github.com/spf13/afero/sftpfs"
+	_ "github.com/spf13/afero/tarfs"
+	_ "github.com/spf13/afero/webdavfs"
+)
+
+// location is a path within a file system, parsed from a URL.
+type location struct {
+	fs   afero.Fs
+	path string
+	url  string
+}
+
+func (l location) String() string { return l.url }
+
+// join returns the location of name below l.
+func (l location) join(name string) location {
+	return location{fs: l.fs, path: filepath.Join(l.path, name), url: strings.TrimSuffix(l.url, "/") + "/" + name}
+}
+
+// opener opens the file systems of URLs, reusing them for the same host
+// and closing them on close.
+type opener struct {
+	ctx     context.Context
+	fss     map[string]afero.Fs
+	closers []io.Closer
+}
+
+// mems holds the mem:// file systems by name, so that they are shared by
+// the commands run in one process.
+var (
+	memsMu sync.Mutex
+	mems   = map[string]afero.Fs{}
+)
+
+func newOpener(ctx context.Context) *opener {
+	return &opener{ctx: ctx, fss: map[string]afero.Fs{}}
+}
+
+func (o *opener) close() {
+	for _, c := range o.closers {
+		c.Close()
+	}
+}
+
+// open parses raw, which is either a local path or a URL for
+// afero.OpenURL, like gs://bucket/path or sftp://user@host/path. The Fs is
+// opened for the URL without its path, which becomes the path of the
+// location. mem://name/path names a MemMapFs of the process.
+func (o *opener) open(raw string) (location, error) {
+	if !strings.Contains(raw, "://") {
+		return location{fs: afero.NewOsFs(), path: raw, url: raw}, nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return location{}, err
+	}
+	loc := location{path: u.Path, url: raw}
+	if loc.path == "" {
+		loc.path = "/"
+	}
+	if u.Scheme == "mem" {
+		memsMu.Lock()
+		defer memsMu.Unlock()
+		if mems[u.Host] == nil {
+			mems[u.Host] = afero.NewMemMapFs()
+		}
+		loc.fs = mems[u.Host]
+		return loc, nil
+	}
+
+	key := raw
+	if u.Scheme == "tar" {
+		// the path is the archive
+		loc.path = "/"
+	} else {
+		root := *u
+		root.Path, root.RawPath = "", ""
+		key = root.String()
+	}
+	if loc.fs = o.fss[key]; loc.fs == nil {
+		if loc.fs, err = afero.OpenURL(o.ctx, key); err != nil {
+			return location{}, err
+		}
+		o.fss[key] = loc.fs
+		if c, ok := loc.fs.(io.Closer); ok {
+			o.closers = append(o.closers, c)
+		}
+	}
+	return loc, nil
+}
@@ -0,0 +1,115 @@
+// Command afs lists, prints, copies, removes and mirrors files on any of the
+// file systems of afero, named by URLs like gs://bucket/dir or
+// sftp://user@host/dir. It is also handy to try out a backend.
+//
+// Usage:
+//
+//	afs ls [-l] url...
+//	afs cat url...
+//	afs cp [-r] [-n] src dst
+//	afs rm [-r] [-f] url...
+//	afs sync [-delete] [-n] [-compare modtime|size|hash|always] [-exclude pattern] src dst
+//	afs tree url
+//
+// Files are named by local paths or by the URLs of afero.OpenURL, for the
+// backends which register a scheme.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+type command struct {
+	usage string
+	run   func(e *env, args []string) error
+}
+
+var commands = map[string]command{
+	"ls":   {"ls [-l] url...", runLs},
+	"cat":  {"cat url...", runCat},
+	"cp":   {"cp [-r] [-n] src dst", runCp},
+	"rm":   {"rm [-r] [-f] url...", runRm},
+	"sync": {"sync [-delete] [-n] [-compare modtime|size|hash|always] [-exclude pattern] src dst", runSync},
+	"tree": {"tree url", runTree},
+}
+
+// env is what commands run with.
+type env struct {
+	*opener
+	name, usage    string
+	stdout, stderr io.Writer
+}
+
+// errUsage makes run exit with status 2, after the usage was printed.
+var errUsage = errors.New("usage")
+
+// flags returns the flag set of the command, which prints its usage.
+func (e *env) flags() *flag.FlagSet {
+	flags := flag.NewFlagSet(e.name, flag.ContinueOnError)
+	flags.SetOutput(e.stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(e.stderr, "usage: afs", e.usage)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// parse parses args with flags, expecting at least min arguments and at
+// most max, or any number if max is negative.
+func parse(flags *flag.FlagSet, args []string, min, max int) ([]string, error) {
+	if err := flags.Parse(args); err != nil {
+		return nil, errUsage
+	}
+	if n := flags.NArg(); n < min || max >= 0 && n > max {
+		flags.Usage()
+		return nil, errUsage
+	}
+	return flags.Args(), nil
+}
+
+func main() {
+	os.Exit(run(context.Background(), os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || commands[args[0]].run == nil {
+		fmt.Fprintln(stderr, "usage:")
+		names := make([]string, 0, len(commands))
+		for name := range commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintln(stderr, "\tafs", commands[name].usage)
+		}
+		return 2
+	}
+	cmd := commands[args[0]]
+	e := &env{opener: newOpener(ctx), name: args[0], usage: cmd.usage, stdout: stdout, stderr: stderr}
+	defer e.close()
+	if err := cmd.run(e, args[1:]); err != nil {
+		if errors.Is(err, errUsage) {
+			return 2
+		}
+		fmt.Fprintln(stderr, "afs:", err)
+		return 1
+	}
+	return 0
+}
+
+// patterns is a flag which can be repeated.
+type patterns []string
+
+func (p *patterns) String() string { return strings.Join(*p, ",") }
+
+func (p *patterns) Set(v string) error {
+	*p = append(*p, v)
+	return nil
+}
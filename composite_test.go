@@ -5,8 +5,12 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/spf13/afero/mem"
 )
 
 var tempDirs []string
@@ -337,10 +341,35 @@ func TestUnionCacheWrite(t *testing.T) {
 	}
 }
 
+func TestCacheOnReadFsWriteFile(t *testing.T) {
+	base := &MemMapFs{}
+	WriteFile(base, "/data/old.txt", []byte("old content"), 0o644)
+	shared := &MemMapFs{}
+	WriteFile(shared, "/data/old.txt", []byte("old content"), 0o644)
+
+	for _, fs := range []Fs{NewCacheOnReadFs(base, &MemMapFs{}, 0), NewCacheOnReadFs(shared, shared, 0)} {
+		for _, name := range []string{"/data/old.txt", "/data/new.txt"} {
+			if err := WriteFile(fs, name, []byte("new"), 0o644); err != nil {
+				t.Fatalf("WriteFile(%s) = %v", name, err)
+			}
+			if data, err := ReadFile(fs, name); err != nil || string(data) != "new" {
+				t.Errorf("%s = %q, %v, want %q", name, data, err, "new")
+			}
+		}
+	}
+	if data, _ := ReadFile(base, "/data/old.txt"); string(data) != "new" {
+		t.Errorf("base file = %q, want %q", data, "new")
+	}
+}
+
 func TestUnionCacheExpire(t *testing.T) {
+	clock := mem.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
 	base := &MemMapFs{}
+	base.SetClock(clock)
 	layer := &MemMapFs{}
+	layer.SetClock(clock)
 	ufs := &CacheOnReadFs{base: base, layer: layer, cacheTime: 1 * time.Second}
+	ufs.SetClock(clock)
 
 	base.Mkdir("/data", 0o777)
 
@@ -355,8 +384,7 @@ func TestUnionCacheExpire(t *testing.T) {
 	fh.Close()
 
 	fh, _ = base.Create("/data/file.txt")
-	// sleep some time, so we really get a different time.Now() on write...
-	time.Sleep(2 * time.Second)
+	clock.Advance(2 * time.Second)
 	fh.WriteString("Another test")
 	fh.Close()
 
@@ -401,6 +429,46 @@ func TestCacheOnReadFsNotInLayer(t *testing.T) {
 	fh.Close()
 }
 
+func TestCacheOnReadFsMaxSize(t *testing.T) {
+	base := NewMemMapFs()
+	layer := NewMemMapFs()
+	fs := NewCacheOnReadFsWithMaxSize(base, layer, 0, 10).(*CacheOnReadFs)
+
+	for _, name := range []string{"/a", "/b", "/c"} {
+		WriteFile(base, name, []byte("12345"), 0o644)
+	}
+	read := func(name string) {
+		t.Helper()
+		if _, err := ReadFile(fs, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	read("/a")
+	read("/b")
+	read("/a") // b is now the least recently used file
+	read("/c")
+
+	if _, err := layer.Stat("/b"); !os.IsNotExist(err) {
+		t.Errorf("/b should have been evicted: %v", err)
+	}
+	for _, name := range []string{"/a", "/c"} {
+		if _, err := layer.Stat(name); err != nil {
+			t.Errorf("%s should be cached: %v", name, err)
+		}
+	}
+	want := CacheStats{Hits: 1, Misses: 3, Evictions: 1, Bytes: 10}
+	if got := fs.Stats(); got != want {
+		t.Errorf("Stats = %+v, want %+v", got, want)
+	}
+
+	if err := fs.Remove("/a"); err != nil {
+		t.Fatal(err)
+	}
+	if got := fs.Stats().Bytes; got != 5 {
+		t.Errorf("Bytes after Remove = %d, want 5", got)
+	}
+}
+
 // #194
 func TestUnionFileReaddirEmpty(t *testing.T) {
 	osFs := NewOsFs()
@@ -515,3 +583,157 @@ func TestUnionFileReaddirAskForTooMany(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestUnionFileReaddirMerge(t *testing.T) {
+	base := NewMemMapFs()
+	overlay := NewMemMapFs()
+	for _, name := range []string{"/d/c", "/d/a", "/d/shared"} {
+		WriteFile(base, name, []byte("base"), 0o644)
+	}
+	for _, name := range []string{"/d/b", "/d/shared"} {
+		WriteFile(overlay, name, []byte("overlay!"), 0o644)
+	}
+
+	readdir := func(m DirsMerger, c int) ([]string, []int64, error) {
+		t.Helper()
+		bf, _ := base.Open("/d")
+		lf, _ := overlay.Open("/d")
+		f := &UnionFile{Base: bf, Layer: lf, Merger: m}
+		defer f.Close()
+		fis, err := f.Readdir(c)
+		var names []string
+		var sizes []int64
+		for _, fi := range fis {
+			names = append(names, fi.Name())
+			sizes = append(sizes, fi.Size())
+		}
+		return names, sizes, err
+	}
+
+	tests := []struct {
+		opts  MergeOptions
+		names string
+		sizes []int64
+	}{
+		{MergeOptions{}, "a,b,c,shared", []int64{4, 8, 4, 8}},
+		{MergeOptions{BaseFirst: true}, "a,b,c,shared", []int64{4, 8, 4, 4}},
+		{MergeOptions{KeepDuplicates: true}, "a,b,c,shared,shared", []int64{4, 8, 4, 8, 4}},
+		{MergeOptions{Unsorted: true}, "b,shared,a,c", []int64{8, 8, 4, 4}},
+	}
+	for _, tt := range tests {
+		names, sizes, err := readdir(NewDirsMerger(tt.opts), -1)
+		if err != nil || strings.Join(names, ",") != tt.names || !reflect.DeepEqual(sizes, tt.sizes) {
+			t.Errorf("%+v: got %v %v, %v, want %s %v", tt.opts, names, sizes, err, tt.names, tt.sizes)
+		}
+	}
+
+	// paging like os.File
+	f, _ := NewCopyOnWriteFs(base, overlay).Open("/d")
+	defer f.Close()
+	var pages []string
+	for {
+		names, err := f.Readdirnames(3)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages = append(pages, strings.Join(names, ","))
+	}
+	if got := strings.Join(pages, "|"); got != "a,b,c|shared" {
+		t.Errorf("pages = %s", got)
+	}
+	if names, err := f.Readdirnames(-1); len(names) != 0 || err != nil {
+		t.Errorf("Readdirnames(-1) at the end = %v, %v", names, err)
+	}
+}
+
+func TestCopyOnWriteDirsMerger(t *testing.T) {
+	base := NewMemMapFs()
+	WriteFile(base, "/d/gone", nil, 0o644)
+	WriteFile(base, "/d/kept", nil, 0o644)
+
+	for _, tt := range []struct {
+		opts MergeOptions
+		want string
+	}{
+		{MergeOptions{Whiteouts: true}, "kept"},
+		{MergeOptions{}, ".wh.gone,gone,kept"},
+	} {
+		ufs := NewCopyOnWriteFs(base, NewMemMapFs(), CopyOnWriteDirsMerger(NewDirsMerger(tt.opts)))
+		ufs.Remove("/d/gone")
+		names, err := readDirNames(ufs, "/d")
+		if err != nil || strings.Join(names, ",") != tt.want {
+			t.Errorf("%+v: got %v, %v, want %s", tt.opts, names, err, tt.want)
+		}
+	}
+}
+
+// statCountingFs counts the calls to Stat of the Fs it wraps.
+type statCountingFs struct {
+	Fs
+	stats int
+}
+
+func (s *statCountingFs) Stat(name string) (os.FileInfo, error) {
+	s.stats++
+	return s.Fs.Stat(name)
+}
+
+func TestCacheOnReadFsStatCache(t *testing.T) {
+	clock := mem.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	base := &statCountingFs{Fs: NewMemMapFs()}
+	WriteFile(base, "/dir/file", []byte("data"), 0o644)
+	ufs := NewCacheOnReadFs(base, NewMemMapFs(), time.Minute,
+		CacheOnReadStatTTL(time.Minute), CacheOnReadNegativeTTL(time.Minute)).(*CacheOnReadFs)
+	ufs.SetClock(clock)
+
+	stat := func(name string) error {
+		t.Helper()
+		_, err := ufs.Stat(name)
+		return err
+	}
+	for i := 0; i < 3; i++ {
+		if err := stat("/dir"); err != nil {
+			t.Fatal(err)
+		}
+		if err := stat("/missing"); !os.IsNotExist(err) {
+			t.Fatalf("Stat of a missing file = %v", err)
+		}
+	}
+	if base.stats != 2 {
+		t.Errorf("%d Stat calls on the base, want 2", base.stats)
+	}
+
+	// Changes through the CacheOnReadFs are seen at once.
+	if err := ufs.MkdirAll("/missing/sub", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := stat("/missing"); err != nil {
+		t.Errorf("Stat after MkdirAll = %v", err)
+	}
+
+	// Others once invalidated or expired.
+	if err := stat("/other"); !os.IsNotExist(err) {
+		t.Fatalf("Stat of a missing file = %v", err)
+	}
+	base.Fs.Mkdir("/other", 0o755)
+	if err := stat("/other"); !os.IsNotExist(err) {
+		t.Errorf("Stat within the negative TTL = %v, want the remembered error", err)
+	}
+	ufs.InvalidatePath("/other")
+	if err := stat("/other"); err != nil {
+		t.Errorf("Stat after InvalidatePath = %v", err)
+	}
+	base.Fs.Remove("/other")
+	ufs.InvalidateAll()
+	if err := stat("/other"); !os.IsNotExist(err) {
+		t.Errorf("Stat after InvalidateAll = %v", err)
+	}
+	base.Fs.Mkdir("/other", 0o755)
+	clock.Advance(2 * time.Minute)
+	if err := stat("/other"); err != nil {
+		t.Errorf("Stat after the TTL = %v", err)
+	}
+}
@@ -21,3 +21,16 @@ import (
 )
 
 const BADFD = syscall.EBADF
+
+const errCrossDevice = syscall.EXDEV
+
+// errLoop is returned when resolving a name follows too many symlinks.
+const errLoop = syscall.ELOOP
+
+// errNoSpace is returned when the quota of a MemMapFs is exceeded, as by
+// mem.Quota.
+const errNoSpace = syscall.ENOSPC
+
+// errNotEmpty is returned when removing or replacing a directory which
+// still holds files.
+const errNotEmpty = syscall.ENOTEMPTY
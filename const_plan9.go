@@ -0,0 +1,37 @@
+// Copyright © 2016 Steve Francia <spf@spf13.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build plan9
+// +build plan9
+
+package afero
+
+import (
+	"syscall"
+)
+
+// Plan 9 has no errno values; this is the message its kernel uses for a bad fd.
+const BADFD = syscall.ErrorString("fd out of range or not open")
+
+const errCrossDevice = syscall.ErrorString("cross-device rename")
+
+// errLoop is returned when resolving a name follows too many symlinks.
+const errLoop = syscall.ErrorString("too many levels of symbolic links")
+
+// errNoSpace is returned when the quota of a MemMapFs is exceeded, as by
+// mem.Quota.
+const errNoSpace = syscall.ErrorString("file system full")
+
+// errNotEmpty is returned when removing or replacing a directory which
+// still holds files.
+const errNotEmpty = syscall.ErrorString("directory not empty")
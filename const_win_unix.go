@@ -10,8 +10,8 @@
 // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
 // See the License for the specific language governing permissions and
 // limitations under the License.
-//go:build !darwin && !openbsd && !freebsd && !dragonfly && !netbsd && !aix && !zos
-// +build !darwin,!openbsd,!freebsd,!dragonfly,!netbsd,!aix,!zos
+//go:build !darwin && !openbsd && !freebsd && !dragonfly && !netbsd && !aix && !zos && !plan9
+// +build !darwin,!openbsd,!freebsd,!dragonfly,!netbsd,!aix,!zos,!plan9
 
 package afero
 
@@ -20,3 +20,16 @@ import (
 )
 
 const BADFD = syscall.EBADFD
+
+const errCrossDevice = syscall.EXDEV
+
+// errLoop is returned when resolving a name follows too many symlinks.
+const errLoop = syscall.ELOOP
+
+// errNoSpace is returned when the quota of a MemMapFs is exceeded, as by
+// mem.Quota.
+const errNoSpace = syscall.ENOSPC
+
+// errNotEmpty is returned when removing or replacing a directory which
+// still holds files.
+const errNotEmpty = syscall.ENOTEMPTY
@@ -0,0 +1,78 @@
+package afero
+
+import (
+	"context"
+	"io"
+	"os"
+)
+
+// ContextFs is an optional interface in Afero, implemented by filesystems
+// whose requests can be cancelled, typically remote ones. ReadFileContext,
+// WriteFileContext and WalkContext open files through it.
+type ContextFs interface {
+	// OpenFileContext opens name like OpenFile. ctx applies to opening the
+	// file and to the requests made for it until it is closed.
+	OpenFileContext(ctx context.Context, name string, flag int, perm os.FileMode) (File, error)
+}
+
+// contextChunkSize is the most the context helpers read or write between
+// two checks of their context.
+const contextChunkSize = 32 * 1024
+
+// openFileContext opens name through OpenFileContext if fs implements
+// ContextFs, else through OpenFile once ctx is checked.
+func openFileContext(ctx context.Context, fs Fs, name string, flag int, perm os.FileMode) (File, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if c, ok := fs.(ContextFs); ok {
+		return c.OpenFileContext(ctx, name, flag, perm)
+	}
+	return fs.OpenFile(name, flag, perm)
+}
+
+// contextReader reads at most contextChunkSize bytes at a time from r, and
+// fails with the error of ctx once it is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	if len(p) > contextChunkSize {
+		p = p[:contextChunkSize]
+	}
+	return r.r.Read(p)
+}
+
+// contextFs opens the files of a walk through OpenFileContext, and fails
+// with the error of ctx once it is done.
+type contextFs struct {
+	Fs
+	ctx context.Context
+}
+
+func (c contextFs) Open(name string) (File, error) {
+	return openFileContext(c.ctx, c.Fs, name, os.O_RDONLY, 0)
+}
+
+func (c contextFs) Stat(name string) (os.FileInfo, error) {
+	if err := c.ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.Fs.Stat(name)
+}
+
+func (c contextFs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	if err := c.ctx.Err(); err != nil {
+		return nil, false, err
+	}
+	if l, ok := c.Fs.(Lstater); ok {
+		return l.LstatIfPossible(name)
+	}
+	fi, err := c.Fs.Stat(name)
+	return fi, false, err
+}
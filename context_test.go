@@ -0,0 +1,117 @@
+package afero
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type ctxKey struct{}
+
+// contextRecordingFs implements ContextFs, recording the files it opens
+// with the value of ctxKey.
+type contextRecordingFs struct {
+	Fs
+	opened []string
+	// onRead, if set, is called before every Read of the files.
+	onRead func()
+}
+
+func (c *contextRecordingFs) OpenFileContext(ctx context.Context, name string, flag int, perm os.FileMode) (File, error) {
+	if ctx.Value(ctxKey{}) == nil {
+		return nil, errors.New("the context was not passed on")
+	}
+	c.opened = append(c.opened, filepath.ToSlash(name))
+	f, err := c.Fs.OpenFile(name, flag, perm)
+	if err != nil || c.onRead == nil {
+		return f, err
+	}
+	return &hookedReadFile{File: f, onRead: c.onRead}, nil
+}
+
+type hookedReadFile struct {
+	File
+	onRead func()
+}
+
+func (f *hookedReadFile) Read(p []byte) (int, error) {
+	f.onRead()
+	return f.File.Read(p)
+}
+
+func TestReadWriteFileContext(t *testing.T) {
+	fs := &contextRecordingFs{Fs: NewMemMapFs()}
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), ctxKey{}, true))
+	defer cancel()
+
+	data := bytes.Repeat([]byte("0123456789"), 10000)
+	if err := WriteFileContext(ctx, fs, "/file", data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadFileContext(ctx, fs, "/file")
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("ReadFileContext = %d bytes, %v, want %d bytes", len(got), err, len(data))
+	}
+	if len(fs.opened) != 2 {
+		t.Errorf("opened through OpenFileContext: %v", fs.opened)
+	}
+
+	// reading stops after the chunk during which ctx was cancelled
+	reads := 0
+	fs.onRead = func() {
+		reads++
+		cancel()
+	}
+	if _, err := ReadFileContext(ctx, fs, "/file"); !errors.Is(err, context.Canceled) {
+		t.Errorf("ReadFileContext cancelled while reading = %v", err)
+	}
+	if reads != 1 {
+		t.Errorf("%d reads after cancelling, want 1", reads)
+	}
+
+	// Fs without ContextFs check ctx themselves
+	if err := WriteFileContext(ctx, fs.Fs, "/other", data, 0o644); !errors.Is(err, context.Canceled) {
+		t.Errorf("WriteFileContext with a cancelled context = %v", err)
+	}
+	if _, err := fs.Fs.Stat("/other"); err == nil {
+		t.Error("WriteFileContext with a cancelled context created the file")
+	}
+}
+
+func TestWalkContext(t *testing.T) {
+	fs := &contextRecordingFs{Fs: NewMemMapFs()}
+	for _, name := range []string{"/root/a/1", "/root/a/2", "/root/b/1"} {
+		if err := WriteFile(fs.Fs, name, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), ctxKey{}, true))
+	defer cancel()
+
+	var visited []string
+	err := WalkContext(ctx, fs, "/root", func(path string, info os.FileInfo, err error) error {
+		visited = append(visited, filepath.ToSlash(path))
+		return err
+	})
+	if err != nil || len(visited) != 6 {
+		t.Fatalf("WalkContext = %v, visited %v", err, visited)
+	}
+	if want := []string{"/root", "/root/a", "/root/b"}; len(fs.opened) != len(want) {
+		t.Errorf("opened through OpenFileContext: %v, want %v", fs.opened, want)
+	}
+
+	visited = nil
+	err = WalkContext(ctx, fs, "/root", func(path string, info os.FileInfo, err error) error {
+		visited = append(visited, filepath.ToSlash(path))
+		if path == filepath.FromSlash("/root/a") {
+			cancel()
+		}
+		return err
+	})
+	if !errors.Is(err, context.Canceled) || len(visited) != 2 {
+		t.Errorf("WalkContext cancelled = %v, visited %v", err, visited)
+	}
+}
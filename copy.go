@@ -0,0 +1,260 @@
+package afero
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// CopyOption configures CopyFile and CopyDir.
+type CopyOption func(*copyOptions)
+
+type copyOptions struct {
+	progress    func(name string, written, size int64)
+	noOverwrite bool
+	delta       int
+	workers     int
+
+	// strictMetadata fails the copy if the mode or modification time
+	// cannot be applied, as Sync does.
+	strictMetadata bool
+}
+
+// CopyWithProgress calls progress while a file is copied, with the name of
+// the source file, the bytes written so far and its size. It is called at
+// least once per file, when it is complete. Since the bytes have to be
+// counted, the copy is streamed even where the file systems could copy
+// server-side.
+func CopyWithProgress(progress func(name string, written, size int64)) CopyOption {
+	return func(o *copyOptions) {
+		o.progress = progress
+	}
+}
+
+// CopyNoOverwrite fails with an error matching os.ErrExist instead of
+// replacing existing destination files.
+func CopyNoOverwrite() CopyOption {
+	return func(o *copyOptions) {
+		o.noOverwrite = true
+	}
+}
+
+// CopyDelta updates existing destination files in place, writing only the
+// blocks of blockSize bytes which differ, like the Delta option of Sync.
+// blockSize 0 selects 64 KiB. Progress is only reported once such a file is
+// complete.
+func CopyDelta(blockSize int) CopyOption {
+	return func(o *copyOptions) {
+		o.delta = blockSize
+		if o.delta <= 0 {
+			o.delta = defaultDeltaBlockSize
+		}
+	}
+}
+
+// CopyWorkers lets CopyDir copy up to n files at once. How many it copies
+// at once is tuned to the latency of the file systems, which is probed with
+// a Stat of src and dst now and then: files on a local disk are copied one
+// by one, those on object stores with round trips of several milliseconds
+// by more goroutines, up to n. The progress callback may then be called
+// concurrently for different files.
+func CopyWorkers(n int) CopyOption {
+	return func(o *copyOptions) {
+		o.workers = n
+	}
+}
+
+// CopyFile copies the file src of srcFs to dst in dstFs, which may be
+// another kind of Fs. The contents are copied with io.Copy, so the
+// WriteTo and ReadFrom methods of the files are used, e.g. for server-side
+// copies in gcsfs. The mode and modification time of src are applied to
+// dst where dstFs supports it; errors doing so are ignored.
+func CopyFile(dstFs Fs, dst string, srcFs Fs, src string, opts ...CopyOption) error {
+	var o copyOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return copyFileTo(dstFs, dst, srcFs, src, &o)
+}
+
+func (a Afero) CopyFile(dst, src string, opts ...CopyOption) error {
+	return CopyFile(a.Fs, dst, a.Fs, src, opts...)
+}
+
+func copyFileTo(dstFs Fs, dst string, srcFs Fs, src string, o *copyOptions) error {
+	in, err := srcFs.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		return &os.PathError{Op: "copy", Path: src, Err: syscall.EISDIR}
+	}
+
+	if o.delta != 0 && !o.noOverwrite {
+		copied, err := deltaCopy(dstFs, dst, in, o.delta)
+		if err != nil {
+			return err
+		}
+		if copied {
+			if o.progress != nil {
+				o.progress(src, fi.Size(), fi.Size())
+			}
+			return copyMetadata(dstFs, dst, fi, o.strictMetadata)
+		}
+		if _, err := in.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	}
+
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if o.noOverwrite {
+		flag |= os.O_EXCL
+	}
+	out, err := dstFs.OpenFile(dst, flag, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	var r io.Reader = in
+	if o.progress != nil {
+		r = &progressReader{r: in, name: src, size: fi.Size(), progress: o.progress}
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	if o.progress != nil && fi.Size() == 0 {
+		o.progress(src, 0, 0)
+	}
+	return copyMetadata(dstFs, dst, fi, o.strictMetadata)
+}
+
+// copyMetadata applies the mode and modification time of fi to name, as
+// far as fs supports them. Errors are only returned if strict is set.
+func copyMetadata(fs Fs, name string, fi os.FileInfo, strict bool) error {
+	if err := fs.Chmod(name, fi.Mode().Perm()); err != nil && strict {
+		return err
+	}
+	if err := fs.Chtimes(name, fi.ModTime(), fi.ModTime()); err != nil && strict {
+		return err
+	}
+	return nil
+}
+
+// progressReader reports the bytes read from r.
+type progressReader struct {
+	r        io.Reader
+	name     string
+	written  int64
+	size     int64
+	progress func(name string, written, size int64)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.written += int64(n)
+		p.progress(p.name, p.written, p.size)
+	}
+	return n, err
+}
+
+// CopyDir copies the tree below the directory src of srcFs to dst in
+// dstFs, creating dst if needed. Files are copied as by CopyFile, and
+// directories get the mode and modification time of their source once
+// their contents are copied. Symlinks are recreated if both file systems
+// support them, otherwise symlinks to files are copied as regular files
+// and others skipped, as are special files. CopyDir stops at the first
+// error.
+func CopyDir(dstFs Fs, dst string, srcFs Fs, src string, opts ...CopyOption) error {
+	var o copyOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if fi, err := srcFs.Stat(src); err != nil {
+		return err
+	} else if !fi.IsDir() {
+		return &os.PathError{Op: "copy", Path: src, Err: syscall.ENOTDIR}
+	}
+
+	type dir struct {
+		name string
+		info os.FileInfo
+	}
+	var dirs []dir
+	pool := newWorkerPool(o.workers,
+		func() { srcFs.Stat(src) },
+		func() { dstFs.Stat(dst) })
+	err := Walk(srcFs, src, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, name)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		switch {
+		case info.IsDir():
+			// writable until it is filled
+			if err := dstFs.MkdirAll(target, 0o700); err != nil {
+				return err
+			}
+			dirs = append(dirs, dir{target, info})
+			return nil
+		case info.Mode()&os.ModeSymlink != 0:
+			return pool.run(func() error {
+				return copySymlink(dstFs, target, srcFs, name, &o)
+			})
+		case info.Mode().IsRegular():
+			return pool.run(func() error {
+				return copyFileTo(dstFs, target, srcFs, name, &o)
+			})
+		}
+		return nil
+	})
+	if werr := pool.wait(); err == nil {
+		err = werr
+	}
+	if err != nil {
+		return err
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		copyMetadata(dstFs, dirs[i].name, dirs[i].info, false)
+	}
+	return nil
+}
+
+func (a Afero) CopyDir(dst, src string, opts ...CopyOption) error {
+	return CopyDir(a.Fs, dst, a.Fs, src, opts...)
+}
+
+// copySymlink recreates the symlink src as dst, or copies the file it
+// points to if the file systems cannot.
+func copySymlink(dstFs Fs, dst string, srcFs Fs, src string, o *copyOptions) error {
+	r, rok := srcFs.(LinkReader)
+	l, lok := dstFs.(Linker)
+	if rok && lok {
+		target, err := r.ReadlinkIfPossible(src)
+		if err == nil {
+			if !o.noOverwrite {
+				dstFs.Remove(dst)
+			}
+			return l.SymlinkIfPossible(target, dst)
+		}
+	}
+	fi, err := srcFs.Stat(src)
+	if err != nil || !fi.Mode().IsRegular() {
+		return nil
+	}
+	return copyFileTo(dstFs, dst, srcFs, src, o)
+}
@@ -1,9 +1,13 @@
 package afero
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"os"
-	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 )
@@ -16,19 +20,146 @@ var _ Lstater = (*CopyOnWriteFs)(nil)
 // is not present in the overlay will copy the file to the overlay ("changing"
 // includes also calls to e.g. Chtimes(), Chmod() and Chown()).
 //
+// Removing a file of the base layer records a whiteout in the overlay: an
+// empty file named ".wh." followed by the name of the removed file, placed in
+// the same directory. Whiteouts hide the file and everything below it in the
+// base layer, as in overlay filesystems; they are not listed by Readdir.
+// Names starting with ".wh." are reserved for them: creating, writing or
+// renaming to such a name fails with EINVAL, and those of the base layer can
+// only be read.
+//
+// Opening a file of the base layer for writing copies it to the overlay as
+// set by its CopyUpPolicy.
+//
 // Reading directories is currently only supported via Open(), not OpenFile().
 type CopyOnWriteFs struct {
 	base  Fs
 	layer Fs
+
+	merger DirsMerger
+	policy CopyUpPolicy
+
+	mu         sync.Mutex
+	promotions map[string]*promotion
+}
+
+// CopyOnWriteOption configures a CopyOnWriteFs.
+type CopyOnWriteOption func(*CopyOnWriteFs)
+
+// CopyOnWriteDirsMerger sets how directories present in both layers are
+// listed. The default is NewDirsMerger(MergeOptions{Whiteouts: true}).
+func CopyOnWriteDirsMerger(m DirsMerger) CopyOnWriteOption {
+	return func(u *CopyOnWriteFs) { u.merger = m }
+}
+
+func NewCopyOnWriteFs(base Fs, layer Fs, opts ...CopyOnWriteOption) Fs {
+	u := &CopyOnWriteFs{base: base, layer: layer}
+	for _, opt := range opts {
+		opt(u)
+	}
+	return u
+}
+
+// mergeWhiteouts is the default DirsMerger of the UnionFiles of a
+// CopyOnWriteFs.
+var mergeWhiteouts = NewDirsMerger(MergeOptions{Whiteouts: true})
+
+func (u *CopyOnWriteFs) dirsMerger() DirsMerger {
+	if u.merger != nil {
+		return u.merger
+	}
+	return mergeWhiteouts
+}
+
+// whiteoutPrefix starts the names of the files marking removed base files.
+const whiteoutPrefix = ".wh."
+
+// whiteoutName returns the name of the whiteout of name.
+func (u *CopyOnWriteFs) whiteoutName(name string) string {
+	dir, file := Split(u, Clean(u, name))
+	return Join(u, dir, whiteoutPrefix+file)
+}
+
+// isReserved reports whether an element of name starts with the whiteout
+// prefix, so that the file cannot be written to the overlay without being
+// taken for a whiteout.
+func (u *CopyOnWriteFs) isReserved(name string) bool {
+	for _, elem := range strings.Split(Clean(u, name), PathSeparatorOf(u)) {
+		if strings.HasPrefix(elem, whiteoutPrefix) {
+			return true
+		}
+	}
+	return false
 }
 
-func NewCopyOnWriteFs(base Fs, layer Fs) Fs {
-	return &CopyOnWriteFs{base: base, layer: layer}
+// errReserved is the error of op writing the reserved name.
+func errReserved(op, name string) error {
+	return &os.PathError{Op: op, Path: name, Err: syscall.EINVAL}
+}
+
+// isWhiteout reports whether name is hidden in the base layer by a whiteout
+// of itself or one of its parents.
+func (u *CopyOnWriteFs) isWhiteout(name string) bool {
+	for p := Clean(u, name); ; {
+		parent := Dir(u, p)
+		if parent == p {
+			return false
+		}
+		if _, err := u.layer.Stat(u.whiteoutName(p)); err == nil {
+			return true
+		}
+		p = parent
+	}
+}
+
+// whiteout hides name in the base layer.
+func (u *CopyOnWriteFs) whiteout(name string) error {
+	if err := u.layer.MkdirAll(Dir(u, Clean(u, name)), 0o777); err != nil {
+		return err
+	}
+	f, err := u.layer.Create(u.whiteoutName(name))
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// inBase reports whether name is visible in the base layer.
+func (u *CopyOnWriteFs) inBase(name string) bool {
+	if _, err := u.base.Stat(name); err != nil {
+		return false
+	}
+	return !u.isWhiteout(name)
+}
+
+// hideWhiteouts leaves the whiteouts out of the entries of the overlay, and
+// the files they hide out of the entries of the base.
+func hideWhiteouts(lofi, bofi []os.FileInfo) (layer, base []os.FileInfo) {
+	hidden := make(map[string]bool)
+	for _, fi := range lofi {
+		if name := fi.Name(); strings.HasPrefix(name, whiteoutPrefix) {
+			hidden[name[len(whiteoutPrefix):]] = true
+		} else {
+			layer = append(layer, fi)
+		}
+	}
+	for _, fi := range bofi {
+		if !hidden[fi.Name()] {
+			base = append(base, fi)
+		}
+	}
+	return layer, base
 }
 
 // Returns true if the file is not in the overlay
 func (u *CopyOnWriteFs) isBaseFile(name string) (bool, error) {
-	if _, err := u.layer.Stat(name); err == nil {
+	// in the overlay, reserved names are whiteouts
+	if !u.isReserved(name) {
+		if _, err := u.layer.Stat(name); err == nil {
+			return false, nil
+		}
+	}
+	if u.isWhiteout(name) {
 		return false, nil
 	}
 	_, err := u.base.Stat(name)
@@ -50,6 +181,12 @@ func (u *CopyOnWriteFs) copyToLayer(name string) error {
 }
 
 func (u *CopyOnWriteFs) Chtimes(name string, atime, mtime time.Time) error {
+	if u.isReserved(name) {
+		return errReserved("chtimes", name)
+	}
+	if err := u.settle(name); err != nil {
+		return err
+	}
 	b, err := u.isBaseFile(name)
 	if err != nil {
 		return err
@@ -63,6 +200,12 @@ func (u *CopyOnWriteFs) Chtimes(name string, atime, mtime time.Time) error {
 }
 
 func (u *CopyOnWriteFs) Chmod(name string, mode os.FileMode) error {
+	if u.isReserved(name) {
+		return errReserved("chmod", name)
+	}
+	if err := u.settle(name); err != nil {
+		return err
+	}
 	b, err := u.isBaseFile(name)
 	if err != nil {
 		return err
@@ -76,6 +219,12 @@ func (u *CopyOnWriteFs) Chmod(name string, mode os.FileMode) error {
 }
 
 func (u *CopyOnWriteFs) Chown(name string, uid, gid int) error {
+	if u.isReserved(name) {
+		return errReserved("chown", name)
+	}
+	if err := u.settle(name); err != nil {
+		return err
+	}
 	b, err := u.isBaseFile(name)
 	if err != nil {
 		return err
@@ -89,10 +238,19 @@ func (u *CopyOnWriteFs) Chown(name string, uid, gid int) error {
 }
 
 func (u *CopyOnWriteFs) Stat(name string) (os.FileInfo, error) {
-	fi, err := u.layer.Stat(name)
+	var fi os.FileInfo
+	var err error
+	if u.isReserved(name) {
+		err = &os.PathError{Op: "stat", Path: name, Err: syscall.ENOENT}
+	} else {
+		fi, err = u.layer.Stat(name)
+	}
 	if err != nil {
 		isNotExist := u.isNotExist(err)
 		if isNotExist {
+			if u.isWhiteout(name) {
+				return nil, &os.PathError{Op: "stat", Path: name, Err: syscall.ENOENT}
+			}
 			return u.base.Stat(name)
 		}
 		return nil, err
@@ -104,7 +262,7 @@ func (u *CopyOnWriteFs) LstatIfPossible(name string) (os.FileInfo, bool, error)
 	llayer, ok1 := u.layer.(Lstater)
 	lbase, ok2 := u.base.(Lstater)
 
-	if ok1 {
+	if ok1 && !u.isReserved(name) {
 		fi, b, err := llayer.LstatIfPossible(name)
 		if err == nil {
 			return fi, b, nil
@@ -115,6 +273,10 @@ func (u *CopyOnWriteFs) LstatIfPossible(name string) (os.FileInfo, bool, error)
 		}
 	}
 
+	if u.isWhiteout(name) {
+		return nil, ok1, &os.PathError{Op: "lstat", Path: name, Err: syscall.ENOENT}
+	}
+
 	if ok2 {
 		fi, b, err := lbase.LstatIfPossible(name)
 		if err == nil {
@@ -127,10 +289,13 @@ func (u *CopyOnWriteFs) LstatIfPossible(name string) (os.FileInfo, bool, error)
 
 	fi, err := u.Stat(name)
 
-	return fi, false, err
+	return fi, false, withOp("lstat", err)
 }
 
 func (u *CopyOnWriteFs) SymlinkIfPossible(oldname, newname string) error {
+	if u.isReserved(newname) {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: syscall.EINVAL}
+	}
 	if slayer, ok := u.layer.(Linker); ok {
 		return slayer.SymlinkIfPossible(oldname, newname)
 	}
@@ -139,8 +304,15 @@ func (u *CopyOnWriteFs) SymlinkIfPossible(oldname, newname string) error {
 }
 
 func (u *CopyOnWriteFs) ReadlinkIfPossible(name string) (string, error) {
-	if rlayer, ok := u.layer.(LinkReader); ok {
-		return rlayer.ReadlinkIfPossible(name)
+	if rlayer, ok := u.layer.(LinkReader); ok && !u.isReserved(name) {
+		target, err := rlayer.ReadlinkIfPossible(name)
+		if err == nil || !u.isNotExist(err) {
+			return target, err
+		}
+	}
+
+	if u.isWhiteout(name) {
+		return "", &os.PathError{Op: "readlink", Path: name, Err: syscall.ENOENT}
 	}
 
 	if rbase, ok := u.base.(LinkReader); ok {
@@ -150,6 +322,15 @@ func (u *CopyOnWriteFs) ReadlinkIfPossible(name string) (string, error) {
 	return "", &os.PathError{Op: "readlink", Path: name, Err: ErrNoReadlink}
 }
 
+// withOp reports a *os.PathError returned by a helper call under the op of
+// the calling method.
+func withOp(op string, err error) error {
+	if e, ok := err.(*os.PathError); ok {
+		return &os.PathError{Op: op, Path: e.Path, Err: e.Err}
+	}
+	return err
+}
+
 func (u *CopyOnWriteFs) isNotExist(err error) bool {
 	if e, ok := err.(*os.PathError); ok {
 		err = e.Err
@@ -160,50 +341,101 @@ func (u *CopyOnWriteFs) isNotExist(err error) bool {
 	return false
 }
 
-// Renaming files present only in the base layer is not permitted
+// Renaming files present only in the base layer is not permitted. If the
+// file is present in both layers, the base file is hidden by a whiteout.
 func (u *CopyOnWriteFs) Rename(oldname, newname string) error {
+	if u.isReserved(oldname) || u.isReserved(newname) {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: syscall.EINVAL}
+	}
+	if err := u.settle(oldname); err != nil {
+		return err
+	}
+	if err := u.settle(newname); err != nil {
+		return err
+	}
 	b, err := u.isBaseFile(oldname)
 	if err != nil {
 		return err
 	}
 	if b {
-		return syscall.EPERM
+		// the base is read only, RenameOrCopy copies the file up instead
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: ErrCrossDevice}
 	}
-	return u.layer.Rename(oldname, newname)
+	if err := u.layer.Rename(oldname, newname); err != nil {
+		return err
+	}
+	if u.inBase(oldname) {
+		return withOp("rename", u.whiteout(oldname))
+	}
+	return nil
 }
 
-// Removing files present only in the base layer is not permitted. If
-// a file is present in the base layer and the overlay, only the overlay
-// will be removed.
+// Remove removes the file from the overlay and, if it is present in the base
+// layer, hides it there with a whiteout.
 func (u *CopyOnWriteFs) Remove(name string) error {
-	err := u.layer.Remove(name)
-	switch err {
-	case syscall.ENOENT:
-		_, err = u.base.Stat(name)
-		if err == nil {
-			return syscall.EPERM
+	if u.isReserved(name) {
+		return errReserved("remove", name)
+	}
+	if err := u.settle(name); err != nil {
+		return err
+	}
+	inBase := u.inBase(name)
+	var err error
+	if fi, serr := u.Stat(name); serr == nil && fi.IsDir() {
+		names, err := ReadDir(u, name)
+		if err != nil {
+			return withOp("remove", err)
 		}
-		return syscall.ENOENT
-	default:
+		if len(names) > 0 {
+			return &os.PathError{Op: "remove", Path: name, Err: errNotEmpty}
+		}
+		// the directory of the overlay can only hold whiteouts of the
+		// files removed from it, which the whiteout of name replaces
+		err = u.layer.RemoveAll(name)
+	} else {
+		err = u.layer.Remove(name)
+	}
+	if err != nil && !u.isNotExist(err) {
 		return err
 	}
+	if inBase {
+		return withOp("remove", u.whiteout(name))
+	}
+	if err != nil {
+		return &os.PathError{Op: "remove", Path: name, Err: syscall.ENOENT}
+	}
+	return nil
 }
 
 func (u *CopyOnWriteFs) RemoveAll(name string) error {
-	err := u.layer.RemoveAll(name)
-	switch err {
-	case syscall.ENOENT:
-		_, err = u.base.Stat(name)
-		if err == nil {
-			return syscall.EPERM
-		}
-		return syscall.ENOENT
-	default:
+	if u.isReserved(name) {
+		return errReserved("RemoveAll", name)
+	}
+	if err := u.settle(name); err != nil {
 		return err
 	}
+	if err := u.layer.RemoveAll(name); err != nil && !u.isNotExist(err) {
+		return err
+	}
+	if u.inBase(name) {
+		return withOp("RemoveAll", u.whiteout(name))
+	}
+	return nil
 }
 
 func (u *CopyOnWriteFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	if u.isReserved(name) {
+		if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) != 0 {
+			return nil, errReserved("open", name)
+		}
+		if u.isWhiteout(name) {
+			return nil, &os.PathError{Op: "open", Path: name, Err: syscall.ENOENT}
+		}
+		return readOnlyFile(u.base.OpenFile(name, flag, perm))
+	}
+	if err := u.settle(name); err != nil {
+		return nil, err
+	}
 	b, err := u.isBaseFile(name)
 	if err != nil {
 		return nil, err
@@ -211,17 +443,17 @@ func (u *CopyOnWriteFs) OpenFile(name string, flag int, perm os.FileMode) (File,
 
 	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) != 0 {
 		if b {
-			if err = u.copyToLayer(name); err != nil {
-				return nil, err
-			}
-			return u.layer.OpenFile(name, flag, perm)
+			return u.copyUp(name, flag, perm)
 		}
 
-		dir := filepath.Dir(name)
+		dir := Dir(u, name)
 		isaDir, err := IsDir(u.base, dir)
 		if err != nil && !os.IsNotExist(err) {
 			return nil, err
 		}
+		if isaDir && u.isWhiteout(dir) {
+			isaDir = false
+		}
 		if isaDir {
 			if err = u.layer.MkdirAll(dir, 0o777); err != nil {
 				return nil, err
@@ -240,7 +472,7 @@ func (u *CopyOnWriteFs) OpenFile(name string, flag int, perm os.FileMode) (File,
 		return nil, &os.PathError{Op: "open", Path: name, Err: syscall.ENOTDIR} // ...or os.ErrNotExist?
 	}
 	if b {
-		return u.base.OpenFile(name, flag, perm)
+		return readOnlyFile(u.base.OpenFile(name, flag, perm))
 	}
 	return u.layer.OpenFile(name, flag, perm)
 }
@@ -251,6 +483,12 @@ func (u *CopyOnWriteFs) OpenFile(name string, flag int, perm os.FileMode) (File,
 //	layer: doesn't exist, exists as a file, and exists as a directory
 //	base:  doesn't exist, exists as a file, and exists as a directory
 func (u *CopyOnWriteFs) Open(name string) (File, error) {
+	if u.isReserved(name) {
+		return u.OpenFile(name, os.O_RDONLY, 0)
+	}
+	if err := u.settle(name); err != nil {
+		return nil, err
+	}
 	// Since the overlay overrides the base we check that first
 	b, err := u.isBaseFile(name)
 	if err != nil {
@@ -259,13 +497,13 @@ func (u *CopyOnWriteFs) Open(name string) (File, error) {
 
 	// If overlay doesn't exist, return the base (base state irrelevant)
 	if b {
-		return u.base.Open(name)
+		return readOnlyFile(u.base.Open(name))
 	}
 
 	// If overlay is a file, return it (base state irrelevant)
 	dir, err := IsDir(u.layer, name)
 	if err != nil {
-		return nil, err
+		return nil, withOp("open", err)
 	}
 	if !dir {
 		return u.layer.Open(name)
@@ -273,13 +511,18 @@ func (u *CopyOnWriteFs) Open(name string) (File, error) {
 
 	// Overlay is a directory, base state now matters.
 	// Base state has 3 states to check but 2 outcomes:
-	// A. It's a file or non-readable in the base (return just the overlay)
+	// A. It's a file, non-readable or hidden in the base (return just the
+	//    overlay, without its whiteouts)
 	// B. It's an accessible directory in the base (return a UnionFile)
 
 	// If base is file or nonreadable, return overlay
 	dir, err = IsDir(u.base, name)
-	if !dir || err != nil {
-		return u.layer.Open(name)
+	if !dir || err != nil || u.isWhiteout(name) {
+		lfile, err := u.layer.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		return &UnionFile{Layer: lfile, Merger: u.dirsMerger()}, nil
 	}
 
 	// Both base & layer are directories
@@ -292,16 +535,17 @@ func (u *CopyOnWriteFs) Open(name string) (File, error) {
 		return nil, fmt.Errorf("BaseErr: %v\nOverlayErr: %v", bErr, lErr)
 	}
 
-	return &UnionFile{Base: bfile, Layer: lfile}, nil
+	return &UnionFile{Base: bfile, Layer: lfile, Merger: u.dirsMerger()}, nil
 }
 
 func (u *CopyOnWriteFs) Mkdir(name string, perm os.FileMode) error {
-	dir, err := IsDir(u.base, name)
-	if err != nil {
-		return u.layer.MkdirAll(name, perm)
+	if u.isReserved(name) {
+		return errReserved("mkdir", name)
 	}
-	if dir {
-		return ErrFileExists
+	// name may exist in either layer; its parent is created in the overlay
+	// if it only exists in the base.
+	if _, err := u.Stat(name); err == nil {
+		return &os.PathError{Op: "mkdir", Path: name, Err: ErrFileExists}
 	}
 	return u.layer.MkdirAll(name, perm)
 }
@@ -310,9 +554,25 @@ func (u *CopyOnWriteFs) Name() string {
 	return "CopyOnWriteFs"
 }
 
+// Unwrap returns the read-only base. The overlay is not reachable through
+// it.
+func (u *CopyOnWriteFs) Unwrap() Fs {
+	return u.base
+}
+
+// Capabilities combines those of the base and the overlay: symlinks are
+// created in the overlay, and files may be read from either of them.
+func (u *CopyOnWriteFs) Capabilities() Capability {
+	base, layer := Capabilities(u.base), Capabilities(u.layer)
+	return (base|layer)&(CapLstat|CapReadlink) | layer&CapSymlink | base&layer&CapReadAt
+}
+
 func (u *CopyOnWriteFs) MkdirAll(name string, perm os.FileMode) error {
+	if u.isReserved(name) {
+		return errReserved("mkdir", name)
+	}
 	dir, err := IsDir(u.base, name)
-	if err != nil {
+	if err != nil || u.isWhiteout(name) {
 		return u.layer.MkdirAll(name, perm)
 	}
 	if dir {
@@ -325,3 +585,151 @@ func (u *CopyOnWriteFs) MkdirAll(name string, perm os.FileMode) error {
 func (u *CopyOnWriteFs) Create(name string) (File, error) {
 	return u.OpenFile(name, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0o666)
 }
+
+// Changeset lists the paths that differ between the overlay of a
+// CopyOnWriteFs and its base layer. All paths are sorted, parents come
+// before their children.
+type Changeset struct {
+	// Added are files and directories only present in the overlay.
+	Added []string
+	// Modified are files present in both layers whose content or type
+	// differ. Modes are not compared, copying a file to the overlay does not
+	// preserve them.
+	Modified []string
+	// Deleted are paths of the base layer hidden by whiteouts. A path can
+	// be both deleted and added, if it was recreated in the overlay.
+	Deleted []string
+}
+
+// Changes walks the overlay and compares it with the base layer. The overlay
+// is walked from its root, so it should be rooted at the directory that
+// holds the changes, e.g. with a BasePathFs or a MemMapFs.
+func (u *CopyOnWriteFs) Changes() (*Changeset, error) {
+	if err := u.settle(FilePathSeparator); err != nil {
+		return nil, err
+	}
+	c := &Changeset{}
+	err := Walk(u.layer, FilePathSeparator, func(name string, lfi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if name == FilePathSeparator {
+			return nil
+		}
+		if dir, file := Split(u.layer, name); strings.HasPrefix(file, whiteoutPrefix) {
+			hidden := Join(u.layer, dir, file[len(whiteoutPrefix):])
+			if _, err := u.base.Stat(hidden); err == nil {
+				c.Deleted = append(c.Deleted, hidden)
+			}
+			return nil
+		}
+		if u.isWhiteout(name) {
+			c.Added = append(c.Added, name)
+			return nil
+		}
+		bfi, err := u.base.Stat(name)
+		if err != nil {
+			if u.isNotExist(err) {
+				c.Added = append(c.Added, name)
+				return nil
+			}
+			return err
+		}
+		if lfi.IsDir() && bfi.IsDir() {
+			return nil
+		}
+		if lfi.IsDir() != bfi.IsDir() {
+			c.Modified = append(c.Modified, name)
+			return nil
+		}
+		equal, err := sameContent(u.base, u.layer, name, bfi.Size(), lfi.Size())
+		if err != nil {
+			return err
+		}
+		if !equal {
+			c.Modified = append(c.Modified, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(c.Deleted)
+	return c, nil
+}
+
+// Materialize applies the changes of the overlay to target, which is
+// expected to hold a copy of the base layer.
+func (u *CopyOnWriteFs) Materialize(target Fs) error {
+	c, err := u.Changes()
+	if err != nil {
+		return err
+	}
+	for _, name := range c.Deleted {
+		if err := target.RemoveAll(name); err != nil {
+			return err
+		}
+	}
+	for _, names := range [][]string{c.Added, c.Modified} {
+		for _, name := range names {
+			fi, err := u.layer.Stat(name)
+			if err != nil {
+				return err
+			}
+			if fi.IsDir() {
+				if err := target.MkdirAll(name, fi.Mode().Perm()); err != nil {
+					return err
+				}
+				continue
+			}
+			if tfi, err := target.Stat(name); err == nil && tfi.IsDir() {
+				if err := target.RemoveAll(name); err != nil {
+					return err
+				}
+			}
+			if err := copyToLayer(u.layer, target, name); err != nil {
+				return err
+			}
+			if err := target.Chmod(name, fi.Mode().Perm()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// sameContent compares the content of the named file in two filesystems.
+func sameContent(a, b Fs, name string, asize, bsize int64) (bool, error) {
+	if asize != bsize {
+		return false, nil
+	}
+	af, err := a.Open(name)
+	if err != nil {
+		return false, err
+	}
+	defer af.Close()
+	bf, err := b.Open(name)
+	if err != nil {
+		return false, err
+	}
+	defer bf.Close()
+
+	abuf := make([]byte, 32*1024)
+	bbuf := make([]byte, 32*1024)
+	for {
+		an, aerr := io.ReadFull(af, abuf)
+		bn, berr := io.ReadFull(bf, bbuf)
+		if !bytes.Equal(abuf[:an], bbuf[:bn]) {
+			return false, nil
+		}
+		if aerr == io.EOF || aerr == io.ErrUnexpectedEOF {
+			return berr == io.EOF || berr == io.ErrUnexpectedEOF, nil
+		}
+		if aerr != nil {
+			return false, aerr
+		}
+		if berr != nil {
+			return false, berr
+		}
+	}
+}
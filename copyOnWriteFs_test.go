@@ -1,9 +1,13 @@
 package afero
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
+	"reflect"
+	"syscall"
 	"testing"
+	"time"
 )
 
 func TestCopyOnWrite(t *testing.T) {
@@ -60,3 +64,211 @@ func TestCopyOnWriteFileInMemMapBase(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestCopyOnWriteChanges(t *testing.T) {
+	base := &MemMapFs{}
+	WriteFile(base, "/same.txt", []byte("same"), 0o644)
+	WriteFile(base, "/changed.txt", []byte("old"), 0o644)
+	WriteFile(base, "/dir/kept.txt", []byte("kept"), 0o644)
+
+	cow := NewCopyOnWriteFs(base, &MemMapFs{}).(*CopyOnWriteFs)
+	WriteFile(cow, "/changed.txt", []byte("new"), 0o644)
+	WriteFile(cow, "/dir/added.txt", []byte("added"), 0o644)
+	cow.Mkdir("/newdir", 0o755)
+	// Copied to the overlay without changing the content.
+	cow.Chtimes("/same.txt", time.Now(), time.Now())
+
+	c, err := cow.Changes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	added := []string{filepath.FromSlash("/dir/added.txt"), filepath.FromSlash("/newdir")}
+	modified := []string{filepath.FromSlash("/changed.txt")}
+	if !reflect.DeepEqual(c.Added, added) {
+		t.Errorf("Added = %v, want %v", c.Added, added)
+	}
+	if !reflect.DeepEqual(c.Modified, modified) {
+		t.Errorf("Modified = %v, want %v", c.Modified, modified)
+	}
+	if len(c.Deleted) != 0 {
+		t.Errorf("Deleted = %v, want none", c.Deleted)
+	}
+
+	target := &MemMapFs{}
+	WriteFile(target, "/changed.txt", []byte("old"), 0o644)
+	WriteFile(target, "/untouched.txt", []byte("untouched"), 0o644)
+	if err := cow.Materialize(target); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		"/changed.txt":   "new",
+		"/dir/added.txt": "added",
+		"/untouched.txt": "untouched",
+	} {
+		got, err := ReadFile(target, name)
+		if err != nil || string(got) != want {
+			t.Errorf("%s: got %q, %v, want %q", name, got, err, want)
+		}
+	}
+	if ok, _ := DirExists(target, "/newdir"); !ok {
+		t.Error("/newdir was not created in the target")
+	}
+	if ok, _ := Exists(target, "/same.txt"); ok {
+		t.Error("/same.txt is unchanged and should not have been copied")
+	}
+}
+
+func TestCopyOnWriteWhiteouts(t *testing.T) {
+	base := &MemMapFs{}
+	WriteFile(base, "/file.txt", []byte("base"), 0o644)
+	WriteFile(base, "/dir/a.txt", []byte("a"), 0o644)
+	WriteFile(base, "/dir/b.txt", []byte("b"), 0o644)
+	WriteFile(base, "/tree/sub/c.txt", []byte("c"), 0o644)
+
+	cow := NewCopyOnWriteFs(base, &MemMapFs{}).(*CopyOnWriteFs)
+
+	if err := cow.Remove("/file.txt"); err != nil {
+		t.Fatalf("Remove of a base file: %v", err)
+	}
+	if _, err := cow.Stat("/file.txt"); !os.IsNotExist(err) {
+		t.Errorf("Stat of a removed file: got %v, want not exist", err)
+	}
+	if _, err := cow.Open("/file.txt"); !os.IsNotExist(err) {
+		t.Errorf("Open of a removed file: got %v, want not exist", err)
+	}
+	if _, err := base.Stat("/file.txt"); err != nil {
+		t.Errorf("base file was changed: %v", err)
+	}
+
+	if err := cow.Remove("/dir"); err == nil {
+		t.Error("Remove of a non-empty directory succeeded")
+	}
+	// Present in both layers: the base file must not come back.
+	WriteFile(cow, "/dir/a.txt", []byte("changed"), 0o644)
+	if err := cow.Remove("/dir/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	names, err := ReadDir(cow, "/dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || names[0].Name() != "b.txt" {
+		t.Errorf("ReadDir = %v, want only b.txt", names)
+	}
+
+	if err := cow.RemoveAll("/tree"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cow.Stat("/tree/sub/c.txt"); !os.IsNotExist(err) {
+		t.Errorf("Stat below a removed directory: got %v, want not exist", err)
+	}
+
+	// Recreating a removed directory does not bring back its content.
+	if err := cow.MkdirAll("/tree/sub", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if names, _ := ReadDir(cow, "/tree/sub"); len(names) != 0 {
+		t.Errorf("ReadDir of a recreated directory = %v, want it empty", names)
+	}
+	WriteFile(cow, "/file.txt", []byte("new"), 0o644)
+	if got, _ := ReadFile(cow, "/file.txt"); string(got) != "new" {
+		t.Errorf("recreated file: got %q, want %q", got, "new")
+	}
+
+	c, err := cow.Changes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleted := []string{filepath.FromSlash("/dir/a.txt"), filepath.FromSlash("/file.txt"), filepath.FromSlash("/tree")}
+	if !reflect.DeepEqual(c.Deleted, deleted) {
+		t.Errorf("Deleted = %v, want %v", c.Deleted, deleted)
+	}
+
+	target := &MemMapFs{}
+	copyFromBase := func(name string) {
+		data, _ := ReadFile(base, name)
+		WriteFile(target, name, data, 0o644)
+	}
+	for _, name := range []string{"/file.txt", "/dir/a.txt", "/dir/b.txt", "/tree/sub/c.txt"} {
+		copyFromBase(name)
+	}
+	if err := cow.Materialize(target); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]bool{
+		"/file.txt":       true,
+		"/dir/a.txt":      false,
+		"/dir/b.txt":      true,
+		"/tree/sub":       true,
+		"/tree/sub/c.txt": false,
+	} {
+		if ok, _ := Exists(target, name); ok != want {
+			t.Errorf("%s exists in the target: %v, want %v", name, ok, want)
+		}
+	}
+}
+
+func TestCopyOnWriteRemoveEmptiedDir(t *testing.T) {
+	base := &MemMapFs{}
+	WriteFile(base, "/d/a", []byte("a"), 0o644)
+	WriteFile(base, "/d/sub/b", []byte("b"), 0o644)
+	cow := NewCopyOnWriteFs(base, &MemMapFs{}).(*CopyOnWriteFs)
+
+	for _, name := range []string{"/d/a", "/d/sub/b", "/d/sub", "/d"} {
+		if err := cow.Remove(name); err != nil {
+			t.Fatalf("Remove(%s) = %v", name, err)
+		}
+	}
+	if _, err := cow.Stat("/d"); !os.IsNotExist(err) {
+		t.Errorf("Stat of the removed directory = %v", err)
+	}
+	c, err := cow.Changes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{filepath.FromSlash("/d")}; !reflect.DeepEqual(c.Deleted, want) {
+		t.Errorf("Deleted = %v, want %v", c.Deleted, want)
+	}
+}
+
+func TestCopyOnWriteReservedNames(t *testing.T) {
+	base := &MemMapFs{}
+	WriteFile(base, "/d/b", []byte("b"), 0o644)
+	WriteFile(base, "/d/.wh.kept", []byte("kept"), 0o644)
+	cow := NewCopyOnWriteFs(base, &MemMapFs{}).(*CopyOnWriteFs)
+
+	if err := WriteFile(cow, "/d/.wh.b", nil, 0o644); !errors.Is(err, syscall.EINVAL) {
+		t.Errorf("WriteFile of a reserved name = %v, want EINVAL", err)
+	}
+	if err := cow.MkdirAll("/e/.wh.d/f", 0o755); !errors.Is(err, syscall.EINVAL) {
+		t.Errorf("MkdirAll through a reserved name = %v, want EINVAL", err)
+	}
+	WriteFile(cow, "/d/c", nil, 0o644)
+	if err := cow.Rename("/d/c", "/d/.wh.b"); !errors.Is(err, syscall.EINVAL) {
+		t.Errorf("Rename to a reserved name = %v, want EINVAL", err)
+	}
+	if _, err := cow.Stat("/d/b"); err != nil {
+		t.Errorf("the base file was hidden: %v", err)
+	}
+
+	// whiteouts are not visible under their own names
+	cow.Remove("/d/b")
+	if _, err := cow.Stat("/d/.wh.b"); !os.IsNotExist(err) {
+		t.Errorf("Stat of a whiteout = %v", err)
+	}
+	if _, err := cow.Open("/d/.wh.b"); !os.IsNotExist(err) {
+		t.Errorf("Open of a whiteout = %v", err)
+	}
+	// files of the base with reserved names can be read
+	if data, err := ReadFile(cow, "/d/.wh.kept"); err != nil || string(data) != "kept" {
+		t.Errorf("ReadFile of a reserved base name = %q, %v", data, err)
+	}
+	var names []string
+	fis, _ := ReadDir(cow, "/d")
+	for _, fi := range fis {
+		names = append(names, fi.Name())
+	}
+	if want := []string{".wh.kept", "c"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("ReadDir = %v, want %v", names, want)
+	}
+}
@@ -0,0 +1,123 @@
+package afero
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestCopyFile(t *testing.T) {
+	src := NewOsFs()
+	dir := t.TempDir()
+	name := filepath.Join(dir, "data.bin")
+	content := strings.Repeat("x", 100000)
+	if err := WriteFile(src, name, []byte(content), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := src.Chtimes(name, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := NewMemMapFs()
+	var calls int
+	var last int64
+	err := CopyFile(dst, "/copy/data.bin", src, name, CopyWithProgress(func(n string, written, size int64) {
+		if n != name || size != int64(len(content)) || written < last {
+			t.Errorf("progress(%q, %d, %d) after %d", n, written, size, last)
+		}
+		calls++
+		last = written
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls == 0 || last != int64(len(content)) {
+		t.Errorf("%d progress calls ending at %d, want the size %d", calls, last, len(content))
+	}
+	if got, err := ReadFile(dst, "/copy/data.bin"); err != nil || string(got) != content {
+		t.Errorf("copied %d bytes, %v", len(got), err)
+	}
+	fi, err := dst.Stat("/copy/data.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0o640 || !fi.ModTime().Equal(mtime) {
+		t.Errorf("mode %v and time %v, want %v and %v", fi.Mode().Perm(), fi.ModTime(), os.FileMode(0o640), mtime)
+	}
+
+	if err := CopyFile(dst, "/copy/data.bin", src, name, CopyNoOverwrite()); !errors.Is(err, os.ErrExist) {
+		t.Errorf("CopyNoOverwrite onto an existing file = %v", err)
+	}
+	if err := CopyFile(dst, "/copy/dir", src, dir); !errors.Is(err, syscall.EISDIR) {
+		t.Errorf("CopyFile of a directory = %v", err)
+	}
+	// within one Fs, through Afero
+	a := Afero{dst}
+	if err := a.CopyFile("/copy/again.bin", "/copy/data.bin"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := a.ReadFile("/copy/again.bin"); string(got) != content {
+		t.Errorf("copy within the Fs has %d bytes", len(got))
+	}
+}
+
+func TestCopyDir(t *testing.T) {
+	src := NewMemMapFs()
+	for name, content := range map[string]string{
+		"/src/a.txt":         "a",
+		"/src/sub/b.txt":     "b",
+		"/src/sub/deep/c.go": "c",
+		"/src/empty.txt":     "",
+	} {
+		if err := WriteFile(src, name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	src.Mkdir("/src/emptydir", 0o755)
+	src.Chmod("/src/sub", 0o750)
+	src.(Linker).SymlinkIfPossible("sub/b.txt", "/src/link")
+
+	dst := NewOsFs()
+	root := filepath.Join(t.TempDir(), "dst")
+	var files []string
+	err := CopyDir(dst, root, src, "/src", CopyWithProgress(func(name string, written, size int64) {
+		if written == size {
+			files = append(files, name)
+		}
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"a.txt":         "a",
+		"sub/b.txt":     "b",
+		"sub/deep/c.go": "c",
+		"empty.txt":     "",
+		"link":          "b",
+	} {
+		if got, err := ReadFile(dst, filepath.Join(root, name)); err != nil || string(got) != content {
+			t.Errorf("%s = %q, %v, want %q", name, got, err, content)
+		}
+	}
+	if target, err := os.Readlink(filepath.Join(root, "link")); err != nil || target != "sub/b.txt" {
+		t.Errorf("link = %q, %v, want the symlink recreated", target, err)
+	}
+	if fi, err := dst.Stat(filepath.Join(root, "sub")); err != nil || fi.Mode().Perm() != 0o750 {
+		t.Errorf("mode of sub = %v, %v", fi.Mode().Perm(), err)
+	}
+	if ok, _ := IsDir(dst, filepath.Join(root, "emptydir")); !ok {
+		t.Error("the empty directory was not copied")
+	}
+	if len(files) != 4 {
+		t.Errorf("progress completed for %v, want the 4 files", files)
+	}
+
+	if err := CopyDir(dst, root, src, "/src/a.txt"); !errors.Is(err, syscall.ENOTDIR) {
+		t.Errorf("CopyDir of a file = %v", err)
+	}
+}
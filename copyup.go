@@ -0,0 +1,406 @@
+package afero
+
+import (
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// CopyUpPolicy sets how a CopyOnWriteFs copies a file of the base layer to
+// the overlay when it is opened for writing. The zero value copies the whole
+// file before OpenFile returns. Opening with O_TRUNC never copies the
+// content.
+type CopyUpPolicy struct {
+	// Lazy creates the file in the overlay without copying its content.
+	// The ranges the new handle does not overwrite are copied when they are
+	// read, when the handle is closed, or before any other operation on the
+	// file through the CopyOnWriteFs.
+	Lazy bool
+
+	// MinLazySize is the size from which files are copied lazily, smaller
+	// files are copied on open.
+	MinLazySize int64
+
+	// Async starts copying the content of lazily copied files in the
+	// background when they are opened, and closing them does not wait for
+	// the copy to complete. If it fails, the file is removed from the
+	// overlay, together with the changes made to it.
+	Async bool
+
+	// Done, if set, is called when the lazy copy of a file completes, with
+	// the error which stopped it if any.
+	Done func(name string, err error)
+}
+
+// CopyOnWriteCopyUp sets how files are copied to the overlay.
+func CopyOnWriteCopyUp(p CopyUpPolicy) CopyOnWriteOption {
+	return func(u *CopyOnWriteFs) { u.policy = p }
+}
+
+// copyUpChunk is the most a promotion copies at once, holding its lock.
+const copyUpChunk = 64 << 10
+
+// A promotion is the lazy copy of a file of the base layer to the overlay.
+type promotion struct {
+	u    *CopyOnWriteFs
+	name string
+	base File // the file in the base, read from
+	copy File // the file in the overlay, written to
+
+	mu       sync.Mutex
+	size     int64      // the bytes of the base still wanted
+	present  [][2]int64 // sorted, disjoint ranges already in the overlay
+	modified bool
+	done     bool
+}
+
+// copyUp copies name, a file of the base, to the overlay and opens it there
+// according to the CopyUpPolicy.
+func (u *CopyOnWriteFs) copyUp(name string, flag int, perm os.FileMode) (File, error) {
+	bfi, err := u.base.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if bfi.Mode().IsRegular() && flag&os.O_TRUNC != 0 {
+		// the content is discarded anyway
+		if err := u.layer.MkdirAll(Dir(u, name), 0o777); err != nil {
+			return nil, err
+		}
+		return u.layer.OpenFile(name, flag|os.O_CREATE, perm)
+	}
+	if !u.policy.Lazy || !bfi.Mode().IsRegular() || bfi.Size() < u.policy.MinLazySize {
+		if err := u.copyToLayer(name); err != nil {
+			return nil, err
+		}
+		return u.layer.OpenFile(name, flag, perm)
+	}
+
+	p, err := u.promote(name, bfi)
+	if err != nil {
+		return nil, err
+	}
+	f, err := u.layer.OpenFile(name, flag, perm)
+	if err != nil {
+		p.abort()
+		return nil, err
+	}
+	if u.policy.Async {
+		go p.run()
+	}
+	return &copyUpFile{File: f, p: p, append: flag&os.O_APPEND != 0}, nil
+}
+
+// promote creates name in the overlay with the size of bfi, its info in
+// the base, and registers its promotion.
+func (u *CopyOnWriteFs) promote(name string, bfi os.FileInfo) (*promotion, error) {
+	if err := u.layer.MkdirAll(Dir(u, name), 0o777); err != nil {
+		return nil, err
+	}
+	bf, err := u.base.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	lf, err := u.layer.Create(name)
+	if err != nil {
+		bf.Close()
+		return nil, err
+	}
+	p := &promotion{u: u, name: Clean(u, name), base: bf, copy: lf, size: bfi.Size()}
+	if err := lf.Truncate(bfi.Size()); err != nil {
+		p.abort()
+		return nil, err
+	}
+	u.mu.Lock()
+	if u.promotions == nil {
+		u.promotions = make(map[string]*promotion)
+	}
+	u.promotions[p.name] = p
+	u.mu.Unlock()
+	return p, nil
+}
+
+// settle completes the promotions of name and of the files below it, so
+// that the overlay holds their whole content.
+func (u *CopyOnWriteFs) settle(name string) error {
+	u.mu.Lock()
+	if len(u.promotions) == 0 {
+		u.mu.Unlock()
+		return nil
+	}
+	name = Clean(u, name)
+	prefix := name
+	if sep := PathSeparatorOf(u); !strings.HasSuffix(prefix, sep) {
+		prefix += sep
+	}
+	var pending []*promotion
+	for n, p := range u.promotions {
+		if n == name || strings.HasPrefix(n, prefix) {
+			pending = append(pending, p)
+		}
+	}
+	u.mu.Unlock()
+	for _, p := range pending {
+		if err := p.complete(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// missing returns the first range within [off, end) not in the overlay.
+func (p *promotion) missing(off, end int64) (int64, int64, bool) {
+	end = min(end, p.size)
+	for _, r := range p.present {
+		if off < r[0] {
+			break
+		}
+		if off < r[1] {
+			off = r[1]
+		}
+	}
+	if off >= end {
+		return 0, 0, false
+	}
+	i := sort.Search(len(p.present), func(i int) bool { return p.present[i][0] > off })
+	if i < len(p.present) && p.present[i][0] < end {
+		end = p.present[i][0]
+	}
+	return off, end, true
+}
+
+// add records that [off, end) is in the overlay.
+func (p *promotion) add(off, end int64) {
+	if off >= end {
+		return
+	}
+	i := sort.Search(len(p.present), func(i int) bool { return p.present[i][1] >= off })
+	j := i
+	for j < len(p.present) && p.present[j][0] <= end {
+		off = min(off, p.present[j][0])
+		end = max(end, p.present[j][1])
+		j++
+	}
+	p.present = append(p.present[:i], append([][2]int64{{off, end}}, p.present[j:]...)...)
+}
+
+// fill copies what is missing of [off, end) from the base. The caller holds
+// p.mu.
+func (p *promotion) fill(off, end int64) error {
+	buf := make([]byte, copyUpChunk)
+	for {
+		from, to, ok := p.missing(off, end)
+		if !ok {
+			return nil
+		}
+		to = min(to, from+copyUpChunk)
+		if err := p.copyRange(buf[:to-from], from); err != nil {
+			return err
+		}
+		off = to
+	}
+}
+
+func (p *promotion) copyRange(buf []byte, off int64) error {
+	n, err := p.base.ReadAt(buf, off)
+	if n < len(buf) {
+		if err == nil || err == io.EOF {
+			// the base changed since it was opened
+			err = syscall.EIO
+		}
+		return err
+	}
+	if _, err := p.copy.WriteAt(buf, off); err != nil {
+		return err
+	}
+	p.add(off, off+int64(n))
+	return nil
+}
+
+// run copies the content in the background, a chunk at a time so that the
+// handle of the file is not blocked for long.
+func (p *promotion) run() {
+	buf := make([]byte, copyUpChunk)
+	for {
+		p.mu.Lock()
+		if p.done {
+			p.mu.Unlock()
+			return
+		}
+		from, to, ok := p.missing(0, p.size)
+		if !ok {
+			p.mu.Unlock()
+			p.complete()
+			return
+		}
+		to = min(to, from+copyUpChunk)
+		if err := p.copyRange(buf[:to-from], from); err != nil {
+			p.mu.Unlock()
+			p.fail(err)
+			return
+		}
+		p.mu.Unlock()
+	}
+}
+
+// complete copies the rest of the content and ends the promotion.
+func (p *promotion) complete() error {
+	p.mu.Lock()
+	if p.done {
+		p.mu.Unlock()
+		return nil
+	}
+	err := p.fill(0, p.size)
+	if err != nil {
+		p.mu.Unlock()
+		return p.fail(err)
+	}
+	if !p.modified {
+		if bfi, err := p.base.Stat(); err == nil {
+			p.u.layer.Chtimes(p.name, bfi.ModTime(), bfi.ModTime())
+		}
+	}
+	err = p.close()
+	p.mu.Unlock()
+	p.notify(err)
+	return err
+}
+
+// fail ends a promotion which could not copy the content, removing the
+// incomplete file from the overlay.
+func (p *promotion) fail(err error) error {
+	p.mu.Lock()
+	if p.done {
+		p.mu.Unlock()
+		return nil
+	}
+	p.close()
+	p.u.layer.Remove(p.name)
+	p.mu.Unlock()
+	p.notify(err)
+	return err
+}
+
+// abort ends a promotion whose file could not be opened.
+func (p *promotion) abort() {
+	p.mu.Lock()
+	p.close()
+	p.u.layer.Remove(p.name)
+	p.mu.Unlock()
+}
+
+// close releases the files and unregisters p. The caller holds p.mu.
+func (p *promotion) close() error {
+	p.done = true
+	p.u.mu.Lock()
+	if p.u.promotions[p.name] == p {
+		delete(p.u.promotions, p.name)
+	}
+	p.u.mu.Unlock()
+	p.base.Close()
+	return p.copy.Close()
+}
+
+func (p *promotion) notify(err error) {
+	if p.u.policy.Done != nil {
+		p.u.policy.Done(p.name, err)
+	}
+}
+
+// copyUpFile is a file of the overlay being promoted lazily. Reads first
+// copy the ranges they need, writes record the ranges they make
+// unnecessary to copy.
+type copyUpFile struct {
+	File
+	p      *promotion
+	append bool
+}
+
+func (f *copyUpFile) ensure(off int64, n int) error {
+	f.p.mu.Lock()
+	defer f.p.mu.Unlock()
+	if f.p.done {
+		return nil
+	}
+	return f.p.fill(off, off+int64(n))
+}
+
+func (f *copyUpFile) Read(b []byte) (int, error) {
+	off, err := f.File.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	if err := f.ensure(off, len(b)); err != nil {
+		return 0, err
+	}
+	return f.File.Read(b)
+}
+
+func (f *copyUpFile) ReadAt(b []byte, off int64) (int, error) {
+	if err := f.ensure(off, len(b)); err != nil {
+		return 0, err
+	}
+	return f.File.ReadAt(b, off)
+}
+
+func (f *copyUpFile) Write(b []byte) (int, error) {
+	f.p.mu.Lock()
+	defer f.p.mu.Unlock()
+	if f.p.done {
+		return f.File.Write(b)
+	}
+	f.p.modified = true
+	if f.append {
+		// appending writes past the content of the base
+		return f.File.Write(b)
+	}
+	off, err := f.File.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	n, err := f.File.Write(b)
+	f.p.add(off, off+int64(n))
+	return n, err
+}
+
+func (f *copyUpFile) WriteAt(b []byte, off int64) (int, error) {
+	f.p.mu.Lock()
+	defer f.p.mu.Unlock()
+	n, err := f.File.WriteAt(b, off)
+	if !f.p.done {
+		f.p.add(off, off+int64(n))
+		f.p.modified = true
+	}
+	return n, err
+}
+
+func (f *copyUpFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *copyUpFile) Truncate(size int64) error {
+	f.p.mu.Lock()
+	defer f.p.mu.Unlock()
+	if err := f.File.Truncate(size); err != nil {
+		return err
+	}
+	if !f.p.done {
+		f.p.size = min(f.p.size, size)
+		f.p.modified = true
+	}
+	return nil
+}
+
+// Close completes the copy, unless it is done in the background.
+func (f *copyUpFile) Close() error {
+	var err error
+	if !f.p.u.policy.Async {
+		err = f.p.complete()
+	}
+	if cerr := f.File.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
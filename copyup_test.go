@@ -0,0 +1,137 @@
+package afero
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+// newCopyUpFs returns a CopyOnWriteFs whose base holds /dir/big with content.
+func newCopyUpFs(t *testing.T, content []byte, p CopyUpPolicy) (base, layer Fs, u *CopyOnWriteFs) {
+	t.Helper()
+	base, layer = NewMemMapFs(), NewMemMapFs()
+	if err := WriteFile(base, "/dir/big", content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return base, layer, NewCopyOnWriteFs(base, layer, CopyOnWriteCopyUp(p)).(*CopyOnWriteFs)
+}
+
+func copyUpContent() []byte {
+	content := make([]byte, 3*copyUpChunk+100)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+	return content
+}
+
+func TestCopyUpLazy(t *testing.T) {
+	content := copyUpContent()
+	base, layer, u := newCopyUpFs(t, content, CopyUpPolicy{Lazy: true})
+
+	f, err := u.OpenFile("/dir/big", os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cf, ok := f.(*copyUpFile)
+	if !ok {
+		t.Fatalf("OpenFile returned a %T, want a lazily copied file", f)
+	}
+	if _, err := f.WriteAt([]byte("changed"), copyUpChunk+10); err != nil {
+		t.Fatal(err)
+	}
+	if got := cf.p.present; len(got) != 1 || got[0] != [2]int64{copyUpChunk + 10, copyUpChunk + 17} {
+		t.Errorf("present = %v, only the write should be in the overlay", got)
+	}
+	copy(content[copyUpChunk+10:], "changed")
+
+	buf := make([]byte, 20)
+	if _, err := f.ReadAt(buf, copyUpChunk); err != nil || !bytes.Equal(buf, content[copyUpChunk:copyUpChunk+20]) {
+		t.Errorf("ReadAt = %q, %v", buf, err)
+	}
+	if err := f.Truncate(int64(len(content) - 50)); err != nil {
+		t.Fatal(err)
+	}
+	content = content[:len(content)-50]
+
+	// another open sees the whole content
+	if got, err := ReadFile(u, "/dir/big"); err != nil || !bytes.Equal(got, content) {
+		t.Errorf("ReadFile while open = %d bytes, %v", len(got), err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ReadFile(layer, "/dir/big"); err != nil || !bytes.Equal(got, content) {
+		t.Errorf("overlay after Close = %d bytes, %v", len(got), err)
+	}
+	if got, _ := ReadFile(base, "/dir/big"); len(got) != len(content)+50 {
+		t.Errorf("the base was changed")
+	}
+	if len(u.promotions) != 0 {
+		t.Errorf("%d promotions left", len(u.promotions))
+	}
+}
+
+func TestCopyUpAsync(t *testing.T) {
+	content := copyUpContent()
+	done := make(chan error, 1)
+	_, layer, u := newCopyUpFs(t, content, CopyUpPolicy{
+		Lazy:  true,
+		Async: true,
+		Done: func(name string, err error) {
+			if name != "/dir/big" {
+				t.Errorf("Done called for %s", name)
+			}
+			done <- err
+		},
+	})
+
+	f, err := u.OpenFile("/dir/big", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString("tail"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ReadFile(layer, "/dir/big"); err != nil || !bytes.Equal(got, append(content, "tail"...)) {
+		t.Errorf("overlay = %d bytes, %v", len(got), err)
+	}
+}
+
+func TestCopyUpEager(t *testing.T) {
+	content := copyUpContent()
+	_, layer, u := newCopyUpFs(t, content, CopyUpPolicy{Lazy: true, MinLazySize: int64(len(content)) + 1})
+
+	f, err := u.OpenFile("/dir/big", os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := f.(*copyUpFile); ok {
+		t.Error("a file smaller than MinLazySize was copied lazily")
+	}
+	f.Close()
+	if got, _ := ReadFile(layer, "/dir/big"); !bytes.Equal(got, content) {
+		t.Errorf("overlay = %d bytes, want a copy of the base", len(got))
+	}
+
+}
+
+func TestCopyUpTruncate(t *testing.T) {
+	base, layer, u := newCopyUpFs(t, copyUpContent(), CopyUpPolicy{})
+	if err := WriteFile(base, "/other", []byte("base content"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := u.OpenFile("/other", os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if fi, err := layer.Stat("/other"); err != nil || fi.Size() != 0 {
+		t.Errorf("overlay = %v, %v, want an empty file", fi, err)
+	}
+}
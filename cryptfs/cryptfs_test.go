@@ -0,0 +1,218 @@
+package cryptfs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/spf13/afero/aferotest"
+)
+
+var key = []byte("0123456789abcdef0123456789abcdef")
+
+func newFs(t *testing.T, base afero.Fs, opts ...Option) *Fs {
+	t.Helper()
+	fs, err := New(base, key, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fs
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, c := range []Cipher{AES256GCM, XChaCha20Poly1305} {
+		base := afero.NewMemMapFs()
+		cfs := newFs(t, base, WithCipher(c), WithChunkSize(16))
+		content := bytes.Repeat([]byte("secret "), 20)
+
+		if err := afero.WriteFile(cfs, "/dir/file", content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		raw, err := afero.ReadFile(base, "/dir/file")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(raw, []byte("secret")) {
+			t.Errorf("cipher %d: the plaintext is stored", c)
+		}
+		got, err := afero.ReadFile(cfs, "/dir/file")
+		if err != nil || !bytes.Equal(got, content) {
+			t.Errorf("cipher %d: ReadFile = %q, %v", c, got, err)
+		}
+		fi, err := cfs.Stat("/dir/file")
+		if err != nil || fi.Size() != int64(len(content)) {
+			t.Errorf("cipher %d: Stat = %v, %v, want size %d", c, fi, err, len(content))
+		}
+		fis, err := afero.ReadDir(cfs, "/dir")
+		if err != nil || len(fis) != 1 || fis[0].Size() != int64(len(content)) {
+			t.Errorf("cipher %d: ReadDir = %v, %v", c, fis, err)
+		}
+	}
+}
+
+func TestRandomAccess(t *testing.T) {
+	cfs := newFs(t, afero.NewMemMapFs(), WithChunkSize(8))
+	f, err := cfs.Create("/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	want := []byte("0123456789abcdefghij")
+	if _, err := f.Write(want); err != nil {
+		t.Fatal(err)
+	}
+	check := func(what string) {
+		t.Helper()
+		got := make([]byte, len(want)+5)
+		n, err := f.ReadAt(got, 0)
+		if err != io.EOF || !bytes.Equal(got[:n], want) {
+			t.Errorf("%s: ReadAt = %q, %v, want %q", what, got[:n], err, want)
+		}
+	}
+
+	// across a chunk boundary
+	if _, err := f.WriteAt([]byte("XYZ"), 6); err != nil {
+		t.Fatal(err)
+	}
+	copy(want[6:], "XYZ")
+	check("WriteAt")
+
+	buf := make([]byte, 4)
+	if _, err := f.Seek(7, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := f.Read(buf); n != 4 || err != nil || string(buf) != "YZ9a" {
+		t.Errorf("Read after Seek = %q, %v", buf[:n], err)
+	}
+
+	// past the end, leaving a gap of zeros
+	if _, err := f.WriteAt([]byte("end"), 30); err != nil {
+		t.Fatal(err)
+	}
+	want = append(append(want, make([]byte, 10)...), "end"...)
+	check("WriteAt past the end")
+
+	if err := f.Truncate(10); err != nil {
+		t.Fatal(err)
+	}
+	want = want[:10]
+	check("Truncate")
+	if err := f.Truncate(17); err != nil {
+		t.Fatal(err)
+	}
+	want = append(want, make([]byte, 7)...)
+	check("growing Truncate")
+
+	fi, err := f.Stat()
+	if err != nil || fi.Size() != 17 {
+		t.Errorf("Stat = %v, %v, want size 17", fi, err)
+	}
+}
+
+func TestAppend(t *testing.T) {
+	cfs := newFs(t, afero.NewMemMapFs(), WithChunkSize(4))
+	afero.WriteFile(cfs, "/file", []byte("hello"), 0o644)
+	f, err := cfs.OpenFile("/file", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(" world")
+	if _, err := f.Read(make([]byte, 1)); err == nil {
+		t.Error("Read of a write-only file succeeded")
+	}
+	f.Close()
+	if got, err := afero.ReadFile(cfs, "/file"); err != nil || string(got) != "hello world" {
+		t.Errorf("ReadFile = %q, %v", got, err)
+	}
+}
+
+func TestTampering(t *testing.T) {
+	base := afero.NewMemMapFs()
+	cfs := newFs(t, base, WithChunkSize(8))
+	afero.WriteFile(cfs, "/file", []byte("0123456789abcdefghij"), 0o644)
+	raw, _ := afero.ReadFile(base, "/file")
+
+	flipped := append([]byte(nil), raw...)
+	flipped[headerSize+20] ^= 1
+	afero.WriteFile(base, "/flipped", flipped, 0o644)
+	if _, err := afero.ReadFile(cfs, "/flipped"); !errors.Is(err, ErrAuthentication) {
+		t.Errorf("modified chunk: err = %v, want ErrAuthentication", err)
+	}
+
+	// drop the last chunk
+	afero.WriteFile(base, "/truncated", raw[:headerSize+2*(8+12+16)], 0o644)
+	if _, err := afero.ReadFile(cfs, "/truncated"); !errors.Is(err, ErrAuthentication) {
+		t.Errorf("dropped chunk: err = %v, want ErrAuthentication", err)
+	}
+
+	other, err := New(base, bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := afero.ReadFile(other, "/file"); !errors.Is(err, ErrAuthentication) {
+		t.Errorf("wrong key: err = %v, want ErrAuthentication", err)
+	}
+
+	afero.WriteFile(base, "/plain", []byte("not encrypted at all, but long enough"), 0o644)
+	if _, err := cfs.Open("/plain"); !errors.Is(err, ErrNotEncrypted) {
+		t.Errorf("plain file: err = %v, want ErrNotEncrypted", err)
+	}
+
+	if _, err := New(base, []byte("short")); err != ErrKeySize {
+		t.Errorf("New with a short key: err = %v, want ErrKeySize", err)
+	}
+}
+
+func TestNameEncryption(t *testing.T) {
+	base := afero.NewMemMapFs()
+	cfs := newFs(t, base, WithNameEncryption())
+	if err := cfs.MkdirAll("/docs/private", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	afero.WriteFile(cfs, "/docs/private/notes.txt", []byte("notes"), 0o644)
+	if err := cfs.Rename("/docs/private/notes.txt", "/docs/notes.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	afero.Walk(base, "/", func(path string, _ os.FileInfo, _ error) error {
+		for _, name := range []string{"docs", "private", "notes"} {
+			if bytes.Contains([]byte(path), []byte(name)) {
+				t.Errorf("the base Fs has the plaintext name %s", path)
+			}
+		}
+		return nil
+	})
+	afero.WriteFile(base, "/"+cfs.encryptName("docs")+"/foreign", nil, 0o644)
+
+	names, err := afero.ReadDir(cfs, "/docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, fi := range names {
+		got = append(got, fi.Name())
+	}
+	if len(got) != 2 || got[0] != "notes.txt" || got[1] != "private" {
+		t.Errorf("ReadDir = %v, want [notes.txt private]", got)
+	}
+	if data, err := afero.ReadFile(cfs, "/docs/notes.txt"); err != nil || string(data) != "notes" {
+		t.Errorf("ReadFile = %q, %v", data, err)
+	}
+	if fi, err := cfs.Stat("/docs/notes.txt"); err != nil || fi.Name() != "notes.txt" || fi.Size() != 5 {
+		t.Errorf("Stat = %v, %v", fi, err)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	newFs := func(t *testing.T) afero.Fs {
+		fs, err := New(afero.NewMemMapFs(), make([]byte, 32))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fs
+	}
+	aferotest.Conformance(t, newFs, afero.Capabilities(newFs(t)))
+}
@@ -0,0 +1,453 @@
+package cryptfs
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"os"
+	"sync"
+	"syscall"
+
+	"github.com/spf13/afero"
+)
+
+// header is the header of an encrypted file, see the package documentation.
+type header struct {
+	raw       []byte
+	cipher    Cipher
+	chunkSize int
+}
+
+func newHeader(c Cipher, chunkSize int) (*header, error) {
+	raw := make([]byte, headerSize)
+	copy(raw, magic)
+	raw[len(magic)] = byte(c)
+	binary.BigEndian.PutUint32(raw[len(magic)+1:], uint32(chunkSize))
+	if _, err := rand.Read(raw[len(magic)+5:]); err != nil {
+		return nil, err
+	}
+	return &header{raw: raw, cipher: c, chunkSize: chunkSize}, nil
+}
+
+func parseHeader(raw []byte) (*header, error) {
+	h := &header{
+		raw:       raw,
+		cipher:    Cipher(raw[len(magic)]),
+		chunkSize: int(binary.BigEndian.Uint32(raw[len(magic)+1:])),
+	}
+	if !bytes.HasPrefix(raw, []byte(magic)) || h.overhead() == 0 || h.chunkSize == 0 {
+		return nil, ErrNotEncrypted
+	}
+	return h, nil
+}
+
+// overhead returns the number of bytes a chunk takes on top of its
+// plaintext, or 0 for an unknown cipher.
+func (h *header) overhead() int {
+	switch h.cipher {
+	case AES256GCM:
+		return 12 + tagSize
+	case XChaCha20Poly1305:
+		return 24 + tagSize
+	}
+	return 0
+}
+
+// plainSize returns the size of the content of a file of size bytes.
+func (h *header) plainSize(size int64) int64 {
+	stored := int64(h.chunkSize + h.overhead())
+	payload := size - headerSize
+	res := payload / stored * int64(h.chunkSize)
+	if rest := payload % stored; rest > int64(h.overhead()) {
+		res += rest - int64(h.overhead())
+	}
+	return res
+}
+
+// File is a regular file of an Fs.
+type File struct {
+	fs   *Fs
+	base afero.File
+	name string
+	flag int
+
+	mu     sync.Mutex
+	h      *header // nil for an empty file until it is written
+	aead   cipher.AEAD
+	size   int64
+	offset int64
+}
+
+func newFile(fs *Fs, base afero.File, name string, flag int, size int64) (*File, error) {
+	f := &File{fs: fs, base: base, name: name, flag: flag}
+	h, err := readHeader(base)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+	if h != nil {
+		if err := f.setHeader(h); err != nil {
+			return nil, err
+		}
+		f.size = h.plainSize(size)
+	}
+	return f, nil
+}
+
+func (f *File) setHeader(h *header) error {
+	aead, err := newAEAD(h.cipher, f.fs.contentKey)
+	if err != nil {
+		return &os.PathError{Op: "open", Path: f.name, Err: err}
+	}
+	f.h, f.aead = h, aead
+	return nil
+}
+
+func (f *File) readable() bool {
+	return f.flag&(os.O_WRONLY|os.O_RDWR) != os.O_WRONLY
+}
+
+func (f *File) writable() bool {
+	return f.flag&(os.O_WRONLY|os.O_RDWR) != 0
+}
+
+// lastChunk returns the index of the last chunk of a file of size bytes, -1
+// if it is empty.
+func (f *File) lastChunk(size int64) int64 {
+	if size == 0 {
+		return -1
+	}
+	return (size - 1) / int64(f.h.chunkSize)
+}
+
+func (f *File) chunkOffset(i int64) int64 {
+	return headerSize + i*int64(f.h.chunkSize+f.h.overhead())
+}
+
+func (f *File) additionalData(i int64, last bool) []byte {
+	ad := make([]byte, headerSize+9)
+	copy(ad, f.h.raw)
+	binary.BigEndian.PutUint64(ad[headerSize:], uint64(i))
+	if last {
+		ad[headerSize+8] = 1
+	}
+	return ad
+}
+
+// readChunk returns the plaintext of chunk i of the file of size bytes.
+func (f *File) readChunk(i, size int64) ([]byte, error) {
+	n := min(int64(f.h.chunkSize), size-i*int64(f.h.chunkSize))
+	buf := make([]byte, int(n)+f.h.overhead())
+	if read, err := f.base.ReadAt(buf, f.chunkOffset(i)); read < len(buf) {
+		if err == nil || err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, &os.PathError{Op: "read", Path: f.name, Err: err}
+	}
+	ns := f.aead.NonceSize()
+	plain, err := f.aead.Open(buf[ns:ns], buf[:ns], buf[ns:], f.additionalData(i, i == f.lastChunk(size)))
+	if err != nil {
+		return nil, &os.PathError{Op: "read", Path: f.name, Err: ErrAuthentication}
+	}
+	return plain, nil
+}
+
+// writeChunk encrypts plain with a new nonce and stores it as chunk i.
+func (f *File) writeChunk(i int64, plain []byte, last bool) error {
+	nonce := make([]byte, f.aead.NonceSize(), len(plain)+f.h.overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return &os.PathError{Op: "write", Path: f.name, Err: err}
+	}
+	sealed := f.aead.Seal(nonce, nonce, plain, f.additionalData(i, last))
+	_, err := f.base.WriteAt(sealed, f.chunkOffset(i))
+	return err
+}
+
+func (f *File) readAt(p []byte, off int64) (int, error) {
+	if !f.readable() {
+		return 0, &os.PathError{Op: "read", Path: f.name, Err: afero.BADFD}
+	}
+	if off < 0 {
+		return 0, &os.PathError{Op: "read", Path: f.name, Err: syscall.EINVAL}
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if off >= f.size {
+		return 0, io.EOF
+	}
+	cs := int64(f.h.chunkSize)
+	n := 0
+	for n < len(p) && off < f.size {
+		i := off / cs
+		plain, err := f.readChunk(i, f.size)
+		if err != nil {
+			return n, err
+		}
+		copied := copy(p[n:], plain[off-i*cs:])
+		n += copied
+		off += int64(copied)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// writeAt writes p at off. Growing the file, by writing past its end or
+// by Truncate with an empty p, fills the gap with zeros. Write and WriteAt
+// never pass an empty p.
+func (f *File) writeAt(p []byte, off int64) (int, error) {
+	if !f.writable() {
+		return 0, &os.PathError{Op: "write", Path: f.name, Err: afero.BADFD}
+	}
+	if off < 0 {
+		return 0, &os.PathError{Op: "write", Path: f.name, Err: syscall.EINVAL}
+	}
+	end := off + int64(len(p))
+	if end <= f.size && len(p) == 0 {
+		return 0, nil
+	}
+	if f.h == nil {
+		h, err := newHeader(f.fs.cipher, f.fs.chunkSize)
+		if err == nil {
+			err = f.setHeader(h)
+		}
+		if err == nil {
+			_, err = f.base.WriteAt(h.raw, 0)
+		}
+		if err != nil {
+			f.h = nil
+			return 0, err
+		}
+	}
+
+	cs := int64(f.h.chunkSize)
+	oldSize, newSize := f.size, max(f.size, end)
+	oldLast, newLast := f.lastChunk(oldSize), f.lastChunk(newSize)
+	first, last := off/cs, (end-1)/cs
+	if newSize > oldSize {
+		// the gap is zeroed and the old last chunk loses its last flag
+		first = min(first, max(oldLast, 0))
+		last = newLast
+	}
+	for i := first; i <= last; i++ {
+		start := i * cs
+		n := min(cs, newSize-start)
+		plain := make([]byte, n)
+		from, to := max(off, start), min(end, start+n)
+		if i <= oldLast && (from > start || to < start+n) {
+			old, err := f.readChunk(i, oldSize)
+			if err != nil {
+				return 0, err
+			}
+			copy(plain, old)
+		}
+		if from < to {
+			copy(plain[from-start:], p[from-off:to-off])
+		}
+		if err := f.writeChunk(i, plain, i == newLast); err != nil {
+			return 0, err
+		}
+	}
+	f.size = newSize
+	return len(p), nil
+}
+
+func (f *File) Name() string {
+	return f.name
+}
+
+func (f *File) Close() error {
+	return f.base.Close()
+}
+
+func (f *File) Read(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n, err := f.readAt(p, f.offset)
+	f.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (f *File) ReadAt(p []byte, off int64) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.readAt(p, off)
+}
+
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.size
+	}
+	if offset < 0 {
+		return 0, &os.PathError{Op: "seek", Path: f.name, Err: syscall.EINVAL}
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *File) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.flag&os.O_APPEND != 0 {
+		f.offset = f.size
+	}
+	n, err := f.writeAt(p, f.offset)
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *File) WriteAt(p []byte, off int64) (int, error) {
+	if f.flag&os.O_APPEND != 0 {
+		return 0, &os.PathError{Op: "writeat", Path: f.name, Err: syscall.EINVAL}
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.writeAt(p, off)
+}
+
+func (f *File) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *File) Readdir(int) ([]os.FileInfo, error) {
+	return nil, &os.PathError{Op: "readdir", Path: f.name, Err: syscall.ENOTDIR}
+}
+
+func (f *File) Readdirnames(int) ([]string, error) {
+	return nil, &os.PathError{Op: "readdirnames", Path: f.name, Err: syscall.ENOTDIR}
+}
+
+func (f *File) Stat() (os.FileInfo, error) {
+	fi, err := f.base.Stat()
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return &FileInfo{FileInfo: fi, name: afero.Base(f.fs, f.name), size: f.size}, nil
+}
+
+func (f *File) Sync() error {
+	return f.base.Sync()
+}
+
+// Truncate changes the size of the file. Only the new last chunk is
+// rewritten when shrinking; growing writes encrypted zeros.
+func (f *File) Truncate(size int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.writable() {
+		return &os.PathError{Op: "truncate", Path: f.name, Err: afero.BADFD}
+	}
+	switch {
+	case size < 0:
+		return &os.PathError{Op: "truncate", Path: f.name, Err: syscall.EINVAL}
+	case size >= f.size:
+		_, err := f.writeAt(nil, size)
+		return err
+	case size == 0:
+		if err := f.base.Truncate(0); err != nil {
+			return err
+		}
+		f.h, f.aead, f.size = nil, nil, 0
+		return nil
+	}
+	last := f.lastChunk(size)
+	plain, err := f.readChunk(last, f.size)
+	if err != nil {
+		return err
+	}
+	plain = plain[:size-last*int64(f.h.chunkSize)]
+	if err := f.writeChunk(last, plain, true); err != nil {
+		return err
+	}
+	if err := f.base.Truncate(f.chunkOffset(last) + int64(len(plain)+f.h.overhead())); err != nil {
+		return err
+	}
+	f.size = size
+	return nil
+}
+
+// Dir is a directory of an Fs. Readdir reports the plaintext names and
+// sizes of the files.
+type Dir struct {
+	afero.File
+	fs   *Fs
+	name string
+}
+
+func (d *Dir) Name() string {
+	return d.name
+}
+
+func (d *Dir) Readdir(count int) ([]os.FileInfo, error) {
+	for {
+		fis, err := d.File.Readdir(count)
+		res := fis[:0]
+		for _, fi := range fis {
+			name, ok := d.fs.decryptElem(fi.Name())
+			if !ok {
+				continue
+			}
+			fi, err := d.fs.fileInfo(name, afero.Join(d.fs, d.File.Name(), fi.Name()), fi)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, fi)
+		}
+		// skipping all the entries of a batch must not look like the end
+		if len(res) > 0 || len(fis) == 0 || count <= 0 || err != nil {
+			return res, err
+		}
+	}
+}
+
+func (d *Dir) Readdirnames(n int) ([]string, error) {
+	fis, err := d.Readdir(n)
+	names := make([]string, len(fis))
+	for i, fi := range fis {
+		names[i] = fi.Name()
+	}
+	return names, err
+}
+
+func (d *Dir) Stat() (os.FileInfo, error) {
+	fi, err := d.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return &FileInfo{FileInfo: fi, name: afero.Base(d.fs, d.name), size: fi.Size()}, nil
+}
+
+// FileInfo reports the plaintext name and size of a file, everything else
+// comes from the base Fs.
+type FileInfo struct {
+	os.FileInfo
+	name string
+	size int64
+}
+
+func (fi *FileInfo) Name() string {
+	return fi.name
+}
+
+func (fi *FileInfo) Size() int64 {
+	return fi.size
+}
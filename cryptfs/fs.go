@@ -0,0 +1,356 @@
+// Package cryptfs provides an afero.Fs that stores file contents, and
+// optionally file names, encrypted in a base Fs.
+//
+// # On-disk format
+//
+// An encrypted file starts with a 32 byte header:
+//
+//	"afcrypt"     7 bytes, the magic
+//	cipher        1 byte, 1 for AES-256-GCM, 2 for XChaCha20-Poly1305
+//	chunk size    4 bytes, big endian, the size of the plaintext chunks
+//	file id       20 random bytes
+//
+// followed by the content, split into chunks of chunk size bytes, the last
+// one possibly shorter. Every chunk is stored as
+//
+//	nonce         12 bytes (AES-256-GCM) or 24 bytes (XChaCha20-Poly1305),
+//	              random, renewed every time the chunk is written
+//	ciphertext    as long as the plaintext chunk
+//	tag           16 bytes
+//
+// with the header, the index of the chunk as 8 bytes big endian and a byte,
+// 1 for the last chunk and 0 otherwise, as additional data. Chunks can thus
+// neither be moved within a file nor to another file, and dropping chunks
+// from the end of a file is detected. An empty file may be stored without a
+// header.
+//
+// Content keys are derived from the key passed to New with HMAC-SHA256, so
+// that the key is never used directly. Only the content is encrypted: the
+// directory structure, permissions, times and the approximate size of files
+// are visible in the base Fs.
+//
+// With WithNameEncryption, every element of a path is encrypted on its own
+// with AES-256-GCM, using the first 12 bytes of its HMAC-SHA256 as nonce,
+// and encoded with unpadded base64url. Names are thus deterministic: equal
+// names encrypt to the same string wherever they are, which is what lets
+// files be looked up, but leaks which names are equal. Encrypted names are
+// about 4/3 of the plaintext length plus 38 bytes, which limits the length
+// of names on file systems restricting it.
+package cryptfs
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/chacha20poly1305"
+
+	"github.com/spf13/afero"
+)
+
+// Cipher is the AEAD the content of files is encrypted with.
+type Cipher byte
+
+const (
+	AES256GCM         Cipher = 1
+	XChaCha20Poly1305 Cipher = 2
+)
+
+const (
+	magic      = "afcrypt"
+	headerSize = 32
+	tagSize    = 16
+
+	// DefaultChunkSize is the size of the plaintext chunks of new files,
+	// unless set with WithChunkSize.
+	DefaultChunkSize = 4096
+)
+
+var (
+	// ErrKeySize is returned by New if the key is not 16, 24 or 32 bytes.
+	ErrKeySize = errors.New("invalid key size")
+
+	// ErrNotEncrypted is wrapped in an os.PathError when a file of the base
+	// Fs has no valid header.
+	ErrNotEncrypted = errors.New("not an encrypted file")
+
+	// ErrAuthentication is wrapped in an os.PathError when a chunk of a file
+	// fails to decrypt, because it was modified or the key is wrong.
+	ErrAuthentication = errors.New("message authentication failed")
+)
+
+// Fs encrypts the content of files when writing them to the base Fs and
+// decrypts it when reading. Files are accessed chunk by chunk, so ReadAt,
+// WriteAt and Seek do not need to process whole files. Directories,
+// permissions and times are those of the base Fs; FileInfo sizes are
+// plaintext sizes.
+type Fs struct {
+	base afero.Fs
+
+	cipher    Cipher
+	chunkSize int
+	names     bool
+
+	contentKey []byte
+	nameAEAD   cipher.AEAD
+	nameIVKey  []byte
+}
+
+// Option configures an Fs created by New.
+type Option func(*Fs)
+
+// WithCipher sets the cipher new files are encrypted with, the default is
+// AES256GCM. Existing files are read with the cipher in their header.
+func WithCipher(c Cipher) Option {
+	return func(fs *Fs) {
+		fs.cipher = c
+	}
+}
+
+// WithChunkSize sets the size of the plaintext chunks of new files, the
+// default is DefaultChunkSize. Larger chunks have less overhead, smaller
+// ones make small reads and writes cheaper.
+func WithChunkSize(size int) Option {
+	return func(fs *Fs) {
+		if size > 0 {
+			fs.chunkSize = size
+		}
+	}
+}
+
+// WithNameEncryption encrypts the names of files and directories as well.
+// All the names in the base Fs must then be encrypted: entries failing to
+// decrypt are left out of directory listings.
+func WithNameEncryption() Option {
+	return func(fs *Fs) {
+		fs.names = true
+	}
+}
+
+// New returns an Fs encrypting files in base with key, which must be 16,
+// 24 or 32 bytes long. Keep it secret: anyone knowing it can decrypt the
+// files.
+func New(base afero.Fs, key []byte, opts ...Option) (*Fs, error) {
+	switch len(key) {
+	case 16, 24, 32:
+	default:
+		return nil, ErrKeySize
+	}
+	fs := &Fs{
+		base:       base,
+		cipher:     AES256GCM,
+		chunkSize:  DefaultChunkSize,
+		contentKey: deriveKey(key, "afero cryptfs content"),
+		nameIVKey:  deriveKey(key, "afero cryptfs name iv"),
+	}
+	for _, opt := range opts {
+		opt(fs)
+	}
+	if _, err := newAEAD(fs.cipher, fs.contentKey); err != nil {
+		return nil, err
+	}
+	// a 32 byte key is always valid for AES
+	block, _ := aes.NewCipher(deriveKey(key, "afero cryptfs names"))
+	fs.nameAEAD, _ = cipher.NewGCM(block)
+	return fs, nil
+}
+
+func deriveKey(key []byte, label string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(label))
+	return mac.Sum(nil)
+}
+
+func newAEAD(c Cipher, key []byte) (cipher.AEAD, error) {
+	switch c {
+	case AES256GCM:
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	case XChaCha20Poly1305:
+		return chacha20poly1305.NewX(key)
+	}
+	return nil, errors.New("unknown cipher")
+}
+
+// encryptName returns the name of the base Fs storing the file name.
+func (fs *Fs) encryptName(name string) string {
+	if !fs.names {
+		return name
+	}
+	sep := afero.PathSeparatorOf(fs)
+	elems := strings.Split(afero.Clean(fs, name), sep)
+	for i, elem := range elems {
+		if elem == "" || elem == "." || elem == ".." {
+			continue
+		}
+		mac := hmac.New(sha256.New, fs.nameIVKey)
+		mac.Write([]byte(elem))
+		nonce := mac.Sum(nil)[:fs.nameAEAD.NonceSize()]
+		sealed := fs.nameAEAD.Seal(nonce, nonce, []byte(elem), nil)
+		elems[i] = base64.RawURLEncoding.EncodeToString(sealed)
+	}
+	return strings.Join(elems, sep)
+}
+
+// decryptElem returns the plaintext of an encrypted path element.
+func (fs *Fs) decryptElem(elem string) (string, bool) {
+	if !fs.names {
+		return elem, true
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(elem)
+	n := fs.nameAEAD.NonceSize()
+	if err != nil || len(sealed) < n {
+		return "", false
+	}
+	plain, err := fs.nameAEAD.Open(nil, sealed[:n], sealed[n:], nil)
+	if err != nil {
+		return "", false
+	}
+	return string(plain), true
+}
+
+// readHeader reads the header of the base file f.
+func readHeader(f afero.File) (*header, error) {
+	buf := make([]byte, headerSize)
+	n, err := f.ReadAt(buf, 0)
+	switch {
+	case n == 0 && err == io.EOF:
+		return nil, nil
+	case n < headerSize:
+		if err == nil || err == io.EOF {
+			err = ErrNotEncrypted
+		}
+		return nil, err
+	}
+	return parseHeader(buf)
+}
+
+// plainSize returns the size of the content of the named file in the base
+// Fs, of size bytes.
+func (fs *Fs) plainSize(name string, size int64) (int64, error) {
+	if size == 0 {
+		return 0, nil
+	}
+	f, err := fs.base.Open(name)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	h, err := readHeader(f)
+	if err != nil {
+		return 0, &os.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return h.plainSize(size), nil
+}
+
+// fileInfo reports the plaintext name and size of the file stored as name.
+func (fs *Fs) fileInfo(plainName, name string, fi os.FileInfo) (os.FileInfo, error) {
+	res := &FileInfo{FileInfo: fi, name: plainName, size: fi.Size()}
+	if fi.Mode().IsRegular() {
+		size, err := fs.plainSize(name, fi.Size())
+		if err != nil {
+			return nil, err
+		}
+		res.size = size
+	}
+	return res, nil
+}
+
+func (fs *Fs) Name() string { return "CryptFs" }
+
+// Unwrap returns the base Fs, which holds the encrypted files.
+func (fs *Fs) Unwrap() afero.Fs {
+	return fs.base
+}
+
+func (fs *Fs) Create(name string) (afero.File, error) {
+	return fs.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o666)
+}
+
+func (fs *Fs) Open(name string) (afero.File, error) {
+	return fs.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (fs *Fs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	// Chunks are read back to modify them, so writable files must be
+	// readable in the base Fs; appending is done by File.
+	baseFlag := flag &^ os.O_APPEND
+	if flag&os.O_WRONLY != 0 {
+		baseFlag = baseFlag&^os.O_WRONLY | os.O_RDWR
+	}
+	bf, err := fs.base.OpenFile(fs.encryptName(name), baseFlag, perm)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := bf.Stat()
+	if err != nil {
+		bf.Close()
+		return nil, err
+	}
+	if fi.IsDir() {
+		return &Dir{File: bf, fs: fs, name: name}, nil
+	}
+	f, err := newFile(fs, bf, name, flag, fi.Size())
+	if err != nil {
+		bf.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+func (fs *Fs) Mkdir(name string, perm os.FileMode) error {
+	return fs.base.Mkdir(fs.encryptName(name), perm)
+}
+
+func (fs *Fs) MkdirAll(path string, perm os.FileMode) error {
+	return fs.base.MkdirAll(fs.encryptName(path), perm)
+}
+
+func (fs *Fs) Remove(name string) error {
+	return fs.base.Remove(fs.encryptName(name))
+}
+
+func (fs *Fs) RemoveAll(path string) error {
+	return fs.base.RemoveAll(fs.encryptName(path))
+}
+
+// Rename renames a file. The content does not depend on the name, so it is
+// not rewritten.
+func (fs *Fs) Rename(oldname, newname string) error {
+	return fs.base.Rename(fs.encryptName(oldname), fs.encryptName(newname))
+}
+
+func (fs *Fs) Stat(name string) (os.FileInfo, error) {
+	encrypted := fs.encryptName(name)
+	fi, err := fs.base.Stat(encrypted)
+	if err != nil {
+		return nil, err
+	}
+	plainName := afero.Base(fs, name)
+	if !fs.names {
+		plainName = fi.Name()
+	}
+	return fs.fileInfo(plainName, encrypted, fi)
+}
+
+func (fs *Fs) Chmod(name string, mode os.FileMode) error {
+	return fs.base.Chmod(fs.encryptName(name), mode)
+}
+
+func (fs *Fs) Chown(name string, uid, gid int) error {
+	return fs.base.Chown(fs.encryptName(name), uid, gid)
+}
+
+func (fs *Fs) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	return fs.base.Chtimes(fs.encryptName(name), atime, mtime)
+}
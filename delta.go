@@ -0,0 +1,66 @@
+package afero
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+)
+
+// defaultDeltaBlockSize is the block size of delta copies.
+const defaultDeltaBlockSize = 64 << 10
+
+// deltaCopy updates the existing file dst of dstFs in place to the contents
+// of in, comparing the two in blocks of size bytes at the same offsets and
+// writing only the blocks which differ, then truncating dst to the size of
+// in. Appending to or changing a part of a file only rewrites the blocks
+// around the change, but inserting into it rewrites everything behind the
+// insertion.
+//
+// deltaCopy reports false if dst cannot be opened for reading and writing
+// or the file does not support ranged writes; in may have been read then,
+// and the caller has to copy the whole file instead.
+func deltaCopy(dstFs Fs, dst string, in File, size int) (bool, error) {
+	out, err := dstFs.OpenFile(dst, os.O_RDWR, 0)
+	if err != nil {
+		return false, nil
+	}
+	src, old := make([]byte, size), make([]byte, size)
+	var off int64
+	for {
+		n, err := io.ReadFull(in, src)
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			out.Close()
+			return false, err
+		}
+		m, err := out.ReadAt(old[:n], off)
+		if err != nil && err != io.EOF {
+			out.Close()
+			if off == 0 {
+				return false, nil
+			}
+			return false, err
+		}
+		if m != n || !bytes.Equal(src[:n], old[:n]) {
+			if _, err := out.WriteAt(src[:n], off); err != nil {
+				out.Close()
+				if errors.Is(err, errors.ErrUnsupported) {
+					return false, nil
+				}
+				return false, err
+			}
+		}
+		off += int64(n)
+	}
+	if err := out.Truncate(off); err != nil {
+		out.Close()
+		if errors.Is(err, errors.ErrUnsupported) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, out.Close()
+}
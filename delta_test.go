@@ -0,0 +1,112 @@
+package afero
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"os"
+	"testing"
+)
+
+// noWriteAtFs returns files which do not support ranged writes.
+type noWriteAtFs struct {
+	Fs
+}
+
+func (fs noWriteAtFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	f, err := fs.Fs.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return noWriteAtFile{f}, nil
+}
+
+type noWriteAtFile struct {
+	File
+}
+
+func (f noWriteAtFile) WriteAt([]byte, int64) (int, error) {
+	return 0, errors.ErrUnsupported
+}
+
+func TestSyncDelta(t *testing.T) {
+	src, base := NewMemMapFs(), NewMemMapFs()
+	data := make([]byte, 1<<20)
+	rand.New(rand.NewSource(1)).Read(data)
+	if err := WriteFile(src, "/src/big.bin", data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var written int64
+	dst := NewInstrumentedFs(base, Hooks{After: func(ev *InstrumentEvent) {
+		if ev.Op == "File.Write" || ev.Op == "File.WriteAt" {
+			written += ev.Bytes
+		}
+	}})
+	opts := SyncOptions{SrcDir: "/src", DstDir: "/dst", Compare: SyncHash, Delta: true, DeltaBlockSize: 4096}
+
+	for _, tt := range []struct {
+		name   string
+		change func([]byte) []byte
+		max    int64
+	}{
+		{"new file", func(b []byte) []byte { return b }, 1 << 20},
+		{"append", func(b []byte) []byte { return append(b, make([]byte, 10000)...) }, 10000 + 4096},
+		{"overwrite", func(b []byte) []byte { copy(b[300000:], "changed"); return b }, 4096},
+		{"truncate", func(b []byte) []byte { return b[:700000] }, 0},
+	} {
+		data = tt.change(data)
+		if err := WriteFile(src, "/src/big.bin", data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		written = 0
+		if _, err := Sync(dst, src, opts); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got, _ := ReadFile(base, "/dst/big.bin"); !bytes.Equal(got, data) {
+			t.Fatalf("%s: the destination differs", tt.name)
+		}
+		if written > tt.max {
+			t.Errorf("%s: wrote %d bytes, want at most %d", tt.name, written, tt.max)
+		}
+	}
+
+	// without ranged writes the whole file is copied
+	data = append(data, "more"...)
+	if err := WriteFile(src, "/src/big.bin", data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Sync(noWriteAtFs{base}, src, opts); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ReadFile(base, "/dst/big.bin"); !bytes.Equal(got, data) {
+		t.Fatal("the destination differs without ranged writes")
+	}
+}
+
+func TestCopyDelta(t *testing.T) {
+	fs := NewMemMapFs()
+	data := make([]byte, 200000)
+	rand.New(rand.NewSource(1)).Read(data)
+	if err := WriteFile(fs, "/dst", data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	data = append(data, "appended"...)
+	if err := WriteFile(fs, "/src", data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var written int64
+	dst := NewInstrumentedFs(fs, Hooks{After: func(ev *InstrumentEvent) {
+		if ev.Op == "File.Write" || ev.Op == "File.WriteAt" {
+			written += ev.Bytes
+		}
+	}})
+	if err := CopyFile(dst, "/dst", fs, "/src", CopyDelta(4096)); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ReadFile(fs, "/dst"); !bytes.Equal(got, data) {
+		t.Fatal("the destination differs")
+	}
+	if written > 4096+8 {
+		t.Errorf("wrote %d bytes", written)
+	}
+}
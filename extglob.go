@@ -0,0 +1,286 @@
+package afero
+
+import (
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// ExtendedGlob is like Glob, but also supports the extended syntax of
+// ExtendedMatch: "**" for any number of directories, brace expansion and
+// POSIX character classes. The matches are sorted and unique.
+//
+// "**" does not follow symlinks to directories, so it cannot loop. Like
+// Glob, ExtendedGlob ignores file system errors and only returns
+// filepath.ErrBadPattern for malformed patterns.
+func ExtendedGlob(fs Fs, pattern string) ([]string, error) {
+	patterns, err := expandBraces(pattern)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var matches []string
+	for _, p := range patterns {
+		root, parts, err := splitExtPattern(p)
+		if err != nil {
+			return nil, err
+		}
+		globParts(fs, root, parts, func(name string) {
+			if !seen[name] {
+				seen[name] = true
+				matches = append(matches, name)
+			}
+		})
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// ExtendedMatch reports whether name matches the pattern. On top of the
+// syntax of filepath.Match it supports:
+//
+//	**          as a whole path element, zero or more path elements
+//	{a,b,c}     any of the comma separated alternatives, which may nest
+//	[!...]      the same as [^...]
+//	[[:alpha:]] POSIX character classes within brackets: alnum, alpha,
+//	            blank, digit, lower, space, upper and xdigit
+//
+// The only possible returned error is filepath.ErrBadPattern.
+func ExtendedMatch(pattern, name string) (bool, error) {
+	patterns, err := expandBraces(pattern)
+	if err != nil {
+		return false, err
+	}
+	names := strings.Split(name, string(filepath.Separator))
+	for _, p := range patterns {
+		root, parts, err := splitExtPattern(p)
+		if err != nil {
+			return false, err
+		}
+		if (root == string(filepath.Separator)) != filepath.IsAbs(name) {
+			continue
+		}
+		elems := names
+		if root == string(filepath.Separator) {
+			elems = names[1:]
+		}
+		if matchParts(parts, elems) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// escapes reports whether a backslash escapes the next character in
+// patterns, as it does in filepath.Match except on Windows.
+var escapes = runtime.GOOS != "windows"
+
+// expandBraces returns the patterns resulting from expanding all braces in
+// pattern. Braces within brackets or escaped are taken literally.
+func expandBraces(pattern string) ([]string, error) {
+	start, depth, inClass := -1, 0, false
+	var commas []int
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case c == '\\' && escapes:
+			i++
+		case inClass:
+			if c == ']' {
+				inClass = false
+			}
+		case c == '[':
+			inClass = true
+		case c == '{':
+			if depth == 0 {
+				start = i
+			}
+			depth++
+		case c == ',' && depth == 1:
+			commas = append(commas, i)
+		case c == '}':
+			if depth == 0 {
+				return nil, filepath.ErrBadPattern
+			}
+			depth--
+			if depth > 0 {
+				continue
+			}
+			var res []string
+			prev := start
+			for _, end := range append(commas, i) {
+				alts, err := expandBraces(pattern[:start] + pattern[prev+1:end] + pattern[i+1:])
+				if err != nil {
+					return nil, err
+				}
+				res = append(res, alts...)
+				prev = end
+			}
+			return res, nil
+		}
+	}
+	if depth > 0 {
+		return nil, filepath.ErrBadPattern
+	}
+	return []string{pattern}, nil
+}
+
+// posixClasses maps the POSIX character classes to filepath.Match ranges.
+var posixClasses = map[string]string{
+	"alnum":  "0-9A-Za-z",
+	"alpha":  "A-Za-z",
+	"blank":  " \t",
+	"digit":  "0-9",
+	"lower":  "a-z",
+	"space":  " \t\n\v\f\r",
+	"upper":  "A-Z",
+	"xdigit": "0-9A-Fa-f",
+}
+
+// translateClasses rewrites "[!" and POSIX classes within brackets of a
+// path element to the syntax of filepath.Match.
+func translateClasses(elem string) (string, error) {
+	if !strings.Contains(elem, "[") {
+		return elem, nil
+	}
+	var b strings.Builder
+	inClass := false
+	for i := 0; i < len(elem); i++ {
+		c := elem[i]
+		switch {
+		case c == '\\' && escapes && i+1 < len(elem):
+			b.WriteString(elem[i : i+2])
+			i++
+			continue
+		case !inClass && c == '[':
+			inClass = true
+			b.WriteByte(c)
+			if i+1 < len(elem) && elem[i+1] == '!' {
+				b.WriteByte('^')
+				i++
+			}
+			continue
+		case inClass && c == '[' && strings.HasPrefix(elem[i:], "[:"):
+			end := strings.Index(elem[i+2:], ":]")
+			if end < 0 {
+				return "", filepath.ErrBadPattern
+			}
+			ranges, ok := posixClasses[elem[i+2:i+2+end]]
+			if !ok {
+				return "", filepath.ErrBadPattern
+			}
+			b.WriteString(ranges)
+			i += end + 3
+			continue
+		case inClass && c == ']':
+			inClass = false
+		}
+		b.WriteByte(c)
+	}
+	return b.String(), nil
+}
+
+// splitExtPattern splits a brace-free pattern into the directory to start
+// from, "/" or ".", and its translated path elements, with repeated "**"
+// collapsed.
+func splitExtPattern(pattern string) (root string, parts []string, err error) {
+	root = "."
+	if strings.HasPrefix(pattern, string(filepath.Separator)) {
+		root = string(filepath.Separator)
+	}
+	for _, elem := range strings.Split(pattern, string(filepath.Separator)) {
+		if elem == "" || elem == "**" && len(parts) > 0 && parts[len(parts)-1] == "**" {
+			continue
+		}
+		if elem != "**" {
+			if elem, err = translateClasses(elem); err != nil {
+				return "", nil, err
+			}
+			if _, err := filepath.Match(elem, ""); err != nil {
+				return "", nil, err
+			}
+		}
+		parts = append(parts, elem)
+	}
+	return root, parts, nil
+}
+
+// globParts calls found for every name below dir matching parts.
+func globParts(fs Fs, dir string, parts []string, found func(string)) {
+	if len(parts) == 0 {
+		found(dir)
+		return
+	}
+	part, rest := parts[0], parts[1:]
+	if part == "**" {
+		globParts(fs, dir, rest, found)
+		names, _ := readDirNames(fs, dir)
+		for _, name := range names {
+			sub := filepath.Join(dir, name)
+			fi, err := lstatIfPossible(fs, sub)
+			switch {
+			case err != nil:
+			case fi.IsDir():
+				globParts(fs, sub, parts, found)
+			case len(rest) == 0:
+				// a trailing "**" matches files as well
+				found(sub)
+			}
+		}
+		return
+	}
+	if !hasMeta(part) {
+		if escapes {
+			part = unescape(part)
+		}
+		name := filepath.Join(dir, part)
+		if _, err := lstatIfPossible(fs, name); err == nil {
+			globParts(fs, name, rest, found)
+		}
+		return
+	}
+	names, _ := readDirNames(fs, dir)
+	for _, name := range names {
+		if ok, _ := filepath.Match(part, name); ok {
+			globParts(fs, filepath.Join(dir, name), rest, found)
+		}
+	}
+}
+
+// unescape removes the backslashes escaping characters in a pattern
+// element without other meta characters.
+func unescape(elem string) string {
+	if !strings.Contains(elem, `\`) {
+		return elem
+	}
+	var b strings.Builder
+	for i := 0; i < len(elem); i++ {
+		if elem[i] == '\\' && i+1 < len(elem) {
+			i++
+		}
+		b.WriteByte(elem[i])
+	}
+	return b.String()
+}
+
+// matchParts reports whether the path elements names match parts.
+func matchParts(parts, names []string) bool {
+	for len(parts) > 0 {
+		if parts[0] == "**" {
+			for i := 0; i <= len(names); i++ {
+				if matchParts(parts[1:], names[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(names) == 0 {
+			return false
+		}
+		if ok, _ := filepath.Match(parts[0], names[0]); !ok {
+			return false
+		}
+		parts, names = parts[1:], names[1:]
+	}
+	return len(names) == 0
+}
@@ -0,0 +1,86 @@
+package afero
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExtendedMatch(t *testing.T) {
+	for _, tt := range []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"**/*.go", "main.go", true},
+		{"**/*.go", "a/b/c.go", true},
+		{"a/**/c.go", "a/c.go", true},
+		{"a/**/c.go", "a/b/x/c.go", true},
+		{"a/**/c.go", "b/c.go", false},
+		{"a/**", "a/b/c", true},
+		{"*.{go,mod}", "go.mod", true},
+		{"*.{go,mod}", "go.sum", false},
+		{"{a,b{1,2}}/x", "b2/x", true},
+		{"{a,b{1,2}}/x", "b3/x", false},
+		{"[[:digit:]][!a]", "1b", true},
+		{"[[:digit:]][!a]", "1a", false},
+		{"[[:upper:]]*", "Readme", true},
+		{"/**/x", "/a/x", true},
+		{"/**/x", "a/x", false},
+	} {
+		pattern := filepath.FromSlash(tt.pattern)
+		name := filepath.FromSlash(tt.name)
+		got, err := ExtendedMatch(pattern, name)
+		if err != nil {
+			t.Errorf("ExtendedMatch(%q, %q): %v", pattern, name, err)
+		} else if got != tt.want {
+			t.Errorf("ExtendedMatch(%q, %q) = %v, want %v", pattern, name, got, tt.want)
+		}
+	}
+
+	for _, pattern := range []string{"{a,b", "a}", "[[:nope:]]", "[a"} {
+		if _, err := ExtendedMatch(pattern, "a"); err != filepath.ErrBadPattern {
+			t.Errorf("ExtendedMatch(%q) error = %v, want ErrBadPattern", pattern, err)
+		}
+	}
+}
+
+func TestExtendedGlob(t *testing.T) {
+	fs := NewMemMapFs()
+	for _, name := range []string{
+		"/src/main.go",
+		"/src/go.mod",
+		"/src/pkg/a/a.go",
+		"/src/pkg/a/a_test.go",
+		"/src/pkg/b/b.txt",
+		"/src/vendor/x/x.go",
+	} {
+		if err := WriteFile(fs, filepath.FromSlash(name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tt := range []struct {
+		pattern string
+		want    []string
+	}{
+		{"/src/**/*.go", []string{"/src/main.go", "/src/pkg/a/a.go", "/src/pkg/a/a_test.go", "/src/vendor/x/x.go"}},
+		{"/src/{pkg,vendor}/**/[!a]*.{go,txt}", []string{"/src/pkg/b/b.txt", "/src/vendor/x/x.go"}},
+		{"/src/**/**/go.mod", []string{"/src/go.mod"}},
+		{"/src/pkg/**", []string{"/src/pkg", "/src/pkg/a", "/src/pkg/a/a.go", "/src/pkg/a/a_test.go", "/src/pkg/b", "/src/pkg/b/b.txt"}},
+		{"/src/{main.go,main.go}", []string{"/src/main.go"}},
+		{"/nope/**", nil},
+	} {
+		got, err := ExtendedGlob(fs, filepath.FromSlash(tt.pattern))
+		if err != nil {
+			t.Errorf("ExtendedGlob(%q): %v", tt.pattern, err)
+			continue
+		}
+		var want []string
+		for _, name := range tt.want {
+			want = append(want, filepath.FromSlash(name))
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("ExtendedGlob(%q) = %q, want %q", tt.pattern, got, want)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package faultfs
+
+import (
+	"errors"
+	"io"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+func TestNthWriteFails(t *testing.T) {
+	fs := New(afero.NewMemMapFs())
+	fs.Inject(Fault{Op: "File.Write", Nth: 3, Err: syscall.ENOSPC})
+
+	f, err := fs.Create("/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for i := 1; i <= 4; i++ {
+		_, err := f.Write([]byte("x"))
+		if i == 3 {
+			var pe *os.PathError
+			if !errors.As(err, &pe) || !errors.Is(err, syscall.ENOSPC) {
+				t.Errorf("write %d = %v, want ENOSPC", i, err)
+			}
+		} else if err != nil {
+			t.Errorf("write %d = %v", i, err)
+		}
+	}
+	if data, _ := afero.ReadFile(fs, "/a"); string(data) != "xxx" {
+		t.Errorf("content = %q, want %q", data, "xxx")
+	}
+}
+
+func TestRenameAndReset(t *testing.T) {
+	fs := New(afero.NewMemMapFs())
+	afero.WriteFile(fs, "/a", nil, 0o644)
+	fs.Inject(Fault{Op: "Rename", Path: "/a*", Err: syscall.EXDEV})
+
+	err := fs.Rename("/a", "/b")
+	var le *os.LinkError
+	if !errors.As(err, &le) || !errors.Is(err, syscall.EXDEV) {
+		t.Fatalf("Rename = %v, want EXDEV", err)
+	}
+	fs.Reset()
+	if err := fs.Rename("/a", "/b"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestShortReadsAndWrites(t *testing.T) {
+	fs := New(afero.NewMemMapFs())
+	fs.Inject(Fault{Op: "File.Read", Short: 2})
+	fs.Inject(Fault{Op: "File.Write", Path: "/short", Short: 3})
+
+	afero.WriteFile(fs, "/a", []byte("hello"), 0o644)
+	f, err := fs.Open("/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 10)
+	if n, err := f.Read(buf); n != 2 || err != nil {
+		t.Errorf("Read = %d, %v, want 2 bytes", n, err)
+	}
+	f.Close()
+	if data, err := afero.ReadFile(fs, "/a"); string(data) != "hello" {
+		t.Errorf("ReadFile = %q, %v", data, err)
+	}
+
+	f, err = fs.Create("/short")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := f.Write([]byte("hello")); n != 3 || err != io.ErrShortWrite {
+		t.Errorf("Write = %d, %v, want 3, io.ErrShortWrite", n, err)
+	}
+	f.Close()
+}
+
+func TestLatency(t *testing.T) {
+	fs := New(afero.NewMemMapFs())
+	fs.Inject(Fault{Op: "Stat", Latency: 20 * time.Millisecond})
+
+	start := time.Now()
+	fs.Stat("/")
+	if d := time.Since(start); d < 20*time.Millisecond {
+		t.Errorf("Stat took %v, want at least 20ms", d)
+	}
+}
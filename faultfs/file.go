@@ -0,0 +1,116 @@
+package faultfs
+
+import (
+	"io"
+	"os"
+
+	"github.com/spf13/afero"
+)
+
+// File is a file opened from a Fs.
+type File struct {
+	afero.File
+	fs   *Fs
+	name string
+}
+
+func (f *File) check(op, osOp string) error {
+	return f.fs.check("File."+op, osOp, f.name)
+}
+
+func (f *File) Close() error {
+	if err := f.check("Close", "close"); err != nil {
+		return err
+	}
+	return f.File.Close()
+}
+
+func (f *File) Read(p []byte) (int, error) {
+	fault := f.fs.fault("File.Read", f.name)
+	if fault.Err != nil {
+		return 0, &os.PathError{Op: "read", Path: f.name, Err: fault.Err}
+	}
+	if fault.Short > 0 && len(p) > fault.Short {
+		p = p[:fault.Short]
+	}
+	return f.File.Read(p)
+}
+
+func (f *File) ReadAt(p []byte, off int64) (int, error) {
+	if err := f.check("ReadAt", "read"); err != nil {
+		return 0, err
+	}
+	return f.File.ReadAt(p, off)
+}
+
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	if err := f.check("Seek", "seek"); err != nil {
+		return 0, err
+	}
+	return f.File.Seek(offset, whence)
+}
+
+// write calls fn with p, cut to the injected Short, if any.
+func (f *File) write(op string, p []byte, fn func([]byte) (int, error)) (int, error) {
+	fault := f.fs.fault("File."+op, f.name)
+	if fault.Err != nil {
+		return 0, &os.PathError{Op: "write", Path: f.name, Err: fault.Err}
+	}
+	if fault.Short > 0 && len(p) > fault.Short {
+		n, err := fn(p[:fault.Short])
+		if err == nil {
+			err = io.ErrShortWrite
+		}
+		return n, err
+	}
+	return fn(p)
+}
+
+func (f *File) Write(p []byte) (int, error) {
+	return f.write("Write", p, f.File.Write)
+}
+
+func (f *File) WriteAt(p []byte, off int64) (int, error) {
+	return f.write("WriteAt", p, func(p []byte) (int, error) {
+		return f.File.WriteAt(p, off)
+	})
+}
+
+func (f *File) WriteString(s string) (int, error) {
+	return f.write("WriteString", []byte(s), f.File.Write)
+}
+
+func (f *File) Readdir(count int) ([]os.FileInfo, error) {
+	if err := f.check("Readdir", "readdir"); err != nil {
+		return nil, err
+	}
+	return f.File.Readdir(count)
+}
+
+func (f *File) Readdirnames(n int) ([]string, error) {
+	if err := f.check("Readdirnames", "readdir"); err != nil {
+		return nil, err
+	}
+	return f.File.Readdirnames(n)
+}
+
+func (f *File) Stat() (os.FileInfo, error) {
+	if err := f.check("Stat", "stat"); err != nil {
+		return nil, err
+	}
+	return f.File.Stat()
+}
+
+func (f *File) Sync() error {
+	if err := f.check("Sync", "sync"); err != nil {
+		return err
+	}
+	return f.File.Sync()
+}
+
+func (f *File) Truncate(size int64) error {
+	if err := f.check("Truncate", "truncate"); err != nil {
+		return err
+	}
+	return f.File.Truncate(size)
+}
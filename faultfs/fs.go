@@ -0,0 +1,266 @@
+// Package faultfs provides an afero.Fs wrapper on which tests can program
+// failures, latency and short reads and writes.
+package faultfs
+
+import (
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// Fault describes a failure injected into the calls it matches.
+type Fault struct {
+	// Op is the name of the method to match, e.g. "Rename" or "OpenFile".
+	// Methods of files are prefixed with "File.", e.g. "File.Write". An
+	// empty Op matches every call.
+	Op string
+	// Path is a path.Match pattern for the name the call is about, for
+	// files the name they were opened with. An empty Path matches all.
+	Path string
+	// Nth makes only the Nth matching call fail, counting from 1. If it is
+	// 0, every matching call fails.
+	Nth int
+
+	// Err is returned instead of making the call, wrapped in an
+	// *os.PathError, or an *os.LinkError for Rename, Symlink and Link.
+	Err error
+	// Latency delays the call.
+	Latency time.Duration
+	// Short limits File.Read, File.Write, File.WriteAt and File.WriteString
+	// to at most this many bytes. Short writes return io.ErrShortWrite.
+	Short int
+}
+
+type rule struct {
+	Fault
+	calls int
+}
+
+// Fs passes all calls to its source Fs, unless they match one of the
+// injected faults.
+type Fs struct {
+	source afero.Fs
+
+	mu    sync.Mutex
+	rules []*rule
+}
+
+var (
+	_ afero.Lstater    = (*Fs)(nil)
+	_ afero.Symlinker  = (*Fs)(nil)
+	_ afero.HardLinker = (*Fs)(nil)
+)
+
+// New returns a Fs without faults passing all calls to source.
+func New(source afero.Fs) *Fs {
+	return &Fs{source: source}
+}
+
+// Inject adds a fault. All faults matching a call apply: their latencies
+// add up, the first error is returned and the smallest Short is used.
+func (fs *Fs) Inject(f Fault) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.rules = append(fs.rules, &rule{Fault: f})
+}
+
+// Reset removes all faults.
+func (fs *Fs) Reset() {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.rules = nil
+}
+
+// fault returns the combined faults for a call of op on name, after
+// sleeping for their latency.
+func (fs *Fs) fault(op, name string) Fault {
+	var res Fault
+	fs.mu.Lock()
+	for _, r := range fs.rules {
+		if r.Op != "" && r.Op != op {
+			continue
+		}
+		if r.Path != "" {
+			if ok, _ := path.Match(r.Path, name); !ok {
+				continue
+			}
+		}
+		r.calls++
+		if r.Nth > 0 && r.calls != r.Nth {
+			continue
+		}
+		res.Latency += r.Latency
+		if res.Err == nil {
+			res.Err = r.Err
+		}
+		if r.Short > 0 && (res.Short == 0 || r.Short < res.Short) {
+			res.Short = r.Short
+		}
+	}
+	fs.mu.Unlock()
+	if res.Latency > 0 {
+		time.Sleep(res.Latency)
+	}
+	return res
+}
+
+// check returns the injected error for a call of op on name, if any, as
+// an *os.PathError with the given os operation.
+func (fs *Fs) check(op, osOp, name string) error {
+	if f := fs.fault(op, name); f.Err != nil {
+		return &os.PathError{Op: osOp, Path: name, Err: f.Err}
+	}
+	return nil
+}
+
+// checkLink is check for calls with two names.
+func (fs *Fs) checkLink(op, osOp, oldname, newname string) error {
+	if f := fs.fault(op, oldname); f.Err != nil {
+		return &os.LinkError{Op: osOp, Old: oldname, New: newname, Err: f.Err}
+	}
+	return nil
+}
+
+func (fs *Fs) file(name string, f afero.File, err error) (afero.File, error) {
+	if err != nil {
+		return nil, err
+	}
+	return &File{File: f, fs: fs, name: name}, nil
+}
+
+func (fs *Fs) Name() string {
+	return "faultfs"
+}
+
+// Unwrap returns the source Fs, without the injected faults.
+func (fs *Fs) Unwrap() afero.Fs {
+	return fs.source
+}
+
+func (fs *Fs) Create(name string) (afero.File, error) {
+	if err := fs.check("Create", "open", name); err != nil {
+		return nil, err
+	}
+	f, err := fs.source.Create(name)
+	return fs.file(name, f, err)
+}
+
+func (fs *Fs) Open(name string) (afero.File, error) {
+	if err := fs.check("Open", "open", name); err != nil {
+		return nil, err
+	}
+	f, err := fs.source.Open(name)
+	return fs.file(name, f, err)
+}
+
+func (fs *Fs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	if err := fs.check("OpenFile", "open", name); err != nil {
+		return nil, err
+	}
+	f, err := fs.source.OpenFile(name, flag, perm)
+	return fs.file(name, f, err)
+}
+
+func (fs *Fs) Mkdir(name string, perm os.FileMode) error {
+	if err := fs.check("Mkdir", "mkdir", name); err != nil {
+		return err
+	}
+	return fs.source.Mkdir(name, perm)
+}
+
+func (fs *Fs) MkdirAll(path string, perm os.FileMode) error {
+	if err := fs.check("MkdirAll", "mkdir", path); err != nil {
+		return err
+	}
+	return fs.source.MkdirAll(path, perm)
+}
+
+func (fs *Fs) Remove(name string) error {
+	if err := fs.check("Remove", "remove", name); err != nil {
+		return err
+	}
+	return fs.source.Remove(name)
+}
+
+func (fs *Fs) RemoveAll(path string) error {
+	if err := fs.check("RemoveAll", "RemoveAll", path); err != nil {
+		return err
+	}
+	return fs.source.RemoveAll(path)
+}
+
+func (fs *Fs) Rename(oldname, newname string) error {
+	if err := fs.checkLink("Rename", "rename", oldname, newname); err != nil {
+		return err
+	}
+	return fs.source.Rename(oldname, newname)
+}
+
+func (fs *Fs) Stat(name string) (os.FileInfo, error) {
+	if err := fs.check("Stat", "stat", name); err != nil {
+		return nil, err
+	}
+	return fs.source.Stat(name)
+}
+
+func (fs *Fs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	if err := fs.check("Lstat", "lstat", name); err != nil {
+		return nil, false, err
+	}
+	if lsf, ok := fs.source.(afero.Lstater); ok {
+		return lsf.LstatIfPossible(name)
+	}
+	fi, err := fs.source.Stat(name)
+	return fi, false, err
+}
+
+func (fs *Fs) SymlinkIfPossible(oldname, newname string) error {
+	if err := fs.checkLink("Symlink", "symlink", oldname, newname); err != nil {
+		return err
+	}
+	if l, ok := fs.source.(afero.Linker); ok {
+		return l.SymlinkIfPossible(oldname, newname)
+	}
+	return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: afero.ErrNoSymlink}
+}
+
+func (fs *Fs) ReadlinkIfPossible(name string) (string, error) {
+	if err := fs.check("Readlink", "readlink", name); err != nil {
+		return "", err
+	}
+	if r, ok := fs.source.(afero.LinkReader); ok {
+		return r.ReadlinkIfPossible(name)
+	}
+	return "", &os.PathError{Op: "readlink", Path: name, Err: afero.ErrNoReadlink}
+}
+
+func (fs *Fs) LinkIfPossible(oldname, newname string) error {
+	if err := fs.checkLink("Link", "link", oldname, newname); err != nil {
+		return err
+	}
+	return afero.Link(fs.source, oldname, newname)
+}
+
+func (fs *Fs) Chmod(name string, mode os.FileMode) error {
+	if err := fs.check("Chmod", "chmod", name); err != nil {
+		return err
+	}
+	return fs.source.Chmod(name, mode)
+}
+
+func (fs *Fs) Chown(name string, uid, gid int) error {
+	if err := fs.check("Chown", "chown", name); err != nil {
+		return err
+	}
+	return fs.source.Chown(name, uid, gid)
+}
+
+func (fs *Fs) Chtimes(name string, atime, mtime time.Time) error {
+	if err := fs.check("Chtimes", "chtimes", name); err != nil {
+		return err
+	}
+	return fs.source.Chtimes(name, atime, mtime)
+}
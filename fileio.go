@@ -0,0 +1,30 @@
+package afero
+
+import "io"
+
+// The File wrappers of this package implement io.ReaderFrom and io.WriterTo
+// through readFrom and writeTo, so that the fast paths of the wrapped file,
+// e.g. copy_file_range(2) and sendfile(2) for an *os.File, are still used by
+// io.Copy.
+
+// readFrom reads r into f, using f's ReadFrom if it has one.
+func readFrom(f File, r io.Reader) (int64, error) {
+	if rf, ok := f.(io.ReaderFrom); ok {
+		return rf.ReadFrom(r)
+	}
+	return io.Copy(writerOnly{f}, r)
+}
+
+// writeTo writes f to w, using f's WriteTo if it has one.
+func writeTo(f File, w io.Writer) (int64, error) {
+	if wt, ok := f.(io.WriterTo); ok {
+		return wt.WriteTo(w)
+	}
+	return io.Copy(w, readerOnly{f})
+}
+
+// writerOnly and readerOnly hide all other methods of a File, so that
+// io.Copy does not call back into the wrapper.
+type writerOnly struct{ io.Writer }
+
+type readerOnly struct{ io.Reader }
@@ -0,0 +1,73 @@
+package afero
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero/mem"
+)
+
+// fastFile records whether its ReadFrom and WriteTo were used.
+type fastFile struct {
+	*mem.File
+	readFrom, writeTo bool
+}
+
+func (f *fastFile) ReadFrom(r io.Reader) (int64, error) {
+	f.readFrom = true
+	return io.Copy(writerOnly{f.File}, r)
+}
+
+func (f *fastFile) WriteTo(w io.Writer) (int64, error) {
+	f.writeTo = true
+	return io.Copy(w, readerOnly{f.File})
+}
+
+func TestWrapperFastPaths(t *testing.T) {
+	wrappers := map[string]func(File) File{
+		"BasePathFile":  func(f File) File { return &BasePathFile{File: f} },
+		"RegexpFile":    func(f File) File { return &RegexpFile{f: f} },
+		"UnionFile":     func(f File) File { return &UnionFile{Layer: f} },
+		"SwappableFile": func(f File) File { return &SwappableFile{File: f} },
+	}
+	for name, wrap := range wrappers {
+		t.Run(name, func(t *testing.T) {
+			inner := &fastFile{File: mem.NewFileHandle(mem.CreateFile("/file"))}
+			f := wrap(inner)
+
+			if _, err := io.Copy(f, readerOnly{strings.NewReader("fast path")}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := f.Seek(0, io.SeekStart); err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if _, err := io.Copy(&buf, f); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != "fast path" {
+				t.Errorf("read back %q", buf.String())
+			}
+			if !inner.readFrom || !inner.writeTo {
+				t.Errorf("ReadFrom used: %v, WriteTo used: %v", inner.readFrom, inner.writeTo)
+			}
+		})
+	}
+}
+
+func TestUnionFileReadFromBothLayers(t *testing.T) {
+	base := mem.NewFileHandle(mem.CreateFile("/file"))
+	layer := mem.NewFileHandle(mem.CreateFile("/file"))
+	f := &UnionFile{Base: base, Layer: layer}
+	if _, err := io.Copy(f, strings.NewReader("both")); err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range []File{base, layer} {
+		buf := make([]byte, 4)
+		if _, err := l.ReadAt(buf, 0); err != nil || string(buf) != "both" {
+			t.Errorf("%s: got %q, %v", l.Name(), buf, err)
+		}
+	}
+}
@@ -0,0 +1,424 @@
+package afero
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"syscall"
+	"time"
+)
+
+// The FilterFs is a generalized RegexpFs. It hides files by a list of
+// include and exclude patterns, given as regular expressions or as glob
+// patterns in the syntax of filepath.Match.
+//
+// A file is visible if it matches at least one include pattern (or there
+// are none) and no exclude pattern. Patterns are matched against the base
+// name unless FilterFullPath is given. Directories are always visible,
+// unless FilterDirectories is given: then a directory matching an exclude
+// pattern is hidden together with everything below it.
+//
+// FilterPredicate filters files by any property of their FileInfo, e.g.
+// their size or modification time, on top of the patterns.
+//
+// Hidden files get an ENOENT error ("No such file or directory") and are
+// left out of directory listings. With FilterHideOnly they are only left
+// out of listings and can still be used by name. With FilterReadOnly they
+// stay visible, but cannot be modified.
+type FilterFs struct {
+	source    Fs
+	include   []matcher
+	exclude   []matcher
+	predicate func(path string, info os.FileInfo) bool
+	fullPath  bool
+	dirs      bool
+	hideOnly  bool
+	readOnly  bool
+}
+
+// FilterOption configures a FilterFs.
+type FilterOption func(*FilterFs)
+
+type matcher func(name string) bool
+
+// FilterInclude adds include patterns in glob syntax. It panics if a
+// pattern is malformed.
+func FilterInclude(patterns ...string) FilterOption {
+	ms := globMatchers(patterns)
+	return func(f *FilterFs) { f.include = append(f.include, ms...) }
+}
+
+// FilterExclude adds exclude patterns in glob syntax. It panics if a
+// pattern is malformed.
+func FilterExclude(patterns ...string) FilterOption {
+	ms := globMatchers(patterns)
+	return func(f *FilterFs) { f.exclude = append(f.exclude, ms...) }
+}
+
+// FilterIncludeRegexp adds include patterns as regular expressions.
+func FilterIncludeRegexp(res ...*regexp.Regexp) FilterOption {
+	ms := regexpMatchers(res)
+	return func(f *FilterFs) { f.include = append(f.include, ms...) }
+}
+
+// FilterExcludeRegexp adds exclude patterns as regular expressions.
+func FilterExcludeRegexp(res ...*regexp.Regexp) FilterOption {
+	ms := regexpMatchers(res)
+	return func(f *FilterFs) { f.exclude = append(f.exclude, ms...) }
+}
+
+// FilterFullPath matches the patterns against the cleaned full path instead
+// of the base name.
+func FilterFullPath() FilterOption {
+	return func(f *FilterFs) { f.fullPath = true }
+}
+
+// FilterDirectories applies the exclude patterns to directories as well.
+// Include patterns only apply to files, so that directories stay reachable.
+func FilterDirectories() FilterOption {
+	return func(f *FilterFs) { f.dirs = true }
+}
+
+// FilterHideOnly leaves hidden files out of directory listings only.
+func FilterHideOnly() FilterOption {
+	return func(f *FilterFs) { f.hideOnly = true }
+}
+
+// FilterPredicate only shows the files for which pred returns true, given
+// their path and FileInfo, e.g. to show only the files newer than a date:
+//
+//	afero.FilterPredicate(func(path string, info os.FileInfo) bool {
+//		return info.ModTime().After(since)
+//	})
+//
+// Like include patterns, it only applies to files, and not to the names
+// which do not exist yet.
+func FilterPredicate(pred func(path string, info os.FileInfo) bool) FilterOption {
+	return func(f *FilterFs) { f.predicate = pred }
+}
+
+// FilterReadOnly makes the files which do not pass the filter read-only
+// instead of hiding them: they are listed and can be opened for reading,
+// but writing, creating, removing, renaming or changing them fails with
+// EPERM.
+func FilterReadOnly() FilterOption {
+	return func(f *FilterFs) { f.readOnly = true }
+}
+
+func globMatchers(patterns []string) []matcher {
+	ms := make([]matcher, len(patterns))
+	for i, p := range patterns {
+		if _, err := filepath.Match(p, ""); err != nil {
+			panic("afero: bad glob pattern " + p)
+		}
+		p := p
+		ms[i] = func(name string) bool {
+			ok, _ := filepath.Match(p, name)
+			return ok
+		}
+	}
+	return ms
+}
+
+func regexpMatchers(res []*regexp.Regexp) []matcher {
+	ms := make([]matcher, len(res))
+	for i, re := range res {
+		ms[i] = re.MatchString
+	}
+	return ms
+}
+
+func NewFilterFs(source Fs, opts ...FilterOption) Fs {
+	f := &FilterFs{source: source}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
+}
+
+type FilterFile struct {
+	f   File
+	fs  *FilterFs
+	dir string
+}
+
+func (r *FilterFs) subject(name string) string {
+	if r.fullPath {
+		return name
+	}
+	return Base(r, name)
+}
+
+func matchesAny(ms []matcher, name string) bool {
+	for _, m := range ms {
+		if m(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// visible reports whether name, a directory if dir is set, passes the
+// filter. info is the FileInfo of name, or nil if it does not exist.
+func (r *FilterFs) visible(name string, dir bool, info os.FileInfo) bool {
+	name = Clean(r, name)
+	if r.dirs {
+		for p := name; ; {
+			parent := Dir(r, p)
+			if parent == p {
+				break
+			}
+			if matchesAny(r.exclude, r.subject(parent)) {
+				return false
+			}
+			p = parent
+		}
+	}
+	if dir && !r.dirs {
+		return true
+	}
+	s := r.subject(name)
+	if matchesAny(r.exclude, s) {
+		return false
+	}
+	if dir {
+		return true
+	}
+	if len(r.include) > 0 && !matchesAny(r.include, s) {
+		return false
+	}
+	return info == nil || r.predicate == nil || r.predicate(name, info)
+}
+
+// listed reports whether a directory entry is listed.
+func (r *FilterFs) listed(name string, info os.FileInfo) bool {
+	return r.readOnly && !r.hideOnly || r.visible(name, info.IsDir(), info)
+}
+
+// check returns an ENOENT error if name is hidden, or an EPERM error if it
+// is read-only and write is set. Names which do not exist yet are checked
+// as files.
+func (r *FilterFs) check(op, name string, write bool) error {
+	if r.hideOnly && !r.readOnly {
+		return nil
+	}
+	fi, err := r.source.Stat(name)
+	if err != nil {
+		return r.checkAs(op, name, false, nil, write)
+	}
+	return r.checkAs(op, name, fi.IsDir(), fi, write)
+}
+
+func (r *FilterFs) checkAs(op, name string, dir bool, info os.FileInfo, write bool) error {
+	if r.visible(name, dir, info) {
+		return nil
+	}
+	if r.readOnly {
+		if !write {
+			return nil
+		}
+		return &os.PathError{Op: op, Path: name, Err: syscall.EPERM}
+	}
+	if r.hideOnly {
+		return nil
+	}
+	return &os.PathError{Op: op, Path: name, Err: syscall.ENOENT}
+}
+
+func (r *FilterFs) Chtimes(name string, a, m time.Time) error {
+	if err := r.check("chtimes", name, true); err != nil {
+		return err
+	}
+	return r.source.Chtimes(name, a, m)
+}
+
+func (r *FilterFs) Chmod(name string, mode os.FileMode) error {
+	if err := r.check("chmod", name, true); err != nil {
+		return err
+	}
+	return r.source.Chmod(name, mode)
+}
+
+func (r *FilterFs) Chown(name string, uid, gid int) error {
+	if err := r.check("chown", name, true); err != nil {
+		return err
+	}
+	return r.source.Chown(name, uid, gid)
+}
+
+func (r *FilterFs) Name() string {
+	return "FilterFs"
+}
+
+// Unwrap returns the source Fs, without the filters.
+func (r *FilterFs) Unwrap() Fs {
+	return r.source
+}
+
+// Capabilities returns CapAtomicRename and CapReadAt of the source, the
+// optional interfaces are not implemented.
+func (r *FilterFs) Capabilities() Capability {
+	return Capabilities(r.source) & (CapAtomicRename | CapReadAt)
+}
+
+func (r *FilterFs) Stat(name string) (os.FileInfo, error) {
+	if err := r.check("stat", name, false); err != nil {
+		return nil, err
+	}
+	return r.source.Stat(name)
+}
+
+func (r *FilterFs) Rename(oldname, newname string) error {
+	if err := r.check("rename", oldname, true); err != nil {
+		return err
+	}
+	dir, _ := IsDir(r.source, oldname)
+	fi, err := r.source.Stat(newname)
+	if err != nil {
+		fi = nil
+	}
+	if err := r.checkAs("rename", newname, dir, fi, true); err != nil {
+		return err
+	}
+	return r.source.Rename(oldname, newname)
+}
+
+func (r *FilterFs) RemoveAll(p string) error {
+	if err := r.check("removeall", p, true); err != nil {
+		return err
+	}
+	return r.source.RemoveAll(p)
+}
+
+func (r *FilterFs) Remove(name string) error {
+	if err := r.check("remove", name, true); err != nil {
+		return err
+	}
+	return r.source.Remove(name)
+}
+
+func (r *FilterFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	write := flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) != 0
+	if err := r.check("open", name, write); err != nil {
+		return nil, err
+	}
+	f, err := r.source.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &FilterFile{f: f, fs: r, dir: name}, nil
+}
+
+func (r *FilterFs) Open(name string) (File, error) {
+	if err := r.check("open", name, false); err != nil {
+		return nil, err
+	}
+	f, err := r.source.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &FilterFile{f: f, fs: r, dir: name}, nil
+}
+
+func (r *FilterFs) Mkdir(n string, p os.FileMode) error {
+	if err := r.checkAs("mkdir", n, true, nil, true); err != nil {
+		return err
+	}
+	return r.source.Mkdir(n, p)
+}
+
+func (r *FilterFs) MkdirAll(n string, p os.FileMode) error {
+	if err := r.checkAs("mkdir", n, true, nil, true); err != nil {
+		return err
+	}
+	return r.source.MkdirAll(n, p)
+}
+
+func (r *FilterFs) Create(name string) (File, error) {
+	if err := r.check("open", name, true); err != nil {
+		return nil, err
+	}
+	f, err := r.source.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return &FilterFile{f: f, fs: r, dir: name}, nil
+}
+
+func (f *FilterFile) Close() error {
+	return f.f.Close()
+}
+
+func (f *FilterFile) Read(s []byte) (int, error) {
+	return f.f.Read(s)
+}
+
+func (f *FilterFile) ReadAt(s []byte, o int64) (int, error) {
+	return f.f.ReadAt(s, o)
+}
+
+func (f *FilterFile) Seek(o int64, w int) (int64, error) {
+	return f.f.Seek(o, w)
+}
+
+func (f *FilterFile) Write(s []byte) (int, error) {
+	return f.f.Write(s)
+}
+
+func (f *FilterFile) WriteAt(s []byte, o int64) (int, error) {
+	return f.f.WriteAt(s, o)
+}
+
+func (f *FilterFile) ReadFrom(r io.Reader) (int64, error) {
+	return readFrom(f.f, r)
+}
+
+func (f *FilterFile) WriteTo(w io.Writer) (int64, error) {
+	return writeTo(f.f, w)
+}
+
+func (f *FilterFile) Name() string {
+	return f.f.Name()
+}
+
+// Readdir leaves out hidden entries. For c > 0 it reads on until at least
+// one entry is visible, so an empty result always comes with an error.
+func (f *FilterFile) Readdir(c int) ([]os.FileInfo, error) {
+	for {
+		rfi, err := f.f.Readdir(c)
+		var fi []os.FileInfo
+		for _, i := range rfi {
+			if f.fs.listed(Join(f.fs, f.dir, i.Name()), i) {
+				fi = append(fi, i)
+			}
+		}
+		if len(fi) > 0 || err != nil || c <= 0 || len(rfi) == 0 {
+			return fi, err
+		}
+	}
+}
+
+func (f *FilterFile) Readdirnames(c int) (n []string, err error) {
+	fi, err := f.Readdir(c)
+	for _, s := range fi {
+		n = append(n, s.Name())
+	}
+	return n, err
+}
+
+func (f *FilterFile) Stat() (os.FileInfo, error) {
+	return f.f.Stat()
+}
+
+func (f *FilterFile) Sync() error {
+	return f.f.Sync()
+}
+
+func (f *FilterFile) Truncate(s int64) error {
+	return f.f.Truncate(s)
+}
+
+func (f *FilterFile) WriteString(s string) (int, error) {
+	return f.f.WriteString(s)
+}
@@ -0,0 +1,172 @@
+package afero
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func filterFixture(t *testing.T) Fs {
+	t.Helper()
+	mfs := NewMemMapFs()
+	for _, name := range []string{
+		"/src/main.go",
+		"/src/main_test.go",
+		"/src/README.md",
+		"/vendor/lib/lib.go",
+		"/build/out.o",
+	} {
+		if err := WriteFile(mfs, name, []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return mfs
+}
+
+func readdirnames(t *testing.T, fs Fs, dir string) []string {
+	t.Helper()
+	f, err := fs.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	names, err := f.Readdirnames(-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestFilterFs(t *testing.T) {
+	fs := NewFilterFs(filterFixture(t),
+		FilterInclude("*.go"),
+		FilterExcludeRegexp(regexp.MustCompile(`_test\.go$`)),
+	)
+
+	if _, err := fs.Stat("/src/main.go"); err != nil {
+		t.Errorf("Stat included file: %v", err)
+	}
+	for _, name := range []string{"/src/main_test.go", "/src/README.md"} {
+		if _, err := fs.Open(name); !os.IsNotExist(err) {
+			t.Errorf("Open %s: got %v, want not exist", name, err)
+		}
+	}
+	if _, err := fs.Create("/src/new.txt"); !os.IsNotExist(err) {
+		t.Errorf("Create excluded file: got %v, want not exist", err)
+	}
+	if f, err := fs.OpenFile("/src/new.go", os.O_CREATE|os.O_WRONLY, 0o644); err != nil {
+		t.Errorf("OpenFile O_CREATE included file: %v", err)
+	} else {
+		f.Close()
+	}
+
+	if got, want := readdirnames(t, fs, "/src"), []string{"main.go", "new.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Readdirnames = %v, want %v", got, want)
+	}
+	if got, want := readdirnames(t, fs, "/"), []string{"build", "src", "vendor"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Readdirnames / = %v, want %v", got, want)
+	}
+}
+
+func TestFilterFsDirectories(t *testing.T) {
+	fs := NewFilterFs(filterFixture(t), FilterExclude("vendor", "build"), FilterDirectories())
+
+	for _, name := range []string{"/vendor", "/vendor/lib", "/vendor/lib/lib.go", "/build/out.o"} {
+		if _, err := fs.Stat(name); !os.IsNotExist(err) {
+			t.Errorf("Stat %s: got %v, want not exist", name, err)
+		}
+	}
+	if err := fs.MkdirAll("/build/tmp", 0o755); !os.IsNotExist(err) {
+		t.Errorf("MkdirAll in excluded dir: got %v, want not exist", err)
+	}
+	if got, want := readdirnames(t, fs, "/"), []string{"src"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Readdirnames / = %v, want %v", got, want)
+	}
+}
+
+func TestFilterFsFullPath(t *testing.T) {
+	fs := NewFilterFs(filterFixture(t), FilterInclude("/src/*"), FilterFullPath())
+
+	if _, err := fs.Stat("/src/README.md"); err != nil {
+		t.Errorf("Stat matching path: %v", err)
+	}
+	if _, err := fs.Stat("/vendor/lib/lib.go"); !os.IsNotExist(err) {
+		t.Errorf("Stat non-matching path: got %v, want not exist", err)
+	}
+}
+
+func TestFilterFsHideOnly(t *testing.T) {
+	fs := NewFilterFs(filterFixture(t), FilterExclude("*.md"), FilterHideOnly())
+
+	if _, err := fs.Stat("/src/README.md"); err != nil {
+		t.Errorf("Stat hidden file: %v", err)
+	}
+	if got, want := readdirnames(t, fs, "/src"), []string{"main.go", "main_test.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Readdirnames = %v, want %v", got, want)
+	}
+}
+
+func TestFilterFsPredicate(t *testing.T) {
+	base := filterFixture(t)
+	old := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	base.Chtimes("/src/main.go", old, old)
+	fs := NewFilterFs(base, FilterInclude("*.go"), FilterPredicate(func(path string, info os.FileInfo) bool {
+		return info.ModTime().After(old)
+	}))
+
+	if _, err := fs.Stat("/src/main.go"); !os.IsNotExist(err) {
+		t.Errorf("Stat of an old file: got %v, want not exist", err)
+	}
+	if _, err := fs.Stat("/src/main_test.go"); err != nil {
+		t.Errorf("Stat of a new file: %v", err)
+	}
+	if got, want := readdirnames(t, fs, "/src"), []string{"main_test.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Readdirnames = %v, want %v", got, want)
+	}
+	// names which do not exist yet pass
+	if f, err := fs.Create("/src/new.go"); err != nil {
+		t.Errorf("Create: %v", err)
+	} else {
+		f.Close()
+	}
+}
+
+func TestFilterFsReadOnly(t *testing.T) {
+	fs := NewFilterFs(filterFixture(t), FilterInclude("*.go"), FilterReadOnly())
+
+	if got, _ := ReadFile(fs, "/src/README.md"); string(got) != "/src/README.md" {
+		t.Errorf("reading a read-only file = %q", got)
+	}
+	if got, want := readdirnames(t, fs, "/src"), []string{"README.md", "main.go", "main_test.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Readdirnames = %v, want %v", got, want)
+	}
+	for name, err := range map[string]error{
+		"WriteFile": WriteFile(fs, "/src/README.md", nil, 0o644),
+		"Create":    WriteFile(fs, "/src/new.txt", nil, 0o644),
+		"Remove":    fs.Remove("/src/README.md"),
+		"Rename":    fs.Rename("/src/main.go", "/src/README.md"),
+		"Chmod":     fs.Chmod("/src/README.md", 0o600),
+	} {
+		if !errors.Is(err, syscall.EPERM) {
+			t.Errorf("%s of a read-only file: got %v, want EPERM", name, err)
+		}
+	}
+	if err := WriteFile(fs, "/src/main.go", []byte("package main"), 0o644); err != nil {
+		t.Errorf("WriteFile of a visible file: %v", err)
+	}
+}
+
+func TestFilterFsBadGlob(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("FilterInclude did not panic on a malformed pattern")
+		}
+	}()
+	FilterInclude("[")
+}
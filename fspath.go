@@ -0,0 +1,155 @@
+package afero
+
+import (
+	"errors"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// PathSeparatorer is an optional interface in Afero. It is implemented by
+// filesystems whose paths do not use the separator of the host OS, e.g.
+// object stores that always use "/" even on Windows.
+type PathSeparatorer interface {
+	PathSeparator() string
+}
+
+// PathSeparatorOf returns the path separator used by fs. A WrappingFs not
+// implementing PathSeparatorer uses the separator of the Fs it wraps, other
+// filesystems not implementing it use FilePathSeparator.
+func PathSeparatorOf(fs Fs) string {
+	for fs != nil {
+		if ps, ok := fs.(PathSeparatorer); ok {
+			if sep := ps.PathSeparator(); sep != "" {
+				return sep
+			}
+		}
+		w, ok := fs.(WrappingFs)
+		if !ok {
+			break
+		}
+		fs = w.Unwrap()
+	}
+	return FilePathSeparator
+}
+
+// toSlash converts p from a path using sep to a slash separated path.
+func toSlash(p, sep string) string {
+	if sep == "/" {
+		return p
+	}
+	return strings.ReplaceAll(p, sep, "/")
+}
+
+// fromSlash is the inverse of toSlash.
+func fromSlash(p, sep string) string {
+	if sep == "/" {
+		return p
+	}
+	return strings.ReplaceAll(p, "/", sep)
+}
+
+// Clean is like filepath.Clean, but uses the path separator of fs.
+func Clean(fs Fs, p string) string {
+	sep := PathSeparatorOf(fs)
+	if sep == FilePathSeparator {
+		return filepath.Clean(p)
+	}
+	return fromSlash(path.Clean(toSlash(p, sep)), sep)
+}
+
+// Join is like filepath.Join, but uses the path separator of fs.
+func Join(fs Fs, elem ...string) string {
+	sep := PathSeparatorOf(fs)
+	if sep == FilePathSeparator {
+		return filepath.Join(elem...)
+	}
+	slashed := make([]string, len(elem))
+	for i, e := range elem {
+		slashed[i] = toSlash(e, sep)
+	}
+	return fromSlash(path.Join(slashed...), sep)
+}
+
+// Dir is like filepath.Dir, but uses the path separator of fs.
+func Dir(fs Fs, p string) string {
+	sep := PathSeparatorOf(fs)
+	if sep == FilePathSeparator {
+		return filepath.Dir(p)
+	}
+	return fromSlash(path.Dir(toSlash(p, sep)), sep)
+}
+
+// Base is like filepath.Base, but uses the path separator of fs.
+func Base(fs Fs, p string) string {
+	sep := PathSeparatorOf(fs)
+	if sep == FilePathSeparator {
+		return filepath.Base(p)
+	}
+	return fromSlash(path.Base(toSlash(p, sep)), sep)
+}
+
+// Split is like filepath.Split, but uses the path separator of fs.
+func Split(fs Fs, p string) (dir, file string) {
+	sep := PathSeparatorOf(fs)
+	if sep == FilePathSeparator {
+		return filepath.Split(p)
+	}
+	i := strings.LastIndex(p, sep)
+	if i < 0 {
+		return "", p
+	}
+	return p[:i+len(sep)], p[i+len(sep):]
+}
+
+// Rel is like filepath.Rel, but uses the path separator of fs. It is purely
+// lexical and never consults the filesystem, so symlinks are not resolved.
+func Rel(fs Fs, base, target string) (string, error) {
+	sep := PathSeparatorOf(fs)
+	if sep == FilePathSeparator {
+		return filepath.Rel(base, target)
+	}
+
+	b := path.Clean(toSlash(base, sep))
+	t := path.Clean(toSlash(target, sep))
+	if b == t {
+		return ".", nil
+	}
+	if b == "." {
+		b = ""
+	}
+	if t == "." {
+		t = ""
+	}
+	if strings.HasPrefix(b, "/") != strings.HasPrefix(t, "/") {
+		return "", errors.New("Rel: can't make " + target + " relative to " + base)
+	}
+
+	bparts := splitSlash(b)
+	tparts := splitSlash(t)
+	i := 0
+	for i < len(bparts) && i < len(tparts) && bparts[i] == tparts[i] {
+		i++
+	}
+	for _, p := range bparts[i:] {
+		if p == ".." {
+			return "", errors.New("Rel: can't make " + target + " relative to " + base)
+		}
+	}
+
+	rel := make([]string, 0, len(bparts)-i+len(tparts)-i)
+	for range bparts[i:] {
+		rel = append(rel, "..")
+	}
+	rel = append(rel, tparts[i:]...)
+	return fromSlash(strings.Join(rel, "/"), sep), nil
+}
+
+// splitSlash splits a cleaned slash separated path into its elements.
+func splitSlash(p string) []string {
+	p = strings.TrimPrefix(p, "/")
+	if p == "" {
+		return nil
+	}
+	return strings.Split(p, "/")
+}
@@ -0,0 +1,103 @@
+package afero
+
+import (
+	"os"
+	"testing"
+)
+
+type sepFs struct {
+	MemMapFs
+	sep string
+}
+
+func (s *sepFs) PathSeparator() string { return s.sep }
+
+func TestPathSeparatorOf(t *testing.T) {
+	if got := PathSeparatorOf(&MemMapFs{}); got != FilePathSeparator {
+		t.Errorf("got %q, want %q", got, FilePathSeparator)
+	}
+	if got := PathSeparatorOf(&sepFs{sep: ":"}); got != ":" {
+		t.Errorf("got %q, want %q", got, ":")
+	}
+
+	// wrappers use the separator of the Fs they wrap
+	sep := &sepFs{sep: ":"}
+	for _, fs := range []Fs{
+		NewReadOnlyFs(sep),
+		NewBasePathFs(NewReadOnlyFs(sep), ":a"),
+		NewCopyOnWriteFs(sep, &MemMapFs{}),
+	} {
+		if got := PathSeparatorOf(fs); got != ":" {
+			t.Errorf("%s: got %q, want %q", fs.Name(), got, ":")
+		}
+	}
+}
+
+func TestCopyOnWriteSeparator(t *testing.T) {
+	base := &sepFs{sep: ":"}
+	WriteFile(base, "a:b", []byte("x"), 0o644)
+	layer := &MemMapFs{}
+	fs := NewCopyOnWriteFs(base, layer)
+	if err := fs.Remove("a:b"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := layer.Stat("a:.wh.b"); err != nil {
+		t.Errorf("whiteout of a:b: %v", err)
+	}
+	if _, err := fs.Stat("a:b"); !os.IsNotExist(err) {
+		t.Errorf("Stat of the removed file = %v", err)
+	}
+}
+
+func TestFsPathHelpers(t *testing.T) {
+	fs := &sepFs{sep: ":"}
+
+	if got := Join(fs, "a", "b:c", "", "d"); got != "a:b:c:d" {
+		t.Errorf("Join: got %q", got)
+	}
+	if got := Clean(fs, ":a::b:.:c:..:d:"); got != ":a:b:d" {
+		t.Errorf("Clean: got %q", got)
+	}
+	if dir, file := Split(fs, "a:b:c"); dir != "a:b:" || file != "c" {
+		t.Errorf("Split: got %q, %q", dir, file)
+	}
+	if dir, file := Split(fs, "c"); dir != "" || file != "c" {
+		t.Errorf("Split: got %q, %q", dir, file)
+	}
+	if got := Dir(fs, "a:b:c:"); got != "a:b:c" {
+		t.Errorf("Dir: got %q", got)
+	}
+	if got := Dir(fs, "c"); got != "." {
+		t.Errorf("Dir: got %q", got)
+	}
+	if got := Base(fs, ":a:b:"); got != "b" {
+		t.Errorf("Base: got %q", got)
+	}
+	if got := Base(fs, ":"); got != ":" {
+		t.Errorf("Base: got %q", got)
+	}
+
+	relTests := []struct {
+		base, target, want string
+		err                bool
+	}{
+		{"a:b", "a:b", ".", false},
+		{"a:b", "a:b:c:d", "c:d", false},
+		{"a:b:c", "a:x", "..:..:x", false},
+		{".", "a:b", "a:b", false},
+		{"a", ".", "..", false},
+		{":a", ":b", "..:b", false},
+		{":a", "b", "", true},
+		{"..:a", "b", "", true},
+	}
+	for _, tt := range relTests {
+		got, err := Rel(fs, tt.base, tt.target)
+		if (err != nil) != tt.err {
+			t.Errorf("Rel(%q, %q): unexpected error %v", tt.base, tt.target, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Rel(%q, %q) = %q, want %q", tt.base, tt.target, got, tt.want)
+		}
+	}
+}
@@ -18,7 +18,11 @@ package gcsfs
 
 import (
 	"errors"
+	"fmt"
+	"net/http"
 	"syscall"
+
+	"google.golang.org/api/googleapi"
 )
 
 var (
@@ -28,4 +32,22 @@ var (
 	ErrObjectDoesNotExist = errors.New("storage: object doesn't exist")
 	ErrEmptyObjectName    = errors.New("storage: object name is empty")
 	ErrFileNotFound       = syscall.ENOENT
+
+	// ErrWriteAtInAppendMode is returned by WriteAt on files opened with
+	// O_APPEND, like in os.
+	ErrWriteAtInAppendMode = errors.New("invalid use of WriteAt on file opened with O_APPEND")
+
+	// ErrPreconditionFailed is wrapped by the errors of commits to objects
+	// whose preconditions, set with OpenFileIf or by O_EXCL, do not hold.
+	ErrPreconditionFailed = errors.New("precondition failed")
 )
+
+// preconditionError wraps err in ErrPreconditionFailed if GCS rejected a
+// request because of its preconditions.
+func preconditionError(err error) error {
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) && gerr.Code == http.StatusPreconditionFailed {
+		return fmt.Errorf("%w: %w", ErrPreconditionFailed, err)
+	}
+	return err
+}
@@ -20,6 +20,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
@@ -30,6 +31,7 @@ import (
 	"google.golang.org/api/iterator"
 
 	"github.com/spf13/afero/gcsfs/internal/stiface"
+	"github.com/spf13/afero/internal/common"
 )
 
 // GcsFs is the Afero version adapted for GCS
@@ -39,6 +41,8 @@ type GcsFile struct {
 	closed    bool
 	ReadDirIt stiface.ObjectIterator
 	resource  *gcsFileResource
+
+	dir common.DirLister
 }
 
 func NewGcsFile(
@@ -146,18 +150,43 @@ func (o *GcsFile) ReadAt(p []byte, off int64) (n int, err error) {
 }
 
 func (o *GcsFile) Write(p []byte) (n int, err error) {
+	if o.openFlags&os.O_APPEND != 0 {
+		return o.append(p)
+	}
 	return o.WriteAt(p, o.fhOffset)
 }
 
+// append writes p at the end of the object, wherever the offset of o is,
+// and moves the offset there, like os does for files opened with O_APPEND.
+func (o *GcsFile) append(p []byte) (int, error) {
+	if o.closed {
+		return 0, ErrFileClosed
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	written, err := o.resource.Append(p)
+	o.fhOffset = o.resource.offset
+	return written, err
+}
+
 func (o *GcsFile) WriteAt(b []byte, off int64) (n int, err error) {
 	if o.closed {
 		return 0, ErrFileClosed
 	}
 
+	if o.openFlags&os.O_APPEND != 0 {
+		return 0, &os.PathError{Op: "writeat", Path: o.Name(), Err: ErrWriteAtInAppendMode}
+	}
+
 	if o.openFlags&os.O_RDONLY != 0 {
 		return 0, fmt.Errorf("file is opend as read only")
 	}
 
+	if len(b) == 0 {
+		return 0, nil
+	}
+
 	_, err = o.resource.obj.Attrs(o.resource.ctx)
 	if err != nil {
 		if err == storage.ErrObjectNotExist {
@@ -178,41 +207,25 @@ func (o *GcsFile) Name() string {
 	return filepath.FromSlash(o.resource.name)
 }
 
-func (o *GcsFile) readdirImpl(count int) ([]*FileInfo, error) {
-	err := o.Sync()
-	if err != nil {
-		return nil, err
-	}
-
-	var ownInfo os.FileInfo
-	ownInfo, err = o.Stat()
-	if err != nil {
-		return nil, err
-	}
-
-	if !ownInfo.IsDir() {
-		return nil, syscall.ENOTDIR
-	}
-
-	path := o.resource.fs.ensureTrailingSeparator(o.resource.name)
+// readdirImpl returns up to count entries of the directory from the Objects
+// iterator, or all of them if count <= 0, and io.EOF once it is done. The
+// objects are fetched in pages of count, so large prefixes can be listed
+// with bounded memory.
+func (o *GcsFile) readdirImpl(count int, ownName string) ([]os.FileInfo, error) {
 	if o.ReadDirIt == nil {
-		// log.Printf("Querying path : %s\n", path)
+		path := o.resource.fs.ensureTrailingSeparator(o.resource.name)
 		bucketName, bucketPath := o.resource.fs.splitName(path)
 
 		o.ReadDirIt = o.resource.fs.client.Bucket(bucketName).Objects(
 			o.resource.ctx, &storage.Query{Delimiter: o.resource.fs.separator, Prefix: bucketPath, Versions: false})
+		if count > 0 {
+			o.ReadDirIt.PageInfo().MaxSize = count
+		}
 	}
-	var res []*FileInfo
-	for {
+	var res []os.FileInfo
+	for count <= 0 || len(res) < count {
 		object, err := o.ReadDirIt.Next()
 		if err == iterator.Done {
-			// reset the iterator
-			o.ReadDirIt = nil
-
-			if len(res) > 0 || count <= 0 {
-				return res, nil
-			}
-
 			return res, io.EOF
 		}
 		if err != nil {
@@ -230,39 +243,51 @@ func (o *GcsFile) readdirImpl(count int) ([]*FileInfo, error) {
 			continue
 		}
 
-		if tmp.Name() == ownInfo.Name() {
+		if tmp.Name() == ownName {
 			// Hmmm
 			continue
 		}
 
 		res = append(res, tmp)
-
-		// This would interrupt the iteration, once we reach the count.
-		// But it would then have files coming before folders - that's not what we want to have exactly,
-		// since it makes the results unpredictable. Hence, we iterate all the objects and then do
-		// the cut-off in a higher level method
-		//if count > 0 && len(res) >= count {
-		//	break
-		//}
 	}
-	// return res, nil
+	return res, nil
 }
 
+// Readdir returns the next count entries of the directory, sorted by name,
+// or all remaining ones if count <= 0, following the contract of os.File.
+//
+// Batches follow the order of the object listing, in which a directory
+// "a" sorts like "a/", so across batches it may come after "a-b".
 func (o *GcsFile) Readdir(count int) ([]os.FileInfo, error) {
-	fi, err := o.readdirImpl(count)
-	if len(fi) > 0 {
-		sort.Sort(ByName(fi))
+	err := o.Sync()
+	if err != nil {
+		return nil, err
+	}
+
+	ownInfo, err := o.Stat()
+	if err != nil {
+		return nil, err
 	}
 
-	if count > 0 {
-		fi = fi[:count]
+	if !ownInfo.IsDir() {
+		return nil, syscall.ENOTDIR
 	}
 
-	var res []os.FileInfo
-	for _, f := range fi {
-		res = append(res, f)
+	fi, err := o.dir.Readdir(count, func() ([]os.FileInfo, error) {
+		return o.readdirImpl(count, ownInfo.Name())
+	})
+	sort.Slice(fi, func(i, j int) bool { return fi[i].Name() < fi[j].Name() })
+	return fi, err
+}
+
+// ReadDir implements fs.ReadDirFile on top of Readdir.
+func (o *GcsFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	fi, err := o.Readdir(n)
+	entries := make([]fs.DirEntry, len(fi))
+	for i, f := range fi {
+		entries[i] = fs.FileInfoToDirEntry(f)
 	}
-	return res, err
+	return entries, err
 }
 
 func (o *GcsFile) Readdirnames(n int) ([]string, error) {
@@ -284,6 +309,13 @@ func (o *GcsFile) Stat() (os.FileInfo, error) {
 		return nil, err
 	}
 
+	if o.resource.generation != 0 {
+		attrs, err := o.resource.obj.Attrs(o.resource.ctx)
+		if err != nil {
+			return nil, err
+		}
+		return newFileInfoFromAttrs(attrs, o.resource.fileMode), nil
+	}
 	return newFileInfo(o.resource.name, o.resource.fs, o.resource.fileMode)
 }
 
@@ -301,6 +333,82 @@ func (o *GcsFile) Truncate(wantedSize int64) error {
 	return o.resource.Truncate(wantedSize)
 }
 
+// SetWriterOptions sets the options the object is uploaded with on the next
+// write or Truncate, overriding the fields set in them of the options of the
+// Fs. They are shared by all the open handles of the object.
+func (o *GcsFile) SetWriterOptions(opts WriterOptions) {
+	o.resource.writerOptions = opts
+}
+
 func (o *GcsFile) WriteString(s string) (ret int, err error) {
 	return o.Write([]byte(s))
 }
+
+// ReadFrom copies r to the file. If r is a GcsFile of the same client, read
+// from its start, and o is an empty file at offset 0, the object is copied
+// server-side instead of streaming it through the client.
+func (o *GcsFile) ReadFrom(r io.Reader) (int64, error) {
+	if o.closed {
+		return 0, ErrFileClosed
+	}
+	if src, ok := r.(*GcsFile); ok {
+		if n, copied, err := o.copyFrom(src); copied {
+			return n, err
+		}
+	}
+	return io.Copy(struct{ io.Writer }{o}, r)
+}
+
+// WriteTo copies the rest of the file to w, server-side if w is a GcsFile
+// as described for ReadFrom.
+func (o *GcsFile) WriteTo(w io.Writer) (int64, error) {
+	if o.closed {
+		return 0, ErrFileClosed
+	}
+	if dst, ok := w.(*GcsFile); ok {
+		if n, copied, err := dst.copyFrom(o); copied {
+			return n, err
+		}
+	}
+	return io.Copy(w, struct{ io.Reader }{o})
+}
+
+// copyFrom replaces the object of o with a server-side copy of the object
+// of src if that has the same result as streaming src into o. copied
+// reports whether it did; the caller has to stream otherwise.
+func (o *GcsFile) copyFrom(src *GcsFile) (n int64, copied bool, err error) {
+	if o.closed || src.closed || o.fhOffset != 0 || src.fhOffset != 0 ||
+		o.openFlags&(os.O_WRONLY|os.O_RDWR) == 0 ||
+		o.resource.fs.client != src.resource.fs.client {
+		return 0, false, nil
+	}
+	if err := src.Sync(); err != nil {
+		return 0, true, err
+	}
+	if err := o.Sync(); err != nil {
+		return 0, true, err
+	}
+
+	srcAttrs, err := src.resource.obj.Attrs(src.resource.ctx)
+	if err != nil {
+		return 0, false, nil
+	}
+	dstAttrs, err := o.resource.obj.Attrs(o.resource.ctx)
+	switch {
+	case err == storage.ErrObjectNotExist:
+		if o.openFlags&os.O_CREATE == 0 {
+			return 0, false, nil
+		}
+	case err != nil || dstAttrs.Size > 0:
+		// Streaming would keep the bytes after the copied ones.
+		return 0, false, nil
+	}
+
+	if _, err := o.resource.obj.CopierFrom(src.resource.obj).Run(o.resource.ctx); err != nil {
+		return 0, true, err
+	}
+	o.resource.currentGcsSize = srcAttrs.Size
+	o.fhOffset = srcAttrs.Size
+	src.fhOffset = srcAttrs.Size
+	return srcAttrs.Size, true, nil
+}
@@ -35,6 +35,9 @@ type FileInfo struct {
 	updated  time.Time
 	isDir    bool
 	fileMode os.FileMode
+
+	generation, metageneration int64
+	attrs                      *storage.ObjectAttrs
 }
 
 func newFileInfo(name string, fs *Fs, fileMode os.FileMode) (*FileInfo, error) {
@@ -77,6 +80,8 @@ func newFileInfo(name string, fs *Fs, fileMode os.FileMode) (*FileInfo, error) {
 
 	res.size = objAttrs.Size
 	res.updated = objAttrs.Updated
+	res.generation, res.metageneration = objAttrs.Generation, objAttrs.Metageneration
+	res.attrs = objAttrs
 
 	return res, nil
 }
@@ -88,6 +93,10 @@ func newFileInfoFromAttrs(objAttrs *storage.ObjectAttrs, fileMode os.FileMode) *
 		updated:  objAttrs.Updated,
 		isDir:    false,
 		fileMode: fileMode,
+
+		generation:     objAttrs.Generation,
+		metageneration: objAttrs.Metageneration,
+		attrs:          objAttrs,
 	}
 
 	if res.name == "" {
@@ -97,6 +106,7 @@ func newFileInfoFromAttrs(objAttrs *storage.ObjectAttrs, fileMode os.FileMode) *
 			res.name = objAttrs.Prefix
 			res.size = folderSize
 			res.isDir = true
+			res.attrs = nil
 		}
 	}
 
@@ -126,8 +136,26 @@ func (fi *FileInfo) IsDir() bool {
 	return fi.isDir
 }
 
+// Sys returns the *storage.ObjectAttrs of the object, holding its ETag,
+// CRC32C, generation, content type and metadata, or nil for folders.
 func (fi *FileInfo) Sys() interface{} {
-	return nil
+	if fi.attrs == nil {
+		return nil
+	}
+	return fi.attrs
+}
+
+// Generation returns the generation of the content of the object, which
+// changes whenever it is written, or 0 for folders. It can be passed to
+// OpenGeneration, or to OpenFileIf as storage.Conditions.GenerationMatch.
+func (fi *FileInfo) Generation() int64 {
+	return fi.generation
+}
+
+// Metageneration returns the version of the metadata of the current
+// generation of the object.
+func (fi *FileInfo) Metageneration() int64 {
+	return fi.metageneration
 }
 
 type ByName []*FileInfo
@@ -138,5 +166,8 @@ func (a ByName) Swap(i, j int) {
 	a[i].size, a[j].size = a[j].size, a[i].size
 	a[i].updated, a[j].updated = a[j].updated, a[i].updated
 	a[i].isDir, a[j].isDir = a[j].isDir, a[i].isDir
+	a[i].generation, a[j].generation = a[j].generation, a[i].generation
+	a[i].metageneration, a[j].metageneration = a[j].metageneration, a[i].metageneration
+	a[i].attrs, a[j].attrs = a[j].attrs, a[i].attrs
 }
 func (a ByName) Less(i, j int) bool { return strings.Compare(a[i].Name(), a[j].Name()) == -1 }
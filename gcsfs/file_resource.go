@@ -21,9 +21,12 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"math/rand"
 	"os"
 	"syscall"
 
+	"cloud.google.com/go/storage"
+
 	"github.com/spf13/afero/gcsfs/internal/stiface"
 )
 
@@ -51,9 +54,45 @@ type gcsFileResource struct {
 	reader         io.ReadCloser
 	writer         io.WriteCloser
 
+	// writerOptions override the WriterOptions of fs for this object.
+	writerOptions WriterOptions
+
+	// appendObj is the temporary object the writer uploads appended data
+	// to, composed with obj, whose attributes were appendAttrs, on commit.
+	appendObj   stiface.ObjectHandle
+	appendAttrs *storage.ObjectAttrs
+
+	// conds are the preconditions of the next commit, if any. Once it
+	// succeeded, they require the generation it created.
+	conds *storage.Conditions
+	// generation is the generation of obj read by OpenGeneration, if any.
+	generation int64
+
 	closed bool
 }
 
+// target returns the handle commits replace the object through.
+func (o *gcsFileResource) target() stiface.ObjectHandle {
+	if o.conds != nil {
+		return o.obj.If(*o.conds)
+	}
+	return o.obj
+}
+
+// committed moves the preconditions on to the generation in attrs, which
+// was just committed.
+func (o *gcsFileResource) committed(attrs *storage.ObjectAttrs) {
+	if o.conds != nil && attrs != nil {
+		o.conds = &storage.Conditions{GenerationMatch: attrs.Generation}
+	}
+}
+
+// newWriter returns a writer replacing the object, keeping the attributes
+// of its current version prev, if any.
+func (o *gcsFileResource) newWriter(prev *storage.ObjectAttrs) stiface.Writer {
+	return newWriter(o.ctx, o.target(), o.fs.writerOptions.merge(o.writerOptions), prev)
+}
+
 func (o *gcsFileResource) Close() error {
 	o.closed = true
 	// TODO rawGcsObjectsMap ?
@@ -62,10 +101,10 @@ func (o *gcsFileResource) Close() error {
 
 func (o *gcsFileResource) maybeCloseIo() error {
 	if err := o.maybeCloseReader(); err != nil {
-		return fmt.Errorf("error closing reader: %v", err)
+		return fmt.Errorf("error closing reader: %w", err)
 	}
 	if err := o.maybeCloseWriter(); err != nil {
-		return fmt.Errorf("error closing writer: %v", err)
+		return fmt.Errorf("error closing writer: %w", err)
 	}
 
 	return nil
@@ -106,15 +145,52 @@ func (o *gcsFileResource) maybeCloseWriter() error {
 		}
 	}
 
-	if err := o.writer.Close(); err != nil {
-		return err
+	if o.appendObj != nil {
+		return o.commitAppend()
 	}
+
+	w := o.writer
 	o.writer = nil
+	if err := w.Close(); err != nil {
+		return preconditionError(err)
+	}
+	if w, ok := w.(stiface.Writer); ok {
+		o.committed(w.Attrs())
+	}
+	return nil
+}
+
+// commitAppend uploads the appended data and composes the object with it.
+// The temporary object is removed in any case.
+func (o *gcsFileResource) commitAppend() error {
+	tmp, prev := o.appendObj, o.appendAttrs
+	o.appendObj, o.appendAttrs = nil, nil
+	// a leftover temporary object is harmless, so errors are ignored
+	defer tmp.Delete(o.ctx)
+
+	err := o.writer.Close()
+	o.writer = nil
+	if err != nil {
+		return err
+	}
+
+	c := o.target().ComposerFrom(o.obj, tmp)
+	attrs := c.ObjectAttrs()
+	attrs.ContentType = prev.ContentType
+	attrs.CacheControl = prev.CacheControl
+	attrs.ContentDisposition = prev.ContentDisposition
+	attrs.ContentLanguage = prev.ContentLanguage
+	attrs.Metadata = prev.Metadata
+	committed, err := c.Run(o.ctx)
+	if err != nil {
+		return fmt.Errorf("couldn't compose the appended data; it is NOT commited to GCS. %w", preconditionError(err))
+	}
+	o.committed(committed)
 	return nil
 }
 
 func (o *gcsFileResource) ReadAt(p []byte, off int64) (n int, err error) {
-	if cap(p) == 0 {
+	if len(p) == 0 {
 		return 0, nil
 	}
 
@@ -128,7 +204,7 @@ func (o *gcsFileResource) ReadAt(p []byte, off int64) (n int, err error) {
 
 	// we have to check, whether it's a folder; the folder must not have an open readers, or writers though,
 	// so this check should not be invoked excessively and cause too much of a performance drop
-	if o.reader == nil && o.writer == nil {
+	if o.reader == nil && o.writer == nil && o.generation == 0 {
 		var info *FileInfo
 		info, err = newFileInfo(o.name, o.fs, o.fileMode)
 		if err != nil {
@@ -173,7 +249,6 @@ func (o *gcsFileResource) WriteAt(b []byte, off int64) (n int, err error) {
 		return 0, err
 	}
 
-	w := o.obj.NewWriter(o.ctx)
 	// TRIGGER WARNING: This can seem like a hack but it works thanks
 	// to GCS strong consistency. We will open and write to the same file; First when the
 	// writer is closed will the content get committed to GCS.
@@ -200,6 +275,8 @@ func (o *gcsFileResource) WriteAt(b []byte, off int64) (n int, err error) {
 		return 0, ErrOutOfRange
 	}
 
+	w := o.newWriter(objAttrs)
+
 	if off > 0 {
 		var r stiface.Reader
 		r, err = o.obj.NewReader(o.ctx)
@@ -223,6 +300,44 @@ func (o *gcsFileResource) WriteAt(b []byte, off int64) (n int, err error) {
 	return written, err
 }
 
+// Append writes b at the end of the object. The data appended to a non
+// empty object is uploaded to a temporary object next to it, which is
+// composed with the object server-side on commit, so that appending does
+// not download the object like writing in its middle does.
+func (o *gcsFileResource) Append(b []byte) (n int, err error) {
+	// An open writer at the end, appending or not, can go on.
+	if o.writer != nil && o.offset >= o.currentGcsSize {
+		n, err = o.writer.Write(b)
+		o.offset += int64(n)
+		return n, err
+	}
+
+	if err = o.maybeCloseIo(); err != nil {
+		return 0, err
+	}
+
+	objAttrs, err := o.obj.Attrs(o.ctx)
+	if err == storage.ErrObjectNotExist || err == nil && objAttrs.Size == 0 {
+		return o.WriteAt(b, 0)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	tmp, err := o.fs.getObj(fmt.Sprintf("%s.afero-append-%x", o.name, rand.Int63()))
+	if err != nil {
+		return 0, err
+	}
+	o.writer = newWriter(o.ctx, tmp, o.fs.writerOptions.merge(o.writerOptions), nil)
+	o.appendObj, o.appendAttrs = tmp, objAttrs
+	o.currentGcsSize = objAttrs.Size
+	o.offset = objAttrs.Size
+
+	n, err = o.writer.Write(b)
+	o.offset += int64(n)
+	return n, err
+}
+
 func min(x, y int) int {
 	if x < y {
 		return x
@@ -244,7 +359,11 @@ func (o *gcsFileResource) Truncate(wantedSize int64) error {
 		return err
 	}
 
-	w := o.obj.NewWriter(o.ctx)
+	objAttrs, err := o.obj.Attrs(o.ctx)
+	if err != nil {
+		return err
+	}
+	w := o.newWriter(objAttrs)
 	written, err := io.Copy(w, r)
 	if err != nil {
 		return err
@@ -265,7 +384,8 @@ func (o *gcsFileResource) Truncate(wantedSize int64) error {
 		return fmt.Errorf("error closing reader: %v", err)
 	}
 	if err = w.Close(); err != nil {
-		return fmt.Errorf("error closing writer: %v", err)
+		return fmt.Errorf("error closing writer: %w", preconditionError(err))
 	}
+	o.committed(w.Attrs())
 	return nil
 }
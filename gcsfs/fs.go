@@ -19,12 +19,15 @@ package gcsfs
 import (
 	"context"
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 	"syscall"
 	"time"
 
+	"cloud.google.com/go/storage"
+
 	"github.com/spf13/afero/gcsfs/internal/stiface"
 )
 
@@ -43,6 +46,91 @@ type Fs struct {
 	rawGcsObjects map[string]*GcsFile
 
 	autoRemoveEmptyFolders bool // trigger for creating "virtual folders" (not required by GCSs)
+
+	writerOptions WriterOptions
+}
+
+// WriterOptions configure how objects are uploaded. The zero value keeps the
+// defaults of storage.Writer.
+//
+// When a write or a Truncate rewrites an existing object, its content type,
+// cache control, content disposition, content language and metadata are
+// carried over to the new version unless set here.
+type WriterOptions struct {
+	// ChunkSize is the size of the chunks uploads are split into, see
+	// storage.Writer. A negative value uploads objects in a single request,
+	// which uses less memory but cannot be retried.
+	ChunkSize int
+
+	ContentType  string
+	CacheControl string
+
+	// Metadata is merged into the metadata of the objects.
+	Metadata map[string]string
+
+	// Retry configures how failed requests are retried, see
+	// storage.ObjectHandle.Retryer.
+	Retry []storage.RetryOption
+}
+
+// merge returns o with the fields set in other overriding its own.
+func (o WriterOptions) merge(other WriterOptions) WriterOptions {
+	if other.ChunkSize != 0 {
+		o.ChunkSize = other.ChunkSize
+	}
+	if other.ContentType != "" {
+		o.ContentType = other.ContentType
+	}
+	if other.CacheControl != "" {
+		o.CacheControl = other.CacheControl
+	}
+	if len(other.Metadata) > 0 {
+		metadata := make(map[string]string, len(o.Metadata)+len(other.Metadata))
+		for k, v := range o.Metadata {
+			metadata[k] = v
+		}
+		for k, v := range other.Metadata {
+			metadata[k] = v
+		}
+		o.Metadata = metadata
+	}
+	if other.Retry != nil {
+		o.Retry = other.Retry
+	}
+	return o
+}
+
+// newWriter returns a writer for obj configured by opts. The attributes of
+// prev, the current version of the object if any, are kept where opts does
+// not set them.
+func newWriter(ctx context.Context, obj stiface.ObjectHandle, opts WriterOptions, prev *storage.ObjectAttrs) stiface.Writer {
+	if opts.Retry != nil {
+		obj = obj.Retryer(opts.Retry...)
+	}
+	w := obj.NewWriter(ctx)
+	attrs := w.ObjectAttrs()
+	if prev != nil {
+		attrs.ContentType = prev.ContentType
+		attrs.CacheControl = prev.CacheControl
+		attrs.ContentDisposition = prev.ContentDisposition
+		attrs.ContentLanguage = prev.ContentLanguage
+		attrs.Metadata = prev.Metadata
+	}
+	opts = WriterOptions{Metadata: attrs.Metadata}.merge(opts)
+	attrs.Metadata = opts.Metadata
+	if opts.ContentType != "" {
+		attrs.ContentType = opts.ContentType
+	}
+	if opts.CacheControl != "" {
+		attrs.CacheControl = opts.CacheControl
+	}
+	switch {
+	case opts.ChunkSize > 0:
+		w.SetChunkSize(opts.ChunkSize)
+	case opts.ChunkSize < 0:
+		w.SetChunkSize(0)
+	}
+	return w
 }
 
 func NewGcsFs(ctx context.Context, client stiface.Client) *Fs {
@@ -60,6 +148,24 @@ func NewGcsFsWithSeparator(ctx context.Context, client stiface.Client, folderSep
 	}
 }
 
+// WithContext returns a copy of fs whose operations, and the files opened
+// through it, use ctx instead of the context fs was created with. The copy
+// shares the client and the state of open files with fs.
+func (fs *Fs) WithContext(ctx context.Context) *Fs {
+	c := *fs
+	c.ctx = ctx
+	return &c
+}
+
+// WithWriterOptions returns a copy of fs uploading the objects written
+// through it with opts. Like WithContext, the copy shares the client and the
+// state of open files with fs.
+func (fs *Fs) WithWriterOptions(opts WriterOptions) *Fs {
+	c := *fs
+	c.writerOptions = opts
+	return &c
+}
+
 // normSeparators will normalize all "\\" and "/" to the provided separator
 func (fs *Fs) normSeparators(s string) string {
 	return strings.Replace(strings.Replace(s, "\\", fs.separator, -1), "/", fs.separator, -1)
@@ -126,6 +232,9 @@ func (fs *Fs) getObj(name string) (stiface.ObjectHandle, error) {
 
 func (fs *Fs) Name() string { return "GcsFs" }
 
+// PathSeparator returns the folder separator used for object names.
+func (fs *Fs) PathSeparator() string { return fs.separator }
+
 func (fs *Fs) Create(name string) (*GcsFile, error) {
 	name = fs.ensureNoLeadingSeparator(fs.normSeparators(ensureNoPrefix(name)))
 	if err := validateName(name); err != nil {
@@ -146,7 +255,7 @@ func (fs *Fs) Create(name string) (*GcsFile, error) {
 	if err != nil {
 		return nil, err
 	}
-	w := obj.NewWriter(fs.ctx)
+	w := newWriter(fs.ctx, obj, fs.writerOptions, nil)
 	err = w.Close()
 	if err != nil {
 		return nil, err
@@ -165,11 +274,11 @@ func (fs *Fs) Mkdir(name string, _ os.FileMode) error {
 	// folder creation logic has to additionally check for folder name presence
 	bucketName, path := fs.splitName(name)
 	if bucketName == "" {
-		return ErrNoBucketInName
+		return &os.PathError{Op: "mkdir", Path: name, Err: ErrNoBucketInName}
 	}
 	if path == "" {
 		// the API would throw "googleapi: Error 400: No object name, required", but this one is more consistent
-		return ErrEmptyObjectName
+		return &os.PathError{Op: "mkdir", Path: name, Err: ErrEmptyObjectName}
 	}
 
 	obj, err := fs.getObj(name)
@@ -188,11 +297,11 @@ func (fs *Fs) MkdirAll(path string, perm os.FileMode) error {
 	// folder creation logic has to additionally check for folder name presence
 	bucketName, splitPath := fs.splitName(path)
 	if bucketName == "" {
-		return ErrNoBucketInName
+		return &os.PathError{Op: "mkdir", Path: path, Err: ErrNoBucketInName}
 	}
 	if splitPath == "" {
 		// the API would throw "googleapi: Error 400: No object name, required", but this one is more consistent
-		return ErrEmptyObjectName
+		return &os.PathError{Op: "mkdir", Path: path, Err: ErrEmptyObjectName}
 	}
 
 	root := ""
@@ -221,7 +330,81 @@ func (fs *Fs) Open(name string) (*GcsFile, error) {
 	return fs.OpenFile(name, os.O_RDONLY, 0)
 }
 
+// OpenFile opens the object name. With O_CREATE|O_EXCL, the object is only
+// committed if it still does not exist then, so that concurrent creators do
+// not overwrite each other; the loser's Close fails with an error matching
+// ErrPreconditionFailed.
 func (fs *Fs) OpenFile(name string, flag int, fileMode os.FileMode) (*GcsFile, error) {
+	var conds *storage.Conditions
+	if flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL {
+		conds = &storage.Conditions{DoesNotExist: true}
+	}
+	return fs.openFile(name, flag, fileMode, conds)
+}
+
+// OpenFileIf is like OpenFile, but what is written is only committed if the
+// object meets conds, e.g. still has the generation it was read at:
+//
+//	fi, _ := fs.Stat(name)
+//	f, _ := fs.OpenFileIf(name, os.O_WRONLY|os.O_TRUNC, 0, storage.Conditions{
+//		GenerationMatch: fi.(*gcsfs.FileInfo).Generation(),
+//	})
+//
+// Writing, syncing or closing the file fails with an error matching
+// ErrPreconditionFailed if they are not met. After every commit, the
+// conditions move on to the generation it created, so one file can be
+// written and synced repeatedly.
+func (fs *Fs) OpenFileIf(name string, flag int, fileMode os.FileMode, conds storage.Conditions) (*GcsFile, error) {
+	return fs.openFile(name, flag, fileMode, &conds)
+}
+
+// OpenGeneration opens the given generation of the object name for
+// reading. The bucket must have object versioning enabled to keep
+// generations other than the latest one.
+func (fs *Fs) OpenGeneration(name string, generation int64) (*GcsFile, error) {
+	name = fs.ensureNoLeadingSeparator(fs.normSeparators(ensureNoPrefix(name)))
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+	obj, err := fs.getObj(name)
+	if err != nil {
+		return nil, err
+	}
+	file := NewGcsFile(fs.ctx, fs, obj.Generation(generation), os.O_RDONLY, defaultFileMode, name)
+	file.resource.generation = generation
+	if _, err := file.Stat(); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// ConditionalOpen opens the object name for reading if its ETag, as found
+// in the attributes returned by FileInfo.Sys, is ifMatch, and fails with
+// ErrPreconditionFailed otherwise. The file reads the generation which had
+// that ETag, even if the object is overwritten meanwhile.
+func (fs *Fs) ConditionalOpen(name, ifMatch string) (*GcsFile, error) {
+	name = fs.ensureNoLeadingSeparator(fs.normSeparators(ensureNoPrefix(name)))
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+	obj, err := fs.getObj(name)
+	if err != nil {
+		return nil, err
+	}
+	attrs, err := obj.Attrs(fs.ctx)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotExist) || err.Error() == ErrObjectDoesNotExist.Error() {
+			return nil, &os.PathError{Op: "open", Path: name, Err: ErrFileNotFound}
+		}
+		return nil, err
+	}
+	if attrs.Etag != ifMatch {
+		return nil, &os.PathError{Op: "open", Path: name, Err: ErrPreconditionFailed}
+	}
+	return fs.OpenGeneration(name, attrs.Generation)
+}
+
+func (fs *Fs) openFile(name string, flag int, fileMode os.FileMode, conds *storage.Conditions) (*GcsFile, error) {
 	var file *GcsFile
 	var err error
 
@@ -230,8 +413,10 @@ func (fs *Fs) OpenFile(name string, flag int, fileMode os.FileMode) (*GcsFile, e
 		return nil, err
 	}
 
+	// A file with conditions gets a resource of its own, as they apply to
+	// its commits only, and so does one opened with another context.
 	f, found := fs.rawGcsObjects[name]
-	if found {
+	if found && conds == nil && f.resource.ctx == fs.ctx {
 		file = NewGcsFileFromOldFH(flag, fileMode, f.resource)
 	} else {
 		var obj stiface.ObjectHandle
@@ -240,6 +425,7 @@ func (fs *Fs) OpenFile(name string, flag int, fileMode os.FileMode) (*GcsFile, e
 			return nil, err
 		}
 		file = NewGcsFile(fs.ctx, fs, obj, flag, fileMode, name)
+		file.resource.conds = conds
 	}
 
 	if flag == os.O_RDONLY {
@@ -250,8 +436,12 @@ func (fs *Fs) OpenFile(name string, flag int, fileMode os.FileMode) (*GcsFile, e
 	}
 
 	if flag&os.O_TRUNC != 0 {
+		if conds != nil {
+			return truncateIf(file, name, flag)
+		}
 		err = file.resource.obj.Delete(fs.ctx)
-		if err != nil {
+		missing := errors.Is(err, storage.ErrObjectNotExist) || errors.Is(err, os.ErrNotExist)
+		if err != nil && !(missing && flag&os.O_CREATE != 0) {
 			return nil, err
 		}
 		return fs.Create(name)
@@ -267,10 +457,16 @@ func (fs *Fs) OpenFile(name string, flag int, fileMode os.FileMode) (*GcsFile, e
 	if flag&os.O_CREATE != 0 {
 		_, err = file.Stat()
 		if err == nil { // the file actually exists
-			return nil, syscall.EPERM
+			if flag&(os.O_APPEND|os.O_EXCL) == os.O_APPEND {
+				// appending to an existing log file
+				return file, nil
+			}
+			return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EPERM}
 		}
 
-		_, err = file.WriteString("")
+		// open a writer right away, so the object gets created even if
+		// nothing is ever written to it
+		_, err = file.resource.WriteAt(nil, 0)
 		if err != nil {
 			return nil, err
 		}
@@ -278,6 +474,25 @@ func (fs *Fs) OpenFile(name string, flag int, fileMode os.FileMode) (*GcsFile, e
 	return file, nil
 }
 
+// truncateIf opens file for O_TRUNC with conditions: instead of deleting
+// the object right away, it is replaced when the file is committed, if they
+// are met.
+func truncateIf(file *GcsFile, name string, flag int) (*GcsFile, error) {
+	_, err := file.Stat()
+	switch {
+	case err == nil && flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL:
+		return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EPERM}
+	case err != nil && flag&os.O_CREATE == 0:
+		return nil, err
+	}
+	if _, err := file.resource.WriteAt(nil, 0); err != nil {
+		return nil, err
+	}
+	// nothing of the current object is kept
+	file.resource.currentGcsSize = 0
+	return file, nil
+}
+
 func (fs *Fs) Remove(name string) error {
 	name = fs.ensureNoLeadingSeparator(fs.normSeparators(ensureNoPrefix(name)))
 	if err := validateName(name); err != nil {
@@ -307,7 +522,7 @@ func (fs *Fs) Remove(name string) error {
 			return err
 		}
 		if len(infos) > 0 {
-			return syscall.ENOTEMPTY
+			return &os.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
 		}
 
 		// it's an empty folder, we can continue
@@ -400,13 +615,13 @@ func (fs *Fs) Stat(name string) (os.FileInfo, error) {
 }
 
 func (fs *Fs) Chmod(_ string, _ os.FileMode) error {
-	return errors.New("method Chmod is not implemented in GCS")
+	return fmt.Errorf("method Chmod is not implemented in GCS: %w", errors.ErrUnsupported)
 }
 
 func (fs *Fs) Chtimes(_ string, _, _ time.Time) error {
-	return errors.New("method Chtimes is not implemented. Create, Delete, Updated times are read only fields in GCS and set implicitly")
+	return fmt.Errorf("method Chtimes is not implemented. Create, Delete, Updated times are read only fields in GCS and set implicitly: %w", errors.ErrUnsupported)
 }
 
 func (fs *Fs) Chown(_ string, _, _ int) error {
-	return errors.New("method Chown is not implemented for GCS")
+	return fmt.Errorf("method Chown is not implemented for GCS: %w", errors.ErrUnsupported)
 }
@@ -18,6 +18,8 @@ package gcsfs
 
 import (
 	"context"
+	"net/http"
+	"net/url"
 	"os"
 	"time"
 
@@ -57,6 +59,42 @@ func NewGcsFSWithSeparator(ctx context.Context, folderSeparator string, opts ...
 	return NewGcsFSFromClientWithSeparator(ctx, client, folderSeparator)
 }
 
+// NewGcsFSWithEndpoint creates a GCS file system talking to the server at endpoint,
+// e.g. a fake-gcs-server emulator at "http://localhost:4443", instead of the GCS API.
+// The client sends no credentials and reads objects through the JSON API, which
+// emulators support best. A URL without a path gets the "/storage/v1/" path of the API.
+// opts are applied last, so option.WithHTTPClient or WithTransport can override
+// the HTTP transport, e.g. to trust the self-signed certificate of an emulator.
+//
+// Setting the STORAGE_EMULATOR_HOST env variable instead has the same effect on
+// every client created by the process.
+func NewGcsFSWithEndpoint(ctx context.Context, endpoint string, opts ...option.ClientOption) (afero.Fs, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/storage/v1/"
+	}
+	opts = append([]option.ClientOption{
+		option.WithEndpoint(u.String()),
+		option.WithoutAuthentication(),
+		storage.WithJSONReads(),
+	}, opts...)
+	client, err := storage.NewClient(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewGcsFSFromClient(ctx, client)
+}
+
+// WithTransport returns a client option making the storage client send its requests
+// through rt, without adding credentials to them.
+func WithTransport(rt http.RoundTripper) option.ClientOption {
+	return option.WithHTTPClient(&http.Client{Transport: rt})
+}
+
 // NewGcsFSFromClient creates a GCS file system from a given storage client
 func NewGcsFSFromClient(ctx context.Context, client *storage.Client) (afero.Fs, error) {
 	c := stiface.AdaptClient(client)
@@ -71,12 +109,41 @@ func NewGcsFSFromClientWithSeparator(ctx context.Context, client *storage.Client
 	return &GcsFs{NewGcsFsWithSeparator(ctx, c, folderSeparator)}, nil
 }
 
+// WithContext returns a GcsFs using ctx for its operations, so that deadlines
+// and cancellation can be applied to individual calls:
+//
+//	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+//	defer cancel()
+//	_, err := fs.WithContext(ctx).Stat(name)
+func (fs *GcsFs) WithContext(ctx context.Context) afero.Fs {
+	return &GcsFs{fs.source.WithContext(ctx)}
+}
+
+// OpenFileContext opens name like OpenFile, with ctx used for opening it
+// and for the requests of the file, so that ReadFileContext and the other
+// context helpers of afero can cancel them.
+func (fs *GcsFs) OpenFileContext(ctx context.Context, name string, flag int, perm os.FileMode) (afero.File, error) {
+	return fs.source.WithContext(ctx).OpenFile(name, flag, perm)
+}
+
+// WithWriterOptions returns a GcsFs uploading the objects written through it
+// with opts, e.g. to set their content type or chunk size:
+//
+//	fs.WithWriterOptions(gcsfs.WriterOptions{ContentType: "application/json"})
+func (fs *GcsFs) WithWriterOptions(opts WriterOptions) afero.Fs {
+	return &GcsFs{fs.source.WithWriterOptions(opts)}
+}
+
 // Wraps gcs.GcsFs and convert some return types to afero interfaces.
 
 func (fs *GcsFs) Name() string {
 	return fs.source.Name()
 }
 
+func (fs *GcsFs) PathSeparator() string {
+	return fs.source.PathSeparator()
+}
+
 func (fs *GcsFs) Create(name string) (afero.File, error) {
 	return fs.source.Create(name)
 }
@@ -97,6 +164,23 @@ func (fs *GcsFs) OpenFile(name string, flag int, perm os.FileMode) (afero.File,
 	return fs.source.OpenFile(name, flag, perm)
 }
 
+// OpenFileIf opens name like OpenFile, committing what is written only if
+// the object meets conds. See Fs.OpenFileIf.
+func (fs *GcsFs) OpenFileIf(name string, flag int, perm os.FileMode, conds storage.Conditions) (afero.File, error) {
+	return fs.source.OpenFileIf(name, flag, perm, conds)
+}
+
+// OpenGeneration opens the given generation of the object name for reading.
+func (fs *GcsFs) OpenGeneration(name string, generation int64) (afero.File, error) {
+	return fs.source.OpenGeneration(name, generation)
+}
+
+// ConditionalOpen opens name for reading if its ETag is ifMatch. See
+// Fs.ConditionalOpen.
+func (fs *GcsFs) ConditionalOpen(name, ifMatch string) (afero.File, error) {
+	return fs.source.ConditionalOpen(name, ifMatch)
+}
+
 func (fs *GcsFs) Remove(name string) error {
 	return fs.source.Remove(name)
 }
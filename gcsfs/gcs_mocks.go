@@ -12,12 +12,18 @@
 package gcsfs
 
 import (
+	"bytes"
 	"context"
+	"hash/crc32"
 	"io"
+	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"sync/atomic"
 
 	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/iterator"
 
 	"github.com/spf13/afero"
@@ -50,7 +56,10 @@ type bucketMock struct {
 	fs afero.Fs
 }
 
-func (m *bucketMock) Attrs(context.Context) (*storage.BucketAttrs, error) {
+func (m *bucketMock) Attrs(ctx context.Context) (*storage.BucketAttrs, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	return &storage.BucketAttrs{}, nil
 }
 
@@ -67,16 +76,65 @@ type objectMock struct {
 
 	name string
 	fs   afero.Fs
+
+	conds *storage.Conditions
+	gen   int64
 }
 
 func (o *objectMock) NewWriter(_ context.Context) stiface.Writer {
-	return &writerMock{name: o.name, fs: o.fs}
+	return &writerMock{name: o.name, fs: o.fs, conds: o.conds}
+}
+
+func (o *objectMock) If(conds storage.Conditions) stiface.ObjectHandle {
+	c := *o
+	c.conds = &conds
+	return &c
+}
+
+// Generation only finds the latest generation, as the mocks keep no others.
+func (o *objectMock) Generation(gen int64) stiface.ObjectHandle {
+	c := *o
+	c.gen = gen
+	return &c
+}
+
+// checkMockConds fails like GCS if the object name does not meet conds.
+func checkMockConds(fs afero.Fs, name string, conds *storage.Conditions) error {
+	if conds == nil {
+		return nil
+	}
+	var attrs storage.ObjectAttrs
+	if err := loadMockAttrs(fs, name, &attrs); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if (conds.DoesNotExist && attrs.Generation != 0) ||
+		(conds.GenerationMatch != 0 && conds.GenerationMatch != attrs.Generation) {
+		return &googleapi.Error{Code: http.StatusPreconditionFailed, Message: "conditionNotMet"}
+	}
+	return nil
+}
+
+// mockRetryers counts the calls to objectMock.Retryer.
+var mockRetryers int32
+
+func (o *objectMock) Retryer(...storage.RetryOption) stiface.ObjectHandle {
+	atomic.AddInt32(&mockRetryers, 1)
+	return o
+}
+
+func (o *objectMock) NewReader(ctx context.Context) (stiface.Reader, error) {
+	return o.NewRangeReader(ctx, 0, -1)
 }
 
 func (o *objectMock) NewRangeReader(_ context.Context, offset, length int64) (stiface.Reader, error) {
 	if o.name == "" {
 		return nil, ErrEmptyObjectName
 	}
+	if o.gen != 0 {
+		if _, err := o.Attrs(context.Background()); err != nil {
+			return nil, err
+		}
+	}
 
 	file, err := o.fs.Open(o.name)
 	if err != nil {
@@ -90,26 +148,32 @@ func (o *objectMock) NewRangeReader(_ context.Context, offset, length int64) (st
 		}
 	}
 
-	res := &readerMock{file: file}
-	if length > -1 {
-		res.buf = make([]byte, length)
-		_, err = file.Read(res.buf)
-		if err != nil {
-			return nil, err
-		}
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	res := &readerMock{file: file, remain: info.Size() - offset}
+	if length > -1 && length < res.remain {
+		res.remain = length
 	}
 
 	return res, nil
 }
 
-func (o *objectMock) Delete(_ context.Context) error {
+func (o *objectMock) Delete(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	if o.name == "" {
 		return ErrEmptyObjectName
 	}
 	return o.fs.Remove(o.name)
 }
 
-func (o *objectMock) Attrs(_ context.Context) (*storage.ObjectAttrs, error) {
+func (o *objectMock) Attrs(ctx context.Context) (*storage.ObjectAttrs, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	if o.name == "" {
 		return nil, ErrEmptyObjectName
 	}
@@ -133,16 +197,125 @@ func (o *objectMock) Attrs(_ context.Context) (*storage.ObjectAttrs, error) {
 		return nil, ErrObjectDoesNotExist
 	}
 
+	if err := loadMockAttrs(o.fs, o.name, res); err != nil {
+		return nil, err
+	}
+	if o.gen != 0 && o.gen != res.Generation {
+		return nil, storage.ErrObjectNotExist
+	}
+	// the ETag changes with every generation, like that of GCS
+	res.Etag = "CL" + strconv.FormatInt(res.Generation, 36)
+	data, err := afero.ReadFile(o.fs, o.name)
+	if err != nil {
+		return nil, err
+	}
+	res.CRC32C = crc32.Checksum(data, crc32.MakeTable(crc32.Castagnoli))
+
 	return res, nil
 }
 
+func (o *objectMock) CopierFrom(src stiface.ObjectHandle) stiface.Copier {
+	return &copierMock{dst: o, src: src.(*objectMock)}
+}
+
+// mockCopies counts the server-side copies run by copierMock.
+var mockCopies int32
+
+type copierMock struct {
+	stiface.Copier
+
+	dst, src *objectMock
+}
+
+func (c *copierMock) Run(ctx context.Context) (*storage.ObjectAttrs, error) {
+	if _, err := c.src.Attrs(ctx); err != nil {
+		return nil, err
+	}
+	data, err := afero.ReadFile(c.src.fs, c.src.name)
+	if err != nil {
+		return nil, err
+	}
+	if err := afero.WriteFile(c.dst.fs, c.dst.name, data, 0o644); err != nil {
+		return nil, err
+	}
+	atomic.AddInt32(&mockCopies, 1)
+	return c.dst.Attrs(ctx)
+}
+
+func (o *objectMock) ComposerFrom(srcs ...stiface.ObjectHandle) stiface.Composer {
+	c := &composerMock{dst: o}
+	for _, src := range srcs {
+		c.srcs = append(c.srcs, src.(*objectMock))
+	}
+	return c
+}
+
+// mockComposes counts the compositions run by composerMock.
+var mockComposes int32
+
+type composerMock struct {
+	stiface.Composer
+
+	dst   *objectMock
+	srcs  []*objectMock
+	attrs storage.ObjectAttrs
+}
+
+func (c *composerMock) ObjectAttrs() *storage.ObjectAttrs {
+	return &c.attrs
+}
+
+func (c *composerMock) Run(ctx context.Context) (*storage.ObjectAttrs, error) {
+	if err := checkMockConds(c.dst.fs, c.dst.name, c.dst.conds); err != nil {
+		return nil, err
+	}
+	var data []byte
+	for _, src := range c.srcs {
+		if _, err := src.Attrs(ctx); err != nil {
+			return nil, err
+		}
+		b, err := afero.ReadFile(src.fs, src.name)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, b...)
+	}
+	if err := afero.WriteFile(c.dst.fs, c.dst.name, data, 0o644); err != nil {
+		return nil, err
+	}
+	if err := saveMockAttrs(c.dst.fs, c.dst.name, &c.attrs); err != nil {
+		return nil, err
+	}
+	atomic.AddInt32(&mockComposes, 1)
+	return c.dst.Attrs(ctx)
+}
+
+// mockChunkSize is the chunk size last set on a writerMock.
+var mockChunkSize int32
+
 type writerMock struct {
 	stiface.Writer
 
-	name string
-	fs   afero.Fs
+	name  string
+	fs    afero.Fs
+	conds *storage.Conditions
 
-	file afero.File
+	attrs storage.ObjectAttrs
+	// buf holds the content until Close commits it, like GCS does, so that
+	// the object can be read while it is being rewritten.
+	buf *bytes.Buffer
+}
+
+func (w *writerMock) ObjectAttrs() *storage.ObjectAttrs {
+	return &w.attrs
+}
+
+func (w *writerMock) Attrs() *storage.ObjectAttrs {
+	return &w.attrs
+}
+
+func (w *writerMock) SetChunkSize(size int) {
+	atomic.StoreInt32(&mockChunkSize, int32(size))
 }
 
 func (w *writerMock) Write(p []byte) (n int, err error) {
@@ -150,36 +323,113 @@ func (w *writerMock) Write(p []byte) (n int, err error) {
 		return 0, ErrEmptyObjectName
 	}
 
-	if w.file == nil {
-		w.file, err = w.fs.Create(w.name)
-		if err != nil {
-			return 0, err
-		}
+	if w.buf == nil {
+		w.buf = new(bytes.Buffer)
 	}
 
-	return w.file.Write(p)
+	return w.buf.Write(p)
 }
 
 func (w *writerMock) Close() error {
 	if w.name == "" {
 		return ErrEmptyObjectName
 	}
-	if w.file == nil {
-		var err error
-		if strings.HasSuffix(w.name, "/") {
-			err = w.fs.Mkdir(w.name, 0o755)
-			if err != nil {
-				return err
-			}
-		} else {
-			_, err = w.Write([]byte{})
-			if err != nil {
-				return err
-			}
+	if w.buf == nil && strings.HasSuffix(w.name, "/") {
+		return w.fs.Mkdir(w.name, 0o755)
+	}
+	if err := checkMockConds(w.fs, w.name, w.conds); err != nil {
+		return err
+	}
+	file, err := w.fs.Create(w.name)
+	if err != nil {
+		return err
+	}
+	if w.buf != nil {
+		if _, err := file.Write(w.buf.Bytes()); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return saveMockAttrs(w.fs, w.name, &w.attrs)
+}
+
+// The attributes of objects are kept in extended attributes of their files.
+const (
+	mockContentType        = "user.content-type"
+	mockCacheControl       = "user.cache-control"
+	mockContentDisposition = "user.content-disposition"
+	mockContentLanguage    = "user.content-language"
+	mockMetadataPrefix     = "user.metadata."
+	mockGeneration         = "user.generation"
+)
+
+// mockGenerations numbers the generations saved by saveMockAttrs.
+var mockGenerations int64
+
+func saveMockAttrs(fs afero.Fs, name string, attrs *storage.ObjectAttrs) error {
+	old, err := afero.ListXattr(fs, name)
+	if err != nil {
+		return err
+	}
+	for _, attr := range old {
+		if err := afero.RemoveXattr(fs, name, attr); err != nil {
+			return err
 		}
 	}
-	if w.file != nil {
-		return w.file.Close()
+	attrs.Generation = atomic.AddInt64(&mockGenerations, 1)
+	attrs.Metageneration = 1
+	values := map[string]string{
+		mockGeneration:         strconv.FormatInt(attrs.Generation, 10),
+		mockContentType:        attrs.ContentType,
+		mockCacheControl:       attrs.CacheControl,
+		mockContentDisposition: attrs.ContentDisposition,
+		mockContentLanguage:    attrs.ContentLanguage,
+	}
+	for k, v := range attrs.Metadata {
+		values[mockMetadataPrefix+k] = v
+	}
+	for attr, value := range values {
+		if value == "" {
+			continue
+		}
+		if err := afero.SetXattr(fs, name, attr, []byte(value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loadMockAttrs(fs afero.Fs, name string, attrs *storage.ObjectAttrs) error {
+	names, err := afero.ListXattr(fs, name)
+	if err != nil {
+		return err
+	}
+	for _, attr := range names {
+		value, err := afero.GetXattr(fs, name, attr)
+		if err != nil {
+			return err
+		}
+		switch attr {
+		case mockGeneration:
+			attrs.Generation, _ = strconv.ParseInt(string(value), 10, 64)
+			attrs.Metageneration = 1
+		case mockContentType:
+			attrs.ContentType = string(value)
+		case mockCacheControl:
+			attrs.CacheControl = string(value)
+		case mockContentDisposition:
+			attrs.ContentDisposition = string(value)
+		case mockContentLanguage:
+			attrs.ContentLanguage = string(value)
+		default:
+			if attrs.Metadata == nil {
+				attrs.Metadata = make(map[string]string)
+			}
+			attrs.Metadata[strings.TrimPrefix(attr, mockMetadataPrefix)] = string(value)
+		}
 	}
 	return nil
 }
@@ -189,19 +439,23 @@ type readerMock struct {
 
 	file afero.File
 
-	buf []byte
+	remain int64
 }
 
 func (r *readerMock) Remain() int64 {
-	return 0
+	return r.remain
 }
 
 func (r *readerMock) Read(p []byte) (int, error) {
-	if r.buf != nil {
-		copy(p, r.buf)
-		return len(r.buf), nil
+	if r.remain <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > r.remain {
+		p = p[:r.remain]
 	}
-	return r.file.Read(p)
+	n, err := r.file.Read(p)
+	r.remain -= int64(n)
+	return n, err
 }
 
 func (r *readerMock) Close() error {
@@ -214,8 +468,16 @@ type objectItMock struct {
 	name string
 	fs   afero.Fs
 
-	dir   afero.File
-	infos []*storage.ObjectAttrs
+	dir      afero.File
+	infos    []*storage.ObjectAttrs
+	pageInfo *iterator.PageInfo
+}
+
+func (it *objectItMock) PageInfo() *iterator.PageInfo {
+	if it.pageInfo == nil {
+		it.pageInfo = &iterator.PageInfo{}
+	}
+	return it.pageInfo
 }
 
 func (it *objectItMock) Next() (*storage.ObjectAttrs, error) {
@@ -6,14 +6,20 @@
 package gcsfs
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
 	"reflect"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"testing"
 
@@ -21,6 +27,7 @@ import (
 	"golang.org/x/oauth2/google"
 
 	"github.com/spf13/afero"
+	"github.com/spf13/afero/aferotest"
 	"github.com/spf13/afero/gcsfs/internal/stiface"
 )
 
@@ -69,7 +76,7 @@ func TestMain(m *testing.M) {
 
 	// in order to respect deferring
 	var exitCode int
-	defer os.Exit(exitCode)
+	defer func() { os.Exit(exitCode) }()
 
 	defer func() {
 		err := recover()
@@ -576,6 +583,11 @@ func TestGcsReaddir(t *testing.T) {
 				t.Errorf("%v: children, got '%v', expected '%v'", name, fileNames, d.children)
 			}
 
+			// a listing does not start over, read it from a new handle
+			dir, err = gcsAfs.Open(name)
+			if err != nil {
+				t.Fatal(err)
+			}
 			fi, err = dir.Readdir(1)
 			if err != nil {
 				t.Fatal(err)
@@ -612,6 +624,52 @@ func TestGcsReaddir(t *testing.T) {
 	}
 }
 
+func TestGcsReaddirBatches(t *testing.T) {
+	createFiles(t)
+	defer removeFiles(t)
+
+	for _, d := range dirs {
+		name := filepath.Join(bucketName, d.name)
+		dir, err := gcsAfs.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var fileNames []string
+		for {
+			fi, err := dir.Readdir(2)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(fi) == 0 || len(fi) > 2 {
+				t.Fatalf("%v: got a batch of %d entries", name, len(fi))
+			}
+			for _, f := range fi {
+				fileNames = append(fileNames, f.Name())
+			}
+		}
+		if !reflect.DeepEqual(fileNames, d.children) {
+			t.Errorf("%v: children, got '%v', expected '%v'", name, fileNames, d.children)
+		}
+
+		if len(d.children) >= 2 {
+			aferotest.CheckReaddir(t, gcsAfs, name)
+		}
+
+		// the listing stays at its end
+		if entries, err := dir.(fs.ReadDirFile).ReadDir(1); len(entries) != 0 || err != io.EOF {
+			t.Errorf("%v: ReadDir(1) after EOF, got %v, %v", name, entries, err)
+		}
+		if entries, err := dir.(fs.ReadDirFile).ReadDir(-1); len(entries) != 0 || err != nil {
+			t.Errorf("%v: ReadDir(-1) after EOF, got %v, %v", name, entries, err)
+		}
+		dir.Close()
+	}
+}
+
 func TestGcsReaddirnames(t *testing.T) {
 	createFiles(t)
 	defer removeFiles(t)
@@ -639,6 +697,11 @@ func TestGcsReaddirnames(t *testing.T) {
 				t.Errorf("%v: children, got '%v', expected '%v'", name, fileNames, d.children)
 			}
 
+			// a listing does not start over, read it from a new handle
+			dir, err = gcsAfs.Open(name)
+			if err != nil {
+				t.Fatal(err)
+			}
 			fileNames, err = dir.Readdirnames(1)
 			if err != nil {
 				t.Fatal(err)
@@ -836,3 +899,448 @@ func TestGcsRemoveAll(t *testing.T) {
 		}
 	})
 }
+
+func TestGcsPathSeparator(t *testing.T) {
+	if sep := afero.PathSeparatorOf(gcsAfs.Fs); sep != "/" {
+		t.Fatalf("got separator %q, want %q", sep, "/")
+	}
+	rel, err := afero.Rel(gcsAfs.Fs, bucketName+"/a", bucketName+"/a/b/c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rel != "b/c" {
+		t.Errorf("got %q, want %q", rel, "b/c")
+	}
+}
+
+func TestGcsWithContext(t *testing.T) {
+	createFiles(t)
+	defer removeFiles(t)
+
+	name := filepath.Join(bucketName, "testFile")
+	ctx, cancel := context.WithCancel(context.Background())
+	cfs := gcsAfs.Fs.(*GcsFs).WithContext(ctx)
+
+	if _, err := cfs.Stat(name); err != nil {
+		t.Fatalf("Stat with a live context: %v", err)
+	}
+	if _, err := afero.ReadFileContext(ctx, gcsAfs.Fs, name); err != nil {
+		t.Fatalf("ReadFileContext with a live context: %v", err)
+	}
+	cancel()
+	if _, err := gcsAfs.Fs.(*GcsFs).OpenFileContext(ctx, name, os.O_RDONLY, 0); !errors.Is(err, context.Canceled) {
+		t.Errorf("OpenFileContext with a canceled context: got %v, want %v", err, context.Canceled)
+	}
+	if _, err := cfs.Stat(name); !errors.Is(err, context.Canceled) {
+		t.Errorf("Stat with a canceled context: got %v, want %v", err, context.Canceled)
+	}
+	if err := cfs.Remove(name); !errors.Is(err, context.Canceled) {
+		t.Errorf("Remove with a canceled context: got %v, want %v", err, context.Canceled)
+	}
+
+	// The original fs is not affected.
+	if _, err := gcsAfs.Stat(name); err != nil {
+		t.Errorf("Stat on the original fs: %v", err)
+	}
+}
+
+func TestGcsServerSideCopy(t *testing.T) {
+	createFiles(t)
+	defer removeFiles(t)
+
+	srcName := filepath.Join(bucketName, "testFile")
+	want, err := gcsAfs.ReadFile(srcName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	copyTo := func(dstName string, prepare func(afero.File)) int32 {
+		t.Helper()
+		src, err := gcsAfs.Open(srcName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer src.Close()
+		dst, err := gcsAfs.Create(dstName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if prepare != nil {
+			prepare(dst)
+		}
+		before := atomic.LoadInt32(&mockCopies)
+		n, err := io.Copy(dst, src)
+		if err != nil {
+			t.Fatalf("io.Copy: %v", err)
+		}
+		if n != int64(len(want)) {
+			t.Errorf("io.Copy copied %d bytes, want %d", n, len(want))
+		}
+		if err := dst.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return atomic.LoadInt32(&mockCopies) - before
+	}
+
+	dstName := filepath.Join(bucketName, "copied")
+	defer gcsAfs.Remove(dstName)
+	if copies := copyTo(dstName, nil); copies != 1 {
+		t.Errorf("%d server-side copies, want 1", copies)
+	}
+	if got, err := gcsAfs.ReadFile(dstName); err != nil || !bytes.Equal(got, want) {
+		t.Errorf("copy = %q, %v, want %q", got, err, want)
+	}
+
+	// A file which is not empty is written by streaming.
+	if copies := copyTo(dstName, func(f afero.File) { f.WriteString("prefix") }); copies != 0 {
+		t.Errorf("%d server-side copies into a non-empty file, want 0", copies)
+	}
+	if got, err := gcsAfs.ReadFile(dstName); err != nil || string(got) != "prefix"+string(want) {
+		t.Errorf("copy = %q, %v, want %q", got, err, "prefix"+string(want))
+	}
+}
+
+func TestGcsAppend(t *testing.T) {
+	createFiles(t)
+	defer removeFiles(t)
+
+	name := filepath.Join(bucketName, "append.log")
+	defer gcsAfs.Remove(name)
+	withType := gcsAfs.Fs.(*GcsFs).WithWriterOptions(WriterOptions{ContentType: "text/plain"})
+	if err := afero.WriteFile(withType, name, []byte("first\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := gcsAfs.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatalf("opening an existing file for appending: %v", err)
+	}
+	composes := atomic.LoadInt32(&mockComposes)
+	// writes go to the end wherever the offset is
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"second\n", "third\n"} {
+		if _, err := f.WriteString(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := f.WriteAt([]byte("x"), 0); !errors.Is(err, ErrWriteAtInAppendMode) {
+		t.Errorf("WriteAt = %v, want ErrWriteAtInAppendMode", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&mockComposes) - composes; n != 1 {
+		t.Errorf("%d compositions, want 1", n)
+	}
+	if got, err := gcsAfs.ReadFile(name); err != nil || string(got) != "first\nsecond\nthird\n" {
+		t.Errorf("content = %q, %v", got, err)
+	}
+
+	obj, err := gcsAfs.Fs.(*GcsFs).source.getObj(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attrs, err := obj.Attrs(context.Background()); err != nil || attrs.ContentType != "text/plain" {
+		t.Errorf("attributes after appending = %+v, %v, want the content type kept", attrs, err)
+	}
+	names, err := gcsAfs.ReadDir(bucketName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fi := range names {
+		if strings.Contains(fi.Name(), ".afero-append-") {
+			t.Errorf("temporary object %s left behind", fi.Name())
+		}
+	}
+
+	// appending to a missing file creates it
+	created := filepath.Join(bucketName, "created.log")
+	defer gcsAfs.Remove(created)
+	f, err = gcsAfs.OpenFile(created, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("one\n")
+	f.WriteString("two\n")
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := gcsAfs.ReadFile(created); err != nil || string(got) != "one\ntwo\n" {
+		t.Errorf("content = %q, %v", got, err)
+	}
+}
+
+func TestGcsGenerations(t *testing.T) {
+	gfs := gcsAfs.Fs.(*GcsFs)
+	name := filepath.Join(bucketName, "generations.txt")
+	defer gcsAfs.Remove(name)
+
+	if err := gcsAfs.WriteFile(name, []byte("v1"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := gcsAfs.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := fi.(*FileInfo).Generation()
+	if gen == 0 || fi.(*FileInfo).Metageneration() == 0 {
+		t.Fatalf("Stat = generation %d, metageneration %d", gen, fi.(*FileInfo).Metageneration())
+	}
+
+	// a conditional write succeeds once, then the generation moved on
+	write := func(content string, conds storage.Conditions) error {
+		f, err := gfs.OpenFileIf(name, os.O_WRONLY|os.O_TRUNC, 0o644, conds)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write([]byte(content)); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+	if err := write("v2", storage.Conditions{GenerationMatch: gen}); err != nil {
+		t.Fatal(err)
+	}
+	if err := write("v3", storage.Conditions{GenerationMatch: gen}); !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("writing with a stale generation = %v, want ErrPreconditionFailed", err)
+	}
+	if got, _ := gcsAfs.ReadFile(name); string(got) != "v2" {
+		t.Errorf("content = %q, want v2", got)
+	}
+
+	// one file commits repeatedly, each time at the generation it created
+	fi, _ = gcsAfs.Stat(name)
+	f, err := gfs.OpenFileIf(name, os.O_WRONLY|os.O_TRUNC, 0o644, storage.Conditions{GenerationMatch: fi.(*FileInfo).Generation()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("v3"))
+	if err := f.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("v4"))
+	if err := f.Close(); err != nil {
+		t.Errorf("second commit = %v", err)
+	}
+	if got, _ := gcsAfs.ReadFile(name); string(got) != "v3v4" {
+		t.Errorf("content = %q, want v3v4", got)
+	}
+
+	// only one of two exclusive creators wins
+	created := filepath.Join(bucketName, "exclusive.txt")
+	defer gcsAfs.Remove(created)
+	first, err := gcsAfs.OpenFile(created, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := gcsAfs.OpenFile(created, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.Write([]byte("first"))
+	second.Write([]byte("second"))
+	if err := first.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Close(); !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("second exclusive create = %v, want ErrPreconditionFailed", err)
+	}
+	if got, _ := gcsAfs.ReadFile(created); string(got) != "first" {
+		t.Errorf("content = %q, want first", got)
+	}
+
+	// reading a generation
+	fi, _ = gcsAfs.Stat(name)
+	gen = fi.(*FileInfo).Generation()
+	g, err := gfs.OpenGeneration(name, gen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := io.ReadAll(g); err != nil || string(got) != "v3v4" {
+		t.Errorf("generation %d = %q, %v", gen, got, err)
+	}
+	if gi, err := g.Stat(); err != nil || gi.(*FileInfo).Generation() != gen {
+		t.Errorf("Stat of generation %d = %v, %v", gen, gi, err)
+	}
+	g.Close()
+	if _, err := gfs.OpenGeneration(name, gen-1); err == nil {
+		t.Error("opened a generation which is gone")
+	}
+}
+
+func TestGcsConditionalOpen(t *testing.T) {
+	gfs := gcsAfs.Fs.(*GcsFs)
+	name := filepath.Join(bucketName, "etag.txt")
+	defer gcsAfs.Remove(name)
+
+	withMeta := gfs.WithWriterOptions(WriterOptions{ContentType: "text/plain", Metadata: map[string]string{"owner": "tests"}})
+	if err := afero.WriteFile(withMeta, name, []byte("v1"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := gcsAfs.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attrs, ok := fi.Sys().(*storage.ObjectAttrs)
+	if !ok {
+		t.Fatalf("Sys = %T, want *storage.ObjectAttrs", fi.Sys())
+	}
+	if attrs.Etag == "" || attrs.CRC32C == 0 || attrs.ContentType != "text/plain" || attrs.Metadata["owner"] != "tests" {
+		t.Errorf("Sys = %+v", attrs)
+	}
+	if dir, _ := gcsAfs.Stat(bucketName); dir.Sys() != nil {
+		t.Errorf("Sys of a folder = %v, want nil", dir.Sys())
+	}
+
+	f, err := gfs.ConditionalOpen(name, attrs.Etag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := io.ReadAll(f); err != nil || string(got) != "v1" {
+		t.Errorf("reading = %q, %v, want v1", got, err)
+	}
+	f.Close()
+
+	if err := gcsAfs.WriteFile(name, []byte("v2"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := gfs.ConditionalOpen(name, attrs.Etag); !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("opening with a stale ETag = %v, want ErrPreconditionFailed", err)
+	}
+	if _, err := gfs.ConditionalOpen(filepath.Join(bucketName, "missing.txt"), attrs.Etag); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("opening a missing object = %v, want ErrNotExist", err)
+	}
+}
+
+func TestGcsWriterOptions(t *testing.T) {
+	createFiles(t)
+	defer removeFiles(t)
+
+	name := filepath.Join(bucketName, "withAttrs")
+	defer gcsAfs.Remove(name)
+	attrs := func() *storage.ObjectAttrs {
+		t.Helper()
+		obj, err := gcsAfs.Fs.(*GcsFs).source.getObj(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := obj.Attrs(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	retryers := atomic.LoadInt32(&mockRetryers)
+	wfs := gcsAfs.Fs.(*GcsFs).WithWriterOptions(WriterOptions{
+		ChunkSize:   1 << 20,
+		ContentType: "text/plain",
+		Metadata:    map[string]string{"owner": "a"},
+		Retry:       []storage.RetryOption{storage.WithPolicy(storage.RetryAlways)},
+	})
+	if err := afero.WriteFile(wfs, name, []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if size := atomic.LoadInt32(&mockChunkSize); size != 1<<20 {
+		t.Errorf("chunk size = %d, want %d", size, 1<<20)
+	}
+	if atomic.LoadInt32(&mockRetryers) == retryers {
+		t.Error("the retry options were not applied")
+	}
+	if a := attrs(); a.ContentType != "text/plain" || a.Metadata["owner"] != "a" {
+		t.Errorf("attrs = %q, %v", a.ContentType, a.Metadata)
+	}
+
+	// A partial write through an Fs without options keeps the attributes.
+	f, err := gcsAfs.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte("L"), 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if a := attrs(); a.ContentType != "text/plain" || a.Metadata["owner"] != "a" {
+		t.Errorf("attrs after WriteAt = %q, %v", a.ContentType, a.Metadata)
+	}
+
+	f.(*GcsFile).SetWriterOptions(WriterOptions{
+		CacheControl: "no-cache",
+		Metadata:     map[string]string{"stage": "done"},
+	})
+	if err := f.Truncate(3); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	a := attrs()
+	if a.ContentType != "text/plain" || a.CacheControl != "no-cache" {
+		t.Errorf("attrs after Truncate = %q, %q", a.ContentType, a.CacheControl)
+	}
+	if want := map[string]string{"owner": "a", "stage": "done"}; !reflect.DeepEqual(a.Metadata, want) {
+		t.Errorf("metadata = %v, want %v", a.Metadata, want)
+	}
+	if got, err := gcsAfs.ReadFile(name); err != nil || string(got) != "heL" {
+		t.Errorf("content = %q, %v, want %q", got, err, "heL")
+	}
+}
+
+func TestGcsFsWithEndpoint(t *testing.T) {
+	var requests, authorized atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.Header.Get("Authorization") != "" {
+			authorized.Add(1)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/storage/v1/b/bucket":
+			fmt.Fprint(w, `{"name": "bucket"}`)
+		case r.URL.Path == "/storage/v1/b/bucket/o/file":
+			fmt.Fprint(w, `{"bucket": "bucket", "name": "file", "size": "5"}`)
+		case r.URL.Path == "/storage/v1/b/bucket/o":
+			fmt.Fprint(w, `{"kind": "storage#objects"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error": {"code": 404, "message": "not found"}}`)
+		}
+	}))
+	defer srv.Close()
+
+	fs, err := NewGcsFSWithEndpoint(context.Background(), srv.URL, WithTransport(srv.Client().Transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := fs.Stat("bucket/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() != 5 || fi.IsDir() {
+		t.Errorf("Stat = size %d, dir %v, want a file of 5 bytes", fi.Size(), fi.IsDir())
+	}
+	if _, err := fs.Stat("bucket/missing"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Stat of a missing object = %v, want ErrNotExist", err)
+	}
+	if requests.Load() == 0 {
+		t.Error("no request reached the endpoint")
+	}
+	if n := authorized.Load(); n != 0 {
+		t.Errorf("%d requests carried credentials", n)
+	}
+
+	// the same through the gs scheme, rooted at the bucket
+	fs, err = afero.OpenURL(context.Background(), "gs://bucket?endpoint="+url.QueryEscape(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := fs.Stat("/file"); err != nil || fi.Size() != 5 {
+		t.Errorf("Stat through a gs URL = %v, %v", fi, err)
+	}
+}
@@ -138,6 +138,10 @@ func (o objectHandle) ComposerFrom(srcs ...ObjectHandle) Composer {
 	return composer{o.ObjectHandle.ComposerFrom(objs...)}
 }
 
+func (o objectHandle) Retryer(opts ...storage.RetryOption) ObjectHandle {
+	return objectHandle{o.ObjectHandle.Retryer(opts...)}
+}
+
 func (w writer) ObjectAttrs() *storage.ObjectAttrs {
 	return &w.Writer.ObjectAttrs
 }
@@ -44,6 +44,7 @@ type ObjectHandle interface {
 	Delete(context.Context) error
 	CopierFrom(ObjectHandle) Copier
 	ComposerFrom(...ObjectHandle) Composer
+	Retryer(...storage.RetryOption) ObjectHandle
 
 	embedToIncludeNewMethods()
 }
@@ -0,0 +1,32 @@
+package gcsfs
+
+import (
+	"context"
+	"net/url"
+	"path"
+
+	"github.com/spf13/afero"
+)
+
+// The gs scheme opens gs://bucket/prefix with afero.OpenURL, rooted at the
+// prefix in the bucket, or all buckets for gs:// alone. The client uses the
+// default credentials, or talks to an emulator given as endpoint parameter,
+// as in gs://bucket?endpoint=http://localhost:4443.
+func init() {
+	afero.RegisterScheme("gs", func(ctx context.Context, u *url.URL) (afero.Fs, error) {
+		var fs afero.Fs
+		var err error
+		if endpoint := u.Query().Get("endpoint"); endpoint != "" {
+			fs, err = NewGcsFSWithEndpoint(ctx, endpoint)
+		} else {
+			fs, err = NewGcsFS(ctx)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if root := path.Join("/", u.Host, u.Path); root != "/" {
+			fs = afero.NewBasePathFs(fs, root)
+		}
+		return fs, nil
+	})
+}
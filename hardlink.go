@@ -0,0 +1,32 @@
+package afero
+
+import (
+	"errors"
+	"os"
+)
+
+// HardLinker is an optional interface in Afero. It is only implemented by the
+// filesystems saying so.
+// It will call Link if the filesystem itself is, or it delegates to, the os
+// filesystem, or the filesystem otherwise supports hard links.
+type HardLinker interface {
+	LinkIfPossible(oldname, newname string) error
+}
+
+// ErrNoLink is the error that will be wrapped in an os.LinkError if a file
+// system does not support hard links either directly or through its
+// delegated filesystem.
+var ErrNoLink = errors.New("hard link not supported")
+
+// Link creates newname as a hard link to the oldname file. It returns an
+// *os.LinkError wrapping ErrNoLink if fs does not support hard links.
+func Link(fs Fs, oldname, newname string) error {
+	if l, ok := fs.(HardLinker); ok {
+		return l.LinkIfPossible(oldname, newname)
+	}
+	return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: ErrNoLink}
+}
+
+func (a Afero) Link(oldname, newname string) error {
+	return Link(a.Fs, oldname, newname)
+}
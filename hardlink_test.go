@@ -0,0 +1,66 @@
+package afero
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func TestLink(t *testing.T) {
+	defer removeAllTestFiles(t)
+	for _, fs := range Fss {
+		dir := testDir(fs)
+		oldname := filepath.Join(dir, "file")
+		newname := filepath.Join(dir, "link")
+		if err := WriteFile(fs, oldname, []byte("hello"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := Link(fs, oldname, newname); err != nil {
+			t.Fatalf("%s: Link: %v", fs.Name(), err)
+		}
+		f, err := fs.OpenFile(newname, os.O_WRONLY|os.O_APPEND, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.WriteString(" world")
+		f.Close()
+		if got, err := ReadFile(fs, oldname); err != nil || string(got) != "hello world" {
+			t.Errorf("%s: write through the link not visible: %q, %v", fs.Name(), got, err)
+		}
+
+		if err := fs.Remove(oldname); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := ReadFile(fs, newname); err != nil || string(got) != "hello world" {
+			t.Errorf("%s: link lost its content: %q, %v", fs.Name(), got, err)
+		}
+
+		if err := Link(fs, dir, filepath.Join(dir, "dirlink")); err == nil {
+			t.Errorf("%s: hard link to a directory succeeded", fs.Name())
+		}
+		if err := WriteFile(fs, oldname, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := Link(fs, oldname, newname); !os.IsExist(err) {
+			t.Errorf("%s: link over existing file: got %v, want exist error", fs.Name(), err)
+		}
+	}
+}
+
+func TestLinkNotSupported(t *testing.T) {
+	mem := &MemMapFs{}
+	WriteFile(mem, "/file.txt", []byte("x"), 0o644)
+
+	for _, fs := range []Fs{NewReadOnlyFs(mem), NewRegexpFs(mem, regexp.MustCompile(`\.txt$`))} {
+		if err := Link(fs, "/file.txt", "/link.txt"); !errors.Is(err, ErrNoLink) {
+			t.Errorf("%s: got %v, want %v", fs.Name(), err, ErrNoLink)
+		}
+	}
+
+	if err := Link(NewBasePathFs(mem, "/"), "/file.txt", "/link.txt"); err != nil {
+		t.Errorf("BasePathFs: %v", err)
+	}
+}
@@ -33,30 +33,155 @@ func (d httpDir) Open(name string) (http.File, error) {
 		strings.Contains(name, "\x00") {
 		return nil, errors.New("http: invalid character in file path")
 	}
+	name = path.Clean("/" + name)
+	f, err := d.open(name)
+	if err != nil && os.IsNotExist(err) && d.fs.fallback != "" {
+		return d.fs.Open(d.join(d.fs.fallback))
+	}
+	return f, err
+}
+
+func (d httpDir) join(name string) string {
 	dir := string(d.basePath)
 	if dir == "" {
 		dir = "."
 	}
+	return filepath.Join(dir, filepath.FromSlash(path.Clean("/"+name)))
+}
 
-	f, err := d.fs.Open(filepath.Join(dir, filepath.FromSlash(path.Clean("/"+name))))
+// open opens the cleaned name and applies the options of the HttpFs.
+func (d httpDir) open(name string) (http.File, error) {
+	if d.fs.hideDotfiles && hasDotfile(name) {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	full := d.join(name)
+	f, err := d.fs.Open(full)
 	if err != nil {
 		return nil, err
 	}
+	if d.fs.listDirs && !d.fs.hideDotfiles {
+		return f, nil
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return f, nil
+	}
+	if !d.fs.listDirs {
+		if _, err := d.fs.source.Stat(filepath.Join(full, "index.html")); err != nil {
+			f.Close()
+			return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+		}
+	}
+	if d.fs.hideDotfiles {
+		return noDotfilesDir{f}, nil
+	}
 	return f, nil
 }
 
+// hasDotfile reports whether an element of the slash separated name starts
+// with a dot.
+func hasDotfile(name string) bool {
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// noDotfilesDir leaves dotfiles out of directory listings.
+type noDotfilesDir struct {
+	http.File
+}
+
+func (d noDotfilesDir) Readdir(count int) ([]os.FileInfo, error) {
+	for {
+		fis, err := d.File.Readdir(count)
+		visible := fis[:0]
+		for _, fi := range fis {
+			if !strings.HasPrefix(fi.Name(), ".") {
+				visible = append(visible, fi)
+			}
+		}
+		if len(visible) > 0 || err != nil || count <= 0 || len(fis) == 0 {
+			return visible, err
+		}
+	}
+}
+
 type HttpFs struct {
-	source Fs
+	source       Fs
+	listDirs     bool
+	hideDotfiles bool
+	fallback     string
+	errorHandler func(w http.ResponseWriter, r *http.Request, err error)
+}
+
+// HttpOption configures an HttpFs created by NewHttpFs.
+type HttpOption func(*HttpFs)
+
+// HttpNoDirListing makes directories without an index.html look like they
+// do not exist, so that http.FileServer answers with 404 instead of a
+// listing.
+func HttpNoDirListing() HttpOption {
+	return func(h *HttpFs) { h.listDirs = false }
+}
+
+// HttpHideDotfiles hides files and directories whose name starts with a
+// dot, in any element of the requested path and in directory listings.
+func HttpHideDotfiles() HttpOption {
+	return func(h *HttpFs) { h.hideDotfiles = true }
 }
 
-func NewHttpFs(source Fs) *HttpFs {
-	return &HttpFs{source: source}
+// HttpFallback serves the file name, relative to the directory passed to
+// Dir, for every path that does not exist, as single page applications
+// expect. A typical name is "/index.html".
+func HttpFallback(name string) HttpOption {
+	return func(h *HttpFs) { h.fallback = name }
+}
+
+// HttpErrorHandler sets the handler FileServer calls when the requested
+// file cannot be opened, to serve custom error pages.
+func HttpErrorHandler(fn func(w http.ResponseWriter, r *http.Request, err error)) HttpOption {
+	return func(h *HttpFs) { h.errorHandler = fn }
+}
+
+func NewHttpFs(source Fs, opts ...HttpOption) *HttpFs {
+	h := &HttpFs{source: source, listDirs: true}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
 }
 
 func (h HttpFs) Dir(s string) *httpDir {
 	return &httpDir{basePath: s, fs: h}
 }
 
+// FileServer returns a handler serving the directory s like
+// http.FileServer(h.Dir(s)). If an error handler is set, it is called
+// instead when the requested file cannot be opened.
+func (h HttpFs) FileServer(s string) http.Handler {
+	dir := h.Dir(s)
+	fileServer := http.FileServer(dir)
+	if h.errorHandler == nil {
+		return fileServer
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f, err := dir.Open(r.URL.Path)
+		if err != nil {
+			h.errorHandler(w, r, err)
+			return
+		}
+		f.Close()
+		fileServer.ServeHTTP(w, r)
+	})
+}
+
 func (h HttpFs) Name() string { return "h HttpFs" }
 
 func (h HttpFs) Create(name string) (File, error) {
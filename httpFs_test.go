@@ -0,0 +1,114 @@
+package afero
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func httpFixture(t *testing.T) Fs {
+	t.Helper()
+	fs := NewMemMapFs()
+	for name, content := range map[string]string{
+		"/www/index.html":       "home",
+		"/www/app.js":           "js",
+		"/www/.env":             "secret",
+		"/www/.git/config":      "git",
+		"/www/assets/logo.txt":  "logo",
+		"/www/docs/index.html":  "docs",
+		"/www/docs/.draft.html": "draft",
+	} {
+		if err := WriteFile(fs, name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return fs
+}
+
+func httpGet(t *testing.T, h http.Handler, path string) (int, string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	body, _ := io.ReadAll(rec.Body)
+	return rec.Code, string(body)
+}
+
+func TestHttpFsDefaults(t *testing.T) {
+	h := NewHttpFs(httpFixture(t)).FileServer("/www")
+
+	if code, body := httpGet(t, h, "/.env"); code != http.StatusOK || body != "secret" {
+		t.Errorf("GET /.env = %d %q", code, body)
+	}
+	if code, body := httpGet(t, h, "/assets/"); code != http.StatusOK || !strings.Contains(body, "logo.txt") {
+		t.Errorf("GET /assets/ = %d %q, want a listing", code, body)
+	}
+}
+
+func TestHttpFsOptions(t *testing.T) {
+	h := NewHttpFs(httpFixture(t), HttpNoDirListing(), HttpHideDotfiles()).FileServer("/www")
+
+	for _, path := range []string{"/.env", "/.git/config", "/docs/.draft.html", "/assets/"} {
+		if code, _ := httpGet(t, h, path); code != http.StatusNotFound {
+			t.Errorf("GET %s = %d, want 404", path, code)
+		}
+	}
+	if code, body := httpGet(t, h, "/docs/"); code != http.StatusOK || body != "docs" {
+		t.Errorf("GET /docs/ = %d %q, want the index", code, body)
+	}
+	if code, body := httpGet(t, h, "/app.js"); code != http.StatusOK || body != "js" {
+		t.Errorf("GET /app.js = %d %q", code, body)
+	}
+
+	h = NewHttpFs(httpFixture(t), HttpHideDotfiles()).FileServer("/www")
+	if code, body := httpGet(t, h, "/docs/"); code != http.StatusOK || body != "docs" {
+		t.Errorf("GET /docs/ = %d %q", code, body)
+	}
+	f, err := NewHttpFs(httpFixture(t), HttpHideDotfiles()).Dir("/www").Open("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	fis, err := f.Readdir(-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fi := range fis {
+		if strings.HasPrefix(fi.Name(), ".") {
+			t.Errorf("listing contains %s", fi.Name())
+		}
+	}
+}
+
+func TestHttpFsFallback(t *testing.T) {
+	h := NewHttpFs(httpFixture(t), HttpFallback("/index.html"), HttpHideDotfiles()).FileServer("/www")
+
+	for _, path := range []string{"/some/route", "/.env"} {
+		if code, body := httpGet(t, h, path); code != http.StatusOK || body != "home" {
+			t.Errorf("GET %s = %d %q, want the fallback", path, code, body)
+		}
+	}
+	if code, body := httpGet(t, h, "/app.js"); code != http.StatusOK || body != "js" {
+		t.Errorf("GET /app.js = %d %q", code, body)
+	}
+}
+
+func TestHttpFsErrorHandler(t *testing.T) {
+	h := NewHttpFs(httpFixture(t), HttpErrorHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+		if os.IsNotExist(err) {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, "custom not found")
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	})).FileServer("/www")
+
+	if code, body := httpGet(t, h, "/missing"); code != http.StatusNotFound || body != "custom not found" {
+		t.Errorf("GET /missing = %d %q", code, body)
+	}
+	if code, body := httpGet(t, h, "/app.js"); code != http.StatusOK || body != "js" {
+		t.Errorf("GET /app.js = %d %q", code, body)
+	}
+}
@@ -0,0 +1,210 @@
+package httpclientfs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"syscall"
+
+	"github.com/spf13/afero"
+	"github.com/spf13/afero/internal/common"
+)
+
+// File is a file or directory opened from a Fs. Sequential reads stream
+// the body of one GET request, reads at other offsets are ranged GET
+// requests.
+type File struct {
+	fs   *Fs
+	name string
+	info os.FileInfo
+	off  int64
+
+	// body streams the content from bodyOff for sequential reads.
+	body    io.ReadCloser
+	bodyOff int64
+
+	dir    common.DirLister
+	closed bool
+}
+
+var _ afero.File = (*File)(nil)
+
+func (f *File) Name() string { return f.name }
+
+func (f *File) Close() error {
+	if f.closed {
+		return afero.ErrFileClosed
+	}
+	f.closeBody()
+	f.closed = true
+	return nil
+}
+
+func (f *File) closeBody() {
+	if f.body != nil {
+		f.body.Close()
+		f.body = nil
+	}
+}
+
+func (f *File) Read(p []byte) (int, error) {
+	if f.closed {
+		return 0, afero.ErrFileClosed
+	}
+	if f.info.IsDir() {
+		return 0, &os.PathError{Op: "read", Path: f.name, Err: syscall.EISDIR}
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if f.body == nil || f.bodyOff != f.off {
+		f.closeBody()
+		body, err := f.get(f.off, -1)
+		if err != nil {
+			return 0, err
+		}
+		f.body, f.bodyOff = body, f.off
+	}
+	n, err := f.body.Read(p)
+	f.off += int64(n)
+	f.bodyOff = f.off
+	if err != nil && err != io.EOF {
+		err = &os.PathError{Op: "read", Path: f.name, Err: err}
+	}
+	return n, err
+}
+
+func (f *File) ReadAt(p []byte, off int64) (int, error) {
+	if f.closed {
+		return 0, afero.ErrFileClosed
+	}
+	if f.info.IsDir() {
+		return 0, &os.PathError{Op: "read", Path: f.name, Err: syscall.EISDIR}
+	}
+	if off < 0 {
+		return 0, &os.PathError{Op: "readat", Path: f.name, Err: errors.New("negative offset")}
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	body, err := f.get(off, int64(len(p)))
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+	n, err := io.ReadFull(body, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// get returns the content from off with a ranged GET, up to n bytes unless
+// n is negative. It returns io.EOF if off is at or past the end.
+func (f *File) get(off, n int64) (io.ReadCloser, error) {
+	rng := "bytes=" + strconv.FormatInt(off, 10) + "-"
+	if n >= 0 {
+		rng += strconv.FormatInt(off+n-1, 10)
+	}
+	resp, err := f.fs.do("GET", f.fs.url(f.name, false), map[string]string{"Range": rng})
+	if err != nil {
+		return nil, &os.PathError{Op: "read", Path: f.name, Err: err}
+	}
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		return resp.Body, nil
+	case http.StatusRequestedRangeNotSatisfiable:
+		resp.Body.Close()
+		return nil, io.EOF
+	case http.StatusOK:
+		// The server ignored the range.
+		if _, err := io.CopyN(io.Discard, resp.Body, off); err != nil {
+			resp.Body.Close()
+			if err == io.EOF {
+				return nil, io.EOF
+			}
+			return nil, &os.PathError{Op: "read", Path: f.name, Err: err}
+		}
+		return resp.Body, nil
+	}
+	resp.Body.Close()
+	if err := statusError("read", f.name, resp); err != nil {
+		return nil, err
+	}
+	return nil, &os.PathError{Op: "read", Path: f.name, Err: fmt.Errorf("http: %s", resp.Status)}
+}
+
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	if f.closed {
+		return 0, afero.ErrFileClosed
+	}
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.off
+	case io.SeekEnd:
+		offset += f.info.Size()
+	}
+	if offset < 0 {
+		return 0, &os.PathError{Op: "seek", Path: f.name, Err: syscall.EINVAL}
+	}
+	f.off = offset
+	return offset, nil
+}
+
+func (f *File) Write(p []byte) (int, error) {
+	return 0, &os.PathError{Op: "write", Path: f.name, Err: syscall.EBADF}
+}
+
+func (f *File) WriteAt(p []byte, off int64) (int, error) {
+	return 0, &os.PathError{Op: "write", Path: f.name, Err: syscall.EBADF}
+}
+
+func (f *File) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *File) Truncate(size int64) error {
+	return &os.PathError{Op: "truncate", Path: f.name, Err: syscall.EBADF}
+}
+
+func (f *File) Sync() error {
+	if f.closed {
+		return afero.ErrFileClosed
+	}
+	return nil
+}
+
+func (f *File) Stat() (os.FileInfo, error) {
+	if f.closed {
+		return nil, afero.ErrFileClosed
+	}
+	return f.info, nil
+}
+
+func (f *File) Readdir(count int) ([]os.FileInfo, error) {
+	if f.closed {
+		return nil, afero.ErrFileClosed
+	}
+	if !f.info.IsDir() {
+		return nil, &os.PathError{Op: "readdir", Path: f.name, Err: syscall.ENOTDIR}
+	}
+	return f.dir.Readdir(count, func() ([]os.FileInfo, error) {
+		entries, err := f.fs.readDir(f.name)
+		if err != nil {
+			return nil, err
+		}
+		return entries, io.EOF
+	})
+}
+
+func (f *File) Readdirnames(n int) ([]string, error) {
+	entries, err := f.Readdir(n)
+	names := make([]string, len(entries))
+	for i, fi := range entries {
+		names[i] = fi.Name()
+	}
+	return names, err
+}
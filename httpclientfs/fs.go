@@ -0,0 +1,413 @@
+// Package httpclientfs provides a read-only afero.Fs for the files below an
+// HTTP(S) URL.
+package httpclientfs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/html"
+
+	"github.com/spf13/afero"
+)
+
+// Listing is how a Fs lists directories.
+type Listing int
+
+const (
+	// NoListing makes Readdir fail: plain HTTP has no way to list a
+	// directory. This is the default.
+	NoListing Listing = iota
+
+	// IndexJSON reads the entries of a directory from the file index.json
+	// in it, a JSON array of objects like
+	//
+	//	{"name": "a.txt", "size": 12, "modTime": "2006-01-02T15:04:05Z"}
+	//	{"name": "sub", "dir": true}
+	//
+	// Only the name is required.
+	IndexJSON
+
+	// HTMLListing parses the links of the HTML page served for a
+	// directory, such as the listings of http.FileServer, nginx or Apache.
+	// Links to children of the directory are entries, those ending with a
+	// slash are directories. The sizes and times of files need a HEAD
+	// request each.
+	HTMLListing
+)
+
+// Fs is a read-only afero.Fs for the files below a base URL.
+//
+// Open issues GET requests, reads at an offset are ranged GET requests and
+// Stat is a HEAD request. A name is a directory if the server redirects it
+// to the name with a trailing slash, as http.FileServer does, or if it has
+// a listing. All the methods changing files fail with syscall.EPERM.
+type Fs struct {
+	base    *url.URL
+	client  *http.Client
+	listing Listing
+	header  http.Header
+}
+
+// Option configures a Fs.
+type Option func(*Fs)
+
+// WithClient makes the Fs send its requests with c instead of
+// http.DefaultClient.
+func WithClient(c *http.Client) Option {
+	return func(fs *Fs) {
+		fs.client = c
+	}
+}
+
+// WithListing sets how Readdir lists directories.
+func WithListing(l Listing) Option {
+	return func(fs *Fs) {
+		fs.listing = l
+	}
+}
+
+// WithHeader adds a header to all the requests, e.g. for authorization.
+func WithHeader(key, value string) Option {
+	return func(fs *Fs) {
+		fs.header.Add(key, value)
+	}
+}
+
+// New returns a Fs for the files below rawURL.
+func New(rawURL string, opts ...Option) (afero.Fs, error) {
+	base, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if base.Scheme != "http" && base.Scheme != "https" {
+		return nil, fmt.Errorf("httpclientfs: unsupported URL scheme %q", base.Scheme)
+	}
+	base.Path = strings.TrimSuffix(base.Path, "/")
+	base.RawPath = ""
+	fs := &Fs{base: base, client: http.DefaultClient, header: make(http.Header)}
+	for _, opt := range opts {
+		opt(fs)
+	}
+	return fs, nil
+}
+
+func (fs *Fs) Name() string { return "httpclientfs" }
+
+// clean returns name as a slash separated path relative to the base URL.
+func clean(name string) string {
+	return path.Clean("/" + strings.ReplaceAll(name, "\\", "/"))
+}
+
+// url returns the URL of name, with a trailing slash for directories.
+func (fs *Fs) url(name string, dir bool) string {
+	u := *fs.base
+	u.Path = fs.base.Path + clean(name)
+	if dir && !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+	return u.String()
+}
+
+func (fs *Fs) do(method, rawURL string, header map[string]string) (*http.Response, error) {
+	req, err := http.NewRequest(method, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range fs.header {
+		req.Header[k] = v
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	return fs.client.Do(req)
+}
+
+// statusError returns nil for successful responses and a *os.PathError
+// matching the status otherwise.
+func statusError(op, name string, resp *http.Response) error {
+	var err error
+	switch code := resp.StatusCode; {
+	case code < 300:
+		return nil
+	case code == http.StatusNotFound, code == http.StatusGone:
+		err = os.ErrNotExist
+	case code == http.StatusUnauthorized, code == http.StatusForbidden:
+		err = os.ErrPermission
+	default:
+		err = fmt.Errorf("http: %s", resp.Status)
+	}
+	return &os.PathError{Op: op, Path: name, Err: err}
+}
+
+// head returns the response to a HEAD request for rawURL, with its body
+// closed.
+func (fs *Fs) head(op, name, rawURL string) (*http.Response, error) {
+	resp, err := fs.do("HEAD", rawURL, nil)
+	if err != nil {
+		return nil, &os.PathError{Op: op, Path: name, Err: err}
+	}
+	resp.Body.Close()
+	return resp, statusError(op, name, resp)
+}
+
+func (fs *Fs) stat(op, name string) (os.FileInfo, error) {
+	p := clean(name)
+	if p == "/" {
+		return &fileInfo{name: "/", mode: os.ModeDir | 0o555}, nil
+	}
+	dir := &fileInfo{name: path.Base(p), mode: os.ModeDir | 0o555}
+	resp, err := fs.head(op, name, fs.url(p, false))
+	if errors.Is(err, os.ErrNotExist) {
+		switch fs.listing {
+		case IndexJSON:
+			_, err = fs.head(op, name, fs.url(p+"/index.json", false))
+		case HTMLListing:
+			_, err = fs.head(op, name, fs.url(p, true))
+		}
+		if err != nil {
+			return nil, err
+		}
+		return dir, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasSuffix(resp.Request.URL.Path, "/") {
+		// redirected to the directory
+		return dir, nil
+	}
+	return responseInfo(path.Base(p), resp), nil
+}
+
+// responseInfo returns the info of the file named name served with resp.
+func responseInfo(name string, resp *http.Response) *fileInfo {
+	fi := &fileInfo{name: name, size: resp.ContentLength, mode: 0o444}
+	if fi.size < 0 {
+		fi.size = 0
+	}
+	fi.modTime, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+	return fi
+}
+
+func (fs *Fs) Stat(name string) (os.FileInfo, error) {
+	return fs.stat("stat", name)
+}
+
+// readDir returns the entries of the directory name, sorted by name.
+func (fs *Fs) readDir(name string) ([]os.FileInfo, error) {
+	var entries []os.FileInfo
+	var err error
+	switch fs.listing {
+	case IndexJSON:
+		entries, err = fs.readIndexJSON(name)
+	case HTMLListing:
+		entries, err = fs.readHTMLListing(name)
+	default:
+		err = &os.PathError{Op: "readdir", Path: name, Err: errors.ErrUnsupported}
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// get returns the response to a GET request for rawURL, failing for error
+// statuses.
+func (fs *Fs) get(op, name, rawURL string) (*http.Response, error) {
+	resp, err := fs.do("GET", rawURL, nil)
+	if err != nil {
+		return nil, &os.PathError{Op: op, Path: name, Err: err}
+	}
+	if err := statusError(op, name, resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+type indexEntry struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	Dir     bool      `json:"dir"`
+}
+
+func (fs *Fs) readIndexJSON(name string) ([]os.FileInfo, error) {
+	resp, err := fs.get("readdir", name, fs.url(clean(name)+"/index.json", false))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var index []indexEntry
+	if err := json.NewDecoder(resp.Body).Decode(&index); err != nil {
+		return nil, &os.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	entries := make([]os.FileInfo, 0, len(index))
+	for _, e := range index {
+		fi := &fileInfo{name: strings.TrimSuffix(e.Name, "/"), size: e.Size, mode: 0o444, modTime: e.ModTime}
+		if e.Dir || strings.HasSuffix(e.Name, "/") {
+			fi.mode = os.ModeDir | 0o555
+		}
+		if fi.name == "" || strings.Contains(fi.name, "/") {
+			continue
+		}
+		entries = append(entries, fi)
+	}
+	return entries, nil
+}
+
+func (fs *Fs) readHTMLListing(name string) ([]os.FileInfo, error) {
+	dirURL := fs.url(name, true)
+	resp, err := fs.get("readdir", name, dirURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	names, err := htmlLinks(resp.Request.URL, resp.Body)
+	if err != nil {
+		return nil, &os.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	var entries []os.FileInfo
+	for _, link := range names {
+		if strings.HasSuffix(link, "/") {
+			entries = append(entries, &fileInfo{name: strings.TrimSuffix(link, "/"), mode: os.ModeDir | 0o555})
+			continue
+		}
+		resp, err := fs.head("readdir", name, fs.url(clean(name)+"/"+link, false))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, responseInfo(link, resp))
+	}
+	return entries, nil
+}
+
+// htmlLinks returns the names of the children of the directory at dir the
+// HTML page r links to, with a trailing slash for directories.
+func htmlLinks(dir *url.URL, r io.Reader) ([]string, error) {
+	seen := make(map[string]bool)
+	var names []string
+	z := html.NewTokenizer(r)
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			if z.Err() == io.EOF {
+				return names, nil
+			}
+			return nil, z.Err()
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tag, hasAttr := z.TagName()
+			if string(tag) != "a" {
+				continue
+			}
+			for hasAttr {
+				var key, val []byte
+				key, val, hasAttr = z.TagAttr()
+				if string(key) != "href" {
+					continue
+				}
+				if name, ok := childName(dir, string(val)); ok && !seen[name] {
+					seen[name] = true
+					names = append(names, name)
+				}
+			}
+		}
+	}
+}
+
+// childName returns the name of the child of dir href links to.
+func childName(dir *url.URL, href string) (string, bool) {
+	ref, err := url.Parse(href)
+	if err != nil || ref.RawQuery != "" || ref.Fragment != "" && ref.Path == "" {
+		return "", false
+	}
+	u := dir.ResolveReference(ref)
+	if u.Host != dir.Host || !strings.HasPrefix(u.Path, dir.Path) {
+		return "", false
+	}
+	name := strings.TrimPrefix(u.Path, dir.Path)
+	if name == "" || strings.Contains(strings.TrimSuffix(name, "/"), "/") {
+		return "", false
+	}
+	return name, true
+}
+
+func (fs *Fs) Create(name string) (afero.File, error) {
+	return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EPERM}
+}
+
+func (fs *Fs) Open(name string) (afero.File, error) {
+	return fs.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (fs *Fs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) != 0 {
+		return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EPERM}
+	}
+	fi, err := fs.stat("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return &File{fs: fs, name: name, info: fi}, nil
+}
+
+func (fs *Fs) Mkdir(name string, perm os.FileMode) error {
+	return &os.PathError{Op: "mkdir", Path: name, Err: syscall.EPERM}
+}
+
+func (fs *Fs) MkdirAll(path string, perm os.FileMode) error {
+	return &os.PathError{Op: "mkdir", Path: path, Err: syscall.EPERM}
+}
+
+func (fs *Fs) Remove(name string) error {
+	return &os.PathError{Op: "remove", Path: name, Err: syscall.EPERM}
+}
+
+func (fs *Fs) RemoveAll(path string) error {
+	return &os.PathError{Op: "removeall", Path: path, Err: syscall.EPERM}
+}
+
+func (fs *Fs) Rename(oldname, newname string) error {
+	return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: syscall.EPERM}
+}
+
+func (fs *Fs) Chmod(name string, mode os.FileMode) error {
+	return &os.PathError{Op: "chmod", Path: name, Err: syscall.EPERM}
+}
+
+func (fs *Fs) Chown(name string, uid, gid int) error {
+	return &os.PathError{Op: "chown", Path: name, Err: syscall.EPERM}
+}
+
+func (fs *Fs) Chtimes(name string, atime, mtime time.Time) error {
+	return &os.PathError{Op: "chtimes", Path: name, Err: syscall.EPERM}
+}
+
+type fileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (fi *fileInfo) Name() string       { return fi.name }
+func (fi *fileInfo) Size() int64        { return fi.size }
+func (fi *fileInfo) Mode() os.FileMode  { return fi.mode }
+func (fi *fileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *fileInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi *fileInfo) Sys() interface{}   { return nil }
@@ -0,0 +1,128 @@
+package httpclientfs
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"syscall"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/spf13/afero/aferotest"
+)
+
+var files = fstest.MapFS{
+	"static/hello.txt":      {Data: []byte("hello world"), ModTime: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+	"static/a b.css":        {Data: []byte("body {}")},
+	"static/sub/deep.txt":   {Data: []byte("deep")},
+	"static/index.json":     {Data: []byte(`[{"name": "hello.txt", "size": 11}, {"name": "sub", "dir": true}]`)},
+	"static/sub/index.json": {Data: []byte(`[{"name": "deep.txt", "size": 4}]`)},
+}
+
+func newTestFs(t *testing.T, opts ...Option) afero.Fs {
+	t.Helper()
+	srv := httptest.NewServer(http.FileServer(http.FS(files)))
+	t.Cleanup(srv.Close)
+	fs, err := New(srv.URL+"/static/", opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fs
+}
+
+func TestHTTPClientFs(t *testing.T) {
+	fs := newTestFs(t)
+
+	fi, err := fs.Stat("/hello.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Name() != "hello.txt" || fi.Size() != 11 || fi.IsDir() || !fi.ModTime().Equal(files["static/hello.txt"].ModTime) {
+		t.Errorf("Stat = %s %d %v %v", fi.Name(), fi.Size(), fi.IsDir(), fi.ModTime())
+	}
+	if fi, err := fs.Stat("/sub"); err != nil || !fi.IsDir() {
+		t.Errorf("Stat dir = %v, %v", fi, err)
+	}
+	if _, err := fs.Stat("/missing"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Stat missing = %v", err)
+	}
+
+	f, err := fs.Open("/hello.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	buf := make([]byte, 5)
+	if n, err := f.ReadAt(buf, 6); err != nil || string(buf[:n]) != "world" {
+		t.Errorf("ReadAt = %q, %v", buf[:n], err)
+	}
+	if n, err := f.ReadAt(buf, 8); err != io.EOF || string(buf[:n]) != "rld" {
+		t.Errorf("ReadAt at end = %q, %v", buf[:n], err)
+	}
+	f.Seek(6, io.SeekStart)
+	if data, err := io.ReadAll(f); err != nil || string(data) != "world" {
+		t.Errorf("read after Seek = %q, %v", data, err)
+	}
+	if data, err := afero.ReadFile(fs, "/a b.css"); err != nil || string(data) != "body {}" {
+		t.Errorf("ReadFile with a space = %q, %v", data, err)
+	}
+
+	if _, err := f.Write([]byte("x")); !errors.Is(err, syscall.EBADF) {
+		t.Errorf("Write = %v", err)
+	}
+	if err := afero.WriteFile(fs, "/new", nil, 0o644); !errors.Is(err, syscall.EPERM) {
+		t.Errorf("WriteFile = %v", err)
+	}
+	if err := fs.Remove("/hello.txt"); !errors.Is(err, syscall.EPERM) {
+		t.Errorf("Remove = %v", err)
+	}
+	if _, err := afero.ReadDir(fs, "/"); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("ReadDir without listing = %v", err)
+	}
+}
+
+func names(fis []os.FileInfo) []string {
+	var res []string
+	for _, fi := range fis {
+		res = append(res, fi.Name())
+	}
+	return res
+}
+
+func TestHTMLListing(t *testing.T) {
+	fs := newTestFs(t, WithListing(HTMLListing))
+	fis, err := afero.ReadDir(fs, "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := names(fis), []string{"a b.css", "hello.txt", "index.json", "sub"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadDir = %v, want %v", got, want)
+	}
+	if fis[1].Size() != 11 || !fis[3].IsDir() {
+		t.Errorf("hello.txt size %d, sub dir %v", fis[1].Size(), fis[3].IsDir())
+	}
+	aferotest.CheckReaddir(t, fs, "/")
+}
+
+func TestIndexJSON(t *testing.T) {
+	fs := newTestFs(t, WithListing(IndexJSON))
+	var walked []string
+	err := afero.Walk(fs, "/", func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		walked = append(walked, path)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"/", "/hello.txt", "/sub", "/sub/deep.txt"}; !reflect.DeepEqual(walked, want) {
+		t.Errorf("Walk = %v, want %v", walked, want)
+	}
+}
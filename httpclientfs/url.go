@@ -0,0 +1,18 @@
+package httpclientfs
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/spf13/afero"
+)
+
+// The http and https schemes open the files below the URL with
+// afero.OpenURL, read only.
+func init() {
+	for _, scheme := range []string{"http", "https"} {
+		afero.RegisterScheme(scheme, func(_ context.Context, u *url.URL) (afero.Fs, error) {
+			return New(u.String())
+		})
+	}
+}
@@ -0,0 +1,351 @@
+package afero
+
+import (
+	"io"
+	"os"
+	"time"
+)
+
+var (
+	_ Lstater    = (*InstrumentedFs)(nil)
+	_ Symlinker  = (*InstrumentedFs)(nil)
+	_ HardLinker = (*InstrumentedFs)(nil)
+	_ Locker     = (*InstrumentedFs)(nil)
+	_ Xattrer    = (*InstrumentedFs)(nil)
+)
+
+// InstrumentEvent describes a single call on an InstrumentedFs or on one of
+// its files.
+type InstrumentEvent struct {
+	// Op is the name of the method called, e.g. "OpenFile" or "Rename".
+	// Methods of files are prefixed with "File.", e.g. "File.Write".
+	Op string
+	// Path is the name the call is about, for files the name they were
+	// opened with. NewPath is only set for "Rename", "Symlink" and "Link".
+	Path    string
+	NewPath string
+
+	// Bytes is the number of bytes read or written. Duration and Err are
+	// the duration and the result of the call. These are only set when
+	// After is called.
+	Bytes    int64
+	Duration time.Duration
+	Err      error
+
+	// Value is not used by the InstrumentedFs. Whatever Before stores here
+	// is seen by After, e.g. a span to end.
+	Value any
+}
+
+// Hooks are the callbacks of an InstrumentedFs. Both are optional.
+type Hooks struct {
+	// Before is called before the call is passed to the source Fs.
+	Before func(ev *InstrumentEvent)
+	// After is called when it returned.
+	After func(ev *InstrumentEvent)
+}
+
+// The InstrumentedFs calls hooks before and after every call on the source
+// Fs and on the files opened from it, e.g. to record tracing spans or
+// metrics. The hooks run synchronously in the goroutine making the call.
+type InstrumentedFs struct {
+	source Fs
+	hooks  Hooks
+}
+
+func NewInstrumentedFs(source Fs, hooks Hooks) Fs {
+	return &InstrumentedFs{source: source, hooks: hooks}
+}
+
+// call runs fn, which returns the number of bytes transferred, between the
+// hooks.
+func (i *InstrumentedFs) call(ev *InstrumentEvent, fn func() (int64, error)) error {
+	if i.hooks.Before != nil {
+		i.hooks.Before(ev)
+	}
+	start := time.Now()
+	n, err := fn()
+	ev.Duration = time.Since(start)
+	ev.Bytes, ev.Err = n, err
+	if i.hooks.After != nil {
+		i.hooks.After(ev)
+	}
+	return err
+}
+
+func (i *InstrumentedFs) file(name string, f File, err error) (File, error) {
+	if err != nil {
+		return nil, err
+	}
+	return &InstrumentedFile{File: f, fs: i, name: name}, nil
+}
+
+func (i *InstrumentedFs) Name() string {
+	return "InstrumentedFs"
+}
+
+// Unwrap returns the Fs whose calls are recorded.
+func (i *InstrumentedFs) Unwrap() Fs {
+	return i.source
+}
+
+// Capabilities returns those of the source.
+func (i *InstrumentedFs) Capabilities() Capability {
+	return Capabilities(i.source)
+}
+
+func (i *InstrumentedFs) Create(name string) (f File, err error) {
+	i.call(&InstrumentEvent{Op: "Create", Path: name}, func() (int64, error) {
+		f, err = i.source.Create(name)
+		return 0, err
+	})
+	return i.file(name, f, err)
+}
+
+func (i *InstrumentedFs) Open(name string) (f File, err error) {
+	i.call(&InstrumentEvent{Op: "Open", Path: name}, func() (int64, error) {
+		f, err = i.source.Open(name)
+		return 0, err
+	})
+	return i.file(name, f, err)
+}
+
+func (i *InstrumentedFs) OpenFile(name string, flag int, perm os.FileMode) (f File, err error) {
+	i.call(&InstrumentEvent{Op: "OpenFile", Path: name}, func() (int64, error) {
+		f, err = i.source.OpenFile(name, flag, perm)
+		return 0, err
+	})
+	return i.file(name, f, err)
+}
+
+func (i *InstrumentedFs) Mkdir(name string, perm os.FileMode) error {
+	return i.call(&InstrumentEvent{Op: "Mkdir", Path: name}, func() (int64, error) {
+		return 0, i.source.Mkdir(name, perm)
+	})
+}
+
+func (i *InstrumentedFs) MkdirAll(path string, perm os.FileMode) error {
+	return i.call(&InstrumentEvent{Op: "MkdirAll", Path: path}, func() (int64, error) {
+		return 0, i.source.MkdirAll(path, perm)
+	})
+}
+
+func (i *InstrumentedFs) Remove(name string) error {
+	return i.call(&InstrumentEvent{Op: "Remove", Path: name}, func() (int64, error) {
+		return 0, i.source.Remove(name)
+	})
+}
+
+func (i *InstrumentedFs) RemoveAll(path string) error {
+	return i.call(&InstrumentEvent{Op: "RemoveAll", Path: path}, func() (int64, error) {
+		return 0, i.source.RemoveAll(path)
+	})
+}
+
+func (i *InstrumentedFs) Rename(oldname, newname string) error {
+	return i.call(&InstrumentEvent{Op: "Rename", Path: oldname, NewPath: newname}, func() (int64, error) {
+		return 0, i.source.Rename(oldname, newname)
+	})
+}
+
+func (i *InstrumentedFs) Stat(name string) (fi os.FileInfo, err error) {
+	i.call(&InstrumentEvent{Op: "Stat", Path: name}, func() (int64, error) {
+		fi, err = i.source.Stat(name)
+		return 0, err
+	})
+	return fi, err
+}
+
+func (i *InstrumentedFs) LstatIfPossible(name string) (fi os.FileInfo, lstat bool, err error) {
+	i.call(&InstrumentEvent{Op: "Lstat", Path: name}, func() (int64, error) {
+		if lsf, ok := i.source.(Lstater); ok {
+			fi, lstat, err = lsf.LstatIfPossible(name)
+		} else {
+			fi, err = i.source.Stat(name)
+		}
+		return 0, err
+	})
+	return fi, lstat, err
+}
+
+func (i *InstrumentedFs) SymlinkIfPossible(oldname, newname string) error {
+	return i.call(&InstrumentEvent{Op: "Symlink", Path: oldname, NewPath: newname}, func() (int64, error) {
+		if l, ok := i.source.(Linker); ok {
+			return 0, l.SymlinkIfPossible(oldname, newname)
+		}
+		return 0, &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: ErrNoSymlink}
+	})
+}
+
+func (i *InstrumentedFs) ReadlinkIfPossible(name string) (target string, err error) {
+	i.call(&InstrumentEvent{Op: "Readlink", Path: name}, func() (int64, error) {
+		if r, ok := i.source.(LinkReader); ok {
+			target, err = r.ReadlinkIfPossible(name)
+		} else {
+			err = &os.PathError{Op: "readlink", Path: name, Err: ErrNoReadlink}
+		}
+		return 0, err
+	})
+	return target, err
+}
+
+func (i *InstrumentedFs) LinkIfPossible(oldname, newname string) error {
+	return i.call(&InstrumentEvent{Op: "Link", Path: oldname, NewPath: newname}, func() (int64, error) {
+		return 0, Link(i.source, oldname, newname)
+	})
+}
+
+func (i *InstrumentedFs) LockIfPossible(name string, exclusive bool) (c io.Closer, locked bool, err error) {
+	i.call(&InstrumentEvent{Op: "Lock", Path: name}, func() (int64, error) {
+		c, locked, err = lockIfPossible(i.source, name, exclusive)
+		return 0, err
+	})
+	return c, locked, err
+}
+
+func (i *InstrumentedFs) GetXattr(name, attr string) (value []byte, err error) {
+	i.call(&InstrumentEvent{Op: "GetXattr", Path: name}, func() (int64, error) {
+		value, err = GetXattr(i.source, name, attr)
+		return int64(len(value)), err
+	})
+	return value, err
+}
+
+func (i *InstrumentedFs) SetXattr(name, attr string, value []byte) error {
+	return i.call(&InstrumentEvent{Op: "SetXattr", Path: name}, func() (int64, error) {
+		return int64(len(value)), SetXattr(i.source, name, attr, value)
+	})
+}
+
+func (i *InstrumentedFs) ListXattr(name string) (attrs []string, err error) {
+	i.call(&InstrumentEvent{Op: "ListXattr", Path: name}, func() (int64, error) {
+		attrs, err = ListXattr(i.source, name)
+		return 0, err
+	})
+	return attrs, err
+}
+
+func (i *InstrumentedFs) RemoveXattr(name, attr string) error {
+	return i.call(&InstrumentEvent{Op: "RemoveXattr", Path: name}, func() (int64, error) {
+		return 0, RemoveXattr(i.source, name, attr)
+	})
+}
+
+func (i *InstrumentedFs) Chmod(name string, mode os.FileMode) error {
+	return i.call(&InstrumentEvent{Op: "Chmod", Path: name}, func() (int64, error) {
+		return 0, i.source.Chmod(name, mode)
+	})
+}
+
+func (i *InstrumentedFs) Chown(name string, uid, gid int) error {
+	return i.call(&InstrumentEvent{Op: "Chown", Path: name}, func() (int64, error) {
+		return 0, i.source.Chown(name, uid, gid)
+	})
+}
+
+func (i *InstrumentedFs) Chtimes(name string, atime, mtime time.Time) error {
+	return i.call(&InstrumentEvent{Op: "Chtimes", Path: name}, func() (int64, error) {
+		return 0, i.source.Chtimes(name, atime, mtime)
+	})
+}
+
+// InstrumentedFile is a file opened from an InstrumentedFs.
+type InstrumentedFile struct {
+	File
+	fs   *InstrumentedFs
+	name string
+}
+
+func (f *InstrumentedFile) call(op string, fn func() (int64, error)) error {
+	return f.fs.call(&InstrumentEvent{Op: "File." + op, Path: f.name}, fn)
+}
+
+func (f *InstrumentedFile) Close() error {
+	return f.call("Close", func() (int64, error) {
+		return 0, f.File.Close()
+	})
+}
+
+func (f *InstrumentedFile) Read(p []byte) (n int, err error) {
+	f.call("Read", func() (int64, error) {
+		n, err = f.File.Read(p)
+		return int64(n), err
+	})
+	return n, err
+}
+
+func (f *InstrumentedFile) ReadAt(p []byte, off int64) (n int, err error) {
+	f.call("ReadAt", func() (int64, error) {
+		n, err = f.File.ReadAt(p, off)
+		return int64(n), err
+	})
+	return n, err
+}
+
+func (f *InstrumentedFile) Seek(offset int64, whence int) (ret int64, err error) {
+	f.call("Seek", func() (int64, error) {
+		ret, err = f.File.Seek(offset, whence)
+		return 0, err
+	})
+	return ret, err
+}
+
+func (f *InstrumentedFile) Write(p []byte) (n int, err error) {
+	f.call("Write", func() (int64, error) {
+		n, err = f.File.Write(p)
+		return int64(n), err
+	})
+	return n, err
+}
+
+func (f *InstrumentedFile) WriteAt(p []byte, off int64) (n int, err error) {
+	f.call("WriteAt", func() (int64, error) {
+		n, err = f.File.WriteAt(p, off)
+		return int64(n), err
+	})
+	return n, err
+}
+
+func (f *InstrumentedFile) WriteString(s string) (n int, err error) {
+	f.call("WriteString", func() (int64, error) {
+		n, err = f.File.WriteString(s)
+		return int64(n), err
+	})
+	return n, err
+}
+
+func (f *InstrumentedFile) Readdir(count int) (fis []os.FileInfo, err error) {
+	f.call("Readdir", func() (int64, error) {
+		fis, err = f.File.Readdir(count)
+		return 0, err
+	})
+	return fis, err
+}
+
+func (f *InstrumentedFile) Readdirnames(n int) (names []string, err error) {
+	f.call("Readdirnames", func() (int64, error) {
+		names, err = f.File.Readdirnames(n)
+		return 0, err
+	})
+	return names, err
+}
+
+func (f *InstrumentedFile) Stat() (fi os.FileInfo, err error) {
+	f.call("Stat", func() (int64, error) {
+		fi, err = f.File.Stat()
+		return 0, err
+	})
+	return fi, err
+}
+
+func (f *InstrumentedFile) Sync() error {
+	return f.call("Sync", func() (int64, error) {
+		return 0, f.File.Sync()
+	})
+}
+
+func (f *InstrumentedFile) Truncate(size int64) error {
+	return f.call("Truncate", func() (int64, error) {
+		return 0, f.File.Truncate(size)
+	})
+}
@@ -0,0 +1,78 @@
+package afero
+
+import (
+	"io"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestInstrumentedFs(t *testing.T) {
+	var events []InstrumentEvent
+	fs := NewInstrumentedFs(NewMemMapFs(), Hooks{
+		Before: func(ev *InstrumentEvent) { ev.Value = ev.Op },
+		After: func(ev *InstrumentEvent) {
+			if ev.Value != ev.Op {
+				t.Errorf("%s: Value = %v, want the one set by Before", ev.Op, ev.Value)
+			}
+			if ev.Duration < 0 {
+				t.Errorf("%s: Duration = %v", ev.Op, ev.Duration)
+			}
+			events = append(events, *ev)
+		},
+	})
+
+	f, err := fs.Create("/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("hello")
+	f.Close()
+	if err := fs.Rename("/a", "/b"); err != nil {
+		t.Fatal(err)
+	}
+	f, err = fs.Open("/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.ReadAll(f)
+	f.Close()
+	_, statErr := fs.Stat("/a")
+
+	type call struct {
+		Op, Path, NewPath string
+		Bytes             int64
+		Err               error
+	}
+	want := []call{
+		{Op: "Create", Path: "/a"},
+		{Op: "File.WriteString", Path: "/a", Bytes: 5},
+		{Op: "File.Close", Path: "/a"},
+		{Op: "Rename", Path: "/a", NewPath: "/b"},
+		{Op: "Open", Path: "/b"},
+		{Op: "File.Read", Path: "/b", Bytes: 5},
+		{Op: "File.Read", Path: "/b", Err: io.EOF},
+		{Op: "File.Close", Path: "/b"},
+		{Op: "Stat", Path: "/a", Err: statErr},
+	}
+	var got []call
+	for _, ev := range events {
+		got = append(got, call{ev.Op, ev.Path, ev.NewPath, ev.Bytes, ev.Err})
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("events:\n got %+v\nwant %+v", got, want)
+	}
+	if !os.IsNotExist(statErr) {
+		t.Errorf("Stat = %v, want not exist", statErr)
+	}
+}
+
+func TestInstrumentedFsNoHooks(t *testing.T) {
+	fs := NewInstrumentedFs(NewMemMapFs(), Hooks{})
+	if err := WriteFile(fs, "/a", []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := Capabilities(fs); got != Capabilities(NewMemMapFs()) {
+		t.Errorf("Capabilities = %v", got)
+	}
+}
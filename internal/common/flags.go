@@ -0,0 +1,25 @@
+package common
+
+import "os"
+
+// accessMode masks the access mode of an os.OpenFile flag.
+const accessMode = os.O_RDONLY | os.O_WRONLY | os.O_RDWR
+
+// ReadAccess reports whether a file opened with flag may be read.
+func ReadAccess(flag int) bool {
+	return flag&accessMode != os.O_WRONLY
+}
+
+// WriteAccess reports whether a file opened with flag may be written.
+// O_APPEND alone does not allow writing, like in os.
+func WriteAccess(flag int) bool {
+	return flag&accessMode != os.O_RDONLY
+}
+
+// ModifiesFs reports whether opening a file with flag needs a writable
+// filesystem: it opens the file for writing, may create it or truncates
+// it. Read-only filesystems reject these flags and accept all others,
+// e.g. O_SYNC or O_EXCL without O_CREATE.
+func ModifiesFs(flag int) bool {
+	return WriteAccess(flag) || flag&(os.O_CREATE|os.O_TRUNC) != 0
+}
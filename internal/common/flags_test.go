@@ -0,0 +1,31 @@
+package common
+
+import (
+	"os"
+	"testing"
+)
+
+func TestOpenFlags(t *testing.T) {
+	for _, tt := range []struct {
+		flag                  int
+		read, write, modifies bool
+	}{
+		{os.O_RDONLY, true, false, false},
+		{os.O_RDONLY | os.O_SYNC | os.O_EXCL, true, false, false},
+		{os.O_RDONLY | os.O_APPEND, true, false, false},
+		{os.O_RDONLY | os.O_TRUNC, true, false, true},
+		{os.O_RDONLY | os.O_CREATE, true, false, true},
+		{os.O_WRONLY, false, true, true},
+		{os.O_RDWR | os.O_APPEND, true, true, true},
+	} {
+		if got := ReadAccess(tt.flag); got != tt.read {
+			t.Errorf("ReadAccess(%#x) = %v, want %v", tt.flag, got, tt.read)
+		}
+		if got := WriteAccess(tt.flag); got != tt.write {
+			t.Errorf("WriteAccess(%#x) = %v, want %v", tt.flag, got, tt.write)
+		}
+		if got := ModifiesFs(tt.flag); got != tt.modifies {
+			t.Errorf("ModifiesFs(%#x) = %v, want %v", tt.flag, got, tt.modifies)
+		}
+	}
+}
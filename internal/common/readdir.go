@@ -0,0 +1,62 @@
+package common
+
+import (
+	"io"
+	"os"
+)
+
+// DirLister implements the Readdir contract of os.File for backends which
+// fetch the entries of a directory at once or in pages:
+//
+//   - Readdir(n) with n > 0 returns at most n entries, continuing where the
+//     previous call stopped, and a nil error. Once all entries were
+//     returned, it returns no entries and io.EOF, on every further call.
+//   - Readdir(n) with n <= 0 returns all remaining entries and a nil
+//     error, at the end of the directory as well.
+//
+// The zero value is ready to use.
+type DirLister struct {
+	entries []os.FileInfo
+	done    bool
+}
+
+// Readdir returns the next entries of the directory as described above,
+// calling fetch until it has enough of them. fetch returns the next page of
+// entries, and io.EOF with or after the last one. If it fails, Readdir
+// returns its error and keeps the entries fetched so far for the next call.
+func (l *DirLister) Readdir(n int, fetch func() ([]os.FileInfo, error)) ([]os.FileInfo, error) {
+	for !l.done && (n <= 0 || len(l.entries) < n) {
+		page, err := fetch()
+		l.entries = append(l.entries, page...)
+		if err == io.EOF {
+			l.done = true
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if n > 0 && len(l.entries) == 0 {
+		return nil, io.EOF
+	}
+	if n <= 0 || n > len(l.entries) {
+		n = len(l.entries)
+	}
+	res := l.entries[:n:n]
+	l.entries = l.entries[n:]
+	if res == nil {
+		res = []os.FileInfo{}
+	}
+	return res, nil
+}
+
+// Readdirnames returns the names of the entries Readdir returns.
+func (l *DirLister) Readdirnames(n int, fetch func() ([]os.FileInfo, error)) ([]string, error) {
+	fis, err := l.Readdir(n, fetch)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(fis))
+	for i, fi := range fis {
+		names[i] = fi.Name()
+	}
+	return names, nil
+}
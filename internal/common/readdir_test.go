@@ -0,0 +1,82 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+type entry string
+
+func (e entry) Name() string       { return string(e) }
+func (e entry) Size() int64        { return 0 }
+func (e entry) Mode() os.FileMode  { return 0o644 }
+func (e entry) ModTime() time.Time { return time.Time{} }
+func (e entry) IsDir() bool        { return false }
+func (e entry) Sys() interface{}   { return nil }
+
+// pages returns a fetch function returning the entries "0" to "n-1" in pages
+// of size, failing once before the page starting at entry fail.
+func pages(n, size, fail int) func() ([]os.FileInfo, error) {
+	next := 0
+	return func() ([]os.FileInfo, error) {
+		if next == fail {
+			fail = -1
+			return nil, syscall.ECONNRESET
+		}
+		var page []os.FileInfo
+		for ; next < n && len(page) < size; next++ {
+			page = append(page, entry(fmt.Sprint(next)))
+		}
+		if next == n {
+			return page, io.EOF
+		}
+		return page, nil
+	}
+}
+
+func TestDirLister(t *testing.T) {
+	for _, size := range []int{1, 3, 10} {
+		var l DirLister
+		fetch := pages(7, size, -1)
+		var got []string
+		for {
+			fis, err := l.Readdir(2, fetch)
+			if err == io.EOF {
+				if len(fis) != 0 {
+					t.Errorf("pages of %d: %d entries with io.EOF", size, len(fis))
+				}
+				break
+			}
+			if err != nil || len(fis) == 0 || len(fis) > 2 {
+				t.Fatalf("pages of %d: Readdir(2) = %d entries, %v", size, len(fis), err)
+			}
+			for _, fi := range fis {
+				got = append(got, fi.Name())
+			}
+		}
+		if fmt.Sprint(got) != "[0 1 2 3 4 5 6]" {
+			t.Errorf("pages of %d: Readdir(2) returned %v", size, got)
+		}
+		if fis, err := l.Readdir(1, fetch); len(fis) != 0 || err != io.EOF {
+			t.Errorf("pages of %d: Readdir(1) at the end = %v, %v", size, fis, err)
+		}
+		if fis, err := l.Readdir(-1, fetch); len(fis) != 0 || err != nil {
+			t.Errorf("pages of %d: Readdir(-1) at the end = %v, %v", size, fis, err)
+		}
+	}
+
+	// a failed fetch keeps what was fetched before
+	var l DirLister
+	fetch := pages(5, 2, 2)
+	if _, err := l.Readdir(3, fetch); !errors.Is(err, syscall.ECONNRESET) {
+		t.Fatalf("Readdir with a failing fetch = %v", err)
+	}
+	if names, err := l.Readdirnames(0, fetch); err != nil || fmt.Sprint(names) != "[0 1 2 3 4]" {
+		t.Errorf("Readdirnames(0) after the failure = %v, %v", names, err)
+	}
+}
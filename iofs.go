@@ -115,7 +115,18 @@ func (iofs IOFS) ReadFile(name string) ([]byte, error) {
 	return bytes, nil
 }
 
-func (iofs IOFS) Sub(dir string) (fs.FS, error) { return IOFS{NewBasePathFs(iofs.Fs, dir)}, nil }
+func (iofs IOFS) Sub(dir string) (fs.FS, error) {
+	const op = "sub"
+
+	if !fs.ValidPath(dir) {
+		return nil, iofs.wrapError(op, dir, fs.ErrInvalid)
+	}
+	if dir == "." {
+		return iofs, nil
+	}
+
+	return IOFS{NewBasePathFs(iofs.Fs, dir)}, nil
+}
 
 func (IOFS) wrapError(op, path string, err error) error {
 	if _, ok := err.(*fs.PathError); ok {
@@ -151,19 +162,92 @@ func (r readDirFile) ReadDir(n int) ([]fs.DirEntry, error) {
 }
 
 // FromIOFS adopts io/fs.FS to use it as afero.Fs
-// Note that io/fs.FS is read-only so all mutating methods will return fs.PathError with fs.ErrPermission
-// To store modifications you may use afero.CopyOnWriteFs
+// Note that io/fs.FS is read-only so mutating methods will return fs.PathError with fs.ErrPermission,
+// unless the fs.FS implements them with the signatures of the os package:
+//
+//	OpenFile(name string, flag int, perm fs.FileMode) (fs.File, error)
+//	Mkdir(name string, perm fs.FileMode) error
+//	MkdirAll(path string, perm fs.FileMode) error
+//	Remove(name string) error
+//	RemoveAll(path string) error
+//	Rename(oldname, newname string) error
+//	Chmod(name string, mode fs.FileMode) error
+//	Chown(name string, uid, gid int) error
+//	Chtimes(name string, atime, mtime time.Time) error
+//
+// Files returned by OpenFile are writable if they implement io.Writer.
+// An IOFS is unwrapped, so it round-trips to its afero.Fs.
+// To store modifications otherwise you may use afero.CopyOnWriteFs
 type FromIOFS struct {
 	fs.FS
 }
 
 var _ Fs = FromIOFS{}
 
-func (f FromIOFS) Create(name string) (File, error) { return nil, notImplemented("create", name) }
+// The optional interfaces FromIOFS uses for writing.
+type (
+	openFileFS interface {
+		OpenFile(name string, flag int, perm fs.FileMode) (fs.File, error)
+	}
+	mkdirFS interface {
+		Mkdir(name string, perm fs.FileMode) error
+	}
+	mkdirAllFS interface {
+		MkdirAll(path string, perm fs.FileMode) error
+	}
+	removeFS interface {
+		Remove(name string) error
+	}
+	removeAllFS interface {
+		RemoveAll(path string) error
+	}
+	renameFS interface {
+		Rename(oldname, newname string) error
+	}
+	chmodFS interface {
+		Chmod(name string, mode fs.FileMode) error
+	}
+	chownFS interface {
+		Chown(name string, uid, gid int) error
+	}
+	chtimesFS interface {
+		Chtimes(name string, atime, mtime time.Time) error
+	}
+)
 
-func (f FromIOFS) Mkdir(name string, perm os.FileMode) error { return notImplemented("mkdir", name) }
+// source returns the afero.Fs wrapped by an IOFS.
+func (f FromIOFS) source() (Fs, bool) {
+	iofs, ok := f.FS.(IOFS)
+	return iofs.Fs, ok
+}
+
+func (f FromIOFS) Create(name string) (File, error) {
+	if src, ok := f.source(); ok {
+		return src.Create(name)
+	}
+	if _, ok := f.FS.(openFileFS); ok {
+		return f.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o666)
+	}
+	return nil, notImplemented("create", name)
+}
+
+func (f FromIOFS) Mkdir(name string, perm os.FileMode) error {
+	if src, ok := f.source(); ok {
+		return src.Mkdir(name, perm)
+	}
+	if m, ok := f.FS.(mkdirFS); ok {
+		return m.Mkdir(name, perm)
+	}
+	return notImplemented("mkdir", name)
+}
 
 func (f FromIOFS) MkdirAll(path string, perm os.FileMode) error {
+	if src, ok := f.source(); ok {
+		return src.MkdirAll(path, perm)
+	}
+	if m, ok := f.FS.(mkdirAllFS); ok {
+		return m.MkdirAll(path, perm)
+	}
 	return notImplemented("mkdirall", path)
 }
 
@@ -177,18 +261,46 @@ func (f FromIOFS) Open(name string) (File, error) {
 }
 
 func (f FromIOFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	if src, ok := f.source(); ok {
+		return src.OpenFile(name, flag, perm)
+	}
+	if o, ok := f.FS.(openFileFS); ok {
+		file, err := o.OpenFile(name, flag, perm)
+		if err != nil {
+			return nil, err
+		}
+		return fromIOFSFile{File: file, name: name}, nil
+	}
 	return f.Open(name)
 }
 
 func (f FromIOFS) Remove(name string) error {
+	if src, ok := f.source(); ok {
+		return src.Remove(name)
+	}
+	if r, ok := f.FS.(removeFS); ok {
+		return r.Remove(name)
+	}
 	return notImplemented("remove", name)
 }
 
 func (f FromIOFS) RemoveAll(path string) error {
+	if src, ok := f.source(); ok {
+		return src.RemoveAll(path)
+	}
+	if r, ok := f.FS.(removeAllFS); ok {
+		return r.RemoveAll(path)
+	}
 	return notImplemented("removeall", path)
 }
 
 func (f FromIOFS) Rename(oldname, newname string) error {
+	if src, ok := f.source(); ok {
+		return src.Rename(oldname, newname)
+	}
+	if r, ok := f.FS.(renameFS); ok {
+		return r.Rename(oldname, newname)
+	}
 	return notImplemented("rename", oldname)
 }
 
@@ -197,14 +309,32 @@ func (f FromIOFS) Stat(name string) (os.FileInfo, error) { return fs.Stat(f.FS,
 func (f FromIOFS) Name() string { return "fromiofs" }
 
 func (f FromIOFS) Chmod(name string, mode os.FileMode) error {
+	if src, ok := f.source(); ok {
+		return src.Chmod(name, mode)
+	}
+	if c, ok := f.FS.(chmodFS); ok {
+		return c.Chmod(name, mode)
+	}
 	return notImplemented("chmod", name)
 }
 
 func (f FromIOFS) Chown(name string, uid, gid int) error {
+	if src, ok := f.source(); ok {
+		return src.Chown(name, uid, gid)
+	}
+	if c, ok := f.FS.(chownFS); ok {
+		return c.Chown(name, uid, gid)
+	}
 	return notImplemented("chown", name)
 }
 
 func (f FromIOFS) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	if src, ok := f.source(); ok {
+		return src.Chtimes(name, atime, mtime)
+	}
+	if c, ok := f.FS.(chtimesFS); ok {
+		return c.Chtimes(name, atime, mtime)
+	}
 	return notImplemented("chtimes", name)
 }
 
@@ -232,11 +362,21 @@ func (f fromIOFSFile) Seek(offset int64, whence int) (int64, error) {
 }
 
 func (f fromIOFSFile) Write(p []byte) (n int, err error) {
-	return -1, notImplemented("write", f.name)
+	writer, ok := f.File.(io.Writer)
+	if !ok {
+		return -1, notImplemented("write", f.name)
+	}
+
+	return writer.Write(p)
 }
 
 func (f fromIOFSFile) WriteAt(p []byte, off int64) (n int, err error) {
-	return -1, notImplemented("writeat", f.name)
+	writerAt, ok := f.File.(io.WriterAt)
+	if !ok {
+		return -1, notImplemented("writeat", f.name)
+	}
+
+	return writerAt.WriteAt(p, off)
 }
 
 func (f fromIOFSFile) Name() string { return f.name }
@@ -282,14 +422,29 @@ func (f fromIOFSFile) Readdirnames(n int) ([]string, error) {
 	return ret, nil
 }
 
-func (f fromIOFSFile) Sync() error { return nil }
+func (f fromIOFSFile) Sync() error {
+	if syncer, ok := f.File.(interface{ Sync() error }); ok {
+		return syncer.Sync()
+	}
+
+	return nil
+}
 
 func (f fromIOFSFile) Truncate(size int64) error {
-	return notImplemented("truncate", f.name)
+	truncater, ok := f.File.(interface{ Truncate(int64) error })
+	if !ok {
+		return notImplemented("truncate", f.name)
+	}
+
+	return truncater.Truncate(size)
 }
 
 func (f fromIOFSFile) WriteString(s string) (ret int, err error) {
-	return -1, notImplemented("writestring", f.name)
+	if _, ok := f.File.(io.Writer); !ok {
+		return -1, notImplemented("writestring", f.name)
+	}
+
+	return f.Write([]byte(s))
 }
 
 func notImplemented(op, path string) error {
@@ -549,3 +549,91 @@ func BenchmarkWalkDir(b *testing.B) {
 		}
 	}
 }
+
+func TestIOFSSub(t *testing.T) {
+	mmfs := NewMemMapFs()
+	WriteFile(mmfs, "dir1/test.txt", []byte("sub"), 0o644)
+	iofs := NewIOFS(mmfs)
+
+	if _, err := iofs.Sub("../dir1"); !errors.Is(err, fs.ErrInvalid) {
+		t.Errorf("Sub invalid path: got %v, want ErrInvalid", err)
+	}
+	if sub, err := iofs.Sub("."); err != nil || sub != fs.FS(iofs) {
+		t.Errorf("Sub(.) = %v, %v, want the same FS", sub, err)
+	}
+	sub, err := fs.Sub(iofs, "dir1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := fs.ReadFile(sub, "test.txt"); err != nil || string(data) != "sub" {
+		t.Errorf("ReadFile in Sub = %q, %v", data, err)
+	}
+}
+
+// writableDirFS is an fs.FS with the write methods FromIOFS looks for.
+type writableDirFS struct {
+	fs.FS
+	dir string
+}
+
+func (w writableDirFS) OpenFile(name string, flag int, perm fs.FileMode) (fs.File, error) {
+	return os.OpenFile(filepath.Join(w.dir, name), flag, perm)
+}
+
+func (w writableDirFS) Mkdir(name string, perm fs.FileMode) error {
+	return os.Mkdir(filepath.Join(w.dir, name), perm)
+}
+
+func (w writableDirFS) Remove(name string) error {
+	return os.Remove(filepath.Join(w.dir, name))
+}
+
+func TestFromIOFSWritable(t *testing.T) {
+	t.Run("round-trip", func(t *testing.T) {
+		mmfs := NewMemMapFs()
+		fromIOFS := FromIOFS{NewIOFS(mmfs)}
+
+		if err := fromIOFS.Mkdir("dir", 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := WriteFile(fromIOFS, "dir/test.txt", []byte("written"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if data, err := ReadFile(mmfs, "dir/test.txt"); err != nil || string(data) != "written" {
+			t.Errorf("ReadFile = %q, %v", data, err)
+		}
+		if err := fromIOFS.Rename("dir/test.txt", "dir/moved.txt"); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("optional interfaces", func(t *testing.T) {
+		dir := t.TempDir()
+		fromIOFS := FromIOFS{writableDirFS{os.DirFS(dir), dir}}
+
+		if err := fromIOFS.Mkdir("dir", 0o755); err != nil {
+			t.Fatal(err)
+		}
+		f, err := fromIOFS.Create("dir/test.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.WriteString("written"); err != nil {
+			t.Error(err)
+		}
+		if err := f.Truncate(4); err != nil {
+			t.Error(err)
+		}
+		f.Close()
+		if data, err := os.ReadFile(filepath.Join(dir, "dir", "test.txt")); err != nil || string(data) != "writ" {
+			t.Errorf("ReadFile = %q, %v", data, err)
+		}
+		if err := fromIOFS.Remove("dir/test.txt"); err != nil {
+			t.Error(err)
+		}
+
+		// Methods the fs.FS does not implement are still refused.
+		assertPermissionError(t, fromIOFS.Rename("dir", "other"))
+		assertPermissionError(t, fromIOFS.MkdirAll("a/b", 0o755))
+	})
+}
@@ -17,14 +17,20 @@ package afero
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/spf13/afero/internal/common"
 )
 
 // byName implements sort.Interface.
@@ -54,6 +60,48 @@ func ReadDir(fs Fs, dirname string) ([]os.FileInfo, error) {
 	return list, nil
 }
 
+// dirEntryReader is implemented by files which read directory entries
+// without a Stat per entry, like *os.File.
+type dirEntryReader interface {
+	ReadDir(n int) ([]fs.DirEntry, error)
+}
+
+// ReadDirEntries reads the directory named by dirname and returns its
+// entries sorted by name. Unlike ReadDir it uses the ReadDir method of the
+// File when it has one, which on OsFs saves a Lstat per entry.
+func (a Afero) ReadDirEntries(dirname string) ([]fs.DirEntry, error) {
+	return ReadDirEntries(a.Fs, dirname)
+}
+
+func ReadDirEntries(fs Fs, dirname string) ([]fs.DirEntry, error) {
+	f, err := fs.Open(dirname)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := readDirEntries(f)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+func readDirEntries(f File) ([]fs.DirEntry, error) {
+	if rd, ok := f.(dirEntryReader); ok {
+		return rd.ReadDir(-1)
+	}
+	list, err := f.Readdir(-1)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]fs.DirEntry, len(list))
+	for i, fi := range list {
+		entries[i] = common.FileInfoDirEntry{FileInfo: fi}
+	}
+	return entries, nil
+}
+
 // ReadFile reads the file named by filename and returns the contents.
 // A successful call returns err == nil, not err == EOF. Because ReadFile
 // reads the whole file, it does not treat an EOF from Read as an error
@@ -68,6 +116,27 @@ func ReadFile(fs Fs, filename string) ([]byte, error) {
 		return nil, err
 	}
 	defer f.Close()
+	return readFile(f, f)
+}
+
+// ReadFileContext reads the file named by filename like ReadFile. It is
+// opened through OpenFileContext if the Fs implements ContextFs, and reading
+// stops with the error of ctx once it is done.
+func (a Afero) ReadFileContext(ctx context.Context, filename string) ([]byte, error) {
+	return ReadFileContext(ctx, a.Fs, filename)
+}
+
+func ReadFileContext(ctx context.Context, fs Fs, filename string) ([]byte, error) {
+	f, err := openFileContext(ctx, fs, filename, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readFile(f, contextReader{ctx, f})
+}
+
+// readFile reads r, the content of f, until EOF.
+func readFile(f File, r io.Reader) ([]byte, error) {
 	// It's a good but not certain bet that FileInfo will tell us exactly how much to
 	// read, so let's try it but be prepared for the answer to be wrong.
 	var n int64
@@ -83,7 +152,7 @@ func ReadFile(fs Fs, filename string) ([]byte, error) {
 	// call will read into its allocated internal buffer cheaply.  If the size was
 	// wrong, we'll either waste some space off the end or reallocate as needed, but
 	// in the overwhelmingly common case we'll get it just right.
-	return readAll(f, n+bytes.MinRead)
+	return readAll(r, n+bytes.MinRead)
 }
 
 // readAll reads from r until an error or EOF and returns the data it read
@@ -137,6 +206,95 @@ func WriteFile(fs Fs, filename string, data []byte, perm os.FileMode) error {
 	return err
 }
 
+// WriteFileContext writes data to the file named by filename like
+// WriteFile. It is opened through OpenFileContext if the Fs implements
+// ContextFs, and writing stops with the error of ctx once it is done,
+// leaving the file with part of data.
+func (a Afero) WriteFileContext(ctx context.Context, filename string, data []byte, perm os.FileMode) error {
+	return WriteFileContext(ctx, a.Fs, filename, data, perm)
+}
+
+func WriteFileContext(ctx context.Context, fs Fs, filename string, data []byte, perm os.FileMode) error {
+	f, err := openFileContext(ctx, fs, filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	for len(data) > 0 {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		chunk := data
+		if len(chunk) > contextChunkSize {
+			chunk = chunk[:contextChunkSize]
+		}
+		var n int
+		n, err = f.Write(chunk)
+		if err == nil && n < len(chunk) {
+			err = io.ErrShortWrite
+		}
+		if err != nil {
+			break
+		}
+		data = data[n:]
+	}
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	return err
+}
+
+func (a Afero) WriteFileAtomic(filename string, data []byte, perm os.FileMode) error {
+	return WriteFileAtomic(a.Fs, filename, data, perm)
+}
+
+// WriteFileAtomic writes data to a file named by filename so that readers
+// see either the old or the new content, never a partially written file.
+// The data is written to a temporary file in the same directory, synced and
+// renamed into place.
+//
+// The write is only as atomic as Rename of fs. If Rename fails with an error
+// matching errors.ErrUnsupported, the temporary file is removed and
+// WriteFileAtomic falls back to WriteFile, which truncates and rewrites
+// filename in place.
+func WriteFileAtomic(fs Fs, filename string, data []byte, perm os.FileMode) error {
+	dir, base := filepath.Split(filename)
+	if dir == "" {
+		dir = "."
+	}
+	f, err := TempFile(fs, dir, "."+base+".tmp*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	n, err := f.Write(data)
+	if err == nil && n < len(data) {
+		err = io.ErrShortWrite
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	if err == nil {
+		if err = fs.Chmod(tmp, perm); errors.Is(err, errors.ErrUnsupported) {
+			// the mode is that of the backend
+			err = nil
+		}
+	}
+	if err != nil {
+		fs.Remove(tmp)
+		return err
+	}
+	if err = fs.Rename(tmp, filename); err != nil {
+		fs.Remove(tmp)
+		if errors.Is(err, errors.ErrUnsupported) {
+			return WriteFile(fs, filename, data, perm)
+		}
+	}
+	return err
+}
+
 // Random number state.
 // We generate random temporary file names so that there's a good
 // chance the file doesn't exist yet - keeps the number of tries in
@@ -162,6 +320,41 @@ func nextRandom() string {
 	return strconv.Itoa(int(1e9 + r%1e9))[1:]
 }
 
+// tempNameFunc holds the func() string generating the random part of the
+// names picked by TempFile and TempDir.
+var tempNameFunc atomic.Value
+
+// SetTempNameFunc replaces the generator for the random part of the names
+// picked by TempFile and TempDir, e.g. to get reproducible names in golden
+// tests. The generator must be safe for concurrent use. Passing nil restores
+// the default generator. The returned function restores the previous one:
+//
+//	defer afero.SetTempNameFunc(func() string { return "fixed" })()
+//
+// The generator is shared by the whole process, including tests running in
+// parallel; TempFileFunc and TempDirFunc take one for a single call instead.
+func SetTempNameFunc(f func() string) (restore func()) {
+	prev := tempNameFunc.Load()
+	if f == nil {
+		f = nextRandom
+	}
+	tempNameFunc.Store(f)
+	return func() {
+		if prev == nil {
+			tempNameFunc.Store(nextRandom)
+			return
+		}
+		tempNameFunc.Store(prev)
+	}
+}
+
+func nextTempName() string {
+	if f, ok := tempNameFunc.Load().(func() string); ok {
+		return f()
+	}
+	return nextRandom()
+}
+
 // TempFile creates a new temporary file in the directory dir,
 // opens the file for reading and writing, and returns the resulting *os.File.
 // The filename is generated by taking pattern and adding a random
@@ -178,20 +371,24 @@ func (a Afero) TempFile(dir, pattern string) (f File, err error) {
 }
 
 func TempFile(fs Fs, dir, pattern string) (f File, err error) {
+	return TempFileFunc(fs, dir, pattern, nextTempName)
+}
+
+// TempFileFunc is TempFile with the random part of the name generated by
+// next, which is tried again as long as the name is taken.
+func TempFileFunc(fs Fs, dir, pattern string, next func() string) (f File, err error) {
 	if dir == "" {
 		dir = os.TempDir()
 	}
 
-	var prefix, suffix string
-	if pos := strings.LastIndex(pattern, "*"); pos != -1 {
-		prefix, suffix = pattern[:pos], pattern[pos+1:]
-	} else {
-		prefix = pattern
+	prefix, suffix, err := prefixAndSuffix(pattern)
+	if err != nil {
+		return nil, &os.PathError{Op: "createtemp", Path: pattern, Err: err}
 	}
 
 	nconflict := 0
 	for i := 0; i < 10000; i++ {
-		name := filepath.Join(dir, prefix+nextRandom()+suffix)
+		name := filepath.Join(dir, prefix+next()+suffix)
 		f, err = fs.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o600)
 		if os.IsExist(err) {
 			if nconflict++; nconflict > 10 {
@@ -207,24 +404,37 @@ func TempFile(fs Fs, dir, pattern string) (f File, err error) {
 }
 
 // TempDir creates a new temporary directory in the directory dir
-// with a name beginning with prefix and returns the path of the
-// new directory.  If dir is the empty string, TempDir uses the
+// and returns the path of the new directory. The directory name is
+// generated by adding a random string to the end of pattern. If pattern
+// includes a "*", the random string replaces the last "*" instead.
+// If dir is the empty string, TempDir uses the
 // default directory for temporary files (see os.TempDir).
 // Multiple programs calling TempDir simultaneously
 // will not choose the same directory.  It is the caller's responsibility
 // to remove the directory when no longer needed.
-func (a Afero) TempDir(dir, prefix string) (name string, err error) {
-	return TempDir(a.Fs, dir, prefix)
+func (a Afero) TempDir(dir, pattern string) (name string, err error) {
+	return TempDir(a.Fs, dir, pattern)
+}
+
+func TempDir(fs Fs, dir, pattern string) (name string, err error) {
+	return TempDirFunc(fs, dir, pattern, nextTempName)
 }
 
-func TempDir(fs Fs, dir, prefix string) (name string, err error) {
+// TempDirFunc is TempDir with the random part of the name generated by
+// next, which is tried again as long as the name is taken.
+func TempDirFunc(fs Fs, dir, pattern string, next func() string) (name string, err error) {
 	if dir == "" {
 		dir = os.TempDir()
 	}
 
+	prefix, suffix, err := prefixAndSuffix(pattern)
+	if err != nil {
+		return "", &os.PathError{Op: "mkdirtemp", Path: pattern, Err: err}
+	}
+
 	nconflict := 0
 	for i := 0; i < 10000; i++ {
-		try := filepath.Join(dir, prefix+nextRandom())
+		try := filepath.Join(dir, prefix+next()+suffix)
 		err = fs.Mkdir(try, 0o700)
 		if os.IsExist(err) {
 			if nconflict++; nconflict > 10 {
@@ -241,3 +451,40 @@ func TempDir(fs Fs, dir, prefix string) (name string, err error) {
 	}
 	return
 }
+
+var errPatternHasSeparator = errors.New("pattern contains path separator")
+
+// prefixAndSuffix splits pattern at the last "*", as os.CreateTemp does.
+func prefixAndSuffix(pattern string) (prefix, suffix string, err error) {
+	for i := 0; i < len(pattern); i++ {
+		if os.IsPathSeparator(pattern[i]) {
+			return "", "", errPatternHasSeparator
+		}
+	}
+	if pos := strings.LastIndex(pattern, "*"); pos != -1 {
+		prefix, suffix = pattern[:pos], pattern[pos+1:]
+	} else {
+		prefix = pattern
+	}
+	return prefix, suffix, nil
+}
+
+// CreateTemp is TempFile under the name of its os package counterpart.
+func (a Afero) CreateTemp(dir, pattern string) (File, error) {
+	return TempFile(a.Fs, dir, pattern)
+}
+
+// CreateTemp is TempFile under the name of its os package counterpart.
+func CreateTemp(fs Fs, dir, pattern string) (File, error) {
+	return TempFile(fs, dir, pattern)
+}
+
+// MkdirTemp is TempDir under the name of its os package counterpart.
+func (a Afero) MkdirTemp(dir, pattern string) (string, error) {
+	return TempDir(a.Fs, dir, pattern)
+}
+
+// MkdirTemp is TempDir under the name of its os package counterpart.
+func MkdirTemp(fs Fs, dir, pattern string) (string, error) {
+	return TempDir(fs, dir, pattern)
+}
@@ -16,7 +16,11 @@
 package afero
 
 import (
+	"errors"
+	"io"
+	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
 )
@@ -81,6 +85,68 @@ func TestWriteFile(t *testing.T) {
 	testFS.Remove(filename) // ignore error
 }
 
+func TestWriteFileAtomic(t *testing.T) {
+	for _, fs := range []Fs{&MemMapFs{}, NewCopyOnWriteFs(&MemMapFs{}, &MemMapFs{})} {
+		fsutil := &Afero{Fs: fs}
+		fs.MkdirAll("/dir", 0o755)
+		if err := fsutil.WriteFile("/dir/file", []byte("old"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := fsutil.WriteFileAtomic("/dir/file", []byte("new"), 0o600); err != nil {
+			t.Fatalf("%s: WriteFileAtomic: %v", fs.Name(), err)
+		}
+
+		contents, err := fsutil.ReadFile("/dir/file")
+		if err != nil || string(contents) != "new" {
+			t.Errorf("%s: ReadFile = %q, %v, want %q", fs.Name(), contents, err, "new")
+		}
+		names, _ := fsutil.ReadDir("/dir")
+		if len(names) != 1 {
+			t.Errorf("%s: temporary files left behind: %v", fs.Name(), names)
+		}
+	}
+}
+
+// noRenameFs is a Fs which cannot rename.
+type noRenameFs struct {
+	Fs
+}
+
+func (noRenameFs) Rename(oldname, newname string) error {
+	return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: errors.ErrUnsupported}
+}
+
+func TestWriteFileAtomicWrapped(t *testing.T) {
+	// a wrapper declaring no capabilities still renames into place, so a
+	// file opened before keeps the old content
+	fs := struct{ Fs }{&MemMapFs{}}
+	WriteFile(fs, "/file", []byte("old"), 0o644)
+	f, err := fs.Open("/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := WriteFileAtomic(fs, "/file", []byte("new"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := io.ReadAll(f); string(data) != "old" {
+		t.Errorf("the file was rewritten in place: read %q", data)
+	}
+
+	// without Rename, the file is written in place
+	nfs := noRenameFs{&MemMapFs{}}
+	WriteFile(nfs, "/file", []byte("old"), 0o644)
+	if err := WriteFileAtomic(nfs, "/file", []byte("new"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ReadFile(nfs, "/file"); string(data) != "new" {
+		t.Errorf("content = %q", data)
+	}
+	if names, _ := ReadDir(nfs, "/"); len(names) != 1 {
+		t.Errorf("temporary files left behind: %v", names)
+	}
+}
+
 func TestReadDir(t *testing.T) {
 	testFS = &MemMapFs{}
 	testFS.Mkdir("/i-am-a-dir", 0o777)
@@ -174,3 +240,138 @@ func TestTempFile(t *testing.T) {
 		})
 	}
 }
+
+func TestSetTempNameFunc(t *testing.T) {
+	var n int
+	restore := SetTempNameFunc(func() string {
+		n++
+		return strconv.Itoa(n)
+	})
+	defer restore()
+
+	fs := NewMemMapFs()
+	f, err := TempFile(fs, "/tmp", "file-*.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join("/tmp", "file-1.txt"); f.Name() != want {
+		t.Errorf("got %s, want %s", f.Name(), want)
+	}
+
+	// the next name is already taken, so TempDir has to move on to the one after
+	if err := fs.Mkdir(filepath.Join("/tmp", "dir2"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	name, err := TempDir(fs, "/tmp", "dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join("/tmp", "dir3"); name != want {
+		t.Errorf("got %s, want %s", name, want)
+	}
+
+	restore()
+	f, err = TempFile(fs, "/tmp", "file-*.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Name() == filepath.Join("/tmp", "file-4.txt") {
+		t.Error("default generator was not restored")
+	}
+}
+
+func TestTempFileFunc(t *testing.T) {
+	t.Parallel()
+	var n int
+	next := func() string {
+		n++
+		return strconv.Itoa(n)
+	}
+
+	fs := NewMemMapFs()
+	f, err := TempFileFunc(fs, "/tmp", "file-*.txt", next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join("/tmp", "file-1.txt"); f.Name() != want {
+		t.Errorf("got %s, want %s", f.Name(), want)
+	}
+	if err := fs.Mkdir(filepath.Join("/tmp", "dir2"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	name, err := TempDirFunc(fs, "/tmp", "dir", next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join("/tmp", "dir3"); name != want {
+		t.Errorf("got %s, want %s", name, want)
+	}
+}
+
+func TestTempPatterns(t *testing.T) {
+	fs := NewMemMapFs()
+
+	name, err := MkdirTemp(fs, "/tmp", "build-*.d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if base := filepath.Base(name); !strings.HasPrefix(base, "build-") || !strings.HasSuffix(base, ".d") || len(base) <= len("build-.d") {
+		t.Errorf("MkdirTemp() dir = %s, invalid name", name)
+	}
+	if ok, _ := IsDir(fs, name); !ok {
+		t.Errorf("%s is not a directory", name)
+	}
+
+	f, err := CreateTemp(fs, name, "myfile-*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if base := filepath.Base(f.Name()); !strings.HasPrefix(base, "myfile-") || !strings.HasSuffix(base, ".json") {
+		t.Errorf("CreateTemp() file = %s, invalid name", f.Name())
+	}
+
+	for _, pattern := range []string{"sub/file*", "../file*"} {
+		if _, err := CreateTemp(fs, "/tmp", pattern); err == nil {
+			t.Errorf("CreateTemp(%q) succeeded, want an error", pattern)
+		}
+		if _, err := MkdirTemp(fs, "/tmp", pattern); err == nil {
+			t.Errorf("MkdirTemp(%q) succeeded, want an error", pattern)
+		}
+	}
+}
+
+func TestReadDirEntries(t *testing.T) {
+	mem := NewMemMapFs()
+	for _, afs := range []Fs{mem, NewOsFs(), NewReadOnlyFs(mem)} {
+		dir := "/dir"
+		if _, ok := afs.(*OsFs); ok {
+			dir = t.TempDir()
+		}
+		if _, ok := afs.(*ReadOnlyFs); !ok {
+			afs.MkdirAll(filepath.Join(dir, "sub"), 0o755)
+			WriteFile(afs, filepath.Join(dir, "b"), []byte("bb"), 0o644)
+			WriteFile(afs, filepath.Join(dir, "a"), []byte("a"), 0o644)
+		}
+
+		entries, err := ReadDirEntries(afs, dir)
+		if err != nil {
+			t.Fatalf("%s: %v", afs.Name(), err)
+		}
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		if strings.Join(names, " ") != "a b sub" {
+			t.Errorf("%s: ReadDirEntries = %v, want [a b sub]", afs.Name(), names)
+		}
+		if !entries[2].IsDir() || entries[0].IsDir() {
+			t.Errorf("%s: IsDir is wrong", afs.Name())
+		}
+		if fi, err := entries[1].Info(); err != nil || fi.Size() != 2 {
+			t.Errorf("%s: Info = %v, %v", afs.Name(), fi, err)
+		}
+		if _, err := ReadDirEntries(afs, filepath.Join(dir, "missing")); err == nil {
+			t.Errorf("%s: ReadDirEntries of a missing directory succeeded", afs.Name())
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package afero
+
+import (
+	"io"
+	"os"
+	"sync"
+)
+
+var (
+	_ Locker = (*OsFs)(nil)
+	_ Locker = (*MemMapFs)(nil)
+)
+
+// Locker is an optional interface in Afero. It is only implemented by the
+// filesystems saying so.
+// LockIfPossible waits for an advisory lock on the existing file name,
+// shared or exclusive, and returns a Closer releasing it. The boolean
+// tells whether a lock was actually taken; if the filesystem, or the
+// platform, cannot lock files, it returns a Closer doing nothing and false.
+//
+// OsFs uses flock on Unix and LockFileEx on Windows, so the locks
+// coordinate with other processes. MemMapFs locks within the process.
+type Locker interface {
+	LockIfPossible(name string, exclusive bool) (io.Closer, bool, error)
+}
+
+// noLock is returned for filesystems that cannot lock.
+type noLock struct{}
+
+func (noLock) Close() error { return nil }
+
+// lockIfPossible locks name on fs if it is a Locker.
+func lockIfPossible(fs Fs, name string, exclusive bool) (io.Closer, bool, error) {
+	if l, ok := fs.(Locker); ok {
+		return l.LockIfPossible(name, exclusive)
+	}
+	return noLock{}, false, nil
+}
+
+func (OsFs) LockIfPossible(name string, exclusive bool) (io.Closer, bool, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, false, err
+	}
+	locked, err := lockFile(f, exclusive)
+	if err != nil {
+		f.Close()
+		return nil, false, &os.PathError{Op: "lock", Path: name, Err: err}
+	}
+	if !locked {
+		f.Close()
+		return noLock{}, false, nil
+	}
+	return &osLock{f: f}, true, nil
+}
+
+// osLock holds a lock on the open file f.
+type osLock struct {
+	once sync.Once
+	f    *os.File
+}
+
+func (l *osLock) Close() error {
+	err := os.ErrClosed
+	l.once.Do(func() {
+		err = unlockFile(l.f)
+		if cerr := l.f.Close(); err == nil {
+			err = cerr
+		}
+	})
+	return err
+}
+
+// memLock is the lock of a MemMapFs file, refs counts the handles using it.
+type memLock struct {
+	sync.RWMutex
+	refs int
+}
+
+func (m *MemMapFs) LockIfPossible(name string, exclusive bool) (io.Closer, bool, error) {
+	resolved, err := m.resolve(name, true)
+	if err != nil {
+		return nil, false, &os.PathError{Op: "lock", Path: name, Err: err}
+	}
+	m.mu.RLock()
+	_, ok := m.getData()[resolved]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, false, &os.PathError{Op: "lock", Path: name, Err: ErrFileNotFound}
+	}
+
+	m.lockMu.Lock()
+	if m.locks == nil {
+		m.locks = make(map[string]*memLock)
+	}
+	l := m.locks[resolved]
+	if l == nil {
+		l = &memLock{}
+		m.locks[resolved] = l
+	}
+	l.refs++
+	m.lockMu.Unlock()
+
+	if exclusive {
+		l.Lock()
+	} else {
+		l.RLock()
+	}
+	return &memLockHandle{fs: m, name: resolved, lock: l, exclusive: exclusive}, true, nil
+}
+
+// memLockHandle releases a lock taken by MemMapFs.LockIfPossible.
+type memLockHandle struct {
+	once      sync.Once
+	fs        *MemMapFs
+	name      string
+	lock      *memLock
+	exclusive bool
+}
+
+func (h *memLockHandle) Close() error {
+	err := os.ErrClosed
+	h.once.Do(func() {
+		if h.exclusive {
+			h.lock.Unlock()
+		} else {
+			h.lock.RUnlock()
+		}
+		h.fs.lockMu.Lock()
+		if h.lock.refs--; h.lock.refs == 0 {
+			delete(h.fs.locks, h.name)
+		}
+		h.fs.lockMu.Unlock()
+		err = nil
+	})
+	return err
+}
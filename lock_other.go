@@ -0,0 +1,17 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !windows
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!windows
+
+package afero
+
+import "os"
+
+// osCapLock is CapLock if OsFs can lock files on this platform.
+const osCapLock Capability = 0
+
+func lockFile(f *os.File, exclusive bool) (bool, error) {
+	return false, nil
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
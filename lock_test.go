@@ -0,0 +1,114 @@
+package afero
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testLocking checks that an exclusive lock on name excludes other locks
+// until it is released, while shared locks coexist.
+func testLocking(t *testing.T, fs Fs, name string) {
+	t.Helper()
+	l := fs.(Locker)
+
+	s1, ok, err := l.LockIfPossible(name, false)
+	if err != nil || !ok {
+		t.Fatalf("shared lock: %v, %v", ok, err)
+	}
+	s2, _, err := l.LockIfPossible(name, false)
+	if err != nil {
+		t.Fatalf("second shared lock: %v", err)
+	}
+
+	locked := make(chan struct{})
+	go func() {
+		ex, _, err := l.LockIfPossible(name, true)
+		if err != nil {
+			t.Error(err)
+		} else {
+			ex.Close()
+		}
+		close(locked)
+	}()
+
+	select {
+	case <-locked:
+		t.Fatal("exclusive lock taken while shared locks are held")
+	case <-time.After(50 * time.Millisecond):
+	}
+	s1.Close()
+	s2.Close()
+	select {
+	case <-locked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("exclusive lock not taken after shared locks were released")
+	}
+	if err := s1.Close(); err == nil {
+		t.Error("second Close of a lock succeeded")
+	}
+}
+
+func TestMemMapFsLock(t *testing.T) {
+	fs := NewMemMapFs()
+	WriteFile(fs, "/file", nil, 0o644)
+	testLocking(t, fs, "/file")
+
+	if _, _, err := fs.(Locker).LockIfPossible("/missing", true); !os.IsNotExist(err) {
+		t.Errorf("lock of missing file = %v, want not exist", err)
+	}
+	if n := len(fs.(*MemMapFs).locks); n != 0 {
+		t.Errorf("%d locks left after all were released", n)
+	}
+}
+
+func TestOsFsLock(t *testing.T) {
+	if osCapLock == 0 {
+		t.Skip("OsFs cannot lock files on this platform")
+	}
+	name := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(name, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	testLocking(t, NewOsFs(), name)
+}
+
+func TestLockForwarding(t *testing.T) {
+	mem := NewMemMapFs()
+	WriteFile(mem, "/base/file", nil, 0o644)
+
+	ex, ok, err := mem.(Locker).LockIfPossible("/base/file", true)
+	if err != nil || !ok {
+		t.Fatal(ok, err)
+	}
+	var waiting []chan struct{}
+	for _, fs := range []Fs{
+		NewBasePathFs(mem, "/base"),
+		NewReadOnlyFs(NewBasePathFs(mem, "/base")),
+	} {
+		locked := make(chan struct{})
+		go func(fs Fs) {
+			if l, _, err := fs.(Locker).LockIfPossible("/file", false); err == nil {
+				l.Close()
+			}
+			close(locked)
+		}(fs)
+		select {
+		case <-locked:
+			t.Errorf("%s: the lock was not forwarded to the source", fs.Name())
+		case <-time.After(20 * time.Millisecond):
+		}
+		waiting = append(waiting, locked)
+	}
+	ex.Close()
+	for _, locked := range waiting {
+		<-locked
+	}
+
+	l, ok, err := lockIfPossible(FromIOFS{}, "/file", true)
+	if err != nil || ok {
+		t.Errorf("lock without Locker = %v, %v", ok, err)
+	}
+	l.Close()
+}
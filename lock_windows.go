@@ -0,0 +1,28 @@
+package afero
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// osCapLock is CapLock if OsFs can lock files on this platform.
+const osCapLock = CapLock
+
+// lockRange covers the whole file, as flock does.
+const lockRange = ^uint32(0)
+
+func lockFile(f *os.File, exclusive bool) (bool, error) {
+	var flags uint32
+	if exclusive {
+		flags = windows.LOCKFILE_EXCLUSIVE_LOCK
+	}
+	ol := new(windows.Overlapped)
+	err := windows.LockFileEx(windows.Handle(f.Fd()), flags, 0, lockRange, lockRange, ol)
+	return err == nil, err
+}
+
+func unlockFile(f *os.File) error {
+	ol := new(windows.Overlapped)
+	return windows.UnlockFileEx(windows.Handle(f.Fd()), 0, lockRange, lockRange, ol)
+}
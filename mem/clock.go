@@ -0,0 +1,62 @@
+package mem
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the time to files, for their modification, access and change
+// times. Files without one use time.Now.
+type Clock interface {
+	Now() time.Time
+}
+
+// FakeClock is a Clock for tests. It stands still until it is set or
+// advanced, so the times of files can be asserted exactly.
+type FakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewFakeClock returns a FakeClock set to now.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Set sets the time of c to now.
+func (c *FakeClock) Set(now time.Time) {
+	c.mu.Lock()
+	c.now = now
+	c.mu.Unlock()
+}
+
+// Advance moves the time of c forward by d.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+// SetClock makes f, which was just created, take its times from c, and
+// sets them all to the time of c. Hard links of f share its clock.
+func SetClock(f *FileData, c Clock) {
+	f.Lock()
+	f.clock = c
+	now := f.now()
+	f.modtime, f.atime, f.ctime = now, now, now
+	f.Unlock()
+}
+
+// now returns the time of the clock of i.
+func (i *inode) now() time.Time {
+	if i.clock == nil {
+		return time.Now()
+	}
+	return i.clock.Now()
+}
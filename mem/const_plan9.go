@@ -0,0 +1,12 @@
+//go:build plan9
+// +build plan9
+
+package mem
+
+import (
+	"syscall"
+)
+
+// errNoSpace is returned when a Quota is exceeded. Plan 9 has no errno
+// values, this is the message of its kernel.
+const errNoSpace = syscall.ErrorString("file system full")
@@ -0,0 +1,11 @@
+//go:build !plan9
+// +build !plan9
+
+package mem
+
+import (
+	"syscall"
+)
+
+// errNoSpace is returned when a Quota is exceeded.
+const errNoSpace = syscall.ENOSPC
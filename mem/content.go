@@ -0,0 +1,175 @@
+package mem
+
+// chunkSize is the size of the chunks the content of files is stored in.
+const chunkSize = 64 << 10
+
+// content is the data of a file. It is stored in chunks covering chunkSize
+// bytes each, keyed by their index. Missing chunks, and the bytes past the
+// end of a chunk shorter than chunkSize, are holes: they read as zeros and
+// take no memory, so seeking far past the end before writing, or growing a
+// file with Truncate, is cheap.
+//
+// Content installed with SetBytes, or read with Bytes, is kept in flat
+// instead, a single slice which can be handed out without copying it. It is
+// split into chunks aliasing it when the file is modified.
+type content struct {
+	size      int64
+	allocated int64
+	chunks    map[int64][]byte
+	flat      []byte
+}
+
+func newContent(b []byte) content {
+	var c content
+	c.writeAt(b, 0)
+	return c
+}
+
+// bytes returns all of c.
+func (c *content) bytes() []byte {
+	b := make([]byte, c.size)
+	c.readAt(b, 0)
+	return b
+}
+
+// flatten returns all of c as one slice. It keeps them that way, so that
+// the next call does not copy them again, unless that would allocate the
+// holes of c beyond what charge allows.
+func (c *content) flatten(charge func(int64) error) []byte {
+	if c.flat != nil {
+		return c.flat
+	}
+	var b []byte
+	if chunk := c.chunks[0]; len(c.chunks) == 1 && int64(len(chunk)) == c.size {
+		b = chunk[:c.size:c.size]
+	} else {
+		b = c.bytes()
+		if charge(c.size-c.allocated) != nil {
+			return b
+		}
+	}
+	*c = content{size: c.size, allocated: c.size, flat: b}
+	return b
+}
+
+// split turns a flat c into chunks aliasing it, for modifying it.
+func (c *content) split() {
+	if c.flat == nil {
+		return
+	}
+	b := c.flat
+	c.flat = nil
+	c.chunks = make(map[int64][]byte, (len(b)+chunkSize-1)/chunkSize)
+	for idx := int64(0); len(b) > 0; idx++ {
+		n := min(len(b), chunkSize)
+		// limit the capacity, so that growing a chunk cannot overwrite
+		// the next one
+		c.chunks[idx] = b[:n:n]
+		b = b[n:]
+	}
+}
+
+// readAt copies the bytes of c starting at off into b and returns their
+// number, which is less than len(b) at the end of c.
+func (c *content) readAt(b []byte, off int64) int {
+	if off >= c.size {
+		return 0
+	}
+	if c.flat != nil {
+		return copy(b, c.flat[off:])
+	}
+	if rest := c.size - off; int64(len(b)) > rest {
+		b = b[:rest]
+	}
+	n := 0
+	for n < len(b) {
+		pos := off + int64(n)
+		chunk, within := c.chunks[pos/chunkSize], int(pos%chunkSize)
+		end := n + chunkSize - within
+		if end > len(b) {
+			end = len(b)
+		}
+		copied := 0
+		if within < len(chunk) {
+			copied = copy(b[n:end], chunk[within:])
+		}
+		clear(b[n+copied : end])
+		n = end
+	}
+	return n
+}
+
+// growth returns by how much writing n bytes at off increases the
+// allocated memory.
+func (c *content) growth(off int64, n int) int64 {
+	c.split()
+	var res int64
+	for end := off + int64(n); off < end; {
+		idx, within := off/chunkSize, off%chunkSize
+		last := min(chunkSize, within+end-off)
+		if have := int64(len(c.chunks[idx])); last > have {
+			res += last - have
+		}
+		off += last - within
+	}
+	return res
+}
+
+// writeAt writes b at off, growing c if needed.
+func (c *content) writeAt(b []byte, off int64) {
+	c.split()
+	if c.chunks == nil && len(b) > 0 {
+		c.chunks = make(map[int64][]byte)
+	}
+	for len(b) > 0 {
+		idx, within := off/chunkSize, int(off%chunkSize)
+		n := min(len(b), chunkSize-within)
+		chunk := c.chunks[idx]
+		if len(chunk) < within+n {
+			c.allocated += int64(within + n - len(chunk))
+			chunk = append(chunk, make([]byte, within+n-len(chunk))...)
+			c.chunks[idx] = chunk
+		}
+		copy(chunk[within:], b[:n])
+		b, off = b[n:], off+int64(n)
+	}
+	if off > c.size {
+		c.size = off
+	}
+}
+
+// truncate changes the size of c. Growing it adds a hole.
+func (c *content) truncate(size int64) {
+	c.split()
+	if size < c.size {
+		for idx, chunk := range c.chunks {
+			start := idx * chunkSize
+			switch {
+			case start >= size:
+				c.allocated -= int64(len(chunk))
+				delete(c.chunks, idx)
+			case start+int64(len(chunk)) > size:
+				// the bytes past size must read as zeros if c grows again
+				keep := size - start
+				c.allocated -= int64(len(chunk)) - keep
+				c.chunks[idx] = chunk[:keep:keep]
+			}
+		}
+	}
+	c.size = size
+}
+
+// clone returns a copy of c not sharing memory with it.
+func (c *content) clone() content {
+	res := content{size: c.size, allocated: c.allocated}
+	if c.flat != nil {
+		res.flat = append([]byte{}, c.flat...)
+	}
+	if c.chunks != nil {
+		res.chunks = make(map[int64][]byte, len(c.chunks))
+		for idx, chunk := range c.chunks {
+			res.chunks[idx] = append([]byte(nil), chunk...)
+		}
+	}
+	return res
+}
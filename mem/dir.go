@@ -32,6 +32,17 @@ func AddToMemDir(dir *FileData, f *FileData) {
 func InitializeDir(d *FileData) {
 	if d.memDir == nil {
 		d.dir = true
-		d.memDir = &DirMap{}
+		d.memDir = newEntries()
 	}
 }
+
+// Children returns the entries of the directory d sorted by name, or nil if
+// d is not a directory.
+func Children(d *FileData) []*FileData {
+	d.Lock()
+	defer d.Unlock()
+	if d.memDir == nil {
+		return nil
+	}
+	return d.memDir.Files()
+}
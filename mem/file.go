@@ -15,14 +15,14 @@
 package mem
 
 import (
-	"bytes"
 	"errors"
 	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
-	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/spf13/afero/internal/common"
@@ -32,13 +32,24 @@ const FilePathSeparator = string(filepath.Separator)
 
 var _ fs.ReadDirFile = &File{}
 
+// File is an open handle of a FileData, like a file descriptor: the content
+// and metadata are shared by all handles of the file, while each File has
+// its own offset, directory position, access mode and closed state. Both
+// are guarded by the lock of the FileData, so a File may be used
+// concurrently, and ReadAt and WriteAt do not affect its offset.
 type File struct {
-	// atomic requires 64-bit alignment for struct field access
 	at           int64
 	readDirCount int64
 	closed       bool
 	readOnly     bool
+	writeOnly    bool
+	append       bool
 	fileData     *FileData
+
+	// trackAtime makes reads update the access time of the file.
+	trackAtime bool
+	// order is the order in which Readdir lists a directory.
+	order ReaddirOrder
 }
 
 func NewFileHandle(data *FileData) *File {
@@ -49,20 +60,63 @@ func NewReadOnlyFileHandle(data *FileData) *File {
 	return &File{fileData: data, readOnly: true}
 }
 
+// NewFileHandleFlag returns a handle for data as opened with the os.OpenFile
+// flag: it can only be read or written if the access mode of flag allows
+// it, and with O_APPEND every write goes to the end of the file.
+func NewFileHandleFlag(data *FileData, flag int) *File {
+	return &File{
+		fileData:  data,
+		readOnly:  !common.WriteAccess(flag),
+		writeOnly: !common.ReadAccess(flag),
+		append:    flag&os.O_APPEND != 0,
+	}
+}
+
 func (f File) Data() *FileData {
 	return f.fileData
 }
 
+// SetAccessTimeTracking makes reads through f update the access time of the
+// file, as without the noatime mount option.
+func (f *File) SetAccessTimeTracking(on bool) {
+	f.trackAtime = on
+}
+
+// SetReaddirOrder sets the order in which Readdir and Readdirnames list the
+// directory f. Changing it between calls may repeat or skip entries.
+func (f *File) SetReaddirOrder(order ReaddirOrder) {
+	f.order = order
+}
+
 type FileData struct {
+	*inode
+	name string
+}
+
+// inode holds everything but the name of a file, so hard links can share it.
+type inode struct {
 	sync.Mutex
-	name    string
-	data    []byte
+	data    content
 	memDir  Dir
 	dir     bool
 	mode    os.FileMode
 	modtime time.Time
+	atime   time.Time
+	ctime   time.Time
 	uid     int
 	gid     int
+	xattrs  map[string][]byte
+
+	// shared is set while data may be shared with a snapshot, it must be
+	// copied before it is modified.
+	shared bool
+
+	// quota is charged for the size of data while nlink > 0.
+	quota *Quota
+	nlink int
+
+	// clock is set by SetClock.
+	clock Clock
 }
 
 func (d *FileData) Name() string {
@@ -71,12 +125,48 @@ func (d *FileData) Name() string {
 	return d.name
 }
 
+// newInode returns an inode with all times set to now.
+func newInode() *inode {
+	now := time.Now()
+	return &inode{modtime: now, atime: now, ctime: now}
+}
+
 func CreateFile(name string) *FileData {
-	return &FileData{name: name, mode: os.ModeTemporary, modtime: time.Now()}
+	i := newInode()
+	i.mode = os.ModeTemporary
+	return &FileData{name: name, inode: i}
 }
 
 func CreateDir(name string) *FileData {
-	return &FileData{name: name, memDir: &DirMap{}, dir: true, modtime: time.Now()}
+	i := newInode()
+	i.memDir, i.dir = newEntries(), true
+	return &FileData{name: name, inode: i}
+}
+
+// CreateSymlink returns a symbolic link named name pointing to target.
+func CreateSymlink(name, target string) *FileData {
+	i := newInode()
+	i.data, i.mode = newContent([]byte(target)), os.ModeSymlink|0o777
+	return &FileData{name: name, inode: i}
+}
+
+// CreateLink returns a hard link named name to f. Both share their content,
+// mode, times and owner.
+func CreateLink(name string, f *FileData) *FileData {
+	return &FileData{name: name, inode: f.inode}
+}
+
+// Inode returns a value identifying the file f names, which is the same for
+// all hard links to it.
+func Inode(f *FileData) interface{} {
+	return f.inode
+}
+
+// LinkTarget returns the target of a symbolic link created by CreateSymlink.
+func LinkTarget(f *FileData) string {
+	f.Lock()
+	defer f.Unlock()
+	return string(f.data.bytes())
 }
 
 func ChangeFileName(f *FileData, newname string) {
@@ -88,6 +178,7 @@ func ChangeFileName(f *FileData, newname string) {
 func SetMode(f *FileData, mode os.FileMode) {
 	f.Lock()
 	f.mode = mode
+	f.ctime = f.now()
 	f.Unlock()
 }
 
@@ -97,42 +188,137 @@ func SetModTime(f *FileData, mtime time.Time) {
 	f.Unlock()
 }
 
+// setModTime sets the modification time of f and its change time to now.
 func setModTime(f *FileData, mtime time.Time) {
 	f.modtime = mtime
+	f.ctime = f.now()
+}
+
+// SetAccessTime sets the access time of f.
+func SetAccessTime(f *FileData, atime time.Time) {
+	f.Lock()
+	f.atime = atime
+	f.Unlock()
 }
 
 func SetUID(f *FileData, uid int) {
 	f.Lock()
 	f.uid = uid
+	f.ctime = f.now()
 	f.Unlock()
 }
 
 func SetGID(f *FileData, gid int) {
 	f.Lock()
 	f.gid = gid
+	f.ctime = f.now()
+	f.Unlock()
+}
+
+// Owner returns the user and group id set with SetUID and SetGID.
+func Owner(f *FileData) (uid, gid int) {
+	f.Lock()
+	defer f.Unlock()
+	return f.uid, f.gid
+}
+
+// Xattr returns a copy of the extended attribute attr of f, and whether it
+// is set.
+func Xattr(f *FileData, attr string) ([]byte, bool) {
+	f.Lock()
+	defer f.Unlock()
+	value, ok := f.xattrs[attr]
+	return append([]byte(nil), value...), ok
+}
+
+// SetXattr sets the extended attribute attr of f to a copy of value.
+func SetXattr(f *FileData, attr string, value []byte) {
+	f.Lock()
+	if f.xattrs == nil {
+		f.xattrs = make(map[string][]byte)
+	}
+	f.xattrs[attr] = append([]byte{}, value...)
+	f.ctime = f.now()
 	f.Unlock()
 }
 
+// RemoveXattr removes the extended attribute attr of f and reports whether
+// it was set.
+func RemoveXattr(f *FileData, attr string) bool {
+	f.Lock()
+	defer f.Unlock()
+	if _, ok := f.xattrs[attr]; !ok {
+		return false
+	}
+	delete(f.xattrs, attr)
+	f.ctime = f.now()
+	return true
+}
+
+// XattrNames returns the sorted names of the extended attributes of f.
+func XattrNames(f *FileData) []string {
+	f.Lock()
+	defer f.Unlock()
+	names := make([]string, 0, len(f.xattrs))
+	for name := range f.xattrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Bytes returns the content of f without copying it, if it is kept in one
+// piece: content set with SetBytes is, and other content is put in one
+// piece by the first call. The slice must not be modified, and writes to f
+// may or may not show in it.
+func Bytes(f *FileData) []byte {
+	f.Lock()
+	defer f.Unlock()
+	return f.data.flatten(f.charge)
+}
+
+// SetBytes replaces the content of f with b without copying it. f owns b
+// from then on: writes to f may modify it, so the caller must not use it
+// anymore. It fails with ENOSPC if the quota of f would be exceeded.
+func SetBytes(f *FileData, b []byte) error {
+	f.Lock()
+	defer f.Unlock()
+	if err := f.charge(int64(len(b)) - f.data.allocated); err != nil {
+		return err
+	}
+	if b == nil {
+		b = []byte{}
+	}
+	f.data = content{size: int64(len(b)), allocated: int64(len(b)), flat: b}
+	f.shared = false
+	setModTime(f, f.now())
+	return nil
+}
+
 func GetFileInfo(f *FileData) *FileInfo {
 	return &FileInfo{f}
 }
 
 func (f *File) Open() error {
-	atomic.StoreInt64(&f.at, 0)
-	atomic.StoreInt64(&f.readDirCount, 0)
 	f.fileData.Lock()
+	f.at, f.readDirCount = 0, 0
 	f.closed = false
 	f.fileData.Unlock()
 	return nil
 }
 
+// Close closes f. Closing it again fails with ErrFileClosed, as do all
+// other methods but Name.
 func (f *File) Close() error {
 	f.fileData.Lock()
+	defer f.fileData.Unlock()
+	if f.closed {
+		return ErrFileClosed
+	}
 	f.closed = true
 	if !f.readOnly {
-		setModTime(f.fileData, time.Now())
+		setModTime(f.fileData, f.fileData.now())
 	}
-	f.fileData.Unlock()
 	return nil
 }
 
@@ -141,6 +327,11 @@ func (f *File) Name() string {
 }
 
 func (f *File) Stat() (os.FileInfo, error) {
+	f.fileData.Lock()
+	defer f.fileData.Unlock()
+	if f.closed {
+		return nil, ErrFileClosed
+	}
 	return &FileInfo{f.fileData}, nil
 }
 
@@ -155,7 +346,11 @@ func (f *File) Readdir(count int) (res []os.FileInfo, err error) {
 	var outLength int64
 
 	f.fileData.Lock()
-	files := f.fileData.memDir.Files()[f.readDirCount:]
+	if f.closed {
+		f.fileData.Unlock()
+		return nil, ErrFileClosed
+	}
+	files := listDir(f.fileData.memDir, f.order)[f.readDirCount:]
 	if count > 0 {
 		if len(files) < count {
 			outLength = int64(len(files))
@@ -169,6 +364,9 @@ func (f *File) Readdir(count int) (res []os.FileInfo, err error) {
 		outLength = int64(len(files))
 	}
 	f.readDirCount += outLength
+	if f.trackAtime {
+		f.fileData.atime = f.fileData.now()
+	}
 	f.fileData.Unlock()
 
 	res = make([]os.FileInfo, outLength)
@@ -204,102 +402,153 @@ func (f *File) ReadDir(n int) ([]fs.DirEntry, error) {
 func (f *File) Read(b []byte) (n int, err error) {
 	f.fileData.Lock()
 	defer f.fileData.Unlock()
-	if f.closed {
-		return 0, ErrFileClosed
+	if err := f.readable(); err != nil || len(b) == 0 {
+		return 0, err
 	}
-	if len(b) > 0 && int(f.at) == len(f.fileData.data) {
+	if f.at == f.fileData.data.size {
 		return 0, io.EOF
 	}
-	if int(f.at) > len(f.fileData.data) {
+	if f.at > f.fileData.data.size {
 		return 0, io.ErrUnexpectedEOF
 	}
-	if len(f.fileData.data)-int(f.at) >= len(b) {
-		n = len(b)
-	} else {
-		n = len(f.fileData.data) - int(f.at)
-	}
-	copy(b, f.fileData.data[f.at:f.at+int64(n)])
-	atomic.AddInt64(&f.at, int64(n))
-	return
+	n = f.read(b, f.at)
+	f.at += int64(n)
+	return n, nil
 }
 
+// ReadAt reads from off without changing the offset of f. Like os.File, it
+// returns io.EOF if it reads fewer than len(b) bytes at the end of the file.
 func (f *File) ReadAt(b []byte, off int64) (n int, err error) {
-	prev := atomic.LoadInt64(&f.at)
-	atomic.StoreInt64(&f.at, off)
-	n, err = f.Read(b)
-	atomic.StoreInt64(&f.at, prev)
-	return
+	f.fileData.Lock()
+	defer f.fileData.Unlock()
+	if err := f.readable(); err != nil || len(b) == 0 {
+		return 0, err
+	}
+	if off < 0 {
+		return 0, &os.PathError{Op: "readat", Path: f.fileData.name, Err: errors.New("negative offset")}
+	}
+	n = f.read(b, off)
+	if n < len(b) {
+		return n, io.EOF
+	}
+	return n, nil
 }
 
-func (f *File) Truncate(size int64) error {
+// readable reports why f cannot be read, if it cannot. The caller must hold
+// the lock of the FileData.
+func (f *File) readable() error {
 	if f.closed {
 		return ErrFileClosed
 	}
-	if f.readOnly {
-		return &os.PathError{Op: "truncate", Path: f.fileData.name, Err: errors.New("file handle is read only")}
+	if f.writeOnly {
+		return &os.PathError{Op: "read", Path: f.fileData.name, Err: errors.New("file handle is write only")}
 	}
-	if size < 0 {
-		return ErrOutOfRange
+	return nil
+}
+
+// read reads into b from off. The caller must hold the lock of the
+// FileData.
+func (f *File) read(b []byte, off int64) int {
+	n := f.fileData.data.readAt(b, off)
+	if f.trackAtime {
+		f.fileData.atime = f.fileData.now()
 	}
+	return n
+}
+
+func (f *File) Truncate(size int64) error {
 	f.fileData.Lock()
 	defer f.fileData.Unlock()
-	if size > int64(len(f.fileData.data)) {
-		diff := size - int64(len(f.fileData.data))
-		f.fileData.data = append(f.fileData.data, bytes.Repeat([]byte{0o0}, int(diff))...)
-	} else {
-		f.fileData.data = f.fileData.data[0:size]
+	if err := f.writable("truncate"); err != nil {
+		return err
 	}
-	setModTime(f.fileData, time.Now())
+	if size < 0 {
+		return ErrOutOfRange
+	}
+	f.fileData.unshare()
+	allocated := f.fileData.data.allocated
+	f.fileData.data.truncate(size)
+	f.fileData.charge(f.fileData.data.allocated - allocated)
+	setModTime(f.fileData, f.fileData.now())
 	return nil
 }
 
 func (f *File) Seek(offset int64, whence int) (int64, error) {
+	f.fileData.Lock()
+	defer f.fileData.Unlock()
 	if f.closed {
 		return 0, ErrFileClosed
 	}
 	switch whence {
 	case io.SeekStart:
-		atomic.StoreInt64(&f.at, offset)
 	case io.SeekCurrent:
-		atomic.AddInt64(&f.at, offset)
+		offset += f.at
 	case io.SeekEnd:
-		atomic.StoreInt64(&f.at, int64(len(f.fileData.data))+offset)
+		offset += f.fileData.data.size
+	default:
+		return 0, &os.PathError{Op: "seek", Path: f.fileData.name, Err: syscall.EINVAL}
+	}
+	if offset < 0 {
+		return 0, &os.PathError{Op: "seek", Path: f.fileData.name, Err: syscall.EINVAL}
 	}
-	return f.at, nil
+	f.at = offset
+	return offset, nil
 }
 
 func (f *File) Write(b []byte) (n int, err error) {
-	if f.closed {
-		return 0, ErrFileClosed
+	f.fileData.Lock()
+	defer f.fileData.Unlock()
+	if err := f.writable("write"); err != nil {
+		return 0, err
 	}
-	if f.readOnly {
-		return 0, &os.PathError{Op: "write", Path: f.fileData.name, Err: errors.New("file handle is read only")}
+	if f.append {
+		f.at = f.fileData.data.size
 	}
-	n = len(b)
-	cur := atomic.LoadInt64(&f.at)
+	n, err = f.write(b, f.at)
+	f.at += int64(n)
+	return n, err
+}
+
+// WriteAt writes at off without changing the offset of f.
+func (f *File) WriteAt(b []byte, off int64) (n int, err error) {
 	f.fileData.Lock()
 	defer f.fileData.Unlock()
-	diff := cur - int64(len(f.fileData.data))
-	var tail []byte
-	if n+int(cur) < len(f.fileData.data) {
-		tail = f.fileData.data[n+int(cur):]
-	}
-	if diff > 0 {
-		f.fileData.data = append(f.fileData.data, append(bytes.Repeat([]byte{0o0}, int(diff)), b...)...)
-		f.fileData.data = append(f.fileData.data, tail...)
-	} else {
-		f.fileData.data = append(f.fileData.data[:cur], b...)
-		f.fileData.data = append(f.fileData.data, tail...)
+	if f.append {
+		return 0, ErrWriteAtInAppendMode
+	}
+	if err := f.writable("write"); err != nil {
+		return 0, err
 	}
-	setModTime(f.fileData, time.Now())
+	if off < 0 {
+		return 0, &os.PathError{Op: "writeat", Path: f.fileData.name, Err: errors.New("negative offset")}
+	}
+	return f.write(b, off)
+}
 
-	atomic.AddInt64(&f.at, int64(n))
-	return
+// writable reports why f cannot be modified by op, if it cannot. The
+// caller must hold the lock of the FileData.
+func (f *File) writable(op string) error {
+	if f.closed {
+		return ErrFileClosed
+	}
+	if f.readOnly {
+		return &os.PathError{Op: op, Path: f.fileData.name, Err: errors.New("file handle is read only")}
+	}
+	return nil
 }
 
-func (f *File) WriteAt(b []byte, off int64) (n int, err error) {
-	atomic.StoreInt64(&f.at, off)
-	return f.Write(b)
+// write writes b at off. The caller must hold the lock of the FileData.
+func (f *File) write(b []byte, off int64) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	f.fileData.unshare()
+	if err := f.fileData.charge(f.fileData.data.growth(off, len(b))); err != nil {
+		return 0, &os.PathError{Op: "write", Path: f.fileData.name, Err: err}
+	}
+	f.fileData.data.writeAt(b, off)
+	setModTime(f.fileData, f.fileData.now())
+	return len(b), nil
 }
 
 func (f *File) WriteString(s string) (ret int, err error) {
@@ -334,6 +583,22 @@ func (s *FileInfo) ModTime() time.Time {
 	return s.modtime
 }
 
+// AccessTime returns the time the file was last read. It is only updated by
+// handles with access time tracking.
+func (s *FileInfo) AccessTime() time.Time {
+	s.Lock()
+	defer s.Unlock()
+	return s.atime
+}
+
+// ChangeTime returns the time the content, mode, owner or times of the file
+// last changed.
+func (s *FileInfo) ChangeTime() time.Time {
+	s.Lock()
+	defer s.Unlock()
+	return s.ctime
+}
+
 func (s *FileInfo) IsDir() bool {
 	s.Lock()
 	defer s.Unlock()
@@ -346,7 +611,16 @@ func (s *FileInfo) Size() int64 {
 	}
 	s.Lock()
 	defer s.Unlock()
-	return int64(len(s.data))
+	return s.data.size
+}
+
+// Allocated returns the number of bytes of memory holding the content of
+// the file. It is less than Size for sparse files, whose holes are not
+// stored.
+func (s *FileInfo) Allocated() int64 {
+	s.Lock()
+	defer s.Unlock()
+	return s.data.allocated
 }
 
 var (
@@ -356,4 +630,8 @@ var (
 	ErrFileNotFound      = os.ErrNotExist
 	ErrFileExists        = os.ErrExist
 	ErrDestinationExists = os.ErrExist
+
+	// ErrWriteAtInAppendMode is returned by WriteAt on handles opened with
+	// O_APPEND, like in os.
+	ErrWriteAtInAppendMode = errors.New("invalid use of WriteAt on file opened with O_APPEND")
 )
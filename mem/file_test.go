@@ -12,7 +12,8 @@ func TestFileDataNameRace(t *testing.T) {
 	const someName = "someName"
 	const someOtherName = "someOtherName"
 	d := FileData{
-		name: someName,
+		inode: &inode{},
+		name:  someName,
 	}
 
 	if d.Name() != someName {
@@ -39,7 +40,9 @@ func TestFileDataModTimeRace(t *testing.T) {
 	someOtherTime := someTime.Add(1 * time.Minute)
 
 	d := FileData{
-		modtime: someTime,
+		inode: &inode{
+			modtime: someTime,
+		},
 	}
 
 	s := FileInfo{
@@ -70,7 +73,9 @@ func TestFileDataModeRace(t *testing.T) {
 	const someOtherMode = 0o660
 
 	d := FileData{
-		mode: someMode,
+		inode: &inode{
+			mode: someMode,
+		},
 	}
 
 	s := FileInfo{
@@ -141,8 +146,8 @@ func TestFileWriteAt(t *testing.T) {
 	}
 
 	expected := bytes.Repeat(testData, 5)
-	if !bytes.Equal(expected, data.data) {
-		t.Fatalf("expected: %v, got: %v", expected, data.data)
+	if !bytes.Equal(expected, data.data.bytes()) {
+		t.Fatalf("expected: %v, got: %v", expected, data.data.bytes())
 	}
 }
 
@@ -150,7 +155,9 @@ func TestFileDataIsDirRace(t *testing.T) {
 	t.Parallel()
 
 	d := FileData{
-		dir: true,
+		inode: &inode{
+			dir: true,
+		},
 	}
 
 	s := FileInfo{
@@ -178,8 +185,10 @@ func TestFileDataSizeRace(t *testing.T) {
 	const someOtherDataSize = "Hello World"
 
 	d := FileData{
-		data: []byte(someData),
-		dir:  false,
+		inode: &inode{
+			data: newContent([]byte(someData)),
+			dir:  false,
+		},
 	}
 
 	s := FileInfo{
@@ -192,7 +201,7 @@ func TestFileDataSizeRace(t *testing.T) {
 
 	go func() {
 		s.Lock()
-		d.data = []byte(someOtherDataSize)
+		d.data = newContent([]byte(someOtherDataSize))
 		s.Unlock()
 	}()
 
@@ -296,3 +305,131 @@ func TestFileWriteAndSeek(t *testing.T) {
 		assert(cur == off, cur, off)
 	}
 }
+
+func TestSparseFile(t *testing.T) {
+	fd := CreateFile("sparse")
+	f := NewFileHandle(fd)
+	info := f.Info()
+
+	const far = 1 << 40
+	if _, err := f.WriteAt([]byte("end"), far); err != nil {
+		t.Fatal(err)
+	}
+	if size := info.Size(); size != far+3 {
+		t.Errorf("Size = %d, want %d", size, far+3)
+	}
+	if a := info.Allocated(); a > chunkSize {
+		t.Errorf("Allocated = %d for a single write", a)
+	}
+
+	// a read spanning the hole and the data
+	buf := bytes.Repeat([]byte{'x'}, chunkSize+10)
+	n, err := f.ReadAt(buf, far+3-int64(len(buf)))
+	if err != nil || n != len(buf) {
+		t.Fatalf("ReadAt = %d, %v", n, err)
+	}
+	if want := append(make([]byte, len(buf)-3), "end"...); !bytes.Equal(buf, want) {
+		t.Errorf("ReadAt returned %q... %q", buf[:4], buf[len(buf)-4:])
+	}
+
+	if err := f.Truncate(2 * far); err != nil {
+		t.Fatal(err)
+	}
+	if size, a := info.Size(), info.Allocated(); size != 2*far || a > chunkSize {
+		t.Errorf("after Truncate: Size = %d, Allocated = %d", size, a)
+	}
+
+	// bytes cut by Truncate read as zeros when the file grows again
+	f.Truncate(far + 1)
+	f.Truncate(far + 3)
+	buf = make([]byte, 3)
+	if _, err := f.ReadAt(buf, far); err != nil || string(buf) != "e\x00\x00" {
+		t.Errorf("ReadAt = %q, %v", buf, err)
+	}
+	if a := info.Allocated(); a != far%chunkSize+1 {
+		t.Errorf("Allocated = %d, want %d", a, far%chunkSize+1)
+	}
+}
+
+func TestFileBytes(t *testing.T) {
+	fd := CreateFile("flat")
+	f := NewFileHandle(fd)
+	big := bytes.Repeat([]byte("0123456789"), chunkSize/5)
+	if err := SetBytes(fd, big); err != nil {
+		t.Fatal(err)
+	}
+	if b := Bytes(fd); &b[0] != &big[0] {
+		t.Error("Bytes copied the content set with SetBytes")
+	}
+
+	// a write splits the content, without losing the rest of it
+	if _, err := f.WriteAt([]byte("ab"), chunkSize-1); err != nil {
+		t.Fatal(err)
+	}
+	f.Seek(chunkSize+1, io.SeekStart)
+	if _, err := f.Write(bytes.Repeat([]byte("x"), chunkSize)); err != nil {
+		t.Fatal(err)
+	}
+	want := append(append([]byte{}, big[:chunkSize-1]...), "ab"...)
+	want = append(want, bytes.Repeat([]byte("x"), chunkSize)...)
+	b := Bytes(fd)
+	if !bytes.Equal(b, want) {
+		t.Fatalf("content after writes has %d bytes, want %d", len(b), len(want))
+	}
+	if again := Bytes(fd); &again[0] != &b[0] {
+		t.Error("Bytes copied the content a second time")
+	}
+	if a := f.Info().Allocated(); a != int64(len(want)) {
+		t.Errorf("Allocated = %d, want %d", a, len(want))
+	}
+}
+
+func TestFileHandles(t *testing.T) {
+	fd := CreateFile("handles")
+	w := NewFileHandle(fd)
+	r := NewReadOnlyFileHandle(fd)
+	if _, err := w.Write([]byte("hello world")); err != nil {
+		t.Fatal(err)
+	}
+
+	// each handle has its own offset, which ReadAt and WriteAt keep
+	buf := make([]byte, 5)
+	if n, err := r.Read(buf); n != 5 || err != nil || string(buf) != "hello" {
+		t.Errorf("Read = %d, %v, %q", n, err, buf)
+	}
+	if _, err := w.WriteAt([]byte("W"), 6); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := r.ReadAt(buf, 8); n != 3 || err != io.EOF || string(buf[:n]) != "rld" {
+		t.Errorf("ReadAt at the end = %d, %v, %q", n, err, buf[:n])
+	}
+	for name, f := range map[string]*File{"writer": w, "reader": r} {
+		want := map[string]int64{"writer": 11, "reader": 5}[name]
+		if at, err := f.Seek(0, io.SeekCurrent); at != want || err != nil {
+			t.Errorf("offset of the %s = %d, %v, want %d", name, at, err, want)
+		}
+	}
+	if n, err := r.Read(buf); n != 5 || err != nil || string(buf) != " Worl" {
+		t.Errorf("Read = %d, %v, %q", n, err, buf)
+	}
+	if _, err := r.Seek(-20, io.SeekCurrent); err == nil {
+		t.Error("seeking before the start succeeded")
+	}
+
+	// closing one handle leaves the others open
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != ErrFileClosed {
+		t.Errorf("second Close = %v, want ErrFileClosed", err)
+	}
+	if _, err := w.WriteAt([]byte("x"), 0); err != ErrFileClosed {
+		t.Errorf("WriteAt after Close = %v", err)
+	}
+	if _, err := w.Stat(); err != ErrFileClosed {
+		t.Errorf("Stat after Close = %v", err)
+	}
+	if n, err := r.ReadAt(buf, 0); n != 5 || err != nil {
+		t.Errorf("ReadAt through the other handle = %d, %v", n, err)
+	}
+}
@@ -0,0 +1,99 @@
+package mem
+
+import "sort"
+
+// ReaddirOrder is the order in which Readdir lists the entries of a
+// directory.
+type ReaddirOrder int
+
+const (
+	// SortedByName lists the entries sorted by name. It is the default.
+	SortedByName ReaddirOrder = iota
+	// InsertionOrder lists the entries in the order they were added to the
+	// directory. A renamed entry counts as added when it was renamed.
+	InsertionOrder
+	// Unordered lists the entries in an unspecified order, which may change
+	// whenever the directory does, like os.File.Readdir.
+	Unordered
+
+	numOrders
+)
+
+// entries is the Dir of directories created by this package. The listing
+// for each order is built when it is first asked for and kept until the
+// directory changes, so reading a directory repeatedly, as Walk does, does
+// not sort it every time. Callers hold the lock of the directory.
+type entries struct {
+	files map[string]*FileData
+	// added is the insertion sequence number of each entry.
+	added map[string]uint64
+	seq   uint64
+	lists [numOrders][]*FileData
+}
+
+func newEntries() *entries {
+	return &entries{files: map[string]*FileData{}, added: map[string]uint64{}}
+}
+
+func (e *entries) Len() int { return len(e.files) }
+
+func (e *entries) Add(f *FileData) {
+	if _, ok := e.files[f.name]; !ok {
+		e.seq++
+		e.added[f.name] = e.seq
+	}
+	e.files[f.name] = f
+	e.lists = [numOrders][]*FileData{}
+}
+
+func (e *entries) Remove(f *FileData) {
+	if _, ok := e.files[f.name]; !ok {
+		return
+	}
+	delete(e.files, f.name)
+	delete(e.added, f.name)
+	e.lists = [numOrders][]*FileData{}
+}
+
+func (e *entries) Names() (names []string) {
+	for x := range e.files {
+		names = append(names, x)
+	}
+	return names
+}
+
+func (e *entries) Files() []*FileData {
+	return e.list(SortedByName)
+}
+
+// list returns the entries in the given order. The slice is shared and must
+// not be modified.
+func (e *entries) list(order ReaddirOrder) []*FileData {
+	if order < 0 || order >= numOrders {
+		order = SortedByName
+	}
+	if files := e.lists[order]; files != nil || len(e.files) == 0 {
+		return files
+	}
+	files := make([]*FileData, 0, len(e.files))
+	for _, f := range e.files {
+		files = append(files, f)
+	}
+	switch order {
+	case SortedByName:
+		sort.Sort(filesSorter(files))
+	case InsertionOrder:
+		sort.Slice(files, func(i, j int) bool { return e.added[files[i].name] < e.added[files[j].name] })
+	}
+	e.lists[order] = files
+	return files
+}
+
+// listDir returns the entries of d in the given order, falling back to
+// Files for Dir implementations from outside this package.
+func listDir(d Dir, order ReaddirOrder) []*FileData {
+	if e, ok := d.(*entries); ok {
+		return e.list(order)
+	}
+	return d.Files()
+}
@@ -0,0 +1,89 @@
+package mem
+
+import (
+	"sync"
+)
+
+// Quota limits the total size and the number of the files attached to it.
+// Attaching a file or growing an attached one beyond the limits fails with
+// ENOSPC, or the equivalent error on Plan 9. A limit of zero means no limit.
+// Only the content actually stored counts, the holes of sparse files are
+// free.
+type Quota struct {
+	maxBytes int64
+	maxFiles int
+
+	mu    sync.Mutex
+	bytes int64
+	files int
+}
+
+// NewQuota returns a Quota of at most maxBytes of content and maxFiles
+// files.
+func NewQuota(maxBytes int64, maxFiles int) *Quota {
+	return &Quota{maxBytes: maxBytes, maxFiles: maxFiles}
+}
+
+// Usage returns the number of bytes and files currently charged to q.
+func (q *Quota) Usage() (bytes int64, files int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.bytes, q.files
+}
+
+// Attach charges f to q. Every hard link counts as a file, but the content
+// they share is only charged once.
+func (q *Quota) Attach(f *FileData) error {
+	f.Lock()
+	defer f.Unlock()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.maxFiles > 0 && q.files >= q.maxFiles {
+		return errNoSpace
+	}
+	if f.quota == nil {
+		size := f.data.allocated
+		if q.maxBytes > 0 && q.bytes+size > q.maxBytes {
+			return errNoSpace
+		}
+		q.bytes += size
+		f.quota = q
+	}
+	q.files++
+	f.nlink++
+	return nil
+}
+
+// Detach releases f from q; the size of its content is released with the
+// last link.
+func (q *Quota) Detach(f *FileData) {
+	f.Lock()
+	defer f.Unlock()
+	if f.quota != q {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.files--
+	f.nlink--
+	if f.nlink == 0 {
+		q.bytes -= f.data.allocated
+		f.quota = nil
+	}
+}
+
+// charge charges the quota of d, if any, for diff more bytes of allocated
+// content. The caller must hold the lock of d.
+func (d *FileData) charge(diff int64) error {
+	q := d.quota
+	if q == nil {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if diff > 0 && q.maxBytes > 0 && q.bytes+diff > q.maxBytes {
+		return errNoSpace
+	}
+	q.bytes += diff
+	return nil
+}
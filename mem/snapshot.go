@@ -0,0 +1,92 @@
+package mem
+
+// unshare gives d its own copy of a content shared with a snapshot. The
+// caller must hold the lock of d.
+func (d *FileData) unshare() {
+	if d.shared {
+		d.data = d.data.clone()
+		d.shared = false
+	}
+}
+
+// Snapshot returns a copy of the files in files, keyed the same way, whose
+// directories list the copies. Hard links remain hard links among the
+// copies. The content of the files is shared with the originals until
+// either is written to, so taking a snapshot only costs the metadata.
+//
+// If quota is not nil, the copies are charged to a new Quota with the same
+// limits and usage, which is returned as well.
+func Snapshot(files map[string]*FileData, quota *Quota) (map[string]*FileData, *Quota) {
+	s := snapshot{
+		inodes: make(map[*inode]*inode),
+		files:  make(map[*FileData]*FileData),
+	}
+	if quota != nil {
+		quota.mu.Lock()
+		s.quota = &Quota{maxBytes: quota.maxBytes, maxFiles: quota.maxFiles, bytes: quota.bytes, files: quota.files}
+		quota.mu.Unlock()
+	}
+	res := make(map[string]*FileData, len(files))
+	for name, f := range files {
+		res[name] = s.file(f)
+	}
+	return res, s.quota
+}
+
+type snapshot struct {
+	inodes map[*inode]*inode
+	files  map[*FileData]*FileData
+	quota  *Quota
+}
+
+func (s *snapshot) file(f *FileData) *FileData {
+	if c, ok := s.files[f]; ok {
+		return c
+	}
+	f.Lock()
+	name := f.name
+	i, ok := s.inodes[f.inode]
+	if !ok {
+		i = &inode{
+			data:    f.data,
+			dir:     f.dir,
+			mode:    f.mode,
+			modtime: f.modtime,
+			atime:   f.atime,
+			ctime:   f.ctime,
+			uid:     f.uid,
+			gid:     f.gid,
+			nlink:   f.nlink,
+			clock:   f.clock,
+		}
+		if f.data.allocated > 0 {
+			f.shared, i.shared = true, true
+		}
+		if f.xattrs != nil {
+			i.xattrs = make(map[string][]byte, len(f.xattrs))
+			for k, v := range f.xattrs {
+				i.xattrs[k] = v
+			}
+		}
+		if f.quota != nil {
+			i.quota = s.quota
+		}
+		s.inodes[f.inode] = i
+	}
+	var children []*FileData
+	if !ok && f.dir {
+		children = listDir(f.memDir, InsertionOrder)
+	}
+	f.Unlock()
+
+	c := &FileData{name: name, inode: i}
+	s.files[f] = c
+	if f.dir && !ok {
+		dir := newEntries()
+		for _, child := range children {
+			dir.Add(s.file(child))
+		}
+		i.memDir = dir
+	}
+	return c
+}
@@ -0,0 +1,166 @@
+package afero
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/afero/mem"
+)
+
+// xattrRecord prefixes the PAX records holding extended attributes, as
+// written by GNU tar.
+const xattrRecord = "SCHILY.xattr."
+
+// DumpTo writes all files of m to w as a tar stream in PAX format, with
+// their content, modes, owners, modification and access times, extended
+// attributes, symlinks and hard links. The root is written as "./" and the
+// other entries are named relative to it, so the stream can be extracted
+// with tar as well. LoadMemMapFs reads it back.
+//
+// The files are those of a Snapshot taken when DumpTo is called, so m can
+// be used meanwhile.
+func (m *MemMapFs) DumpTo(w io.Writer) error {
+	data := m.Snapshot().getData()
+	names := make([]string, 0, len(data))
+	for name := range data {
+		names = append(names, name)
+	}
+	// parents sort before their children
+	sort.Strings(names)
+
+	tw := tar.NewWriter(w)
+	linked := make(map[interface{}]string)
+	for _, name := range names {
+		f := data[name]
+		info := mem.GetFileInfo(f)
+		var target string
+		if info.Mode()&os.ModeSymlink != 0 {
+			target = mem.LinkTarget(f)
+		}
+		hdr, err := tar.FileInfoHeader(info, target)
+		if err != nil {
+			return err
+		}
+		hdr.Format = tar.FormatPAX
+		hdr.Name = filepath.ToSlash(strings.TrimPrefix(name, FilePathSeparator))
+		if info.IsDir() {
+			hdr.Name += "/"
+			if hdr.Name == "/" {
+				hdr.Name = "./"
+			}
+		}
+		hdr.AccessTime = info.AccessTime()
+		hdr.Uid, hdr.Gid = mem.Owner(f)
+
+		regular := info.Mode().IsRegular()
+		if regular {
+			if first, ok := linked[mem.Inode(f)]; ok {
+				hdr.Typeflag, hdr.Linkname, hdr.Size = tar.TypeLink, first, 0
+				if err := tw.WriteHeader(hdr); err != nil {
+					return err
+				}
+				continue
+			}
+			linked[mem.Inode(f)] = hdr.Name
+		}
+		for _, attr := range mem.XattrNames(f) {
+			if hdr.PAXRecords == nil {
+				hdr.PAXRecords = make(map[string]string)
+			}
+			value, _ := mem.Xattr(f, attr)
+			hdr.PAXRecords[xattrRecord+attr] = string(value)
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if regular {
+			if _, err := io.Copy(tw, mem.NewReadOnlyFileHandle(f)); err != nil {
+				return err
+			}
+		}
+	}
+	return tw.Close()
+}
+
+// LoadMemMapFs returns a MemMapFs holding the files of a tar stream written
+// by DumpTo. Other tar streams can be loaded as well, as long as they only
+// hold directories, regular files, symlinks and hard links.
+func LoadMemMapFs(r io.Reader) (*MemMapFs, error) {
+	type entry struct {
+		name string
+		hdr  *tar.Header
+	}
+	m := &MemMapFs{}
+	var entries []entry
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		name := normalizePath(FilePathSeparator + filepath.FromSlash(hdr.Name))
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = m.MkdirAll(name, 0o700)
+		case tar.TypeReg:
+			if err = m.MkdirAll(filepath.Dir(name), 0o700); err == nil {
+				err = m.load(name, tr)
+			}
+		case tar.TypeSymlink:
+			err = m.SymlinkIfPossible(hdr.Linkname, name)
+		case tar.TypeLink:
+			err = m.LinkIfPossible(normalizePath(FilePathSeparator+filepath.FromSlash(hdr.Linkname)), name)
+		default:
+			err = fmt.Errorf("unsupported tar entry %q of type %q", hdr.Name, hdr.Typeflag)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeLink {
+			entries = append(entries, entry{name, hdr})
+		}
+	}
+
+	// Metadata is set last, as adding files changes the times of their
+	// directories and the modes may not allow it.
+	data := m.getData()
+	for _, e := range entries {
+		f := data[e.name]
+		mem.SetMode(f, e.hdr.FileInfo().Mode())
+		mem.SetUID(f, e.hdr.Uid)
+		mem.SetGID(f, e.hdr.Gid)
+		for k, v := range e.hdr.PAXRecords {
+			if attr, ok := strings.CutPrefix(k, xattrRecord); ok {
+				mem.SetXattr(f, attr, []byte(v))
+			}
+		}
+		mem.SetModTime(f, e.hdr.ModTime)
+		atime := e.hdr.AccessTime
+		if atime.IsZero() {
+			atime = e.hdr.ModTime
+		}
+		mem.SetAccessTime(f, atime)
+	}
+	return m, nil
+}
+
+// load writes the content read from r to the new file name.
+func (m *MemMapFs) load(name string, r io.Reader) error {
+	f, err := m.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	return err
+}
@@ -15,36 +15,205 @@ package afero
 
 import (
 	"fmt"
-	"io"
 	"log"
 	"os"
 	"path/filepath"
-	"sort"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
+	"github.com/spf13/afero/internal/common"
 	"github.com/spf13/afero/mem"
 )
 
 const chmodBits = os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky // Only a subset of bits are allowed to be changed. Documented under os.Chmod()
 
+var _ Symlinker = (*MemMapFs)(nil)
+
 type MemMapFs struct {
 	mu   sync.RWMutex
 	data map[string]*mem.FileData
 	init sync.Once
+
+	// hasSymlinks is set once the first symlink is created, paths only need
+	// to be resolved from then on.
+	hasSymlinks bool
+
+	quota *mem.Quota
+
+	// strict is set by SetStrictPermissions, the permissions are checked
+	// for uid and gid.
+	strict   bool
+	uid, gid int
+
+	// atime is set by SetAccessTimeTracking, reads update access times.
+	atime bool
+
+	// order is set by SetReaddirOrder.
+	order mem.ReaddirOrder
+
+	// clock is set by SetClock, nil means time.Now.
+	clock mem.Clock
+
+	watchMu  sync.Mutex
+	watchers []*memWatcher
+
+	// locks holds the advisory locks of LockIfPossible by path.
+	lockMu sync.Mutex
+	locks  map[string]*memLock
 }
 
 func NewMemMapFs() Fs {
 	return &MemMapFs{}
 }
 
+// NewMemMapFsWithLimits returns a MemMapFs holding at most maxBytes of file
+// content and maxFiles files, directories and links. Operations exceeding
+// the limits fail with ENOSPC. A limit of zero means no limit.
+func NewMemMapFsWithLimits(maxBytes int64, maxFiles int) Fs {
+	return &MemMapFs{quota: mem.NewQuota(maxBytes, maxFiles)}
+}
+
+// Usage returns the number of bytes and files counted against the limits of
+// a MemMapFs created with NewMemMapFsWithLimits, and zeros otherwise.
+func (m *MemMapFs) Usage() (bytes int64, files int) {
+	if m.quota == nil {
+		return 0, 0
+	}
+	return m.quota.Usage()
+}
+
+// SetAccessTimeTracking makes reads through files opened from then on update
+// their access times, as reported by mem.FileInfo.AccessTime. It is off by
+// default, like a file system mounted with noatime.
+func (m *MemMapFs) SetAccessTimeTracking(on bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.atime = on
+}
+
+// SetReaddirOrder sets the order in which Readdir and Readdirnames list
+// directories opened from then on. By default the entries are sorted by
+// name; mem.InsertionOrder lists them in the order they were created and
+// mem.Unordered leaves the order unspecified. Each directory keeps its
+// listings until it changes, so reading it again is cheap in any order.
+func (m *MemMapFs) SetReaddirOrder(order mem.ReaddirOrder) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.order = order
+}
+
+// SetClock makes m take the times of the files it creates and changes from
+// then on from c, e.g. a mem.FakeClock in tests. Set it before m is used
+// to have every time, including that of the root, come from c.
+func (m *MemMapFs) SetClock(c mem.Clock) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.clock = c
+}
+
+// now returns the time of the clock of m.
+func (m *MemMapFs) now() time.Time {
+	if m.clock == nil {
+		return time.Now()
+	}
+	return m.clock.Now()
+}
+
+// stamp gives f, just created, the clock of m.
+func (m *MemMapFs) stamp(f *mem.FileData) *mem.FileData {
+	if m.clock != nil {
+		mem.SetClock(f, m.clock)
+	}
+	return f
+}
+
+// FileBytes returns the content of the file name without copying it, and
+// false if there is no such file. The slice must not be modified; see
+// mem.Bytes. Files set with SetFileBytes are returned as they are, others
+// are put in one piece by the first call.
+func (m *MemMapFs) FileBytes(name string) ([]byte, bool) {
+	f, err := m.open(name)
+	if err != nil || mem.GetFileInfo(f).IsDir() {
+		return nil, false
+	}
+	return mem.Bytes(f), true
+}
+
+// SetFileBytes replaces the content of the file name with b without
+// copying it, creating the file with perm if needed like WriteFile. m owns
+// b from then on, the caller must not use it anymore.
+func (m *MemMapFs) SetFileBytes(name string, b []byte, perm os.FileMode) error {
+	f, err := m.OpenFile(name, os.O_WRONLY|os.O_CREATE, perm)
+	if err != nil {
+		return err
+	}
+	f.Close()
+	data, err := m.open(name)
+	if err != nil {
+		return err
+	}
+	if err := mem.SetBytes(data, b); err != nil {
+		return &os.PathError{Op: "write", Path: name, Err: err}
+	}
+	m.notify(data.Name(), WatchWrite)
+	return nil
+}
+
+// Snapshot returns a copy of m. Taking it only copies the metadata, the
+// content of the files is shared until it is written to, in m or in the
+// copy. The copy has the limits, usage and permission settings of m, but
+// neither its watchers nor its locks.
+func (m *MemMapFs) Snapshot() *MemMapFs {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	s := &MemMapFs{
+		hasSymlinks: m.hasSymlinks,
+		strict:      m.strict,
+		uid:         m.uid,
+		gid:         m.gid,
+		atime:       m.atime,
+		order:       m.order,
+		clock:       m.clock,
+	}
+	data, quota := mem.Snapshot(m.getData(), m.quota)
+	s.init.Do(func() {
+		s.data, s.quota = data, quota
+	})
+	return s
+}
+
+// Restore sets the files and limits of m back to those of snapshot, which
+// stays unchanged and can be restored again. Files of m that are still open
+// are detached from m. Watchers are not notified.
+func (m *MemMapFs) Restore(snapshot *MemMapFs) {
+	snapshot.mu.RLock()
+	data, quota := mem.Snapshot(snapshot.getData(), snapshot.quota)
+	hasSymlinks := snapshot.hasSymlinks
+	snapshot.mu.RUnlock()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.getData()
+	m.data, m.quota, m.hasSymlinks = data, quota, hasSymlinks
+}
+
+// handle prepares a new handle of m.
+func (m *MemMapFs) handle(f *mem.File) *mem.File {
+	m.mu.RLock()
+	f.SetAccessTimeTracking(m.atime)
+	f.SetReaddirOrder(m.order)
+	m.mu.RUnlock()
+	return f
+}
+
 func (m *MemMapFs) getData() map[string]*mem.FileData {
 	m.init.Do(func() {
 		m.data = make(map[string]*mem.FileData)
 		// Root should always exist, right?
 		// TODO: what about windows?
-		root := mem.CreateDir(FilePathSeparator)
+		root := m.stamp(mem.CreateDir(FilePathSeparator))
 		mem.SetMode(root, os.ModeDir|0o755)
 		m.data[FilePathSeparator] = root
 	})
@@ -53,12 +222,69 @@ func (m *MemMapFs) getData() map[string]*mem.FileData {
 
 func (*MemMapFs) Name() string { return "MemMapFS" }
 
+func (*MemMapFs) Capabilities() Capability {
+	return CapLstat | CapSymlink | CapReadlink | CapAtomicRename | CapHardLink | CapLock | CapXattr | CapReadAt
+}
+
+// setData stores f under name, replacing an existing entry. It fails with
+// ENOSPC if there is no room for f within the quota.
+func (m *MemMapFs) setData(name string, f *mem.FileData) error {
+	if m.quota != nil {
+		old, ok := m.getData()[name]
+		if ok {
+			m.quota.Detach(old)
+		}
+		if err := m.quota.Attach(f); err != nil {
+			if ok {
+				m.quota.Attach(old)
+			}
+			return err
+		}
+	}
+	m.getData()[name] = f
+	return nil
+}
+
+// deleteData removes the entry of name and releases it from the quota.
+func (m *MemMapFs) deleteData(name string) {
+	f, ok := m.getData()[name]
+	if !ok {
+		return
+	}
+	if m.quota != nil {
+		m.quota.Detach(f)
+	}
+	delete(m.getData(), name)
+	m.notify(name, WatchRemove)
+}
+
 func (m *MemMapFs) Create(name string) (File, error) {
-	name = normalizePath(name)
+	if err := m.checkAccess("open", name, permWrite, permWrite|permExec); err != nil {
+		return nil, err
+	}
+	file, err := m.create(name)
+	if err != nil {
+		return nil, err
+	}
+	return m.watchFile(m.handle(file)), nil
+}
+
+func (m *MemMapFs) create(name string) (*mem.File, error) {
 	m.mu.Lock()
-	file := mem.CreateFile(name)
-	m.getData()[name] = file
-	m.registerWithParent(file, 0)
+	name, err := m.lockfreeResolve(name, true)
+	if err != nil {
+		m.mu.Unlock()
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+	file := m.stamp(mem.CreateFile(name))
+	if m.strict {
+		mem.SetMode(file, 0o666)
+		m.own(file)
+	}
+	if err := m.addData(file, 0); err != nil {
+		m.mu.Unlock()
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
 	m.mu.Unlock()
 	return mem.NewFileHandle(file), nil
 }
@@ -79,6 +305,14 @@ func (m *MemMapFs) unRegisterWithParent(fileName string) error {
 	return nil
 }
 
+// touchParent updates the modification time of the directory containing
+// name, whose entries changed.
+func (m *MemMapFs) touchParent(name string) {
+	if parent, err := m.lockfreeOpen(filepath.Dir(name)); err == nil {
+		mem.SetModTime(parent, m.now())
+	}
+}
+
 func (m *MemMapFs) findParent(f *mem.FileData) *mem.FileData {
 	pdir, _ := filepath.Split(f.Name())
 	pdir = filepath.Clean(pdir)
@@ -89,27 +323,9 @@ func (m *MemMapFs) findParent(f *mem.FileData) *mem.FileData {
 	return pfile
 }
 
-func (m *MemMapFs) findDescendants(name string) []*mem.FileData {
-	fData := m.getData()
-	descendants := make([]*mem.FileData, 0, len(fData))
-	for p, dFile := range fData {
-		if strings.HasPrefix(p, name+FilePathSeparator) {
-			descendants = append(descendants, dFile)
-		}
-	}
-
-	sort.Slice(descendants, func(i, j int) bool {
-		cur := len(strings.Split(descendants[i].Name(), FilePathSeparator))
-		next := len(strings.Split(descendants[j].Name(), FilePathSeparator))
-		return cur < next
-	})
-
-	return descendants
-}
-
-func (m *MemMapFs) registerWithParent(f *mem.FileData, perm os.FileMode) {
+func (m *MemMapFs) registerWithParent(f *mem.FileData, perm os.FileMode) error {
 	if f == nil {
-		return
+		return nil
 	}
 	parent := m.findParent(f)
 	if parent == nil {
@@ -117,12 +333,12 @@ func (m *MemMapFs) registerWithParent(f *mem.FileData, perm os.FileMode) {
 		err := m.lockfreeMkdir(pdir, perm)
 		if err != nil {
 			// log.Println("Mkdir error:", err)
-			return
+			return err
 		}
 		parent, err = m.lockfreeOpen(pdir)
 		if err != nil {
 			// log.Println("Open after Mkdir error:", err)
-			return
+			return err
 		}
 	}
 
@@ -130,6 +346,23 @@ func (m *MemMapFs) registerWithParent(f *mem.FileData, perm os.FileMode) {
 	mem.InitializeDir(parent)
 	mem.AddToMemDir(parent, f)
 	parent.Unlock()
+	return nil
+}
+
+// addData stores the new entry f and registers it with its parent. It fails
+// with ENOSPC if f or a missing parent exceeds the quota.
+func (m *MemMapFs) addData(f *mem.FileData, perm os.FileMode) error {
+	name := f.Name()
+	if err := m.setData(name, f); err != nil {
+		return err
+	}
+	if err := m.registerWithParent(f, perm); err == errNoSpace {
+		m.deleteData(name)
+		return err
+	}
+	m.touchParent(name)
+	m.notify(name, WatchCreate)
+	return nil
 }
 
 func (m *MemMapFs) lockfreeMkdir(name string, perm os.FileMode) error {
@@ -142,17 +375,25 @@ func (m *MemMapFs) lockfreeMkdir(name string, perm os.FileMode) error {
 			return ErrFileExists
 		}
 	} else {
-		item := mem.CreateDir(name)
+		item := m.stamp(mem.CreateDir(name))
 		mem.SetMode(item, os.ModeDir|perm)
-		m.getData()[name] = item
-		m.registerWithParent(item, perm)
+		m.own(item)
+		if err := m.addData(item, perm); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
 func (m *MemMapFs) Mkdir(name string, perm os.FileMode) error {
 	perm &= chmodBits
-	name = normalizePath(name)
+	if err := m.checkAccess("mkdir", name, 0, permWrite|permExec); err != nil {
+		return err
+	}
+	name, err := m.resolve(name, false)
+	if err != nil {
+		return &os.PathError{Op: "mkdir", Path: name, Err: err}
+	}
 
 	m.mu.RLock()
 	_, ok := m.getData()[name]
@@ -167,10 +408,13 @@ func (m *MemMapFs) Mkdir(name string, perm os.FileMode) error {
 		m.mu.Unlock()
 		return &os.PathError{Op: "mkdir", Path: name, Err: ErrFileExists}
 	}
-	item := mem.CreateDir(name)
+	item := m.stamp(mem.CreateDir(name))
 	mem.SetMode(item, os.ModeDir|perm)
-	m.getData()[name] = item
-	m.registerWithParent(item, perm)
+	m.own(item)
+	if err := m.addData(item, perm); err != nil {
+		m.mu.Unlock()
+		return &os.PathError{Op: "mkdir", Path: name, Err: err}
+	}
 	m.mu.Unlock()
 
 	return m.setFileMode(name, perm|os.ModeDir)
@@ -202,23 +446,21 @@ func normalizePath(path string) string {
 }
 
 func (m *MemMapFs) Open(name string) (File, error) {
-	f, err := m.open(name)
-	if f != nil {
-		return mem.NewReadOnlyFileHandle(f), err
+	if err := m.checkAccess("open", name, permRead, 0); err != nil {
+		return nil, err
 	}
-	return nil, err
-}
-
-func (m *MemMapFs) openWrite(name string) (File, error) {
 	f, err := m.open(name)
 	if f != nil {
-		return mem.NewFileHandle(f), err
+		return m.handle(mem.NewReadOnlyFileHandle(f)), err
 	}
 	return nil, err
 }
 
 func (m *MemMapFs) open(name string) (*mem.FileData, error) {
-	name = normalizePath(name)
+	name, err := m.resolve(name, true)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
 
 	m.mu.RLock()
 	f, ok := m.getData()[name]
@@ -239,37 +481,52 @@ func (m *MemMapFs) lockfreeOpen(name string) (*mem.FileData, error) {
 	}
 }
 
+// OpenFile opens name like os.OpenFile on Linux:
+//
+//   - The access mode (O_RDONLY, O_WRONLY or O_RDWR) decides whether the
+//     returned file can be read and written.
+//   - O_CREATE creates a missing file with perm; with O_EXCL, opening an
+//     existing file fails with ErrFileExists. O_EXCL without O_CREATE is
+//     ignored.
+//   - O_TRUNC truncates the file, even when opened read-only.
+//   - O_APPEND moves every write to the end of the file, and WriteAt fails
+//     with mem.ErrWriteAtInAppendMode.
+//   - Opening a directory for writing, or with O_CREATE or O_TRUNC, fails
+//     with EISDIR.
+//   - O_SYNC has no effect, since there is nothing to flush.
 func (m *MemMapFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
 	perm &= chmodBits
+	createWant := os.FileMode(0)
+	if flag&os.O_CREATE != 0 {
+		createWant = permWrite | permExec
+	}
+	if err := m.checkAccess("open", name, openPerm(flag), createWant); err != nil {
+		return nil, err
+	}
 	chmod := false
-	file, err := m.openWrite(name)
-	if err == nil && (flag&os.O_EXCL > 0) {
+	data, err := m.open(name)
+	if err == nil && flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL {
 		return nil, &os.PathError{Op: "open", Path: name, Err: ErrFileExists}
 	}
 	if os.IsNotExist(err) && (flag&os.O_CREATE > 0) {
-		file, err = m.Create(name)
-		chmod = true
+		var file *mem.File
+		file, err = m.create(name)
+		if err == nil {
+			data, chmod = file.Data(), true
+		}
 	}
 	if err != nil {
 		return nil, err
 	}
-	if flag == os.O_RDONLY {
-		file = mem.NewReadOnlyFileHandle(file.(*mem.File).Data())
-	}
-	if flag&os.O_APPEND > 0 {
-		_, err = file.Seek(0, io.SeekEnd)
-		if err != nil {
-			file.Close()
-			return nil, err
-		}
+	if mem.GetFileInfo(data).IsDir() && common.ModifiesFs(flag) {
+		return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
 	}
-	if flag&os.O_TRUNC > 0 && flag&(os.O_RDWR|os.O_WRONLY) > 0 {
-		err = file.Truncate(0)
-		if err != nil {
-			file.Close()
+	if flag&os.O_TRUNC != 0 && !chmod {
+		if err := m.watchFile(mem.NewFileHandle(data)).Truncate(0); err != nil {
 			return nil, err
 		}
 	}
+	file := m.watchFile(m.handle(mem.NewFileHandleFlag(data, flag)))
 	if chmod {
 		return file, m.setFileMode(name, perm)
 	}
@@ -277,121 +534,191 @@ func (m *MemMapFs) OpenFile(name string, flag int, perm os.FileMode) (File, erro
 }
 
 func (m *MemMapFs) Remove(name string) error {
-	name = normalizePath(name)
-
+	if err := m.checkParent("remove", name); err != nil {
+		return err
+	}
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if _, ok := m.getData()[name]; ok {
+	name, err := m.lockfreeResolve(name, false)
+	if err != nil {
+		return &os.PathError{Op: "remove", Path: name, Err: err}
+	}
+
+	if f, ok := m.getData()[name]; ok {
+		if len(mem.Children(f)) > 0 {
+			return &os.PathError{Op: "remove", Path: name, Err: errNotEmpty}
+		}
 		err := m.unRegisterWithParent(name)
 		if err != nil {
 			return &os.PathError{Op: "remove", Path: name, Err: err}
 		}
-		delete(m.getData(), name)
+		m.deleteData(name)
+		m.touchParent(name)
 	} else {
 		return &os.PathError{Op: "remove", Path: name, Err: os.ErrNotExist}
 	}
 	return nil
 }
 
+// RemoveAll removes path and the files below it, walking the directory tree
+// from path so that it only costs the size of the subtree. Removing the
+// root removes everything but the root itself.
 func (m *MemMapFs) RemoveAll(path string) error {
-	path = normalizePath(path)
+	if err := m.checkParent("RemoveAll", path); err != nil {
+		return err
+	}
+	path, err := m.resolve(path, false)
+	if err != nil {
+		return &os.PathError{Op: "RemoveAll", Path: path, Err: err}
+	}
 	m.mu.Lock()
-	m.unRegisterWithParent(path)
-	m.mu.Unlock()
-
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+	defer m.mu.Unlock()
 
-	for p := range m.getData() {
-		if p == path || strings.HasPrefix(p, path+FilePathSeparator) {
-			m.mu.RUnlock()
-			m.mu.Lock()
-			delete(m.getData(), p)
-			m.mu.Unlock()
-			m.mu.RLock()
-		}
+	f, ok := m.getData()[path]
+	if !ok {
+		return nil
 	}
+	m.removeTree(f)
+	if path == FilePathSeparator {
+		mem.SetModTime(f, m.now())
+		return nil
+	}
+	if m.unRegisterWithParent(path) == nil {
+		m.touchParent(path)
+	}
+	m.deleteData(path)
 	return nil
 }
 
+// removeTree removes the files below the directory dir, children before
+// their parents.
+func (m *MemMapFs) removeTree(dir *mem.FileData) {
+	for _, f := range mem.Children(dir) {
+		m.removeTree(f)
+		dir.Lock()
+		mem.RemoveFromMemDir(dir, f)
+		dir.Unlock()
+		m.deleteData(f.Name())
+	}
+}
+
+// Rename renames oldname to newname like os.Rename on Linux: an existing
+// newname is replaced, unless it is a directory which is not empty or
+// whose type differs from oldname, and a directory cannot be moved below
+// itself.
 func (m *MemMapFs) Rename(oldname, newname string) error {
-	oldname = normalizePath(oldname)
-	newname = normalizePath(newname)
+	if err := m.checkParent("rename", oldname); err != nil {
+		return err
+	}
+	if err := m.checkParent("rename", newname); err != nil {
+		return err
+	}
+	oldname, err := m.resolve(oldname, false)
+	if err != nil {
+		return &os.PathError{Op: "rename", Path: oldname, Err: err}
+	}
+	newname, err = m.resolve(newname, false)
+	if err != nil {
+		return &os.PathError{Op: "rename", Path: newname, Err: err}
+	}
 
 	if oldname == newname {
 		return nil
 	}
 
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-	if _, ok := m.getData()[oldname]; ok {
-		m.mu.RUnlock()
-		m.mu.Lock()
-		err := m.unRegisterWithParent(oldname)
-		if err != nil {
-			return err
-		}
-
-		fileData := m.getData()[oldname]
-		mem.ChangeFileName(fileData, newname)
-		m.getData()[newname] = fileData
-
-		err = m.renameDescendants(oldname, newname)
-		if err != nil {
-			return err
-		}
-
-		delete(m.getData(), oldname)
-
-		m.registerWithParent(fileData, 0)
-		m.mu.Unlock()
-		m.mu.RLock()
-	} else {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fileData, ok := m.getData()[oldname]
+	if !ok {
 		return &os.PathError{Op: "rename", Path: oldname, Err: ErrFileNotFound}
 	}
-	return nil
-}
-
-func (m *MemMapFs) renameDescendants(oldname, newname string) error {
-	descendants := m.findDescendants(oldname)
-	removes := make([]string, 0, len(descendants))
-	for _, desc := range descendants {
-		descNewName := strings.Replace(desc.Name(), oldname, newname, 1)
-		err := m.unRegisterWithParent(desc.Name())
-		if err != nil {
-			return err
+	isDir := mem.GetFileInfo(fileData).IsDir()
+	if isDir && (oldname == FilePathSeparator || strings.HasPrefix(newname, oldname+FilePathSeparator)) {
+		return &os.PathError{Op: "rename", Path: oldname, Err: syscall.EINVAL}
+	}
+	if target, ok := m.getData()[newname]; ok {
+		targetIsDir := mem.GetFileInfo(target).IsDir()
+		switch {
+		case isDir && !targetIsDir:
+			return &os.PathError{Op: "rename", Path: newname, Err: syscall.ENOTDIR}
+		case !isDir && targetIsDir:
+			return &os.PathError{Op: "rename", Path: newname, Err: syscall.EISDIR}
+		case targetIsDir && len(mem.Children(target)) > 0:
+			return &os.PathError{Op: "rename", Path: newname, Err: errNotEmpty}
 		}
-
-		removes = append(removes, desc.Name())
-		mem.ChangeFileName(desc, descNewName)
-		m.getData()[descNewName] = desc
-
-		m.registerWithParent(desc, 0)
 	}
-	for _, r := range removes {
-		delete(m.getData(), r)
+
+	if err := m.unRegisterWithParent(oldname); err != nil {
+		return &os.PathError{Op: "rename", Path: oldname, Err: err}
 	}
+	m.deleteData(newname)
+	delete(m.getData(), oldname)
+	mem.ChangeFileName(fileData, newname)
+	m.getData()[newname] = fileData
+	m.renameDescendants(fileData, oldname, newname)
 
+	m.registerWithParent(fileData, 0)
+	m.touchParent(oldname)
+	m.touchParent(newname)
+	m.notify(oldname, WatchRename)
+	m.notify(newname, WatchCreate)
 	return nil
 }
 
+// renameDescendants moves the files below dir, which was renamed from
+// oldname to newname, to their new paths.
+func (m *MemMapFs) renameDescendants(dir *mem.FileData, oldname, newname string) {
+	for _, f := range mem.Children(dir) {
+		name := f.Name()
+		descNewName := newname + name[len(oldname):]
+		dir.Lock()
+		mem.RemoveFromMemDir(dir, f)
+		mem.ChangeFileName(f, descNewName)
+		mem.AddToMemDir(dir, f)
+		dir.Unlock()
+		delete(m.getData(), name)
+		m.getData()[descNewName] = f
+		m.renameDescendants(f, oldname, newname)
+	}
+}
+
 func (m *MemMapFs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
-	fileInfo, err := m.Stat(name)
-	return fileInfo, false, err
+	fileInfo, err := m.stat("lstat", name, false)
+	return fileInfo, true, err
 }
 
 func (m *MemMapFs) Stat(name string) (os.FileInfo, error) {
-	f, err := m.Open(name)
-	if err != nil {
+	return m.stat("stat", name, true)
+}
+
+func (m *MemMapFs) stat(op, name string, follow bool) (os.FileInfo, error) {
+	if err := m.checkAccess(op, name, 0, 0); err != nil {
 		return nil, err
 	}
-	fi := mem.GetFileInfo(f.(*mem.File).Data())
-	return fi, nil
+	name, err := m.resolve(name, follow)
+	if err != nil {
+		return nil, &os.PathError{Op: op, Path: name, Err: err}
+	}
+
+	m.mu.RLock()
+	f, ok := m.getData()[name]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, &os.PathError{Op: op, Path: name, Err: ErrFileNotFound}
+	}
+	return mem.GetFileInfo(f), nil
 }
 
 func (m *MemMapFs) Chmod(name string, mode os.FileMode) error {
 	mode &= chmodBits
+	if err := m.checkOwner("chmod", name); err != nil {
+		return err
+	}
+	name, err := m.resolve(name, true)
+	if err != nil {
+		return &os.PathError{Op: "chmod", Path: name, Err: err}
+	}
 
 	m.mu.RLock()
 	f, ok := m.getData()[name]
@@ -402,11 +729,18 @@ func (m *MemMapFs) Chmod(name string, mode os.FileMode) error {
 	prevOtherBits := mem.GetFileInfo(f).Mode() & ^chmodBits
 
 	mode = prevOtherBits | mode
-	return m.setFileMode(name, mode)
+	if err := m.setFileMode(name, mode); err != nil {
+		return err
+	}
+	m.notify(name, WatchChmod)
+	return nil
 }
 
 func (m *MemMapFs) setFileMode(name string, mode os.FileMode) error {
-	name = normalizePath(name)
+	name, err := m.resolve(name, true)
+	if err != nil {
+		return &os.PathError{Op: "chmod", Path: name, Err: err}
+	}
 
 	m.mu.RLock()
 	f, ok := m.getData()[name]
@@ -423,7 +757,13 @@ func (m *MemMapFs) setFileMode(name string, mode os.FileMode) error {
 }
 
 func (m *MemMapFs) Chown(name string, uid, gid int) error {
-	name = normalizePath(name)
+	if err := m.checkRoot("chown", name); err != nil {
+		return err
+	}
+	name, err := m.resolve(name, true)
+	if err != nil {
+		return &os.PathError{Op: "chown", Path: name, Err: err}
+	}
 
 	m.mu.RLock()
 	f, ok := m.getData()[name]
@@ -434,12 +774,19 @@ func (m *MemMapFs) Chown(name string, uid, gid int) error {
 
 	mem.SetUID(f, uid)
 	mem.SetGID(f, gid)
+	m.notify(name, WatchChmod)
 
 	return nil
 }
 
 func (m *MemMapFs) Chtimes(name string, atime time.Time, mtime time.Time) error {
-	name = normalizePath(name)
+	if err := m.checkOwner("chtimes", name); err != nil {
+		return err
+	}
+	name, err := m.resolve(name, true)
+	if err != nil {
+		return &os.PathError{Op: "chtimes", Path: name, Err: err}
+	}
 
 	m.mu.RLock()
 	f, ok := m.getData()[name]
@@ -450,11 +797,140 @@ func (m *MemMapFs) Chtimes(name string, atime time.Time, mtime time.Time) error
 
 	m.mu.Lock()
 	mem.SetModTime(f, mtime)
+	mem.SetAccessTime(f, atime)
 	m.mu.Unlock()
+	m.notify(name, WatchChmod)
 
 	return nil
 }
 
+// maxSymlinks is the number of symlinks followed when resolving a path before
+// giving up with ELOOP, the same limit Linux uses.
+const maxSymlinks = 40
+
+// resolve normalizes name and follows the symlinks in it. A symlink in the
+// last element is only followed if followLast is set.
+func (m *MemMapFs) resolve(name string, followLast bool) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.lockfreeResolve(name, followLast)
+}
+
+func (m *MemMapFs) lockfreeResolve(name string, followLast bool) (string, error) {
+	name = normalizePath(name)
+	if !m.hasSymlinks {
+		return name, nil
+	}
+	for i := 0; i < maxSymlinks; i++ {
+		link, rest := m.findSymlink(name, followLast)
+		if link == nil {
+			return name, nil
+		}
+		target := mem.LinkTarget(link)
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(link.Name()), target)
+		}
+		name = normalizePath(target + rest)
+	}
+	return name, errLoop
+}
+
+// findSymlink returns the first symlink among the parent directories of name
+// and, if followLast is set, name itself, together with the rest of name
+// after it.
+func (m *MemMapFs) findSymlink(name string, followLast bool) (*mem.FileData, string) {
+	data := m.getData()
+	for i := 1; i <= len(name); i++ {
+		if i < len(name) && !os.IsPathSeparator(name[i]) {
+			continue
+		}
+		if i == len(name) && !followLast {
+			break
+		}
+		f, ok := data[name[:i]]
+		if !ok {
+			break
+		}
+		if mem.GetFileInfo(f).Mode()&os.ModeSymlink != 0 {
+			return f, name[i:]
+		}
+	}
+	return nil, ""
+}
+
+func (m *MemMapFs) SymlinkIfPossible(oldname, newname string) error {
+	if err := m.checkParent("symlink", newname); err != nil {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: syscall.EACCES}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name, err := m.lockfreeResolve(newname, false)
+	if err != nil {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: err}
+	}
+	if _, ok := m.getData()[name]; ok {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: ErrFileExists}
+	}
+	link := m.stamp(mem.CreateSymlink(name, oldname))
+	m.own(link)
+	if err := m.addData(link, 0); err != nil {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: err}
+	}
+	m.hasSymlinks = true
+	return nil
+}
+
+func (m *MemMapFs) LinkIfPossible(oldname, newname string) error {
+	if err := m.checkParent("link", newname); err != nil {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: syscall.EACCES}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	oldpath, err := m.lockfreeResolve(oldname, false)
+	if err != nil {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: err}
+	}
+	newpath, err := m.lockfreeResolve(newname, false)
+	if err != nil {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: err}
+	}
+	f, ok := m.getData()[oldpath]
+	if !ok {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: ErrFileNotFound}
+	}
+	if mem.GetFileInfo(f).IsDir() {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: syscall.EPERM}
+	}
+	if _, ok := m.getData()[newpath]; ok {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: ErrFileExists}
+	}
+	link := mem.CreateLink(newpath, f)
+	if err := m.addData(link, 0); err != nil {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: err}
+	}
+	return nil
+}
+
+func (m *MemMapFs) ReadlinkIfPossible(name string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	name, err := m.lockfreeResolve(name, false)
+	if err != nil {
+		return "", &os.PathError{Op: "readlink", Path: name, Err: err}
+	}
+	f, ok := m.getData()[name]
+	if !ok {
+		return "", &os.PathError{Op: "readlink", Path: name, Err: ErrFileNotFound}
+	}
+	if mem.GetFileInfo(f).Mode()&os.ModeSymlink == 0 {
+		return "", &os.PathError{Op: "readlink", Path: name, Err: syscall.EINVAL}
+	}
+	return mem.LinkTarget(f), nil
+}
+
 func (m *MemMapFs) List() {
 	for _, x := range m.data {
 		y := mem.FileInfo{FileData: x}
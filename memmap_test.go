@@ -1,16 +1,22 @@
 package afero
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
+	"syscall"
 	"testing"
 	"time"
+
+	"github.com/spf13/afero/mem"
 )
 
 func TestNormalizePath(t *testing.T) {
@@ -133,6 +139,99 @@ func TestOpenFileExcl(t *testing.T) {
 		t.Errorf("OpenFile Create Excl should have failed, but it didn't")
 	}
 	checkPathError(t, err, "Open")
+
+	// O_EXCL without O_CREATE is ignored, like in os.
+	f, err = fs.OpenFile(fileName, os.O_RDWR|os.O_EXCL, fileMode)
+	if err != nil {
+		t.Errorf("OpenFile Excl without Create failed: %s", err)
+		return
+	}
+	f.Close()
+}
+
+// TestOpenFileFlags checks the flag matrix of MemMapFs.OpenFile against
+// the os package.
+func TestOpenFileFlags(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("MemMapFs follows the flag semantics of Linux")
+	}
+	defer removeAllTestFiles(t)
+
+	tests := []struct {
+		name string
+		flag int
+		// do uses the opened file and returns the resulting content or
+		// the first error.
+		do      func(f File) error
+		wantErr bool
+		want    string
+	}{
+		{"read write-only", os.O_WRONLY, func(f File) error {
+			_, err := f.Read(make([]byte, 1))
+			return err
+		}, true, "hello"},
+		{"write read-only append", os.O_RDONLY | os.O_APPEND, func(f File) error {
+			_, err := f.Write([]byte("!"))
+			return err
+		}, true, "hello"},
+		{"append after seek", os.O_RDWR | os.O_APPEND, func(f File) error {
+			if _, err := f.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+			_, err := f.Write([]byte("!"))
+			return err
+		}, false, "hello!"},
+		{"read appending file from start", os.O_RDWR | os.O_APPEND, func(f File) error {
+			b := make([]byte, 1)
+			if _, err := f.Read(b); err != nil || b[0] != 'h' {
+				return fmt.Errorf("read %q, %v", b, err)
+			}
+			return nil
+		}, false, "hello"},
+		{"write at appending file", os.O_WRONLY | os.O_APPEND, func(f File) error {
+			_, err := f.WriteAt([]byte("!"), 0)
+			return err
+		}, true, "hello"},
+		{"truncate read-only", os.O_RDONLY | os.O_TRUNC, func(f File) error {
+			return nil
+		}, false, ""},
+		{"sync write", os.O_WRONLY | os.O_SYNC, func(f File) error {
+			_, err := f.Write([]byte("j"))
+			return err
+		}, false, "jello"},
+		{"excl without create", os.O_RDONLY | os.O_EXCL, func(f File) error {
+			return nil
+		}, false, "hello"},
+	}
+
+	for _, fs := range Fss {
+		dir := testDir(fs)
+		for _, tt := range tests {
+			path := filepath.Join(dir, "flags.txt")
+			if err := WriteFile(fs, path, []byte("hello"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			f, err := fs.OpenFile(path, tt.flag, 0)
+			if err != nil {
+				t.Errorf("%s: %s: OpenFile: %v", fs.Name(), tt.name, err)
+				continue
+			}
+			err = tt.do(f)
+			f.Close()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("%s: %s: err = %v, want error %v", fs.Name(), tt.name, err, tt.wantErr)
+			}
+			if got, _ := ReadFile(fs, path); string(got) != tt.want {
+				t.Errorf("%s: %s: content = %q, want %q", fs.Name(), tt.name, got, tt.want)
+			}
+		}
+
+		for _, flag := range []int{os.O_WRONLY, os.O_RDWR, os.O_RDONLY | os.O_CREATE, os.O_RDONLY | os.O_TRUNC} {
+			if _, err := fs.OpenFile(dir, flag, 0); !errors.Is(err, syscall.EISDIR) {
+				t.Errorf("%s: OpenFile(dir, %#x) = %v, want EISDIR", fs.Name(), flag, err)
+			}
+		}
+	}
 }
 
 // Ensure Permissions are set on OpenFile/Mkdir/MkdirAll
@@ -668,8 +767,8 @@ func TestMemFsOpenFileModeIllegal(t *testing.T) {
 	}
 }
 
-// LstatIfPossible should always return false, since MemMapFs does not
-// support symlinks.
+// LstatIfPossible should always return true, since MemMapFs supports
+// symlinks.
 func TestMemFsLstatIfPossible(t *testing.T) {
 	t.Parallel()
 
@@ -691,8 +790,8 @@ func TestMemFsLstatIfPossible(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Function returned err: %v", err)
 	}
-	if lstatCalled {
-		t.Fatalf("Function indicated lstat was called. This should never be true.")
+	if !lstatCalled {
+		t.Fatalf("Function indicated lstat was not called. This should never be false.")
 	}
 }
 
@@ -897,8 +996,15 @@ func TestMemMapFsRename(t *testing.T) {
 			t.Fatalf("%s: Mkdir %q failed: %v", fs.Name(), data.from, err)
 		}
 
+		// a directory only replaces an empty one
+		entries, _ := ReadDir(fs, data.exists)
 		err = fs.Rename(data.from, data.exists)
-		if err != nil {
+		if len(entries) > 0 {
+			if !errors.Is(err, errNotEmpty) {
+				t.Errorf("%s: rename %q, %q onto a non-empty directory: %v, want ENOTEMPTY", fs.Name(), data.from, data.exists, err)
+			}
+			fs.Remove(data.from)
+		} else if err != nil {
 			t.Errorf("%s: rename %q, %q failed: %v", fs.Name(), data.from, data.exists, err)
 		}
 
@@ -918,3 +1024,551 @@ func TestMemMapFsRename(t *testing.T) {
 		}
 	}
 }
+
+func TestMemMapFsSymlinks(t *testing.T) {
+	fs := NewMemMapFs()
+	linker := fs.(Symlinker)
+
+	WriteFile(fs, "/dir/file.txt", []byte("content"), 0o644)
+	if err := linker.SymlinkIfPossible("/dir/file.txt", "/abs"); err != nil {
+		t.Fatal(err)
+	}
+	if err := linker.SymlinkIfPossible("file.txt", "/dir/rel"); err != nil {
+		t.Fatal(err)
+	}
+	if err := linker.SymlinkIfPossible("dir", "/dirlink"); err != nil {
+		t.Fatal(err)
+	}
+	if err := linker.SymlinkIfPossible("/nowhere", "/dangling"); err != nil {
+		t.Fatal(err)
+	}
+	if err := linker.SymlinkIfPossible("/loop2", "/loop1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := linker.SymlinkIfPossible("/loop1", "/loop2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := linker.SymlinkIfPossible("/dir/file.txt", "/abs"); !os.IsExist(err) {
+		t.Errorf("symlink over existing file: got %v, want exist error", err)
+	}
+
+	for _, name := range []string{"/abs", "/dir/rel", "/dirlink/file.txt", "/dirlink/rel"} {
+		got, err := ReadFile(fs, name)
+		if err != nil || string(got) != "content" {
+			t.Errorf("ReadFile(%s) = %q, %v", name, got, err)
+		}
+	}
+
+	fi, lstatCalled, err := linker.LstatIfPossible("/abs")
+	if err != nil || !lstatCalled || fi.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("Lstat(/abs) = %v, %v, %v, want a symlink", fi, lstatCalled, err)
+	}
+	if fi, err := fs.Stat("/dirlink"); err != nil || !fi.IsDir() {
+		t.Errorf("Stat(/dirlink) = %v, %v, want a directory", fi, err)
+	}
+	if target, err := linker.ReadlinkIfPossible("/dir/rel"); err != nil || target != "file.txt" {
+		t.Errorf("Readlink(/dir/rel) = %q, %v", target, err)
+	}
+	if _, err := linker.ReadlinkIfPossible("/dir/file.txt"); !errors.Is(err, syscall.EINVAL) {
+		t.Errorf("Readlink of a regular file: got %v, want EINVAL", err)
+	}
+	if _, err := fs.Stat("/dangling"); !os.IsNotExist(err) {
+		t.Errorf("Stat(/dangling): got %v, want not exist", err)
+	}
+	if _, err := fs.Stat("/loop1"); !errors.Is(err, errLoop) {
+		t.Errorf("Stat(/loop1): got %v, want ELOOP", err)
+	}
+
+	// Walk reports symlinks without following them.
+	var walked []string
+	Walk(fs, "/dirlink", func(path string, info os.FileInfo, err error) error {
+		walked = append(walked, path)
+		return err
+	})
+	if len(walked) != 1 {
+		t.Errorf("Walk followed the symlink: %v", walked)
+	}
+
+	// Remove deletes the symlink, not its target.
+	if err := fs.Remove("/abs"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Stat("/dir/file.txt"); err != nil {
+		t.Errorf("removing the symlink removed the target: %v", err)
+	}
+}
+
+func TestMemMapFsWithLimits(t *testing.T) {
+	fs := NewMemMapFsWithLimits(10, 3).(*MemMapFs)
+
+	f, err := fs.Create("/dir/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("0123456789")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("x")); !errors.Is(err, errNoSpace) {
+		t.Errorf("write past the byte limit: got %v, want ENOSPC", err)
+	}
+	if err := f.Truncate(4); err != nil {
+		t.Fatal(err)
+	}
+	f.Seek(0, io.SeekEnd)
+	if _, err := f.Write([]byte("x")); err != nil {
+		t.Errorf("write after truncate: %v", err)
+	}
+	f.Close()
+
+	if bytes, files := fs.Usage(); bytes != 5 || files != 2 {
+		t.Errorf("Usage = %d bytes, %d files, want 5 bytes, 2 files", bytes, files)
+	}
+
+	if err := fs.Mkdir("/other", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Create("/too-many"); !errors.Is(err, errNoSpace) {
+		t.Errorf("create past the file limit: got %v, want ENOSPC", err)
+	}
+	if _, err := fs.Stat("/too-many"); !os.IsNotExist(err) {
+		t.Errorf("failed create left a file behind: %v", err)
+	}
+
+	// Replacing and removing files releases their space.
+	if err := WriteFile(fs, "/dir/file", []byte("abc"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.RemoveAll("/dir"); err != nil {
+		t.Fatal(err)
+	}
+	if bytes, files := fs.Usage(); bytes != 0 || files != 1 {
+		t.Errorf("Usage = %d bytes, %d files, want 0 bytes, 1 file", bytes, files)
+	}
+	if err := WriteFile(fs, "/a/b", []byte("0123456789"), 0o644); err != nil {
+		t.Errorf("write after freeing space: %v", err)
+	}
+}
+
+func TestMemMapFsDirTimes(t *testing.T) {
+	fs := &MemMapFs{}
+	old := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	dirTime := func(name string) time.Time {
+		t.Helper()
+		fi, err := fs.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fi.ModTime()
+	}
+	fs.MkdirAll("/a", 0o755)
+	fs.MkdirAll("/b", 0o755)
+
+	for _, step := range []struct {
+		desc    string
+		op      func() error
+		touched []string
+	}{
+		{"create", func() error { return WriteFile(fs, "/a/f", []byte("x"), 0o644) }, []string{"/a"}},
+		{"write", func() error { return WriteFile(fs, "/a/f", []byte("y"), 0o644) }, nil},
+		{"rename", func() error { return fs.Rename("/a/f", "/b/f") }, []string{"/a", "/b"}},
+		{"mkdir", func() error { return fs.Mkdir("/b/d", 0o755) }, []string{"/b"}},
+		{"remove", func() error { return fs.Remove("/b/f") }, []string{"/b"}},
+		{"removeall", func() error { return fs.RemoveAll("/b/d") }, []string{"/b"}},
+	} {
+		for _, d := range []string{"/a", "/b"} {
+			fs.Chtimes(d, old, old)
+		}
+		if err := step.op(); err != nil {
+			t.Fatalf("%s: %v", step.desc, err)
+		}
+		for _, d := range []string{"/a", "/b"} {
+			touched := false
+			for _, n := range step.touched {
+				touched = touched || n == d
+			}
+			if got := !dirTime(d).Equal(old); got != touched {
+				t.Errorf("%s: %s touched = %v, want %v", step.desc, d, got, touched)
+			}
+		}
+	}
+}
+
+func TestMemMapFsAccessAndChangeTimes(t *testing.T) {
+	fs := &MemMapFs{}
+	old := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	WriteFile(fs, "/f", []byte("data"), 0o644)
+	info := func() *mem.FileInfo {
+		t.Helper()
+		fi, err := fs.Stat("/f")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fi.(*mem.FileInfo)
+	}
+
+	fs.Chtimes("/f", old, old)
+	if fi := info(); !fi.AccessTime().Equal(old) || !fi.ModTime().Equal(old) {
+		t.Fatalf("times after Chtimes = %v, %v", fi.AccessTime(), fi.ModTime())
+	}
+	if info().ChangeTime().Equal(old) {
+		t.Error("Chtimes did not update the change time")
+	}
+
+	if _, err := ReadFile(fs, "/f"); err != nil {
+		t.Fatal(err)
+	}
+	if !info().AccessTime().Equal(old) {
+		t.Error("read updated the access time without tracking")
+	}
+
+	fs.SetAccessTimeTracking(true)
+	if _, err := ReadFile(fs, "/f"); err != nil {
+		t.Fatal(err)
+	}
+	if fi := info(); fi.AccessTime().Equal(old) || !fi.ModTime().Equal(old) {
+		t.Errorf("times after tracked read = %v, %v", fi.AccessTime(), fi.ModTime())
+	}
+
+	before := info().ChangeTime()
+	time.Sleep(time.Millisecond)
+	fs.Chmod("/f", 0o600)
+	if !info().ChangeTime().After(before) {
+		t.Error("Chmod did not update the change time")
+	}
+}
+
+func TestMemMapFsReaddirOrder(t *testing.T) {
+	fs := &MemMapFs{}
+	for _, name := range []string{"c", "a", "d", "b"} {
+		WriteFile(fs, "/dir/"+name, nil, 0o644)
+	}
+	fs.Rename("/dir/a", "/dir/e")
+	names := func(fs Fs) string {
+		t.Helper()
+		f, err := fs.Open("/dir")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		// in batches, which must continue one listing
+		var all []string
+		for {
+			batch, err := f.Readdirnames(2)
+			all = append(all, batch...)
+			if err != nil {
+				break
+			}
+		}
+		return strings.Join(all, " ")
+	}
+
+	if got := names(fs); got != "b c d e" {
+		t.Errorf("default order = %q", got)
+	}
+	fs.SetReaddirOrder(mem.InsertionOrder)
+	if got := names(fs); got != "c d b e" {
+		t.Errorf("insertion order = %q", got)
+	}
+	fs.Remove("/dir/d")
+	WriteFile(fs, "/dir/a", nil, 0o644)
+	if got := names(fs); got != "c b e a" {
+		t.Errorf("insertion order after changes = %q", got)
+	}
+	if got := names(fs.Snapshot()); got != "c b e a" {
+		t.Errorf("insertion order of the snapshot = %q", got)
+	}
+	fs.SetReaddirOrder(mem.Unordered)
+	got := strings.Fields(names(fs))
+	sort.Strings(got)
+	if strings.Join(got, " ") != "a b c e" {
+		t.Errorf("unordered = %q", got)
+	}
+}
+
+func TestMemMapFsFileBytes(t *testing.T) {
+	m := NewMemMapFsWithLimits(100, 0).(*MemMapFs)
+	fixture := []byte("large fixture")
+	if err := m.SetFileBytes("/data/fixture", fixture, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	b, ok := m.FileBytes("/data/fixture")
+	if !ok || &b[0] != &fixture[0] {
+		t.Errorf("FileBytes = %q, %v, want the slice set", b, ok)
+	}
+	if got, err := ReadFile(m, "/data/fixture"); err != nil || string(got) != "large fixture" {
+		t.Errorf("ReadFile = %q, %v", got, err)
+	}
+	if fi, err := m.Stat("/data/fixture"); err != nil || fi.Mode().Perm() != 0o644 {
+		t.Errorf("Stat = %v, %v", fi, err)
+	}
+
+	// the snapshot keeps the content when it changes
+	s := m.Snapshot()
+	if err := m.SetFileBytes("/data/fixture", []byte("changed"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := s.FileBytes("/data/fixture"); string(b) != "large fixture" {
+		t.Errorf("snapshot = %q", b)
+	}
+	if err := m.SetFileBytes("/data/fixture", make([]byte, 101), 0o644); !errors.Is(err, errNoSpace) {
+		t.Errorf("SetFileBytes over the quota = %v, want ENOSPC", err)
+	}
+
+	// files written in pieces are put in one
+	WriteFile(m, "/data/written", []byte("written"), 0o644)
+	b, _ = m.FileBytes("/data/written")
+	if again, _ := m.FileBytes("/data/written"); string(b) != "written" || &again[0] != &b[0] {
+		t.Errorf("FileBytes = %q, copied again", again)
+	}
+	for _, name := range []string{"/data", "/missing"} {
+		if _, ok := m.FileBytes(name); ok {
+			t.Errorf("FileBytes(%s) succeeded", name)
+		}
+	}
+}
+
+func TestMemMapFsSnapshot(t *testing.T) {
+	m := NewMemMapFsWithLimits(0, 100).(*MemMapFs)
+	m.MkdirAll("/dir/sub", 0o755)
+	WriteFile(m, "/dir/a", []byte("hello"), 0o644)
+	Link(m, "/dir/a", "/dir/b")
+	m.SymlinkIfPossible("/dir/a", "/link")
+
+	snap := m.Snapshot()
+	content := func(fs Fs, name string) string {
+		t.Helper()
+		data, err := ReadFile(fs, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	// an in-place write to the original must not show in the snapshot
+	f, err := m.OpenFile("/dir/a", os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteAt([]byte("J"), 0)
+	f.Close()
+	m.Remove("/dir/sub")
+	WriteFile(m, "/dir/new", nil, 0o644)
+
+	if got := content(snap, "/link"); got != "hello" {
+		t.Errorf("snapshot content = %q, want %q", got, "hello")
+	}
+	if got := content(m, "/dir/b"); got != "Jello" {
+		t.Errorf("original content = %q, want %q", got, "Jello")
+	}
+	if names, _ := readDirNames(snap, "/dir"); strings.Join(names, ",") != "a,b,sub" {
+		t.Errorf("snapshot lists %v", names)
+	}
+
+	// hard links stay linked within the snapshot
+	WriteFile(snap, "/dir/b", []byte("bye"), 0o644)
+	if got := content(snap, "/dir/a"); got != "bye" {
+		t.Errorf("snapshot link content = %q, want %q", got, "bye")
+	}
+	if got := content(m, "/dir/a"); got != "Jello" {
+		t.Errorf("original content after writing the snapshot = %q", got)
+	}
+	if _, files := snap.Usage(); files != 5 {
+		t.Errorf("snapshot counts %d files, want 5", files)
+	}
+
+	for i := 0; i < 2; i++ {
+		m.Restore(snap)
+		if got := content(m, "/dir/a"); got != "bye" {
+			t.Errorf("restored content = %q, want %q", got, "bye")
+		}
+		if _, err := m.Stat("/dir/new"); !os.IsNotExist(err) {
+			t.Errorf("file created after the snapshot survived Restore: %v", err)
+		}
+		WriteFile(m, "/dir/a", []byte("again"), 0o644)
+	}
+	if got := content(snap, "/dir/a"); got != "bye" {
+		t.Errorf("Restore changed the snapshot to %q", got)
+	}
+}
+
+func TestMemMapFsTreeOperations(t *testing.T) {
+	fs := &MemMapFs{}
+	for _, name := range []string{"/foo/a", "/foo/sub/b", "/foobar/c", "/foo.txt"} {
+		if err := WriteFile(fs, name, []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	paths := func() string {
+		var ps []string
+		for p := range fs.getData() {
+			ps = append(ps, filepath.ToSlash(p))
+		}
+		sort.Strings(ps)
+		return strings.Join(ps, " ")
+	}
+
+	if err := fs.Remove("/foo"); !errors.Is(err, errNotEmpty) {
+		t.Errorf("Remove of a non-empty directory = %v, want ENOTEMPTY", err)
+	}
+	if err := fs.Rename("/foo", "/foo/sub/x"); !errors.Is(err, syscall.EINVAL) {
+		t.Errorf("Rename below itself = %v, want EINVAL", err)
+	}
+	if err := fs.Rename("/foo", "/foo.txt"); !errors.Is(err, syscall.ENOTDIR) {
+		t.Errorf("Rename of a directory onto a file = %v, want ENOTDIR", err)
+	}
+	if err := fs.Rename("/foo.txt", "/foobar"); !errors.Is(err, syscall.EISDIR) {
+		t.Errorf("Rename of a file onto a directory = %v, want EISDIR", err)
+	}
+	if err := fs.Rename("/foo", "/foobar"); !errors.Is(err, errNotEmpty) {
+		t.Errorf("Rename onto a non-empty directory = %v, want ENOTEMPTY", err)
+	}
+
+	if err := fs.Rename("/foo", "/moved"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := paths(), "/ /foo.txt /foobar /foobar/c /moved /moved/a /moved/sub /moved/sub/b"; got != want {
+		t.Errorf("after Rename: %s, want %s", got, want)
+	}
+	if got, err := ReadFile(fs, "/moved/sub/b"); err != nil || string(got) != "/foo/sub/b" {
+		t.Errorf("ReadFile after Rename = %q, %v", got, err)
+	}
+	if names, _ := readDirNames(fs, "/moved/sub"); strings.Join(names, ",") != "b" {
+		t.Errorf("Readdir after Rename = %v", names)
+	}
+
+	WriteFile(fs, "/moved/sub/b2", nil, 0o644)
+	if err := fs.RemoveAll("/moved/sub/b"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := paths(), "/ /foo.txt /foobar /foobar/c /moved /moved/a /moved/sub /moved/sub/b2"; got != want {
+		t.Errorf("after RemoveAll of a prefix: %s, want %s", got, want)
+	}
+	if err := fs.RemoveAll("/"); err != nil {
+		t.Fatal(err)
+	}
+	if got := paths(); got != "/" {
+		t.Errorf("after RemoveAll of the root: %s", got)
+	}
+	if names, _ := readDirNames(fs, "/"); len(names) != 0 {
+		t.Errorf("the root lists %v", names)
+	}
+}
+
+func TestMemMapFsClock(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := mem.NewFakeClock(start)
+	fs := &MemMapFs{}
+	fs.SetClock(clock)
+
+	modTime := func(name string) time.Time {
+		t.Helper()
+		fi, err := fs.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fi.ModTime()
+	}
+
+	if err := fs.Mkdir("/dir", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if got := modTime("/"); !got.Equal(start) {
+		t.Errorf("root = %v, want %v", got, start)
+	}
+	clock.Advance(time.Minute)
+	f, err := fs.Create("/dir/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := start.Add(time.Minute)
+	if got := modTime("/dir/file"); !got.Equal(created) {
+		t.Errorf("new file = %v, want %v", got, created)
+	}
+	if got := modTime("/dir"); !got.Equal(created) {
+		t.Errorf("parent after create = %v, want %v", got, created)
+	}
+
+	clock.Advance(time.Hour)
+	f.WriteString("data")
+	f.Close()
+	written := created.Add(time.Hour)
+	fi, _ := fs.Stat("/dir/file")
+	if !fi.ModTime().Equal(written) {
+		t.Errorf("after write = %v, want %v", fi.ModTime(), written)
+	}
+	if ctime := fi.(*mem.FileInfo).ChangeTime(); !ctime.Equal(written) {
+		t.Errorf("change time = %v, want %v", ctime, written)
+	}
+
+	// Snapshots keep the clock.
+	s := fs.Snapshot()
+	clock.Set(start)
+	WriteFile(s, "/other", nil, 0o644)
+	if fi, _ := s.Stat("/other"); !fi.ModTime().Equal(start) {
+		t.Errorf("file of the snapshot = %v, want %v", fi.ModTime(), start)
+	}
+}
+
+func TestMemMapFsDumpAndLoad(t *testing.T) {
+	fs := &MemMapFs{}
+	mtime := time.Date(2021, 2, 3, 4, 5, 6, 7000, time.UTC)
+	atime := mtime.Add(time.Hour)
+	fs.MkdirAll("/dir/sub", 0o755)
+	WriteFile(fs, "/dir/file", []byte("content"), 0o640)
+	WriteFile(fs, "/empty", nil, 0o600)
+	fs.SymlinkIfPossible("dir/file", "/link")
+	fs.LinkIfPossible("/dir/file", "/hard")
+	fs.Chown("/dir/file", 1000, 100)
+	SetXattr(fs, "/dir/file", "user.tag", []byte("v\x00bin"))
+	for _, name := range []string{"/dir/file", "/dir/sub", "/dir", "/"} {
+		fs.Chtimes(name, atime, mtime)
+	}
+	fs.Chmod("/dir/sub", 0o555)
+
+	var dump bytes.Buffer
+	if err := fs.DumpTo(&dump); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadMemMapFs(bytes.NewReader(dump.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := ReadFile(loaded, "/link"); err != nil || string(got) != "content" {
+		t.Errorf("content through the symlink = %q, %v", got, err)
+	}
+	for _, name := range []string{"/dir/file", "/dir/sub", "/dir", "/"} {
+		fi, err := loaded.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, _ := fs.Stat(name)
+		if fi.Mode() != want.Mode() || !fi.ModTime().Equal(mtime) || !fi.(*mem.FileInfo).AccessTime().Equal(atime) {
+			t.Errorf("%s = %v %v %v, want %v %v %v", name, fi.Mode(), fi.ModTime(), fi.(*mem.FileInfo).AccessTime(), want.Mode(), mtime, atime)
+		}
+	}
+	if target, _ := loaded.ReadlinkIfPossible("/link"); target != "dir/file" {
+		t.Errorf("symlink target = %q", target)
+	}
+	if v, err := GetXattr(loaded, "/dir/file", "user.tag"); err != nil || string(v) != "v\x00bin" {
+		t.Errorf("xattr = %q, %v", v, err)
+	}
+	f, _ := loaded.open("/dir/file")
+	if uid, gid := mem.Owner(f); uid != 1000 || gid != 100 {
+		t.Errorf("owner = %d:%d", uid, gid)
+	}
+	// the hard link still shares the content
+	WriteFile(loaded, "/hard", []byte("changed"), 0o640)
+	if got, _ := ReadFile(loaded, "/dir/file"); string(got) != "changed" {
+		t.Errorf("content after writing the hard link = %q", got)
+	}
+
+	// dumps are stable, for golden files
+	var again bytes.Buffer
+	if err := fs.DumpTo(&again); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(dump.Bytes(), again.Bytes()) {
+		t.Error("dumping the same files twice differs")
+	}
+}
@@ -0,0 +1,157 @@
+package afero
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/spf13/afero/mem"
+)
+
+// Permission bits checked by a MemMapFs in strict mode, as in access(2).
+const (
+	permRead  os.FileMode = 4
+	permWrite os.FileMode = 2
+	permExec  os.FileMode = 1
+)
+
+// SetStrictPermissions makes m enforce the Unix permission bits and the
+// ownership of files for the user uid in group gid, returning EACCES (or
+// EPERM for Chmod, Chown and Chtimes) like a real file system would. Files
+// and directories created from then on belong to uid and gid, and Create
+// uses mode 0666 like os.Create. As for root, nothing is enforced if uid is
+// 0.
+//
+// Set up the files a test needs first, then switch to strict mode. Note that
+// the parent directories a file creates implicitly have no permission bits,
+// so create them with MkdirAll.
+func (m *MemMapFs) SetStrictPermissions(uid, gid int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.strict = true
+	m.uid, m.gid = uid, gid
+}
+
+// own gives f to the user of a strict MemMapFs.
+func (m *MemMapFs) own(f *mem.FileData) {
+	if m.strict {
+		mem.SetUID(f, m.uid)
+		mem.SetGID(f, m.gid)
+	}
+}
+
+// access reports whether the user may access f as asked by want.
+func (m *MemMapFs) access(f *mem.FileData, want os.FileMode) bool {
+	if m.uid == 0 {
+		return true
+	}
+	uid, gid := mem.Owner(f)
+	mode := mem.GetFileInfo(f).Mode().Perm()
+	switch {
+	case uid == m.uid:
+		mode >>= 6
+	case gid == m.gid:
+		mode >>= 3
+	}
+	return mode&want == want
+}
+
+// checkAccess returns EACCES in strict mode unless the parent directories
+// of name may be searched and name grants want if it exists. If it does
+// not, the closest existing parent must grant createWant.
+func (m *MemMapFs) checkAccess(op, name string, want, createWant os.FileMode) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if !m.strict {
+		return nil
+	}
+	resolved, err := m.lockfreeResolve(name, true)
+	if err != nil {
+		return nil // reported by the operation itself
+	}
+	data := m.getData()
+	f, exists := data[resolved]
+	for dir := resolved; ; {
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+		d, ok := data[dir]
+		if !ok {
+			continue
+		}
+		if !m.access(d, permExec) || !exists && !m.access(d, createWant) {
+			return &os.PathError{Op: op, Path: name, Err: syscall.EACCES}
+		}
+		exists = true // only the closest parent has to grant createWant
+	}
+	if f != nil && !m.access(f, want) {
+		return &os.PathError{Op: op, Path: name, Err: syscall.EACCES}
+	}
+	return nil
+}
+
+// checkParent returns EACCES in strict mode unless the directory containing
+// name may be modified.
+func (m *MemMapFs) checkParent(op, name string) error {
+	err := m.checkAccess(op, filepath.Dir(normalizePath(name)), permWrite|permExec, 0)
+	if err != nil {
+		err.(*os.PathError).Path = name
+	}
+	return err
+}
+
+// checkOwner returns EPERM in strict mode unless the user owns name.
+func (m *MemMapFs) checkOwner(op, name string) error {
+	if err := m.checkAccess(op, name, 0, 0); err != nil {
+		return err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if !m.strict || m.uid == 0 {
+		return nil
+	}
+	resolved, err := m.lockfreeResolve(name, true)
+	if err != nil {
+		return nil
+	}
+	f, ok := m.getData()[resolved]
+	if !ok {
+		return nil
+	}
+	if uid, _ := mem.Owner(f); uid != m.uid {
+		return &os.PathError{Op: op, Path: name, Err: syscall.EPERM}
+	}
+	return nil
+}
+
+// openPerm returns the permissions needed to open a file with flag.
+func openPerm(flag int) os.FileMode {
+	var want os.FileMode
+	switch flag & (os.O_RDONLY | os.O_WRONLY | os.O_RDWR) {
+	case os.O_RDONLY:
+		want = permRead
+	case os.O_WRONLY:
+		want = permWrite
+	default:
+		want = permRead | permWrite
+	}
+	if flag&os.O_TRUNC != 0 {
+		want |= permWrite
+	}
+	return want
+}
+
+// checkRoot returns EPERM in strict mode unless the user is root.
+func (m *MemMapFs) checkRoot(op, name string) error {
+	if err := m.checkAccess(op, name, 0, 0); err != nil {
+		return err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.strict && m.uid != 0 {
+		return &os.PathError{Op: op, Path: name, Err: syscall.EPERM}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package afero
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/spf13/afero/mem"
+)
+
+func TestMemMapFsStrictPermissions(t *testing.T) {
+	fs := &MemMapFs{}
+	for _, dir := range []string{"/home/user/sub", "/shared", "/root"} {
+		if err := fs.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, perm := range map[string]os.FileMode{
+		"/home/user/own.txt":   0o600,
+		"/home/user/ro.txt":    0o400,
+		"/shared/group.txt":    0o640,
+		"/shared/other.txt":    0o640,
+		"/root/secret.txt":     0o600,
+		"/home/user/sub/a.txt": 0o644,
+	} {
+		if err := WriteFile(fs, name, []byte("x"), perm); err != nil {
+			t.Fatal(err)
+		}
+		if err := fs.Chmod(name, perm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fs.Chmod("/root", os.ModeDir|0o700)
+	fs.Chown("/shared/group.txt", 0, 100)
+	for _, name := range []string{"/home/user", "/home/user/own.txt", "/home/user/ro.txt", "/home/user/sub", "/home/user/sub/a.txt"} {
+		fs.Chown(name, 1000, 100)
+	}
+	fs.SetStrictPermissions(1000, 100)
+
+	denied := func(err error) bool { return errors.Is(err, syscall.EACCES) }
+
+	if _, err := fs.Open("/home/user/own.txt"); err != nil {
+		t.Errorf("Open own file: %v", err)
+	}
+	if _, err := fs.OpenFile("/home/user/ro.txt", os.O_WRONLY, 0); !denied(err) || !os.IsPermission(err) {
+		t.Errorf("OpenFile read-only file for writing: got %v, want EACCES", err)
+	}
+	if _, err := fs.Open("/shared/group.txt"); err != nil {
+		t.Errorf("Open group readable file: %v", err)
+	}
+	if _, err := fs.Open("/shared/other.txt"); !denied(err) {
+		t.Errorf("Open file only readable by owner and group: got %v, want EACCES", err)
+	}
+	if _, err := fs.Stat("/root/secret.txt"); !denied(err) {
+		t.Errorf("Stat in unsearchable directory: got %v, want EACCES", err)
+	}
+	if _, err := fs.Create("/shared/new.txt"); !denied(err) {
+		t.Errorf("Create in foreign directory: got %v, want EACCES", err)
+	}
+	if err := fs.Mkdir("/shared/dir", 0o755); !denied(err) {
+		t.Errorf("Mkdir in foreign directory: got %v, want EACCES", err)
+	}
+	if err := fs.Remove("/shared/other.txt"); !denied(err) {
+		t.Errorf("Remove from foreign directory: got %v, want EACCES", err)
+	}
+	if err := fs.Chmod("/shared/other.txt", 0o777); !errors.Is(err, syscall.EPERM) {
+		t.Errorf("Chmod foreign file: got %v, want EPERM", err)
+	}
+	if err := fs.Chown("/home/user/own.txt", 0, 0); !errors.Is(err, syscall.EPERM) {
+		t.Errorf("Chown: got %v, want EPERM", err)
+	}
+
+	f, err := fs.Create("/home/user/new.txt")
+	if err != nil {
+		t.Fatalf("Create in own directory: %v", err)
+	}
+	f.Close()
+	if err := fs.MkdirAll("/home/user/x/y", 0o700); err != nil {
+		t.Fatalf("MkdirAll in own directory: %v", err)
+	}
+	if err := fs.Remove("/home/user/sub/a.txt"); err != nil {
+		t.Errorf("Remove from own directory: %v", err)
+	}
+	fi, err := fs.Stat("/home/user/new.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0o666 {
+		t.Errorf("Create mode = %v, want 0666", fi.Mode())
+	}
+	if _, err := ReadFile(fs, "/home/user/new.txt"); err != nil {
+		t.Errorf("ReadFile created file: %v", err)
+	}
+	for _, name := range []string{"/home/user/new.txt", "/home/user/x/y"} {
+		f := fs.getData()[normalizePath(name)]
+		if uid, gid := mem.Owner(f); uid != 1000 || gid != 100 {
+			t.Errorf("%s is owned by %d:%d, want 1000:100", name, uid, gid)
+		}
+	}
+
+	// Root may do anything.
+	fs.SetStrictPermissions(0, 0)
+	if _, err := fs.Open("/root/secret.txt"); err != nil {
+		t.Errorf("Open as root: %v", err)
+	}
+}
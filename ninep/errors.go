@@ -0,0 +1,59 @@
+package ninep
+
+import (
+	"errors"
+	"os"
+	"syscall"
+
+	"github.com/spf13/afero"
+)
+
+// errnos maps errors to the Linux error numbers of Rlerror, which differ
+// from those of the syscall package on other platforms. The first match
+// wins.
+var errnos = []struct {
+	err   error
+	errno uint32
+}{
+	{syscall.EPERM, 1},
+	{syscall.ENOENT, 2},
+	{syscall.EIO, 5},
+	{syscall.EBADF, 9},
+	{syscall.EACCES, 13},
+	{syscall.EBUSY, 16},
+	{syscall.EEXIST, 17},
+	{syscall.EXDEV, 18},
+	{syscall.ENOTDIR, 20},
+	{syscall.EISDIR, 21},
+	{syscall.EINVAL, 22},
+	{syscall.ENOSPC, 28},
+	{syscall.EROFS, 30},
+	{syscall.ENAMETOOLONG, 36},
+	{syscall.ENOTEMPTY, 39},
+	{syscall.ELOOP, 40},
+	{syscall.ENOTSUP, 95},
+	{os.ErrNotExist, 2},
+	{os.ErrExist, 17},
+	{os.ErrPermission, 13},
+	{os.ErrClosed, 9},
+	{os.ErrInvalid, 22},
+	{afero.ErrFileClosed, 9},
+	{afero.ErrOutOfRange, 22},
+	{afero.ErrTooLarge, 27},
+	{afero.ErrXattrNotFound, 61},
+	{afero.ErrNoSymlink, 95},
+	{afero.ErrNoReadlink, 95},
+	{afero.ErrNoLink, 95},
+	{afero.ErrNoXattr, 95},
+	{errShortMessage, 22},
+}
+
+// errno returns the Linux error number of err, EIO if it has none.
+func errno(err error) uint32 {
+	for _, e := range errnos {
+		if errors.Is(err, e.err) {
+			return e.errno
+		}
+	}
+	return 5
+}
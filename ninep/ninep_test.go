@@ -0,0 +1,314 @@
+package ninep
+
+import (
+	"net"
+	"os"
+	"runtime"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// client speaks 9P2000.L to a Server over a pipe.
+type client struct {
+	t    *testing.T
+	conn net.Conn
+	tag  uint16
+}
+
+func newClient(t *testing.T, fs afero.Fs) *client {
+	t.Helper()
+	cc, sc := net.Pipe()
+	done := make(chan error)
+	go func() { done <- New(fs).ServeConn(sc) }()
+	t.Cleanup(func() {
+		cc.Close()
+		if err := <-done; err != nil {
+			t.Errorf("ServeConn = %v", err)
+		}
+	})
+	c := &client{t: t, conn: cc}
+	d := c.rpc(tversion, func(e *encoder) { e.u32(8192); e.str(version) })
+	if msize, v := d.u32(), d.str(); msize != 8192 || v != version {
+		t.Fatalf("Rversion = %d %q", msize, v)
+	}
+	c.rpc(tattach, func(e *encoder) { e.u32(0); e.u32(^uint32(0)); e.str("user"); e.str(""); e.u32(0) })
+	return c
+}
+
+// call sends a message of type typ and returns the reply, which is either
+// of type typ+1 or an Rlerror.
+func (c *client) call(typ uint8, body func(*encoder)) (*decoder, uint32) {
+	c.t.Helper()
+	c.tag++
+	e := newMessage(typ, c.tag)
+	body(e)
+	if _, err := c.conn.Write(e.bytes()); err != nil {
+		c.t.Fatal(err)
+	}
+	msg, err := readMessage(c.conn, 1<<20)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	d := &decoder{b: msg}
+	rtyp, tag := d.u8(), d.u16()
+	if tag != c.tag {
+		c.t.Fatalf("reply tag %d, want %d", tag, c.tag)
+	}
+	if rtyp == rlerror {
+		return nil, d.u32()
+	}
+	if rtyp != typ+1 {
+		c.t.Fatalf("reply type %d to %d", rtyp, typ)
+	}
+	return d, 0
+}
+
+// rpc is call, failing the test on an Rlerror.
+func (c *client) rpc(typ uint8, body func(*encoder)) *decoder {
+	c.t.Helper()
+	d, errno := c.call(typ, body)
+	if errno != 0 {
+		c.t.Fatalf("message %d: error %d", typ, errno)
+	}
+	return d
+}
+
+func (c *client) walk(fid, newfid uint32, names ...string) (*decoder, uint32) {
+	c.t.Helper()
+	return c.call(twalk, func(e *encoder) {
+		e.u32(fid)
+		e.u32(newfid)
+		e.u16(uint16(len(names)))
+		for _, name := range names {
+			e.str(name)
+		}
+	})
+}
+
+func (c *client) readAll(fid uint32) string {
+	c.t.Helper()
+	var data []byte
+	for {
+		d := c.rpc(tread, func(e *encoder) { e.u32(fid); e.u64(uint64(len(data))); e.u32(5) })
+		n := d.u32()
+		if n == 0 {
+			return string(data)
+		}
+		data = append(data, d.next(int(n))...)
+	}
+}
+
+func (c *client) readdir(fid uint32) []string {
+	c.t.Helper()
+	var names []string
+	var off uint64
+	for {
+		d := c.rpc(treaddir, func(e *encoder) { e.u32(fid); e.u64(off); e.u32(64) })
+		entries := &decoder{b: d.next(int(d.u32()))}
+		if len(entries.b) == 0 {
+			return names
+		}
+		for len(entries.b) > 0 {
+			entries.next(13)
+			off = entries.u64()
+			entries.u8()
+			names = append(names, entries.str())
+		}
+	}
+}
+
+func TestServeFiles(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "/dir/hello.txt", []byte("hello, world"), 0o644)
+	c := newClient(t, fs)
+
+	if _, errno := c.walk(0, 1, "dir", "missing"); errno != 0 {
+		t.Fatalf("partial walk = error %d", errno)
+	}
+	if _, errno := c.walk(1, 1); errno != 9 {
+		t.Errorf("the fid of a partial walk was created: error %d", errno)
+	}
+	if _, errno := c.walk(0, 1, "missing"); errno != 2 {
+		t.Errorf("walk to a missing file = error %d, want ENOENT", errno)
+	}
+	d, _ := c.walk(0, 1, "dir", "..", "..", "dir", "hello.txt")
+	if n := d.u16(); n != 5 {
+		t.Fatalf("walked %d names", n)
+	}
+	c.rpc(tlopen, func(e *encoder) { e.u32(1); e.u32(0) })
+	if got := c.readAll(1); got != "hello, world" {
+		t.Errorf("read %q", got)
+	}
+	c.rpc(tclunk, func(e *encoder) { e.u32(1) })
+
+	// create, write and append
+	c.walk(0, 2, "dir")
+	c.rpc(tlcreate, func(e *encoder) { e.u32(2); e.str("new.txt"); e.u32(lORdwr); e.u32(0o600); e.u32(0) })
+	c.rpc(twrite, func(e *encoder) { e.u32(2); e.u64(0); e.u32(3); e.b = append(e.b, "abc"...) })
+	c.rpc(tclunk, func(e *encoder) { e.u32(2) })
+	c.walk(0, 2, "dir", "new.txt")
+	c.rpc(tlopen, func(e *encoder) { e.u32(2); e.u32(lOWronly | lOAppend) })
+	c.rpc(twrite, func(e *encoder) { e.u32(2); e.u64(0); e.u32(3); e.b = append(e.b, "def"...) })
+	if got, _ := afero.ReadFile(fs, "/dir/new.txt"); string(got) != "abcdef" {
+		t.Errorf("new.txt = %q", got)
+	}
+
+	d = c.rpc(tgetattr, func(e *encoder) { e.u32(2); e.u64(getattrBasic) })
+	d.u64()
+	q := qid{d.u8(), d.u32(), d.u64()}
+	mode := d.u32()
+	d.next(4 + 4 + 8 + 8) // uid, gid, nlink and rdev
+	if size := d.u64(); q.typ != qtFile || mode != sIFREG|0o600 || size != 6 {
+		t.Errorf("getattr = %v, mode %o, size %d", q, mode, size)
+	}
+
+	// setattr truncates and sets the times, after the file is closed,
+	// which sets its modification time
+	c.rpc(tclunk, func(e *encoder) { e.u32(2) })
+	c.walk(0, 2, "dir", "new.txt")
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	c.rpc(tsetattr, func(e *encoder) {
+		e.u32(2)
+		e.u32(setattrSize | setattrMtime | setattrMtimeSet | setattrMode)
+		e.u32(0o640)
+		e.u32(0)
+		e.u32(0)
+		e.u64(2)
+		e.u64(0)
+		e.u64(0)
+		e.u64(uint64(mtime.Unix()))
+		e.u64(0)
+	})
+	c.rpc(tclunk, func(e *encoder) { e.u32(2) })
+	fi, err := fs.Stat("/dir/new.txt")
+	if err != nil || fi.Size() != 2 || fi.Mode() != 0o640 || !fi.ModTime().Equal(mtime) {
+		t.Errorf("after setattr: size %d, mode %v, time %v, %v", fi.Size(), fi.Mode(), fi.ModTime(), err)
+	}
+}
+
+func TestServeDirectories(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	for _, name := range []string{"/a", "/b", "/c", "/d", "/e", "/f"} {
+		afero.WriteFile(fs, name, nil, 0o644)
+	}
+	c := newClient(t, fs)
+
+	c.rpc(tmkdir, func(e *encoder) { e.u32(0); e.str("sub"); e.u32(0o755); e.u32(0) })
+	if _, errno := c.call(tmkdir, func(e *encoder) { e.u32(0); e.str("sub"); e.u32(0o755); e.u32(0) }); errno != 17 {
+		t.Errorf("mkdir of an existing directory = error %d, want EEXIST", errno)
+	}
+	if _, errno := c.call(tmkdir, func(e *encoder) { e.u32(0); e.str("../x"); e.u32(0o755); e.u32(0) }); errno != 22 {
+		t.Errorf("mkdir with a slash = error %d, want EINVAL", errno)
+	}
+
+	c.walk(0, 1)
+	c.rpc(tlopen, func(e *encoder) { e.u32(1); e.u32(0) })
+	names := c.readdir(1)
+	sort.Strings(names)
+	if want := []string{".", "..", "a", "b", "c", "d", "e", "f", "sub"}; len(names) != len(want) {
+		t.Errorf("readdir = %v, want %v", names, want)
+	}
+
+	c.walk(0, 2, "a")
+	c.walk(0, 3, "sub")
+	c.rpc(trenameat, func(e *encoder) { e.u32(0); e.str("b"); e.u32(3); e.str("b") })
+	if ok, _ := afero.Exists(fs, "/sub/b"); !ok {
+		t.Error("renameat did not move b")
+	}
+	c.rpc(trename, func(e *encoder) { e.u32(2); e.u32(3); e.str("moved") })
+	if ok, _ := afero.Exists(fs, "/sub/moved"); !ok {
+		t.Error("rename did not move a")
+	}
+	// the fid follows its file
+	c.rpc(tlopen, func(e *encoder) { e.u32(2); e.u32(lOWronly) })
+	c.rpc(tclunk, func(e *encoder) { e.u32(2) })
+
+	if _, errno := c.call(tunlinkat, func(e *encoder) { e.u32(0); e.str("sub"); e.u32(0) }); errno != 21 {
+		t.Errorf("unlinkat of a directory without AT_REMOVEDIR = error %d, want EISDIR", errno)
+	}
+	if _, errno := c.call(tunlinkat, func(e *encoder) { e.u32(0); e.str("c"); e.u32(atRemovedir) }); errno != 20 {
+		t.Errorf("unlinkat of a file with AT_REMOVEDIR = error %d, want ENOTDIR", errno)
+	}
+	c.rpc(tunlinkat, func(e *encoder) { e.u32(3); e.str("moved"); e.u32(0) })
+	c.rpc(tunlinkat, func(e *encoder) { e.u32(3); e.str("b"); e.u32(0) })
+	c.rpc(tunlinkat, func(e *encoder) { e.u32(0); e.str("sub"); e.u32(atRemovedir) })
+	if ok, _ := afero.Exists(fs, "/sub"); ok {
+		t.Error("sub was not removed")
+	}
+
+	c.walk(0, 4, "d")
+	c.rpc(tremove, func(e *encoder) { e.u32(4) })
+	if _, errno := c.call(tclunk, func(e *encoder) { e.u32(4) }); errno != 9 {
+		t.Errorf("the fid was not clunked by remove: error %d", errno)
+	}
+	if _, err := fs.Stat("/d"); !os.IsNotExist(err) {
+		t.Errorf("d was not removed: %v", err)
+	}
+}
+
+func TestServeLinksAndXattrs(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "/file", []byte("data"), 0o644)
+	c := newClient(t, fs)
+
+	c.rpc(tsymlink, func(e *encoder) { e.u32(0); e.str("link"); e.str("file"); e.u32(0) })
+	d, _ := c.walk(0, 1, "link")
+	if d.u16(); d.u8() != qtSymlink {
+		t.Error("the symlink is not walked as one")
+	}
+	if d := c.rpc(treadlink, func(e *encoder) { e.u32(1) }); d.str() != "file" {
+		t.Error("readlink did not return the target")
+	}
+	c.walk(0, 2, "file")
+	c.rpc(tlink, func(e *encoder) { e.u32(0); e.u32(2); e.str("hard") })
+	if got, _ := afero.ReadFile(fs, "/hard"); string(got) != "data" {
+		t.Errorf("hard link = %q", got)
+	}
+
+	c.walk(0, 3, "file")
+	c.rpc(txattrcreate, func(e *encoder) { e.u32(3); e.str("user.mime"); e.u64(4); e.u32(0) })
+	c.rpc(twrite, func(e *encoder) { e.u32(3); e.u64(0); e.u32(4); e.b = append(e.b, "text"...) })
+	c.rpc(tclunk, func(e *encoder) { e.u32(3) })
+	if v, err := afero.GetXattr(fs, "/file", "user.mime"); err != nil || string(v) != "text" {
+		t.Errorf("xattr = %q, %v", v, err)
+	}
+	d = c.rpc(txattrwalk, func(e *encoder) { e.u32(2); e.u32(4); e.str("") })
+	if size := d.u64(); size != uint64(len("user.mime\x00")) {
+		t.Errorf("size of the list = %d", size)
+	}
+	if got := c.readAll(4); got != "user.mime\x00" {
+		t.Errorf("xattr list = %q", got)
+	}
+	if _, errno := c.call(txattrwalk, func(e *encoder) { e.u32(2); e.u32(5); e.str("user.none") }); errno != 61 {
+		t.Errorf("missing xattr = error %d, want ENODATA", errno)
+	}
+}
+
+func TestOversizedWrite(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "/file", nil, 0o644)
+	cc, sc := net.Pipe()
+	defer cc.Close()
+	go New(fs).ServeConn(sc)
+	c := &client{t: t, conn: cc}
+
+	// a bare Twrite, the count of which is not backed by data
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, errno := c.call(twrite, func(e *encoder) { e.u32(0); e.u64(0); e.u32(^uint32(0)); e.b = append(e.b, "data"...) })
+	runtime.ReadMemStats(&after)
+	if errno != 22 {
+		t.Errorf("Twrite of 4 GiB = error %d, want EINVAL", errno)
+	}
+	if n := after.TotalAlloc - before.TotalAlloc; n > 1<<20 {
+		t.Errorf("Twrite of 4 bytes claiming 4 GiB allocated %d bytes", n)
+	}
+
+	// a count within msize, longer than the message
+	if _, errno := c.call(twrite, func(e *encoder) { e.u32(0); e.u64(0); e.u32(100); e.b = append(e.b, "data"...) }); errno != 22 {
+		t.Errorf("short Twrite = error %d, want EINVAL", errno)
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package ninep
+
+import "os"
+
+// sysOwner returns the user and group id of a FileInfo of the os package,
+// which are not available on this platform.
+func sysOwner(fi os.FileInfo) (uid, gid uint32) {
+	return 0, 0
+}
@@ -0,0 +1,174 @@
+package ninep
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// The message types of 9P2000.L, and those of 9P2000 it keeps.
+const (
+	tlerror      = 6
+	rlerror      = 7
+	tstatfs      = 8
+	rstatfs      = 9
+	tlopen       = 12
+	rlopen       = 13
+	tlcreate     = 14
+	rlcreate     = 15
+	tsymlink     = 16
+	rsymlink     = 17
+	tmknod       = 18
+	trename      = 20
+	rrename      = 21
+	treadlink    = 22
+	rreadlink    = 23
+	tgetattr     = 24
+	rgetattr     = 25
+	tsetattr     = 26
+	rsetattr     = 27
+	txattrwalk   = 30
+	txattrcreate = 32
+	treaddir     = 40
+	rreaddir     = 41
+	tfsync       = 50
+	rfsync       = 51
+	tlock        = 52
+	rlock        = 53
+	tgetlock     = 54
+	rgetlock     = 55
+	tlink        = 70
+	rlink        = 71
+	tmkdir       = 72
+	rmkdir       = 73
+	trenameat    = 74
+	rrenameat    = 75
+	tunlinkat    = 76
+	runlinkat    = 77
+	tversion     = 100
+	rversion     = 101
+	tauth        = 102
+	tattach      = 104
+	rattach      = 105
+	tflush       = 108
+	rflush       = 109
+	twalk        = 110
+	rwalk        = 111
+	tread        = 116
+	rread        = 117
+	twrite       = 118
+	rwrite       = 119
+	tclunk       = 120
+	rclunk       = 121
+	tremove      = 122
+	rremove      = 123
+)
+
+const (
+	version = "9P2000.L"
+	// noTag is the tag of Tversion.
+	noTag = 0xffff
+	// headerSize is the size of size[4] type[1] tag[2].
+	headerSize = 7
+	// maxWalk is the most names a Twalk may hold.
+	maxWalk = 16
+)
+
+// The types of qids.
+const (
+	qtDir     = 0x80
+	qtSymlink = 0x02
+	qtFile    = 0x00
+)
+
+// qid identifies a file on the server.
+type qid struct {
+	typ     uint8
+	version uint32
+	path    uint64
+}
+
+var errShortMessage = errors.New("ninep: short message")
+
+// decoder reads the fields of a message. Reading past its end sets err
+// and returns zero values, or no bytes for fields longer than an integer,
+// so a length read from the message cannot make it allocate.
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) next(n int) []byte {
+	if d.err != nil || n < 0 || len(d.b) < n {
+		d.err = errShortMessage
+		if n < 0 || n > 8 {
+			return nil
+		}
+		return make([]byte, n)
+	}
+	b := d.b[:n]
+	d.b = d.b[n:]
+	return b
+}
+
+func (d *decoder) u8() uint8   { return d.next(1)[0] }
+func (d *decoder) u16() uint16 { return binary.LittleEndian.Uint16(d.next(2)) }
+func (d *decoder) u32() uint32 { return binary.LittleEndian.Uint32(d.next(4)) }
+func (d *decoder) u64() uint64 { return binary.LittleEndian.Uint64(d.next(8)) }
+
+func (d *decoder) str() string {
+	return string(d.next(int(d.u16())))
+}
+
+// encoder builds a message.
+type encoder struct {
+	b []byte
+}
+
+// newMessage starts a message of type typ answering tag.
+func newMessage(typ uint8, tag uint16) *encoder {
+	e := &encoder{b: make([]byte, 4, 64)}
+	e.u8(typ)
+	e.u16(tag)
+	return e
+}
+
+func (e *encoder) u8(v uint8)   { e.b = append(e.b, v) }
+func (e *encoder) u16(v uint16) { e.b = binary.LittleEndian.AppendUint16(e.b, v) }
+func (e *encoder) u32(v uint32) { e.b = binary.LittleEndian.AppendUint32(e.b, v) }
+func (e *encoder) u64(v uint64) { e.b = binary.LittleEndian.AppendUint64(e.b, v) }
+
+func (e *encoder) str(s string) {
+	e.u16(uint16(len(s)))
+	e.b = append(e.b, s...)
+}
+
+func (e *encoder) qid(q qid) {
+	e.u8(q.typ)
+	e.u32(q.version)
+	e.u64(q.path)
+}
+
+// bytes returns the message with its size set.
+func (e *encoder) bytes() []byte {
+	binary.LittleEndian.PutUint32(e.b, uint32(len(e.b)))
+	return e.b
+}
+
+// readMessage reads a message of at most msize bytes from r and returns it
+// without its size.
+func readMessage(r io.Reader, msize uint32) ([]byte, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, err
+	}
+	n := binary.LittleEndian.Uint32(size[:])
+	if n < headerSize || n > msize {
+		return nil, errors.New("ninep: bad message size")
+	}
+	b := make([]byte, n-4)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
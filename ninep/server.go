@@ -0,0 +1,1260 @@
+// Package ninep serves an afero.Fs over the 9P2000.L protocol, the dialect
+// of 9P spoken by the Linux v9fs client, QEMU and gVisor. It lets virtual
+// machines and containers mount an in-process tree where FUSE is not
+// available:
+//
+//	l, _ := net.Listen("tcp", "127.0.0.1:5640")
+//	go ninep.New(afero.NewMemMapFs()).Serve(l)
+//
+//	mount -t 9p -o trans=tcp,port=5640,version=9p2000.L 127.0.0.1 /mnt
+//
+// Symlinks, hard links and extended attributes are served where the Fs
+// implements afero.Linker, afero.LinkReader, afero.HardLinker and
+// afero.Xattrer. There is no authentication; the user names of Tattach are
+// ignored and every request is made with the rights of the Fs.
+package ninep
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/spf13/afero/mem"
+)
+
+// DefaultMsize is the largest message size the server accepts unless
+// WithMsize says otherwise.
+const DefaultMsize = 1 << 20
+
+// Server serves an afero.Fs over 9P2000.L. It may serve any number of
+// connections at once; the requests of one connection are answered in
+// order.
+type Server struct {
+	fs    afero.Fs
+	msize uint32
+
+	mu    sync.Mutex
+	qids  map[string]uint64
+	nextQ uint64
+}
+
+// Option configures a Server.
+type Option func(*Server)
+
+// WithMsize sets the largest message size the server negotiates.
+func WithMsize(msize uint32) Option {
+	return func(s *Server) {
+		s.msize = msize
+	}
+}
+
+// New returns a Server for fs. The tree is attached at "/" unless a
+// client asks for another directory with the aname of Tattach.
+func New(fs afero.Fs, opts ...Option) *Server {
+	s := &Server{fs: fs, msize: DefaultMsize, qids: make(map[string]uint64)}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Serve accepts connections on l and serves each in its own goroutine. It
+// returns the error of Accept.
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		rwc, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.ServeConn(rwc)
+	}
+}
+
+// ServeConn serves the connection rwc until it is closed or a malformed
+// message is read, then closes it and the files it opened. It returns nil
+// if the client closed the connection.
+func (s *Server) ServeConn(rwc io.ReadWriteCloser) error {
+	c := &conn{s: s, rwc: rwc, msize: s.msize, fids: make(map[uint32]*fid)}
+	defer c.close()
+	for {
+		msg, err := readMessage(rwc, c.msize)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if _, err := rwc.Write(c.handle(msg)); err != nil {
+			return err
+		}
+	}
+}
+
+// qid returns the qid of the file p with the info fi. Paths are numbered in
+// the order they are first seen.
+func (s *Server) qid(p string, fi os.FileInfo) qid {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id, ok := s.qids[p]
+	if !ok {
+		s.nextQ++
+		id = s.nextQ
+		s.qids[p] = id
+	}
+	q := qid{typ: qtFile, path: id}
+	switch {
+	case fi.IsDir():
+		q.typ = qtDir
+	case fi.Mode()&os.ModeSymlink != 0:
+		q.typ = qtSymlink
+	}
+	return q
+}
+
+// moveQids keeps the qids of the tree below oldpath for newpath.
+func (s *Server) moveQids(oldpath, newpath string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.qids, newpath)
+	for p, id := range s.qids {
+		if rest, ok := below(oldpath, p); ok {
+			delete(s.qids, p)
+			s.qids[newpath+rest] = id
+		}
+	}
+}
+
+// forgetQids drops the qids of the tree below p.
+func (s *Server) forgetQids(p string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for q := range s.qids {
+		if _, ok := below(p, q); ok {
+			delete(s.qids, q)
+		}
+	}
+}
+
+// below reports whether p is dir or inside it, and returns the rest of p.
+func below(dir, p string) (string, bool) {
+	if p == dir {
+		return "", true
+	}
+	if dir == "/" {
+		return p, strings.HasPrefix(p, "/")
+	}
+	if strings.HasPrefix(p, dir+"/") {
+		return p[len(dir):], true
+	}
+	return "", false
+}
+
+// fid is a file of the client.
+type fid struct {
+	// path is the slash separated name of the file, and root the directory
+	// it was attached at, which ".." does not leave.
+	path, root string
+
+	file   afero.File
+	append bool
+	// entries is the listing read by Treaddir at offset 0.
+	entries []dirent
+
+	xattr *xattr
+}
+
+// xattr is an extended attribute opened by Txattrwalk or Txattrcreate.
+type xattr struct {
+	name  string
+	value []byte
+	// create is set by Txattrcreate; the value is set when the fid is
+	// clunked.
+	create bool
+	size   uint64
+}
+
+type dirent struct {
+	qid  qid
+	typ  uint8
+	name string
+}
+
+// conn is a connection being served.
+type conn struct {
+	s     *Server
+	rwc   io.ReadWriteCloser
+	msize uint32
+	fids  map[uint32]*fid
+}
+
+func (c *conn) close() {
+	c.reset()
+	c.rwc.Close()
+}
+
+// reset clunks all fids.
+func (c *conn) reset() {
+	for n, f := range c.fids {
+		c.clunkFid(f)
+		delete(c.fids, n)
+	}
+}
+
+func (c *conn) clunkFid(f *fid) error {
+	var err error
+	if f.file != nil {
+		err = f.file.Close()
+		f.file = nil
+	}
+	if x := f.xattr; x != nil && x.create {
+		if uint64(len(x.value)) != x.size {
+			return syscall.EINVAL
+		}
+		err = afero.SetXattr(c.s.fs, c.name(f.path), x.name, x.value)
+	}
+	return err
+}
+
+// name returns the name in the Fs of the fid path p.
+func (c *conn) name(p string) string {
+	return filepath.FromSlash(p)
+}
+
+func (c *conn) lstat(p string) (os.FileInfo, error) {
+	name := c.name(p)
+	if l, ok := c.s.fs.(afero.Lstater); ok {
+		fi, _, err := l.LstatIfPossible(name)
+		return fi, err
+	}
+	return c.s.fs.Stat(name)
+}
+
+func (c *conn) qid(p string) (qid, error) {
+	fi, err := c.lstat(p)
+	if err != nil {
+		return qid{}, err
+	}
+	return c.s.qid(p, fi), nil
+}
+
+// fid returns the fid numbered n.
+func (c *conn) fid(n uint32) (*fid, error) {
+	f, ok := c.fids[n]
+	if !ok {
+		return nil, syscall.EBADF
+	}
+	return f, nil
+}
+
+// newFid checks that n is not in use.
+func (c *conn) newFid(n uint32) error {
+	if _, ok := c.fids[n]; ok {
+		return syscall.EBADF
+	}
+	return nil
+}
+
+// child returns the path of the entry name of the directory fid dir.
+func (c *conn) child(dir uint32, name string) (string, error) {
+	f, err := c.fid(dir)
+	if err != nil {
+		return "", err
+	}
+	if err := checkName(name); err != nil {
+		return "", err
+	}
+	return path.Join(f.path, name), nil
+}
+
+// checkName rejects names which are not a single path element.
+func checkName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\x00") {
+		return syscall.EINVAL
+	}
+	return nil
+}
+
+// handle answers the message msg.
+func (c *conn) handle(msg []byte) []byte {
+	d := &decoder{b: msg}
+	typ, tag := d.u8(), d.u16()
+	r := newMessage(typ+1, tag)
+	var err error
+	switch typ {
+	case tversion:
+		err = c.version(d, r)
+	case tauth:
+		err = syscall.ENOTSUP
+	case tattach:
+		err = c.attach(d, r)
+	case tflush:
+		// requests are answered in order, so there is nothing to flush
+	case twalk:
+		err = c.walk(d, r)
+	case tread:
+		err = c.read(d, r)
+	case twrite:
+		err = c.write(d, r)
+	case tclunk:
+		err = c.clunk(d)
+	case tremove:
+		err = c.remove(d)
+	case tstatfs:
+		err = c.statfs(d, r)
+	case tlopen:
+		err = c.lopen(d, r)
+	case tlcreate:
+		err = c.lcreate(d, r)
+	case tsymlink:
+		err = c.symlink(d, r)
+	case trename:
+		err = c.rename(d)
+	case treadlink:
+		err = c.readlink(d, r)
+	case tgetattr:
+		err = c.getattr(d, r)
+	case tsetattr:
+		err = c.setattr(d)
+	case txattrwalk:
+		err = c.xattrwalk(d, r)
+	case txattrcreate:
+		err = c.xattrcreate(d)
+	case treaddir:
+		err = c.readdir(d, r)
+	case tfsync:
+		err = c.fsync(d)
+	case tlock:
+		err = c.lock(d, r)
+	case tgetlock:
+		err = c.getlock(d, r)
+	case tlink:
+		err = c.link(d)
+	case tmkdir:
+		err = c.mkdir(d, r)
+	case trenameat:
+		err = c.renameat(d)
+	case tunlinkat:
+		err = c.unlinkat(d)
+	default:
+		err = syscall.ENOTSUP
+	}
+	if err != nil {
+		r = newMessage(rlerror, tag)
+		r.u32(errno(err))
+	}
+	return r.bytes()
+}
+
+func (c *conn) version(d *decoder, r *encoder) error {
+	msize, v := d.u32(), d.str()
+	if d.err != nil {
+		return d.err
+	}
+	c.reset()
+	if msize > c.s.msize {
+		msize = c.s.msize
+	}
+	if msize < headerSize+64 {
+		return syscall.EINVAL
+	}
+	c.msize = msize
+	if v != version && !strings.HasPrefix(v, version+".") {
+		v = "unknown"
+	} else {
+		v = version
+	}
+	r.u32(msize)
+	r.str(v)
+	return nil
+}
+
+func (c *conn) attach(d *decoder, r *encoder) error {
+	n, _, _, aname, _ := d.u32(), d.u32(), d.str(), d.str(), d.u32()
+	if d.err != nil {
+		return d.err
+	}
+	if err := c.newFid(n); err != nil {
+		return err
+	}
+	root := path.Clean("/" + aname)
+	fi, err := c.s.fs.Stat(c.name(root))
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return syscall.ENOTDIR
+	}
+	c.fids[n] = &fid{path: root, root: root}
+	r.qid(c.s.qid(root, fi))
+	return nil
+}
+
+func (c *conn) walk(d *decoder, r *encoder) error {
+	n, newN, count := d.u32(), d.u32(), d.u16()
+	if count > maxWalk {
+		return syscall.EINVAL
+	}
+	names := make([]string, count)
+	for i := range names {
+		names[i] = d.str()
+	}
+	if d.err != nil {
+		return d.err
+	}
+	f, err := c.fid(n)
+	if err != nil {
+		return err
+	}
+	if newN != n {
+		if err := c.newFid(newN); err != nil {
+			return err
+		}
+	}
+
+	p := f.path
+	var qids []qid
+	for _, name := range names {
+		switch {
+		case name == "..":
+			if p != f.root {
+				p = path.Dir(p)
+			}
+		case checkName(name) != nil:
+			err = syscall.EINVAL
+		default:
+			p = path.Join(p, name)
+		}
+		var q qid
+		if err == nil {
+			q, err = c.qid(p)
+		}
+		if err != nil {
+			if len(qids) == 0 {
+				return err
+			}
+			// A partial walk is answered with the qids walked, and does
+			// not create newfid.
+			break
+		}
+		qids = append(qids, q)
+	}
+
+	if len(qids) == len(names) {
+		if newN == n {
+			f.path = p
+		} else {
+			c.fids[newN] = &fid{path: p, root: f.root}
+		}
+	}
+	r.u16(uint16(len(qids)))
+	for _, q := range qids {
+		r.qid(q)
+	}
+	return nil
+}
+
+// maxData is the most data a Rread or Rwrite may carry.
+func (c *conn) maxData() uint32 {
+	return c.msize - headerSize - 4
+}
+
+func (c *conn) read(d *decoder, r *encoder) error {
+	n, off, count := d.u32(), d.u64(), d.u32()
+	if d.err != nil {
+		return d.err
+	}
+	f, err := c.fid(n)
+	if err != nil {
+		return err
+	}
+	if count > c.maxData() {
+		count = c.maxData()
+	}
+	if x := f.xattr; x != nil {
+		if x.create {
+			return syscall.EBADF
+		}
+		var b []byte
+		if off < uint64(len(x.value)) {
+			b = x.value[off:]
+		}
+		if uint32(len(b)) > count {
+			b = b[:count]
+		}
+		r.u32(uint32(len(b)))
+		r.b = append(r.b, b...)
+		return nil
+	}
+	if f.file == nil {
+		return syscall.EBADF
+	}
+	b := make([]byte, count)
+	read, err := f.file.ReadAt(b, int64(off))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	r.u32(uint32(read))
+	r.b = append(r.b, b[:read]...)
+	return nil
+}
+
+func (c *conn) write(d *decoder, r *encoder) error {
+	n, off, count := d.u32(), d.u64(), d.u32()
+	if d.err != nil {
+		return d.err
+	}
+	if count > c.maxData() {
+		return syscall.EINVAL
+	}
+	if int(count) > len(d.b) {
+		return errShortMessage
+	}
+	b := d.next(int(count))
+	f, err := c.fid(n)
+	if err != nil {
+		return err
+	}
+	if x := f.xattr; x != nil {
+		if !x.create || off != uint64(len(x.value)) || off+uint64(count) > x.size {
+			return syscall.EINVAL
+		}
+		x.value = append(x.value, b...)
+		r.u32(count)
+		return nil
+	}
+	if f.file == nil {
+		return syscall.EBADF
+	}
+	var written int
+	if f.append {
+		written, err = f.file.Write(b)
+	} else {
+		written, err = f.file.WriteAt(b, int64(off))
+	}
+	if err != nil {
+		return err
+	}
+	r.u32(uint32(written))
+	return nil
+}
+
+func (c *conn) clunk(d *decoder) error {
+	n := d.u32()
+	if d.err != nil {
+		return d.err
+	}
+	f, err := c.fid(n)
+	if err != nil {
+		return err
+	}
+	delete(c.fids, n)
+	return c.clunkFid(f)
+}
+
+func (c *conn) remove(d *decoder) error {
+	n := d.u32()
+	if d.err != nil {
+		return d.err
+	}
+	f, err := c.fid(n)
+	if err != nil {
+		return err
+	}
+	// The fid is clunked even if the file cannot be removed.
+	delete(c.fids, n)
+	c.clunkFid(f)
+	if f.path == f.root {
+		return syscall.EBUSY
+	}
+	if err := c.s.fs.Remove(c.name(f.path)); err != nil {
+		return err
+	}
+	c.s.forgetQids(f.path)
+	return nil
+}
+
+// v9fsMagic is the file system type Rstatfs reports, that of v9fs.
+const v9fsMagic = 0x01021997
+
+func (c *conn) statfs(d *decoder, r *encoder) error {
+	n := d.u32()
+	if d.err != nil {
+		return d.err
+	}
+	if _, err := c.fid(n); err != nil {
+		return err
+	}
+	// The size of an Fs is unknown, and reported as empty.
+	r.u32(v9fsMagic)
+	r.u32(blockSize)
+	for i := 0; i < 6; i++ {
+		r.u64(0) // blocks, bfree, bavail, files, ffree and fsid
+	}
+	r.u32(255)
+	return nil
+}
+
+// The Linux open flags of Tlopen and Tlcreate.
+const (
+	lOWronly = 01
+	lORdwr   = 02
+	lOCreat  = 0o100
+	lOExcl   = 0o200
+	lOTrunc  = 0o1000
+	lOAppend = 0o2000
+)
+
+// openFlag returns the flag of OpenFile for the Linux open flags fl.
+func openFlag(fl uint32) int {
+	var flag int
+	switch fl & 3 {
+	case lOWronly:
+		flag = os.O_WRONLY
+	case lORdwr:
+		flag = os.O_RDWR
+	default:
+		flag = os.O_RDONLY
+	}
+	if fl&lOCreat != 0 {
+		flag |= os.O_CREATE
+	}
+	if fl&lOExcl != 0 {
+		flag |= os.O_EXCL
+	}
+	if fl&lOTrunc != 0 {
+		flag |= os.O_TRUNC
+	}
+	if fl&lOAppend != 0 {
+		flag |= os.O_APPEND
+	}
+	return flag
+}
+
+func (c *conn) lopen(d *decoder, r *encoder) error {
+	n, fl := d.u32(), d.u32()
+	if d.err != nil {
+		return d.err
+	}
+	f, err := c.fid(n)
+	if err != nil {
+		return err
+	}
+	if f.file != nil || f.xattr != nil {
+		return syscall.EBADF
+	}
+	fi, err := c.lstat(f.path)
+	if err != nil {
+		return err
+	}
+	name := c.name(f.path)
+	if fi.IsDir() {
+		if fl&3 != 0 {
+			return syscall.EISDIR
+		}
+		f.file, err = c.s.fs.Open(name)
+	} else {
+		f.file, err = c.s.fs.OpenFile(name, openFlag(fl&^(lOCreat|lOExcl)), 0)
+	}
+	if err != nil {
+		return err
+	}
+	f.append = fl&lOAppend != 0
+	f.entries = nil
+	r.qid(c.s.qid(f.path, fi))
+	r.u32(0) // the iounit, msize less the header of Twrite
+	return nil
+}
+
+func (c *conn) lcreate(d *decoder, r *encoder) error {
+	n, name, fl, mode, _ := d.u32(), d.str(), d.u32(), d.u32(), d.u32()
+	if d.err != nil {
+		return d.err
+	}
+	p, err := c.child(n, name)
+	if err != nil {
+		return err
+	}
+	f := c.fids[n]
+	if f.file != nil || f.xattr != nil {
+		return syscall.EBADF
+	}
+	file, err := c.s.fs.OpenFile(c.name(p), openFlag(fl)|os.O_CREATE, fileMode(mode))
+	if err != nil {
+		return err
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.path, f.file, f.append = p, file, fl&lOAppend != 0
+	r.qid(c.s.qid(p, fi))
+	r.u32(0)
+	return nil
+}
+
+func (c *conn) symlink(d *decoder, r *encoder) error {
+	n, name, target, _ := d.u32(), d.str(), d.str(), d.u32()
+	if d.err != nil {
+		return d.err
+	}
+	p, err := c.child(n, name)
+	if err != nil {
+		return err
+	}
+	l, ok := c.s.fs.(afero.Linker)
+	if !ok {
+		return afero.ErrNoSymlink
+	}
+	if err := l.SymlinkIfPossible(target, c.name(p)); err != nil {
+		return err
+	}
+	q, err := c.qid(p)
+	if err != nil {
+		return err
+	}
+	r.qid(q)
+	return nil
+}
+
+func (c *conn) rename(d *decoder) error {
+	n, dir, name := d.u32(), d.u32(), d.str()
+	if d.err != nil {
+		return d.err
+	}
+	f, err := c.fid(n)
+	if err != nil {
+		return err
+	}
+	newpath, err := c.child(dir, name)
+	if err != nil {
+		return err
+	}
+	if err := c.move(f.path, newpath); err != nil {
+		return err
+	}
+	f.path = newpath
+	return nil
+}
+
+func (c *conn) renameat(d *decoder) error {
+	olddir, oldname, newdir, newname := d.u32(), d.str(), d.u32(), d.str()
+	if d.err != nil {
+		return d.err
+	}
+	oldpath, err := c.child(olddir, oldname)
+	if err != nil {
+		return err
+	}
+	newpath, err := c.child(newdir, newname)
+	if err != nil {
+		return err
+	}
+	return c.move(oldpath, newpath)
+}
+
+// move renames oldpath to newpath, and the fids below it.
+func (c *conn) move(oldpath, newpath string) error {
+	if err := c.s.fs.Rename(c.name(oldpath), c.name(newpath)); err != nil {
+		return err
+	}
+	c.s.moveQids(oldpath, newpath)
+	for _, f := range c.fids {
+		if rest, ok := below(oldpath, f.path); ok {
+			f.path = newpath + rest
+		}
+	}
+	return nil
+}
+
+func (c *conn) readlink(d *decoder, r *encoder) error {
+	n := d.u32()
+	if d.err != nil {
+		return d.err
+	}
+	f, err := c.fid(n)
+	if err != nil {
+		return err
+	}
+	l, ok := c.s.fs.(afero.LinkReader)
+	if !ok {
+		return afero.ErrNoReadlink
+	}
+	target, err := l.ReadlinkIfPossible(c.name(f.path))
+	if err != nil {
+		return err
+	}
+	r.str(target)
+	return nil
+}
+
+// blockSize is the block size reported by Rgetattr and Rstatfs.
+const blockSize = 4096
+
+// The bits of the mode of Rgetattr.
+const (
+	sIFDIR = 0o040000
+	sIFREG = 0o100000
+	sIFLNK = 0o120000
+	sISUID = 0o4000
+	sISGID = 0o2000
+	sISVTX = 0o1000
+)
+
+// unixMode returns the Linux mode of m.
+func unixMode(m os.FileMode) uint32 {
+	mode := uint32(m.Perm())
+	switch {
+	case m.IsDir():
+		mode |= sIFDIR
+	case m&os.ModeSymlink != 0:
+		mode |= sIFLNK
+	default:
+		mode |= sIFREG
+	}
+	if m&os.ModeSetuid != 0 {
+		mode |= sISUID
+	}
+	if m&os.ModeSetgid != 0 {
+		mode |= sISGID
+	}
+	if m&os.ModeSticky != 0 {
+		mode |= sISVTX
+	}
+	return mode
+}
+
+// fileMode returns the permissions of the Linux mode m.
+func fileMode(m uint32) os.FileMode {
+	mode := os.FileMode(m & 0o777)
+	if m&sISUID != 0 {
+		mode |= os.ModeSetuid
+	}
+	if m&sISGID != 0 {
+		mode |= os.ModeSetgid
+	}
+	if m&sISVTX != 0 {
+		mode |= os.ModeSticky
+	}
+	return mode
+}
+
+// owner returns the user and group id of fi, where the Fs keeps them.
+func owner(fi os.FileInfo) (uid, gid uint32) {
+	if mfi, ok := fi.(*mem.FileInfo); ok {
+		u, g := mem.Owner(mfi.FileData)
+		return uint32(u), uint32(g)
+	}
+	return sysOwner(fi)
+}
+
+// times returns the access and change times of fi, or its modification time
+// where the Fs does not keep them.
+func times(fi os.FileInfo) (atime, ctime time.Time) {
+	atime, ctime = fi.ModTime(), fi.ModTime()
+	if a, ok := fi.(interface{ AccessTime() time.Time }); ok && !a.AccessTime().IsZero() {
+		atime = a.AccessTime()
+	}
+	if c, ok := fi.(interface{ ChangeTime() time.Time }); ok && !c.ChangeTime().IsZero() {
+		ctime = c.ChangeTime()
+	}
+	return atime, ctime
+}
+
+// getattrBasic is the mask of the attributes Rgetattr reports: all of
+// P9_GETATTR_BASIC.
+const getattrBasic = 0x7ff
+
+func (c *conn) getattr(d *decoder, r *encoder) error {
+	n, _ := d.u32(), d.u64()
+	if d.err != nil {
+		return d.err
+	}
+	f, err := c.fid(n)
+	if err != nil {
+		return err
+	}
+	fi, err := c.lstat(f.path)
+	if err != nil {
+		return err
+	}
+	uid, gid := owner(fi)
+	atime, ctime := times(fi)
+	var nlink uint64 = 1
+	if fi.IsDir() {
+		nlink = 2
+	}
+	r.u64(getattrBasic)
+	r.qid(c.s.qid(f.path, fi))
+	r.u32(unixMode(fi.Mode()))
+	r.u32(uid)
+	r.u32(gid)
+	r.u64(nlink)
+	r.u64(0) // rdev
+	r.u64(uint64(fi.Size()))
+	r.u64(blockSize)
+	r.u64(uint64(fi.Size()+511) / 512)
+	for _, t := range []time.Time{atime, fi.ModTime(), ctime, {}} {
+		if t.IsZero() {
+			r.u64(0)
+			r.u64(0)
+			continue
+		}
+		r.u64(uint64(t.Unix()))
+		r.u64(uint64(t.Nanosecond()))
+	}
+	r.u64(0) // gen
+	r.u64(0) // data_version
+	return nil
+}
+
+// The valid bits of Tsetattr.
+const (
+	setattrMode     = 0x1
+	setattrUID      = 0x2
+	setattrGID      = 0x4
+	setattrSize     = 0x8
+	setattrAtime    = 0x10
+	setattrMtime    = 0x20
+	setattrAtimeSet = 0x80
+	setattrMtimeSet = 0x100
+)
+
+func (c *conn) setattr(d *decoder) error {
+	n, valid, mode, uid, gid, size := d.u32(), d.u32(), d.u32(), d.u32(), d.u32(), d.u64()
+	atime := time.Unix(int64(d.u64()), int64(d.u64()))
+	mtime := time.Unix(int64(d.u64()), int64(d.u64()))
+	if d.err != nil {
+		return d.err
+	}
+	f, err := c.fid(n)
+	if err != nil {
+		return err
+	}
+	name := c.name(f.path)
+	fi, err := c.lstat(f.path)
+	if err != nil {
+		return err
+	}
+
+	if valid&setattrMode != 0 {
+		if err := c.s.fs.Chmod(name, fileMode(mode)); err != nil {
+			return err
+		}
+	}
+	if valid&(setattrUID|setattrGID) != 0 {
+		oldUID, oldGID := owner(fi)
+		if valid&setattrUID == 0 {
+			uid = oldUID
+		}
+		if valid&setattrGID == 0 {
+			gid = oldGID
+		}
+		if err := c.s.fs.Chown(name, int(uid), int(gid)); err != nil {
+			return err
+		}
+	}
+	if valid&setattrSize != 0 {
+		if err := c.truncate(f, int64(size)); err != nil {
+			return err
+		}
+	}
+	if valid&(setattrAtime|setattrMtime) != 0 {
+		now := time.Now()
+		oldAtime, _ := times(fi)
+		switch {
+		case valid&setattrAtime == 0:
+			atime = oldAtime
+		case valid&setattrAtimeSet == 0:
+			atime = now
+		}
+		switch {
+		case valid&setattrMtime == 0:
+			mtime = fi.ModTime()
+		case valid&setattrMtimeSet == 0:
+			mtime = now
+		}
+		if err := c.s.fs.Chtimes(name, atime, mtime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// truncate changes the size of the file of f, through its open file if it
+// has one.
+func (c *conn) truncate(f *fid, size int64) error {
+	if f.file != nil {
+		if err := f.file.Truncate(size); err == nil {
+			return nil
+		}
+	}
+	file, err := c.s.fs.OpenFile(c.name(f.path), os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	if err := file.Truncate(size); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func (c *conn) xattrwalk(d *decoder, r *encoder) error {
+	n, newN, name := d.u32(), d.u32(), d.str()
+	if d.err != nil {
+		return d.err
+	}
+	f, err := c.fid(n)
+	if err != nil {
+		return err
+	}
+	if err := c.newFid(newN); err != nil {
+		return err
+	}
+	var value []byte
+	if name == "" {
+		// the names of the attributes, each ended by a NUL
+		names, err := afero.ListXattr(c.s.fs, c.name(f.path))
+		if err != nil {
+			return err
+		}
+		for _, attr := range names {
+			value = append(append(value, attr...), 0)
+		}
+	} else {
+		value, err = afero.GetXattr(c.s.fs, c.name(f.path), name)
+		if err != nil {
+			return err
+		}
+	}
+	c.fids[newN] = &fid{path: f.path, root: f.root, xattr: &xattr{name: name, value: value}}
+	r.u64(uint64(len(value)))
+	return nil
+}
+
+func (c *conn) xattrcreate(d *decoder) error {
+	n, name, size, _ := d.u32(), d.str(), d.u64(), d.u32()
+	if d.err != nil {
+		return d.err
+	}
+	f, err := c.fid(n)
+	if err != nil {
+		return err
+	}
+	if f.file != nil || f.xattr != nil || name == "" || size > uint64(c.msize)*16 {
+		return syscall.EINVAL
+	}
+	if _, ok := c.s.fs.(afero.Xattrer); !ok {
+		return afero.ErrNoXattr
+	}
+	f.xattr = &xattr{name: name, create: true, size: size}
+	return nil
+}
+
+// The types of the entries of Rreaddir.
+const (
+	dtDir = 4
+	dtReg = 8
+	dtLnk = 10
+)
+
+func direntType(m os.FileMode) uint8 {
+	switch {
+	case m.IsDir():
+		return dtDir
+	case m&os.ModeSymlink != 0:
+		return dtLnk
+	}
+	return dtReg
+}
+
+func (c *conn) readdir(d *decoder, r *encoder) error {
+	n, off, count := d.u32(), d.u64(), d.u32()
+	if d.err != nil {
+		return d.err
+	}
+	f, err := c.fid(n)
+	if err != nil {
+		return err
+	}
+	if f.file == nil {
+		return syscall.EBADF
+	}
+	if off == 0 || f.entries == nil {
+		if f.entries, err = c.list(f); err != nil {
+			return err
+		}
+	}
+	if count > c.maxData() {
+		count = c.maxData()
+	}
+
+	data := &encoder{}
+	// The offset of an entry is that of the one after it.
+	for i := off; i < uint64(len(f.entries)); i++ {
+		e := f.entries[i]
+		if uint32(len(data.b)+13+8+1+2+len(e.name)) > count {
+			break
+		}
+		data.qid(e.qid)
+		data.u64(i + 1)
+		data.u8(e.typ)
+		data.str(e.name)
+	}
+	r.u32(uint32(len(data.b)))
+	r.b = append(r.b, data.b...)
+	return nil
+}
+
+// list reads the entries of the directory of f, with "." and "..".
+func (c *conn) list(f *fid) ([]dirent, error) {
+	fis, err := afero.ReadDir(c.s.fs, c.name(f.path))
+	if err != nil {
+		return nil, err
+	}
+	parent := f.path
+	if parent != f.root {
+		parent = path.Dir(parent)
+	}
+	entries := make([]dirent, 0, len(fis)+2)
+	for _, dot := range []struct{ name, path string }{{".", f.path}, {"..", parent}} {
+		q, err := c.qid(dot.path)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, dirent{q, dtDir, dot.name})
+	}
+	for _, fi := range fis {
+		q := c.s.qid(path.Join(f.path, fi.Name()), fi)
+		entries = append(entries, dirent{q, direntType(fi.Mode()), fi.Name()})
+	}
+	return entries, nil
+}
+
+func (c *conn) fsync(d *decoder) error {
+	n, _ := d.u32(), d.u32()
+	if d.err != nil {
+		return d.err
+	}
+	f, err := c.fid(n)
+	if err != nil {
+		return err
+	}
+	if f.file == nil {
+		return syscall.EBADF
+	}
+	return f.file.Sync()
+}
+
+// Locks are not kept: every Tlock succeeds, and Tgetlock reports the range
+// unlocked.
+const (
+	lockSuccess = 0
+	lockUnlck   = 2
+)
+
+func (c *conn) lock(d *decoder, r *encoder) error {
+	n, _, _, _, _, _, _ := d.u32(), d.u8(), d.u32(), d.u64(), d.u64(), d.u32(), d.str()
+	if d.err != nil {
+		return d.err
+	}
+	if _, err := c.fid(n); err != nil {
+		return err
+	}
+	r.u8(lockSuccess)
+	return nil
+}
+
+func (c *conn) getlock(d *decoder, r *encoder) error {
+	n, _, start, length, proc, client := d.u32(), d.u8(), d.u64(), d.u64(), d.u32(), d.str()
+	if d.err != nil {
+		return d.err
+	}
+	if _, err := c.fid(n); err != nil {
+		return err
+	}
+	r.u8(lockUnlck)
+	r.u64(start)
+	r.u64(length)
+	r.u32(proc)
+	r.str(client)
+	return nil
+}
+
+func (c *conn) link(d *decoder) error {
+	dir, n, name := d.u32(), d.u32(), d.str()
+	if d.err != nil {
+		return d.err
+	}
+	f, err := c.fid(n)
+	if err != nil {
+		return err
+	}
+	p, err := c.child(dir, name)
+	if err != nil {
+		return err
+	}
+	l, ok := c.s.fs.(afero.HardLinker)
+	if !ok {
+		return afero.ErrNoLink
+	}
+	return l.LinkIfPossible(c.name(f.path), c.name(p))
+}
+
+func (c *conn) mkdir(d *decoder, r *encoder) error {
+	dir, name, mode, _ := d.u32(), d.str(), d.u32(), d.u32()
+	if d.err != nil {
+		return d.err
+	}
+	p, err := c.child(dir, name)
+	if err != nil {
+		return err
+	}
+	if err := c.s.fs.Mkdir(c.name(p), fileMode(mode)); err != nil {
+		return err
+	}
+	q, err := c.qid(p)
+	if err != nil {
+		return err
+	}
+	r.qid(q)
+	return nil
+}
+
+// atRemovedir is the flag of Tunlinkat removing a directory.
+const atRemovedir = 0x200
+
+func (c *conn) unlinkat(d *decoder) error {
+	dir, name, flags := d.u32(), d.str(), d.u32()
+	if d.err != nil {
+		return d.err
+	}
+	p, err := c.child(dir, name)
+	if err != nil {
+		return err
+	}
+	fi, err := c.lstat(p)
+	if err != nil {
+		return err
+	}
+	switch {
+	case flags&atRemovedir != 0 && !fi.IsDir():
+		return syscall.ENOTDIR
+	case flags&atRemovedir == 0 && fi.IsDir():
+		return syscall.EISDIR
+	}
+	if err := c.s.fs.Remove(c.name(p)); err != nil {
+		return err
+	}
+	c.s.forgetQids(p)
+	return nil
+}
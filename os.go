@@ -33,6 +33,10 @@ func NewOsFs() Fs {
 
 func (OsFs) Name() string { return "OsFs" }
 
+func (OsFs) Capabilities() Capability {
+	return CapLstat | CapSymlink | CapReadlink | CapAtomicRename | CapHardLink | osCapLock | osCapXattr | CapReadAt
+}
+
 func (OsFs) Create(name string) (File, error) {
 	f, e := os.Create(name)
 	if f == nil {
@@ -111,3 +115,7 @@ func (OsFs) SymlinkIfPossible(oldname, newname string) error {
 func (OsFs) ReadlinkIfPossible(name string) (string, error) {
 	return os.Readlink(name)
 }
+
+func (OsFs) LinkIfPossible(oldname, newname string) error {
+	return os.Link(oldname, newname)
+}
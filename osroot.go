@@ -0,0 +1,153 @@
+//go:build go1.25
+
+package afero
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	_ Lstater    = (*OsRootFs)(nil)
+	_ Symlinker  = (*OsRootFs)(nil)
+	_ HardLinker = (*OsRootFs)(nil)
+)
+
+// OsRootFs is an Fs on a directory of the OS file system which no name can
+// leave, not even through symlinks or a directory renamed concurrently.
+// It is built on os.Root, which resolves every name relative to the open
+// directory in the kernel, with openat and friends.
+//
+// Names are relative to the directory, "/" is the directory itself, like
+// in a BasePathFs. Names with ".." leading outside the directory, and
+// symlinks pointing outside of it, fail with an error. Absolute symlinks
+// always count as pointing outside.
+//
+// Built with Go older than 1.25, whose os.Root lacks operations, an
+// OsRootFs is a hardened BasePathFs over an OsFs, with the weaker
+// guarantees documented at NewHardenedBasePathFs.
+type OsRootFs struct {
+	root *os.Root
+	dir  string
+}
+
+// NewOsRootFs opens dir as the root of an OsRootFs. The directory stays
+// open until Close is called.
+func NewOsRootFs(dir string) (*OsRootFs, error) {
+	dir = filepath.Clean(dir)
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &OsRootFs{root: root, dir: dir}, nil
+}
+
+// hardenedRoot returns the OsRootFs a hardened BasePathFs over source uses
+// for the base path, or nil.
+func hardenedRoot(source Fs, path string) *OsRootFs {
+	switch source.(type) {
+	case *OsFs, OsFs:
+		r, err := NewOsRootFs(path)
+		if err != nil {
+			return nil
+		}
+		return r
+	}
+	return nil
+}
+
+// rootName returns name relative to the root, as os.Root expects it.
+func rootName(name string) string {
+	name = strings.TrimLeft(filepath.Clean(name), "/"+string(filepath.Separator))
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+func (r *OsRootFs) Capabilities() Capability {
+	return CapLstat | CapSymlink | CapReadlink | CapAtomicRename | CapHardLink | CapReadAt
+}
+
+// Close closes the directory. The files opened through r stay usable.
+func (r *OsRootFs) Close() error {
+	return r.root.Close()
+}
+
+func (r *OsRootFs) Name() string { return "OsRootFs" }
+
+func (r *OsRootFs) file(f *os.File, err error) (File, error) {
+	if err != nil {
+		return nil, err
+	}
+	return &BasePathFile{File: f, path: r.dir}, nil
+}
+
+func (r *OsRootFs) Create(name string) (File, error) {
+	return r.file(r.root.Create(rootName(name)))
+}
+
+func (r *OsRootFs) Mkdir(name string, perm os.FileMode) error {
+	return r.root.Mkdir(rootName(name), perm)
+}
+
+func (r *OsRootFs) MkdirAll(path string, perm os.FileMode) error {
+	return r.root.MkdirAll(rootName(path), perm)
+}
+
+func (r *OsRootFs) Open(name string) (File, error) {
+	return r.file(r.root.Open(rootName(name)))
+}
+
+func (r *OsRootFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	return r.file(r.root.OpenFile(rootName(name), flag, perm))
+}
+
+func (r *OsRootFs) Remove(name string) error {
+	return r.root.Remove(rootName(name))
+}
+
+func (r *OsRootFs) RemoveAll(path string) error {
+	return r.root.RemoveAll(rootName(path))
+}
+
+func (r *OsRootFs) Rename(oldname, newname string) error {
+	return r.root.Rename(rootName(oldname), rootName(newname))
+}
+
+func (r *OsRootFs) Stat(name string) (os.FileInfo, error) {
+	return r.root.Stat(rootName(name))
+}
+
+func (r *OsRootFs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	fi, err := r.root.Lstat(rootName(name))
+	return fi, true, err
+}
+
+func (r *OsRootFs) Chmod(name string, mode os.FileMode) error {
+	return r.root.Chmod(rootName(name), mode)
+}
+
+func (r *OsRootFs) Chown(name string, uid, gid int) error {
+	return r.root.Chown(rootName(name), uid, gid)
+}
+
+func (r *OsRootFs) Chtimes(name string, atime, mtime time.Time) error {
+	return r.root.Chtimes(rootName(name), atime, mtime)
+}
+
+// SymlinkIfPossible creates newname pointing to oldname, which is stored
+// as given. Following it fails if it leads outside the root.
+func (r *OsRootFs) SymlinkIfPossible(oldname, newname string) error {
+	return r.root.Symlink(oldname, rootName(newname))
+}
+
+func (r *OsRootFs) ReadlinkIfPossible(name string) (string, error) {
+	return r.root.Readlink(rootName(name))
+}
+
+func (r *OsRootFs) LinkIfPossible(oldname, newname string) error {
+	return r.root.Link(rootName(oldname), rootName(newname))
+}
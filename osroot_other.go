@@ -0,0 +1,40 @@
+//go:build !go1.25
+
+package afero
+
+import (
+	"os"
+	"syscall"
+)
+
+// OsRootFs is an Fs on a directory of the OS file system which names
+// cannot leave. Built with Go 1.25 or later it uses os.Root; this build
+// falls back to a hardened BasePathFs over an OsFs, see
+// NewHardenedBasePathFs.
+type OsRootFs struct {
+	*BasePathFs
+}
+
+// NewOsRootFs returns an OsRootFs for dir, which must be a directory.
+func NewOsRootFs(dir string) (*OsRootFs, error) {
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return nil, &os.PathError{Op: "open", Path: dir, Err: syscall.ENOTDIR}
+	}
+	return &OsRootFs{&BasePathFs{source: NewOsFs(), path: dir, hardened: true}}, nil
+}
+
+// hardenedRoot returns nil, a hardened BasePathFs resolves names itself.
+func hardenedRoot(source Fs, path string) *OsRootFs {
+	return nil
+}
+
+// Close does nothing, no directory is kept open.
+func (r *OsRootFs) Close() error {
+	return nil
+}
+
+func (r *OsRootFs) Name() string { return "OsRootFs" }
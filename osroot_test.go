@@ -0,0 +1,107 @@
+package afero
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOsRootFs(t *testing.T) {
+	dir := t.TempDir()
+	jail := filepath.Join(dir, "jail")
+	if err := os.MkdirAll(filepath.Join(dir, "outside"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "outside", "secret"), []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(jail, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("../outside", filepath.Join(jail, "out")); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+
+	fs, err := NewOsRootFs(jail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.Close()
+
+	if err := fs.MkdirAll("/dir/sub", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(fs, "/dir/file", []byte("data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(filepath.Join(jail, "dir", "file")); err != nil || string(data) != "data" {
+		t.Errorf("file on disk = %q, %v", data, err)
+	}
+	f, err := fs.Open("/dir/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := filepath.ToSlash(f.Name()); name != "/dir/file" {
+		t.Errorf("Name = %q, want it relative to the root", name)
+	}
+	f.Close()
+	if err := fs.Rename("/dir/file", "/dir/sub/moved"); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := fs.Stat("dir/sub/moved"); err != nil || fi.Size() != 4 {
+		t.Errorf("Stat after Rename = %v, %v", fi, err)
+	}
+	if err := fs.SymlinkIfPossible("dir/sub/moved", "/link"); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ReadFile(fs, "/link"); err != nil || string(data) != "data" {
+		t.Errorf("ReadFile through a link = %q, %v", data, err)
+	}
+
+	for _, name := range []string{"/out/secret", "../outside/secret", "/dir/../../outside/secret"} {
+		if data, err := ReadFile(fs, name); err == nil {
+			t.Errorf("ReadFile(%q) = %q, the root was left", name, data)
+		}
+	}
+	if _, err := fs.Create("/out/new"); err == nil {
+		t.Error("Create through an escaping link succeeded")
+	}
+	if fi, _, err := fs.LstatIfPossible("/out"); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("Lstat of the escaping link = %v, %v", fi, err)
+	}
+	if target, err := fs.ReadlinkIfPossible("/out"); err != nil || target != "../outside" {
+		t.Errorf("Readlink = %q, %v", target, err)
+	}
+	if err := fs.RemoveAll("/dir"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "outside", "secret")); err != nil {
+		t.Errorf("the file outside the root is gone: %v", err)
+	}
+}
+
+func TestHardenedBasePathFsOverOsFs(t *testing.T) {
+	dir := t.TempDir()
+	jail := filepath.Join(dir, "jail")
+	os.MkdirAll(filepath.Join(jail, "data"), 0o755)
+	os.WriteFile(filepath.Join(jail, "data", "file"), []byte("data"), 0o644)
+	os.WriteFile(filepath.Join(dir, "secret"), []byte("secret"), 0o644)
+	if err := os.Symlink("..", filepath.Join(jail, "up")); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+	os.Symlink("data", filepath.Join(jail, "rel"))
+
+	bp := NewHardenedBasePathFs(NewOsFs(), jail)
+	if data, err := ReadFile(bp, "/rel/file"); err != nil || string(data) != "data" {
+		t.Errorf("ReadFile through a link = %q, %v", data, err)
+	}
+	if _, err := ReadFile(bp, "/up/secret"); err == nil {
+		t.Error("ReadFile through an escaping link succeeded")
+	}
+	if err := bp.Rename("/data/file", "/moved"); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(filepath.Join(jail, "moved")); err != nil || string(data) != "data" {
+		t.Errorf("renamed file on disk = %q, %v", data, err)
+	}
+}
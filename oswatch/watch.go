@@ -0,0 +1,193 @@
+// Package oswatch watches the file system of the operating system with
+// fsnotify. Importing it makes afero.NewWatcher work for afero.OsFs:
+//
+//	import _ "github.com/spf13/afero/oswatch"
+package oswatch
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/spf13/afero"
+)
+
+func init() {
+	afero.RegisterOsWatcher(New)
+}
+
+// roots is a set of watched names.
+type roots map[string]bool
+
+// covers reports whether name is one of the roots or below one of them.
+func (r roots) covers(name string) bool {
+	for root := range r {
+		if name == root || strings.HasPrefix(name, strings.TrimSuffix(root, string(filepath.Separator))+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// watcher watches the file system with fsnotify, adding the directories
+// below the watched names itself.
+type watcher struct {
+	w      *fsnotify.Watcher
+	events chan afero.WatchEvent
+	errors chan error
+	done   chan struct{}
+
+	closeOnce sync.Once
+
+	mu    sync.Mutex
+	roots roots
+	dirs  map[string]bool
+}
+
+// New returns a Watcher for the file system of the operating system.
+func New() (afero.Watcher, error) {
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	w := &watcher{
+		w:      fw,
+		events: make(chan afero.WatchEvent),
+		errors: make(chan error),
+		done:   make(chan struct{}),
+		roots:  make(roots),
+		dirs:   make(map[string]bool),
+	}
+	go w.run()
+	return w, nil
+}
+
+func (w *watcher) Events() <-chan afero.WatchEvent { return w.events }
+
+func (w *watcher) Errors() <-chan error { return w.errors }
+
+func (w *watcher) Add(name string) error {
+	name = filepath.Clean(name)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.addTree(name); err != nil {
+		return err
+	}
+	w.roots[name] = true
+	return nil
+}
+
+// addTree watches root and the directories below it. The caller must hold
+// w.mu.
+func (w *watcher) addTree(root string) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if (!info.IsDir() && path != root) || w.dirs[path] {
+			return nil
+		}
+		if err := w.w.Add(path); err != nil {
+			return err
+		}
+		w.dirs[path] = true
+		return nil
+	})
+}
+
+func (w *watcher) Remove(name string) error {
+	name = filepath.Clean(name)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.roots[name] {
+		return &os.PathError{Op: "unwatch", Path: name, Err: os.ErrNotExist}
+	}
+	delete(w.roots, name)
+	for dir := range w.dirs {
+		if (roots{name: true}).covers(dir) && !w.roots.covers(dir) {
+			w.w.Remove(dir)
+			delete(w.dirs, dir)
+		}
+	}
+	return nil
+}
+
+func (w *watcher) Close() error {
+	w.closeOnce.Do(func() { close(w.done) })
+	return w.w.Close()
+}
+
+func (w *watcher) run() {
+	defer close(w.events)
+	defer close(w.errors)
+	events, errs := w.w.Events, w.w.Errors
+	for events != nil || errs != nil {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			w.update(e)
+			select {
+			case w.events <- afero.WatchEvent{Name: e.Name, Op: watchOp(e.Op)}:
+			case <-w.done:
+				return
+			}
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			select {
+			case w.errors <- err:
+			case <-w.done:
+				return
+			}
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// update keeps the watched directories in sync with e.
+func (w *watcher) update(e fsnotify.Event) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if e.Has(fsnotify.Remove) || e.Has(fsnotify.Rename) {
+		for dir := range w.dirs {
+			if (roots{e.Name: true}).covers(dir) {
+				delete(w.dirs, dir)
+			}
+		}
+	}
+	if e.Has(fsnotify.Create) && w.roots.covers(e.Name) {
+		if fi, err := os.Lstat(e.Name); err == nil && fi.IsDir() {
+			// The directory may already be gone again, which is
+			// reported by its own event.
+			w.addTree(e.Name)
+		}
+	}
+}
+
+func watchOp(op fsnotify.Op) afero.WatchOp {
+	var wop afero.WatchOp
+	for _, m := range []struct {
+		from fsnotify.Op
+		to   afero.WatchOp
+	}{
+		{fsnotify.Create, afero.WatchCreate},
+		{fsnotify.Write, afero.WatchWrite},
+		{fsnotify.Remove, afero.WatchRemove},
+		{fsnotify.Rename, afero.WatchRename},
+		{fsnotify.Chmod, afero.WatchChmod},
+	} {
+		if op&m.from != 0 {
+			wop |= m.to
+		}
+	}
+	return wop
+}
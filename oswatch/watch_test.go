@@ -0,0 +1,57 @@
+package oswatch
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// nextEvent returns the next event for name, skipping others.
+func nextEvent(t *testing.T, w afero.Watcher, name string) afero.WatchEvent {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case e := <-w.Events():
+			if e.Name == name {
+				return e
+			}
+		case err := <-w.Errors():
+			t.Fatal(err)
+		case <-timeout:
+			t.Fatalf("no event for %s", name)
+		}
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	dir := t.TempDir()
+	fs := afero.NewOsFs()
+	w, err := afero.NewWatcher(fs)
+	if err != nil {
+		t.Skip("no OS file watching:", err)
+	}
+	defer w.Close()
+	if err := w.Add(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	sub := filepath.Join(dir, "sub")
+	if err := fs.Mkdir(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if e := nextEvent(t, w, sub); e.Op&afero.WatchCreate == 0 {
+		t.Errorf("got %v, want CREATE", e)
+	}
+
+	// New directories are watched as well.
+	file := filepath.Join(sub, "file")
+	if err := afero.WriteFile(fs, file, []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if e := nextEvent(t, w, file); e.Op&afero.WatchCreate == 0 {
+		t.Errorf("got %v, want CREATE", e)
+	}
+}
@@ -16,9 +16,16 @@
 package afero
 
 import (
+	"context"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
+	"sync"
+
+	"github.com/spf13/afero/internal/common"
+	"github.com/spf13/afero/mem"
 )
 
 // readDirNames reads the directory named by dirname and returns
@@ -104,3 +111,358 @@ func Walk(fs Fs, root string, walkFn filepath.WalkFunc) error {
 	}
 	return walk(fs, root, info, walkFn)
 }
+
+// WalkContext walks the file tree rooted at root like Walk. Directories are
+// opened through OpenFileContext if the Fs implements ContextFs, and the
+// walk stops with the error of ctx once it is done.
+func (a Afero) WalkContext(ctx context.Context, root string, walkFn filepath.WalkFunc) error {
+	return WalkContext(ctx, a.Fs, root, walkFn)
+}
+
+func WalkContext(ctx context.Context, fs Fs, root string, walkFn filepath.WalkFunc) error {
+	return Walk(contextFs{fs, ctx}, root, func(path string, info os.FileInfo, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		return walkFn(path, info, err)
+	})
+}
+
+// WalkOptions configures WalkWithOptions.
+type WalkOptions struct {
+	// FollowSymlinks visits symlinks as the files they point to, and walks
+	// the directories they point to. A directory reached through a symlink
+	// is only walked if it was not walked before, otherwise it is visited
+	// as the symlink itself, so symlink cycles end. Broken symlinks are
+	// visited as the symlink as well.
+	FollowSymlinks bool
+	// MaxDepth limits how deep the walk goes: the entries of root have
+	// depth 1, and directories at MaxDepth are visited but not read. 0 means
+	// no limit.
+	MaxDepth int
+	// OnError, if set, is called instead of walkFn with the errors of
+	// reading path. Returning nil goes on with the walk, filepath.SkipDir
+	// skips the rest of the directory and any other error stops the walk.
+	OnError func(path string, err error) error
+}
+
+// WalkWithOptions walks the file tree rooted at root like Walk, as
+// configured by opts. walkFn may also return filepath.SkipAll to stop the
+// walk without an error.
+func WalkWithOptions(fs Fs, root string, opts WalkOptions, walkFn filepath.WalkFunc) error {
+	w := &optionsWalk{fs: fs, opts: opts, fn: walkFn, walked: make(map[interface{}]bool)}
+	info, err := w.stat(root, nil)
+	if err != nil {
+		err = w.fail(root, nil, err)
+	} else {
+		err = w.walk(root, info, nil)
+	}
+	if err == filepath.SkipDir || err == filepath.SkipAll {
+		return nil
+	}
+	return err
+}
+
+func (a Afero) WalkWithOptions(root string, opts WalkOptions, walkFn filepath.WalkFunc) error {
+	return WalkWithOptions(a.Fs, root, opts, walkFn)
+}
+
+type optionsWalk struct {
+	fs   Fs
+	opts WalkOptions
+	fn   filepath.WalkFunc
+	// walked holds the keys of the directories walked so far.
+	walked map[interface{}]bool
+}
+
+// walk visits path and the files below it. parents are the directories
+// walked above it.
+func (w *optionsWalk) walk(path string, info os.FileInfo, parents []os.FileInfo) error {
+	if err := w.fn(path, info, nil); err != nil || !info.IsDir() {
+		if err == filepath.SkipDir && info.IsDir() {
+			err = nil
+		}
+		return err
+	}
+	if w.opts.MaxDepth > 0 && len(parents) >= w.opts.MaxDepth {
+		return nil
+	}
+	if key, ok := fileKey(info); ok {
+		w.walked[key] = true
+	}
+
+	names, err := readDirNames(w.fs, path)
+	if err != nil {
+		if err := w.fail(path, info, err); err != filepath.SkipDir {
+			return err
+		}
+		return nil
+	}
+	parents = append(parents, info)
+	for _, name := range names {
+		filename := filepath.Join(path, name)
+		fileInfo, err := w.stat(filename, parents)
+		if err != nil {
+			err = w.fail(filename, fileInfo, err)
+		} else {
+			err = w.walk(filename, fileInfo, parents)
+		}
+		if err == filepath.SkipDir {
+			// returned for a file, or an error, skipping the rest of path
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stat returns the FileInfo to visit path with: the file a symlink points
+// to if symlinks are followed and it is not a directory walked before,
+// otherwise the file at path.
+func (w *optionsWalk) stat(path string, parents []os.FileInfo) (os.FileInfo, error) {
+	info, err := lstatIfPossible(w.fs, path)
+	if err != nil || !w.opts.FollowSymlinks || info.Mode()&os.ModeSymlink == 0 {
+		return info, err
+	}
+	target, err := w.fs.Stat(path)
+	if err != nil || (target.IsDir() && w.wasWalked(target, parents)) {
+		return info, nil
+	}
+	return target, nil
+}
+
+// wasWalked reports whether the directory dir was walked before, or, if
+// the Fs does not tell the identity of its files, whether it is one of
+// parents.
+func (w *optionsWalk) wasWalked(dir os.FileInfo, parents []os.FileInfo) bool {
+	if key, ok := fileKey(dir); ok {
+		return w.walked[key]
+	}
+	for _, p := range parents {
+		if os.SameFile(p, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *optionsWalk) fail(path string, info os.FileInfo, err error) error {
+	if w.opts.OnError != nil {
+		return w.opts.OnError(path, err)
+	}
+	return w.fn(path, info, err)
+}
+
+// fileKey returns a comparable identity of the file fi describes, if it can
+// be told.
+func fileKey(fi os.FileInfo) (interface{}, bool) {
+	if mfi, ok := fi.(*mem.FileInfo); ok {
+		// directories have no hard links, so their FileData is unique
+		return mfi.FileData, true
+	}
+	return sysFileKey(fi)
+}
+
+// walkDir recursively descends path, calling fn.
+// adapted from https://golang.org/src/path/filepath/path.go
+func walkDir(fs Fs, path string, d fs.DirEntry, fn fs.WalkDirFunc) error {
+	if err := fn(path, d, nil); err != nil || !d.IsDir() {
+		if err == filepath.SkipDir && d.IsDir() {
+			// Successfully skipped directory.
+			err = nil
+		}
+		return err
+	}
+
+	entries, err := ReadDirEntries(fs, path)
+	if err != nil {
+		// Second call, to report ReadDir error.
+		err = fn(path, d, err)
+		if err != nil {
+			if err == filepath.SkipDir && d.IsDir() {
+				err = nil
+			}
+			return err
+		}
+	}
+
+	for _, d1 := range entries {
+		if err := walkDir(fs, filepath.Join(path, d1.Name()), d1, fn); err != nil {
+			if err == filepath.SkipDir {
+				break
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// WalkDir walks the file tree rooted at root, calling fn for each file or
+// directory in the tree, including root, with the semantics of
+// filepath.WalkDir. Entries come from ReadDirEntries, so unlike Walk it
+// does not Lstat every file; call DirEntry.Info when the FileInfo is
+// needed. The files are walked in lexical order and symbolic links are not
+// followed.
+func (a Afero) WalkDir(root string, fn fs.WalkDirFunc) error {
+	return WalkDir(a.Fs, root, fn)
+}
+
+func WalkDir(fs Fs, root string, fn fs.WalkDirFunc) error {
+	info, err := lstatIfPossible(fs, root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = walkDir(fs, root, common.FileInfoDirEntry{FileInfo: info}, fn)
+	}
+	if err == filepath.SkipDir || err == filepath.SkipAll {
+		return nil
+	}
+	return err
+}
+
+// WalkConcurrent walks the file tree rooted at root like Walk, but reads up
+// to workers directories at the same time, which pays off on backends where
+// every request has a high latency. fn is called concurrently and must be
+// safe for that; the entries of a single directory are still visited in
+// lexical order by one goroutine.
+//
+// The FileInfo passed to fn comes from Readdir instead of a Lstat per entry.
+// Returning filepath.SkipDir skips a directory, or for a file the remaining
+// entries of its directory, as with Walk. If fn returns other errors for
+// several paths, WalkConcurrent returns the one which comes first in walk
+// order, which is the error Walk would have returned.
+func WalkConcurrent(fs Fs, root string, workers int, fn filepath.WalkFunc) error {
+	if workers < 1 {
+		workers = 1
+	}
+	info, err := lstatIfPossible(fs, root)
+	if err != nil {
+		return fn(root, nil, err)
+	}
+	if err := fn(root, info, nil); err != nil {
+		if info.IsDir() && err == filepath.SkipDir {
+			return nil
+		}
+		return err
+	}
+	if !info.IsDir() {
+		return nil
+	}
+	w := &concurrentWalk{fs: fs, root: root, fn: fn, sem: make(chan struct{}, workers)}
+	w.spawn(root, info)
+	w.wg.Wait()
+	return w.err
+}
+
+func (a Afero) WalkConcurrent(root string, workers int, fn filepath.WalkFunc) error {
+	return WalkConcurrent(a.Fs, root, workers, fn)
+}
+
+type concurrentWalk struct {
+	fs   Fs
+	root string
+	fn   filepath.WalkFunc
+	sem  chan struct{}
+	wg   sync.WaitGroup
+
+	mu      sync.Mutex
+	err     error
+	errPath string
+}
+
+func (w *concurrentWalk) spawn(path string, info os.FileInfo) {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		w.sem <- struct{}{}
+		defer func() { <-w.sem }()
+		w.walkDir(path, info)
+	}()
+}
+
+func (w *concurrentWalk) walkDir(path string, info os.FileInfo) {
+	if w.skip(path) {
+		return
+	}
+	infos, err := readDirInfos(w.fs, path)
+	if err != nil {
+		if err := w.fn(path, info, err); err != nil && err != filepath.SkipDir {
+			w.fail(path, err)
+		}
+		return
+	}
+	for _, fi := range infos {
+		filename := filepath.Join(path, fi.Name())
+		if w.skip(filename) {
+			return
+		}
+		err := w.fn(filename, fi, nil)
+		if err == filepath.SkipDir {
+			if fi.IsDir() {
+				continue
+			}
+			return
+		}
+		if err != nil {
+			w.fail(filename, err)
+			return
+		}
+		if fi.IsDir() {
+			w.spawn(filename, fi)
+		}
+	}
+}
+
+// skip reports whether path comes after a failed path in walk order, so
+// that visiting it cannot change the result anymore.
+func (w *concurrentWalk) skip(path string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err != nil && w.before(w.errPath, path)
+}
+
+// fail records err unless an error was recorded for an earlier path.
+func (w *concurrentWalk) fail(path string, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err == nil || w.before(path, w.errPath) {
+		w.err, w.errPath = err, path
+	}
+}
+
+// before reports whether Walk visits a before b.
+func (w *concurrentWalk) before(a, b string) bool {
+	ac, bc := w.components(a), w.components(b)
+	for i := 0; i < len(ac) && i < len(bc); i++ {
+		if ac[i] != bc[i] {
+			return ac[i] < bc[i]
+		}
+	}
+	return len(ac) < len(bc)
+}
+
+func (w *concurrentWalk) components(path string) []string {
+	rel, err := filepath.Rel(w.root, path)
+	if err != nil || rel == "." {
+		return nil
+	}
+	return strings.Split(rel, string(filepath.Separator))
+}
+
+// readDirInfos reads the directory named by dirname and returns its entries
+// sorted by name.
+func readDirInfos(fs Fs, dirname string) ([]os.FileInfo, error) {
+	f, err := fs.Open(dirname)
+	if err != nil {
+		return nil, err
+	}
+	infos, err := f.Readdir(-1)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	return infos, nil
+}
@@ -15,8 +15,14 @@
 package afero
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
 	"testing"
 )
 
@@ -67,3 +73,185 @@ func TestWalk(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestWalkConcurrent(t *testing.T) {
+	fs := NewMemMapFs()
+	for i := 0; i < 5; i++ {
+		for j := 0; j < 5; j++ {
+			name := fmt.Sprintf("/root/d%d/e%d/f", i, j)
+			if err := WriteFile(fs, name, []byte(name), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	var want []string
+	if err := Walk(fs, "/root", func(path string, info os.FileInfo, err error) error {
+		if info.IsDir() && info.Name() == "d3" {
+			return filepath.SkipDir
+		}
+		want = append(want, path)
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var got []string
+	if err := WalkConcurrent(fs, "/root", 4, func(path string, info os.FileInfo, err error) error {
+		if info.IsDir() && info.Name() == "d3" {
+			return filepath.SkipDir
+		}
+		mu.Lock()
+		got = append(got, path)
+		mu.Unlock()
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(got)
+	sort.Strings(want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("visited %v, want %v", got, want)
+	}
+
+	errA, errB := errors.New("a"), errors.New("b")
+	for i := 0; i < 20; i++ {
+		err := WalkConcurrent(fs, "/root", 8, func(path string, info os.FileInfo, err error) error {
+			switch filepath.ToSlash(path) {
+			case "/root/d1/e4/f":
+				return errA
+			case "/root/d4/e0":
+				return errB
+			}
+			return nil
+		})
+		if err != errA {
+			t.Fatalf("WalkConcurrent = %v, want the first error in walk order", err)
+		}
+	}
+}
+
+func TestWalkDir(t *testing.T) {
+	for _, afs := range []Fs{NewMemMapFs(), NewOsFs()} {
+		root := "/root"
+		if _, ok := afs.(*OsFs); ok {
+			root = t.TempDir()
+		}
+		for _, name := range []string{"a/x", "a/y", "b/z", "c/w", "top"} {
+			afs.MkdirAll(filepath.Dir(filepath.Join(root, name)), 0o755)
+			if err := WriteFile(afs, filepath.Join(root, name), nil, 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var want []string
+		Walk(afs, root, func(path string, info os.FileInfo, err error) error {
+			if info.IsDir() && info.Name() == "b" {
+				return filepath.SkipDir
+			}
+			want = append(want, path)
+			return err
+		})
+		var got []string
+		err := WalkDir(afs, root, func(path string, d fs.DirEntry, err error) error {
+			if d.IsDir() && d.Name() == "b" {
+				return filepath.SkipDir
+			}
+			got = append(got, path)
+			return err
+		})
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: WalkDir visited %v, %v, want %v", afs.Name(), got, err, want)
+		}
+
+		got = nil
+		err = WalkDir(afs, root, func(path string, d fs.DirEntry, err error) error {
+			if path == filepath.Join(root, "a", "x") {
+				return filepath.SkipAll
+			}
+			got = append(got, path)
+			return err
+		})
+		if err != nil || len(got) != 2 {
+			t.Errorf("%s: WalkDir with SkipAll visited %v, %v", afs.Name(), got, err)
+		}
+	}
+
+	errMissing := WalkDir(NewMemMapFs(), "/missing", func(path string, d fs.DirEntry, err error) error {
+		if d != nil {
+			t.Errorf("DirEntry for a missing root = %v", d)
+		}
+		return err
+	})
+	if !errors.Is(errMissing, os.ErrNotExist) {
+		t.Errorf("WalkDir of a missing root = %v", errMissing)
+	}
+}
+
+func TestWalkWithOptions(t *testing.T) {
+	for _, afs := range []Fs{NewMemMapFs(), NewOsFs()} {
+		root := "/root"
+		if _, ok := afs.(*OsFs); ok {
+			root = t.TempDir()
+		}
+		join := func(name string) string { return filepath.Join(root, name) }
+		for _, name := range []string{"a/x", "c-target/f"} {
+			afs.MkdirAll(filepath.Dir(join(name)), 0o755)
+			WriteFile(afs, join(name), nil, 0o644)
+		}
+		afs.Mkdir(join("b"), 0o755)
+		for link, target := range map[string]string{
+			"a/loop": root,
+			"b/link": join("a"),
+			"broken": join("missing"),
+			"c":      join("c-target"),
+		} {
+			if err := afs.(Linker).SymlinkIfPossible(target, join(link)); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		visit := func(opts WalkOptions) (string, error) {
+			var got []string
+			err := WalkWithOptions(afs, root, opts, func(path string, info os.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+				rel, _ := filepath.Rel(root, path)
+				if info.IsDir() {
+					rel += "/"
+				} else if info.Mode()&os.ModeSymlink != 0 {
+					rel += "@"
+				}
+				got = append(got, filepath.ToSlash(rel))
+				return nil
+			})
+			return fmt.Sprint(got), err
+		}
+		for _, tt := range []struct {
+			opts WalkOptions
+			want string
+		}{
+			{WalkOptions{}, "[./ a/ a/loop@ a/x b/ b/link@ broken@ c@ c-target/ c-target/f]"},
+			{WalkOptions{FollowSymlinks: true}, "[./ a/ a/loop@ a/x b/ b/link@ broken@ c/ c/f c-target/ c-target/f]"},
+			{WalkOptions{MaxDepth: 1}, "[./ a/ b/ broken@ c@ c-target/]"},
+		} {
+			if got, err := visit(tt.opts); err != nil || got != tt.want {
+				t.Errorf("%s: %+v visited %s, %v, want %s", afs.Name(), tt.opts, got, err, tt.want)
+			}
+		}
+
+		var errs []string
+		err := WalkWithOptions(afs, join("missing"), WalkOptions{OnError: func(path string, err error) error {
+			errs = append(errs, path)
+			return nil
+		}}, func(path string, info os.FileInfo, err error) error {
+			t.Errorf("walkFn called for %s, %v", path, err)
+			return err
+		})
+		if err != nil || len(errs) != 1 {
+			t.Errorf("%s: OnError called for %v, walk returned %v", afs.Name(), errs, err)
+		}
+	}
+}
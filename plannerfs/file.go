@@ -0,0 +1,49 @@
+package plannerfs
+
+import (
+	"io"
+
+	"github.com/spf13/afero"
+)
+
+// File is a file opened for writing from a Fs, recording its writes.
+type File struct {
+	afero.File
+	fs   *Fs
+	name string
+}
+
+func (f *File) Write(p []byte) (int, error) {
+	n, err := f.File.Write(p)
+	if n > 0 {
+		// after the write, as O_APPEND moves the offset to the end first
+		if off, serr := f.File.Seek(0, io.SeekCurrent); serr == nil {
+			f.recordWrite(p[:n], off-int64(n))
+		}
+	}
+	return n, err
+}
+
+func (f *File) WriteAt(p []byte, off int64) (int, error) {
+	n, err := f.File.WriteAt(p, off)
+	if n > 0 {
+		f.recordWrite(p[:n], off)
+	}
+	return n, err
+}
+
+func (f *File) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *File) recordWrite(p []byte, off int64) {
+	f.fs.record(Op{Kind: Write, Path: f.name, Offset: off, Data: append([]byte(nil), p...)})
+}
+
+func (f *File) Truncate(size int64) error {
+	if err := f.File.Truncate(size); err != nil {
+		return err
+	}
+	f.fs.record(Op{Kind: Truncate, Path: f.name, Size: size})
+	return nil
+}
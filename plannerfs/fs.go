@@ -0,0 +1,329 @@
+// Package plannerfs provides an afero.Fs on which writes succeed without
+// touching the base Fs: they change an in-memory overlay and are recorded,
+// in order, as a plan. Tools generating files can print the plan for a
+// --dry-run, or apply it once confirmed.
+package plannerfs
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// Kind is the kind of an operation.
+type Kind int
+
+const (
+	Mkdir Kind = iota
+	Create
+	Write
+	Truncate
+	Chmod
+	Chown
+	Chtimes
+	Rename
+	Remove
+	RemoveAll
+	Symlink
+)
+
+var kinds = [...]string{"mkdir", "create", "write", "truncate", "chmod", "chown", "chtimes", "rename", "remove", "removeall", "symlink"}
+
+func (k Kind) String() string {
+	if k < 0 || int(k) >= len(kinds) {
+		return fmt.Sprintf("Kind(%d)", int(k))
+	}
+	return kinds[k]
+}
+
+// Op is a recorded operation. Only the fields of its kind are set.
+type Op struct {
+	Kind Kind
+	// Path is the file changed, or the old name for Rename and the name of
+	// the link for Symlink.
+	Path string
+	// NewPath is the new name for Rename and the target for Symlink.
+	NewPath string
+	// Mode is set for Mkdir, Create and Chmod.
+	Mode os.FileMode
+	// Data is written at Offset for Write. Consecutive writes to a file
+	// are merged into one Write.
+	Offset int64
+	Data   []byte
+	// Size is set for Truncate, also when a file is opened with O_TRUNC.
+	Size int64
+	// UID and GID are set for Chown.
+	UID, GID int
+	// Atime and Mtime are set for Chtimes.
+	Atime, Mtime time.Time
+}
+
+func (op Op) String() string {
+	switch op.Kind {
+	case Mkdir, Create, Chmod:
+		return fmt.Sprintf("%s %s %#o", op.Kind, op.Path, op.Mode.Perm())
+	case Write:
+		return fmt.Sprintf("write %s %d bytes at %d", op.Path, len(op.Data), op.Offset)
+	case Truncate:
+		return fmt.Sprintf("truncate %s %d", op.Path, op.Size)
+	case Chown:
+		return fmt.Sprintf("chown %s %d:%d", op.Path, op.UID, op.GID)
+	case Chtimes:
+		return fmt.Sprintf("chtimes %s %s", op.Path, op.Mtime.Format(time.RFC3339))
+	case Rename:
+		return fmt.Sprintf("rename %s %s", op.Path, op.NewPath)
+	case Symlink:
+		return fmt.Sprintf("symlink %s -> %s", op.Path, op.NewPath)
+	}
+	return fmt.Sprintf("%s %s", op.Kind, op.Path)
+}
+
+// Fs reads through to its base Fs until files are changed. Changes go to a
+// MemMapFs layered over the base with an afero.CopyOnWriteFs, which hides
+// removed base files with whiteouts.
+type Fs struct {
+	base    afero.Fs
+	overlay *afero.CopyOnWriteFs
+
+	mu  sync.Mutex
+	ops []Op
+}
+
+var _ afero.Symlinker = (*Fs)(nil)
+
+// New returns an Fs with an empty plan over base, which is never written.
+func New(base afero.Fs) *Fs {
+	fs := &Fs{base: base}
+	fs.Reset()
+	return fs
+}
+
+// Plan returns the operations made so far, in order.
+func (fs *Fs) Plan() []Op {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return append([]Op(nil), fs.ops...)
+}
+
+// Reset drops the plan and the overlay, so that the Fs shows the base again.
+// It must not be called while other calls are in progress.
+func (fs *Fs) Reset() {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.overlay = afero.NewCopyOnWriteFs(afero.NewReadOnlyFs(fs.base), afero.NewMemMapFs()).(*afero.CopyOnWriteFs)
+	fs.ops = nil
+}
+
+// Changes returns the net effect of the plan compared with the base.
+func (fs *Fs) Changes() (*afero.Changeset, error) {
+	return fs.overlay.Changes()
+}
+
+func (fs *Fs) record(op Op) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if op.Kind == Write && len(fs.ops) > 0 {
+		last := &fs.ops[len(fs.ops)-1]
+		if last.Kind == Write && last.Path == op.Path && last.Offset+int64(len(last.Data)) == op.Offset {
+			last.Data = append(last.Data, op.Data...)
+			return
+		}
+	}
+	fs.ops = append(fs.ops, op)
+}
+
+func (fs *Fs) Name() string { return "PlannerFs" }
+
+// Unwrap returns the base Fs, which does not see the planned changes.
+func (fs *Fs) Unwrap() afero.Fs {
+	return fs.base
+}
+
+func (fs *Fs) exists(name string) bool {
+	_, _, err := fs.overlay.LstatIfPossible(name)
+	return err == nil
+}
+
+func (fs *Fs) Create(name string) (afero.File, error) {
+	return fs.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o666)
+}
+
+func (fs *Fs) Mkdir(name string, perm os.FileMode) error {
+	if err := fs.overlay.Mkdir(name, perm); err != nil {
+		return err
+	}
+	fs.record(Op{Kind: Mkdir, Path: name, Mode: perm})
+	return nil
+}
+
+// MkdirAll records a Mkdir for every directory it creates.
+func (fs *Fs) MkdirAll(path string, perm os.FileMode) error {
+	var missing []string
+	for dir := afero.Clean(fs, path); !fs.exists(dir); dir = afero.Dir(fs, dir) {
+		missing = append(missing, dir)
+		if afero.Dir(fs, dir) == dir {
+			break
+		}
+	}
+	if err := fs.overlay.MkdirAll(path, perm); err != nil {
+		return err
+	}
+	for i := len(missing) - 1; i >= 0; i-- {
+		fs.record(Op{Kind: Mkdir, Path: missing[i], Mode: perm})
+	}
+	return nil
+}
+
+func (fs *Fs) Open(name string) (afero.File, error) {
+	return fs.overlay.Open(name)
+}
+
+// OpenFile records a Create for new files and a Truncate for files opened
+// with O_TRUNC. Files opened for writing record their writes.
+func (fs *Fs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) == 0 {
+		return fs.overlay.OpenFile(name, flag, perm)
+	}
+	existed := fs.exists(name)
+	f, err := fs.overlay.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	if !existed {
+		fs.record(Op{Kind: Create, Path: name, Mode: perm})
+	} else if flag&os.O_TRUNC != 0 {
+		fs.record(Op{Kind: Truncate, Path: name})
+	}
+	return &File{File: f, fs: fs, name: name}, nil
+}
+
+func (fs *Fs) Remove(name string) error {
+	if err := fs.overlay.Remove(name); err != nil {
+		return err
+	}
+	fs.record(Op{Kind: Remove, Path: name})
+	return nil
+}
+
+// RemoveAll records a RemoveAll if path existed.
+func (fs *Fs) RemoveAll(path string) error {
+	existed := fs.exists(path)
+	if err := fs.overlay.RemoveAll(path); err != nil {
+		return err
+	}
+	if existed {
+		fs.record(Op{Kind: RemoveAll, Path: path})
+	}
+	return nil
+}
+
+func (fs *Fs) Rename(oldname, newname string) error {
+	if err := fs.overlay.Rename(oldname, newname); err != nil {
+		return err
+	}
+	fs.record(Op{Kind: Rename, Path: oldname, NewPath: newname})
+	return nil
+}
+
+func (fs *Fs) Stat(name string) (os.FileInfo, error) {
+	return fs.overlay.Stat(name)
+}
+
+func (fs *Fs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	return fs.overlay.LstatIfPossible(name)
+}
+
+func (fs *Fs) SymlinkIfPossible(oldname, newname string) error {
+	if err := fs.overlay.SymlinkIfPossible(oldname, newname); err != nil {
+		return err
+	}
+	fs.record(Op{Kind: Symlink, Path: newname, NewPath: oldname})
+	return nil
+}
+
+func (fs *Fs) ReadlinkIfPossible(name string) (string, error) {
+	return fs.overlay.ReadlinkIfPossible(name)
+}
+
+func (fs *Fs) Chmod(name string, mode os.FileMode) error {
+	if err := fs.overlay.Chmod(name, mode); err != nil {
+		return err
+	}
+	fs.record(Op{Kind: Chmod, Path: name, Mode: mode})
+	return nil
+}
+
+func (fs *Fs) Chown(name string, uid, gid int) error {
+	if err := fs.overlay.Chown(name, uid, gid); err != nil {
+		return err
+	}
+	fs.record(Op{Kind: Chown, Path: name, UID: uid, GID: gid})
+	return nil
+}
+
+func (fs *Fs) Chtimes(name string, atime, mtime time.Time) error {
+	if err := fs.overlay.Chtimes(name, atime, mtime); err != nil {
+		return err
+	}
+	fs.record(Op{Kind: Chtimes, Path: name, Atime: atime, Mtime: mtime})
+	return nil
+}
+
+// Apply makes the operations of the plan on target, usually the base Fs,
+// stopping at the first error.
+func (fs *Fs) Apply(target afero.Fs) error {
+	for _, op := range fs.Plan() {
+		if err := apply(target, op); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func apply(target afero.Fs, op Op) error {
+	switch op.Kind {
+	case Mkdir:
+		return target.Mkdir(op.Path, op.Mode)
+	case Create:
+		f, err := target.OpenFile(op.Path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, op.Mode)
+		if err != nil {
+			return err
+		}
+		return f.Close()
+	case Write, Truncate:
+		f, err := target.OpenFile(op.Path, os.O_WRONLY, 0)
+		if err != nil {
+			return err
+		}
+		if op.Kind == Write {
+			_, err = f.WriteAt(op.Data, op.Offset)
+		} else {
+			err = f.Truncate(op.Size)
+		}
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	case Chmod:
+		return target.Chmod(op.Path, op.Mode)
+	case Chown:
+		return target.Chown(op.Path, op.UID, op.GID)
+	case Chtimes:
+		return target.Chtimes(op.Path, op.Atime, op.Mtime)
+	case Rename:
+		return target.Rename(op.Path, op.NewPath)
+	case Remove:
+		return target.Remove(op.Path)
+	case RemoveAll:
+		return target.RemoveAll(op.Path)
+	case Symlink:
+		if linker, ok := target.(afero.Linker); ok {
+			return linker.SymlinkIfPossible(op.NewPath, op.Path)
+		}
+		return &os.LinkError{Op: "symlink", Old: op.NewPath, New: op.Path, Err: afero.ErrNoSymlink}
+	}
+	return fmt.Errorf("plannerfs: unknown operation %v", op.Kind)
+}
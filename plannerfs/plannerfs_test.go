@@ -0,0 +1,135 @@
+package plannerfs
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/spf13/afero/aferotest"
+)
+
+func TestPlan(t *testing.T) {
+	base := afero.NewMemMapFs()
+	afero.WriteFile(base, "/project/go.mod", []byte("module old\n"), 0o644)
+	afero.WriteFile(base, "/project/stale.go", []byte("package stale\n"), 0o644)
+	fs := New(base)
+
+	fs.MkdirAll("/project/cmd/tool", 0o755)
+	f, err := fs.Create("/project/cmd/tool/main.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("package ")
+	f.WriteString("main\n")
+	f.Close()
+	afero.WriteFile(fs, "/project/go.mod", []byte("module new\n"), 0o644)
+	fs.Chmod("/project/cmd/tool/main.go", 0o600)
+	fs.Rename("/project/go.mod", "/project/go.mod.new")
+	fs.Remove("/project/stale.go")
+	fs.RemoveAll("/project/missing")
+
+	var got []string
+	for _, op := range fs.Plan() {
+		got = append(got, op.String())
+	}
+	want := []string{
+		"mkdir /project/cmd 0755",
+		"mkdir /project/cmd/tool 0755",
+		"create /project/cmd/tool/main.go 0666",
+		"write /project/cmd/tool/main.go 13 bytes at 0",
+		"truncate /project/go.mod 0",
+		"write /project/go.mod 11 bytes at 0",
+		"chmod /project/cmd/tool/main.go 0600",
+		"rename /project/go.mod /project/go.mod.new",
+		"remove /project/stale.go",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("plan:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// the Fs shows the planned state, the base is untouched
+	if data, _ := afero.ReadFile(fs, "/project/go.mod.new"); string(data) != "module new\n" {
+		t.Errorf("planned go.mod.new = %q", data)
+	}
+	if _, err := fs.Stat("/project/stale.go"); !os.IsNotExist(err) {
+		t.Errorf("removed file still visible: %v", err)
+	}
+	if data, _ := afero.ReadFile(base, "/project/go.mod"); string(data) != "module old\n" {
+		t.Errorf("base go.mod = %q", data)
+	}
+	if _, err := base.Stat("/project/cmd"); !os.IsNotExist(err) {
+		t.Errorf("base was changed: %v", err)
+	}
+
+	// applying the plan to the base gives the planned state
+	if err := fs.Apply(base); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"/project/cmd/tool/main.go": "package main\n",
+		"/project/go.mod.new":       "module new\n",
+	} {
+		if data, err := afero.ReadFile(base, name); err != nil || string(data) != content {
+			t.Errorf("%s after Apply = %q, %v", name, data, err)
+		}
+	}
+	if fi, _ := base.Stat("/project/cmd/tool/main.go"); fi.Mode().Perm() != 0o600 {
+		t.Errorf("mode after Apply = %v", fi.Mode())
+	}
+	if ok, _ := afero.Exists(base, "/project/stale.go"); ok {
+		t.Error("stale.go was not removed by Apply")
+	}
+
+	fs.Reset()
+	if len(fs.Plan()) != 0 {
+		t.Error("Reset did not drop the plan")
+	}
+}
+
+func TestAppendAndWriteAt(t *testing.T) {
+	base := afero.NewMemMapFs()
+	afero.WriteFile(base, "/log", []byte("abc"), 0o644)
+	fs := New(base)
+	f, err := fs.OpenFile("/log", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("de"))
+	f.Close()
+	f, _ = fs.OpenFile("/log", os.O_WRONLY, 0)
+	f.WriteAt([]byte("X"), 0)
+	f.Truncate(4)
+	f.Close()
+
+	var got []string
+	for _, op := range fs.Plan() {
+		got = append(got, op.String())
+	}
+	if s := strings.Join(got, "; "); s != "write /log 2 bytes at 3; write /log 1 bytes at 0; truncate /log 4" {
+		t.Errorf("plan = %s", s)
+	}
+	if data, _ := afero.ReadFile(fs, "/log"); string(data) != "Xbcd" {
+		t.Errorf("content = %q", data)
+	}
+}
+
+func TestMkdirExisting(t *testing.T) {
+	fs := New(afero.NewMemMapFs())
+	if err := fs.Mkdir("/dir", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Mkdir("/dir", 0o755); !os.IsExist(err) {
+		t.Errorf("second Mkdir = %v, want an exist error", err)
+	}
+	if n := len(fs.Plan()); n != 1 {
+		t.Errorf("plan has %d ops, want the first Mkdir only", n)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	newFs := func(t *testing.T) afero.Fs {
+		return New(afero.NewMemMapFs())
+	}
+	aferotest.Conformance(t, newFs, afero.Capabilities(newFs(t)))
+}
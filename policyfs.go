@@ -0,0 +1,238 @@
+package afero
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"time"
+)
+
+var _ Lstater = (*PolicyFs)(nil)
+
+// PolicyRequest describes a single call on a PolicyFs. Op is the name the
+// os package uses for the operation ("open", "mkdir", "remove", "RemoveAll",
+// "rename", "stat", "lstat", "chmod", "chown", "chtimes", "getxattr",
+// "setxattr", "listxattr", "removexattr"), or "lock" for LockIfPossible.
+// NewPath is only set for "rename", Flag only for "open", Mode for "open",
+// "mkdir" and "chmod".
+type PolicyRequest struct {
+	Op      string
+	Path    string
+	NewPath string
+	Flag    int
+	Mode    os.FileMode
+}
+
+// PolicyDecision is the answer of a PolicyEngine. Reason is recorded in the
+// error returned for denied calls and passed to the audit function.
+type PolicyDecision struct {
+	Allow  bool
+	Reason string
+}
+
+// PolicyEngine decides whether a call on a PolicyFs may proceed.
+type PolicyEngine interface {
+	Decide(req PolicyRequest) PolicyDecision
+}
+
+// PolicyFunc adapts an ordinary function to a PolicyEngine.
+type PolicyFunc func(req PolicyRequest) PolicyDecision
+
+func (f PolicyFunc) Decide(req PolicyRequest) PolicyDecision {
+	return f(req)
+}
+
+// AuditFunc is called by a PolicyFs for every decision, allowed or not.
+type AuditFunc func(req PolicyRequest, d PolicyDecision)
+
+// PolicyError is the Err of the *os.PathError returned for calls denied by
+// a PolicyEngine. It matches fs.ErrPermission with errors.Is.
+type PolicyError struct {
+	Reason string
+}
+
+func (e *PolicyError) Error() string {
+	if e.Reason == "" {
+		return "denied by policy"
+	}
+	return "denied by policy: " + e.Reason
+}
+
+func (e *PolicyError) Is(target error) bool {
+	return target == fs.ErrPermission
+}
+
+// The PolicyFs asks a PolicyEngine before every call whether it may be
+// passed to the source Fs. Denied calls fail with an *os.PathError whose
+// Err is a *PolicyError carrying the reason of the decision.
+//
+// Files are only checked when they are opened; reads and writes on an open
+// file are not checked again.
+type PolicyFs struct {
+	source Fs
+	engine PolicyEngine
+	audit  AuditFunc
+}
+
+// NewPolicyFs returns a PolicyFs checking calls with engine. audit may be
+// nil.
+func NewPolicyFs(source Fs, engine PolicyEngine, audit AuditFunc) Fs {
+	return &PolicyFs{source: source, engine: engine, audit: audit}
+}
+
+func (p *PolicyFs) check(req PolicyRequest) error {
+	d := p.engine.Decide(req)
+	if p.audit != nil {
+		p.audit(req, d)
+	}
+	if d.Allow {
+		return nil
+	}
+	return &os.PathError{Op: req.Op, Path: req.Path, Err: &PolicyError{Reason: d.Reason}}
+}
+
+func (p *PolicyFs) Name() string {
+	return "PolicyFs"
+}
+
+// Unwrap returns the source Fs, to which the policy does not apply.
+func (p *PolicyFs) Unwrap() Fs {
+	return p.source
+}
+
+// Capabilities returns those of the source it passes on, links are not
+// supported.
+func (p *PolicyFs) Capabilities() Capability {
+	return Capabilities(p.source) & (CapLstat | CapAtomicRename | CapLock | CapXattr | CapReadAt)
+}
+
+func (p *PolicyFs) Create(name string) (File, error) {
+	flag := os.O_RDWR | os.O_CREATE | os.O_TRUNC
+	if err := p.check(PolicyRequest{Op: "open", Path: name, Flag: flag, Mode: 0o666}); err != nil {
+		return nil, err
+	}
+	return p.source.Create(name)
+}
+
+func (p *PolicyFs) Open(name string) (File, error) {
+	if err := p.check(PolicyRequest{Op: "open", Path: name, Flag: os.O_RDONLY}); err != nil {
+		return nil, err
+	}
+	return p.source.Open(name)
+}
+
+func (p *PolicyFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	if err := p.check(PolicyRequest{Op: "open", Path: name, Flag: flag, Mode: perm}); err != nil {
+		return nil, err
+	}
+	return p.source.OpenFile(name, flag, perm)
+}
+
+func (p *PolicyFs) Mkdir(name string, perm os.FileMode) error {
+	if err := p.check(PolicyRequest{Op: "mkdir", Path: name, Mode: perm}); err != nil {
+		return err
+	}
+	return p.source.Mkdir(name, perm)
+}
+
+func (p *PolicyFs) MkdirAll(path string, perm os.FileMode) error {
+	if err := p.check(PolicyRequest{Op: "mkdir", Path: path, Mode: perm}); err != nil {
+		return err
+	}
+	return p.source.MkdirAll(path, perm)
+}
+
+func (p *PolicyFs) Remove(name string) error {
+	if err := p.check(PolicyRequest{Op: "remove", Path: name}); err != nil {
+		return err
+	}
+	return p.source.Remove(name)
+}
+
+func (p *PolicyFs) RemoveAll(path string) error {
+	if err := p.check(PolicyRequest{Op: "RemoveAll", Path: path}); err != nil {
+		return err
+	}
+	return p.source.RemoveAll(path)
+}
+
+func (p *PolicyFs) Rename(oldname, newname string) error {
+	if err := p.check(PolicyRequest{Op: "rename", Path: oldname, NewPath: newname}); err != nil {
+		return err
+	}
+	return p.source.Rename(oldname, newname)
+}
+
+func (p *PolicyFs) Stat(name string) (os.FileInfo, error) {
+	if err := p.check(PolicyRequest{Op: "stat", Path: name}); err != nil {
+		return nil, err
+	}
+	return p.source.Stat(name)
+}
+
+func (p *PolicyFs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	if err := p.check(PolicyRequest{Op: "lstat", Path: name}); err != nil {
+		return nil, false, err
+	}
+	if lsf, ok := p.source.(Lstater); ok {
+		return lsf.LstatIfPossible(name)
+	}
+	fi, err := p.source.Stat(name)
+	return fi, false, err
+}
+
+func (p *PolicyFs) LockIfPossible(name string, exclusive bool) (io.Closer, bool, error) {
+	if err := p.check(PolicyRequest{Op: "lock", Path: name}); err != nil {
+		return nil, false, err
+	}
+	return lockIfPossible(p.source, name, exclusive)
+}
+
+func (p *PolicyFs) GetXattr(name, attr string) ([]byte, error) {
+	if err := p.check(PolicyRequest{Op: "getxattr", Path: name}); err != nil {
+		return nil, err
+	}
+	return GetXattr(p.source, name, attr)
+}
+
+func (p *PolicyFs) SetXattr(name, attr string, value []byte) error {
+	if err := p.check(PolicyRequest{Op: "setxattr", Path: name}); err != nil {
+		return err
+	}
+	return SetXattr(p.source, name, attr, value)
+}
+
+func (p *PolicyFs) ListXattr(name string) ([]string, error) {
+	if err := p.check(PolicyRequest{Op: "listxattr", Path: name}); err != nil {
+		return nil, err
+	}
+	return ListXattr(p.source, name)
+}
+
+func (p *PolicyFs) RemoveXattr(name, attr string) error {
+	if err := p.check(PolicyRequest{Op: "removexattr", Path: name}); err != nil {
+		return err
+	}
+	return RemoveXattr(p.source, name, attr)
+}
+
+func (p *PolicyFs) Chmod(name string, mode os.FileMode) error {
+	if err := p.check(PolicyRequest{Op: "chmod", Path: name, Mode: mode}); err != nil {
+		return err
+	}
+	return p.source.Chmod(name, mode)
+}
+
+func (p *PolicyFs) Chown(name string, uid, gid int) error {
+	if err := p.check(PolicyRequest{Op: "chown", Path: name}); err != nil {
+		return err
+	}
+	return p.source.Chown(name, uid, gid)
+}
+
+func (p *PolicyFs) Chtimes(name string, atime, mtime time.Time) error {
+	if err := p.check(PolicyRequest{Op: "chtimes", Path: name}); err != nil {
+		return err
+	}
+	return p.source.Chtimes(name, atime, mtime)
+}
@@ -0,0 +1,67 @@
+package afero
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestPolicyFs(t *testing.T) {
+	base := &MemMapFs{}
+	WriteFile(base, "/public/a.txt", []byte("a"), 0o644)
+	WriteFile(base, "/secret/b.txt", []byte("b"), 0o644)
+
+	engine := PolicyFunc(func(req PolicyRequest) PolicyDecision {
+		if strings.HasPrefix(req.Path, "/secret") || strings.HasPrefix(req.NewPath, "/secret") {
+			return PolicyDecision{Reason: "secret area"}
+		}
+		if req.Op == "open" && req.Flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+			return PolicyDecision{Reason: "read-only policy"}
+		}
+		return PolicyDecision{Allow: true}
+	})
+	var audited []string
+	audit := func(req PolicyRequest, d PolicyDecision) {
+		audited = append(audited, req.Op+" "+req.Path+" "+d.Reason)
+	}
+	pfs := NewPolicyFs(base, engine, audit)
+
+	if _, err := ReadFile(pfs, "/public/a.txt"); err != nil {
+		t.Errorf("allowed read failed: %v", err)
+	}
+
+	_, err := pfs.Open("/secret/b.txt")
+	var perr *os.PathError
+	if !errors.As(err, &perr) || perr.Op != "open" || perr.Path != "/secret/b.txt" {
+		t.Fatalf("got %v, want *os.PathError for open /secret/b.txt", err)
+	}
+	var policyErr *PolicyError
+	if !errors.As(err, &policyErr) || policyErr.Reason != "secret area" {
+		t.Errorf("got %v, want PolicyError with reason %q", err, "secret area")
+	}
+	if !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("%v should match fs.ErrPermission", err)
+	}
+
+	if _, err := pfs.OpenFile("/public/a.txt", os.O_RDWR, 0); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("write open: got %v, want permission error", err)
+	}
+	if err := pfs.Rename("/public/a.txt", "/secret/a.txt"); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("rename: got %v, want permission error", err)
+	}
+	if _, err := base.Stat("/public/a.txt"); err != nil {
+		t.Errorf("denied rename changed the source: %v", err)
+	}
+
+	want := []string{
+		"open /public/a.txt ",
+		"open /secret/b.txt secret area",
+		"open /public/a.txt read-only policy",
+		"rename /public/a.txt secret area",
+	}
+	if strings.Join(audited, "\n") != strings.Join(want, "\n") {
+		t.Errorf("audit log:\n%s\nwant:\n%s", strings.Join(audited, "\n"), strings.Join(want, "\n"))
+	}
+}
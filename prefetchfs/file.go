@@ -0,0 +1,164 @@
+package prefetchfs
+
+import (
+	"io"
+	"math"
+	"os"
+	"sync"
+
+	"github.com/spf13/afero"
+)
+
+// sequentialReads is the number of Reads, each continuing the one before,
+// after which a file reads ahead.
+const sequentialReads = 2
+
+// chunk is a read-ahead request, its data and err set when done is closed.
+type chunk struct {
+	off  int64
+	data []byte
+	err  error
+	done chan struct{}
+}
+
+// File is a file opened for reading from a Fs. It reads with ReadAt of the
+// base file at an offset of its own, so Read, Seek and ReadAt do not move
+// the offset of the base file.
+type File struct {
+	afero.File
+	fs *Fs
+
+	mu     sync.Mutex
+	off    int64
+	reads  int
+	chunks []*chunk
+	// next is where the next chunk starts, size the size of the file when
+	// it started reading ahead, or -1.
+	next, size int64
+	closed     bool
+	// pending counts the chunks not done yet, including dropped ones.
+	pending sync.WaitGroup
+}
+
+func (f *File) Read(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return 0, afero.ErrFileClosed
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	f.reads++
+	if f.reads > sequentialReads {
+		f.fill()
+		if len(f.chunks) > 0 {
+			return f.readChunks(p)
+		}
+	}
+	return f.readAt(p)
+}
+
+// readAt reads from the base file at the offset, for the reads not served
+// from chunks.
+func (f *File) readAt(p []byte) (int, error) {
+	n, err := f.File.ReadAt(p, f.off)
+	f.off += int64(n)
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+// readChunks reads from the chunks, waiting for the first one if needed.
+func (f *File) readChunks(p []byte) (int, error) {
+	for len(f.chunks) > 0 {
+		c := f.chunks[0]
+		<-c.done
+		if i := f.off - c.off; i < int64(len(c.data)) {
+			n := copy(p, c.data[i:])
+			f.off += int64(n)
+			return n, nil
+		}
+		if c.err != nil {
+			f.reset()
+			return 0, c.err
+		}
+		f.chunks = f.chunks[1:]
+		f.fill()
+	}
+	// past the size the file had
+	return f.readAt(p)
+}
+
+// fill requests the chunks missing in the window ahead of the reader, up to
+// the size of the file.
+func (f *File) fill() {
+	if f.size < 0 {
+		f.size = math.MaxInt64
+		if fi, err := f.File.Stat(); err == nil {
+			f.size = fi.Size()
+		}
+	}
+	if len(f.chunks) == 0 {
+		f.next = f.off
+	}
+	for f.next < f.off+f.fs.window && f.next < f.size {
+		c := &chunk{off: f.next, done: make(chan struct{})}
+		f.chunks = append(f.chunks, c)
+		f.next += f.fs.chunkSize
+		f.pending.Add(1)
+		go func(file afero.File, size int64) {
+			defer f.pending.Done()
+			buf := make([]byte, size)
+			n, err := file.ReadAt(buf, c.off)
+			c.data, c.err = buf[:n], err
+			close(c.done)
+		}(f.File, f.fs.chunkSize)
+	}
+}
+
+// reset drops what was read ahead and starts counting sequential reads anew.
+func (f *File) reset() {
+	f.chunks = nil
+	f.reads = 0
+}
+
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return 0, afero.ErrFileClosed
+	}
+	pos := offset
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		pos += f.off
+	case io.SeekEnd:
+		var err error
+		if pos, err = f.File.Seek(offset, io.SeekEnd); err != nil {
+			return 0, err
+		}
+	default:
+		return 0, &os.PathError{Op: "seek", Path: f.Name(), Err: os.ErrInvalid}
+	}
+	if pos < 0 {
+		return 0, &os.PathError{Op: "seek", Path: f.Name(), Err: os.ErrInvalid}
+	}
+	if pos != f.off {
+		f.reset()
+		f.off = pos
+	}
+	return pos, nil
+}
+
+// Close waits for the chunks in flight before closing the base file.
+func (f *File) Close() error {
+	f.mu.Lock()
+	f.closed = true
+	f.chunks = nil
+	f.mu.Unlock()
+	f.pending.Wait()
+	return f.File.Close()
+}
@@ -0,0 +1,150 @@
+// Package prefetchfs provides an afero.Fs wrapper which reads ahead of
+// files read sequentially, so that backends with a high latency per
+// request, like SFTP, HTTP or object stores, stream them at the rate of
+// several requests in flight.
+package prefetchfs
+
+import (
+	"os"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+const (
+	// DefaultWindow is how far ahead of the reader data is requested.
+	DefaultWindow = 1 << 20
+	// DefaultChunkSize is the size of each read-ahead request.
+	DefaultChunkSize = 256 << 10
+)
+
+// Fs passes all calls to its base Fs. The files it opens for reading only
+// read ahead once they were read sequentially a few times, by calling
+// ReadAt of the base file concurrently for the chunks of the window ahead
+// of the reader, and serving Read from them. A Seek elsewhere, or a failed
+// request, drops what was read ahead.
+//
+// Files opened for writing are those of the base Fs.
+type Fs struct {
+	base      afero.Fs
+	window    int64
+	chunkSize int64
+}
+
+var _ afero.Symlinker = (*Fs)(nil)
+
+// Option configures an Fs created by New.
+type Option func(*Fs)
+
+// WithWindow sets how many bytes ahead of the reader are read, the default
+// is DefaultWindow.
+func WithWindow(n int64) Option {
+	return func(fs *Fs) {
+		fs.window = n
+	}
+}
+
+// WithChunkSize sets the size of the requests reading ahead, the default is
+// DefaultChunkSize. The window holds up to window/chunk size requests in
+// flight.
+func WithChunkSize(n int64) Option {
+	return func(fs *Fs) {
+		fs.chunkSize = n
+	}
+}
+
+// New returns an Fs reading ahead of the files of base.
+func New(base afero.Fs, opts ...Option) *Fs {
+	fs := &Fs{base: base, window: DefaultWindow, chunkSize: DefaultChunkSize}
+	for _, opt := range opts {
+		opt(fs)
+	}
+	if fs.chunkSize <= 0 {
+		fs.chunkSize = DefaultChunkSize
+	}
+	if fs.window < fs.chunkSize {
+		fs.window = fs.chunkSize
+	}
+	return fs
+}
+
+func (fs *Fs) Name() string { return "PrefetchFs" }
+
+// Unwrap returns the base Fs.
+func (fs *Fs) Unwrap() afero.Fs {
+	return fs.base
+}
+
+func (fs *Fs) Create(name string) (afero.File, error) {
+	return fs.base.Create(name)
+}
+
+func (fs *Fs) Mkdir(name string, perm os.FileMode) error {
+	return fs.base.Mkdir(name, perm)
+}
+
+func (fs *Fs) MkdirAll(path string, perm os.FileMode) error {
+	return fs.base.MkdirAll(path, perm)
+}
+
+func (fs *Fs) Open(name string) (afero.File, error) {
+	return fs.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (fs *Fs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	f, err := fs.base.OpenFile(name, flag, perm)
+	if err != nil || flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) != 0 {
+		return f, err
+	}
+	return &File{File: f, fs: fs, size: -1}, nil
+}
+
+func (fs *Fs) Remove(name string) error {
+	return fs.base.Remove(name)
+}
+
+func (fs *Fs) RemoveAll(path string) error {
+	return fs.base.RemoveAll(path)
+}
+
+func (fs *Fs) Rename(oldname, newname string) error {
+	return fs.base.Rename(oldname, newname)
+}
+
+func (fs *Fs) Stat(name string) (os.FileInfo, error) {
+	return fs.base.Stat(name)
+}
+
+func (fs *Fs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	if lfs, ok := fs.base.(afero.Lstater); ok {
+		return lfs.LstatIfPossible(name)
+	}
+	fi, err := fs.base.Stat(name)
+	return fi, false, err
+}
+
+func (fs *Fs) SymlinkIfPossible(oldname, newname string) error {
+	if linker, ok := fs.base.(afero.Linker); ok {
+		return linker.SymlinkIfPossible(oldname, newname)
+	}
+	return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: afero.ErrNoSymlink}
+}
+
+func (fs *Fs) ReadlinkIfPossible(name string) (string, error) {
+	if reader, ok := fs.base.(afero.LinkReader); ok {
+		return reader.ReadlinkIfPossible(name)
+	}
+	return "", &os.PathError{Op: "readlink", Path: name, Err: afero.ErrNoReadlink}
+}
+
+func (fs *Fs) Chmod(name string, mode os.FileMode) error {
+	return fs.base.Chmod(name, mode)
+}
+
+func (fs *Fs) Chown(name string, uid, gid int) error {
+	return fs.base.Chown(name, uid, gid)
+}
+
+func (fs *Fs) Chtimes(name string, atime, mtime time.Time) error {
+	return fs.base.Chtimes(name, atime, mtime)
+}
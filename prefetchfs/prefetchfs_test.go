@@ -0,0 +1,151 @@
+package prefetchfs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"testing/iotest"
+
+	"github.com/spf13/afero"
+	"github.com/spf13/afero/aferotest"
+	"github.com/spf13/afero/faultfs"
+)
+
+func content(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	return data
+}
+
+// countReadAts returns an Fs counting the ReadAt calls of its files.
+func countReadAts(base afero.Fs) (afero.Fs, *int64) {
+	var n int64
+	return afero.NewInstrumentedFs(base, afero.Hooks{Before: func(ev *afero.InstrumentEvent) {
+		if ev.Op == "File.ReadAt" {
+			atomic.AddInt64(&n, 1)
+		}
+	}}), &n
+}
+
+func TestSequentialRead(t *testing.T) {
+	mem := afero.NewMemMapFs()
+	data := content(1 << 20)
+	afero.WriteFile(mem, "/file", data, 0o644)
+	base, readAts := countReadAts(mem)
+	fs := New(base, WithWindow(256<<10), WithChunkSize(64<<10))
+
+	f, err := fs.Open("/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var got bytes.Buffer
+	buf := make([]byte, 4096)
+	reads := 0
+	for {
+		n, err := f.Read(buf)
+		got.Write(buf[:n])
+		reads++
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.Equal(got.Bytes(), data) {
+		t.Fatalf("read %d bytes, which differ from the file", got.Len())
+	}
+	// a few direct reads, then chunks of 64 KiB
+	if n := atomic.LoadInt64(readAts); n > sequentialReads+int64(len(data)>>16)+2 {
+		t.Errorf("%d reads of 4 KiB made %d ReadAt calls", reads, n)
+	}
+}
+
+func TestRandomAccess(t *testing.T) {
+	mem := afero.NewMemMapFs()
+	data := content(100000)
+	afero.WriteFile(mem, "/file", data, 0o644)
+	base, readAts := countReadAts(mem)
+	fs := New(base, WithWindow(350), WithChunkSize(100))
+
+	f, err := fs.Open("/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	buf := make([]byte, 10)
+	for i, off := range []int64{50000, 10, 99995, 70000, 0, 42} {
+		if _, err := f.Seek(off, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		n, err := f.Read(buf)
+		if err != nil || !bytes.Equal(buf[:n], data[off:off+int64(n)]) {
+			t.Errorf("Read at %d = %d, %v", off, n, err)
+		}
+		if got := atomic.LoadInt64(readAts); got != int64(i+1) {
+			t.Errorf("%d ReadAt calls for %d seeks and reads, want no read-ahead", got, i+1)
+		}
+	}
+
+	// Read, ReadAt and Seek agree whether the file reads ahead or not
+	for _, size := range []int{0, 99, 100, 101, 1234} {
+		afero.WriteFile(mem, "/small", data[:size], 0o644)
+		f, err := fs.Open("/small")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := iotest.TestReader(f, data[:size]); err != nil {
+			t.Errorf("file of %d bytes: %v", size, err)
+		}
+		f.Close()
+	}
+}
+
+func TestReadAheadError(t *testing.T) {
+	faulty := faultfs.New(afero.NewMemMapFs())
+	afero.WriteFile(faulty, "/file", content(10000), 0o644)
+	fs := New(faulty, WithWindow(4000), WithChunkSize(1000))
+	f, err := fs.Open("/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	buf := make([]byte, 500)
+	for i := 0; i < sequentialReads; i++ {
+		f.Read(buf)
+	}
+	faulty.Inject(faultfs.Fault{Op: "File.ReadAt", Err: syscall.ECONNRESET})
+	if _, err := f.Read(buf); !errors.Is(err, syscall.ECONNRESET) {
+		t.Fatalf("Read with failing requests = %v", err)
+	}
+	// the read ahead was dropped, the next Read tries again
+	faulty.Reset()
+	if n, err := f.Read(buf); err != nil || !bytes.Equal(buf[:n], content(10000)[1000:1000+n]) {
+		t.Errorf("Read after the failure = %d, %v", n, err)
+	}
+
+	// files opened for writing are those of the base Fs
+	w, err := fs.OpenFile("/file", os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if _, ok := w.(*File); ok {
+		t.Error("a file opened for writing reads ahead")
+	}
+}
+
+func TestConformance(t *testing.T) {
+	newFs := func(t *testing.T) afero.Fs {
+		return New(afero.NewMemMapFs())
+	}
+	aferotest.Conformance(t, newFs, afero.Capabilities(newFs(t)))
+}
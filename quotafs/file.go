@@ -0,0 +1,78 @@
+package quotafs
+
+import (
+	"errors"
+	"os"
+	"syscall"
+
+	"github.com/spf13/afero"
+)
+
+// File is a file opened for writing from a Fs. It keeps track of its offset
+// to charge writes before they are made.
+type File struct {
+	afero.File
+	fs   *Fs
+	name string
+	flag int
+	off  int64
+}
+
+// write charges the file for p written at off, then calls fn. A short
+// write only keeps the bytes written charged.
+func (f *File) write(p []byte, off int64, fn func([]byte) (int, error)) (int, error) {
+	end := off + int64(len(p))
+	prev, err := f.fs.extend(f.name, end)
+	if err != nil {
+		return 0, &os.PathError{Op: "write", Path: f.name, Err: err}
+	}
+	n, err := fn(p)
+	if n < len(p) {
+		f.fs.settle(f.name, end, max(prev, off+int64(n)))
+	}
+	return n, err
+}
+
+func (f *File) Write(p []byte) (int, error) {
+	off := f.off
+	if f.flag&os.O_APPEND != 0 {
+		off = f.fs.size(f.name)
+	}
+	n, err := f.write(p, off, f.File.Write)
+	f.off = off + int64(n)
+	return n, err
+}
+
+func (f *File) WriteAt(p []byte, off int64) (int, error) {
+	return f.write(p, off, func(p []byte) (int, error) {
+		return f.File.WriteAt(p, off)
+	})
+}
+
+func (f *File) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *File) Read(p []byte) (int, error) {
+	n, err := f.File.Read(p)
+	f.off += int64(n)
+	return n, err
+}
+
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	off, err := f.File.Seek(offset, whence)
+	if err == nil {
+		f.off = off
+	}
+	return off, err
+}
+
+func (f *File) Truncate(size int64) error {
+	err := f.fs.do(map[string]*entry{f.name: {size: size}}, func() error {
+		return f.File.Truncate(size)
+	})
+	if errors.Is(err, syscall.ENOSPC) {
+		return &os.PathError{Op: "truncate", Path: f.name, Err: err}
+	}
+	return err
+}
@@ -0,0 +1,454 @@
+// Package quotafs provides an afero.Fs wrapper which limits the total size
+// and the number of files of the whole file system and of chosen subtrees,
+// whatever the backend, e.g. to give each tenant of a service its quota.
+package quotafs
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// Limit caps the usage of a tree. A limit of zero means no limit.
+type Limit struct {
+	// MaxBytes is the total size of the regular files.
+	MaxBytes int64
+	// MaxFiles is the number of files, directories and symlinks.
+	MaxFiles int
+}
+
+// QuotaConfig sets the limits of an Fs.
+type QuotaConfig struct {
+	// Limit applies to the whole Fs.
+	Limit
+	// Subtrees limits the entries below the directories it names further,
+	// the directories themselves not counted.
+	Subtrees map[string]Limit
+}
+
+// entry is what is charged for a file; entries are never modified, changes
+// replace them.
+type entry struct {
+	size int64
+	dir  bool
+}
+
+type usage struct {
+	bytes int64
+	files int
+}
+
+func (u *usage) add(e *entry, sign int) {
+	if e != nil {
+		u.bytes += int64(sign) * e.size
+		u.files += sign
+	}
+}
+
+// tree is a limited tree; the tree of the whole Fs has an empty dir.
+type tree struct {
+	dir   string
+	limit Limit
+	used  usage
+}
+
+func (t *tree) exceeds(d usage) bool {
+	return d.bytes > 0 && t.limit.MaxBytes > 0 && t.used.bytes+d.bytes > t.limit.MaxBytes ||
+		d.files > 0 && t.limit.MaxFiles > 0 && t.used.files+d.files > t.limit.MaxFiles
+}
+
+// below reports whether name is inside the directory dir.
+func (fs *Fs) below(name, dir string) bool {
+	if name == dir || !strings.HasPrefix(name, dir) {
+		return false
+	}
+	sep := afero.PathSeparatorOf(fs)
+	return strings.HasSuffix(dir, sep) || strings.HasPrefix(name[len(dir):], sep)
+}
+
+// covers reports whether name is in the tree t.
+func (fs *Fs) covers(t *tree, name string) bool {
+	return t.dir == "" || fs.below(name, t.dir)
+}
+
+// Fs passes all calls to its base Fs and fails those which would make a tree
+// exceed its limits with ENOSPC, in an *os.PathError or *os.LinkError.
+//
+// Only what is created through the Fs is charged: files are charged with
+// their size as soon as they are written through it, and the entries
+// already in the base can be charged with Scan. Changes made to the base
+// directly are not seen. Hard links are not supported.
+type Fs struct {
+	base afero.Fs
+
+	mu      sync.Mutex
+	trees   []*tree
+	entries map[string]*entry
+}
+
+var _ afero.Symlinker = (*Fs)(nil)
+
+// New returns an Fs enforcing limits on base.
+func New(base afero.Fs, limits QuotaConfig) *Fs {
+	fs := &Fs{
+		base:    base,
+		trees:   []*tree{{limit: limits.Limit}},
+		entries: map[string]*entry{},
+	}
+	for dir, limit := range limits.Subtrees {
+		fs.trees = append(fs.trees, &tree{dir: afero.Clean(fs, dir), limit: limit})
+	}
+	return fs
+}
+
+// Usage returns the number of bytes and files charged below path, or for
+// path itself if it is not a directory.
+func (fs *Fs) Usage(path string) (bytes int64, files int) {
+	path = afero.Clean(fs, path)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	for _, t := range fs.trees[1:] {
+		if t.dir == path {
+			return t.used.bytes, t.used.files
+		}
+	}
+	var u usage
+	for name, e := range fs.entries {
+		if fs.below(name, path) || name == path && !e.dir {
+			u.add(e, 1)
+		}
+	}
+	return u.bytes, u.files
+}
+
+// Scan charges the entries below the directory dir which are already in the
+// base Fs, for instance when a service restarts. They are charged even if
+// that exceeds the limits, but nothing can be added then until enough is
+// removed.
+func (fs *Fs) Scan(dir string) error {
+	dir = afero.Clean(fs, dir)
+	set := map[string]*entry{}
+	err := afero.Walk(fs.base, dir, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if name = afero.Clean(fs, name); name != dir {
+			set[name] = entryOf(info)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.commit(set, false)
+	return nil
+}
+
+func entryOf(info os.FileInfo) *entry {
+	if info.Mode().IsRegular() {
+		return &entry{size: info.Size()}
+	}
+	return &entry{dir: info.IsDir()}
+}
+
+// commit replaces the entries named in set, removing those set to nil. If
+// check is set and a tree would grow beyond its limits, nothing is changed
+// and ENOSPC returned. The caller holds fs.mu.
+func (fs *Fs) commit(set map[string]*entry, check bool) error {
+	d := make([]usage, len(fs.trees))
+	for name, e := range set {
+		for i, t := range fs.trees {
+			if fs.covers(t, name) {
+				d[i].add(fs.entries[name], -1)
+				d[i].add(e, 1)
+			}
+		}
+	}
+	if check {
+		for i, t := range fs.trees {
+			if t.exceeds(d[i]) {
+				return syscall.ENOSPC
+			}
+		}
+	}
+	for i, t := range fs.trees {
+		t.used.bytes += d[i].bytes
+		t.used.files += d[i].files
+	}
+	for name, e := range set {
+		if e == nil {
+			delete(fs.entries, name)
+		} else {
+			fs.entries[name] = e
+		}
+	}
+	return nil
+}
+
+// reserve charges the changes in set and returns a function taking them
+// back, for when the operation fails.
+func (fs *Fs) reserve(set map[string]*entry) (undo func(), err error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	old := make(map[string]*entry, len(set))
+	for name := range set {
+		old[name] = fs.entries[name]
+	}
+	if err := fs.commit(set, true); err != nil {
+		return nil, err
+	}
+	return func() {
+		fs.mu.Lock()
+		defer fs.mu.Unlock()
+		fs.commit(old, false)
+	}, nil
+}
+
+// do calls fn with the changes in set reserved.
+func (fs *Fs) do(set map[string]*entry, fn func() error) error {
+	undo, err := fs.reserve(set)
+	if err != nil {
+		return err
+	}
+	if err := fn(); err != nil {
+		undo()
+		return err
+	}
+	return nil
+}
+
+// forget drops the entries of name and below.
+func (fs *Fs) forget(name string) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	set := map[string]*entry{}
+	for n := range fs.entries {
+		if n == name || fs.below(n, name) {
+			set[n] = nil
+		}
+	}
+	fs.commit(set, false)
+}
+
+// extend charges the file name for growing to end bytes and returns its
+// previous size.
+func (fs *Fs) extend(name string, end int64) (int64, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	var size int64
+	if e := fs.entries[name]; e != nil {
+		size = e.size
+	}
+	if end <= size {
+		return size, nil
+	}
+	return size, fs.commit(map[string]*entry{name: {size: end}}, true)
+}
+
+// size returns the charged size of name.
+func (fs *Fs) size(name string) int64 {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if e := fs.entries[name]; e != nil {
+		return e.size
+	}
+	return 0
+}
+
+// settle sets the size of name from reserved, as charged by extend, to
+// size, unless it changed meanwhile.
+func (fs *Fs) settle(name string, reserved, size int64) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if e := fs.entries[name]; e != nil && e.size == reserved {
+		fs.commit(map[string]*entry{name: {size: size}}, false)
+	}
+}
+
+func (fs *Fs) Name() string { return "QuotaFs" }
+
+// Unwrap returns the base Fs, which is not limited.
+func (fs *Fs) Unwrap() afero.Fs {
+	return fs.base
+}
+
+func (fs *Fs) Create(name string) (afero.File, error) {
+	return fs.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o666)
+}
+
+func (fs *Fs) Mkdir(name string, perm os.FileMode) error {
+	name = afero.Clean(fs, name)
+	err := fs.do(map[string]*entry{name: {dir: true}}, func() error {
+		return fs.base.Mkdir(name, perm)
+	})
+	if errors.Is(err, syscall.ENOSPC) {
+		return &os.PathError{Op: "mkdir", Path: name, Err: err}
+	}
+	return err
+}
+
+func (fs *Fs) MkdirAll(path string, perm os.FileMode) error {
+	path = afero.Clean(fs, path)
+	set := map[string]*entry{}
+	for dir := path; ; dir = afero.Dir(fs, dir) {
+		if _, err := fs.base.Stat(dir); err == nil || !os.IsNotExist(err) {
+			break
+		}
+		set[dir] = &entry{dir: true}
+		if afero.Dir(fs, dir) == dir {
+			break
+		}
+	}
+	err := fs.do(set, func() error {
+		return fs.base.MkdirAll(path, perm)
+	})
+	if errors.Is(err, syscall.ENOSPC) {
+		return &os.PathError{Op: "mkdir", Path: path, Err: err}
+	}
+	return err
+}
+
+func (fs *Fs) Open(name string) (afero.File, error) {
+	return fs.base.Open(name)
+}
+
+// OpenFile charges files created or truncated. Files opened for writing are
+// wrapped to charge what is written to them.
+func (fs *Fs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) == 0 {
+		return fs.base.OpenFile(name, flag, perm)
+	}
+	name = afero.Clean(fs, name)
+	var e *entry
+	if info, err := fs.base.Stat(name); err == nil {
+		fs.adopt(name, info)
+		if flag&os.O_TRUNC != 0 && info.Mode().IsRegular() {
+			e = &entry{}
+		}
+	} else if os.IsNotExist(err) && flag&os.O_CREATE != 0 {
+		e = &entry{}
+	}
+	var f afero.File
+	open := func() (err error) {
+		f, err = fs.base.OpenFile(name, flag, perm)
+		return err
+	}
+	var err error
+	if e != nil {
+		err = fs.do(map[string]*entry{name: e}, open)
+	} else {
+		err = open()
+	}
+	if errors.Is(err, syscall.ENOSPC) {
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &File{File: f, fs: fs, name: name, flag: flag}, nil
+}
+
+// adopt charges the existing file name if it is not yet charged.
+func (fs *Fs) adopt(name string, info os.FileInfo) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.entries[name] == nil {
+		fs.commit(map[string]*entry{name: entryOf(info)}, false)
+	}
+}
+
+func (fs *Fs) Remove(name string) error {
+	if err := fs.base.Remove(name); err != nil {
+		return err
+	}
+	fs.forget(afero.Clean(fs, name))
+	return nil
+}
+
+func (fs *Fs) RemoveAll(path string) error {
+	if err := fs.base.RemoveAll(path); err != nil {
+		return err
+	}
+	fs.forget(afero.Clean(fs, path))
+	return nil
+}
+
+// Rename moves the charges of oldname and the entries below it. It fails if
+// the tree it moves them to has no room for them.
+func (fs *Fs) Rename(oldname, newname string) error {
+	src, dst := afero.Clean(fs, oldname), afero.Clean(fs, newname)
+	fs.mu.Lock()
+	set := map[string]*entry{}
+	if _, ok := fs.entries[dst]; ok {
+		set[dst] = nil
+	}
+	for name, e := range fs.entries {
+		if name == src || fs.below(name, src) {
+			set[name] = nil
+			set[dst+name[len(src):]] = e
+		}
+	}
+	fs.mu.Unlock()
+	if src == dst {
+		return fs.base.Rename(oldname, newname)
+	}
+	err := fs.do(set, func() error {
+		return fs.base.Rename(oldname, newname)
+	})
+	if errors.Is(err, syscall.ENOSPC) {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err}
+	}
+	return err
+}
+
+func (fs *Fs) Stat(name string) (os.FileInfo, error) {
+	return fs.base.Stat(name)
+}
+
+func (fs *Fs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	if lfs, ok := fs.base.(afero.Lstater); ok {
+		return lfs.LstatIfPossible(name)
+	}
+	fi, err := fs.base.Stat(name)
+	return fi, false, err
+}
+
+func (fs *Fs) SymlinkIfPossible(oldname, newname string) error {
+	linker, ok := fs.base.(afero.Linker)
+	if !ok {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: afero.ErrNoSymlink}
+	}
+	err := fs.do(map[string]*entry{afero.Clean(fs, newname): {}}, func() error {
+		return linker.SymlinkIfPossible(oldname, newname)
+	})
+	if errors.Is(err, syscall.ENOSPC) {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: err}
+	}
+	return err
+}
+
+func (fs *Fs) ReadlinkIfPossible(name string) (string, error) {
+	if reader, ok := fs.base.(afero.LinkReader); ok {
+		return reader.ReadlinkIfPossible(name)
+	}
+	return "", &os.PathError{Op: "readlink", Path: name, Err: afero.ErrNoReadlink}
+}
+
+func (fs *Fs) Chmod(name string, mode os.FileMode) error {
+	return fs.base.Chmod(name, mode)
+}
+
+func (fs *Fs) Chown(name string, uid, gid int) error {
+	return fs.base.Chown(name, uid, gid)
+}
+
+func (fs *Fs) Chtimes(name string, atime, mtime time.Time) error {
+	return fs.base.Chtimes(name, atime, mtime)
+}
@@ -0,0 +1,139 @@
+package quotafs
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/spf13/afero/aferotest"
+)
+
+func TestBytesAndFiles(t *testing.T) {
+	fs := New(afero.NewMemMapFs(), QuotaConfig{Limit: Limit{MaxBytes: 10, MaxFiles: 3}})
+
+	f, err := fs.Create("/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("123456")); err != nil {
+		t.Fatal(err)
+	}
+	// rewriting what is there is free
+	f.Seek(0, 0)
+	if _, err := f.Write([]byte("abcdef")); err != nil {
+		t.Fatal(err)
+	}
+	n, err := f.Write([]byte("ghijk"))
+	var pe *os.PathError
+	if n != 0 || !errors.As(err, &pe) || !errors.Is(err, syscall.ENOSPC) {
+		t.Errorf("write beyond MaxBytes = %d, %v", n, err)
+	}
+	if _, err := f.WriteAt([]byte("ghij"), 6); err != nil {
+		t.Errorf("write up to MaxBytes = %v", err)
+	}
+	f.Close()
+	if bytes, files := fs.Usage("/"); bytes != 10 || files != 1 {
+		t.Errorf("Usage = %d, %d", bytes, files)
+	}
+
+	fs.Mkdir("/d", 0o755)
+	afero.WriteFile(fs, "/d/b", nil, 0o644)
+	if _, err := fs.Create("/d/c"); !errors.Is(err, syscall.ENOSPC) {
+		t.Errorf("Create beyond MaxFiles = %v", err)
+	}
+	if _, err := fs.Stat("/d/c"); !os.IsNotExist(err) {
+		t.Errorf("the rejected file was created: %v", err)
+	}
+
+	// truncating and removing release the quota
+	if err := afero.WriteFile(fs, "/a", []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fs.RemoveAll("/d")
+	if bytes, files := fs.Usage("/"); bytes != 1 || files != 1 {
+		t.Errorf("Usage after truncating and removing = %d, %d", bytes, files)
+	}
+	if err := fs.MkdirAll("/x/y", 0o755); err != nil {
+		t.Errorf("MkdirAll of two directories = %v", err)
+	}
+	if err := fs.MkdirAll("/x/y/z/w", 0o755); !errors.Is(err, syscall.ENOSPC) {
+		t.Errorf("MkdirAll beyond MaxFiles = %v", err)
+	}
+}
+
+func TestSubtrees(t *testing.T) {
+	base := afero.NewMemMapFs()
+	base.MkdirAll("/tenants/a", 0o755)
+	base.MkdirAll("/tenants/b", 0o755)
+	afero.WriteFile(base, "/tenants/a/old", []byte("1234"), 0o644)
+	fs := New(base, QuotaConfig{Subtrees: map[string]Limit{
+		"/tenants/a": {MaxBytes: 8},
+		"/tenants/b": {MaxBytes: 100},
+	}})
+	if err := fs.Scan("/tenants"); err != nil {
+		t.Fatal(err)
+	}
+	if bytes, files := fs.Usage("/tenants/a"); bytes != 4 || files != 1 {
+		t.Errorf("Usage of a after Scan = %d, %d", bytes, files)
+	}
+
+	if err := afero.WriteFile(fs, "/tenants/a/new", []byte("12345"), 0o644); !errors.Is(err, syscall.ENOSPC) {
+		t.Errorf("write beyond the limit of a = %v", err)
+	}
+	if err := afero.WriteFile(fs, "/tenants/b/new", []byte("12345"), 0o644); err != nil {
+		t.Errorf("write to b = %v", err)
+	}
+	if err := afero.WriteFile(fs, "/other", []byte("123456789"), 0o644); err != nil {
+		t.Errorf("write outside the subtrees = %v", err)
+	}
+
+	// moving b/new into a would exceed the limit of a
+	var le *os.LinkError
+	if err := fs.Rename("/tenants/b/new", "/tenants/a/new"); !errors.As(err, &le) || !errors.Is(err, syscall.ENOSPC) {
+		t.Errorf("Rename into a full subtree = %v", err)
+	}
+	if err := fs.Rename("/tenants/a/old", "/tenants/b/old"); err != nil {
+		t.Fatal(err)
+	}
+	if bytes, _ := fs.Usage("/tenants/b"); bytes != 9 {
+		t.Errorf("Usage of b after Rename = %d", bytes)
+	}
+	if bytes, _ := fs.Usage("/tenants/b/old"); bytes != 4 {
+		t.Errorf("Usage of the renamed file = %d", bytes)
+	}
+	// the failed write left an empty file, as on a full disk
+	if bytes, files := fs.Usage("/tenants/a"); bytes != 0 || files != 1 {
+		t.Errorf("Usage of a after Rename = %d, %d", bytes, files)
+	}
+}
+
+func TestAppend(t *testing.T) {
+	fs := New(afero.NewMemMapFs(), QuotaConfig{Limit: Limit{MaxBytes: 6}})
+	afero.WriteFile(fs, "/log", []byte("abc"), 0o644)
+	f, err := fs.OpenFile("/log", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.Write([]byte("def")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("g")); !errors.Is(err, syscall.ENOSPC) {
+		t.Errorf("append beyond MaxBytes = %v", err)
+	}
+	if err := f.Truncate(2); err != nil {
+		t.Fatal(err)
+	}
+	if bytes, _ := fs.Usage("/log"); bytes != 2 {
+		t.Errorf("Usage after Truncate = %d", bytes)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	newFs := func(t *testing.T) afero.Fs {
+		return New(afero.NewMemMapFs(), QuotaConfig{})
+	}
+	aferotest.Conformance(t, newFs, afero.Capabilities(newFs(t)))
+}
@@ -1,19 +1,66 @@
 package afero
 
 import (
+	"io"
+	"io/fs"
 	"os"
 	"syscall"
 	"time"
 )
 
-var _ Lstater = (*ReadOnlyFs)(nil)
+var (
+	_ Lstater        = (*ReadOnlyFs)(nil)
+	_ fs.ReadDirFile = (*ReadOnlyFile)(nil)
+)
 
+// ReadOnlyFs is a read-only view of its source. All mutations fail with an
+// *os.PathError or *os.LinkError, by default wrapping syscall.EPERM.
 type ReadOnlyFs struct {
 	source Fs
+	err    error
+	audit  func(err error)
+}
+
+// ReadOnlyOption configures a ReadOnlyFs.
+type ReadOnlyOption func(*ReadOnlyFs)
+
+// ReadOnlyError sets the error wrapped by the errors of rejected mutations,
+// e.g. syscall.EROFS to report a read-only file system like a read-only
+// mount does. The default is syscall.EPERM.
+func ReadOnlyError(err error) ReadOnlyOption {
+	return func(r *ReadOnlyFs) { r.err = err }
+}
+
+// ReadOnlyAudit calls audit with the error of every rejected mutation,
+// writes through open files included, e.g. to log attempted writes. It
+// must be safe for concurrent use.
+func ReadOnlyAudit(audit func(err error)) ReadOnlyOption {
+	return func(r *ReadOnlyFs) { r.audit = audit }
+}
+
+func NewReadOnlyFs(source Fs, opts ...ReadOnlyOption) Fs {
+	r := &ReadOnlyFs{source: source}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
 }
 
-func NewReadOnlyFs(source Fs) Fs {
-	return &ReadOnlyFs{source: source}
+// denied returns the error rejecting op on name and reports it. r may be
+// nil, for the defaults.
+func (r *ReadOnlyFs) denied(op, name string) error {
+	var errno error = syscall.EPERM
+	if r != nil && r.err != nil {
+		errno = r.err
+	}
+	return r.report(&os.PathError{Op: op, Path: name, Err: errno})
+}
+
+func (r *ReadOnlyFs) report(err error) error {
+	if r != nil && r.audit != nil {
+		r.audit(err)
+	}
+	return err
 }
 
 func (r *ReadOnlyFs) ReadDir(name string) ([]os.FileInfo, error) {
@@ -21,21 +68,31 @@ func (r *ReadOnlyFs) ReadDir(name string) ([]os.FileInfo, error) {
 }
 
 func (r *ReadOnlyFs) Chtimes(n string, a, m time.Time) error {
-	return syscall.EPERM
+	return r.denied("chtimes", n)
 }
 
 func (r *ReadOnlyFs) Chmod(n string, m os.FileMode) error {
-	return syscall.EPERM
+	return r.denied("chmod", n)
 }
 
 func (r *ReadOnlyFs) Chown(n string, uid, gid int) error {
-	return syscall.EPERM
+	return r.denied("chown", n)
 }
 
 func (r *ReadOnlyFs) Name() string {
 	return "ReadOnlyFilter"
 }
 
+// Unwrap returns the writable Fs r protects.
+func (r *ReadOnlyFs) Unwrap() Fs {
+	return r.source
+}
+
+// Capabilities returns the reading capabilities of the source.
+func (r *ReadOnlyFs) Capabilities() Capability {
+	return Capabilities(r.source) & (CapLstat | CapReadlink | CapLock | CapXattr | CapReadAt)
+}
+
 func (r *ReadOnlyFs) Stat(name string) (os.FileInfo, error) {
 	return r.source.Stat(name)
 }
@@ -48,8 +105,34 @@ func (r *ReadOnlyFs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
 	return fi, false, err
 }
 
+// LockIfPossible forwards to the source, exclusive locks included, since
+// locks do not modify files.
+func (r *ReadOnlyFs) LockIfPossible(name string, exclusive bool) (io.Closer, bool, error) {
+	return lockIfPossible(r.source, name, exclusive)
+}
+
+func (r *ReadOnlyFs) GetXattr(name, attr string) ([]byte, error) {
+	return GetXattr(r.source, name, attr)
+}
+
+func (r *ReadOnlyFs) SetXattr(name, attr string, value []byte) error {
+	return r.denied("setxattr", name)
+}
+
+func (r *ReadOnlyFs) ListXattr(name string) ([]string, error) {
+	return ListXattr(r.source, name)
+}
+
+func (r *ReadOnlyFs) RemoveXattr(name, attr string) error {
+	return r.denied("removexattr", name)
+}
+
 func (r *ReadOnlyFs) SymlinkIfPossible(oldname, newname string) error {
-	return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: ErrNoSymlink}
+	return r.report(&os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: ErrNoSymlink})
+}
+
+func (r *ReadOnlyFs) LinkIfPossible(oldname, newname string) error {
+	return r.report(&os.LinkError{Op: "link", Old: oldname, New: newname, Err: ErrNoLink})
 }
 
 func (r *ReadOnlyFs) ReadlinkIfPossible(name string) (string, error) {
@@ -61,36 +144,93 @@ func (r *ReadOnlyFs) ReadlinkIfPossible(name string) (string, error) {
 }
 
 func (r *ReadOnlyFs) Rename(o, n string) error {
-	return syscall.EPERM
+	return r.denied("rename", o)
 }
 
 func (r *ReadOnlyFs) RemoveAll(p string) error {
-	return syscall.EPERM
+	return r.denied("RemoveAll", p)
 }
 
 func (r *ReadOnlyFs) Remove(n string) error {
-	return syscall.EPERM
+	return r.denied("remove", n)
 }
 
 func (r *ReadOnlyFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
 	if flag&(os.O_WRONLY|syscall.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) != 0 {
-		return nil, syscall.EPERM
+		return nil, r.denied("open", name)
 	}
-	return r.source.OpenFile(name, flag, perm)
+	return r.file(r.source.OpenFile(name, flag, perm))
 }
 
 func (r *ReadOnlyFs) Open(n string) (File, error) {
-	return r.source.Open(n)
+	return r.file(r.source.Open(n))
 }
 
 func (r *ReadOnlyFs) Mkdir(n string, p os.FileMode) error {
-	return syscall.EPERM
+	return r.denied("mkdir", n)
 }
 
 func (r *ReadOnlyFs) MkdirAll(n string, p os.FileMode) error {
-	return syscall.EPERM
+	return r.denied("mkdir", n)
 }
 
 func (r *ReadOnlyFs) Create(n string) (File, error) {
-	return nil, syscall.EPERM
+	return nil, r.denied("open", n)
+}
+
+// ReadOnlyFile is returned by ReadOnlyFs. It rejects all writes like the
+// ReadOnlyFs does, with EPERM by default, even if the source returned a
+// file which is open for writing.
+type ReadOnlyFile struct {
+	File
+	fs *ReadOnlyFs
+}
+
+// readOnlyFile wraps the result of an Open in a ReadOnlyFile.
+func readOnlyFile(f File, err error) (File, error) {
+	return (*ReadOnlyFs)(nil).file(f, err)
+}
+
+// file wraps the result of an Open in a ReadOnlyFile rejecting writes like
+// r does.
+func (r *ReadOnlyFs) file(f File, err error) (File, error) {
+	if err != nil {
+		return nil, err
+	}
+	return &ReadOnlyFile{File: f, fs: r}, nil
+}
+
+func (f *ReadOnlyFile) denied(op string) error {
+	return f.fs.denied(op, f.Name())
+}
+
+func (f *ReadOnlyFile) Write(p []byte) (int, error) {
+	return 0, f.denied("write")
+}
+
+func (f *ReadOnlyFile) WriteAt(p []byte, off int64) (int, error) {
+	return 0, f.denied("write")
+}
+
+func (f *ReadOnlyFile) WriteString(s string) (int, error) {
+	return 0, f.denied("write")
+}
+
+func (f *ReadOnlyFile) Truncate(size int64) error {
+	return f.denied("truncate")
+}
+
+func (f *ReadOnlyFile) ReadFrom(r io.Reader) (int64, error) {
+	return 0, f.denied("write")
+}
+
+func (f *ReadOnlyFile) WriteTo(w io.Writer) (int64, error) {
+	return writeTo(f.File, w)
+}
+
+func (f *ReadOnlyFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if rdf, ok := f.File.(fs.ReadDirFile); ok {
+		return rdf.ReadDir(n)
+	}
+	return readDirFile{f.File}.ReadDir(n)
 }
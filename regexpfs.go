@@ -1,6 +1,7 @@
 package afero
 
 import (
+	"io"
 	"os"
 	"regexp"
 	"syscall"
@@ -9,7 +10,8 @@ import (
 
 // The RegexpFs filters files (not directories) by regular expression. Only
 // files matching the given regexp will be allowed, all others get a ENOENT error (
-// "No such file or directory").
+// "No such file or directory"). See FilterFs for more than one pattern and
+// for filtering directories.
 type RegexpFs struct {
 	re     *regexp.Regexp
 	source Fs
@@ -24,17 +26,17 @@ type RegexpFile struct {
 	re *regexp.Regexp
 }
 
-func (r *RegexpFs) matchesName(name string) error {
+func (r *RegexpFs) matchesName(op, name string) error {
 	if r.re == nil {
 		return nil
 	}
 	if r.re.MatchString(name) {
 		return nil
 	}
-	return syscall.ENOENT
+	return &os.PathError{Op: op, Path: name, Err: syscall.ENOENT}
 }
 
-func (r *RegexpFs) dirOrMatches(name string) error {
+func (r *RegexpFs) dirOrMatches(op, name string) error {
 	dir, err := IsDir(r.source, name)
 	if err != nil {
 		return err
@@ -42,25 +44,25 @@ func (r *RegexpFs) dirOrMatches(name string) error {
 	if dir {
 		return nil
 	}
-	return r.matchesName(name)
+	return r.matchesName(op, name)
 }
 
 func (r *RegexpFs) Chtimes(name string, a, m time.Time) error {
-	if err := r.dirOrMatches(name); err != nil {
+	if err := r.dirOrMatches("chtimes", name); err != nil {
 		return err
 	}
 	return r.source.Chtimes(name, a, m)
 }
 
 func (r *RegexpFs) Chmod(name string, mode os.FileMode) error {
-	if err := r.dirOrMatches(name); err != nil {
+	if err := r.dirOrMatches("chmod", name); err != nil {
 		return err
 	}
 	return r.source.Chmod(name, mode)
 }
 
 func (r *RegexpFs) Chown(name string, uid, gid int) error {
-	if err := r.dirOrMatches(name); err != nil {
+	if err := r.dirOrMatches("chown", name); err != nil {
 		return err
 	}
 	return r.source.Chown(name, uid, gid)
@@ -70,8 +72,20 @@ func (r *RegexpFs) Name() string {
 	return "RegexpFs"
 }
 
+// Unwrap returns the source Fs, which lists all files whatever their
+// names.
+func (r *RegexpFs) Unwrap() Fs {
+	return r.source
+}
+
+// Capabilities returns CapAtomicRename and CapReadAt of the source, the
+// optional interfaces are not implemented.
+func (r *RegexpFs) Capabilities() Capability {
+	return Capabilities(r.source) & (CapAtomicRename | CapReadAt)
+}
+
 func (r *RegexpFs) Stat(name string) (os.FileInfo, error) {
-	if err := r.dirOrMatches(name); err != nil {
+	if err := r.dirOrMatches("stat", name); err != nil {
 		return nil, err
 	}
 	return r.source.Stat(name)
@@ -85,10 +99,10 @@ func (r *RegexpFs) Rename(oldname, newname string) error {
 	if dir {
 		return nil
 	}
-	if err := r.matchesName(oldname); err != nil {
+	if err := r.matchesName("rename", oldname); err != nil {
 		return err
 	}
-	if err := r.matchesName(newname); err != nil {
+	if err := r.matchesName("rename", newname); err != nil {
 		return err
 	}
 	return r.source.Rename(oldname, newname)
@@ -100,7 +114,7 @@ func (r *RegexpFs) RemoveAll(p string) error {
 		return err
 	}
 	if !dir {
-		if err := r.matchesName(p); err != nil {
+		if err := r.matchesName("RemoveAll", p); err != nil {
 			return err
 		}
 	}
@@ -108,14 +122,14 @@ func (r *RegexpFs) RemoveAll(p string) error {
 }
 
 func (r *RegexpFs) Remove(name string) error {
-	if err := r.dirOrMatches(name); err != nil {
+	if err := r.dirOrMatches("remove", name); err != nil {
 		return err
 	}
 	return r.source.Remove(name)
 }
 
 func (r *RegexpFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
-	if err := r.dirOrMatches(name); err != nil {
+	if err := r.dirOrMatches("open", name); err != nil {
 		return nil, err
 	}
 	return r.source.OpenFile(name, flag, perm)
@@ -127,7 +141,7 @@ func (r *RegexpFs) Open(name string) (File, error) {
 		return nil, err
 	}
 	if !dir {
-		if err := r.matchesName(name); err != nil {
+		if err := r.matchesName("open", name); err != nil {
 			return nil, err
 		}
 	}
@@ -147,7 +161,7 @@ func (r *RegexpFs) MkdirAll(n string, p os.FileMode) error {
 }
 
 func (r *RegexpFs) Create(name string) (File, error) {
-	if err := r.matchesName(name); err != nil {
+	if err := r.matchesName("open", name); err != nil {
 		return nil, err
 	}
 	return r.source.Create(name)
@@ -177,22 +191,36 @@ func (f *RegexpFile) WriteAt(s []byte, o int64) (int, error) {
 	return f.f.WriteAt(s, o)
 }
 
+func (f *RegexpFile) ReadFrom(r io.Reader) (int64, error) {
+	return readFrom(f.f, r)
+}
+
+func (f *RegexpFile) WriteTo(w io.Writer) (int64, error) {
+	return writeTo(f.f, w)
+}
+
 func (f *RegexpFile) Name() string {
 	return f.f.Name()
 }
 
+// Readdir leaves out the files not matching. For c > 0 it reads on until at
+// least one entry matches, so an empty result always comes with an error.
 func (f *RegexpFile) Readdir(c int) (fi []os.FileInfo, err error) {
-	var rfi []os.FileInfo
-	rfi, err = f.f.Readdir(c)
-	if err != nil {
-		return nil, err
-	}
-	for _, i := range rfi {
-		if i.IsDir() || f.re.MatchString(i.Name()) {
-			fi = append(fi, i)
+	for {
+		var rfi []os.FileInfo
+		rfi, err = f.f.Readdir(c)
+		if err != nil {
+			return nil, err
+		}
+		for _, i := range rfi {
+			if i.IsDir() || f.re.MatchString(i.Name()) {
+				fi = append(fi, i)
+			}
+		}
+		if len(fi) > 0 || c <= 0 || len(rfi) == 0 {
+			return fi, nil
 		}
 	}
-	return fi, nil
 }
 
 func (f *RegexpFile) Readdirnames(c int) (n []string, err error) {
@@ -0,0 +1,115 @@
+package afero
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// SchemeFactory creates the Fs for a URL passed to OpenURL.
+type SchemeFactory func(ctx context.Context, u *url.URL) (Fs, error)
+
+// ErrUnknownScheme is wrapped by the errors of OpenURL for URLs whose
+// scheme is not registered.
+var ErrUnknownScheme = errors.New("unknown URL scheme")
+
+var (
+	schemesMu sync.RWMutex
+	schemes   = map[string]SchemeFactory{}
+)
+
+// RegisterScheme makes factory create the Fs of the URLs with scheme in
+// OpenURL. The backends in subpackages register their schemes when they
+// are imported, as database/sql drivers do, so an application choosing
+// its backend by configuration imports those it supports:
+//
+//	import _ "github.com/spf13/afero/gcsfs"
+//
+// A factory should return an Fs rooted at the path of the URL, or the
+// whole backend if the path is empty or "/". RegisterScheme panics if the
+// scheme is already registered.
+func RegisterScheme(scheme string, factory SchemeFactory) {
+	schemesMu.Lock()
+	defer schemesMu.Unlock()
+	if factory == nil {
+		panic("afero: RegisterScheme factory is nil")
+	}
+	if _, dup := schemes[scheme]; dup {
+		panic("afero: RegisterScheme called twice for scheme " + scheme)
+	}
+	schemes[scheme] = factory
+}
+
+// Schemes returns the registered schemes, sorted.
+func Schemes() []string {
+	schemesMu.RLock()
+	defer schemesMu.RUnlock()
+	list := make([]string, 0, len(schemes))
+	for scheme := range schemes {
+		list = append(list, scheme)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// OpenURL returns the Fs for rawURL, created by the factory registered for
+// its scheme. This package registers
+//
+//	os:///path, file:///path        the OsFs, rooted at path
+//	mem://?maxBytes=n&maxFiles=n    a new MemMapFs, with optional limits
+//
+// and the backends in subpackages register theirs, e.g. gs://bucket/prefix
+// for gcsfs; see their documentation.
+func OpenURL(ctx context.Context, rawURL string) (Fs, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	schemesMu.RLock()
+	factory := schemes[u.Scheme]
+	schemesMu.RUnlock()
+	if factory == nil {
+		return nil, fmt.Errorf("afero: %w %q", ErrUnknownScheme, u.Scheme)
+	}
+	return factory(ctx, u)
+}
+
+// rootAt returns fs rooted at the path of u.
+func rootAt(fs Fs, u *url.URL) Fs {
+	if u.Path == "" || u.Path == "/" {
+		return fs
+	}
+	return NewBasePathFs(fs, u.Path)
+}
+
+func init() {
+	osFactory := func(_ context.Context, u *url.URL) (Fs, error) {
+		return rootAt(NewOsFs(), u), nil
+	}
+	RegisterScheme("os", osFactory)
+	RegisterScheme("file", osFactory)
+	RegisterScheme("mem", func(_ context.Context, u *url.URL) (Fs, error) {
+		q := u.Query()
+		var maxBytes int64
+		var maxFiles int
+		var err error
+		if v := q.Get("maxBytes"); v != "" {
+			if maxBytes, err = strconv.ParseInt(v, 10, 64); err != nil {
+				return nil, fmt.Errorf("afero: mem URL: maxBytes: %w", err)
+			}
+		}
+		if v := q.Get("maxFiles"); v != "" {
+			if maxFiles, err = strconv.Atoi(v); err != nil {
+				return nil, fmt.Errorf("afero: mem URL: maxFiles: %w", err)
+			}
+		}
+		if maxBytes == 0 && maxFiles == 0 {
+			return rootAt(NewMemMapFs(), u), nil
+		}
+		return rootAt(NewMemMapFsWithLimits(maxBytes, maxFiles), u), nil
+	})
+}
@@ -0,0 +1,71 @@
+package afero
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenURL(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "file"), []byte("data"), 0o644)
+
+	fs, err := OpenURL(ctx, "os://"+filepath.ToSlash(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ReadFile(fs, "/file"); err != nil || string(data) != "data" {
+		t.Errorf("ReadFile of the rooted OsFs = %q, %v", data, err)
+	}
+
+	fs, err = OpenURL(ctx, "mem://?maxBytes=4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(fs, "/big", []byte("12345"), 0o644); !errors.Is(err, errNoSpace) {
+		t.Errorf("write beyond maxBytes = %v", err)
+	}
+	if _, err := OpenURL(ctx, "mem://?maxFiles=x"); err == nil {
+		t.Error("an invalid maxFiles was accepted")
+	}
+	if _, err := OpenURL(ctx, "nope://bucket"); !errors.Is(err, ErrUnknownScheme) {
+		t.Errorf("OpenURL of an unknown scheme = %v", err)
+	}
+}
+
+func TestRegisterScheme(t *testing.T) {
+	var got *url.URL
+	RegisterScheme("test-registry", func(_ context.Context, u *url.URL) (Fs, error) {
+		got = u
+		return NewMemMapFs(), nil
+	})
+	defer func() {
+		schemesMu.Lock()
+		delete(schemes, "test-registry")
+		schemesMu.Unlock()
+	}()
+	if _, err := OpenURL(context.Background(), "test-registry://host/prefix?opt=1"); err != nil {
+		t.Fatal(err)
+	}
+	if got.Host != "host" || got.Path != "/prefix" || got.Query().Get("opt") != "1" {
+		t.Errorf("the factory got %v", got)
+	}
+	found := false
+	for _, s := range Schemes() {
+		found = found || s == "test-registry"
+	}
+	if !found {
+		t.Errorf("Schemes() = %v", Schemes())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a scheme twice did not panic")
+		}
+	}()
+	RegisterScheme("mem", func(context.Context, *url.URL) (Fs, error) { return nil, nil })
+}
@@ -0,0 +1,123 @@
+package afero
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// ErrCrossDevice is wrapped in an *os.LinkError by Rename when oldname and
+// newname cannot be renamed into each other, e.g. because they are on
+// different devices or in different layers of a composite filesystem. It is
+// syscall.EXDEV, so it also matches the errors of the os package.
+// RenameOrCopy falls back to copying in this case.
+var ErrCrossDevice error = errCrossDevice
+
+// RenameOrCopy renames oldname to newname. If fs cannot rename them into
+// each other and reports ErrCrossDevice, RenameOrCopy copies oldname to
+// newname, recursively for directories, and then removes oldname.
+//
+// Every file is copied to a temporary file next to its new name, synced
+// and then renamed, so newname never holds a partially written file. If
+// copying fails, what was copied is removed again and oldname is kept.
+func RenameOrCopy(fs Fs, oldname, newname string) error {
+	err := fs.Rename(oldname, newname)
+	if !errors.Is(err, ErrCrossDevice) {
+		return err
+	}
+	if err := copyRecursive(fs, oldname, newname); err != nil {
+		return err
+	}
+	return fs.RemoveAll(oldname)
+}
+
+func (a Afero) RenameOrCopy(oldname, newname string) error {
+	return RenameOrCopy(a.Fs, oldname, newname)
+}
+
+// copyRecursive copies oldname to newname within fs, keeping modes, times and,
+// if fs supports them, symlinks.
+func copyRecursive(fs Fs, oldname, newname string) error {
+	fi, err := lstatIfPossible(fs, oldname)
+	if err != nil {
+		return err
+	}
+	switch {
+	case fi.Mode()&os.ModeSymlink != 0:
+		if r, ok := fs.(LinkReader); ok {
+			if l, ok := fs.(Linker); ok {
+				target, err := r.ReadlinkIfPossible(oldname)
+				if err != nil {
+					return err
+				}
+				return l.SymlinkIfPossible(target, newname)
+			}
+		}
+		return copySynced(fs, oldname, newname)
+	case fi.IsDir():
+		// writable until it is filled
+		if err := fs.Mkdir(newname, 0o700); err != nil {
+			return err
+		}
+		names, err := readDirNames(fs, oldname)
+		if err == nil {
+			for _, name := range names {
+				if err = copyRecursive(fs, filepath.Join(oldname, name), filepath.Join(newname, name)); err != nil {
+					break
+				}
+			}
+		}
+		if err == nil {
+			err = fs.Chmod(newname, fi.Mode().Perm())
+		}
+		if err == nil {
+			err = fs.Chtimes(newname, fi.ModTime(), fi.ModTime())
+		}
+		if err != nil {
+			fs.RemoveAll(newname)
+		}
+		return err
+	default:
+		return copySynced(fs, oldname, newname)
+	}
+}
+
+// copySynced copies the file oldname to a temporary file, syncs it and
+// renames it to newname.
+func copySynced(fs Fs, oldname, newname string) error {
+	dir, base := filepath.Split(newname)
+	if dir == "" {
+		dir = "."
+	}
+	f, err := TempFile(fs, dir, "."+base+".tmp*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	f.Close()
+
+	err = copyFileTo(fs, tmp, fs, oldname, &copyOptions{strictMetadata: true})
+	if err == nil {
+		err = syncToDisk(fs, tmp)
+	}
+	if err == nil {
+		err = fs.Rename(tmp, newname)
+	}
+	if err != nil {
+		fs.Remove(tmp)
+	}
+	return err
+}
+
+// syncToDisk calls Sync on the file name.
+func syncToDisk(fs Fs, name string) error {
+	f, err := fs.OpenFile(name, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	err = f.Sync()
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,85 @@
+package afero
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+// mountsFs pretends that every top level directory is a separate device.
+type mountsFs struct {
+	*MemMapFs
+	renames int
+}
+
+func (m *mountsFs) Rename(oldname, newname string) error {
+	m.renames++
+	mount := func(name string) string { return strings.SplitN(strings.TrimPrefix(name, "/"), "/", 2)[0] }
+	if mount(oldname) != mount(newname) {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: ErrCrossDevice}
+	}
+	return m.MemMapFs.Rename(oldname, newname)
+}
+
+func TestRenameOrCopy(t *testing.T) {
+	mem := NewMemMapFs()
+	fs := &mountsFs{MemMapFs: mem.(*MemMapFs)}
+	mem.MkdirAll("/a/dir/sub", 0o755)
+	mem.MkdirAll("/b", 0o755)
+	WriteFile(mem, "/a/dir/sub/file", []byte("content"), 0o600)
+	mem.(Linker).SymlinkIfPossible("sub/file", "/a/dir/link")
+	mem.Chmod("/a/dir", 0o750)
+
+	if err := RenameOrCopy(fs, "/a/dir", "/a/same"); err != nil || fs.renames != 1 {
+		t.Fatalf("RenameOrCopy on one device = %v after %d renames", err, fs.renames)
+	}
+	if err := RenameOrCopy(fs, "/a/same", "/b/dir"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mem.Stat("/a/same"); !os.IsNotExist(err) {
+		t.Errorf("source still exists: %v", err)
+	}
+	if data, err := ReadFile(mem, "/b/dir/link"); err != nil || string(data) != "content" {
+		t.Errorf("ReadFile through the link = %q, %v", data, err)
+	}
+	if target, err := mem.(LinkReader).ReadlinkIfPossible("/b/dir/link"); err != nil || target != "sub/file" {
+		t.Errorf("link target = %q, %v", target, err)
+	}
+	for name, perm := range map[string]os.FileMode{"/b/dir": 0o750, "/b/dir/sub/file": 0o600} {
+		if fi, err := mem.Stat(name); err != nil || fi.Mode().Perm() != perm {
+			t.Errorf("%s: mode %v, %v, want %v", name, fi.Mode().Perm(), err, perm)
+		}
+	}
+	if names, _ := readDirNames(mem, "/b/dir/sub"); len(names) != 1 {
+		t.Errorf("temporary files left: %v", names)
+	}
+
+	if err := RenameOrCopy(fs, "/a/missing", "/b/missing"); !os.IsNotExist(err) {
+		t.Errorf("RenameOrCopy of a missing file = %v, want not exist", err)
+	}
+}
+
+func TestRenameOrCopyCopyOnWrite(t *testing.T) {
+	base := NewMemMapFs()
+	WriteFile(base, "/file", []byte("base"), 0o644)
+	ufs := NewCopyOnWriteFs(NewReadOnlyFs(base), NewMemMapFs())
+
+	err := ufs.Rename("/file", "/moved")
+	var le *os.LinkError
+	if !errors.As(err, &le) || !errors.Is(err, errCrossDevice) {
+		t.Fatalf("Rename of a base file = %v, want EXDEV", err)
+	}
+	if err := RenameOrCopy(ufs, "/file", "/moved"); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ReadFile(ufs, "/moved"); err != nil || string(data) != "base" {
+		t.Errorf("moved file = %q, %v", data, err)
+	}
+	if _, err := ufs.Stat("/file"); !os.IsNotExist(err) {
+		t.Errorf("renamed file still visible: %v", err)
+	}
+	if _, err := base.Stat("/file"); err != nil {
+		t.Errorf("base was changed: %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+package retryfs
+
+import (
+	"os"
+
+	"github.com/spf13/afero"
+)
+
+// File is a file opened from a Fs.
+type File struct {
+	afero.File
+	fs     *Fs
+	reopen func() (afero.File, error)
+	// listed is set once Readdir or Readdirnames was called.
+	listed bool
+}
+
+func (f *File) ReadAt(p []byte, off int64) (n int, err error) {
+	err = f.fs.read(func() error {
+		n, err = f.File.ReadAt(p, off)
+		return err
+	})
+	return n, err
+}
+
+func (f *File) WriteAt(p []byte, off int64) (n int, err error) {
+	err = f.fs.write("File.WriteAt", func() error {
+		n, err = f.File.WriteAt(p, off)
+		return err
+	})
+	return n, err
+}
+
+func (f *File) Stat() (fi os.FileInfo, err error) {
+	err = f.fs.read(func() error {
+		fi, err = f.File.Stat()
+		return err
+	})
+	return fi, err
+}
+
+// list calls fn, retrying a full listing on a reopened file, since the
+// failed attempt may have moved the position in the directory.
+func (f *File) list(count int, fn func(afero.File) error) error {
+	first := !f.listed
+	f.listed = true
+	if count > 0 || !first {
+		return fn(f.File)
+	}
+	retry := false
+	return f.fs.read(func() error {
+		if retry {
+			nf, err := f.reopen()
+			if err != nil {
+				return err
+			}
+			f.File.Close()
+			f.File = nf
+		}
+		retry = true
+		return fn(f.File)
+	})
+}
+
+func (f *File) Readdir(count int) (fis []os.FileInfo, err error) {
+	err = f.list(count, func(file afero.File) error {
+		fis, err = file.Readdir(count)
+		return err
+	})
+	return fis, err
+}
+
+func (f *File) Readdirnames(n int) (names []string, err error) {
+	err = f.list(n, func(file afero.File) error {
+		names, err = file.Readdirnames(n)
+		return err
+	})
+	return names, err
+}
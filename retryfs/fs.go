@@ -0,0 +1,270 @@
+// Package retryfs provides an afero.Fs wrapper which retries the operations
+// of flaky backends, like network file systems, when they fail with a
+// transient error, so that callers do not each need retry loops.
+package retryfs
+
+import (
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// RetryPolicy configures an Fs created by New.
+type RetryPolicy struct {
+	// MaxRetries is the number of times a failing operation is retried.
+	// Defaults to 3.
+	MaxRetries int
+
+	// Backoff is the delay before the first retry; it doubles with every
+	// further attempt up to MaxBackoff. They default to 100ms and 5s.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	// Jitter is the fraction of each delay which is random, between 0 and
+	// 1, so that clients failing together do not retry together. Defaults
+	// to 0.5; a negative value disables it.
+	Jitter float64
+
+	// Retryable reports whether an error is transient. Defaults to
+	// IsTransient.
+	Retryable func(err error) bool
+
+	// RetryWrites retries the writes which the base Fs reports as
+	// idempotent with the Idempotent interface. Other writes, and all
+	// writes without it, are made once.
+	RetryWrites bool
+}
+
+// Idempotent is implemented by backends which know which of their writes
+// can be repeated after a failure to the same effect, e.g. because
+// objects are always written whole.
+type Idempotent interface {
+	// IsIdempotent reports whether op is idempotent. Op is the name of a
+	// method, prefixed with "File." for methods of files, e.g. "Chmod" or
+	// "File.WriteAt".
+	IsIdempotent(op string) bool
+}
+
+// IsTransient reports whether err may go away when retried: timeouts,
+// temporary errors as reported by net.Error and syscall.Errno, refused and
+// broken connections and unexpected EOFs. Errors saying that a file does
+// not exist, exists or may not be accessed never are.
+func IsTransient(err error) bool {
+	if err == nil || errors.Is(err, os.ErrNotExist) || errors.Is(err, os.ErrExist) || errors.Is(err, os.ErrPermission) {
+		return false
+	}
+	var timeout interface{ Timeout() bool }
+	if errors.As(err, &timeout) && timeout.Timeout() {
+		return true
+	}
+	var temporary interface{ Temporary() bool }
+	if errors.As(err, &temporary) && temporary.Temporary() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, net.ErrClosed)
+}
+
+// Fs passes all calls to its base Fs, retrying reads failing with a
+// transient error: Stat, Open, the other opens for reading and the Stat,
+// ReadAt and full Readdir of files. Reads which moved the offset of a file
+// cannot be repeated and are not retried.
+type Fs struct {
+	base   afero.Fs
+	policy RetryPolicy
+	sleep  func(time.Duration)
+}
+
+var _ afero.Symlinker = (*Fs)(nil)
+
+// New returns an Fs retrying the operations of base according to policy.
+func New(base afero.Fs, policy RetryPolicy) *Fs {
+	if policy.MaxRetries <= 0 {
+		policy.MaxRetries = 3
+	}
+	if policy.Backoff <= 0 {
+		policy.Backoff = 100 * time.Millisecond
+	}
+	if policy.MaxBackoff <= 0 {
+		policy.MaxBackoff = 5 * time.Second
+	}
+	if policy.Jitter == 0 {
+		policy.Jitter = 0.5
+	}
+	if policy.Retryable == nil {
+		policy.Retryable = IsTransient
+	}
+	return &Fs{base: base, policy: policy, sleep: time.Sleep}
+}
+
+// read calls fn, retrying it on transient errors.
+func (fs *Fs) read(fn func() error) error {
+	delay := fs.policy.Backoff
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= fs.policy.MaxRetries || !fs.policy.Retryable(err) {
+			return err
+		}
+		d := delay
+		if fs.policy.Jitter > 0 {
+			d -= time.Duration(rand.Float64() * min(fs.policy.Jitter, 1) * float64(d))
+		}
+		fs.sleep(d)
+		delay = min(2*delay, fs.policy.MaxBackoff)
+	}
+}
+
+// write calls fn, retrying it like a read if op is idempotent.
+func (fs *Fs) write(op string, fn func() error) error {
+	if fs.policy.RetryWrites {
+		if i, ok := fs.base.(Idempotent); ok && i.IsIdempotent(op) {
+			return fs.read(fn)
+		}
+	}
+	return fn()
+}
+
+func (fs *Fs) Name() string { return "RetryFs" }
+
+// Unwrap returns the base Fs, which does not retry.
+func (fs *Fs) Unwrap() afero.Fs {
+	return fs.base
+}
+
+func (fs *Fs) Create(name string) (afero.File, error) {
+	var f afero.File
+	err := fs.write("Create", func() (err error) {
+		f, err = fs.base.Create(name)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fs.file(f, name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o666), nil
+}
+
+func (fs *Fs) Mkdir(name string, perm os.FileMode) error {
+	return fs.write("Mkdir", func() error { return fs.base.Mkdir(name, perm) })
+}
+
+func (fs *Fs) MkdirAll(path string, perm os.FileMode) error {
+	return fs.write("MkdirAll", func() error { return fs.base.MkdirAll(path, perm) })
+}
+
+func (fs *Fs) Open(name string) (afero.File, error) {
+	var f afero.File
+	err := fs.read(func() (err error) {
+		f, err = fs.base.Open(name)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fs.file(f, name, os.O_RDONLY, 0), nil
+}
+
+// OpenFile retries opens for reading; opens which may create or truncate
+// the file count as writes.
+func (fs *Fs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	var f afero.File
+	open := func() (err error) {
+		f, err = fs.base.OpenFile(name, flag, perm)
+		return err
+	}
+	var err error
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) == 0 {
+		err = fs.read(open)
+	} else {
+		err = fs.write("OpenFile", open)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return fs.file(f, name, flag, perm), nil
+}
+
+func (fs *Fs) file(f afero.File, name string, flag int, perm os.FileMode) *File {
+	// reopening must neither create nor truncate the file again
+	flag &^= os.O_CREATE | os.O_EXCL | os.O_TRUNC
+	return &File{File: f, fs: fs, reopen: func() (afero.File, error) {
+		return fs.base.OpenFile(name, flag, perm)
+	}}
+}
+
+func (fs *Fs) Remove(name string) error {
+	return fs.write("Remove", func() error { return fs.base.Remove(name) })
+}
+
+func (fs *Fs) RemoveAll(path string) error {
+	return fs.write("RemoveAll", func() error { return fs.base.RemoveAll(path) })
+}
+
+func (fs *Fs) Rename(oldname, newname string) error {
+	return fs.write("Rename", func() error { return fs.base.Rename(oldname, newname) })
+}
+
+func (fs *Fs) Stat(name string) (os.FileInfo, error) {
+	var fi os.FileInfo
+	err := fs.read(func() (err error) {
+		fi, err = fs.base.Stat(name)
+		return err
+	})
+	return fi, err
+}
+
+func (fs *Fs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	lfs, ok := fs.base.(afero.Lstater)
+	if !ok {
+		fi, err := fs.Stat(name)
+		return fi, false, err
+	}
+	var fi os.FileInfo
+	var lstat bool
+	err := fs.read(func() (err error) {
+		fi, lstat, err = lfs.LstatIfPossible(name)
+		return err
+	})
+	return fi, lstat, err
+}
+
+func (fs *Fs) SymlinkIfPossible(oldname, newname string) error {
+	linker, ok := fs.base.(afero.Linker)
+	if !ok {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: afero.ErrNoSymlink}
+	}
+	return fs.write("SymlinkIfPossible", func() error { return linker.SymlinkIfPossible(oldname, newname) })
+}
+
+func (fs *Fs) ReadlinkIfPossible(name string) (string, error) {
+	reader, ok := fs.base.(afero.LinkReader)
+	if !ok {
+		return "", &os.PathError{Op: "readlink", Path: name, Err: afero.ErrNoReadlink}
+	}
+	var target string
+	err := fs.read(func() (err error) {
+		target, err = reader.ReadlinkIfPossible(name)
+		return err
+	})
+	return target, err
+}
+
+func (fs *Fs) Chmod(name string, mode os.FileMode) error {
+	return fs.write("Chmod", func() error { return fs.base.Chmod(name, mode) })
+}
+
+func (fs *Fs) Chown(name string, uid, gid int) error {
+	return fs.write("Chown", func() error { return fs.base.Chown(name, uid, gid) })
+}
+
+func (fs *Fs) Chtimes(name string, atime, mtime time.Time) error {
+	return fs.write("Chtimes", func() error { return fs.base.Chtimes(name, atime, mtime) })
+}
@@ -0,0 +1,129 @@
+package retryfs
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/spf13/afero/aferotest"
+	"github.com/spf13/afero/faultfs"
+)
+
+func newFs(base afero.Fs, policy RetryPolicy) (*Fs, *[]time.Duration) {
+	fs := New(base, policy)
+	var delays []time.Duration
+	fs.sleep = func(d time.Duration) { delays = append(delays, d) }
+	return fs, &delays
+}
+
+func TestRetryReads(t *testing.T) {
+	faulty := faultfs.New(afero.NewMemMapFs())
+	afero.WriteFile(faulty, "/dir/file", []byte("data"), 0o644)
+	fs, delays := newFs(faulty, RetryPolicy{Backoff: time.Second, MaxBackoff: 3 * time.Second, Jitter: -1})
+
+	faulty.Inject(faultfs.Fault{Op: "Stat", Nth: 1, Err: syscall.ECONNRESET})
+	faulty.Inject(faultfs.Fault{Op: "Stat", Nth: 2, Err: syscall.ETIMEDOUT})
+	faulty.Inject(faultfs.Fault{Op: "Stat", Nth: 3, Err: syscall.ECONNRESET})
+	if fi, err := fs.Stat("/dir/file"); err != nil || fi.Size() != 4 {
+		t.Fatalf("Stat = %v, %v", fi, err)
+	}
+	if want := []time.Duration{time.Second, 2 * time.Second, 3 * time.Second}; len(*delays) != 3 || (*delays)[2] != want[2] {
+		t.Errorf("delays = %v, want %v", *delays, want)
+	}
+
+	faulty.Reset()
+	*delays = nil
+	faulty.Inject(faultfs.Fault{Op: "Open", Err: syscall.ECONNRESET})
+	if _, err := fs.Open("/dir/file"); !errors.Is(err, syscall.ECONNRESET) || len(*delays) != 3 {
+		t.Errorf("Open failing every time = %v after %d retries", err, len(*delays))
+	}
+
+	faulty.Reset()
+	*delays = nil
+	faulty.Inject(faultfs.Fault{Op: "Stat", Err: os.ErrNotExist})
+	if _, err := fs.Stat("/dir/file"); !os.IsNotExist(err) || len(*delays) != 0 {
+		t.Errorf("Stat with a permanent error = %v after %d retries", err, len(*delays))
+	}
+
+	faulty.Reset()
+	f, err := fs.Open("/dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	faulty.Inject(faultfs.Fault{Op: "File.Readdir", Nth: 1, Err: syscall.ECONNRESET})
+	if fis, err := f.Readdir(-1); err != nil || len(fis) != 1 {
+		t.Errorf("Readdir = %d entries, %v", len(fis), err)
+	}
+}
+
+func TestJitter(t *testing.T) {
+	faulty := faultfs.New(afero.NewMemMapFs())
+	fs, delays := newFs(faulty, RetryPolicy{MaxRetries: 20, Backoff: time.Second, MaxBackoff: time.Second})
+	faulty.Inject(faultfs.Fault{Op: "Stat", Err: syscall.ETIMEDOUT})
+	fs.Stat("/x")
+	varied := false
+	for _, d := range *delays {
+		if d < time.Second/2 || d > time.Second {
+			t.Fatalf("delay %v out of range", d)
+		}
+		varied = varied || d != (*delays)[0]
+	}
+	if !varied {
+		t.Error("the delays have no jitter")
+	}
+}
+
+// idempotentFs marks Chmod and File.WriteAt as idempotent.
+type idempotentFs struct {
+	*faultfs.Fs
+}
+
+func (idempotentFs) IsIdempotent(op string) bool {
+	return op == "Chmod" || op == "File.WriteAt"
+}
+
+func TestRetryWrites(t *testing.T) {
+	faulty := faultfs.New(afero.NewMemMapFs())
+	afero.WriteFile(faulty, "/file", []byte("data"), 0o644)
+
+	fs, delays := newFs(faulty, RetryPolicy{RetryWrites: true})
+	faulty.Inject(faultfs.Fault{Op: "Chmod", Nth: 1, Err: syscall.ECONNRESET})
+	if err := fs.Chmod("/file", 0o600); !errors.Is(err, syscall.ECONNRESET) || len(*delays) != 0 {
+		t.Errorf("Chmod without Idempotent = %v after %d retries", err, len(*delays))
+	}
+
+	faulty.Reset()
+	fs, delays = newFs(idempotentFs{faulty}, RetryPolicy{RetryWrites: true})
+	faulty.Inject(faultfs.Fault{Op: "Chmod", Nth: 1, Err: syscall.ECONNRESET})
+	if err := fs.Chmod("/file", 0o600); err != nil || len(*delays) != 1 {
+		t.Errorf("idempotent Chmod = %v after %d retries", err, len(*delays))
+	}
+	faulty.Inject(faultfs.Fault{Op: "Remove", Nth: 1, Err: syscall.ECONNRESET})
+	if err := fs.Remove("/file"); !errors.Is(err, syscall.ECONNRESET) {
+		t.Errorf("Remove, not idempotent = %v", err)
+	}
+
+	f, err := fs.OpenFile("/file", os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	faulty.Inject(faultfs.Fault{Op: "File.WriteAt", Nth: 1, Err: syscall.ECONNRESET})
+	if _, err := f.WriteAt([]byte("DA"), 0); err != nil {
+		t.Errorf("idempotent WriteAt = %v", err)
+	}
+	if data, _ := afero.ReadFile(faulty, "/file"); string(data) != "DAta" {
+		t.Errorf("content = %q", data)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	newFs := func(t *testing.T) afero.Fs {
+		return New(afero.NewMemMapFs(), RetryPolicy{})
+	}
+	aferotest.Conformance(t, newFs, afero.Capabilities(newFs(t)))
+}
@@ -1,6 +1,9 @@
 package afero
 
 import (
+	"errors"
+	"io"
+	"os"
 	"regexp"
 	"testing"
 )
@@ -50,6 +53,51 @@ func TestFilterReadonlyRemoveAndRead(t *testing.T) {
 	}
 }
 
+func TestReadOnlyOptions(t *testing.T) {
+	mfs := NewMemMapFs()
+	WriteFile(mfs, "/file.txt", []byte("content"), 0o644)
+	var rejected []string
+	errROFS := errors.New("read-only file system")
+	fs := NewReadOnlyFs(mfs, ReadOnlyError(errROFS), ReadOnlyAudit(func(err error) {
+		rejected = append(rejected, err.Error())
+	}))
+
+	if err := fs.Remove("/file.txt"); !errors.Is(err, errROFS) {
+		t.Errorf("Remove = %v, want errROFS", err)
+	}
+	if _, err := fs.OpenFile("/file.txt", os.O_WRONLY, 0); !errors.Is(err, errROFS) {
+		t.Errorf("OpenFile for writing = %v, want errROFS", err)
+	}
+	f, err := fs.Open("/file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.Write([]byte("x")); !errors.Is(err, errROFS) {
+		t.Errorf("Write through the file = %v, want errROFS", err)
+	}
+	if err := fs.(Linker).SymlinkIfPossible("/file.txt", "/link"); !errors.Is(err, ErrNoSymlink) {
+		t.Errorf("SymlinkIfPossible = %v", err)
+	}
+	want := []string{
+		"remove /file.txt: read-only file system",
+		"open /file.txt: read-only file system",
+		"write /file.txt: read-only file system",
+		"symlink /file.txt /link: symlink not supported",
+	}
+	if len(rejected) != len(want) {
+		t.Fatalf("audited %q, want %q", rejected, want)
+	}
+	for i := range want {
+		if rejected[i] != want[i] {
+			t.Errorf("audited %q, want %q", rejected[i], want[i])
+		}
+	}
+	if _, err := fs.Stat("/file.txt"); err != nil || len(rejected) != len(want) {
+		t.Errorf("Stat = %v, audited %d", err, len(rejected))
+	}
+}
+
 func TestFilterRegexp(t *testing.T) {
 	fs := NewRegexpFs(&MemMapFs{}, regexp.MustCompile(`\.txt$`))
 	_, err := fs.Create("/file.html")
@@ -92,4 +140,68 @@ func TestFilterRegexReadDir(t *testing.T) {
 	if len(names) != 1 {
 		t.Errorf("Got wrong number of names: %v", names)
 	}
+
+	// pages skip the entries left out, an empty one only comes with io.EOF
+	f, _ = fs.Open("/dir")
+	names = nil
+	for {
+		page, err := f.Readdirnames(1)
+		if err == io.EOF {
+			break
+		}
+		if err != nil || len(page) != 1 {
+			t.Fatalf("Readdirnames(1) = %v, %v", page, err)
+		}
+		names = append(names, page...)
+	}
+	if len(names) != 2 {
+		t.Errorf("Readdirnames(1) returned %v", names)
+	}
+}
+
+// writableOpenFs returns files open for writing from Open.
+type writableOpenFs struct {
+	Fs
+}
+
+func (w writableOpenFs) Open(name string) (File, error) {
+	return w.Fs.OpenFile(name, os.O_RDWR, 0)
+}
+
+func TestReadOnlyFileHandles(t *testing.T) {
+	base := &MemMapFs{}
+	if err := WriteFile(base, "/file.txt", []byte("content"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	source := writableOpenFs{base}
+
+	for _, fs := range []Fs{
+		NewReadOnlyFs(source),
+		NewCopyOnWriteFs(source, &MemMapFs{}),
+		NewCacheOnReadFs(source, writableOpenFs{&MemMapFs{}}, 0),
+	} {
+		f, err := fs.Open("/file.txt")
+		if err != nil {
+			t.Fatalf("%s: %v", fs.Name(), err)
+		}
+		if _, err := f.Write([]byte("x")); !os.IsPermission(err) {
+			t.Errorf("%s: Write got %v, want EPERM", fs.Name(), err)
+		}
+		if _, err := f.WriteAt([]byte("x"), 0); !os.IsPermission(err) {
+			t.Errorf("%s: WriteAt got %v, want EPERM", fs.Name(), err)
+		}
+		if _, err := f.WriteString("x"); !os.IsPermission(err) {
+			t.Errorf("%s: WriteString got %v, want EPERM", fs.Name(), err)
+		}
+		if err := f.Truncate(0); !os.IsPermission(err) {
+			t.Errorf("%s: Truncate got %v, want EPERM", fs.Name(), err)
+		}
+		if data, err := ReadAll(f); err != nil || string(data) != "content" {
+			t.Errorf("%s: read %q, %v", fs.Name(), data, err)
+		}
+		f.Close()
+	}
+	if data, _ := ReadFile(base, "/file.txt"); string(data) != "content" {
+		t.Errorf("base file changed to %q", data)
+	}
 }
@@ -0,0 +1,206 @@
+package afero
+
+import (
+	"io"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/spf13/afero/mem"
+)
+
+var _ Lstater = (*ScannerFs)(nil)
+
+// ScanFunc inspects the content of a file before it is written to the
+// underlying filesystem. Returning an error rejects the content.
+type ScanFunc func(name string, content io.Reader) error
+
+// The ScannerFs passes everything written to files through a ScanFunc
+// before committing it to the source Fs, e.g. to enforce size limits or to
+// hand uploads to a virus scanner.
+//
+// Files opened for writing are staged in memory and only written to the
+// source Fs by a successful Close(). Until then, the source is unchanged,
+// so a newly created file does not exist there yet. If the ScanFunc rejects
+// the content, Close returns its error wrapped in an *os.PathError and the
+// source is left untouched. Files opened read-only are passed through.
+type ScannerFs struct {
+	source Fs
+	scan   ScanFunc
+}
+
+func NewScannerFs(source Fs, scan ScanFunc) Fs {
+	return &ScannerFs{source: source, scan: scan}
+}
+
+// ScannerFile is returned by ScannerFs for files opened for writing.
+type ScannerFile struct {
+	*mem.File
+	fs     *ScannerFs
+	name   string
+	perm   os.FileMode
+	closed bool
+}
+
+func (f *ScannerFile) Name() string {
+	return f.name
+}
+
+// Close scans the staged content and writes it to the source Fs if accepted.
+func (f *ScannerFile) Close() error {
+	if f.closed {
+		return ErrFileClosed
+	}
+	f.closed = true
+	defer f.File.Close()
+
+	fi, err := f.File.Stat()
+	if err != nil {
+		return err
+	}
+	size := fi.Size()
+
+	if f.fs.scan != nil {
+		if err := f.fs.scan(f.name, io.NewSectionReader(f.File, 0, size)); err != nil {
+			return &os.PathError{Op: "close", Path: f.name, Err: err}
+		}
+	}
+
+	dst, err := f.fs.source.OpenFile(f.name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, io.NewSectionReader(f.File, 0, size)); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+func (s *ScannerFs) Name() string {
+	return "ScannerFs"
+}
+
+// Unwrap returns the source Fs, whose files are not scanned.
+func (s *ScannerFs) Unwrap() Fs {
+	return s.source
+}
+
+// Capabilities returns those of the source it passes on, links are not
+// supported.
+func (s *ScannerFs) Capabilities() Capability {
+	return Capabilities(s.source) & (CapLstat | CapAtomicRename | CapLock | CapXattr | CapReadAt)
+}
+
+func (s *ScannerFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) == 0 {
+		return s.source.OpenFile(name, flag, perm)
+	}
+
+	fi, err := s.source.Stat(name)
+	switch {
+	case err == nil && fi.IsDir():
+		return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
+	case err == nil && flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL:
+		return nil, &os.PathError{Op: "open", Path: name, Err: ErrFileExists}
+	case os.IsNotExist(err) && flag&os.O_CREATE == 0:
+		return nil, err
+	case err != nil && !os.IsNotExist(err):
+		return nil, err
+	}
+
+	staged := mem.NewFileHandle(mem.CreateFile(name))
+	if err == nil && flag&os.O_TRUNC == 0 {
+		src, err := s.source.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		_, err = io.Copy(staged, src)
+		src.Close()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := staged.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+	if flag&os.O_APPEND != 0 {
+		if _, err := staged.Seek(0, io.SeekEnd); err != nil {
+			return nil, err
+		}
+	}
+
+	return &ScannerFile{File: staged, fs: s, name: name, perm: perm}, nil
+}
+
+func (s *ScannerFs) Create(name string) (File, error) {
+	return s.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o666)
+}
+
+func (s *ScannerFs) Open(name string) (File, error) {
+	return s.source.Open(name)
+}
+
+func (s *ScannerFs) Mkdir(name string, perm os.FileMode) error {
+	return s.source.Mkdir(name, perm)
+}
+
+func (s *ScannerFs) MkdirAll(path string, perm os.FileMode) error {
+	return s.source.MkdirAll(path, perm)
+}
+
+func (s *ScannerFs) Remove(name string) error {
+	return s.source.Remove(name)
+}
+
+func (s *ScannerFs) RemoveAll(path string) error {
+	return s.source.RemoveAll(path)
+}
+
+func (s *ScannerFs) Rename(oldname, newname string) error {
+	return s.source.Rename(oldname, newname)
+}
+
+func (s *ScannerFs) Stat(name string) (os.FileInfo, error) {
+	return s.source.Stat(name)
+}
+
+func (s *ScannerFs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	if lsf, ok := s.source.(Lstater); ok {
+		return lsf.LstatIfPossible(name)
+	}
+	fi, err := s.source.Stat(name)
+	return fi, false, err
+}
+
+func (s *ScannerFs) LockIfPossible(name string, exclusive bool) (io.Closer, bool, error) {
+	return lockIfPossible(s.source, name, exclusive)
+}
+
+func (s *ScannerFs) GetXattr(name, attr string) ([]byte, error) {
+	return GetXattr(s.source, name, attr)
+}
+
+func (s *ScannerFs) SetXattr(name, attr string, value []byte) error {
+	return SetXattr(s.source, name, attr, value)
+}
+
+func (s *ScannerFs) ListXattr(name string) ([]string, error) {
+	return ListXattr(s.source, name)
+}
+
+func (s *ScannerFs) RemoveXattr(name, attr string) error {
+	return RemoveXattr(s.source, name, attr)
+}
+
+func (s *ScannerFs) Chmod(name string, mode os.FileMode) error {
+	return s.source.Chmod(name, mode)
+}
+
+func (s *ScannerFs) Chown(name string, uid, gid int) error {
+	return s.source.Chown(name, uid, gid)
+}
+
+func (s *ScannerFs) Chtimes(name string, atime, mtime time.Time) error {
+	return s.source.Chtimes(name, atime, mtime)
+}
@@ -0,0 +1,78 @@
+package afero
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestScannerFs(t *testing.T) {
+	errInfected := errors.New("infected")
+	var scanned []string
+	base := NewMemMapFs()
+	sfs := NewScannerFs(base, func(name string, content io.Reader) error {
+		b, err := io.ReadAll(content)
+		if err != nil {
+			return err
+		}
+		scanned = append(scanned, name)
+		if strings.Contains(string(b), "EICAR") {
+			return errInfected
+		}
+		return nil
+	})
+
+	if err := WriteFile(sfs, "/clean.txt", []byte("hello"), 0o644); err != nil {
+		t.Fatalf("clean write failed: %v", err)
+	}
+	if b, err := ReadFile(base, "/clean.txt"); err != nil || string(b) != "hello" {
+		t.Fatalf("got %q, %v", b, err)
+	}
+
+	f, err := sfs.Create("/bad.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString("X5O!P%@AP EICAR"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := Exists(base, "/bad.txt"); ok {
+		t.Error("content must not reach the source before Close")
+	}
+	if err := f.Close(); !errors.Is(err, errInfected) {
+		t.Fatalf("expected scanner error, got %v", err)
+	}
+	if ok, _ := Exists(base, "/bad.txt"); ok {
+		t.Error("rejected content must not reach the source")
+	}
+	if err := f.Close(); err != ErrFileClosed {
+		t.Errorf("expected ErrFileClosed on second Close, got %v", err)
+	}
+
+	// appending to an accepted file scans the complete content
+	f, err = sfs.OpenFile("/clean.txt", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(" EICAR")
+	if err := f.Close(); !errors.Is(err, errInfected) {
+		t.Fatalf("expected scanner error, got %v", err)
+	}
+	if b, _ := ReadFile(base, "/clean.txt"); string(b) != "hello" {
+		t.Errorf("source was modified: %q", b)
+	}
+
+	if _, err := sfs.OpenFile("/clean.txt", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644); !os.IsExist(err) {
+		t.Errorf("expected exist error, got %v", err)
+	}
+	if _, err := sfs.OpenFile("/missing.txt", os.O_WRONLY, 0o644); !os.IsNotExist(err) {
+		t.Errorf("expected not exist error, got %v", err)
+	}
+
+	want := []string{"/clean.txt", "/bad.txt", "/clean.txt"}
+	if strings.Join(scanned, ",") != strings.Join(want, ",") {
+		t.Errorf("scanned %v, want %v", scanned, want)
+	}
+}
@@ -14,14 +14,18 @@
 package sftpfs
 
 import (
+	"io"
 	"os"
 
 	"github.com/pkg/sftp"
+
+	"github.com/spf13/afero/internal/common"
 )
 
 type File struct {
 	client *sftp.Client
 	fd     *sftp.File
+	dir    common.DirLister
 }
 
 func FileOpen(s *sftp.Client, name string) (*File, error) {
@@ -61,6 +65,9 @@ func (f *File) Truncate(size int64) error {
 }
 
 func (f *File) Read(b []byte) (n int, err error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
 	return f.fd.Read(b)
 }
 
@@ -68,28 +75,21 @@ func (f *File) ReadAt(b []byte, off int64) (n int, err error) {
 	return f.fd.ReadAt(b, off)
 }
 
-func (f *File) Readdir(count int) (res []os.FileInfo, err error) {
-	res, err = f.client.ReadDir(f.Name())
-	if err != nil {
-		return
-	}
-	if count > 0 {
-		if len(res) > count {
-			res = res[:count]
-		}
-	}
-	return
+func (f *File) Readdir(count int) ([]os.FileInfo, error) {
+	return f.dir.Readdir(count, f.list)
 }
 
-func (f *File) Readdirnames(n int) (names []string, err error) {
-	data, err := f.Readdir(n)
+func (f *File) Readdirnames(n int) ([]string, error) {
+	return f.dir.Readdirnames(n, f.list)
+}
+
+// list returns all entries of the directory, which the server sends at once.
+func (f *File) list() ([]os.FileInfo, error) {
+	res, err := f.client.ReadDir(f.Name())
 	if err != nil {
 		return nil, err
 	}
-	for _, v := range data {
-		names = append(names, v.Name())
-	}
-	return
+	return res, io.EOF
 }
 
 func (f *File) Seek(offset int64, whence int) (int64, error) {
@@ -97,12 +97,17 @@ func (f *File) Seek(offset int64, whence int) (int64, error) {
 }
 
 func (f *File) Write(b []byte) (n int, err error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
 	return f.fd.Write(b)
 }
 
-// TODO
 func (f *File) WriteAt(b []byte, off int64) (n int, err error) {
-	return 0, nil
+	if len(b) == 0 {
+		return 0, nil
+	}
+	return f.fd.WriteAt(b, off)
 }
 
 func (f *File) WriteString(s string) (ret int, err error) {
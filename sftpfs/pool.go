@@ -0,0 +1,267 @@
+package sftpfs
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+)
+
+// Config configures a managed Fs created with NewWithDialer.
+type Config struct {
+	// Dial opens a new connection. It is called whenever the pool needs a
+	// client, initially and after a connection was lost.
+	Dial func() (*sftp.Client, error)
+
+	// PoolSize is the number of connections used round-robin. Defaults to 1.
+	PoolSize int
+
+	// MaxRetries is the number of times an operation failing with a
+	// connection error is retried on a fresh connection. Defaults to 3.
+	MaxRetries int
+
+	// Backoff is the delay before the first retry; it doubles with every
+	// further attempt. Defaults to 100ms.
+	Backoff time.Duration
+
+	// HealthCheckInterval is how often idle connections are probed, so
+	// that broken ones are replaced before they are used. Zero disables
+	// health checks.
+	HealthCheckInterval time.Duration
+}
+
+// NewWithDialer returns an Fs that manages its own connections: broken
+// connections are dropped and operations failing with a connection error
+// are transparently retried on a new one. An operation which was
+// interrupted may already have been applied by the server, so those which
+// are not idempotent, Mkdir, Remove, Rename, SymlinkIfPossible,
+// LinkIfPossible and OpenFile with O_EXCL, are not retried once sent: they
+// return the connection error, and the next operation uses a new
+// connection.
+//
+// Files stay bound to the connection they were opened on and are not
+// reopened if it breaks.
+//
+// The first connection is opened before NewWithDialer returns. Call Close
+// to release all connections.
+func NewWithDialer(cfg Config) (*Fs, error) {
+	if cfg.Dial == nil {
+		return nil, errors.New("sftpfs: Config.Dial is nil")
+	}
+	if cfg.PoolSize <= 0 {
+		cfg.PoolSize = 1
+	}
+	if cfg.MaxRetries <= 0 {
+		cfg.MaxRetries = 3
+	}
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = 100 * time.Millisecond
+	}
+	p := &pool{
+		cfg:     cfg,
+		clients: make([]*sftp.Client, cfg.PoolSize),
+		lost:    make([]chan struct{}, cfg.PoolSize),
+		done:    make(chan struct{}),
+	}
+	s := &Fs{pool: p}
+	if err := s.do(func(*sftp.Client) error { return nil }); err != nil {
+		return nil, err
+	}
+	if cfg.HealthCheckInterval > 0 {
+		go p.healthCheck()
+	}
+	return s, nil
+}
+
+// Close closes all connections of a managed Fs. It does nothing for an Fs
+// created with New, whose client is owned by the caller.
+func (s Fs) Close() error {
+	if s.pool == nil {
+		return nil
+	}
+	return s.pool.close()
+}
+
+// do calls fn with a client. In managed mode fn is retried with backoff on
+// a new connection if it fails with a connection error.
+func (s Fs) do(fn func(c *sftp.Client) error) error {
+	return s.run(fn, true)
+}
+
+// doOnce calls fn with a client like do, but does not retry fn once it was
+// called: only getting a connection is retried.
+func (s Fs) doOnce(fn func(c *sftp.Client) error) error {
+	return s.run(fn, false)
+}
+
+func (s Fs) run(fn func(c *sftp.Client) error, retry bool) error {
+	if s.pool == nil {
+		return fn(s.client)
+	}
+	p := s.pool
+	for attempt := 0; ; attempt++ {
+		i, c, err := p.get()
+		if err == nil {
+			err = fn(c)
+			if err == nil || !isConnError(err) && !p.broken(i, c) {
+				return err
+			}
+			p.discard(i, c)
+			if !retry {
+				return err
+			}
+		}
+		if attempt >= p.cfg.MaxRetries || errors.Is(err, errPoolClosed) {
+			return err
+		}
+		select {
+		case <-time.After(p.cfg.Backoff << attempt):
+		case <-p.done:
+			return errPoolClosed
+		}
+	}
+}
+
+var errPoolClosed = errors.New("sftpfs: connection pool closed")
+
+// isConnError reports whether err means the connection was lost. Other
+// errors, such as io.EOF or timeouts, may come from a working connection;
+// pool.broken tells whether the client failing with them shut down.
+func isConnError(err error) bool {
+	return errors.Is(err, sftp.ErrSSHFxConnectionLost) ||
+		errors.Is(err, sftp.ErrSSHFxNoConnection) ||
+		errors.Is(err, io.ErrClosedPipe) ||
+		errors.Is(err, net.ErrClosed)
+}
+
+type pool struct {
+	cfg     Config
+	mu      sync.Mutex
+	clients []*sftp.Client
+	// lost holds a channel per slot, closed once its client shut down.
+	lost   []chan struct{}
+	next   int
+	closed bool
+	done   chan struct{}
+}
+
+// get returns the next slot and its client, dialing if the slot is empty.
+// The lock is not held while dialing, so that the other slots stay usable.
+func (p *pool) get() (int, *sftp.Client, error) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return 0, nil, errPoolClosed
+	}
+	i := p.next
+	p.next = (p.next + 1) % len(p.clients)
+	if c := p.clients[i]; c != nil {
+		select {
+		case <-p.lost[i]:
+			// shut down while idle, nothing was sent on it
+			p.clients[i], p.lost[i] = nil, nil
+			c.Close()
+		default:
+			p.mu.Unlock()
+			return i, c, nil
+		}
+	}
+	p.mu.Unlock()
+
+	c, err := p.cfg.Dial()
+	if err != nil {
+		return i, nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch {
+	case p.closed:
+		c.Close()
+		return 0, nil, errPoolClosed
+	case p.clients[i] != nil:
+		// dialed concurrently for the same slot
+		c.Close()
+		return i, p.clients[i], nil
+	}
+	lost := make(chan struct{})
+	go func() {
+		c.Wait()
+		close(lost)
+	}()
+	p.clients[i], p.lost[i] = c, lost
+	return i, c, nil
+}
+
+// broken reports whether c, the client of slot i, shut down.
+func (p *pool) broken(i int, c *sftp.Client) bool {
+	p.mu.Lock()
+	lost := p.lost[i]
+	ok := p.clients[i] == c
+	p.mu.Unlock()
+	if !ok {
+		return true
+	}
+	select {
+	case <-lost:
+		return true
+	default:
+		return false
+	}
+}
+
+// discard closes c and empties slot i, unless it was replaced already.
+func (p *pool) discard(i int, c *sftp.Client) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.clients[i] == c {
+		p.clients[i], p.lost[i] = nil, nil
+		c.Close()
+	}
+}
+
+func (p *pool) healthCheck() {
+	t := time.NewTicker(p.cfg.HealthCheckInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-t.C:
+		}
+		p.mu.Lock()
+		clients := append([]*sftp.Client(nil), p.clients...)
+		p.mu.Unlock()
+		for i, c := range clients {
+			if c == nil {
+				continue
+			}
+			if _, err := c.Getwd(); err != nil && (isConnError(err) || p.broken(i, c)) {
+				p.discard(i, c)
+			}
+		}
+	}
+}
+
+func (p *pool) close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return errPoolClosed
+	}
+	p.closed = true
+	close(p.done)
+	var first error
+	for i, c := range p.clients {
+		if c == nil {
+			continue
+		}
+		if err := c.Close(); err != nil && first == nil {
+			first = err
+		}
+		p.clients[i], p.lost[i] = nil, nil
+	}
+	return first
+}
@@ -0,0 +1,243 @@
+package sftpfs
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+)
+
+// pipeDialer serves each connection with an in-process sftp server and
+// keeps track of them so that tests can break them.
+type pipeDialer struct {
+	mu    sync.Mutex
+	dials int
+	fail  int
+	conns []io.Closer
+	// block, if set, is received from before dialing.
+	block chan struct{}
+	// breakNext breaks all connections before the server reads the next
+	// request.
+	breakNext atomic.Bool
+}
+
+func (d *pipeDialer) Dial() (*sftp.Client, error) {
+	d.mu.Lock()
+	block := d.block
+	d.mu.Unlock()
+	if block != nil {
+		<-block
+	}
+	d.mu.Lock()
+	d.dials++
+	if d.fail > 0 {
+		d.fail--
+		d.mu.Unlock()
+		return nil, errors.New("dial failed")
+	}
+	cr, sw := io.Pipe()
+	sr, cw := io.Pipe()
+	d.conns = append(d.conns, sw, sr)
+	d.mu.Unlock()
+
+	server, err := sftp.NewServer(struct {
+		io.Reader
+		io.WriteCloser
+	}{breakingReader{sr, d}, sw})
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		server.Serve()
+		sw.Close()
+	}()
+	return sftp.NewClientPipe(cr, cw)
+}
+
+// breakingReader is the server side of a connection of d, which breaks
+// the connections when d.breakNext is set.
+type breakingReader struct {
+	r io.Reader
+	d *pipeDialer
+}
+
+func (b breakingReader) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	if b.d.breakNext.Swap(false) {
+		b.d.breakAll()
+		return 0, io.EOF
+	}
+	return n, err
+}
+
+// breakAll simulates a dropped connection for all clients dialed so far.
+func (d *pipeDialer) breakAll() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, c := range d.conns {
+		c.Close()
+	}
+	d.conns = nil
+}
+
+func (d *pipeDialer) count() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.dials
+}
+
+func TestReconnect(t *testing.T) {
+	dir := t.TempDir()
+	d := &pipeDialer{fail: 1}
+	fs, err := NewWithDialer(Config{Dial: d.Dial, Backoff: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.Close()
+	if d.count() != 2 {
+		t.Errorf("dials = %d, want 2 after a failed first dial", d.count())
+	}
+
+	if err := fs.Mkdir(dir+"/a", 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	d.breakAll()
+	fi, err := fs.Stat(dir + "/a")
+	if err != nil {
+		t.Fatalf("Stat after connection loss: %v", err)
+	}
+	if !fi.IsDir() {
+		t.Errorf("%s is not a directory", fi.Name())
+	}
+	if d.count() != 3 {
+		t.Errorf("dials = %d, want 3 after reconnecting", d.count())
+	}
+
+	// Other errors are returned without retrying.
+	if _, err := fs.Stat(dir + "/missing"); !os.IsNotExist(err) {
+		t.Errorf("Stat missing file: got %v, want not exist", err)
+	}
+	if d.count() != 3 {
+		t.Errorf("dials = %d, want no redial for a not-exist error", d.count())
+	}
+}
+
+func TestHealthCheck(t *testing.T) {
+	d := &pipeDialer{}
+	fs, err := NewWithDialer(Config{Dial: d.Dial, HealthCheckInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.Close()
+
+	d.breakAll()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		fs.pool.mu.Lock()
+		dropped := fs.pool.clients[0] == nil
+		fs.pool.mu.Unlock()
+		if dropped {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("health check did not drop the broken connection")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDialerGivesUp(t *testing.T) {
+	d := &pipeDialer{fail: 10}
+	if _, err := NewWithDialer(Config{Dial: d.Dial, MaxRetries: 2, Backoff: time.Millisecond}); err == nil {
+		t.Fatal("NewWithDialer succeeded with a failing dialer")
+	}
+	if d.count() != 3 {
+		t.Errorf("dials = %d, want 3", d.count())
+	}
+}
+
+func TestNoRetryNonIdempotent(t *testing.T) {
+	dir := t.TempDir()
+	d := &pipeDialer{}
+	fs, err := NewWithDialer(Config{Dial: d.Dial, Backoff: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.Close()
+
+	// the request is lost with the connection, and not sent again
+	d.breakNext.Store(true)
+	if err := fs.Mkdir(dir+"/a", 0o755); err == nil {
+		t.Fatal("Mkdir succeeded on a broken connection")
+	}
+	if d.count() != 1 {
+		t.Errorf("dials = %d, want no redial for Mkdir", d.count())
+	}
+	if _, err := os.Stat(dir + "/a"); !os.IsNotExist(err) {
+		t.Errorf("Mkdir was retried: %v", err)
+	}
+
+	// idempotent operations are retried
+	if _, err := fs.Stat(dir); err != nil {
+		t.Fatal(err)
+	}
+	d.breakNext.Store(true)
+	if _, err := fs.Stat(dir); err != nil {
+		t.Fatalf("Stat after connection loss: %v", err)
+	}
+	if err := fs.Mkdir(dir+"/a", 0o755); err != nil {
+		t.Fatalf("Mkdir on a new connection: %v", err)
+	}
+}
+
+func TestDialOutsideLock(t *testing.T) {
+	d := &pipeDialer{}
+	fs, err := NewWithDialer(Config{Dial: d.Dial, PoolSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.Close()
+
+	// the second slot dials, the first one stays usable meanwhile
+	block := make(chan struct{})
+	d.mu.Lock()
+	d.block = block
+	d.mu.Unlock()
+	dialed := make(chan error)
+	go func() {
+		_, err := fs.Stat("/")
+		dialed <- err
+	}()
+	for {
+		fs.pool.mu.Lock()
+		next := fs.pool.next
+		fs.pool.mu.Unlock()
+		if next == 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	stat := make(chan error)
+	go func() {
+		_, err := fs.Stat("/")
+		stat <- err
+	}()
+	select {
+	case err := <-stat:
+		if err != nil {
+			t.Errorf("Stat on the first connection: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Stat waited for the dial of another connection")
+	}
+	close(block)
+	if err := <-dialed; err != nil {
+		t.Errorf("Stat on the new connection: %v", err)
+	}
+}
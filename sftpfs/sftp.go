@@ -14,7 +14,9 @@
 package sftpfs
 
 import (
+	"errors"
 	"os"
+	"path"
 	"time"
 
 	"github.com/pkg/sftp"
@@ -26,8 +28,15 @@ import (
 //
 // For details in any method, check the documentation of the sftp package
 // (github.com/pkg/sftp).
+var (
+	_ afero.Lstater    = Fs{}
+	_ afero.Symlinker  = Fs{}
+	_ afero.HardLinker = Fs{}
+)
+
 type Fs struct {
 	client *sftp.Client
+	pool   *pool
 }
 
 func New(client *sftp.Client) afero.Fs {
@@ -37,15 +46,25 @@ func New(client *sftp.Client) afero.Fs {
 func (s Fs) Name() string { return "sftpfs" }
 
 func (s Fs) Create(name string) (afero.File, error) {
-	return FileCreate(s.client, name)
+	var f *File
+	err := s.do(func(c *sftp.Client) (err error) {
+		f, err = FileCreate(c, name)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
 }
 
 func (s Fs) Mkdir(name string, perm os.FileMode) error {
-	err := s.client.Mkdir(name)
-	if err != nil {
-		return err
-	}
-	return s.client.Chmod(name, perm)
+	return s.doOnce(func(c *sftp.Client) error {
+		err := c.Mkdir(name)
+		if err != nil {
+			return err
+		}
+		return c.Chmod(name, perm)
+	})
 }
 
 func (s Fs) MkdirAll(path string, perm os.FileMode) error {
@@ -92,13 +111,29 @@ func (s Fs) MkdirAll(path string, perm os.FileMode) error {
 }
 
 func (s Fs) Open(name string) (afero.File, error) {
-	return FileOpen(s.client, name)
+	var f *File
+	err := s.do(func(c *sftp.Client) (err error) {
+		f, err = FileOpen(c, name)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
 }
 
 // OpenFile calls the OpenFile method on the SSHFS connection. The mode argument
 // is ignored because it's ignored by the github.com/pkg/sftp implementation.
 func (s Fs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
-	sshfsFile, err := s.client.OpenFile(name, flag)
+	var sshfsFile *sftp.File
+	do := s.do
+	if flag&os.O_EXCL != 0 {
+		do = s.doOnce
+	}
+	err := do(func(c *sftp.Client) (err error) {
+		sshfsFile, err = c.OpenFile(name, flag)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -107,35 +142,124 @@ func (s Fs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error
 }
 
 func (s Fs) Remove(name string) error {
-	return s.client.Remove(name)
+	return s.doOnce(func(c *sftp.Client) error {
+		return c.Remove(name)
+	})
 }
 
+// RemoveAll removes path and everything below it. Unlike sftp.Client's
+// RemoveAll, it does not follow symlinks and succeeds if path does not exist.
 func (s Fs) RemoveAll(path string) error {
-	// TODO have a look at os.RemoveAll
-	// https://github.com/golang/go/blob/master/src/os/path.go#L66
-	return nil
+	return s.do(func(c *sftp.Client) error {
+		return removeAll(c, path)
+	})
+}
+
+func removeAll(c *sftp.Client, p string) error {
+	fi, err := c.Lstat(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return c.Remove(p)
+	}
+	entries, err := c.ReadDir(p)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := removeAll(c, path.Join(p, e.Name())); err != nil {
+			return err
+		}
+	}
+	return c.RemoveDirectory(p)
 }
 
+// Rename uses the posix-rename extension if the server supports it, so that
+// an existing newname is replaced like with os.Rename.
 func (s Fs) Rename(oldname, newname string) error {
-	return s.client.Rename(oldname, newname)
+	return s.doOnce(func(c *sftp.Client) error {
+		if _, ok := c.HasExtension("posix-rename@openssh.com"); ok {
+			return c.PosixRename(oldname, newname)
+		}
+		return c.Rename(oldname, newname)
+	})
 }
 
 func (s Fs) Stat(name string) (os.FileInfo, error) {
-	return s.client.Stat(name)
+	var fi os.FileInfo
+	err := s.do(func(c *sftp.Client) (err error) {
+		fi, err = c.Stat(name)
+		return err
+	})
+	return fi, err
 }
 
 func (s Fs) Lstat(p string) (os.FileInfo, error) {
-	return s.client.Lstat(p)
+	var fi os.FileInfo
+	err := s.do(func(c *sftp.Client) (err error) {
+		fi, err = c.Lstat(p)
+		return err
+	})
+	return fi, err
+}
+
+func (s Fs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	fi, err := s.Lstat(name)
+	return fi, true, err
+}
+
+func (s Fs) SymlinkIfPossible(oldname, newname string) error {
+	err := s.doOnce(func(c *sftp.Client) error {
+		return c.Symlink(oldname, newname)
+	})
+	if err != nil {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: err}
+	}
+	return nil
+}
+
+func (s Fs) ReadlinkIfPossible(name string) (string, error) {
+	var target string
+	err := s.do(func(c *sftp.Client) (err error) {
+		target, err = c.ReadLink(name)
+		return err
+	})
+	if err != nil {
+		return "", &os.PathError{Op: "readlink", Path: name, Err: err}
+	}
+	return target, nil
+}
+
+// LinkIfPossible creates a hard link with the hardlink extension, which
+// most servers support.
+func (s Fs) LinkIfPossible(oldname, newname string) error {
+	err := s.doOnce(func(c *sftp.Client) error {
+		return c.Link(oldname, newname)
+	})
+	if err != nil {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: err}
+	}
+	return nil
 }
 
 func (s Fs) Chmod(name string, mode os.FileMode) error {
-	return s.client.Chmod(name, mode)
+	return s.do(func(c *sftp.Client) error {
+		return c.Chmod(name, mode)
+	})
 }
 
 func (s Fs) Chown(name string, uid, gid int) error {
-	return s.client.Chown(name, uid, gid)
+	return s.do(func(c *sftp.Client) error {
+		return c.Chown(name, uid, gid)
+	})
 }
 
 func (s Fs) Chtimes(name string, atime time.Time, mtime time.Time) error {
-	return s.client.Chtimes(name, atime, mtime)
+	return s.do(func(c *sftp.Client) error {
+		return c.Chtimes(name, atime, mtime)
+	})
 }
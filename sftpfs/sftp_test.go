@@ -28,6 +28,8 @@ import (
 	"time"
 
 	"github.com/pkg/sftp"
+	"github.com/spf13/afero"
+	"github.com/spf13/afero/aferotest"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -280,3 +282,61 @@ func TestSftpCreate(t *testing.T) {
 	fmt.Println("done")
 	// TODO check here if "hello\tworld\n" is in buffer b
 }
+
+func TestSftpOptionalInterfaces(t *testing.T) {
+	client, err := (&pipeDialer{}).Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	fs := New(client)
+	dir := t.TempDir()
+
+	afero.WriteFile(fs, dir+"/a", []byte("a"), 0o644)
+	afero.WriteFile(fs, dir+"/b", []byte("b"), 0o644)
+	if err := fs.Rename(dir+"/a", dir+"/b"); err != nil {
+		t.Fatalf("Rename over existing file: %v", err)
+	}
+	if data, err := afero.ReadFile(fs, dir+"/b"); err != nil || string(data) != "a" {
+		t.Errorf("content after Rename = %q, %v", data, err)
+	}
+
+	if err := fs.(afero.Linker).SymlinkIfPossible(dir+"/b", dir+"/link"); err != nil {
+		t.Fatal(err)
+	}
+	if target, err := fs.(afero.LinkReader).ReadlinkIfPossible(dir + "/link"); err != nil || target != dir+"/b" {
+		t.Errorf("Readlink = %q, %v", target, err)
+	}
+	fi, lstat, err := fs.(afero.Lstater).LstatIfPossible(dir + "/link")
+	if err != nil || !lstat || fi.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("LstatIfPossible = %v, %v, %v", fi, lstat, err)
+	}
+	aferotest.CheckReaddir(t, fs, dir)
+
+	// RemoveAll must not follow symlinks out of the tree.
+	outside := t.TempDir()
+	afero.WriteFile(fs, outside+"/keep", []byte("keep"), 0o644)
+	fs.MkdirAll(dir+"/tree/sub", 0o755)
+	afero.WriteFile(fs, dir+"/tree/sub/f", []byte("f"), 0o644)
+	fs.(afero.Linker).SymlinkIfPossible(outside, dir+"/tree/out")
+	if err := fs.RemoveAll(dir + "/tree"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Stat(dir + "/tree"); !os.IsNotExist(err) {
+		t.Errorf("tree after RemoveAll: %v", err)
+	}
+	if _, err := os.Stat(outside + "/keep"); err != nil {
+		t.Errorf("RemoveAll followed a symlink: %v", err)
+	}
+	if err := fs.RemoveAll(dir + "/missing"); err != nil {
+		t.Errorf("RemoveAll of missing path = %v", err)
+	}
+
+	tm := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := fs.Chtimes(dir+"/b", tm, tm); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := fs.Stat(dir + "/b"); err != nil || !fi.ModTime().Equal(tm) {
+		t.Errorf("ModTime after Chtimes = %v, %v", fi.ModTime(), err)
+	}
+}
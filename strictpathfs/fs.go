@@ -0,0 +1,291 @@
+// Package strictpathfs provides an afero.Fs which rejects paths that are
+// not valid on Windows, whatever the OS it runs on, so that tests catch
+// names which would only fail in production on Windows.
+package strictpathfs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/spf13/afero"
+)
+
+// ErrInvalidPath is wrapped by the errors of paths breaking a rule, which
+// are returned in an *os.PathError or *os.LinkError.
+var ErrInvalidPath = errors.New("invalid path")
+
+// Rules is a set of checks applied to every path.
+type Rules uint
+
+const (
+	// ReservedNames rejects device names like CON, PRN, AUX, NUL, COM1 and
+	// LPT1 in any case, also with an extension as in "nul.txt".
+	ReservedNames Rules = 1 << iota
+
+	// TrailingDotsAndSpaces rejects names ending in a dot or a space, which
+	// Windows silently strips.
+	TrailingDotsAndSpaces
+
+	// IllegalCharacters rejects control characters and < > : " | ? * \ in
+	// names.
+	IllegalCharacters
+
+	// PathLength rejects paths longer than the maximum path length and
+	// names longer than 255 characters, counted in UTF-16 code units.
+	PathLength
+
+	// Windows is the set of all rules.
+	Windows = ReservedNames | TrailingDotsAndSpaces | IllegalCharacters | PathLength
+)
+
+// DefaultMaxPath is MAX_PATH without its terminating NUL.
+const DefaultMaxPath = 259
+
+// maxName is the longest name NTFS stores.
+const maxName = 255
+
+// Fs checks the paths passed to every operation, also those only reading,
+// before calling the base Fs. Rename and SymlinkIfPossible check both
+// names.
+type Fs struct {
+	base    afero.Fs
+	rules   Rules
+	maxPath int
+	checks  []func(name string) error
+}
+
+// Option configures an Fs created by New.
+type Option func(*Fs)
+
+// WithRules sets the rules to apply, the default is Windows.
+func WithRules(rules Rules) Option {
+	return func(fs *Fs) {
+		fs.rules = rules
+	}
+}
+
+// WithMaxPath sets the longest path accepted by the PathLength rule, the
+// default is DefaultMaxPath. Since the length of relative paths depends on
+// the working directory on Windows, this can be lowered to leave room for
+// it.
+func WithMaxPath(n int) Option {
+	return func(fs *Fs) {
+		fs.maxPath = n
+	}
+}
+
+// WithCheck adds a check of its own to the rules. An error it returns is
+// wrapped to match ErrInvalidPath.
+func WithCheck(check func(name string) error) Option {
+	return func(fs *Fs) {
+		fs.checks = append(fs.checks, check)
+	}
+}
+
+func New(base afero.Fs, opts ...Option) afero.Fs {
+	fs := &Fs{base: base, rules: Windows, maxPath: DefaultMaxPath}
+	for _, opt := range opts {
+		opt(fs)
+	}
+	return fs
+}
+
+var reserved = map[string]bool{"CON": true, "PRN": true, "AUX": true, "NUL": true}
+
+func init() {
+	for i := '1'; i <= '9'; i++ {
+		reserved["COM"+string(i)] = true
+		reserved["LPT"+string(i)] = true
+	}
+}
+
+func isSeparator(c rune) bool {
+	return c == '/' || c == filepath.Separator
+}
+
+func utf16Len(s string) int {
+	return len(utf16.Encode([]rune(s)))
+}
+
+// Validate returns an error wrapping ErrInvalidPath if name breaks one of
+// the rules of fs.
+func (fs *Fs) Validate(name string) error {
+	if fs.rules&PathLength != 0 && utf16Len(name) > fs.maxPath {
+		return fmt.Errorf("%w: longer than %d characters", ErrInvalidPath, fs.maxPath)
+	}
+	for _, elem := range strings.FieldsFunc(name[len(filepath.VolumeName(name)):], isSeparator) {
+		if elem == "." || elem == ".." {
+			continue
+		}
+		if err := fs.validateName(elem); err != nil {
+			return err
+		}
+	}
+	for _, check := range fs.checks {
+		if err := check(name); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidPath, err)
+		}
+	}
+	return nil
+}
+
+func (fs *Fs) validateName(elem string) error {
+	if fs.rules&PathLength != 0 && utf16Len(elem) > maxName {
+		return fmt.Errorf("%w: %q is longer than %d characters", ErrInvalidPath, elem, maxName)
+	}
+	if fs.rules&TrailingDotsAndSpaces != 0 && strings.TrimRight(elem, ". ") != elem {
+		return fmt.Errorf("%w: %q ends in a dot or a space", ErrInvalidPath, elem)
+	}
+	if fs.rules&IllegalCharacters != 0 {
+		if i := strings.IndexFunc(elem, func(c rune) bool {
+			return c < 32 || strings.ContainsRune(`<>:"|?*\`, c)
+		}); i >= 0 {
+			return fmt.Errorf("%w: %q contains %q", ErrInvalidPath, elem, elem[i])
+		}
+	}
+	if fs.rules&ReservedNames != 0 {
+		stem, _, _ := strings.Cut(elem, ".")
+		if reserved[strings.ToUpper(strings.TrimRight(stem, " "))] {
+			return fmt.Errorf("%w: %q is a reserved name", ErrInvalidPath, elem)
+		}
+	}
+	return nil
+}
+
+func (fs *Fs) check(op, name string) error {
+	if err := fs.Validate(name); err != nil {
+		return &os.PathError{Op: op, Path: name, Err: err}
+	}
+	return nil
+}
+
+func (fs *Fs) Name() string { return "StrictPathFs" }
+
+// Unwrap returns the base Fs, which accepts any path.
+func (fs *Fs) Unwrap() afero.Fs {
+	return fs.base
+}
+
+func (fs *Fs) Create(name string) (afero.File, error) {
+	if err := fs.check("open", name); err != nil {
+		return nil, err
+	}
+	return fs.base.Create(name)
+}
+
+func (fs *Fs) Mkdir(name string, perm os.FileMode) error {
+	if err := fs.check("mkdir", name); err != nil {
+		return err
+	}
+	return fs.base.Mkdir(name, perm)
+}
+
+func (fs *Fs) MkdirAll(path string, perm os.FileMode) error {
+	if err := fs.check("mkdir", path); err != nil {
+		return err
+	}
+	return fs.base.MkdirAll(path, perm)
+}
+
+func (fs *Fs) Open(name string) (afero.File, error) {
+	if err := fs.check("open", name); err != nil {
+		return nil, err
+	}
+	return fs.base.Open(name)
+}
+
+func (fs *Fs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	if err := fs.check("open", name); err != nil {
+		return nil, err
+	}
+	return fs.base.OpenFile(name, flag, perm)
+}
+
+func (fs *Fs) Remove(name string) error {
+	if err := fs.check("remove", name); err != nil {
+		return err
+	}
+	return fs.base.Remove(name)
+}
+
+func (fs *Fs) RemoveAll(path string) error {
+	if err := fs.check("removeall", path); err != nil {
+		return err
+	}
+	return fs.base.RemoveAll(path)
+}
+
+func (fs *Fs) Rename(oldname, newname string) error {
+	for _, name := range []string{oldname, newname} {
+		if err := fs.Validate(name); err != nil {
+			return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err}
+		}
+	}
+	return fs.base.Rename(oldname, newname)
+}
+
+func (fs *Fs) Stat(name string) (os.FileInfo, error) {
+	if err := fs.check("stat", name); err != nil {
+		return nil, err
+	}
+	return fs.base.Stat(name)
+}
+
+func (fs *Fs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	if err := fs.check("lstat", name); err != nil {
+		return nil, false, err
+	}
+	if lfs, ok := fs.base.(afero.Lstater); ok {
+		return lfs.LstatIfPossible(name)
+	}
+	fi, err := fs.base.Stat(name)
+	return fi, false, err
+}
+
+func (fs *Fs) SymlinkIfPossible(oldname, newname string) error {
+	for _, name := range []string{oldname, newname} {
+		if err := fs.Validate(name); err != nil {
+			return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: err}
+		}
+	}
+	if linker, ok := fs.base.(afero.Linker); ok {
+		return linker.SymlinkIfPossible(oldname, newname)
+	}
+	return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: afero.ErrNoSymlink}
+}
+
+func (fs *Fs) ReadlinkIfPossible(name string) (string, error) {
+	if err := fs.check("readlink", name); err != nil {
+		return "", err
+	}
+	if reader, ok := fs.base.(afero.LinkReader); ok {
+		return reader.ReadlinkIfPossible(name)
+	}
+	return "", &os.PathError{Op: "readlink", Path: name, Err: afero.ErrNoReadlink}
+}
+
+func (fs *Fs) Chmod(name string, mode os.FileMode) error {
+	if err := fs.check("chmod", name); err != nil {
+		return err
+	}
+	return fs.base.Chmod(name, mode)
+}
+
+func (fs *Fs) Chown(name string, uid, gid int) error {
+	if err := fs.check("chown", name); err != nil {
+		return err
+	}
+	return fs.base.Chown(name, uid, gid)
+}
+
+func (fs *Fs) Chtimes(name string, atime, mtime time.Time) error {
+	if err := fs.check("chtimes", name); err != nil {
+		return err
+	}
+	return fs.base.Chtimes(name, atime, mtime)
+}
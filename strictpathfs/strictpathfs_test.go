@@ -0,0 +1,106 @@
+package strictpathfs
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/spf13/afero/aferotest"
+)
+
+func TestValidate(t *testing.T) {
+	fs := New(afero.NewMemMapFs()).(*Fs)
+	for _, tt := range []struct {
+		name  string
+		valid bool
+	}{
+		{"/dir/file.txt", true},
+		{"relative/../path/.hidden", true},
+		{"/dir/CON", false},
+		{"/dir/nul.txt", false},
+		{"/Lpt3/file", false},
+		{"/dir/com1 .log", false},
+		{"/dir/console", true},
+		{"/dir/file.", false},
+		{"/dir /file", false},
+		{"/dir/a:b", false},
+		{"/dir/a*b", false},
+		{`/dir/a\b`, false},
+		{"/dir/tab\there", false},
+		{"/" + strings.Repeat("a", 255), true},
+		{"/" + strings.Repeat("a", 256), false},
+		{strings.Repeat("/abcdefghi", 25), true},
+		{strings.Repeat("/abcdefghi", 26), false},
+		{"/" + strings.Repeat("é", 200), true},
+		{"/" + strings.Repeat("😀", 200), false},
+	} {
+		err := fs.Validate(tt.name)
+		if tt.valid && err != nil {
+			t.Errorf("Validate(%q) = %v", tt.name, err)
+		}
+		if !tt.valid && !errors.Is(err, ErrInvalidPath) {
+			t.Errorf("Validate(%q) = %v, want ErrInvalidPath", tt.name, err)
+		}
+	}
+}
+
+func TestOptions(t *testing.T) {
+	errUpper := errors.New("upper case")
+	fs := New(afero.NewMemMapFs(),
+		WithRules(ReservedNames),
+		WithMaxPath(10),
+		WithCheck(func(name string) error {
+			if strings.ToLower(name) != name {
+				return errUpper
+			}
+			return nil
+		}),
+	).(*Fs)
+	if err := fs.Validate("/a:b/file./with a very long name"); err != nil {
+		t.Errorf("disabled rules were applied: %v", err)
+	}
+	if err := fs.Validate("/aux"); !errors.Is(err, ErrInvalidPath) {
+		t.Errorf("Validate of a reserved name = %v", err)
+	}
+	if err := fs.Validate("/Upper"); !errors.Is(err, ErrInvalidPath) || !errors.Is(err, errUpper) {
+		t.Errorf("Validate with a check = %v, want ErrInvalidPath and the error of the check", err)
+	}
+}
+
+func TestOperations(t *testing.T) {
+	base := afero.NewMemMapFs()
+	fs := New(base)
+
+	if err := afero.WriteFile(fs, "/dir/file", []byte("ok"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var perr *os.PathError
+	if _, err := fs.Create("/dir/aux.go"); !errors.As(err, &perr) || perr.Op != "open" || !errors.Is(err, ErrInvalidPath) {
+		t.Errorf("Create = %v, want a PathError wrapping ErrInvalidPath", err)
+	}
+	if err := fs.MkdirAll("/dir/sub./x", 0o755); !errors.Is(err, ErrInvalidPath) {
+		t.Errorf("MkdirAll = %v", err)
+	}
+	var lerr *os.LinkError
+	if err := fs.Rename("/dir/file", "/dir/what?"); !errors.As(err, &lerr) || !errors.Is(err, ErrInvalidPath) {
+		t.Errorf("Rename = %v, want a LinkError wrapping ErrInvalidPath", err)
+	}
+
+	// names already in the base are rejected too
+	afero.WriteFile(base, "/dir/prn", nil, 0o644)
+	if _, err := fs.Stat("/dir/prn"); !errors.Is(err, ErrInvalidPath) {
+		t.Errorf("Stat = %v", err)
+	}
+	if got, err := afero.ReadFile(fs, "/dir/file"); err != nil || string(got) != "ok" {
+		t.Errorf("ReadFile = %q, %v", got, err)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	newFs := func(t *testing.T) afero.Fs {
+		return New(afero.NewMemMapFs())
+	}
+	aferotest.Conformance(t, newFs, afero.Capabilities(newFs(t)))
+}
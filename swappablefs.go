@@ -0,0 +1,212 @@
+package afero
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	_ Lstater        = (*AtomicSwappableFs)(nil)
+	_ fs.ReadDirFile = (*SwappableFile)(nil)
+)
+
+// The AtomicSwappableFs forwards all calls to an inner Fs that can be
+// replaced at any time with Store or Swap, e.g. to point a service to a new
+// BasePathFs root after a release without restarting it.
+//
+// Every call uses the Fs that was current when it started. Files stay bound
+// to the Fs they were opened on; Swap returns a channel that is closed once
+// all files opened on the previous Fs have been closed, so it can be
+// released safely.
+type AtomicSwappableFs struct {
+	current atomic.Pointer[swapGeneration]
+}
+
+type swapGeneration struct {
+	fs Fs
+
+	mu      sync.Mutex
+	open    int
+	retired bool
+	drained chan struct{}
+}
+
+func newSwapGeneration(fs Fs) *swapGeneration {
+	return &swapGeneration{fs: fs, drained: make(chan struct{})}
+}
+
+// acquire registers a file about to be opened. It fails once the generation
+// has been swapped out, the caller has to retry on the current one.
+func (g *swapGeneration) acquire() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.retired {
+		return false
+	}
+	g.open++
+	return true
+}
+
+func (g *swapGeneration) release() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.open--
+	if g.retired && g.open == 0 {
+		close(g.drained)
+	}
+}
+
+func (g *swapGeneration) retire() <-chan struct{} {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.retired = true
+	if g.open == 0 {
+		close(g.drained)
+	}
+	return g.drained
+}
+
+func NewAtomicSwappableFs(initial Fs) *AtomicSwappableFs {
+	s := &AtomicSwappableFs{}
+	s.current.Store(newSwapGeneration(initial))
+	return s
+}
+
+// Load returns the current inner Fs.
+func (s *AtomicSwappableFs) Load() Fs {
+	return s.current.Load().fs
+}
+
+// Store replaces the inner Fs without waiting for open files.
+func (s *AtomicSwappableFs) Store(fs Fs) {
+	s.Swap(fs)
+}
+
+// Swap replaces the inner Fs and returns the previous one together with a
+// channel that is closed once all files opened on it have been closed.
+func (s *AtomicSwappableFs) Swap(fs Fs) (old Fs, drained <-chan struct{}) {
+	prev := s.current.Swap(newSwapGeneration(fs))
+	return prev.fs, prev.retire()
+}
+
+// SwappableFile is returned by AtomicSwappableFs and keeps track of the
+// generation of the inner Fs it was opened on.
+type SwappableFile struct {
+	File
+	gen    *swapGeneration
+	closed atomic.Bool
+}
+
+func (f *SwappableFile) Close() error {
+	err := f.File.Close()
+	if f.closed.CompareAndSwap(false, true) {
+		f.gen.release()
+	}
+	return err
+}
+
+func (f *SwappableFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if rdf, ok := f.File.(fs.ReadDirFile); ok {
+		return rdf.ReadDir(n)
+	}
+	return readDirFile{f.File}.ReadDir(n)
+}
+
+func (f *SwappableFile) ReadFrom(r io.Reader) (int64, error) {
+	return readFrom(f.File, r)
+}
+
+func (f *SwappableFile) WriteTo(w io.Writer) (int64, error) {
+	return writeTo(f.File, w)
+}
+
+func (s *AtomicSwappableFs) openWith(open func(Fs) (File, error)) (File, error) {
+	for {
+		gen := s.current.Load()
+		if !gen.acquire() {
+			continue
+		}
+		f, err := open(gen.fs)
+		if err != nil {
+			gen.release()
+			return nil, err
+		}
+		return &SwappableFile{File: f, gen: gen}, nil
+	}
+}
+
+func (s *AtomicSwappableFs) Name() string {
+	return "AtomicSwappableFs"
+}
+
+// Unwrap returns the current inner Fs, like Load.
+func (s *AtomicSwappableFs) Unwrap() Fs {
+	return s.Load()
+}
+
+// Capabilities returns those of the current inner Fs which do not depend on
+// it staying the same.
+func (s *AtomicSwappableFs) Capabilities() Capability {
+	return Capabilities(s.Load()) & (CapLstat | CapAtomicRename | CapReadAt)
+}
+
+func (s *AtomicSwappableFs) Create(name string) (File, error) {
+	return s.openWith(func(fs Fs) (File, error) { return fs.Create(name) })
+}
+
+func (s *AtomicSwappableFs) Open(name string) (File, error) {
+	return s.openWith(func(fs Fs) (File, error) { return fs.Open(name) })
+}
+
+func (s *AtomicSwappableFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	return s.openWith(func(fs Fs) (File, error) { return fs.OpenFile(name, flag, perm) })
+}
+
+func (s *AtomicSwappableFs) Mkdir(name string, perm os.FileMode) error {
+	return s.Load().Mkdir(name, perm)
+}
+
+func (s *AtomicSwappableFs) MkdirAll(path string, perm os.FileMode) error {
+	return s.Load().MkdirAll(path, perm)
+}
+
+func (s *AtomicSwappableFs) Remove(name string) error {
+	return s.Load().Remove(name)
+}
+
+func (s *AtomicSwappableFs) RemoveAll(path string) error {
+	return s.Load().RemoveAll(path)
+}
+
+func (s *AtomicSwappableFs) Rename(oldname, newname string) error {
+	return s.Load().Rename(oldname, newname)
+}
+
+func (s *AtomicSwappableFs) Stat(name string) (os.FileInfo, error) {
+	return s.Load().Stat(name)
+}
+
+func (s *AtomicSwappableFs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	fs := s.Load()
+	if lsf, ok := fs.(Lstater); ok {
+		return lsf.LstatIfPossible(name)
+	}
+	fi, err := fs.Stat(name)
+	return fi, false, err
+}
+
+func (s *AtomicSwappableFs) Chmod(name string, mode os.FileMode) error {
+	return s.Load().Chmod(name, mode)
+}
+
+func (s *AtomicSwappableFs) Chown(name string, uid, gid int) error {
+	return s.Load().Chown(name, uid, gid)
+}
+
+func (s *AtomicSwappableFs) Chtimes(name string, atime, mtime time.Time) error {
+	return s.Load().Chtimes(name, atime, mtime)
+}
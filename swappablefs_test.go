@@ -0,0 +1,90 @@
+package afero
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAtomicSwappableFs(t *testing.T) {
+	first, second := NewMemMapFs(), NewMemMapFs()
+	WriteFile(first, "/file", []byte("first"), 0o644)
+	WriteFile(second, "/file", []byte("second"), 0o644)
+
+	sfs := NewAtomicSwappableFs(first)
+	if b, _ := ReadFile(sfs, "/file"); string(b) != "first" {
+		t.Fatalf("got %q", b)
+	}
+
+	f, err := sfs.Open("/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old, drained := sfs.Swap(second)
+	if old != first {
+		t.Error("Swap did not return the previous Fs")
+	}
+	if b, _ := ReadFile(sfs, "/file"); string(b) != "second" {
+		t.Fatalf("got %q", b)
+	}
+
+	select {
+	case <-drained:
+		t.Fatal("drained before the open file was closed")
+	default:
+	}
+
+	// the open file still reads from the old Fs
+	if b, _ := ReadAll(f); string(b) != "first" {
+		t.Errorf("got %q", b)
+	}
+	f.Close()
+	f.Close()
+
+	select {
+	case <-drained:
+	case <-time.After(time.Second):
+		t.Fatal("not drained after the open file was closed")
+	}
+
+	if _, drained := sfs.Swap(first); drained == nil {
+		t.Fatal("nil drain channel")
+	} else {
+		select {
+		case <-drained:
+		default:
+			t.Error("Fs without open files should be drained immediately")
+		}
+	}
+}
+
+func TestAtomicSwappableFsConcurrent(t *testing.T) {
+	a, b := NewMemMapFs(), NewMemMapFs()
+	WriteFile(a, "/file", []byte("a"), 0o644)
+	WriteFile(b, "/file", []byte("b"), 0o644)
+	sfs := NewAtomicSwappableFs(a)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if _, err := ReadFile(sfs, "/file"); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 50; i++ {
+		next := a
+		if i%2 == 0 {
+			next = b
+		}
+		_, drained := sfs.Swap(next)
+		go func() { <-drained }()
+	}
+	wg.Wait()
+}
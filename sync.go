@@ -0,0 +1,319 @@
+package afero
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// SyncCompare selects how Sync decides that a file is unchanged.
+type SyncCompare int
+
+const (
+	// SyncSizeModTime skips files with the same size and modification time,
+	// compared to the second.
+	SyncSizeModTime SyncCompare = iota
+	// SyncSize skips files with the same size.
+	SyncSize
+	// SyncHash skips files with the same size and content hash.
+	SyncHash
+	// SyncAlways copies every file.
+	SyncAlways
+)
+
+// SyncOptions configures Sync.
+type SyncOptions struct {
+	// SrcDir and DstDir are the directories to mirror. Both default to "/".
+	SrcDir, DstDir string
+
+	// Delete removes files and directories from DstDir which are not in
+	// SrcDir. Excluded paths are never removed.
+	Delete bool
+
+	// Compare decides which files are copied.
+	Compare SyncCompare
+
+	// Hash creates the hash for SyncHash. Defaults to sha256.New.
+	Hash func() hash.Hash
+
+	// Include and Exclude are glob patterns in the syntax of filepath.Match,
+	// matched against base names. A file is synced if it matches an include
+	// pattern (or there are none) and no exclude pattern. Excluded
+	// directories are skipped along with their contents.
+	Include, Exclude []string
+
+	// DryRun only returns the actions without applying them.
+	DryRun bool
+
+	// Delta updates changed files in place where the destination supports
+	// writing at offsets. The files are compared in blocks of DeltaBlockSize
+	// bytes, 64 KiB by default, and only the blocks which differ are
+	// written, e.g. the end of a file which was appended to. This reads the
+	// destination file, so it pays off where writing costs more than
+	// reading. Other destinations get the whole file.
+	Delta          bool
+	DeltaBlockSize int
+
+	// Workers is the maximum number of files copied at once, as by the
+	// CopyWorkers option of CopyDir: how many are copied at once is tuned
+	// to the probed latency of the file systems. 0 and 1 copy the files one
+	// by one.
+	Workers int
+}
+
+// SyncOp is the kind of a SyncAction.
+type SyncOp int
+
+const (
+	SyncMkdir SyncOp = iota
+	SyncCopy
+	SyncRemove
+)
+
+func (op SyncOp) String() string {
+	switch op {
+	case SyncMkdir:
+		return "mkdir"
+	case SyncCopy:
+		return "copy"
+	case SyncRemove:
+		return "remove"
+	}
+	return "unknown"
+}
+
+// SyncAction is a change Sync makes to the destination. Path is relative
+// to the synced directories.
+type SyncAction struct {
+	Op   SyncOp
+	Path string
+}
+
+// Sync mirrors the tree below opts.SrcDir in src into opts.DstDir in dst,
+// creating directories and copying the files which differ. Copied files
+// get the mode and modification time of the source. Symlinks to files are
+// copied as regular files, other symlinks and special files are skipped.
+//
+// Sync returns the actions in the order they are applied. They stop at the
+// first failing one, whose error is returned. With Workers, copies run
+// concurrently and the actions include those started before the failure.
+func Sync(dst, src Fs, opts SyncOptions) ([]SyncAction, error) {
+	if opts.SrcDir == "" {
+		opts.SrcDir = "/"
+	}
+	if opts.DstDir == "" {
+		opts.DstDir = "/"
+	}
+	if opts.Hash == nil {
+		opts.Hash = sha256.New
+	}
+	for _, patterns := range [][]string{opts.Include, opts.Exclude} {
+		for _, p := range patterns {
+			if _, err := filepath.Match(p, ""); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	s := &syncer{dst: dst, src: src, opts: opts, seen: make(map[string]bool), removed: make(map[string]bool)}
+	s.pool = newWorkerPool(opts.Workers,
+		func() { src.Stat(opts.SrcDir) },
+		func() { dst.Stat(opts.DstDir) })
+	err := Walk(src, opts.SrcDir, s.visit)
+	if werr := s.pool.wait(); err == nil {
+		err = werr
+	}
+	if err != nil {
+		return s.actions, err
+	}
+	if opts.Delete {
+		if err := Walk(dst, opts.DstDir, s.prune); err != nil && !os.IsNotExist(err) {
+			return s.actions, err
+		}
+	}
+	return s.actions, nil
+}
+
+type syncer struct {
+	dst, src Fs
+	opts     SyncOptions
+	seen     map[string]bool
+	removed  map[string]bool
+	actions  []SyncAction
+	pool     *workerPool
+}
+
+// excluded reports whether the filters skip the path.
+func (s *syncer) excluded(name string, dir bool) bool {
+	base := filepath.Base(name)
+	for _, p := range s.opts.Exclude {
+		if ok, _ := filepath.Match(p, base); ok {
+			return true
+		}
+	}
+	if dir || len(s.opts.Include) == 0 {
+		return false
+	}
+	for _, p := range s.opts.Include {
+		if ok, _ := filepath.Match(p, base); ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *syncer) visit(name string, info os.FileInfo, err error) error {
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(s.opts.SrcDir, name)
+	if err != nil {
+		return err
+	}
+	if rel != "." && s.excluded(rel, info.IsDir()) {
+		if info.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		if info, err = s.src.Stat(name); err != nil || info.IsDir() {
+			return nil
+		}
+	}
+	if !info.IsDir() && !info.Mode().IsRegular() {
+		return nil
+	}
+	s.seen[rel] = true
+
+	target := filepath.Join(s.opts.DstDir, rel)
+	dfi, err := lstatIfPossible(s.dst, target)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	exists := err == nil
+	if exists && dfi.IsDir() != info.IsDir() {
+		if err := s.apply(SyncAction{Op: SyncRemove, Path: rel}); err != nil {
+			return err
+		}
+		exists = false
+	}
+
+	if info.IsDir() {
+		if exists {
+			return nil
+		}
+		return s.apply(SyncAction{Op: SyncMkdir, Path: rel})
+	}
+	if exists {
+		same, err := s.same(name, info, target, dfi)
+		if err != nil || same {
+			return err
+		}
+	}
+	return s.apply(SyncAction{Op: SyncCopy, Path: rel})
+}
+
+// prune removes the files in the destination which were not seen in the
+// source.
+func (s *syncer) prune(name string, info os.FileInfo, err error) error {
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(s.opts.DstDir, name)
+	if err != nil {
+		return err
+	}
+	if s.removed[rel] && info.IsDir() {
+		return filepath.SkipDir
+	}
+	if rel == "." || s.seen[rel] {
+		return nil
+	}
+	if s.excluded(rel, info.IsDir()) {
+		if info.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	}
+	if err := s.apply(SyncAction{Op: SyncRemove, Path: rel}); err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return filepath.SkipDir
+	}
+	return nil
+}
+
+// same reports whether the source and destination files are considered
+// equal by the configured comparison.
+func (s *syncer) same(srcName string, sfi os.FileInfo, dstName string, dfi os.FileInfo) (bool, error) {
+	switch s.opts.Compare {
+	case SyncAlways:
+		return false, nil
+	case SyncSize:
+		return sfi.Size() == dfi.Size(), nil
+	case SyncHash:
+		if sfi.Size() != dfi.Size() {
+			return false, nil
+		}
+		sum1, err := s.sum(s.src, srcName)
+		if err != nil {
+			return false, err
+		}
+		sum2, err := s.sum(s.dst, dstName)
+		if err != nil {
+			return false, err
+		}
+		return bytes.Equal(sum1, sum2), nil
+	}
+	return sfi.Size() == dfi.Size() &&
+		sfi.ModTime().Truncate(time.Second).Equal(dfi.ModTime().Truncate(time.Second)), nil
+}
+
+func (s *syncer) sum(fs Fs, name string) ([]byte, error) {
+	f, err := fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := s.opts.Hash()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// apply records the action and carries it out unless this is a dry run.
+func (s *syncer) apply(a SyncAction) error {
+	s.actions = append(s.actions, a)
+	if a.Op == SyncRemove {
+		s.removed[a.Path] = true
+	}
+	if s.opts.DryRun {
+		return nil
+	}
+	srcName := filepath.Join(s.opts.SrcDir, a.Path)
+	dstName := filepath.Join(s.opts.DstDir, a.Path)
+	switch a.Op {
+	case SyncMkdir:
+		fi, err := s.src.Stat(srcName)
+		if err != nil {
+			return err
+		}
+		return s.dst.MkdirAll(dstName, fi.Mode().Perm())
+	case SyncRemove:
+		return s.dst.RemoveAll(dstName)
+	}
+	o := &copyOptions{strictMetadata: true}
+	if s.opts.Delta {
+		CopyDelta(s.opts.DeltaBlockSize)(o)
+	}
+	return s.pool.run(func() error {
+		return copyFileTo(s.dst, dstName, s.src, srcName, o)
+	})
+}
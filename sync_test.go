@@ -0,0 +1,115 @@
+package afero
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSync(t *testing.T) {
+	src, dst := NewMemMapFs(), NewMemMapFs()
+	for name, content := range map[string]string{
+		"/src/a.txt":       "a",
+		"/src/b.txt":       "b",
+		"/src/sub/c.txt":   "c",
+		"/src/skip/d.txt":  "d",
+		"/src/e.log":       "e",
+		"/dst/stale.txt":   "old",
+		"/dst/old/x.txt":   "x",
+		"/dst/keep.log":    "log",
+		"/dst/b.txt":       "bb",
+		"/dst/sub/c.txt/f": "dir in the way",
+	} {
+		fs := dst
+		if strings.HasPrefix(name, "/src/") {
+			fs = src
+		}
+		if err := WriteFile(fs, name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	opts := SyncOptions{
+		SrcDir:  "/src",
+		DstDir:  "/dst",
+		Delete:  true,
+		Include: []string{"*.txt"},
+		Exclude: []string{"skip"},
+		DryRun:  true,
+	}
+	plan, err := Sync(dst, src, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []SyncAction{
+		{SyncCopy, "a.txt"},
+		{SyncCopy, "b.txt"},
+		{SyncRemove, "sub/c.txt"},
+		{SyncCopy, "sub/c.txt"},
+		{SyncRemove, "old"},
+		{SyncRemove, "stale.txt"},
+	}
+	if !reflect.DeepEqual(plan, want) {
+		t.Fatalf("plan = %v, want %v", plan, want)
+	}
+	if ok, _ := Exists(dst, "/dst/a.txt"); ok {
+		t.Fatal("dry run copied a file")
+	}
+
+	opts.DryRun = false
+	actions, err := Sync(dst, src, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(actions, want) {
+		t.Errorf("actions = %v, want %v", actions, want)
+	}
+	for name, content := range map[string]string{
+		"/dst/a.txt":     "a",
+		"/dst/b.txt":     "b",
+		"/dst/sub/c.txt": "c",
+		"/dst/keep.log":  "log",
+	} {
+		if data, err := ReadFile(dst, name); err != nil || string(data) != content {
+			t.Errorf("%s = %q, %v, want %q", name, data, err, content)
+		}
+	}
+	for _, name := range []string{"/dst/stale.txt", "/dst/old", "/dst/skip", "/dst/e.log"} {
+		if ok, _ := Exists(dst, name); ok {
+			t.Errorf("%s exists", name)
+		}
+	}
+
+	// A second run has nothing to do.
+	if actions, err := Sync(dst, src, opts); err != nil || len(actions) != 0 {
+		t.Errorf("second Sync = %v, %v, want no actions", actions, err)
+	}
+}
+
+func TestSyncCompare(t *testing.T) {
+	src, dst := NewMemMapFs(), NewMemMapFs()
+	mtime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	WriteFile(src, "/f", []byte("new"), 0o644)
+	WriteFile(dst, "/f", []byte("old"), 0o644)
+	src.Chtimes("/f", mtime, mtime)
+	dst.Chtimes("/f", mtime, mtime)
+
+	for _, tc := range []struct {
+		compare SyncCompare
+		copies  bool
+	}{
+		{SyncSizeModTime, false},
+		{SyncSize, false},
+		{SyncHash, true},
+		{SyncAlways, true},
+	} {
+		actions, err := Sync(dst, src, SyncOptions{Compare: tc.compare, DryRun: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if copies := len(actions) == 1; copies != tc.copies {
+			t.Errorf("compare %d: actions = %v, want copy %v", tc.compare, actions, tc.copies)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package afero
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// TarOption configures WriteTar.
+type TarOption func(*tarOptions)
+
+type tarOptions struct {
+	prefix string
+	filter func(path string, info os.FileInfo) bool
+}
+
+// TarWithPrefix prepends prefix to the names of all entries, e.g. "app/".
+func TarWithPrefix(prefix string) TarOption {
+	return func(o *tarOptions) {
+		o.prefix = prefix
+	}
+}
+
+// TarWithFilter only writes the files for which filter returns true.
+// Excluded directories are skipped along with their contents.
+func TarWithFilter(filter func(path string, info os.FileInfo) bool) TarOption {
+	return func(o *tarOptions) {
+		o.filter = filter
+	}
+}
+
+// WriteTar walks the file tree rooted at root and writes it to w as a tar
+// stream. Entry names are relative to root and use forward slashes; root
+// itself is not written. Modes and modification times are preserved, as
+// are symlinks if fs supports reading them. It is the inverse of tarfs.
+func WriteTar(fs Fs, root string, w io.Writer, opts ...TarOption) error {
+	var o tarOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	tw := tar.NewWriter(w)
+	err := Walk(fs, root, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, name)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		if o.filter != nil && !o.filter(name, info) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		var link string
+		if info.Mode()&os.ModeSymlink != 0 {
+			lr, ok := fs.(LinkReader)
+			if !ok {
+				return &os.PathError{Op: "readlink", Path: name, Err: ErrNoReadlink}
+			}
+			if link, err = lr.ReadlinkIfPossible(name); err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = path.Join(o.prefix, filepath.ToSlash(rel))
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		f, err := fs.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+func (a Afero) WriteTar(root string, w io.Writer, opts ...TarOption) error {
+	return WriteTar(a.Fs, root, w, opts...)
+}
@@ -0,0 +1,70 @@
+package afero
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteTar(t *testing.T) {
+	fs := &MemMapFs{}
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	fs.MkdirAll("/root/dir", 0o750)
+	WriteFile(fs, "/root/dir/file.txt", []byte("hello tar"), 0o640)
+	WriteFile(fs, "/root/skip.log", []byte("skipped"), 0o644)
+	fs.Chtimes("/root/dir/file.txt", mtime, mtime)
+	fs.SymlinkIfPossible("dir/file.txt", "/root/link")
+
+	var buf bytes.Buffer
+	err := WriteTar(fs, "/root", &buf,
+		TarWithPrefix("app"),
+		TarWithFilter(func(path string, info os.FileInfo) bool {
+			return !strings.HasSuffix(path, ".log")
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type entry struct {
+		typ     byte
+		mode    int64
+		content string
+		link    string
+	}
+	got := map[string]entry{}
+	var order []string
+	tr := tar.NewReader(&buf)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(tr)
+		got[hdr.Name] = entry{hdr.Typeflag, hdr.Mode & 0o777, string(content), hdr.Linkname}
+		order = append(order, hdr.Name)
+		if hdr.Name == "app/dir/file.txt" && !hdr.ModTime.Equal(mtime) {
+			t.Errorf("mod time = %v, want %v", hdr.ModTime, mtime)
+		}
+	}
+
+	want := map[string]entry{
+		"app/dir/":         {tar.TypeDir, 0o750, "", ""},
+		"app/dir/file.txt": {tar.TypeReg, 0o640, "hello tar", ""},
+		"app/link":         {tar.TypeSymlink, 0o777, "", "dir/file.txt"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("entries = %v, want %d entries", order, len(want))
+	}
+	for name, w := range want {
+		if got[name] != w {
+			t.Errorf("%s = %+v, want %+v", name, got[name], w)
+		}
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !plan9
+// +build !plan9
+
+package tarfs
+
+import "syscall"
+
+// errROFS is returned by all mutating operations on the read-only tarfs.
+const errROFS = syscall.EROFS
@@ -0,0 +1,10 @@
+//go:build plan9
+// +build plan9
+
+package tarfs
+
+import "syscall"
+
+// errROFS is returned by all mutating operations on the read-only tarfs.
+// Plan 9 has no EROFS, so use the message its kernel reports instead.
+const errROFS = syscall.ErrorString("file system is read only")
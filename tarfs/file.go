@@ -2,20 +2,22 @@ package tarfs
 
 import (
 	"archive/tar"
-	"bytes"
+	"io"
 	"os"
 	"path/filepath"
 	"sort"
 	"syscall"
 
 	"github.com/spf13/afero"
+	"github.com/spf13/afero/internal/common"
 )
 
 type File struct {
 	h      *tar.Header
-	data   *bytes.Reader
+	data   *io.SectionReader
 	closed bool
 	fs     *Fs
+	dir    common.DirLister
 }
 
 func (f *File) Close() error {
@@ -40,6 +42,10 @@ func (f *File) Read(p []byte) (n int, err error) {
 		return 0, syscall.EISDIR
 	}
 
+	if len(p) == 0 {
+		return 0, nil
+	}
+
 	return f.data.Read(p)
 }
 
@@ -67,9 +73,9 @@ func (f *File) Seek(offset int64, whence int) (int64, error) {
 	return f.data.Seek(offset, whence)
 }
 
-func (f *File) Write(p []byte) (n int, err error) { return 0, syscall.EROFS }
+func (f *File) Write(p []byte) (n int, err error) { return 0, errROFS }
 
-func (f *File) WriteAt(p []byte, off int64) (n int, err error) { return 0, syscall.EROFS }
+func (f *File) WriteAt(p []byte, off int64) (n int, err error) { return 0, errROFS }
 
 func (f *File) Name() string {
 	return filepath.Join(splitpath(f.h.Name))
@@ -99,26 +105,23 @@ func (f *File) Readdir(count int) ([]os.FileInfo, error) {
 		return nil, syscall.ENOTDIR
 	}
 
-	names, err := f.getDirectoryNames()
-	if err != nil {
-		return nil, err
-	}
-
-	d := f.fs.files[f.Name()]
-	var fi []os.FileInfo
-	for _, n := range names {
-		if n == "" {
-			continue
+	return f.dir.Readdir(count, func() ([]os.FileInfo, error) {
+		names, err := f.getDirectoryNames()
+		if err != nil {
+			return nil, err
 		}
 
-		f := d[n]
-		fi = append(fi, f.h.FileInfo())
-		if count > 0 && len(fi) >= count {
-			break
+		d := f.fs.files[f.Name()]
+		var fi []os.FileInfo
+		for _, n := range names {
+			if n == "" {
+				continue
+			}
+			fi = append(fi, d[n].h.FileInfo())
 		}
-	}
 
-	return fi, nil
+		return fi, io.EOF
+	})
 }
 
 func (f *File) Readdirnames(n int) ([]string, error) {
@@ -139,6 +142,6 @@ func (f *File) Stat() (os.FileInfo, error) { return f.h.FileInfo(), nil }
 
 func (f *File) Sync() error { return nil }
 
-func (f *File) Truncate(size int64) error { return syscall.EROFS }
+func (f *File) Truncate(size int64) error { return errROFS }
 
-func (f *File) WriteString(s string) (ret int, err error) { return 0, syscall.EROFS }
+func (f *File) WriteString(s string) (ret int, err error) { return 0, errROFS }
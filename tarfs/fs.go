@@ -4,13 +4,17 @@ package tarfs
 import (
 	"archive/tar"
 	"bytes"
+	"errors"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/spf13/afero"
+	"github.com/spf13/afero/internal/common"
 )
 
 type Fs struct {
@@ -39,45 +43,117 @@ func New(t *tar.Reader) *Fs {
 			return nil
 		}
 
-		d, f := splitpath(hdr.Name)
-		if _, ok := fs.files[d]; !ok {
-			fs.files[d] = make(map[string]*File)
+		data, err := readAll(t, hdr)
+		if err != nil {
+			panic("tarfs: " + err.Error())
 		}
+		fs.add(hdr, data)
+	}
+	fs.addRoot()
 
-		var buf bytes.Buffer
-		size, err := buf.ReadFrom(t)
+	return fs
+}
+
+// NewFromReaderAt returns a Fs serving the tar archive of size bytes read
+// from r. Unlike New, it does not hold the contents of the files in memory:
+// it reads the headers once to find where they are, and then serves reads
+// of files directly from r, so that large archives can be mounted lazily.
+// Only the contents of sparse files are read into memory.
+//
+// r must not change while the Fs is in use.
+func NewFromReaderAt(r io.ReaderAt, size int64) (*Fs, error) {
+	fs := &Fs{files: make(map[string]map[string]*File)}
+	archive := io.NewSectionReader(r, 0, size)
+	t := tar.NewReader(archive)
+	for {
+		hdr, err := t.Next()
+		if err == io.EOF {
+			break
+		}
 		if err != nil {
-			panic("tarfs: reading from tar:" + err.Error())
+			return nil, err
 		}
 
-		if size != hdr.Size {
-			panic("tarfs: size mismatch")
+		if isSparse(hdr) {
+			// the stored data is not the content of the file
+			data, err := readAll(t, hdr)
+			if err != nil {
+				return nil, err
+			}
+			fs.add(hdr, data)
+			continue
+		}
+		// tar.Reader leaves archive positioned at the data of the entry
+		off, err := archive.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, err
+		}
+		if off+hdr.Size > size {
+			return nil, io.ErrUnexpectedEOF
 		}
+		fs.add(hdr, io.NewSectionReader(r, off, hdr.Size))
+	}
+	fs.addRoot()
+
+	return fs, nil
+}
+
+// readAll reads the content of the current entry of t into memory.
+func readAll(t *tar.Reader, hdr *tar.Header) (*io.SectionReader, error) {
+	var buf bytes.Buffer
+	size, err := buf.ReadFrom(t)
+	if err != nil {
+		return nil, fmt.Errorf("reading from tar: %w", err)
+	}
+	if size != hdr.Size {
+		return nil, errors.New("size mismatch")
+	}
+	return io.NewSectionReader(bytes.NewReader(buf.Bytes()), 0, size), nil
+}
 
-		file := &File{
-			h:    hdr,
-			data: bytes.NewReader(buf.Bytes()),
-			fs:   fs,
+// isSparse reports whether hdr is a sparse file in one of the GNU formats.
+func isSparse(hdr *tar.Header) bool {
+	if hdr.Typeflag == tar.TypeGNUSparse {
+		return true
+	}
+	for k := range hdr.PAXRecords {
+		if strings.HasPrefix(k, "GNU.sparse.") {
+			return true
 		}
-		fs.files[d][f] = file
+	}
+	return false
+}
 
+func (fs *Fs) add(hdr *tar.Header, data *io.SectionReader) {
+	d, f := splitpath(hdr.Name)
+	if _, ok := fs.files[d]; !ok {
+		fs.files[d] = make(map[string]*File)
 	}
+	fs.files[d][f] = &File{h: hdr, data: data, fs: fs}
+}
 
+// addRoot adds a pseudoroot.
+func (fs *Fs) addRoot() {
 	if fs.files[afero.FilePathSeparator] == nil {
 		fs.files[afero.FilePathSeparator] = make(map[string]*File)
 	}
-	// Add a pseudoroot
 	fs.files[afero.FilePathSeparator][""] = &File{
 		h: &tar.Header{
 			Name:     afero.FilePathSeparator,
 			Typeflag: tar.TypeDir,
 			Size:     0,
 		},
-		data: bytes.NewReader(nil),
+		data: io.NewSectionReader(bytes.NewReader(nil), 0, 0),
 		fs:   fs,
 	}
+}
 
-	return fs
+// Header returns the *tar.Header of the archive entry described by fi, a
+// FileInfo of an Fs, e.g. for its owner, link target or PAX records. It is
+// what fi.Sys returns, and must not be modified.
+func Header(fi os.FileInfo) (*tar.Header, bool) {
+	h, ok := fi.Sys().(*tar.Header)
+	return h, ok
 }
 
 func (fs *Fs) Open(name string) (afero.File, error) {
@@ -92,31 +168,33 @@ func (fs *Fs) Open(name string) (afero.File, error) {
 	}
 
 	nf := *file
+	// every handle has its own offset
+	nf.data = io.NewSectionReader(file.data, 0, file.data.Size())
 
 	return &nf, nil
 }
 
 func (fs *Fs) Name() string { return "tarfs" }
 
-func (fs *Fs) Create(name string) (afero.File, error) { return nil, syscall.EROFS }
+func (fs *Fs) Create(name string) (afero.File, error) { return nil, errROFS }
 
-func (fs *Fs) Mkdir(name string, perm os.FileMode) error { return syscall.EROFS }
+func (fs *Fs) Mkdir(name string, perm os.FileMode) error { return errROFS }
 
-func (fs *Fs) MkdirAll(path string, perm os.FileMode) error { return syscall.EROFS }
+func (fs *Fs) MkdirAll(path string, perm os.FileMode) error { return errROFS }
 
 func (fs *Fs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
-	if flag != os.O_RDONLY {
+	if common.ModifiesFs(flag) {
 		return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EPERM}
 	}
 
 	return fs.Open(name)
 }
 
-func (fs *Fs) Remove(name string) error { return syscall.EROFS }
+func (fs *Fs) Remove(name string) error { return errROFS }
 
-func (fs *Fs) RemoveAll(path string) error { return syscall.EROFS }
+func (fs *Fs) RemoveAll(path string) error { return errROFS }
 
-func (fs *Fs) Rename(oldname string, newname string) error { return syscall.EROFS }
+func (fs *Fs) Rename(oldname string, newname string) error { return errROFS }
 
 func (fs *Fs) Stat(name string) (os.FileInfo, error) {
 	d, f := splitpath(name)
@@ -132,8 +210,8 @@ func (fs *Fs) Stat(name string) (os.FileInfo, error) {
 	return file.h.FileInfo(), nil
 }
 
-func (fs *Fs) Chmod(name string, mode os.FileMode) error { return syscall.EROFS }
+func (fs *Fs) Chmod(name string, mode os.FileMode) error { return errROFS }
 
-func (fs *Fs) Chown(name string, uid, gid int) error { return syscall.EROFS }
+func (fs *Fs) Chown(name string, uid, gid int) error { return errROFS }
 
-func (fs *Fs) Chtimes(name string, atime time.Time, mtime time.Time) error { return syscall.EROFS }
+func (fs *Fs) Chtimes(name string, atime time.Time, mtime time.Time) error { return errROFS }
@@ -3,6 +3,7 @@ package tarfs
 
 import (
 	"archive/tar"
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
@@ -14,6 +15,7 @@ import (
 	"testing"
 
 	"github.com/spf13/afero"
+	"github.com/spf13/afero/aferotest"
 )
 
 var files = []struct {
@@ -122,6 +124,19 @@ func TestRead(t *testing.T) {
 	}
 }
 
+func TestReadZeroLengthAtEOF(t *testing.T) {
+	file, err := afs.Open("/testFile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.Seek(0, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := file.Read(nil); n != 0 || err != nil {
+		t.Errorf("Read(0) at EOF = %d, %v, want 0, nil", n, err)
+	}
+}
+
 func TestReadAt(t *testing.T) {
 	for _, f := range files {
 		if !f.exists {
@@ -319,6 +334,11 @@ func TestReaddir(t *testing.T) {
 			t.Errorf("%v: children, got '%v', expected '%v'", d.name, names, d.children)
 		}
 
+		// a listing does not start over, read it from a new handle
+		dir, err = afs.Open(d.name)
+		if err != nil {
+			t.Fatal(err)
+		}
 		fi, err = dir.Readdir(1)
 		if err != nil {
 			t.Fatal(err)
@@ -334,6 +354,8 @@ func TestReaddir(t *testing.T) {
 		}
 	}
 
+	aferotest.CheckReaddir(t, afs, "/")
+
 	dir, err := afs.Open("/testFile")
 	if err != nil {
 		t.Fatal(err)
@@ -361,6 +383,11 @@ func TestReaddirnames(t *testing.T) {
 			t.Errorf("%v: children, got '%v', expected '%v'", d.name, names, d.children)
 		}
 
+		// a listing does not start over, read it from a new handle
+		dir, err = afs.Open(d.name)
+		if err != nil {
+			t.Fatal(err)
+		}
 		names, err = dir.Readdirnames(1)
 		if err != nil {
 			t.Fatal(err)
@@ -404,3 +431,83 @@ func TestGlob(t *testing.T) {
 		}
 	}
 }
+
+func TestNewFromReaderAt(t *testing.T) {
+	tf, err := os.Open("testdata/t.tar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tf.Close()
+	fi, err := tf.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fs, err := NewFromReaderAt(tf, fi.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		if !f.exists || f.isdir {
+			if _, err := fs.Stat(f.name); (err == nil) != f.exists {
+				t.Errorf("%v exists = %v, but got err = %v", f.name, f.exists, err)
+			}
+			continue
+		}
+		data, err := afero.ReadFile(fs, f.name)
+		if err != nil {
+			t.Fatalf("%v: %v", f.name, err)
+		}
+		if int64(len(data)) != f.size || string(data[:8]) != f.content || string(data[4092:4100]) != f.contentAt4k {
+			t.Errorf("%v: got %d bytes starting with <%s>", f.name, len(data), data[:8])
+		}
+	}
+
+	// handles of the same file do not share their offsets
+	a, _ := fs.Open("/testFile")
+	b, _ := fs.Open("/testFile")
+	a.Seek(4092, io.SeekStart)
+	buf := make([]byte, 8)
+	if _, err := b.Read(buf); err != nil || string(buf) != "aaaaaaaa" {
+		t.Errorf("Read of a second handle = <%s>, %v", buf, err)
+	}
+
+	if _, err := NewFromReaderAt(tf, fi.Size()/2); err == nil {
+		t.Error("truncated archive was accepted")
+	}
+}
+
+func TestHeader(t *testing.T) {
+	fi, err := afs.Stat("/testFile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, ok := Header(fi)
+	if !ok || h.Uname != "agimenez" || h.Mode != 0o644 || h.Size != 8192 {
+		t.Errorf("Header = %+v, %v", h, ok)
+	}
+
+	var buf bytes.Buffer
+	w := tar.NewWriter(&buf)
+	w.WriteHeader(&tar.Header{
+		Name:       "file",
+		Mode:       0o600,
+		Uid:        1000,
+		PAXRecords: map[string]string{"SCHILY.xattr.user.origin": "test"},
+		Format:     tar.FormatPAX,
+	})
+	w.Close()
+	fs := New(tar.NewReader(&buf))
+	f, err := fs.Open("/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	fi, err = f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h, ok := Header(fi); !ok || h.Uid != 1000 || h.PAXRecords["SCHILY.xattr.user.origin"] != "test" {
+		t.Errorf("Header = %+v, %v", h, ok)
+	}
+}
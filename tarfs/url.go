@@ -0,0 +1,32 @@
+package tarfs
+
+import (
+	"context"
+	"net/url"
+	"os"
+
+	"github.com/spf13/afero"
+)
+
+// The tar scheme opens the archive at a local path with afero.OpenURL, as in
+// tar:///srv/assets.tar. The archive is read with NewFromReaderAt and stays
+// open as long as the process runs.
+func init() {
+	afero.RegisterScheme("tar", func(_ context.Context, u *url.URL) (afero.Fs, error) {
+		f, err := os.Open(u.Path)
+		if err != nil {
+			return nil, err
+		}
+		fi, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		fs, err := NewFromReaderAt(f, fi.Size())
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return fs, nil
+	})
+}
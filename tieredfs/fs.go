@@ -0,0 +1,483 @@
+// Package tieredfs provides an afero.Fs which caches the files of a slow
+// remote Fs, e.g. an sftpfs or gcsfs, in several tiers of faster ones, e.g.
+// a directory on disk and memory. Stacking CacheOnReadFs values instead
+// does not compose: the outer cache cannot tell when the inner one is
+// stale, and writes are applied to every layer separately.
+package tieredfs
+
+import (
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/spf13/afero/internal/common"
+	"github.com/spf13/afero/mem"
+)
+
+// Policy selects how writes reach the remote Fs.
+type Policy int
+
+const (
+	// WriteThrough writes to the remote directly and drops the cached
+	// copies of the file, which are fetched again on the next read.
+	WriteThrough Policy = iota
+
+	// WriteBack writes to the fastest tier only. The files written are
+	// dirty until Flush copies them to the remote; they never expire.
+	WriteBack
+)
+
+type tier struct {
+	fs  afero.Fs
+	ttl time.Duration
+	// fetched holds when each file was copied to the tier or found to be
+	// still the same as in the tier below.
+	fetched map[string]time.Time
+}
+
+// Fs reads files from the fastest tier holding a valid copy, filling the
+// faster tiers on the way. A copy expires once it is older than the TTL
+// of its tier; it is then compared with the copy in the tier below by size
+// and modification time and only fetched again if they differ. Copies
+// found in a tier which were not made by this Fs, e.g. in a disk cache
+// kept from an earlier run, count as expired.
+//
+// Directories, and the metadata of files without a cached copy, come from
+// the remote. Changes to directories, Rename, Remove, Chmod, Chown and
+// Chtimes always apply to the remote right away and drop cached copies.
+type Fs struct {
+	remote afero.Fs
+	tiers  []*tier
+	policy Policy
+
+	mu    sync.Mutex
+	dirty map[string]bool
+	now   func() time.Time
+}
+
+// Option configures an Fs created by New.
+type Option func(*Fs)
+
+// WithTier adds a cache tier whose copies are valid for ttl, or until they
+// are dropped if ttl is 0. Tiers are searched in the order they are added,
+// so the fastest has to come first.
+func WithTier(fs afero.Fs, ttl time.Duration) Option {
+	return func(t *Fs) {
+		t.tiers = append(t.tiers, &tier{fs: fs, ttl: ttl, fetched: make(map[string]time.Time)})
+	}
+}
+
+// WithPolicy sets the write policy, the default is WriteThrough. Without
+// tiers, writes always go to the remote.
+func WithPolicy(p Policy) Option {
+	return func(fs *Fs) {
+		fs.policy = p
+	}
+}
+
+// WithClock makes the TTLs of the tiers count the time of c, e.g. a
+// mem.FakeClock in tests, instead of that of time.Now.
+func WithClock(c mem.Clock) Option {
+	return func(fs *Fs) {
+		fs.now = c.Now
+	}
+}
+
+func New(remote afero.Fs, opts ...Option) afero.Fs {
+	fs := &Fs{remote: remote, dirty: make(map[string]bool), now: time.Now}
+	for _, opt := range opts {
+		opt(fs)
+	}
+	return fs
+}
+
+func (fs *Fs) Name() string { return "TieredFs" }
+
+// Unwrap returns the remote Fs.
+func (fs *Fs) Unwrap() afero.Fs {
+	return fs.remote
+}
+
+func (fs *Fs) writeBack() bool {
+	return fs.policy == WriteBack && len(fs.tiers) > 0
+}
+
+// source returns the Fs below tier i.
+func (fs *Fs) source(i int) afero.Fs {
+	if i+1 < len(fs.tiers) {
+		return fs.tiers[i+1].fs
+	}
+	return fs.remote
+}
+
+// valid reports whether the copy of name in tier i can be used without
+// looking at the tiers below.
+func (fs *Fs) valid(i int, name string) bool {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if i == 0 && fs.dirty[name] {
+		return true
+	}
+	t := fs.tiers[i]
+	fetched, ok := t.fetched[name]
+	return ok && (t.ttl == 0 || fs.now().Sub(fetched) < t.ttl)
+}
+
+func (fs *Fs) touch(i int, name string) {
+	fs.mu.Lock()
+	fs.tiers[i].fetched[name] = fs.now()
+	fs.mu.Unlock()
+}
+
+// forget drops what is known of name and everything below it.
+func (fs *Fs) forget(name string) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	prefix := name + afero.PathSeparatorOf(fs)
+	match := func(n string) bool { return n == name || strings.HasPrefix(n, prefix) }
+	for _, t := range fs.tiers {
+		for n := range t.fetched {
+			if match(n) {
+				delete(t.fetched, n)
+			}
+		}
+	}
+	for n := range fs.dirty {
+		if match(n) {
+			delete(fs.dirty, n)
+		}
+	}
+}
+
+// drop removes the cached copies of name in all tiers but the first skip.
+func (fs *Fs) drop(name string, skip int) {
+	for i := skip; i < len(fs.tiers); i++ {
+		fs.tiers[i].fs.RemoveAll(name)
+	}
+	if skip == 0 {
+		fs.forget(name)
+		return
+	}
+	fs.mu.Lock()
+	for _, t := range fs.tiers[skip:] {
+		delete(t.fetched, name)
+	}
+	fs.mu.Unlock()
+}
+
+// lookup returns the level holding the valid copy of name, len(fs.tiers)
+// for the remote, and its FileInfo. With fill, the file is copied to all
+// faster tiers, so that it can be opened from the first.
+func (fs *Fs) lookup(name string, fill bool) (int, os.FileInfo, error) {
+	level := len(fs.tiers)
+	var fi os.FileInfo
+	for i, t := range fs.tiers {
+		tfi, err := t.fs.Stat(name)
+		if err == nil && !tfi.IsDir() && fs.valid(i, name) {
+			level, fi = i, tfi
+			break
+		}
+	}
+	if fi == nil {
+		var err error
+		if fi, err = fs.remote.Stat(name); err != nil {
+			return 0, nil, err
+		}
+		if fi.IsDir() {
+			return level, fi, nil
+		}
+	}
+
+	// Revalidate or fill the faster tiers, from the slowest up.
+	for i := level - 1; i >= 0; i-- {
+		tfi, err := fs.tiers[i].fs.Stat(name)
+		switch {
+		case err == nil && same(tfi, fi):
+			fs.touch(i, name)
+		case fill:
+			if err := fs.fetch(i, name); err != nil {
+				return 0, nil, err
+			}
+		default:
+			continue
+		}
+		level = i
+	}
+	return level, fi, nil
+}
+
+// same reports whether two copies of a file are considered equal.
+func same(a, b os.FileInfo) bool {
+	return a.Size() == b.Size() &&
+		a.ModTime().Truncate(time.Second).Equal(b.ModTime().Truncate(time.Second))
+}
+
+// fetch copies name from the Fs below tier i into it.
+func (fs *Fs) fetch(i int, name string) error {
+	t := fs.tiers[i]
+	if err := t.fs.MkdirAll(afero.Dir(fs, name), 0o777); err != nil {
+		return err
+	}
+	if err := afero.CopyFile(t.fs, name, fs.source(i), name); err != nil {
+		t.fs.Remove(name)
+		return err
+	}
+	fs.touch(i, name)
+	return nil
+}
+
+// Prefetch copies the files to all tiers ahead of their use, recursively
+// for directories.
+func (fs *Fs) Prefetch(names ...string) error {
+	for _, name := range names {
+		err := afero.Walk(fs.remote, name, func(path string, info os.FileInfo, err error) error {
+			if err != nil || !info.Mode().IsRegular() {
+				return err
+			}
+			_, _, err = fs.lookup(path, true)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush copies the files written with the WriteBack policy to the remote,
+// in the order of their names. It stops at the first error; the files not
+// copied yet stay dirty.
+func (fs *Fs) Flush() error {
+	fs.mu.Lock()
+	names := make([]string, 0, len(fs.dirty))
+	for name := range fs.dirty {
+		names = append(names, name)
+	}
+	fs.mu.Unlock()
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := fs.flush(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (fs *Fs) flush(name string) error {
+	if err := fs.remote.MkdirAll(afero.Dir(fs, name), 0o777); err != nil {
+		return err
+	}
+	if err := afero.CopyFile(fs.remote, name, fs.tiers[0].fs, name); err != nil {
+		return err
+	}
+	fs.mu.Lock()
+	delete(fs.dirty, name)
+	fs.tiers[0].fetched[name] = fs.now()
+	fs.mu.Unlock()
+	return nil
+}
+
+// flushBelow flushes the dirty files at or below name.
+func (fs *Fs) flushBelow(name string) error {
+	fs.mu.Lock()
+	var names []string
+	prefix := name + afero.PathSeparatorOf(fs)
+	for n := range fs.dirty {
+		if n == name || strings.HasPrefix(n, prefix) {
+			names = append(names, n)
+		}
+	}
+	fs.mu.Unlock()
+	sort.Strings(names)
+	for _, n := range names {
+		if err := fs.flush(n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (fs *Fs) isDirty(name string) bool {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.dirty[name]
+}
+
+func (fs *Fs) Create(name string) (afero.File, error) {
+	return fs.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o666)
+}
+
+func (fs *Fs) Open(name string) (afero.File, error) {
+	return fs.OpenFile(name, os.O_RDONLY, 0)
+}
+
+// OpenFile opens files for reading from the first tier. Files opened for
+// writing are opened in the remote with WriteThrough, in the first tier
+// with WriteBack.
+func (fs *Fs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	name = afero.Clean(fs, name)
+	if common.ModifiesFs(flag) {
+		if fs.writeBack() {
+			return fs.openBack(name, flag, perm)
+		}
+		f, err := fs.remote.OpenFile(name, flag, perm)
+		if err != nil {
+			return nil, err
+		}
+		fs.drop(name, 0)
+		return &writeThroughFile{File: f, fs: fs, name: name}, nil
+	}
+
+	level, fi, err := fs.lookup(name, true)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		return fs.openDir(name, flag, perm)
+	}
+	if level == len(fs.tiers) {
+		return fs.remote.OpenFile(name, flag, perm)
+	}
+	return fs.tiers[0].fs.OpenFile(name, flag, perm)
+}
+
+// openDir opens a directory of the remote. With WriteBack, the entries of
+// the first tier are merged in, which include the files not flushed yet.
+func (fs *Fs) openDir(name string, flag int, perm os.FileMode) (afero.File, error) {
+	rf, err := fs.remote.OpenFile(name, flag, perm)
+	if err != nil || !fs.writeBack() {
+		return rf, err
+	}
+	lf, err := fs.tiers[0].fs.Open(name)
+	if err != nil {
+		return rf, nil
+	}
+	return &afero.UnionFile{Base: rf, Layer: lf}, nil
+}
+
+// openBack opens name for writing in the first tier, fetching its content
+// first unless it is truncated.
+func (fs *Fs) openBack(name string, flag int, perm os.FileMode) (afero.File, error) {
+	_, fi, err := fs.lookup(name, flag&os.O_TRUNC == 0)
+	switch {
+	case err == nil && fi.IsDir():
+		return fs.remote.OpenFile(name, flag, perm)
+	case err == nil && flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL:
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrExist}
+	case os.IsNotExist(err) && flag&os.O_CREATE != 0:
+		if dfi, err := fs.remote.Stat(afero.Dir(fs, name)); err != nil {
+			return nil, err
+		} else if !dfi.IsDir() {
+			return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+		}
+	case err != nil:
+		return nil, err
+	}
+
+	first := fs.tiers[0].fs
+	if err := first.MkdirAll(afero.Dir(fs, name), 0o777); err != nil {
+		return nil, err
+	}
+	f, err := first.OpenFile(name, flag&^os.O_EXCL, perm)
+	if err != nil {
+		return nil, err
+	}
+	fs.mu.Lock()
+	fs.dirty[name] = true
+	fs.mu.Unlock()
+	fs.drop(name, 1)
+	return f, nil
+}
+
+func (fs *Fs) Mkdir(name string, perm os.FileMode) error {
+	return fs.remote.Mkdir(name, perm)
+}
+
+func (fs *Fs) MkdirAll(path string, perm os.FileMode) error {
+	return fs.remote.MkdirAll(path, perm)
+}
+
+func (fs *Fs) Remove(name string) error {
+	name = afero.Clean(fs, name)
+	err := fs.remote.Remove(name)
+	if err != nil && !(os.IsNotExist(err) && fs.isDirty(name)) {
+		return err
+	}
+	fs.drop(name, 0)
+	return nil
+}
+
+func (fs *Fs) RemoveAll(path string) error {
+	path = afero.Clean(fs, path)
+	if err := fs.remote.RemoveAll(path); err != nil {
+		return err
+	}
+	fs.drop(path, 0)
+	return nil
+}
+
+// Rename flushes the dirty files at or below oldname and renames it in the
+// remote.
+func (fs *Fs) Rename(oldname, newname string) error {
+	oldname, newname = afero.Clean(fs, oldname), afero.Clean(fs, newname)
+	if err := fs.flushBelow(oldname); err != nil {
+		return err
+	}
+	if err := fs.remote.Rename(oldname, newname); err != nil {
+		return err
+	}
+	fs.drop(oldname, 0)
+	fs.drop(newname, 0)
+	return nil
+}
+
+// Stat returns the FileInfo of the valid copy of a file with the fastest
+// tier, without copying it.
+func (fs *Fs) Stat(name string) (os.FileInfo, error) {
+	_, fi, err := fs.lookup(afero.Clean(fs, name), false)
+	return fi, err
+}
+
+// change applies a metadata change to a dirty file in the first tier, to
+// others in the remote, dropping their copies.
+func (fs *Fs) change(name string, fn func(afero.Fs, string) error) error {
+	name = afero.Clean(fs, name)
+	if fs.isDirty(name) {
+		return fn(fs.tiers[0].fs, name)
+	}
+	if err := fn(fs.remote, name); err != nil {
+		return err
+	}
+	fs.drop(name, 0)
+	return nil
+}
+
+func (fs *Fs) Chmod(name string, mode os.FileMode) error {
+	return fs.change(name, func(f afero.Fs, n string) error { return f.Chmod(n, mode) })
+}
+
+func (fs *Fs) Chown(name string, uid, gid int) error {
+	return fs.change(name, func(f afero.Fs, n string) error { return f.Chown(n, uid, gid) })
+}
+
+func (fs *Fs) Chtimes(name string, atime, mtime time.Time) error {
+	return fs.change(name, func(f afero.Fs, n string) error { return f.Chtimes(n, atime, mtime) })
+}
+
+// writeThroughFile drops the copies cached while it was open when it is
+// closed.
+type writeThroughFile struct {
+	afero.File
+	fs   *Fs
+	name string
+}
+
+func (f *writeThroughFile) Close() error {
+	err := f.File.Close()
+	f.fs.drop(f.name, 0)
+	return err
+}
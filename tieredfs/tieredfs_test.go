@@ -0,0 +1,195 @@
+package tieredfs
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/spf13/afero/aferotest"
+	"github.com/spf13/afero/mem"
+)
+
+type tiers struct {
+	remote, disk, mem afero.Fs
+	fs                *Fs
+	clock             *mem.FakeClock
+}
+
+func newTiers(t *testing.T, opts ...Option) *tiers {
+	t.Helper()
+	ts := &tiers{remote: afero.NewMemMapFs(), disk: afero.NewMemMapFs(), mem: afero.NewMemMapFs()}
+	ts.clock = mem.NewFakeClock(time.Now())
+	opts = append([]Option{WithTier(ts.mem, time.Minute), WithTier(ts.disk, time.Hour), WithClock(ts.clock)}, opts...)
+	ts.fs = New(ts.remote, opts...).(*Fs)
+	return ts
+}
+
+func (ts *tiers) writeRemote(t *testing.T, name, content string, mtime time.Time) {
+	t.Helper()
+	if err := afero.WriteFile(ts.remote, name, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.remote.Chtimes(name, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func read(t *testing.T, fs afero.Fs, name string) string {
+	t.Helper()
+	b, err := afero.ReadFile(fs, name)
+	if err != nil {
+		return "error: " + err.Error()
+	}
+	return string(b)
+}
+
+func TestReadThrough(t *testing.T) {
+	ts := newTiers(t)
+	old := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	ts.writeRemote(t, "/dir/file", "v1", old)
+
+	if got := read(t, ts.fs, "/dir/file"); got != "v1" {
+		t.Fatalf("read = %q", got)
+	}
+	for _, tier := range []afero.Fs{ts.disk, ts.mem} {
+		if got := read(t, tier, "/dir/file"); got != "v1" {
+			t.Errorf("cached copy = %q", got)
+		}
+	}
+	if fi, err := ts.fs.Stat("/dir/file"); err != nil || !fi.ModTime().Equal(old) {
+		t.Errorf("Stat = %v, %v, want the modification time of the remote", fi, err)
+	}
+
+	ts.writeRemote(t, "/dir/file", "v2", old.Add(time.Hour))
+	if got := read(t, ts.fs, "/dir/file"); got != "v1" {
+		t.Errorf("read before any TTL = %q, want the cached v1", got)
+	}
+	// The memory copy expired, but the disk copy is still valid.
+	ts.clock.Advance(2 * time.Minute)
+	if got := read(t, ts.fs, "/dir/file"); got != "v1" {
+		t.Errorf("read after the memory TTL = %q, want v1 from disk", got)
+	}
+	ts.clock.Advance(2 * time.Hour)
+	if got := read(t, ts.fs, "/dir/file"); got != "v2" {
+		t.Errorf("read after the disk TTL = %q, want v2", got)
+	}
+	if got := read(t, ts.mem, "/dir/file"); got != "v2" {
+		t.Errorf("memory copy = %q, want it refreshed", got)
+	}
+}
+
+func TestRevalidate(t *testing.T) {
+	ts := newTiers(t)
+	mtime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	ts.writeRemote(t, "/file", "data", mtime)
+	read(t, ts.fs, "/file")
+
+	// An expired copy which matches the tier below is kept, not fetched again.
+	afero.WriteFile(ts.mem, "/file", []byte("DATA"), 0o644)
+	ts.mem.Chtimes("/file", mtime, mtime)
+	ts.clock.Advance(2 * time.Minute)
+	if got := read(t, ts.fs, "/file"); got != "DATA" {
+		t.Errorf("read = %q, want the revalidated copy", got)
+	}
+
+	// Copies the Fs did not make are revalidated too.
+	afero.WriteFile(ts.disk, "/other", []byte("stale"), 0o644)
+	ts.writeRemote(t, "/other", "fresh", mtime)
+	if got := read(t, ts.fs, "/other"); got != "fresh" {
+		t.Errorf("read = %q, want the remote content", got)
+	}
+}
+
+func TestWriteThrough(t *testing.T) {
+	ts := newTiers(t)
+	ts.writeRemote(t, "/file", "v1", time.Now())
+	read(t, ts.fs, "/file")
+
+	if err := afero.WriteFile(ts.fs, "/file", []byte("v2"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := read(t, ts.remote, "/file"); got != "v2" {
+		t.Errorf("remote = %q", got)
+	}
+	if _, err := ts.mem.Stat("/file"); !os.IsNotExist(err) {
+		t.Errorf("the cached copy was not dropped: %v", err)
+	}
+	if got := read(t, ts.fs, "/file"); got != "v2" {
+		t.Errorf("read = %q", got)
+	}
+
+	if err := ts.fs.Remove("/file"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ts.fs.Stat("/file"); !os.IsNotExist(err) {
+		t.Errorf("Stat after Remove = %v", err)
+	}
+	if _, err := ts.disk.Stat("/file"); !os.IsNotExist(err) {
+		t.Errorf("disk copy after Remove = %v", err)
+	}
+}
+
+func TestWriteBack(t *testing.T) {
+	ts := newTiers(t, WithPolicy(WriteBack))
+	ts.remote.MkdirAll("/logs", 0o755)
+	ts.writeRemote(t, "/logs/old", "old", time.Now())
+
+	if err := afero.WriteFile(ts.fs, "/logs/new", []byte("new"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ts.remote.Stat("/logs/new"); !os.IsNotExist(err) {
+		t.Errorf("the remote was written before Flush: %v", err)
+	}
+	// dirty files never expire
+	ts.clock.Advance(24 * time.Hour)
+	if got := read(t, ts.fs, "/logs/new"); got != "new" {
+		t.Errorf("read = %q", got)
+	}
+	fis, err := afero.ReadDir(ts.fs, "/logs")
+	if err != nil || len(fis) != 2 {
+		t.Errorf("ReadDir = %d entries, %v, want old and new", len(fis), err)
+	}
+
+	if err := ts.fs.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got := read(t, ts.remote, "/logs/new"); got != "new" {
+		t.Errorf("remote after Flush = %q", got)
+	}
+
+	// Rename flushes first.
+	afero.WriteFile(ts.fs, "/logs/new", []byte("changed"), 0o644)
+	if err := ts.fs.Rename("/logs/new", "/logs/renamed"); err != nil {
+		t.Fatal(err)
+	}
+	if got := read(t, ts.remote, "/logs/renamed"); got != "changed" {
+		t.Errorf("remote after Rename = %q", got)
+	}
+	if _, err := ts.fs.OpenFile("/missing/file", os.O_CREATE|os.O_WRONLY, 0o644); !os.IsNotExist(err) {
+		t.Errorf("creating a file in a missing directory = %v", err)
+	}
+}
+
+func TestPrefetch(t *testing.T) {
+	ts := newTiers(t)
+	ts.writeRemote(t, "/site/index.html", "index", time.Now())
+	ts.writeRemote(t, "/site/css/main.css", "css", time.Now())
+	if err := ts.fs.Prefetch("/site"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"/site/index.html", "/site/css/main.css"} {
+		for _, tier := range []afero.Fs{ts.disk, ts.mem} {
+			if _, err := tier.Stat(name); err != nil {
+				t.Errorf("%s not prefetched: %v", name, err)
+			}
+		}
+	}
+}
+
+func TestConformance(t *testing.T) {
+	newFs := func(t *testing.T) afero.Fs {
+		return New(afero.NewMemMapFs(), WithTier(afero.NewMemMapFs(), time.Minute))
+	}
+	aferotest.Conformance(t, newFs, afero.Capabilities(newFs(t)))
+}
@@ -0,0 +1,207 @@
+package afero
+
+import (
+	"errors"
+	"os"
+	"sort"
+	"strings"
+)
+
+// The TxFs buffers all changes to a base Fs in a CopyOnWriteFs with an in
+// memory layer until Commit applies them, or Rollback drops them. Reads see
+// the buffered changes.
+//
+// Commit first saves everything it is going to overwrite or remove in the
+// base to a journal. If applying the changes fails, the journal is restored,
+// so the base ends up with either all changes or none of them.
+//
+// A TxFs is not safe for use while Commit or Rollback run.
+type TxFs struct {
+	*CopyOnWriteFs
+	base Fs
+}
+
+func NewTxFs(base Fs) *TxFs {
+	return &TxFs{CopyOnWriteFs: &CopyOnWriteFs{base: base, layer: &MemMapFs{}}, base: base}
+}
+
+func (t *TxFs) Name() string {
+	return "TxFs"
+}
+
+// Rename moves files and directories of the base by copying them to the
+// layer first, which a CopyOnWriteFs refuses to do.
+func (t *TxFs) Rename(oldname, newname string) error {
+	if t.inBase(oldname) {
+		if err := t.copyUp(oldname); err != nil {
+			return withOp("rename", err)
+		}
+	}
+	return t.CopyOnWriteFs.Rename(oldname, newname)
+}
+
+// copyUp copies name, and everything below it, from the base to the layer
+// unless it is there already.
+func (t *TxFs) copyUp(name string) error {
+	return Walk(t.CopyOnWriteFs, name, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if _, err := lstatIfPossible(t.layer, path); err == nil {
+			return nil
+		}
+		if fi.IsDir() {
+			if err := t.layer.MkdirAll(path, fi.Mode().Perm()); err != nil {
+				return err
+			}
+			return t.layer.Chtimes(path, fi.ModTime(), fi.ModTime())
+		}
+		return copyEntry(t.layer, t.base, path, fi)
+	})
+}
+
+// Commit applies the buffered changes to the base and clears them.
+func (t *TxFs) Commit() error {
+	c, err := t.Changes()
+	if err != nil {
+		return err
+	}
+	j := &txJournal{base: t.base, backup: &MemMapFs{}}
+	for _, name := range topmost(c.Deleted, c.Added, c.Modified) {
+		if err := j.save(name); err != nil {
+			return err
+		}
+	}
+	if err := t.Materialize(t.base); err != nil {
+		if rerr := j.restore(); rerr != nil {
+			return errors.Join(err, rerr)
+		}
+		return err
+	}
+	t.Rollback()
+	return nil
+}
+
+// Rollback drops the buffered changes.
+func (t *TxFs) Rollback() {
+	t.CopyOnWriteFs = &CopyOnWriteFs{base: t.base, layer: &MemMapFs{}}
+}
+
+// topmost returns the names of all lists, sorted, leaving out those below
+// another one.
+func topmost(lists ...[]string) []string {
+	var names []string
+	for _, l := range lists {
+		names = append(names, l...)
+	}
+	sort.Strings(names)
+	var res []string
+	for _, name := range names {
+		if n := len(res); n > 0 {
+			last := res[n-1]
+			if name == last || strings.HasPrefix(name, strings.TrimSuffix(last, FilePathSeparator)+FilePathSeparator) {
+				continue
+			}
+		}
+		res = append(res, name)
+	}
+	return res
+}
+
+// txJournal records the state of the base before a commit.
+type txJournal struct {
+	base, backup Fs
+	saved        []txSaved
+}
+
+type txSaved struct {
+	name    string
+	existed bool
+}
+
+// save copies name and everything below it from the base to the backup.
+func (j *txJournal) save(name string) error {
+	_, err := lstatIfPossible(j.base, name)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	j.saved = append(j.saved, txSaved{name: name, existed: err == nil})
+	if err != nil {
+		return nil
+	}
+	return copyTree(j.backup, j.base, name)
+}
+
+// restore puts back the saved state of the base.
+func (j *txJournal) restore() error {
+	var errs []error
+	for i := len(j.saved) - 1; i >= 0; i-- {
+		s := j.saved[i]
+		if err := j.base.RemoveAll(s.name); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if s.existed {
+			if err := copyTree(j.base, j.backup, s.name); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// copyTree copies root and everything below it from src to dst, keeping
+// modes and modification times.
+func copyTree(dst, src Fs, root string) error {
+	var dirs []string
+	var infos []os.FileInfo
+	err := Walk(src, root, func(name string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			return copyEntry(dst, src, name, fi)
+		}
+		if err := dst.MkdirAll(name, fi.Mode().Perm()); err != nil {
+			return err
+		}
+		dirs, infos = append(dirs, name), append(infos, fi)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// The times of directories change while they are filled.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := dst.Chmod(dirs[i], infos[i].Mode().Perm()); err != nil {
+			return err
+		}
+		if err := dst.Chtimes(dirs[i], infos[i].ModTime(), infos[i].ModTime()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyEntry copies the file or symlink name from src to dst.
+func copyEntry(dst, src Fs, name string, fi os.FileInfo) error {
+	if err := dst.MkdirAll(Dir(src, name), 0o777); err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeSymlink != 0 {
+		lr, ok := src.(LinkReader)
+		if !ok {
+			return &os.PathError{Op: "readlink", Path: name, Err: ErrNoReadlink}
+		}
+		target, err := lr.ReadlinkIfPossible(name)
+		if err != nil {
+			return err
+		}
+		l, ok := dst.(Linker)
+		if !ok {
+			return &os.LinkError{Op: "symlink", Old: target, New: name, Err: ErrNoSymlink}
+		}
+		return l.SymlinkIfPossible(target, name)
+	}
+	return copyFileTo(dst, name, src, name, &copyOptions{strictMetadata: true})
+}
@@ -0,0 +1,136 @@
+package afero
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"sort"
+	"syscall"
+	"testing"
+)
+
+func txTree(t *testing.T, fs Fs) map[string]string {
+	t.Helper()
+	tree := make(map[string]string)
+	err := Walk(fs, "/", func(name string, fi os.FileInfo, err error) error {
+		if err != nil || fi.IsDir() {
+			return err
+		}
+		data, err := ReadFile(fs, name)
+		tree[name] = string(data)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
+
+func TestTxFsCommitAndRollback(t *testing.T) {
+	base := NewMemMapFs()
+	WriteFile(base, "/etc/app.conf", []byte("old"), 0o644)
+	WriteFile(base, "/etc/old.conf", []byte("x"), 0o644)
+	WriteFile(base, "/etc/conf.d/a", []byte("a"), 0o644)
+	before := txTree(t, base)
+
+	tx := NewTxFs(base)
+	change := func() {
+		t.Helper()
+		if err := WriteFile(tx, "/etc/app.conf", []byte("new"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.Remove("/etc/old.conf"); err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.Rename("/etc/conf.d", "/etc/conf.new"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	change()
+	want := map[string]string{"/etc/app.conf": "new", "/etc/conf.new/a": "a"}
+	if got := txTree(t, tx); !reflect.DeepEqual(got, want) {
+		t.Errorf("view = %v, want %v", got, want)
+	}
+	if got := txTree(t, base); !reflect.DeepEqual(got, before) {
+		t.Errorf("base changed before Commit: %v", got)
+	}
+
+	tx.Rollback()
+	if got := txTree(t, tx); !reflect.DeepEqual(got, before) {
+		t.Errorf("view after Rollback = %v, want %v", got, before)
+	}
+
+	change()
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if got := txTree(t, base); !reflect.DeepEqual(got, want) {
+		t.Errorf("base after Commit = %v, want %v", got, want)
+	}
+	if c, _ := tx.Changes(); len(c.Added)+len(c.Modified)+len(c.Deleted) != 0 {
+		t.Errorf("changes left after Commit: %+v", c)
+	}
+}
+
+// failingFs fails to create files whose name is fail.
+type failingFs struct {
+	Fs
+	fail string
+}
+
+func (f *failingFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	if name == f.fail && flag&os.O_CREATE != 0 {
+		return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EIO}
+	}
+	return f.Fs.OpenFile(name, flag, perm)
+}
+
+func (f *failingFs) Create(name string) (File, error) {
+	return f.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o666)
+}
+
+func TestTxFsCommitIsAtomic(t *testing.T) {
+	mem := NewMemMapFs()
+	WriteFile(mem, "/a", []byte("a"), 0o644)
+	WriteFile(mem, "/dir/b", []byte("b"), 0o644)
+	base := &failingFs{Fs: mem, fail: "/z"}
+	before := txTree(t, mem)
+
+	tx := NewTxFs(base)
+	WriteFile(tx, "/a", []byte("changed"), 0o644)
+	tx.RemoveAll("/dir")
+	tx.MkdirAll("/new", 0o755)
+	WriteFile(tx, "/new/c", []byte("c"), 0o644)
+	WriteFile(tx, "/z", []byte("fails"), 0o644)
+
+	err := tx.Commit()
+	if !errors.Is(err, syscall.EIO) {
+		t.Fatalf("Commit = %v, want EIO", err)
+	}
+	if got := txTree(t, mem); !reflect.DeepEqual(got, before) {
+		t.Errorf("base after failed Commit = %v, want %v", got, before)
+	}
+	var names []string
+	for name := range txTree(t, tx) {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if want := []string{"/a", "/new/c", "/z"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("changes after failed Commit = %v, want %v", names, want)
+	}
+}
+
+func TestTxFsMkdirExisting(t *testing.T) {
+	base := NewMemMapFs()
+	base.Mkdir("/base", 0o755)
+	WriteFile(base, "/file", nil, 0o644)
+	tx := NewTxFs(base)
+	if err := tx.Mkdir("/new", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"/base", "/file", "/new"} {
+		if err := tx.Mkdir(name, 0o755); !errors.Is(err, os.ErrExist) {
+			t.Errorf("Mkdir(%q) = %v, want ErrExist", name, err)
+		}
+	}
+}
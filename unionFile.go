@@ -3,7 +3,7 @@ package afero
 import (
 	"io"
 	"os"
-	"path/filepath"
+	"sort"
 	"syscall"
 )
 
@@ -13,8 +13,9 @@ import (
 //
 // The calls to
 // Readdir() and Readdirnames() merge the file os.FileInfo / names from the
-// base and the overlay - for files present in both layers, only those
-// from the overlay will be used.
+// base and the overlay with the Merger. By default, for files present in
+// both layers, only those from the overlay will be used, and the entries
+// are sorted by name.
 //
 // When opening files for writing (Create() / OpenFile() with the right flags)
 // the operations will be done in both layers, starting with the overlay. A
@@ -26,6 +27,7 @@ type UnionFile struct {
 	Merger DirsMerger
 	off    int
 	files  []os.FileInfo
+	merged bool
 }
 
 func (f *UnionFile) Close() error {
@@ -65,7 +67,9 @@ func (f *UnionFile) ReadAt(s []byte, o int64) (int, error) {
 	if f.Layer != nil {
 		n, err := f.Layer.ReadAt(s, o)
 		if (err == nil || err == io.EOF) && f.Base != nil {
-			_, err = f.Base.Seek(o+int64(n), io.SeekStart)
+			if _, serr := f.Base.Seek(o+int64(n), io.SeekStart); serr != nil {
+				err = serr
+			}
 		}
 		return n, err
 	}
@@ -117,6 +121,35 @@ func (f *UnionFile) WriteAt(s []byte, o int64) (n int, err error) {
 	return 0, BADFD
 }
 
+// ReadFrom writes to both layers in the same way as Write; the fast path of
+// the underlying file is only used if there is a single layer.
+func (f *UnionFile) ReadFrom(r io.Reader) (int64, error) {
+	if f.Layer != nil && f.Base != nil {
+		return io.Copy(writerOnly{f}, r)
+	}
+	if f.Layer != nil {
+		return readFrom(f.Layer, r)
+	}
+	if f.Base != nil {
+		return readFrom(f.Base, r)
+	}
+	return 0, BADFD
+}
+
+func (f *UnionFile) WriteTo(w io.Writer) (int64, error) {
+	if f.Layer != nil {
+		n, err := writeTo(f.Layer, w)
+		if err == nil && f.Base != nil {
+			_, err = f.Base.Seek(n, io.SeekCurrent)
+		}
+		return n, err
+	}
+	if f.Base != nil {
+		return writeTo(f.Base, w)
+	}
+	return 0, BADFD
+}
+
 func (f *UnionFile) Name() string {
 	if f.Layer != nil {
 		return f.Layer.Name()
@@ -129,40 +162,67 @@ func (f *UnionFile) Name() string {
 // single view.
 type DirsMerger func(lofi, bofi []os.FileInfo) ([]os.FileInfo, error)
 
-var defaultUnionMergeDirsFn = func(lofi, bofi []os.FileInfo) ([]os.FileInfo, error) {
-	files := make(map[string]os.FileInfo)
-
-	for _, fi := range lofi {
-		files[fi.Name()] = fi
-	}
+// MergeOptions configure the DirsMerger returned by NewDirsMerger. The zero
+// value lists every name once, taking the entry of the overlay for names in
+// both layers, sorted by name.
+type MergeOptions struct {
+	// BaseFirst makes the entries of the base take precedence over those
+	// of the overlay.
+	BaseFirst bool
+	// KeepDuplicates lists names present in both layers twice, first the
+	// entry of the layer taking precedence.
+	KeepDuplicates bool
+	// Unsorted lists the entries of the layer taking precedence first, in
+	// the order the layers returned them, instead of sorting them by name.
+	Unsorted bool
+	// Whiteouts hides the whiteouts of a CopyOnWriteFs in the overlay, and
+	// the entries of the base they mark as removed.
+	Whiteouts bool
+}
 
-	for _, fi := range bofi {
-		if _, exists := files[fi.Name()]; !exists {
-			files[fi.Name()] = fi
+// NewDirsMerger returns a DirsMerger merging directories as set by opts.
+func NewDirsMerger(opts MergeOptions) DirsMerger {
+	return func(lofi, bofi []os.FileInfo) ([]os.FileInfo, error) {
+		if opts.Whiteouts {
+			lofi, bofi = hideWhiteouts(lofi, bofi)
+		}
+		first, second := lofi, bofi
+		if opts.BaseFirst {
+			first, second = bofi, lofi
 		}
-	}
 
-	rfi := make([]os.FileInfo, len(files))
+		rfi := make([]os.FileInfo, 0, len(first)+len(second))
+		seen := make(map[string]bool, len(first))
+		for _, fi := range first {
+			seen[fi.Name()] = true
+			rfi = append(rfi, fi)
+		}
+		for _, fi := range second {
+			if opts.KeepDuplicates || !seen[fi.Name()] {
+				rfi = append(rfi, fi)
+			}
+		}
 
-	i := 0
-	for _, fi := range files {
-		rfi[i] = fi
-		i++
+		if !opts.Unsorted {
+			sort.SliceStable(rfi, func(i, j int) bool { return rfi[i].Name() < rfi[j].Name() })
+		}
+		return rfi, nil
 	}
-
-	return rfi, nil
 }
 
+var defaultUnionMergeDirsFn = NewDirsMerger(MergeOptions{})
+
 // Readdir will weave the two directories together and
-// return a single view of the overlayed directories.
-// At the end of the directory view, the error is io.EOF if c > 0.
+// return a single view of the overlayed directories. Like os.File.Readdir,
+// it returns at most c entries and io.EOF at the end of the directory if
+// c > 0, and all remaining entries otherwise.
 func (f *UnionFile) Readdir(c int) (ofi []os.FileInfo, err error) {
 	var merge DirsMerger = f.Merger
 	if merge == nil {
 		merge = defaultUnionMergeDirsFn
 	}
 
-	if f.off == 0 {
+	if !f.merged {
 		var lfi []os.FileInfo
 		if f.Layer != nil {
 			lfi, err = f.Layer.Readdir(-1)
@@ -183,11 +243,12 @@ func (f *UnionFile) Readdir(c int) (ofi []os.FileInfo, err error) {
 		if err != nil {
 			return nil, err
 		}
-		f.files = append(f.files, merged...)
+		f.files, f.merged = merged, true
 	}
 	files := f.files[f.off:]
 
 	if c <= 0 {
+		f.off = len(f.files)
 		return files, nil
 	}
 
@@ -269,12 +330,12 @@ func (f *UnionFile) WriteString(s string) (n int, err error) {
 
 func copyFile(base Fs, layer Fs, name string, bfh File) error {
 	// First make sure the directory exists
-	exists, err := Exists(layer, filepath.Dir(name))
+	exists, err := Exists(layer, Dir(base, name))
 	if err != nil {
 		return err
 	}
 	if !exists {
-		err = layer.MkdirAll(filepath.Dir(name), 0o777) // FIXME?
+		err = layer.MkdirAll(Dir(base, name), 0o777) // FIXME?
 		if err != nil {
 			return err
 		}
@@ -319,8 +380,14 @@ func copyToLayer(base Fs, layer Fs, name string) error {
 	return copyFile(base, layer, name, bfh)
 }
 
-func copyFileToLayer(base Fs, layer Fs, name string, flag int, perm os.FileMode) error {
-	bfh, err := base.OpenFile(name, flag, perm)
+// copyFileToLayer copies name from base to layer before the caller opens it
+// with flag. The base file is only read here, a file missing in base which
+// flag creates only gets its directory in layer.
+func copyFileToLayer(base Fs, layer Fs, name string, flag int) error {
+	bfh, err := base.Open(name)
+	if os.IsNotExist(err) && flag&os.O_CREATE != 0 {
+		return layer.MkdirAll(Dir(base, name), 0o777)
+	}
 	if err != nil {
 		return err
 	}
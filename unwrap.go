@@ -0,0 +1,84 @@
+package afero
+
+import "reflect"
+
+// WrappingFs is implemented by filesystems built on top of another one,
+// like BasePathFs or CopyOnWriteFs. Filesystems with more than one inner
+// Fs return the one they were created for, e.g. the base of a
+// CopyOnWriteFs.
+type WrappingFs interface {
+	Fs
+
+	// Unwrap returns the wrapped Fs.
+	Unwrap() Fs
+}
+
+// UnwrapAll unwraps fs until it reaches an Fs which does not wrap another
+// one, and returns it.
+func UnwrapAll(fs Fs) Fs {
+	for {
+		w, ok := fs.(WrappingFs)
+		if !ok {
+			return fs
+		}
+		inner := w.Unwrap()
+		if inner == nil {
+			return fs
+		}
+		fs = inner
+	}
+}
+
+var (
+	_ WrappingFs = (*BasePathFs)(nil)
+	_ WrappingFs = (*ReadOnlyFs)(nil)
+	_ WrappingFs = (*RegexpFs)(nil)
+	_ WrappingFs = (*FilterFs)(nil)
+	_ WrappingFs = (*ChecksumFs)(nil)
+	_ WrappingFs = (*CopyOnWriteFs)(nil)
+	_ WrappingFs = (*TxFs)(nil)
+	_ WrappingFs = (*CacheOnReadFs)(nil)
+	_ WrappingFs = (*AtomicSwappableFs)(nil)
+	_ WrappingFs = (*ScannerFs)(nil)
+	_ WrappingFs = (*PolicyFs)(nil)
+	_ WrappingFs = (*InstrumentedFs)(nil)
+)
+
+var fsType = reflect.TypeOf((*Fs)(nil)).Elem()
+
+// As finds the first Fs in the chain of fs and the filesystems it wraps
+// which is assignable to the value pointed to by target, and if one is
+// found, sets target to it and returns true. Like errors.As, it panics if
+// target is not a non-nil pointer to a type implementing Fs or to an
+// interface type.
+//
+//	var base *afero.BasePathFs
+//	if afero.As(fs, &base) {
+//		// fs is or wraps a BasePathFs
+//	}
+func As(fs Fs, target any) bool {
+	if target == nil {
+		panic("afero: target cannot be nil")
+	}
+	val := reflect.ValueOf(target)
+	typ := val.Type()
+	if typ.Kind() != reflect.Ptr || val.IsNil() {
+		panic("afero: target must be a non-nil pointer")
+	}
+	targetType := typ.Elem()
+	if targetType.Kind() != reflect.Interface && !targetType.Implements(fsType) {
+		panic("afero: *target must be interface or implement Fs")
+	}
+	for fs != nil {
+		if reflect.TypeOf(fs).AssignableTo(targetType) {
+			val.Elem().Set(reflect.ValueOf(fs))
+			return true
+		}
+		w, ok := fs.(WrappingFs)
+		if !ok {
+			return false
+		}
+		fs = w.Unwrap()
+	}
+	return false
+}
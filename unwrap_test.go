@@ -0,0 +1,70 @@
+package afero
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestUnwrap(t *testing.T) {
+	mem := &MemMapFs{}
+	for _, fs := range []Fs{
+		NewBasePathFs(mem, "/base"),
+		NewReadOnlyFs(mem),
+		NewRegexpFs(mem, regexp.MustCompile(`.`)),
+		NewCacheOnReadFs(mem, &MemMapFs{}, 0),
+		NewScannerFs(mem, nil),
+		NewAtomicSwappableFs(mem),
+	} {
+		if got := fs.(WrappingFs).Unwrap(); got != mem {
+			t.Errorf("%s: Unwrap = %v, want the wrapped MemMapFs", fs.Name(), got)
+		}
+	}
+	cow := NewCopyOnWriteFs(NewReadOnlyFs(mem), &MemMapFs{})
+	if got := cow.(WrappingFs).Unwrap().(WrappingFs).Unwrap(); got != mem {
+		t.Errorf("CopyOnWriteFs does not unwrap to its base: %v", got)
+	}
+}
+
+func TestUnwrapAll(t *testing.T) {
+	mem := &MemMapFs{}
+	fs := NewReadOnlyFs(NewBasePathFs(NewScannerFs(mem, nil), "/base"))
+	if got := UnwrapAll(fs); got != mem {
+		t.Errorf("UnwrapAll = %v, want the innermost MemMapFs", got)
+	}
+	if got := UnwrapAll(mem); got != mem {
+		t.Errorf("UnwrapAll of an Fs wrapping nothing = %v", got)
+	}
+}
+
+func TestAs(t *testing.T) {
+	mem := &MemMapFs{}
+	fs := NewReadOnlyFs(NewBasePathFs(mem, "/base"))
+
+	var bp *BasePathFs
+	if !As(fs, &bp) || bp.source != mem {
+		t.Errorf("As found %v, want the BasePathFs", bp)
+	}
+	var m *MemMapFs
+	if !As(fs, &m) || m != mem {
+		t.Errorf("As found %v, want the MemMapFs", m)
+	}
+	var cow *CopyOnWriteFs
+	if As(fs, &cow) || cow != nil {
+		t.Errorf("As found a CopyOnWriteFs: %v", cow)
+	}
+	var l Locker
+	if !As(fs, &l) || any(l) != any(fs) {
+		t.Errorf("As with an interface found %v, want the outermost Fs", l)
+	}
+
+	for _, target := range []any{nil, bp, new(int)} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("As(%T) did not panic", target)
+				}
+			}()
+			As(fs, target)
+		}()
+	}
+}
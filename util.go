@@ -23,6 +23,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"syscall"
 	"unicode"
 
 	"golang.org/x/text/runes"
@@ -327,3 +328,23 @@ func FullBaseFsPath(basePathFs *BasePathFs, relativePath string) string {
 
 	return combinedPath
 }
+
+// Scope returns an Afero restricted to dir, in the same way as BasePathFs.
+// It fails if dir is not an existing directory or if the scoped filesystem
+// does not provide all of the required capabilities, so that a wrapper
+// stack that silently drops e.g. symlink support is caught when it is set up.
+func (a Afero) Scope(dir string, required Capability) (Afero, error) {
+	isDir, err := IsDir(a.Fs, dir)
+	if err != nil {
+		return Afero{}, err
+	}
+	if !isDir {
+		return Afero{}, &os.PathError{Op: "scope", Path: dir, Err: syscall.ENOTDIR}
+	}
+
+	scoped := NewBasePathFs(a.Fs, dir)
+	if missing := required &^ Capabilities(scoped); missing != 0 {
+		return Afero{}, &os.PathError{Op: "scope", Path: dir, Err: fmt.Errorf("%w: %s", ErrMissingCapability, missing)}
+	}
+	return Afero{Fs: scoped}, nil
+}
@@ -0,0 +1,12 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package afero
+
+import "os"
+
+// sysFileKey returns the identity of a FileInfo of the os package, which is
+// not available on this platform; os.SameFile still is.
+func sysFileKey(fi os.FileInfo) (interface{}, bool) {
+	return nil, false
+}
@@ -0,0 +1,18 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package afero
+
+import (
+	"os"
+	"syscall"
+)
+
+// sysFileKey returns the device and inode of a FileInfo of the os package.
+func sysFileKey(fi os.FileInfo) (interface{}, bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil, false
+	}
+	return [2]uint64{uint64(st.Dev), uint64(st.Ino)}, true
+}
@@ -0,0 +1,384 @@
+package afero
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/spf13/afero/mem"
+)
+
+// WatchOp describes the kind of change reported by a Watcher.
+type WatchOp uint32
+
+const (
+	WatchCreate WatchOp = 1 << iota
+	WatchWrite
+	WatchRemove
+	WatchRename
+	WatchChmod
+)
+
+var watchOpNames = []struct {
+	op   WatchOp
+	name string
+}{
+	{WatchCreate, "CREATE"},
+	{WatchWrite, "WRITE"},
+	{WatchRemove, "REMOVE"},
+	{WatchRename, "RENAME"},
+	{WatchChmod, "CHMOD"},
+}
+
+func (op WatchOp) String() string {
+	var names []string
+	for _, o := range watchOpNames {
+		if op&o.op != 0 {
+			names = append(names, o.name)
+		}
+	}
+	return strings.Join(names, "|")
+}
+
+// WatchEvent is a change to the named file. Rename is reported as a
+// WatchRename event for the old name followed by a WatchCreate event for
+// the new one; chown and chtimes are reported as WatchChmod.
+type WatchEvent struct {
+	Name string
+	Op   WatchOp
+}
+
+func (e WatchEvent) String() string {
+	return e.Op.String() + " " + e.Name
+}
+
+// Watcher reports changes to the files of a filesystem.
+type Watcher interface {
+	// Add starts watching name; for a directory this includes everything
+	// below it, including directories created later on.
+	Add(name string) error
+
+	// Remove stops watching a name passed to Add.
+	Remove(name string) error
+
+	// Events returns the channel the changes are delivered on. It is
+	// closed by Close.
+	Events() <-chan WatchEvent
+
+	// Errors returns the channel errors are delivered on. It is closed by
+	// Close.
+	Errors() <-chan error
+
+	Close() error
+}
+
+// Watchable is implemented by filesystems that can report changes.
+type Watchable interface {
+	Watch() (Watcher, error)
+}
+
+// ErrNoWatch is returned by NewWatcher for filesystems that cannot report
+// changes.
+var ErrNoWatch = errors.New("watching not supported")
+
+// NewWatcher returns a Watcher for fs. OsFs uses the watcher registered
+// with RegisterOsWatcher, MemMapFs reports the changes made through its
+// methods, and BasePathFs and ReadOnlyFs watch their source.
+func NewWatcher(fs Fs) (Watcher, error) {
+	if w, ok := fs.(Watchable); ok {
+		return w.Watch()
+	}
+	return nil, ErrNoWatch
+}
+
+// watchRoots is a set of watched names.
+type watchRoots map[string]bool
+
+// covers reports whether name is one of the roots or below one of them.
+func (r watchRoots) covers(name string) bool {
+	for root := range r {
+		if name == root || strings.HasPrefix(name, strings.TrimSuffix(root, FilePathSeparator)+FilePathSeparator) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	osWatchMu sync.RWMutex
+	osWatch   func() (Watcher, error)
+)
+
+// RegisterOsWatcher makes newWatcher create the Watchers of OsFs. The core
+// package cannot watch the file system of the operating system itself;
+// the oswatch package registers a watcher using its notification
+// mechanism when it is imported:
+//
+//	import _ "github.com/spf13/afero/oswatch"
+//
+// RegisterOsWatcher panics if a watcher is already registered.
+func RegisterOsWatcher(newWatcher func() (Watcher, error)) {
+	osWatchMu.Lock()
+	defer osWatchMu.Unlock()
+	if newWatcher == nil {
+		panic("afero: RegisterOsWatcher newWatcher is nil")
+	}
+	if osWatch != nil {
+		panic("afero: RegisterOsWatcher called twice")
+	}
+	osWatch = newWatcher
+}
+
+// Watch returns a Watcher created by the function registered with
+// RegisterOsWatcher, or ErrNoWatch if there is none.
+func (OsFs) Watch() (Watcher, error) {
+	osWatchMu.RLock()
+	newWatcher := osWatch
+	osWatchMu.RUnlock()
+	if newWatcher == nil {
+		return nil, ErrNoWatch
+	}
+	return newWatcher()
+}
+
+// memWatcher receives the changes made through a MemMapFs. Events are
+// queued, so the MemMapFs is never blocked by a slow reader.
+type memWatcher struct {
+	fs     *MemMapFs
+	events chan WatchEvent
+	errors chan error
+	wake   chan struct{}
+	done   chan struct{}
+
+	mu     sync.Mutex
+	roots  watchRoots
+	queue  []WatchEvent
+	closed bool
+}
+
+// Watch returns a Watcher reporting the changes made through m. Writes are
+// only reported for files opened after the first Watcher was created.
+func (m *MemMapFs) Watch() (Watcher, error) {
+	w := &memWatcher{
+		fs:     m,
+		events: make(chan WatchEvent),
+		errors: make(chan error),
+		wake:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+		roots:  make(watchRoots),
+	}
+	m.watchMu.Lock()
+	m.watchers = append(m.watchers, w)
+	m.watchMu.Unlock()
+	go w.run()
+	return w, nil
+}
+
+func (w *memWatcher) Events() <-chan WatchEvent { return w.events }
+
+func (w *memWatcher) Errors() <-chan error { return w.errors }
+
+func (w *memWatcher) Add(name string) error {
+	name = normalizePath(name)
+	if _, err := w.fs.Stat(name); err != nil {
+		return err
+	}
+	w.mu.Lock()
+	w.roots[name] = true
+	w.mu.Unlock()
+	return nil
+}
+
+func (w *memWatcher) Remove(name string) error {
+	name = normalizePath(name)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.roots[name] {
+		return &os.PathError{Op: "unwatch", Path: name, Err: os.ErrNotExist}
+	}
+	delete(w.roots, name)
+	return nil
+}
+
+func (w *memWatcher) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return ErrFileClosed
+	}
+	w.closed = true
+	w.mu.Unlock()
+
+	m := w.fs
+	m.watchMu.Lock()
+	for i, o := range m.watchers {
+		if o == w {
+			m.watchers = append(m.watchers[:i], m.watchers[i+1:]...)
+			break
+		}
+	}
+	m.watchMu.Unlock()
+	close(w.done)
+	return nil
+}
+
+func (w *memWatcher) push(e WatchEvent) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed || !w.roots.covers(e.Name) {
+		return
+	}
+	w.queue = append(w.queue, e)
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (w *memWatcher) run() {
+	defer close(w.events)
+	defer close(w.errors)
+	for {
+		w.mu.Lock()
+		queue := w.queue
+		w.queue = nil
+		w.mu.Unlock()
+		for _, e := range queue {
+			select {
+			case w.events <- e:
+			case <-w.done:
+				return
+			}
+		}
+		select {
+		case <-w.wake:
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// notify reports a change to the watchers of m.
+func (m *MemMapFs) notify(name string, op WatchOp) {
+	m.watchMu.Lock()
+	defer m.watchMu.Unlock()
+	for _, w := range m.watchers {
+		w.push(WatchEvent{Name: name, Op: op})
+	}
+}
+
+// watchFile makes writes to f reported to the watchers of m, if there are
+// any.
+func (m *MemMapFs) watchFile(f *mem.File) File {
+	m.watchMu.Lock()
+	defer m.watchMu.Unlock()
+	if len(m.watchers) == 0 {
+		return f
+	}
+	return &memWatchFile{File: f, fs: m}
+}
+
+// memWatchFile reports writes to a file of a watched MemMapFs.
+type memWatchFile struct {
+	*mem.File
+	fs *MemMapFs
+}
+
+func (f *memWatchFile) wrote(err error) {
+	if err == nil {
+		f.fs.notify(f.Data().Name(), WatchWrite)
+	}
+}
+
+func (f *memWatchFile) Write(b []byte) (int, error) {
+	n, err := f.File.Write(b)
+	f.wrote(err)
+	return n, err
+}
+
+func (f *memWatchFile) WriteAt(b []byte, off int64) (int, error) {
+	n, err := f.File.WriteAt(b, off)
+	f.wrote(err)
+	return n, err
+}
+
+func (f *memWatchFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *memWatchFile) Truncate(size int64) error {
+	err := f.File.Truncate(size)
+	f.wrote(err)
+	return err
+}
+
+// basePathWatcher translates the names of a Watcher on the source of a
+// BasePathFs.
+type basePathWatcher struct {
+	Watcher
+	fs     *BasePathFs
+	events chan WatchEvent
+	done   chan struct{}
+
+	closeOnce sync.Once
+}
+
+func (b *BasePathFs) Watch() (Watcher, error) {
+	w, err := NewWatcher(b.source)
+	if err != nil {
+		return nil, err
+	}
+	bw := &basePathWatcher{Watcher: w, fs: b, events: make(chan WatchEvent), done: make(chan struct{})}
+	go bw.run()
+	return bw, nil
+}
+
+func (w *basePathWatcher) Events() <-chan WatchEvent { return w.events }
+
+func (w *basePathWatcher) Add(name string) error {
+	path, err := w.fs.RealPath(name)
+	if err != nil {
+		return &os.PathError{Op: "watch", Path: name, Err: err}
+	}
+	return w.Watcher.Add(path)
+}
+
+func (w *basePathWatcher) Remove(name string) error {
+	path, err := w.fs.RealPath(name)
+	if err != nil {
+		return &os.PathError{Op: "unwatch", Path: name, Err: err}
+	}
+	return w.Watcher.Remove(path)
+}
+
+func (w *basePathWatcher) Close() error {
+	w.closeOnce.Do(func() { close(w.done) })
+	return w.Watcher.Close()
+}
+
+func (w *basePathWatcher) run() {
+	defer close(w.events)
+	base := filepath.Clean(w.fs.path)
+	for e := range w.Watcher.Events() {
+		if base != FilePathSeparator {
+			if e.Name != base && !strings.HasPrefix(e.Name, base+FilePathSeparator) {
+				continue
+			}
+			e.Name = strings.TrimPrefix(e.Name, base)
+			if e.Name == "" {
+				e.Name = FilePathSeparator
+			}
+		}
+		select {
+		case w.events <- e:
+		case <-w.done:
+			return
+		}
+	}
+}
+
+func (r *ReadOnlyFs) Watch() (Watcher, error) {
+	return NewWatcher(r.source)
+}
@@ -0,0 +1,98 @@
+package afero
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// nextEvent returns the next event for name, skipping others.
+func nextEvent(t *testing.T, w Watcher, name string) WatchEvent {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case e := <-w.Events():
+			if e.Name == name {
+				return e
+			}
+		case err := <-w.Errors():
+			t.Fatal(err)
+		case <-timeout:
+			t.Fatalf("no event for %s", name)
+		}
+	}
+}
+
+func TestMemMapFsWatcher(t *testing.T) {
+	fs := &MemMapFs{}
+	fs.MkdirAll("/watched", 0o755)
+	fs.MkdirAll("/other", 0o755)
+
+	w, err := NewWatcher(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if err := w.Add("/watched"); err != nil {
+		t.Fatal(err)
+	}
+
+	WriteFile(fs, "/other/ignored", []byte("x"), 0o644)
+	fs.MkdirAll("/watched/sub", 0o755)
+	f, _ := fs.Create("/watched/sub/file")
+	f.WriteString("x")
+	f.Close()
+	fs.Rename("/watched/sub/file", "/watched/moved")
+	fs.Chmod("/watched/moved", 0o600)
+	fs.Remove("/watched/moved")
+
+	want := []WatchEvent{
+		{"/watched/sub", WatchCreate},
+		{"/watched/sub/file", WatchCreate},
+		{"/watched/sub/file", WatchWrite},
+		{"/watched/sub/file", WatchRename},
+		{"/watched/moved", WatchCreate},
+		{"/watched/moved", WatchChmod},
+		{"/watched/moved", WatchRemove},
+	}
+	for _, we := range want {
+		select {
+		case e := <-w.Events():
+			if e != we {
+				t.Fatalf("got %v, want %v", e, we)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no event, want %v", we)
+		}
+	}
+}
+
+func TestBasePathFsWatcher(t *testing.T) {
+	fs := NewBasePathFs(&MemMapFs{}, "/base")
+	fs.MkdirAll("/dir", 0o755)
+
+	w, err := NewWatcher(NewReadOnlyFs(fs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if err := w.Add("/dir"); err != nil {
+		t.Fatal(err)
+	}
+	fs.Create("/dir/file")
+	if e := nextEvent(t, w, filepath.FromSlash("/dir/file")); e.Op != WatchCreate {
+		t.Errorf("got %v, want CREATE", e)
+	}
+
+	if _, err := NewWatcher(NewRegexpFs(fs, nil)); err != ErrNoWatch {
+		t.Errorf("NewWatcher(RegexpFs) = %v, want %v", err, ErrNoWatch)
+	}
+}
+
+func TestOsFsWatcherUnregistered(t *testing.T) {
+	// the watcher of the oswatch package is not registered in this test
+	if _, err := NewWatcher(NewOsFs()); err != ErrNoWatch {
+		t.Errorf("NewWatcher(OsFs) = %v, want %v", err, ErrNoWatch)
+	}
+}
@@ -0,0 +1,289 @@
+package webdavfs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"syscall"
+
+	"github.com/spf13/afero"
+	"github.com/spf13/afero/internal/common"
+)
+
+// File is a file or collection opened from a Fs. Read-only files are read
+// with ranged GET requests; files opened for writing hold their content in
+// memory until Sync or Close.
+type File struct {
+	fs   *Fs
+	name string
+	info os.FileInfo
+	flag int
+	off  int64
+
+	// body streams the content from bodyOff for sequential reads.
+	body    io.ReadCloser
+	bodyOff int64
+
+	// buf is the content of a file opened for writing, which is stored if
+	// dirty.
+	buf   []byte
+	dirty bool
+
+	dir    common.DirLister
+	closed bool
+}
+
+var _ afero.File = (*File)(nil)
+
+func (f *File) Name() string { return f.name }
+
+func (f *File) writable() bool { return f.buf != nil }
+
+// readable returns an error unless f was opened for reading.
+func (f *File) readable() error {
+	if f.closed {
+		return afero.ErrFileClosed
+	}
+	if !common.ReadAccess(f.flag) {
+		return &os.PathError{Op: "read", Path: f.name, Err: syscall.EBADF}
+	}
+	return nil
+}
+
+func (f *File) Close() error {
+	if f.closed {
+		return afero.ErrFileClosed
+	}
+	err := f.Sync()
+	f.closeBody()
+	f.closed = true
+	return err
+}
+
+func (f *File) closeBody() {
+	if f.body != nil {
+		f.body.Close()
+		f.body = nil
+	}
+}
+
+func (f *File) Read(p []byte) (int, error) {
+	if err := f.readable(); err != nil {
+		return 0, err
+	}
+	if f.writable() || f.info.IsDir() {
+		n, err := f.ReadAt(p, f.off)
+		f.off += int64(n)
+		return n, err
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if f.body == nil || f.bodyOff != f.off {
+		f.closeBody()
+		body, err := f.get(f.off, -1)
+		if err != nil {
+			return 0, err
+		}
+		f.body, f.bodyOff = body, f.off
+	}
+	n, err := f.body.Read(p)
+	f.off += int64(n)
+	f.bodyOff = f.off
+	if err != nil && err != io.EOF {
+		err = &os.PathError{Op: "read", Path: f.name, Err: err}
+	}
+	return n, err
+}
+
+func (f *File) ReadAt(p []byte, off int64) (int, error) {
+	if err := f.readable(); err != nil {
+		return 0, err
+	}
+	if f.info.IsDir() {
+		return 0, &os.PathError{Op: "read", Path: f.name, Err: syscall.EISDIR}
+	}
+	if off < 0 {
+		return 0, &os.PathError{Op: "readat", Path: f.name, Err: errors.New("negative offset")}
+	}
+	if f.writable() {
+		if off >= int64(len(f.buf)) {
+			return 0, io.EOF
+		}
+		n := copy(p, f.buf[off:])
+		if n < len(p) {
+			return n, io.EOF
+		}
+		return n, nil
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	body, err := f.get(off, int64(len(p)))
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+	n, err := io.ReadFull(body, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// get returns the content from off with a ranged GET, up to n bytes unless
+// n is negative. It returns io.EOF if off is at or past the end.
+func (f *File) get(off, n int64) (io.ReadCloser, error) {
+	rng := fmt.Sprintf("bytes=%d-", off)
+	if n >= 0 {
+		rng += fmt.Sprint(off + n - 1)
+	}
+	resp, err := f.fs.do("GET", f.name, false, nil, map[string]string{"Range": rng})
+	if err != nil {
+		return nil, &os.PathError{Op: "read", Path: f.name, Err: err}
+	}
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		return resp.Body, nil
+	case http.StatusRequestedRangeNotSatisfiable:
+		resp.Body.Close()
+		return nil, io.EOF
+	case http.StatusOK:
+		// The server ignored the range.
+		if _, err := io.CopyN(io.Discard, resp.Body, off); err != nil {
+			resp.Body.Close()
+			if err == io.EOF {
+				return nil, io.EOF
+			}
+			return nil, &os.PathError{Op: "read", Path: f.name, Err: err}
+		}
+		return resp.Body, nil
+	}
+	resp.Body.Close()
+	if err := statusError("read", f.name, resp); err != nil {
+		return nil, err
+	}
+	return nil, &os.PathError{Op: "read", Path: f.name, Err: fmt.Errorf("webdav: %s", resp.Status)}
+}
+
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	if f.closed {
+		return 0, afero.ErrFileClosed
+	}
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.off
+	case io.SeekEnd:
+		if f.writable() {
+			offset += int64(len(f.buf))
+		} else {
+			offset += f.info.Size()
+		}
+	}
+	if offset < 0 {
+		return 0, &os.PathError{Op: "seek", Path: f.name, Err: syscall.EINVAL}
+	}
+	f.off = offset
+	return offset, nil
+}
+
+func (f *File) Write(p []byte) (int, error) {
+	if f.flag&os.O_APPEND != 0 {
+		f.off = int64(len(f.buf))
+	}
+	n, err := f.WriteAt(p, f.off)
+	f.off += int64(n)
+	return n, err
+}
+
+func (f *File) WriteAt(p []byte, off int64) (int, error) {
+	if f.closed {
+		return 0, afero.ErrFileClosed
+	}
+	if !f.writable() {
+		return 0, &os.PathError{Op: "write", Path: f.name, Err: syscall.EBADF}
+	}
+	if off < 0 {
+		return 0, &os.PathError{Op: "writeat", Path: f.name, Err: errors.New("negative offset")}
+	}
+	if end := off + int64(len(p)); end > int64(len(f.buf)) {
+		f.buf = append(f.buf, make([]byte, end-int64(len(f.buf)))...)
+	}
+	copy(f.buf[off:], p)
+	f.dirty = true
+	return len(p), nil
+}
+
+func (f *File) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *File) Truncate(size int64) error {
+	if f.closed {
+		return afero.ErrFileClosed
+	}
+	if !f.writable() {
+		return &os.PathError{Op: "truncate", Path: f.name, Err: syscall.EBADF}
+	}
+	if size < 0 {
+		return &os.PathError{Op: "truncate", Path: f.name, Err: syscall.EINVAL}
+	}
+	if size > int64(len(f.buf)) {
+		f.buf = append(f.buf, make([]byte, size-int64(len(f.buf)))...)
+	} else {
+		f.buf = f.buf[:size]
+	}
+	f.dirty = true
+	return nil
+}
+
+// Sync stores the content of a file opened for writing with a PUT.
+func (f *File) Sync() error {
+	if f.closed {
+		return afero.ErrFileClosed
+	}
+	if !f.dirty {
+		return nil
+	}
+	if err := f.fs.exec("write", "PUT", f.name, false, f.buf, nil); err != nil {
+		return err
+	}
+	f.dirty = false
+	return nil
+}
+
+func (f *File) Stat() (os.FileInfo, error) {
+	if f.closed {
+		return nil, afero.ErrFileClosed
+	}
+	if f.writable() {
+		return &fileInfo{name: f.info.Name(), size: int64(len(f.buf)), mode: f.info.Mode(), modTime: f.info.ModTime()}, nil
+	}
+	return f.info, nil
+}
+
+func (f *File) Readdir(count int) ([]os.FileInfo, error) {
+	if f.closed {
+		return nil, afero.ErrFileClosed
+	}
+	return f.dir.Readdir(count, func() ([]os.FileInfo, error) {
+		entries, err := f.fs.readDir(f.name)
+		if err != nil {
+			return nil, err
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+		return entries, io.EOF
+	})
+}
+
+func (f *File) Readdirnames(n int) ([]string, error) {
+	entries, err := f.Readdir(n)
+	names := make([]string, len(entries))
+	for i, fi := range entries {
+		names[i] = fi.Name()
+	}
+	return names, err
+}
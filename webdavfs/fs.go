@@ -0,0 +1,414 @@
+// Package webdavfs provides an afero.Fs for a directory on a WebDAV server.
+package webdavfs
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// Credentials authenticate the requests of a Fs with HTTP basic auth.
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// Fs is an afero.Fs for the collection at a WebDAV URL.
+//
+// Stat and Readdir use PROPFIND, reads are ranged GET requests, Mkdir is
+// MKCOL and Rename is MOVE. WebDAV cannot write parts of a file, so files
+// opened for writing are buffered in memory and stored with a PUT on Sync
+// and Close; until then other handles, like every other client, see the
+// content before the writes. The protocol has no permissions, owners or
+// settable times: Chmod, Chown and Chtimes of an existing file fail with
+// errors.ErrUnsupported.
+type Fs struct {
+	base   *url.URL
+	creds  *Credentials
+	client *http.Client
+}
+
+// Option configures a Fs.
+type Option func(*Fs)
+
+// WithClient makes the Fs send its requests with c instead of
+// http.DefaultClient.
+func WithClient(c *http.Client) Option {
+	return func(fs *Fs) {
+		fs.client = c
+	}
+}
+
+// New returns a Fs for the collection at rawURL. The credentials may be nil
+// for servers without authentication.
+func New(rawURL string, creds *Credentials, opts ...Option) (afero.Fs, error) {
+	base, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if base.Scheme != "http" && base.Scheme != "https" {
+		return nil, fmt.Errorf("webdavfs: unsupported URL scheme %q", base.Scheme)
+	}
+	base.Path = strings.TrimSuffix(base.Path, "/")
+	fs := &Fs{base: base, creds: creds, client: http.DefaultClient}
+	for _, opt := range opts {
+		opt(fs)
+	}
+	return fs, nil
+}
+
+func (fs *Fs) Name() string { return "webdavfs" }
+
+// PathSeparator returns "/", which separates the elements of WebDAV paths
+// on every OS.
+func (fs *Fs) PathSeparator() string { return "/" }
+
+// clean returns name as a slash separated path relative to the base URL.
+func clean(name string) string {
+	return path.Clean("/" + strings.ReplaceAll(name, "\\", "/"))
+}
+
+// url returns the URL of name, with a trailing slash for collections.
+func (fs *Fs) url(name string, dir bool) string {
+	u := *fs.base
+	u.Path = fs.base.Path + clean(name)
+	if dir && !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+	return u.String()
+}
+
+func (fs *Fs) do(method, name string, dir bool, body []byte, header map[string]string) (*http.Response, error) {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, fs.url(name, dir), r)
+	if err != nil {
+		return nil, err
+	}
+	if fs.creds != nil {
+		req.SetBasicAuth(fs.creds.Username, fs.creds.Password)
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	return fs.client.Do(req)
+}
+
+// exec sends a request whose response body is not needed and maps error
+// statuses to a *os.PathError.
+func (fs *Fs) exec(op, method, name string, dir bool, body []byte, header map[string]string) error {
+	resp, err := fs.do(method, name, dir, body, header)
+	if err != nil {
+		return &os.PathError{Op: op, Path: name, Err: err}
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return statusError(op, name, resp)
+}
+
+// statusError returns nil for successful responses and a *os.PathError
+// matching the status otherwise.
+func statusError(op, name string, resp *http.Response) error {
+	var err error
+	switch code := resp.StatusCode; {
+	case code < 300:
+		return nil
+	case code == http.StatusNotFound, code == http.StatusConflict:
+		// Conflict means that a parent collection is missing.
+		err = os.ErrNotExist
+	case code == http.StatusUnauthorized, code == http.StatusForbidden:
+		err = os.ErrPermission
+	case code == http.StatusMethodNotAllowed && op == "mkdir":
+		err = os.ErrExist
+	case code == http.StatusPreconditionFailed:
+		err = os.ErrExist
+	case code == http.StatusInsufficientStorage:
+		err = syscall.ENOSPC
+	default:
+		err = fmt.Errorf("webdav: %s", resp.Status)
+	}
+	return &os.PathError{Op: op, Path: name, Err: err}
+}
+
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<D:propfind xmlns:D="DAV:"><D:prop><D:resourcetype/><D:getcontentlength/><D:getlastmodified/></D:prop></D:propfind>`
+
+type multistatus struct {
+	Responses []struct {
+		Href      string `xml:"DAV: href"`
+		Propstats []struct {
+			Status string `xml:"DAV: status"`
+			Prop   struct {
+				ResourceType struct {
+					Collection *struct{} `xml:"DAV: collection"`
+				} `xml:"DAV: resourcetype"`
+				ContentLength string `xml:"DAV: getcontentlength"`
+				LastModified  string `xml:"DAV: getlastmodified"`
+			} `xml:"DAV: prop"`
+		} `xml:"DAV: propstat"`
+	} `xml:"DAV: response"`
+}
+
+// propfind returns the infos of name and, for depth 1, its children. The
+// info of name comes first.
+func (fs *Fs) propfind(op, name string, depth int) ([]os.FileInfo, error) {
+	resp, err := fs.do("PROPFIND", name, false, []byte(propfindBody), map[string]string{
+		"Depth":        strconv.Itoa(depth),
+		"Content-Type": "application/xml; charset=utf-8",
+	})
+	if err != nil {
+		return nil, &os.PathError{Op: op, Path: name, Err: err}
+	}
+	defer resp.Body.Close()
+	if err := statusError(op, name, resp); err != nil {
+		return nil, err
+	}
+	var ms multistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return nil, &os.PathError{Op: op, Path: name, Err: err}
+	}
+
+	self := clean(name)
+	var infos []os.FileInfo
+	for _, r := range ms.Responses {
+		p, err := fs.relPath(r.Href)
+		if err != nil {
+			return nil, &os.PathError{Op: op, Path: name, Err: err}
+		}
+		fi := &fileInfo{name: path.Base(p), mode: 0o644}
+		for _, ps := range r.Propstats {
+			if !strings.Contains(ps.Status, " 200 ") {
+				continue
+			}
+			if ps.Prop.ResourceType.Collection != nil {
+				fi.mode = os.ModeDir | 0o755
+			}
+			if ps.Prop.ContentLength != "" {
+				fi.size, _ = strconv.ParseInt(ps.Prop.ContentLength, 10, 64)
+			}
+			if ps.Prop.LastModified != "" {
+				fi.modTime, _ = http.ParseTime(ps.Prop.LastModified)
+			}
+		}
+		if p == self {
+			infos = append([]os.FileInfo{fi}, infos...)
+		} else {
+			infos = append(infos, fi)
+		}
+	}
+	if len(infos) == 0 {
+		return nil, &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+	}
+	return infos, nil
+}
+
+// relPath returns the path of href relative to the base URL.
+func (fs *Fs) relPath(href string) (string, error) {
+	u, err := url.Parse(href)
+	if err != nil {
+		return "", err
+	}
+	p := strings.TrimPrefix(u.Path, fs.base.Path)
+	if len(p) == len(u.Path) && fs.base.Path != "" {
+		return "", fmt.Errorf("webdav: response for %q outside of %q", href, fs.base.Path)
+	}
+	return clean(p), nil
+}
+
+func (fs *Fs) Stat(name string) (os.FileInfo, error) {
+	infos, err := fs.propfind("stat", name, 0)
+	if err != nil {
+		return nil, err
+	}
+	return infos[0], nil
+}
+
+func (fs *Fs) readDir(name string) ([]os.FileInfo, error) {
+	infos, err := fs.propfind("readdir", name, 1)
+	if err != nil {
+		return nil, err
+	}
+	if !infos[0].IsDir() {
+		return nil, &os.PathError{Op: "readdir", Path: name, Err: syscall.ENOTDIR}
+	}
+	return infos[1:], nil
+}
+
+func (fs *Fs) Create(name string) (afero.File, error) {
+	return fs.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o666)
+}
+
+func (fs *Fs) Open(name string) (afero.File, error) {
+	return fs.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (fs *Fs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	fi, err := fs.Stat(name)
+	switch {
+	case err == nil && flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL:
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrExist}
+	case errors.Is(err, os.ErrNotExist) && flag&os.O_CREATE != 0:
+		if err := fs.exec("open", "PUT", name, false, []byte{}, nil); err != nil {
+			return nil, err
+		}
+		fi = &fileInfo{name: path.Base(clean(name)), mode: 0o644, modTime: time.Now()}
+	case err != nil:
+		return nil, &os.PathError{Op: "open", Path: name, Err: err.(*os.PathError).Err}
+	}
+
+	f := &File{fs: fs, name: name, info: fi, flag: flag}
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_TRUNC) == 0 {
+		return f, nil
+	}
+	if fi.IsDir() {
+		return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
+	}
+	f.buf = []byte{}
+	if flag&os.O_TRUNC != 0 {
+		f.dirty = fi.Size() > 0
+	} else if fi.Size() > 0 {
+		if f.buf, err = fs.get(name); err != nil {
+			return nil, err
+		}
+	}
+	if flag&os.O_APPEND != 0 {
+		f.off = int64(len(f.buf))
+	}
+	return f, nil
+}
+
+// get returns the content of name.
+func (fs *Fs) get(name string) ([]byte, error) {
+	resp, err := fs.do("GET", name, false, nil, nil)
+	if err != nil {
+		return nil, &os.PathError{Op: "read", Path: name, Err: err}
+	}
+	defer resp.Body.Close()
+	if err := statusError("read", name, resp); err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, &os.PathError{Op: "read", Path: name, Err: err}
+	}
+	return data, nil
+}
+
+func (fs *Fs) Mkdir(name string, perm os.FileMode) error {
+	return fs.exec("mkdir", "MKCOL", name, true, nil, nil)
+}
+
+func (fs *Fs) MkdirAll(name string, perm os.FileMode) error {
+	p := ""
+	for _, elem := range strings.Split(clean(name), "/")[1:] {
+		if elem == "" {
+			continue
+		}
+		p += "/" + elem
+		err := fs.Mkdir(p, perm)
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return err
+		}
+		fi, err := fs.Stat(p)
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			return &os.PathError{Op: "mkdir", Path: p, Err: syscall.ENOTDIR}
+		}
+	}
+	return nil
+}
+
+func (fs *Fs) Remove(name string) error {
+	fi, err := fs.Stat(name)
+	if err != nil {
+		return &os.PathError{Op: "remove", Path: name, Err: err.(*os.PathError).Err}
+	}
+	if fi.IsDir() {
+		entries, err := fs.readDir(name)
+		if err != nil {
+			return err
+		}
+		if len(entries) > 0 {
+			return &os.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
+		}
+	}
+	return fs.exec("remove", "DELETE", name, fi.IsDir(), nil, nil)
+}
+
+func (fs *Fs) RemoveAll(name string) error {
+	err := fs.exec("RemoveAll", "DELETE", name, false, nil, nil)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// Rename moves oldname to newname. Servers answer a MOVE of a missing
+// resource with different statuses, so oldname is looked up first.
+func (fs *Fs) Rename(oldname, newname string) error {
+	_, err := fs.Stat(oldname)
+	if err == nil {
+		err = fs.exec("rename", "MOVE", oldname, false, nil, map[string]string{
+			"Destination": fs.url(newname, false),
+			"Overwrite":   "T",
+		})
+	}
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err.(*os.PathError).Err}
+	}
+	return nil
+}
+
+// unsupported returns the error of op on name, which fails for missing
+// files as on other file systems.
+func (fs *Fs) unsupported(op, name string) error {
+	if _, err := fs.Stat(name); err != nil {
+		return &os.PathError{Op: op, Path: name, Err: err.(*os.PathError).Err}
+	}
+	return &os.PathError{Op: op, Path: name, Err: errors.ErrUnsupported}
+}
+
+func (fs *Fs) Chmod(name string, mode os.FileMode) error {
+	return fs.unsupported("chmod", name)
+}
+
+func (fs *Fs) Chown(name string, uid, gid int) error {
+	return fs.unsupported("chown", name)
+}
+
+func (fs *Fs) Chtimes(name string, atime, mtime time.Time) error {
+	return fs.unsupported("chtimes", name)
+}
+
+type fileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (fi *fileInfo) Name() string       { return fi.name }
+func (fi *fileInfo) Size() int64        { return fi.size }
+func (fi *fileInfo) Mode() os.FileMode  { return fi.mode }
+func (fi *fileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *fileInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi *fileInfo) Sys() interface{}   { return nil }
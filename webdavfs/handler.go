@@ -0,0 +1,67 @@
+package webdavfs
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+
+	"golang.org/x/net/webdav"
+
+	"github.com/spf13/afero"
+)
+
+// NewHandler returns a WebDAV handler serving fs read-write below the URL
+// path prefix, e.g. to mount it with the WebDAV client of an operating
+// system. Locks are kept in memory; the Logger and LockSystem of the
+// handler can be changed before it is used.
+//
+//	http.Handle("/dav/", webdavfs.NewHandler(fs, "/dav"))
+func NewHandler(fs afero.Fs, prefix string) *webdav.Handler {
+	return &webdav.Handler{
+		Prefix:     prefix,
+		FileSystem: &fileSystem{fs},
+		LockSystem: webdav.NewMemLS(),
+	}
+}
+
+// fileSystem adapts an afero.Fs to webdav.FileSystem. Its files already
+// implement webdav.File.
+type fileSystem struct {
+	source afero.Fs
+}
+
+// name turns the slash separated name of a request into a name of the
+// source.
+func (w *fileSystem) name(name string) string {
+	return filepath.FromSlash(path.Clean("/" + name))
+}
+
+func (w *fileSystem) Mkdir(_ context.Context, name string, perm os.FileMode) error {
+	return w.source.Mkdir(w.name(name), perm)
+}
+
+func (w *fileSystem) OpenFile(_ context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	return w.source.OpenFile(w.name(name), flag, perm)
+}
+
+func (w *fileSystem) RemoveAll(_ context.Context, name string) error {
+	name = w.name(name)
+	if name == afero.FilePathSeparator {
+		// like webdav.Dir, never remove the root
+		return os.ErrInvalid
+	}
+	return w.source.RemoveAll(name)
+}
+
+func (w *fileSystem) Rename(_ context.Context, oldName, newName string) error {
+	oldName, newName = w.name(oldName), w.name(newName)
+	if oldName == afero.FilePathSeparator || newName == afero.FilePathSeparator {
+		return os.ErrInvalid
+	}
+	return w.source.Rename(oldName, newName)
+}
+
+func (w *fileSystem) Stat(_ context.Context, name string) (os.FileInfo, error) {
+	return w.source.Stat(w.name(name))
+}
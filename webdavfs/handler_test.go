@@ -0,0 +1,68 @@
+package webdavfs
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestHandler(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "/docs/readme.txt", []byte("hello"), 0o644)
+	srv := httptest.NewServer(NewHandler(fs, "/dav"))
+	defer srv.Close()
+
+	do := func(method, path, body string, header ...string) (int, string) {
+		t.Helper()
+		req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(b)
+	}
+
+	if code, body := do("GET", "/dav/docs/readme.txt", ""); code != http.StatusOK || body != "hello" {
+		t.Errorf("GET = %d %q", code, body)
+	}
+	if code, _ := do("MKCOL", "/dav/new", ""); code != http.StatusCreated {
+		t.Errorf("MKCOL = %d", code)
+	}
+	if code, _ := do("PUT", "/dav/new/file.txt", "uploaded"); code != http.StatusCreated {
+		t.Errorf("PUT = %d", code)
+	}
+	if got, err := afero.ReadFile(fs, "/new/file.txt"); err != nil || string(got) != "uploaded" {
+		t.Errorf("uploaded file = %q, %v", got, err)
+	}
+	code, body := do("PROPFIND", "/dav/new/", "", "Depth", "1")
+	if code != http.StatusMultiStatus || !strings.Contains(body, "/dav/new/file.txt") {
+		t.Errorf("PROPFIND = %d %s", code, body)
+	}
+	if code, _ := do("MOVE", "/dav/new/file.txt", "", "Destination", srv.URL+"/dav/docs/moved.txt"); code != http.StatusCreated {
+		t.Errorf("MOVE = %d", code)
+	}
+	if ok, _ := afero.Exists(fs, "/docs/moved.txt"); !ok {
+		t.Error("the moved file is missing")
+	}
+	if code, _ := do("DELETE", "/dav/docs", ""); code != http.StatusNoContent {
+		t.Errorf("DELETE = %d", code)
+	}
+	if ok, _ := afero.Exists(fs, "/docs"); ok {
+		t.Error("the deleted directory still exists")
+	}
+	if code, _ := do("DELETE", "/dav/", ""); code < 400 {
+		t.Errorf("DELETE of the root = %d", code)
+	}
+}
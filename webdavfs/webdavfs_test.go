@@ -0,0 +1,186 @@
+package webdavfs
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"syscall"
+	"testing"
+
+	"golang.org/x/net/webdav"
+
+	"github.com/spf13/afero"
+	"github.com/spf13/afero/aferotest"
+)
+
+func newTestFs(t *testing.T, creds *Credentials) afero.Fs {
+	t.Helper()
+	h := &webdav.Handler{Prefix: "/dav", FileSystem: webdav.NewMemFS(), LockSystem: webdav.NewMemLS()}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, _ := r.BasicAuth(); user != "user" || pass != "secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	fs, err := New(srv.URL+"/dav/", creds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fs
+}
+
+func TestWebdavFs(t *testing.T) {
+	fs := newTestFs(t, &Credentials{Username: "user", Password: "secret"})
+
+	if err := fs.MkdirAll("/a/b", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Mkdir("/a", 0o755); !errors.Is(err, os.ErrExist) {
+		t.Errorf("Mkdir of existing dir = %v", err)
+	}
+	if err := fs.Mkdir("/x/y", 0o755); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Mkdir without parent = %v", err)
+	}
+	if err := afero.WriteFile(fs, "/a/f.txt", []byte("hello world"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := fs.Stat("/a/f.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Name() != "f.txt" || fi.Size() != 11 || fi.IsDir() || fi.ModTime().IsZero() {
+		t.Errorf("Stat = %s %d %v %v", fi.Name(), fi.Size(), fi.IsDir(), fi.ModTime())
+	}
+	if fi, err := fs.Stat("/a/b"); err != nil || !fi.IsDir() {
+		t.Errorf("Stat dir = %v, %v", fi, err)
+	}
+	if _, err := fs.Stat("/missing"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Stat missing = %v", err)
+	}
+
+	f, err := fs.Open("/a/f.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 5)
+	if n, err := f.ReadAt(buf, 6); err != nil || string(buf[:n]) != "world" {
+		t.Errorf("ReadAt = %q, %v", buf[:n], err)
+	}
+	if n, err := f.ReadAt(buf, 8); err != io.EOF || string(buf[:n]) != "rld" {
+		t.Errorf("ReadAt at end = %q, %v", buf[:n], err)
+	}
+	f.Seek(6, io.SeekStart)
+	if data, err := io.ReadAll(f); err != nil || string(data) != "world" {
+		t.Errorf("read after Seek = %q, %v", data, err)
+	}
+	if _, err := f.Write([]byte("x")); err == nil {
+		t.Error("Write to read-only file succeeded")
+	}
+	f.Close()
+
+	f, err = fs.OpenFile("/a/f.txt", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("!")
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := afero.ReadFile(fs, "/a/f.txt"); err != nil || string(data) != "hello world!" {
+		t.Errorf("content after append = %q, %v", data, err)
+	}
+
+	if _, err := fs.OpenFile("/a/f.txt", os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644); !errors.Is(err, os.ErrExist) {
+		t.Errorf("O_EXCL on existing file = %v", err)
+	}
+
+	names, err := afero.ReadDir(fs, "/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, fi := range names {
+		got = append(got, fi.Name())
+	}
+	if want := []string{"b", "f.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadDir = %v, want %v", got, want)
+	}
+	aferotest.CheckReaddir(t, fs, "/a")
+
+	if err := fs.Rename("/a/f.txt", "/a/b/g.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Stat("/a/f.txt"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("old name after Rename = %v", err)
+	}
+	if err := fs.Remove("/a/b"); err == nil {
+		t.Error("Remove of non-empty dir succeeded")
+	}
+	if err := fs.Remove("/a/b/g.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.RemoveAll("/a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Stat("/a"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Stat after RemoveAll = %v", err)
+	}
+	if err := fs.Chmod("/", 0o700); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("Chmod = %v", err)
+	}
+}
+
+func TestWebdavFsCredentials(t *testing.T) {
+	fs := newTestFs(t, &Credentials{Username: "user", Password: "wrong"})
+	if _, err := fs.Stat("/"); !errors.Is(err, os.ErrPermission) {
+		t.Errorf("Stat with wrong password = %v", err)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	const buffered = "writes are buffered until Sync or Close, other handles do not see them before"
+	aferotest.Conformance(t, func(t *testing.T) afero.Fs {
+		return newTestFs(t, &Credentials{Username: "user", Password: "secret"})
+	}, 0,
+		aferotest.Skip("ReadWrite", buffered),
+		aferotest.Skip("Truncate", buffered),
+		aferotest.Skip("Chmod", "WebDAV has no permissions"),
+		aferotest.Skip("Chtimes", "WebDAV has no settable times"))
+}
+
+func TestWebdavFsBufferedWrites(t *testing.T) {
+	fs := newTestFs(t, &Credentials{Username: "user", Password: "secret"})
+	f, err := fs.OpenFile("/file", os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("hello"))
+	if err := f.Truncate(7); err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 8)
+	if n, err := f.ReadAt(b, 0); n != 7 || err != io.EOF || string(b[:n]) != "hello\x00\x00" {
+		t.Errorf("ReadAt on the writing handle = %d, %q, %v", n, b[:n], err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := afero.ReadFile(fs, "/file"); err != nil || string(got) != "hello\x00\x00" {
+		t.Errorf("content after Close = %q, %v", got, err)
+	}
+
+	w, err := fs.OpenFile("/file", os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if _, err := w.Read(b); !errors.Is(err, syscall.EBADF) {
+		t.Errorf("Read of a write-only file = %v, want EBADF", err)
+	}
+}
@@ -0,0 +1,106 @@
+package afero
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// workerLatency is the probed latency per file copied at once.
+	workerLatency = time.Millisecond
+	// probeInterval is the number of files between two probes.
+	probeInterval = 32
+)
+
+// workerPool copies files on up to max goroutines. How many files it
+// copies at once follows the latency of the file systems, which it probes
+// before the first file and every probeInterval files after it: one per
+// workerLatency of latency, so files on a local disk are copied one by one
+// and those in an object store with round trips of 20ms by up to 20
+// goroutines. With max 1 the files are copied by the caller.
+type workerPool struct {
+	max     int
+	probes  []func()
+	latency time.Duration
+	started int
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	limit   int
+	running int
+	err     error
+	wg      sync.WaitGroup
+}
+
+// newWorkerPool returns a pool of up to n workers, tuned by the duration of
+// the probes, each a cheap call to one of the file systems, e.g. a Stat.
+func newWorkerPool(n int, probes ...func()) *workerPool {
+	p := &workerPool{max: n, probes: probes, limit: 1}
+	p.cond = sync.NewCond(&p.mu)
+	return p
+}
+
+// probe times the probes and sets the number of workers from the latency
+// of the slowest file system, averaged with the earlier probes.
+func (p *workerPool) probe() {
+	var d time.Duration
+	for _, probe := range p.probes {
+		start := time.Now()
+		probe()
+		d = max(d, time.Since(start))
+	}
+	if p.started == 0 {
+		p.latency = d
+	} else {
+		p.latency = (3*p.latency + d) / 4
+	}
+	limit := min(max(int(p.latency/workerLatency), 1), p.max)
+
+	p.mu.Lock()
+	p.limit = limit
+	p.cond.Broadcast()
+	p.mu.Unlock()
+}
+
+// run calls fn on a worker once one is free. It returns the error of an
+// earlier call, after which no more calls are started.
+func (p *workerPool) run(fn func() error) error {
+	if p.max <= 1 {
+		return fn()
+	}
+	if p.started%probeInterval == 0 {
+		p.probe()
+	}
+	p.started++
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for p.err == nil && p.running >= p.limit {
+		p.cond.Wait()
+	}
+	if p.err != nil {
+		return p.err
+	}
+	p.running++
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		err := fn()
+		p.mu.Lock()
+		p.running--
+		if p.err == nil {
+			p.err = err
+		}
+		p.cond.Broadcast()
+		p.mu.Unlock()
+	}()
+	return nil
+}
+
+// wait waits for the running calls and returns the first error.
+func (p *workerPool) wait() error {
+	p.wg.Wait()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
@@ -0,0 +1,115 @@
+package afero
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// latencyFs delays Stat, and opening files for writing four times as long,
+// and records how many files are opened for writing at once.
+type latencyFs struct {
+	Fs
+	delay time.Duration
+
+	mu          sync.Mutex
+	open, peak  int
+	failOnWrite string
+}
+
+func (fs *latencyFs) Stat(name string) (os.FileInfo, error) {
+	time.Sleep(fs.delay)
+	return fs.Fs.Stat(name)
+}
+
+func (fs *latencyFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return fs.Fs.OpenFile(name, flag, perm)
+	}
+	if name == fs.failOnWrite {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrPermission}
+	}
+	fs.mu.Lock()
+	fs.open++
+	fs.peak = max(fs.peak, fs.open)
+	fs.mu.Unlock()
+	time.Sleep(4 * fs.delay)
+	f, err := fs.Fs.OpenFile(name, flag, perm)
+	fs.mu.Lock()
+	fs.open--
+	fs.mu.Unlock()
+	return f, err
+}
+
+func TestCopyWorkers(t *testing.T) {
+	src := NewMemMapFs()
+	for i := 0; i < 40; i++ {
+		if err := WriteFile(src, fmt.Sprintf("/src/d%d/f%d", i%4, i), []byte("data"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tt := range []struct {
+		delay     time.Duration
+		min, peak int
+	}{
+		{0, 1, 2},
+		{5 * time.Millisecond, 2, 4},
+	} {
+		dst := &latencyFs{Fs: NewMemMapFs(), delay: tt.delay}
+		if err := CopyDir(dst, "/dst", src, "/src", CopyWorkers(4)); err != nil {
+			t.Fatal(err)
+		}
+		if dst.peak < tt.min || dst.peak > tt.peak {
+			t.Errorf("latency %v: %d files copied at once, want %d to %d", tt.delay, dst.peak, tt.min, tt.peak)
+		}
+		for i := 0; i < 40; i++ {
+			name := fmt.Sprintf("/dst/d%d/f%d", i%4, i)
+			if data, err := ReadFile(dst, name); err != nil || string(data) != "data" {
+				t.Fatalf("latency %v: %s = %q, %v", tt.delay, name, data, err)
+			}
+		}
+
+		dst = &latencyFs{Fs: NewMemMapFs(), delay: tt.delay}
+		opts := SyncOptions{SrcDir: "/src", DstDir: "/dst", Workers: 4}
+		actions, err := Sync(dst, src, opts)
+		if err != nil || len(actions) != 45 {
+			t.Fatalf("latency %v: Sync = %d actions, %v", tt.delay, len(actions), err)
+		}
+		if dst.peak < tt.min || dst.peak > tt.peak {
+			t.Errorf("latency %v: Sync copied %d files at once, want %d to %d", tt.delay, dst.peak, tt.min, tt.peak)
+		}
+	}
+
+	// the first error stops the copy
+	dst := &latencyFs{Fs: NewMemMapFs(), delay: 5 * time.Millisecond, failOnWrite: "/dst/d1/f5"}
+	if err := CopyDir(dst, "/dst", src, "/src", CopyWorkers(4)); !errors.Is(err, os.ErrPermission) {
+		t.Errorf("CopyDir with a failing file = %v", err)
+	}
+	dst = &latencyFs{Fs: NewMemMapFs(), delay: 5 * time.Millisecond, failOnWrite: "/dst/d1/f5"}
+	opts := SyncOptions{SrcDir: "/src", DstDir: "/dst", Workers: 4}
+	if _, err := Sync(dst, src, opts); !errors.Is(err, os.ErrPermission) {
+		t.Errorf("Sync with a failing file = %v", err)
+	}
+}
+
+func TestWorkerPoolProbe(t *testing.T) {
+	p := newWorkerPool(8, func() {})
+	p.probe()
+	if p.limit != 1 {
+		t.Errorf("limit for a local file system = %d, want 1", p.limit)
+	}
+	p = newWorkerPool(8, func() {}, func() { time.Sleep(3 * time.Millisecond) })
+	p.probe()
+	if p.limit < 3 || p.limit > 8 {
+		t.Errorf("limit for a latency of 3ms = %d, want 3 to 8", p.limit)
+	}
+	p = newWorkerPool(2, func() { time.Sleep(10 * time.Millisecond) })
+	p.probe()
+	if p.limit != 2 {
+		t.Errorf("limit capped at 2 = %d", p.limit)
+	}
+}
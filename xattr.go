@@ -0,0 +1,179 @@
+package afero
+
+import (
+	"errors"
+	"os"
+
+	"github.com/spf13/afero/mem"
+)
+
+var (
+	_ Xattrer = (*OsFs)(nil)
+	_ Xattrer = (*MemMapFs)(nil)
+)
+
+// Xattrer is an optional interface in Afero. It is only implemented by the
+// filesystems saying so.
+// It gives access to the extended attributes of files: small named values
+// stored next to the content, such as "user.mime_type". Missing attributes
+// are reported as ErrXattrNotFound on every filesystem.
+//
+// OsFs uses the xattr system calls where the platform has them. MemMapFs
+// keeps the attributes with the file, shared by its hard links.
+type Xattrer interface {
+	GetXattr(name, attr string) ([]byte, error)
+	SetXattr(name, attr string, value []byte) error
+	ListXattr(name string) ([]string, error)
+	RemoveXattr(name, attr string) error
+}
+
+// ErrNoXattr is the error that will be wrapped in an os.PathError if a file
+// system does not support extended attributes either directly or through
+// its delegated filesystem.
+var ErrNoXattr = errors.New("extended attributes not supported")
+
+// ErrXattrNotFound is wrapped in an os.PathError when the attribute to get
+// or remove is not set.
+var ErrXattrNotFound = errors.New("extended attribute not found")
+
+// GetXattr returns the value of the extended attribute attr of name. It
+// returns an *os.PathError wrapping ErrNoXattr if fs does not support
+// extended attributes.
+func GetXattr(fs Fs, name, attr string) ([]byte, error) {
+	if x, ok := fs.(Xattrer); ok {
+		return x.GetXattr(name, attr)
+	}
+	return nil, &os.PathError{Op: "getxattr", Path: name, Err: ErrNoXattr}
+}
+
+// SetXattr sets the extended attribute attr of name to value, creating or
+// replacing it.
+func SetXattr(fs Fs, name, attr string, value []byte) error {
+	if x, ok := fs.(Xattrer); ok {
+		return x.SetXattr(name, attr, value)
+	}
+	return &os.PathError{Op: "setxattr", Path: name, Err: ErrNoXattr}
+}
+
+// ListXattr returns the names of the extended attributes of name.
+func ListXattr(fs Fs, name string) ([]string, error) {
+	if x, ok := fs.(Xattrer); ok {
+		return x.ListXattr(name)
+	}
+	return nil, &os.PathError{Op: "listxattr", Path: name, Err: ErrNoXattr}
+}
+
+// RemoveXattr removes the extended attribute attr of name.
+func RemoveXattr(fs Fs, name, attr string) error {
+	if x, ok := fs.(Xattrer); ok {
+		return x.RemoveXattr(name, attr)
+	}
+	return &os.PathError{Op: "removexattr", Path: name, Err: ErrNoXattr}
+}
+
+func (a Afero) GetXattr(name, attr string) ([]byte, error) {
+	return GetXattr(a.Fs, name, attr)
+}
+
+func (a Afero) SetXattr(name, attr string, value []byte) error {
+	return SetXattr(a.Fs, name, attr, value)
+}
+
+func (a Afero) ListXattr(name string) ([]string, error) {
+	return ListXattr(a.Fs, name)
+}
+
+func (a Afero) RemoveXattr(name, attr string) error {
+	return RemoveXattr(a.Fs, name, attr)
+}
+
+func (OsFs) GetXattr(name, attr string) ([]byte, error) {
+	value, err := getxattr(name, attr)
+	if err != nil {
+		return nil, &os.PathError{Op: "getxattr", Path: name, Err: xattrErr(err)}
+	}
+	return value, nil
+}
+
+func (OsFs) SetXattr(name, attr string, value []byte) error {
+	if err := setxattr(name, attr, value); err != nil {
+		return &os.PathError{Op: "setxattr", Path: name, Err: err}
+	}
+	return nil
+}
+
+func (OsFs) ListXattr(name string) ([]string, error) {
+	names, err := listxattr(name)
+	if err != nil {
+		return nil, &os.PathError{Op: "listxattr", Path: name, Err: err}
+	}
+	return names, nil
+}
+
+func (OsFs) RemoveXattr(name, attr string) error {
+	if err := removexattr(name, attr); err != nil {
+		return &os.PathError{Op: "removexattr", Path: name, Err: xattrErr(err)}
+	}
+	return nil
+}
+
+// xattrFile returns the file name resolves to, for the xattr operation op.
+func (m *MemMapFs) xattrFile(op, name string) (*mem.FileData, error) {
+	resolved, err := m.resolve(name, true)
+	if err != nil {
+		return nil, &os.PathError{Op: op, Path: name, Err: err}
+	}
+	m.mu.RLock()
+	f, ok := m.getData()[resolved]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, &os.PathError{Op: op, Path: name, Err: ErrFileNotFound}
+	}
+	return f, nil
+}
+
+func (m *MemMapFs) GetXattr(name, attr string) ([]byte, error) {
+	f, err := m.xattrFile("getxattr", name)
+	if err != nil {
+		return nil, err
+	}
+	value, ok := mem.Xattr(f, attr)
+	if !ok {
+		return nil, &os.PathError{Op: "getxattr", Path: name, Err: ErrXattrNotFound}
+	}
+	return value, nil
+}
+
+func (m *MemMapFs) SetXattr(name, attr string, value []byte) error {
+	if err := m.checkOwner("setxattr", name); err != nil {
+		return err
+	}
+	f, err := m.xattrFile("setxattr", name)
+	if err != nil {
+		return err
+	}
+	mem.SetXattr(f, attr, value)
+	return nil
+}
+
+func (m *MemMapFs) ListXattr(name string) ([]string, error) {
+	f, err := m.xattrFile("listxattr", name)
+	if err != nil {
+		return nil, err
+	}
+	return mem.XattrNames(f), nil
+}
+
+func (m *MemMapFs) RemoveXattr(name, attr string) error {
+	if err := m.checkOwner("removexattr", name); err != nil {
+		return err
+	}
+	f, err := m.xattrFile("removexattr", name)
+	if err != nil {
+		return err
+	}
+	if !mem.RemoveXattr(f, attr) {
+		return &os.PathError{Op: "removexattr", Path: name, Err: ErrXattrNotFound}
+	}
+	return nil
+}
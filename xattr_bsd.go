@@ -0,0 +1,9 @@
+//go:build darwin || freebsd || netbsd
+// +build darwin freebsd netbsd
+
+package afero
+
+import "golang.org/x/sys/unix"
+
+// errNoAttr is the error of the xattr system calls for a missing attribute.
+const errNoAttr = unix.ENOATTR
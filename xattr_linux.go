@@ -0,0 +1,6 @@
+package afero
+
+import "golang.org/x/sys/unix"
+
+// errNoAttr is the error of the xattr system calls for a missing attribute.
+const errNoAttr = unix.ENODATA
@@ -0,0 +1,28 @@
+//go:build !darwin && !freebsd && !linux && !netbsd
+// +build !darwin,!freebsd,!linux,!netbsd
+
+package afero
+
+// osCapXattr is CapXattr if OsFs supports extended attributes on this
+// platform.
+const osCapXattr Capability = 0
+
+func xattrErr(err error) error {
+	return err
+}
+
+func getxattr(name, attr string) ([]byte, error) {
+	return nil, ErrNoXattr
+}
+
+func setxattr(name, attr string, value []byte) error {
+	return ErrNoXattr
+}
+
+func listxattr(name string) ([]string, error) {
+	return nil, ErrNoXattr
+}
+
+func removexattr(name, attr string) error {
+	return ErrNoXattr
+}
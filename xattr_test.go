@@ -0,0 +1,99 @@
+package afero
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+)
+
+// testXattrs sets, lists, gets and removes attributes of name.
+func testXattrs(t *testing.T, fs Fs, name string) {
+	t.Helper()
+	if err := SetXattr(fs, name, "user.b", []byte("2")); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetXattr(fs, name, "user.a", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := GetXattr(fs, name, "user.a"); err != nil || string(value) != "1" {
+		t.Errorf("GetXattr = %q, %v", value, err)
+	}
+	if names, err := ListXattr(fs, name); err != nil || !containsAll(names, "user.a", "user.b") {
+		t.Errorf("ListXattr = %q, %v", names, err)
+	}
+	if err := RemoveXattr(fs, name, "user.a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetXattr(fs, name, "user.a"); !errors.Is(err, ErrXattrNotFound) {
+		t.Errorf("GetXattr of a removed attribute = %v, want ErrXattrNotFound", err)
+	}
+	if err := RemoveXattr(fs, name, "user.a"); !errors.Is(err, ErrXattrNotFound) {
+		t.Errorf("RemoveXattr of a removed attribute = %v, want ErrXattrNotFound", err)
+	}
+}
+
+func containsAll(names []string, want ...string) bool {
+	for _, w := range want {
+		found := false
+		for _, n := range names {
+			found = found || n == w
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func TestMemMapFsXattr(t *testing.T) {
+	fs := NewMemMapFs()
+	WriteFile(fs, "/file", nil, 0o644)
+	testXattrs(t, fs, "/file")
+
+	// attributes belong to the file, not to its name
+	Link(fs, "/file", "/link")
+	SetXattr(fs, "/link", "user.c", []byte("3"))
+	if names, err := ListXattr(fs, "/file"); err != nil || !reflect.DeepEqual(names, []string{"user.b", "user.c"}) {
+		t.Errorf("ListXattr = %q, %v", names, err)
+	}
+	if _, err := GetXattr(fs, "/missing", "user.a"); !os.IsNotExist(err) {
+		t.Errorf("GetXattr of a missing file = %v, want not exist", err)
+	}
+}
+
+func TestOsFsXattr(t *testing.T) {
+	if osCapXattr == 0 {
+		t.Skip("OsFs has no extended attributes on this platform")
+	}
+	name := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(name, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fs := NewOsFs()
+	if err := SetXattr(fs, name, "user.probe", nil); errors.Is(err, errors.ErrUnsupported) {
+		t.Skip("the temporary directory has no extended attributes")
+	}
+	RemoveXattr(fs, name, "user.probe")
+	testXattrs(t, fs, name)
+}
+
+func TestXattrForwarding(t *testing.T) {
+	mem := NewMemMapFs()
+	WriteFile(mem, "/base/file", nil, 0o644)
+	testXattrs(t, NewBasePathFs(mem, "/base"), "/file")
+
+	ro := NewReadOnlyFs(NewBasePathFs(mem, "/base"))
+	if value, err := GetXattr(ro, "/file", "user.b"); err != nil || string(value) != "2" {
+		t.Errorf("GetXattr through ReadOnlyFs = %q, %v", value, err)
+	}
+	if err := SetXattr(ro, "/file", "user.a", nil); !errors.Is(err, syscall.EPERM) {
+		t.Errorf("SetXattr through ReadOnlyFs = %v, want EPERM", err)
+	}
+
+	if _, err := GetXattr(FromIOFS{}, "/file", "user.a"); !errors.Is(err, ErrNoXattr) {
+		t.Errorf("GetXattr without Xattrer = %v, want ErrNoXattr", err)
+	}
+}
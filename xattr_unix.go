@@ -0,0 +1,70 @@
+//go:build darwin || freebsd || linux || netbsd
+// +build darwin freebsd linux netbsd
+
+package afero
+
+import (
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// osCapXattr is CapXattr if OsFs supports extended attributes on this
+// platform.
+const osCapXattr = CapXattr
+
+// xattrErr maps the error of a missing attribute to ErrXattrNotFound.
+func xattrErr(err error) error {
+	if err == errNoAttr {
+		return ErrXattrNotFound
+	}
+	return err
+}
+
+func getxattr(name, attr string) ([]byte, error) {
+	for {
+		size, err := unix.Getxattr(name, attr, nil)
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size)
+		n, err := unix.Getxattr(name, attr, buf)
+		if err == unix.ERANGE {
+			// the value grew in between
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	}
+}
+
+func setxattr(name, attr string, value []byte) error {
+	return unix.Setxattr(name, attr, value, 0)
+}
+
+func listxattr(name string) ([]string, error) {
+	for {
+		size, err := unix.Listxattr(name, nil)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return []string{}, nil
+		}
+		buf := make([]byte, size)
+		n, err := unix.Listxattr(name, buf)
+		if err == unix.ERANGE {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return strings.Split(strings.TrimSuffix(string(buf[:n]), "\x00"), "\x00"), nil
+	}
+}
+
+func removexattr(name, attr string) error {
+	return unix.Removexattr(name, attr)
+}
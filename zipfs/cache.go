@@ -0,0 +1,61 @@
+package zipfs
+
+import (
+	"archive/zip"
+	"container/list"
+	"sync"
+)
+
+// blockSize is the size of the blocks the decompressed content of files is
+// read and cached in.
+const blockSize = 64 << 10
+
+type blockKey struct {
+	file  *zip.File
+	index int64
+}
+
+type cachedBlock struct {
+	key  blockKey
+	data []byte
+}
+
+// blockCache holds decompressed blocks, evicting the least recently used
+// ones beyond maxBytes. A maxBytes of zero means no limit.
+type blockCache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	lru      list.List
+	blocks   map[blockKey]*list.Element
+}
+
+func newBlockCache(maxBytes int64) *blockCache {
+	return &blockCache{maxBytes: maxBytes, blocks: make(map[blockKey]*list.Element)}
+}
+
+func (c *blockCache) get(key blockKey) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.blocks[key]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(e)
+	return e.Value.(*cachedBlock).data, true
+}
+
+func (c *blockCache) put(key blockKey, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.blocks[key]; ok {
+		return
+	}
+	c.blocks[key] = c.lru.PushFront(&cachedBlock{key: key, data: data})
+	c.size += int64(len(data))
+	for c.maxBytes > 0 && c.size > c.maxBytes {
+		b := c.lru.Remove(c.lru.Back()).(*cachedBlock)
+		delete(c.blocks, b.key)
+		c.size -= int64(len(b.data))
+	}
+}
@@ -5,46 +5,99 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"sync"
 	"syscall"
 
 	"github.com/spf13/afero"
+	"github.com/spf13/afero/internal/common"
 )
 
 type File struct {
-	fs            *Fs
-	zipfile       *zip.File
+	fs      *Fs
+	zipfile *zip.File
+
+	mu            sync.Mutex
+	cache         *blockCache
 	reader        io.ReadCloser
+	readerBlock   int64 // index of the next block reader returns
 	offset        int64
+	dir           common.DirLister
 	isdir, closed bool
-	buf           []byte
 }
 
-func (f *File) fillBuffer(offset int64) (err error) {
-	if f.reader == nil {
-		if f.reader, err = f.zipfile.Open(); err != nil {
-			return
+// block returns the decompressed block index of the file, from the cache
+// or by reading on. The caller must hold f.mu.
+func (f *File) block(index int64) ([]byte, error) {
+	key := blockKey{file: f.zipfile, index: index}
+	if data, ok := f.cache.get(key); ok {
+		return data, nil
+	}
+	if f.reader == nil || f.readerBlock > index {
+		// deflate streams can only be read from the start
+		if f.reader != nil {
+			f.reader.Close()
 		}
+		r, err := f.zipfile.Open()
+		if err != nil {
+			f.reader = nil
+			return nil, err
+		}
+		f.reader, f.readerBlock = r, 0
 	}
-	if offset > int64(f.zipfile.UncompressedSize64) {
-		offset = int64(f.zipfile.UncompressedSize64)
-		err = io.EOF
-	}
-	if len(f.buf) >= int(offset) {
-		return
+	for {
+		data := make([]byte, blockSize)
+		n, err := io.ReadFull(f.reader, data)
+		if err == io.ErrUnexpectedEOF || err == io.EOF {
+			err = nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		data = data[:n:n]
+		f.cache.put(blockKey{file: f.zipfile, index: f.readerBlock}, data)
+		f.readerBlock++
+		if f.readerBlock > index {
+			return data, nil
+		}
 	}
-	buf := make([]byte, int(offset)-len(f.buf))
-	if n, readErr := io.ReadFull(f.reader, buf); n > 0 {
-		f.buf = append(f.buf, buf[:n]...)
-	} else if readErr != nil {
-		err = readErr
+}
+
+// readAt reads the decompressed content at off into p. The caller must
+// hold f.mu.
+func (f *File) readAt(p []byte, off int64) (n int, err error) {
+	size := int64(f.zipfile.UncompressedSize64)
+	if off >= size {
+		return 0, io.EOF
+	}
+	if off+int64(len(p)) > size {
+		p, err = p[:size-off], io.EOF
+	}
+	for n < len(p) {
+		pos := off + int64(n)
+		data, berr := f.block(pos / blockSize)
+		if berr != nil {
+			return n, berr
+		}
+		c := 0
+		if within := int(pos % blockSize); within < len(data) {
+			c = copy(p[n:], data[within:])
+		}
+		if c == 0 {
+			// the archive holds less than its directory says
+			return n, io.ErrUnexpectedEOF
+		}
+		n += c
 	}
-	return
+	return n, err
 }
 
 func (f *File) Close() (err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
 	f.zipfile = nil
 	f.closed = true
-	f.buf = nil
+	f.cache = nil
 	if f.reader != nil {
 		err = f.reader.Close()
 		f.reader = nil
@@ -56,11 +109,15 @@ func (f *File) Read(p []byte) (n int, err error) {
 	if f.isdir {
 		return 0, syscall.EISDIR
 	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
 	if f.closed {
 		return 0, afero.ErrFileClosed
 	}
-	err = f.fillBuffer(f.offset + int64(len(p)))
-	n = copy(p, f.buf[f.offset:])
+	if len(p) == 0 {
+		return 0, nil
+	}
+	n, err = f.readAt(p, f.offset)
 	f.offset += int64(n)
 	return
 }
@@ -69,18 +126,26 @@ func (f *File) ReadAt(p []byte, off int64) (n int, err error) {
 	if f.isdir {
 		return 0, syscall.EISDIR
 	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
 	if f.closed {
 		return 0, afero.ErrFileClosed
 	}
-	err = f.fillBuffer(off + int64(len(p)))
-	n = copy(p, f.buf[int(off):])
-	return
+	if off < 0 {
+		return 0, &os.PathError{Op: "readat", Path: f.Name(), Err: syscall.EINVAL}
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	return f.readAt(p, off)
 }
 
 func (f *File) Seek(offset int64, whence int) (int64, error) {
 	if f.isdir {
 		return 0, syscall.EISDIR
 	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
 	if f.closed {
 		return 0, afero.ErrFileClosed
 	}
@@ -123,32 +188,34 @@ func (f *File) getDirEntries() (map[string]*zip.File, error) {
 	return entries, nil
 }
 
-func (f *File) Readdir(count int) (fi []os.FileInfo, err error) {
-	zipfiles, err := f.getDirEntries()
-	if err != nil {
-		return nil, err
-	}
-	for _, zipfile := range zipfiles {
-		fi = append(fi, zipfile.FileInfo())
-		if count > 0 && len(fi) >= count {
-			break
-		}
-	}
-	return
+func (f *File) Readdir(count int) ([]os.FileInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.dir.Readdir(count, f.listDir)
+}
+
+func (f *File) Readdirnames(count int) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.dir.Readdirnames(count, f.listDir)
 }
 
-func (f *File) Readdirnames(count int) (names []string, err error) {
+// listDir returns the entries of the directory, sorted by name.
+func (f *File) listDir() ([]os.FileInfo, error) {
 	zipfiles, err := f.getDirEntries()
 	if err != nil {
 		return nil, err
 	}
-	for filename := range zipfiles {
-		names = append(names, filename)
-		if count > 0 && len(names) >= count {
-			break
-		}
+	names := make([]string, 0, len(zipfiles))
+	for name := range zipfiles {
+		names = append(names, name)
 	}
-	return
+	sort.Strings(names)
+	fi := make([]os.FileInfo, len(names))
+	for i, name := range names {
+		fi[i] = zipfiles[name].FileInfo()
+	}
+	return fi, io.EOF
 }
 
 func (f *File) Stat() (os.FileInfo, error) {
@@ -2,8 +2,12 @@ package zipfs
 
 import (
 	"archive/zip"
+	"bytes"
 	"io"
+	"sync"
 	"testing"
+
+	"github.com/spf13/afero"
 )
 
 func TestFileRead(t *testing.T) {
@@ -41,3 +45,85 @@ func TestFileRead(t *testing.T) {
 		t.Errorf("Expected read length to be 0, found: %d", n)
 	}
 }
+
+func TestFileZeroLengthAndPastEnd(t *testing.T) {
+	zrc, err := zip.OpenReader("testdata/small.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	zfs := New(&zrc.Reader)
+	f, err := zfs.Open("smallFile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := f.Read(nil); n != 0 || err != nil {
+		t.Errorf("Read(0) = %d, %v, want 0, nil", n, err)
+	}
+	if n, err := f.ReadAt(nil, info.Size()+10); n != 0 || err != nil {
+		t.Errorf("ReadAt(0) past the end = %d, %v, want 0, nil", n, err)
+	}
+	if n, err := f.ReadAt(make([]byte, 4), info.Size()+10); n != 0 || err != io.EOF {
+		t.Errorf("ReadAt past the end = %d, %v, want 0, io.EOF", n, err)
+	}
+}
+
+func TestFileBlockCache(t *testing.T) {
+	content := make([]byte, 5*blockSize+123)
+	for i := range content {
+		content[i] = byte(i * 7 / 3)
+	}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, _ := zw.Create("big")
+	w.Write(content)
+	zw.Close()
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zfs := New(zr, WithBlockCache(2*blockSize))
+	shared, err := zfs.Open("big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer shared.Close()
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			own, err := zfs.Open("big")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer own.Close()
+			p := make([]byte, 1000)
+			// read backwards, so blocks are evicted and decompressed again
+			for off := int64(len(content) - 1000 - g); off >= 0; off -= blockSize / 3 {
+				for _, f := range []afero.File{shared, own} {
+					n, err := f.ReadAt(p, off)
+					if err != nil || n != len(p) || !bytes.Equal(p, content[off:off+1000]) {
+						t.Errorf("ReadAt(%d) = %d, %v, wrong content", off, n, err)
+						return
+					}
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	if c := zfs.(*Fs).cache; c.size > c.maxBytes {
+		t.Errorf("cache holds %d bytes, more than its %d", c.size, c.maxBytes)
+	}
+	if data, err := afero.ReadFile(zfs, "big"); err != nil || !bytes.Equal(data, content) {
+		t.Errorf("ReadFile = %d bytes, %v", len(data), err)
+	}
+}
@@ -8,11 +8,26 @@ import (
 	"time"
 
 	"github.com/spf13/afero"
+	"github.com/spf13/afero/internal/common"
 )
 
 type Fs struct {
 	r     *zip.Reader
 	files map[string]map[string]*zip.File
+	cache *blockCache
+}
+
+// Option configures an Fs created by New.
+type Option func(*Fs)
+
+// WithBlockCache makes all files opened from the Fs share a cache of up to
+// maxBytes of decompressed content, kept in blocks of 64 KiB. Without it,
+// every file handle keeps what it decompressed until it is closed, so
+// reopening a file, e.g. to serve it again, decompresses it again.
+func WithBlockCache(maxBytes int64) Option {
+	return func(fs *Fs) {
+		fs.cache = newBlockCache(maxBytes)
+	}
 }
 
 func splitpath(name string) (dir, file string) {
@@ -26,8 +41,14 @@ func splitpath(name string) (dir, file string) {
 	return
 }
 
-func New(r *zip.Reader) afero.Fs {
+// New returns a read-only Fs serving the files of the zip archive r. Files
+// are decompressed lazily, as far as they are read. File handles have
+// their own offsets and are safe for concurrent use.
+func New(r *zip.Reader, opts ...Option) afero.Fs {
 	fs := &Fs{r: r, files: make(map[string]map[string]*zip.File)}
+	for _, opt := range opts {
+		opt(fs)
+	}
 	for _, file := range r.File {
 		d, f := splitpath(file.Name)
 		if _, ok := fs.files[d]; !ok {
@@ -64,12 +85,16 @@ func (fs *Fs) Open(name string) (afero.File, error) {
 	if !ok {
 		return nil, &os.PathError{Op: "stat", Path: name, Err: syscall.ENOENT}
 	}
-	return &File{fs: fs, zipfile: file, isdir: file.FileInfo().IsDir()}, nil
+	cache := fs.cache
+	if cache == nil {
+		cache = newBlockCache(0)
+	}
+	return &File{fs: fs, zipfile: file, isdir: file.FileInfo().IsDir(), cache: cache}, nil
 }
 
 func (fs *Fs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
-	if flag != os.O_RDONLY {
-		return nil, syscall.EPERM
+	if common.ModifiesFs(flag) {
+		return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EPERM}
 	}
 	return fs.Open(name)
 }
@@ -87,7 +112,23 @@ func (p *pseudoRoot) Size() int64        { return 0 }
 func (p *pseudoRoot) Mode() os.FileMode  { return os.ModeDir | os.ModePerm }
 func (p *pseudoRoot) ModTime() time.Time { return time.Now() }
 func (p *pseudoRoot) IsDir() bool        { return true }
-func (p *pseudoRoot) Sys() interface{}   { return nil }
+
+// Sys returns a header for the root directory, which has no entry in the
+// archive.
+func (p *pseudoRoot) Sys() interface{} {
+	h := &zip.FileHeader{Name: "/"}
+	h.SetMode(p.Mode())
+	return h
+}
+
+// Header returns the *zip.FileHeader of the archive entry described by fi,
+// a FileInfo of an Fs, e.g. for its compression method, CRC-32 or extra
+// fields. It is what fi.Sys returns, and must not be modified. The root
+// directory, which has no entry, gets a header with just its name and mode.
+func Header(fi os.FileInfo) (*zip.FileHeader, bool) {
+	h, ok := fi.Sys().(*zip.FileHeader)
+	return h, ok
+}
 
 func (fs *Fs) Stat(name string) (os.FileInfo, error) {
 	d, f := splitpath(name)
@@ -0,0 +1,32 @@
+package zipfs
+
+import (
+	"archive/zip"
+	"context"
+	"net/url"
+	"os"
+
+	"github.com/spf13/afero"
+)
+
+// The zip scheme opens the archive at a local path with afero.OpenURL, as in
+// zip:///srv/assets.zip. The archive stays open as long as the process runs.
+func init() {
+	afero.RegisterScheme("zip", func(_ context.Context, u *url.URL) (afero.Fs, error) {
+		f, err := os.Open(u.Path)
+		if err != nil {
+			return nil, err
+		}
+		fi, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		r, err := zip.NewReader(f, fi.Size())
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return New(r), nil
+	})
+}
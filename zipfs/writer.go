@@ -0,0 +1,234 @@
+package zipfs
+
+import (
+	"archive/zip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/spf13/afero/internal/common"
+)
+
+// WriterFs builds a zip archive through the afero.Fs interface. Files are
+// staged in memory and added to the archive when they are closed; after
+// that they can still be read, but no longer be changed. Directories are
+// added when they are created.
+//
+// The archive is only valid after Close, which also adds all files that are
+// still open.
+type WriterFs struct {
+	mu      sync.Mutex
+	staging afero.Fs
+	zw      *zip.Writer
+	written map[string]bool
+	closed  bool
+}
+
+// NewWriter returns a WriterFs writing a zip archive to w.
+func NewWriter(w io.Writer) *WriterFs {
+	return &WriterFs{
+		staging: afero.NewMemMapFs(),
+		zw:      zip.NewWriter(w),
+		written: make(map[string]bool),
+	}
+}
+
+// zipName turns an Fs path into the name of a zip entry.
+func zipName(name string) string {
+	return strings.TrimPrefix(filepath.ToSlash(filepath.Clean("/"+name)), "/")
+}
+
+// writeEntry adds the named staged file or directory to the archive. The
+// caller must hold w.mu.
+func (w *WriterFs) writeEntry(name string) error {
+	zname := zipName(name)
+	if zname == "" || w.written[zname] {
+		return nil
+	}
+	if w.closed {
+		return &os.PathError{Op: "write", Path: name, Err: afero.ErrFileClosed}
+	}
+	fi, err := w.staging.Stat(name)
+	if err != nil {
+		return err
+	}
+	hdr, err := zip.FileInfoHeader(fi)
+	if err != nil {
+		return err
+	}
+	hdr.Name = zname
+	if fi.IsDir() {
+		hdr.Name += "/"
+	} else {
+		hdr.Method = zip.Deflate
+	}
+	zf, err := w.zw.CreateHeader(hdr)
+	if err != nil {
+		return err
+	}
+	w.written[zname] = true
+	if fi.IsDir() {
+		return nil
+	}
+	f, err := w.staging.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(zf, f)
+	return err
+}
+
+// Flush writes the entries added so far to the underlying writer.
+func (w *WriterFs) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return afero.ErrFileClosed
+	}
+	return w.zw.Flush()
+}
+
+// Close adds the files that are still open and writes the central directory
+// of the archive. It does not close the underlying writer.
+func (w *WriterFs) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return afero.ErrFileClosed
+	}
+	err := afero.Walk(w.staging, "/", func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		return w.writeEntry(path)
+	})
+	if err != nil {
+		return err
+	}
+	w.closed = true
+	return w.zw.Close()
+}
+
+// readOnly fails with EPERM if the named file is already in the archive.
+func (w *WriterFs) readOnly(op, name string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed || w.written[zipName(name)] {
+		return &os.PathError{Op: op, Path: name, Err: syscall.EPERM}
+	}
+	return nil
+}
+
+func (w *WriterFs) Name() string { return "zipfs.WriterFs" }
+
+func (w *WriterFs) Create(name string) (afero.File, error) {
+	return w.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o666)
+}
+
+func (w *WriterFs) Open(name string) (afero.File, error) {
+	return w.staging.Open(name)
+}
+
+func (w *WriterFs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	if !common.ModifiesFs(flag) {
+		return w.staging.OpenFile(name, flag, perm)
+	}
+	if err := w.readOnly("open", name); err != nil {
+		return nil, err
+	}
+	f, err := w.staging.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &WriterFile{File: f, fs: w, name: name}, nil
+}
+
+func (w *WriterFs) Mkdir(name string, perm os.FileMode) error {
+	if err := w.staging.Mkdir(name, perm); err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.writeEntry(name)
+}
+
+func (w *WriterFs) MkdirAll(path string, perm os.FileMode) error {
+	if err := w.staging.MkdirAll(path, perm); err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var dirs []string
+	for dir := filepath.Clean("/" + path); dir != "/" && dir != "."; dir = filepath.Dir(dir) {
+		dirs = append(dirs, dir)
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := w.writeEntry(dirs[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *WriterFs) Remove(name string) error {
+	if err := w.readOnly("remove", name); err != nil {
+		return err
+	}
+	return w.staging.Remove(name)
+}
+
+func (w *WriterFs) RemoveAll(path string) error {
+	return &os.PathError{Op: "RemoveAll", Path: path, Err: syscall.EPERM}
+}
+
+func (w *WriterFs) Rename(oldname, newname string) error {
+	return &os.PathError{Op: "rename", Path: oldname, Err: syscall.EPERM}
+}
+
+func (w *WriterFs) Stat(name string) (os.FileInfo, error) {
+	return w.staging.Stat(name)
+}
+
+func (w *WriterFs) Chmod(name string, mode os.FileMode) error {
+	if err := w.readOnly("chmod", name); err != nil {
+		return err
+	}
+	return w.staging.Chmod(name, mode)
+}
+
+func (w *WriterFs) Chown(name string, uid, gid int) error {
+	if err := w.readOnly("chown", name); err != nil {
+		return err
+	}
+	return w.staging.Chown(name, uid, gid)
+}
+
+func (w *WriterFs) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	if err := w.readOnly("chtimes", name); err != nil {
+		return err
+	}
+	return w.staging.Chtimes(name, atime, mtime)
+}
+
+// WriterFile is a file of a WriterFs opened for writing. Closing it adds it
+// to the archive.
+type WriterFile struct {
+	afero.File
+	fs   *WriterFs
+	name string
+}
+
+func (f *WriterFile) Close() error {
+	if err := f.File.Close(); err != nil {
+		return err
+	}
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	return f.fs.writeEntry(f.name)
+}
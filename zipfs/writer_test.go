@@ -0,0 +1,76 @@
+package zipfs
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+
+	if err := w.MkdirAll("/dir/sub", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := afero.WriteFile(w, "/dir/sub/file.txt", []byte("hello zip"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Closed files are in the archive and can no longer be changed.
+	if _, err := w.OpenFile("/dir/sub/file.txt", os.O_WRONLY, 0); !os.IsPermission(err) {
+		t.Errorf("reopening a written file: got %v, want permission error", err)
+	}
+	if got, err := afero.ReadFile(w, "/dir/sub/file.txt"); err != nil || string(got) != "hello zip" {
+		t.Errorf("reading a written file: %q, %v", got, err)
+	}
+
+	// Files still open are added by Close.
+	f, err := w.Create("/open.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("still open")
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != afero.ErrFileClosed {
+		t.Errorf("second Close = %v, want %v", err, afero.ErrFileClosed)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, zf := range zr.File {
+		names = append(names, zf.Name)
+	}
+	want := []string{"dir/", "dir/sub/", "dir/sub/file.txt", "open.txt"}
+	if len(names) != len(want) {
+		t.Fatalf("entries = %v, want %v", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("entries = %v, want %v", names, want)
+		}
+	}
+
+	zfs := New(zr)
+	if got, err := afero.ReadFile(zfs, "/dir/sub/file.txt"); err != nil || string(got) != "hello zip" {
+		t.Errorf("read back %q, %v", got, err)
+	}
+	if got, err := afero.ReadFile(zfs, "/open.txt"); err != nil || string(got) != "still open" {
+		t.Errorf("read back %q, %v", got, err)
+	}
+	if fi, err := zfs.Stat("/dir/sub/file.txt"); err != nil || fi.Mode().Perm() != 0o644 {
+		t.Errorf("Stat = %v, %v, want mode 0644", fi, err)
+	}
+}
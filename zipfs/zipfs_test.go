@@ -2,11 +2,13 @@ package zipfs
 
 import (
 	"archive/zip"
+	"context"
 	"path/filepath"
 	"reflect"
 	"testing"
 
 	"github.com/spf13/afero"
+	"github.com/spf13/afero/aferotest"
 )
 
 func TestZipFS(t *testing.T) {
@@ -16,6 +18,7 @@ func TestZipFS(t *testing.T) {
 	}
 	zfs := New(&zrc.Reader)
 	a := &afero.Afero{Fs: zfs}
+	aferotest.CheckReaddir(t, zfs, "/")
 
 	buf, err := a.ReadFile("testFile")
 	if err != nil {
@@ -101,3 +104,46 @@ func TestZipFS(t *testing.T) {
 		}
 	}
 }
+
+func TestZipFSHeader(t *testing.T) {
+	zrc, err := zip.OpenReader("testdata/t.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zrc.Close()
+	zfs := New(&zrc.Reader)
+
+	fi, err := zfs.Stat("/testFile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, ok := Header(fi)
+	if !ok || h.Method != zip.Deflate || h.CRC32 != 0xd0504ccd || h.UncompressedSize64 != 8192 {
+		t.Errorf("Header = %+v, %v", h, ok)
+	}
+	infos, err := afero.ReadDir(zfs, "/sub")
+	if err != nil || len(infos) != 1 {
+		t.Fatalf("ReadDir = %v, %v", infos, err)
+	}
+	if h, ok := Header(infos[0]); !ok || h.Name != "sub/testDir2/" {
+		t.Errorf("Header of a listed entry = %+v, %v", h, ok)
+	}
+	root, _ := zfs.Stat("/")
+	if h, ok := Header(root); !ok || !h.Mode().IsDir() {
+		t.Errorf("Header of the root = %+v, %v", h, ok)
+	}
+}
+
+func TestOpenURL(t *testing.T) {
+	path, err := filepath.Abs("testdata/t.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	zfs, err := afero.OpenURL(context.Background(), "zip://"+filepath.ToSlash(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf, err := afero.ReadFile(zfs, "testFile"); err != nil || len(buf) != 8192 {
+		t.Errorf("ReadFile = %d bytes, %v, want 8192 bytes", len(buf), err)
+	}
+}
@@ -0,0 +1,94 @@
+package zstdfs
+
+import (
+	"io"
+	"os"
+
+	"github.com/spf13/afero"
+	"github.com/spf13/afero/mem"
+)
+
+// File is a regular file of an Fs. Its uncompressed content is held in
+// memory, shared with the other handles of the file; for writable files it
+// is compressed and written to the base Fs by Sync and Close.
+type File struct {
+	*mem.File
+	fs       *Fs
+	name     string
+	of       *openFile
+	writable bool
+	closed   bool
+}
+
+func (f *File) Name() string {
+	return f.name
+}
+
+func (f *File) Stat() (os.FileInfo, error) {
+	fi, err := f.fs.base.Stat(f.name)
+	if err != nil {
+		return nil, err
+	}
+	memfi, err := f.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return &FileInfo{FileInfo: fi, size: memfi.Size()}, nil
+}
+
+// Sync compresses the current content and writes it to the base Fs.
+func (f *File) Sync() error {
+	if f.closed {
+		return afero.ErrFileClosed
+	}
+	if !f.writable {
+		return nil
+	}
+	// Read through a handle of its own, f may be write-only.
+	r := mem.NewReadOnlyFileHandle(f.of.data)
+	data := make([]byte, mem.GetFileInfo(f.of.data).Size())
+	if _, err := r.ReadAt(data, 0); err != nil && err != io.EOF {
+		return err
+	}
+	return f.fs.store(f.name, data)
+}
+
+func (f *File) Close() error {
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	f.closed = true
+	f.fs.release(f.name, f.of)
+	return f.File.Close()
+}
+
+// Dir is a directory of an Fs. Readdir reports the uncompressed sizes of
+// the files.
+type Dir struct {
+	afero.File
+	fs *Fs
+}
+
+func (d *Dir) Readdir(count int) ([]os.FileInfo, error) {
+	fis, err := d.File.Readdir(count)
+	for i, fi := range fis {
+		name := afero.Join(d.fs, d.File.Name(), fi.Name())
+		zfi, ferr := d.fs.fileInfo(name, fi)
+		if ferr != nil {
+			return nil, ferr
+		}
+		fis[i] = zfi
+	}
+	return fis, err
+}
+
+// FileInfo reports the uncompressed size of a file, everything else comes
+// from the base Fs.
+type FileInfo struct {
+	os.FileInfo
+	size int64
+}
+
+func (fi *FileInfo) Size() int64 {
+	return fi.size
+}
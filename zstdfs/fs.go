@@ -0,0 +1,351 @@
+// Package zstdfs provides a writable afero.Fs that stores file contents
+// zstd compressed in a base Fs.
+package zstdfs
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/spf13/afero"
+	"github.com/spf13/afero/mem"
+)
+
+// Fs compresses the content of files when they are closed and decompresses
+// it when they are opened. Directories, permissions and times are those of
+// the base Fs; FileInfo sizes are uncompressed sizes.
+//
+// The content of an open file is held in memory and shared by its handles,
+// changes reach the base Fs on Sync and Close.
+type Fs struct {
+	base afero.Fs
+	enc  *zstd.Encoder
+
+	mu   sync.Mutex
+	open map[string]*openFile
+
+	level zstd.EncoderLevel
+	exts  []string
+	skip  []string
+}
+
+// Option configures an Fs created by New.
+type Option func(*Fs)
+
+// WithLevel sets the compression level, the default is
+// zstd.SpeedDefault.
+func WithLevel(level zstd.EncoderLevel) Option {
+	return func(fs *Fs) {
+		fs.level = level
+	}
+}
+
+// WithExtensions restricts compression to files with one of the given
+// extensions, e.g. ".log". Other files are passed through unchanged.
+func WithExtensions(exts ...string) Option {
+	return func(fs *Fs) {
+		fs.exts = append(fs.exts, exts...)
+	}
+}
+
+// WithSkipExtensions excludes files with one of the given extensions from
+// compression, e.g. already compressed formats like ".jpg" or ".gz".
+func WithSkipExtensions(exts ...string) Option {
+	return func(fs *Fs) {
+		fs.skip = append(fs.skip, exts...)
+	}
+}
+
+func New(base afero.Fs, opts ...Option) afero.Fs {
+	fs := &Fs{base: base, level: zstd.SpeedDefault, open: make(map[string]*openFile)}
+	for _, opt := range opts {
+		opt(fs)
+	}
+	// NewWriter only fails on invalid options.
+	fs.enc, _ = zstd.NewWriter(nil, zstd.WithEncoderLevel(fs.level))
+	return fs
+}
+
+// openFile is the uncompressed content of an open file, shared by refs
+// handles.
+type openFile struct {
+	data *mem.FileData
+	refs int
+}
+
+func hasExt(name string, exts []string) bool {
+	ext := filepath.Ext(name)
+	for _, e := range exts {
+		if strings.EqualFold(ext, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// compressed reports whether the content of the named file is stored
+// compressed.
+func (fs *Fs) compressed(name string) bool {
+	if len(fs.exts) > 0 && !hasExt(name, fs.exts) {
+		return false
+	}
+	return !hasExt(name, fs.skip)
+}
+
+// load reads and decompresses the content of the named file.
+func (fs *Fs) load(name string) ([]byte, error) {
+	raw, err := afero.ReadFile(fs.base, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	// A decoder runs goroutines until it is closed, so none is kept
+	// between loads. NewReader only fails on invalid options.
+	dec, _ := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+	defer dec.Close()
+	data, err := dec.DecodeAll(raw, nil)
+	if err != nil {
+		return nil, &os.PathError{Op: "read", Path: name, Err: err}
+	}
+	return data, nil
+}
+
+// store compresses data and writes it to the named file.
+func (fs *Fs) store(name string, data []byte) error {
+	f, err := fs.base.OpenFile(name, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(fs.enc.EncodeAll(data, nil)); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// size returns the uncompressed size of the named file, preferably from the
+// frame header.
+func (fs *Fs) size(name string) (int64, error) {
+	f, err := fs.base.Open(name)
+	if err != nil {
+		return 0, err
+	}
+	buf := make([]byte, zstd.HeaderMaxSize)
+	n, err := io.ReadFull(f, buf)
+	f.Close()
+	if n == 0 {
+		return 0, nil
+	}
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return 0, err
+	}
+	var h zstd.Header
+	if h.Decode(buf[:n]) == nil && h.HasFCS {
+		return int64(h.FrameContentSize), nil
+	}
+	data, err := fs.load(name)
+	return int64(len(data)), err
+}
+
+// fileInfo reports the uncompressed size of a regular file.
+func (fs *Fs) fileInfo(name string, fi os.FileInfo) (os.FileInfo, error) {
+	if !fi.Mode().IsRegular() || !fs.compressed(name) {
+		return fi, nil
+	}
+	size, err := fs.size(name)
+	if err != nil {
+		return nil, err
+	}
+	return &FileInfo{FileInfo: fi, size: size}, nil
+}
+
+func (fs *Fs) Name() string { return "ZstdFs" }
+
+// Unwrap returns the base Fs, which holds the compressed content.
+func (fs *Fs) Unwrap() afero.Fs {
+	return fs.base
+}
+
+// Capabilities returns none: files are decompressed whole when opened, and
+// Rename rewrites files whose compression changes.
+func (fs *Fs) Capabilities() afero.Capability {
+	return 0
+}
+
+func (fs *Fs) Create(name string) (afero.File, error) {
+	return fs.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o666)
+}
+
+func (fs *Fs) Open(name string) (afero.File, error) {
+	return fs.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (fs *Fs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	// Let the base Fs check the flags, create the file and, if requested,
+	// truncate it.
+	bf, err := fs.base.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := bf.Stat()
+	if err != nil {
+		bf.Close()
+		return nil, err
+	}
+	if fi.IsDir() {
+		return &Dir{File: bf, fs: fs}, nil
+	}
+	if !fs.compressed(name) {
+		return bf, nil
+	}
+	if err := bf.Close(); err != nil {
+		return nil, err
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	of := fs.open[name]
+	if of == nil {
+		data, err := fs.load(name)
+		if err != nil {
+			return nil, err
+		}
+		of = &openFile{data: mem.CreateFile(name)}
+		if err := mem.SetBytes(of.data, data); err != nil {
+			return nil, err
+		}
+		fs.open[name] = of
+	} else if flag&os.O_TRUNC != 0 {
+		// The base Fs truncated the file, the handles open on it see that.
+		if err := mem.SetBytes(of.data, nil); err != nil {
+			return nil, err
+		}
+	}
+	of.refs++
+	return &File{
+		File:     mem.NewFileHandleFlag(of.data, flag),
+		fs:       fs,
+		name:     name,
+		of:       of,
+		writable: flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND) != 0,
+	}, nil
+}
+
+// release drops a handle of of, and of itself with its last handle.
+func (fs *Fs) release(name string, of *openFile) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	of.refs--
+	if of.refs == 0 && fs.open[name] == of {
+		delete(fs.open, name)
+	}
+}
+
+// forget drops the open content of name and the files below it, which were
+// removed or renamed in the base Fs: files opened after that do not share
+// it. The open handles keep it.
+func (fs *Fs) forget(name string) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	prefix := strings.TrimSuffix(name, "/") + "/"
+	for n := range fs.open {
+		if n == name || strings.HasPrefix(n, prefix) {
+			delete(fs.open, n)
+		}
+	}
+}
+
+func (fs *Fs) Mkdir(name string, perm os.FileMode) error {
+	return fs.base.Mkdir(name, perm)
+}
+
+func (fs *Fs) MkdirAll(path string, perm os.FileMode) error {
+	return fs.base.MkdirAll(path, perm)
+}
+
+func (fs *Fs) Remove(name string) error {
+	if err := fs.base.Remove(name); err != nil {
+		return err
+	}
+	fs.forget(name)
+	return nil
+}
+
+func (fs *Fs) RemoveAll(path string) error {
+	if err := fs.base.RemoveAll(path); err != nil {
+		return err
+	}
+	fs.forget(path)
+	return nil
+}
+
+// Rename renames a file. If only one of the names is compressed, the content
+// is rewritten accordingly.
+func (fs *Fs) Rename(oldname, newname string) error {
+	if err := fs.rename(oldname, newname); err != nil {
+		return err
+	}
+	fs.forget(oldname)
+	fs.forget(newname)
+	return nil
+}
+
+func (fs *Fs) rename(oldname, newname string) error {
+	if fs.compressed(oldname) == fs.compressed(newname) {
+		return fs.base.Rename(oldname, newname)
+	}
+	fi, err := fs.base.Stat(oldname)
+	if err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		return fs.base.Rename(oldname, newname)
+	}
+
+	var data []byte
+	if fs.compressed(oldname) {
+		data, err = fs.load(oldname)
+	} else {
+		data, err = afero.ReadFile(fs.base, oldname)
+	}
+	if err != nil {
+		return err
+	}
+	if fs.compressed(newname) {
+		data = fs.enc.EncodeAll(data, nil)
+	}
+	if fi, err := fs.base.Stat(newname); err == nil && fi.IsDir() {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: syscall.EISDIR}
+	}
+	if err := afero.WriteFile(fs.base, newname, data, fi.Mode().Perm()); err != nil {
+		return err
+	}
+	return fs.base.Remove(oldname)
+}
+
+func (fs *Fs) Stat(name string) (os.FileInfo, error) {
+	fi, err := fs.base.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	return fs.fileInfo(name, fi)
+}
+
+func (fs *Fs) Chmod(name string, mode os.FileMode) error {
+	return fs.base.Chmod(name, mode)
+}
+
+func (fs *Fs) Chown(name string, uid, gid int) error {
+	return fs.base.Chown(name, uid, gid)
+}
+
+func (fs *Fs) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	return fs.base.Chtimes(name, atime, mtime)
+}
@@ -0,0 +1,193 @@
+package zstdfs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/spf13/afero/aferotest"
+)
+
+var content = bytes.Repeat([]byte("afero zstd "), 1000)
+
+func TestRoundTrip(t *testing.T) {
+	base := afero.NewMemMapFs()
+	zfs := New(base)
+
+	if err := afero.WriteFile(zfs, "/dir/file.txt", content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := afero.ReadFile(base, "/dir/file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(raw) >= len(content) {
+		t.Errorf("stored %d bytes for %d bytes of content", len(raw), len(content))
+	}
+
+	got, err := afero.ReadFile(zfs, "/dir/file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("read back %d bytes, want the %d bytes written", len(got), len(content))
+	}
+
+	fi, err := zfs.Stat("/dir/file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() != int64(len(content)) {
+		t.Errorf("Stat size = %d, want %d", fi.Size(), len(content))
+	}
+
+	fis, err := afero.ReadDir(zfs, "/dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fis) != 1 || fis[0].Size() != int64(len(content)) {
+		t.Errorf("ReadDir = %v, want file.txt with size %d", fis, len(content))
+	}
+}
+
+func TestAppend(t *testing.T) {
+	zfs := New(afero.NewMemMapFs())
+	if err := afero.WriteFile(zfs, "/file", []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := zfs.OpenFile("/file", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte(" world")); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != afero.ErrFileClosed {
+		t.Errorf("second Close = %v, want %v", err, afero.ErrFileClosed)
+	}
+
+	got, err := afero.ReadFile(zfs, "/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "hello world" {
+		t.Errorf("got %q, want %q", got, "hello world")
+	}
+
+	if _, err := zfs.OpenFile("/file", os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644); !os.IsExist(err) {
+		t.Errorf("O_EXCL on existing file: got %v, want exist error", err)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	aferotest.Conformance(t, func(t *testing.T) afero.Fs {
+		return New(afero.NewMemMapFs())
+	}, 0)
+}
+
+func TestReadOnlyOpen(t *testing.T) {
+	zfs := New(afero.NewMemMapFs())
+	if err := afero.WriteFile(zfs, "/file", content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := zfs.Open("/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.Write([]byte("x")); err == nil {
+		t.Error("write to a file opened read-only succeeded")
+	}
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(f, buf); err != nil || string(buf) != "afero" {
+		t.Errorf("Read = %q, %v, want %q", buf, err, "afero")
+	}
+}
+
+func TestExtensions(t *testing.T) {
+	base := afero.NewMemMapFs()
+	zfs := New(base, WithExtensions(".log"))
+
+	for _, name := range []string{"/a.log", "/b.jpg"} {
+		if err := afero.WriteFile(zfs, name, content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if raw, _ := afero.ReadFile(base, "/b.jpg"); !bytes.Equal(raw, content) {
+		t.Error("b.jpg should be stored uncompressed")
+	}
+	if raw, _ := afero.ReadFile(base, "/a.log"); bytes.Equal(raw, content) {
+		t.Error("a.log should be stored compressed")
+	}
+
+	// Renaming across the filter rewrites the content.
+	if err := zfs.Rename("/a.log", "/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if raw, _ := afero.ReadFile(base, "/a.txt"); !bytes.Equal(raw, content) {
+		t.Error("a.txt should be stored uncompressed after rename")
+	}
+	if _, err := base.Stat("/a.log"); !os.IsNotExist(err) {
+		t.Errorf("a.log still exists after rename: %v", err)
+	}
+
+	skip := New(afero.NewMemMapFs(), WithSkipExtensions(".JPG"))
+	if skip.(*Fs).compressed("/photo.jpg") || !skip.(*Fs).compressed("/notes.txt") {
+		t.Error("WithSkipExtensions should exclude .jpg files only")
+	}
+}
+
+// partialDirFs returns directories whose Readdir fails after the entries.
+type partialDirFs struct {
+	afero.Fs
+}
+
+var errPartial = errors.New("partial listing")
+
+func (fs partialDirFs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	f, err := fs.Fs.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	if fi, err := f.Stat(); err == nil && fi.IsDir() {
+		return partialDir{f}, nil
+	}
+	return f, nil
+}
+
+type partialDir struct {
+	afero.File
+}
+
+func (d partialDir) Readdir(count int) ([]os.FileInfo, error) {
+	fis, _ := d.File.Readdir(count)
+	return fis, errPartial
+}
+
+func TestReaddirError(t *testing.T) {
+	base := afero.NewMemMapFs()
+	zfs := New(partialDirFs{base})
+	if err := afero.WriteFile(zfs, "/dir/file.txt", content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	d, err := zfs.Open("/dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	fis, err := d.Readdir(-1)
+	if err != errPartial {
+		t.Errorf("Readdir error = %v, want %v", err, errPartial)
+	}
+	if len(fis) != 1 || fis[0].Size() != int64(len(content)) {
+		t.Errorf("Readdir = %v, want file.txt with size %d", fis, len(content))
+	}
+}